@@ -176,6 +176,19 @@ const (
 	HighestCapabilityVersion = LINUX_CAPABILITY_VERSION_3
 )
 
+// Securebits defined by Linux. Taken from the kernel's
+// include/uapi/linux/securebits.h.
+const (
+	SECBIT_NOROOT                      = 1 << 0
+	SECBIT_NOROOT_LOCKED               = 1 << 1
+	SECBIT_NO_SETUID_FIXUP             = 1 << 2
+	SECBIT_NO_SETUID_FIXUP_LOCKED      = 1 << 3
+	SECBIT_KEEP_CAPS                   = 1 << 4
+	SECBIT_KEEP_CAPS_LOCKED            = 1 << 5
+	SECBIT_NO_CAP_AMBIENT_RAISE        = 1 << 6
+	SECBIT_NO_CAP_AMBIENT_RAISE_LOCKED = 1 << 7
+)
+
 // CapUserHeader is equivalent to Linux's cap_user_header_t.
 //
 // +marshal
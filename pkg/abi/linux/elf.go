@@ -156,3 +156,35 @@ type ElfProg64 struct {
 	Memsz  uint64 // Size of contents in memory.
 	Align  uint64 // Alignment in memory and file.
 }
+
+// ElfSiginfo is struct elf_siginfo, from include/uapi/linux/elfcore.h.
+//
+// +marshal
+type ElfSiginfo struct {
+	Signo int32 // Signal number.
+	Code  int32 // Extra code.
+	Errno int32 // Errno.
+}
+
+// PrStatus is struct elf_prstatus, the contents of the NT_PRSTATUS note of
+// core dumps, from include/linux/elfcore.h.
+//
+// +marshal
+type PrStatus struct {
+	Info    ElfSiginfo // Info associated with the signal.
+	Cursig  int16      // Current signal.
+	_       [2]byte
+	Sigpend uint64     // Set of pending signals.
+	Sighold uint64     // Set of held signals.
+	Pid     int32      // Thread ID.
+	Ppid    int32      // Parent's process ID.
+	Pgrp    int32      // Process group ID.
+	Sid     int32      // Session ID.
+	Utime   Timeval    // User time.
+	Stime   Timeval    // System time.
+	Cutime  Timeval    // Cumulative user time.
+	Cstime  Timeval    // Cumulative system time.
+	Regs    PtraceRegs // General purpose registers.
+	Fpvalid int32      // True if math co-processor being used.
+	_       [4]byte
+}
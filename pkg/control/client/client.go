@@ -22,12 +22,28 @@ import (
 
 // ConnectTo attempts to connect to the sandbox with the given address.
 func ConnectTo(addr string) (*urpc.Client, error) {
+	return ConnectToWithToken(addr, nil)
+}
+
+// ConnectToWithToken attempts to connect to the sandbox with the given address
+// and authenticates with token, which must match the one given to the server
+// with Server.SetToken. No token is sent if it's empty.
+func ConnectToWithToken(addr string, token []byte) (*urpc.Client, error) {
 	// Connect to the server.
 	conn, err := unet.Connect(addr, false)
 	if err != nil {
 		return nil, err
 	}
 
+	for buf := token; len(buf) > 0; {
+		n, err := conn.Write(buf)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		buf = buf[n:]
+	}
+
 	// Wrap in our stream codec.
 	return urpc.NewClient(conn), nil
 }
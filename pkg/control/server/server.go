@@ -21,6 +21,9 @@ implementations of the control interface.
 package server
 
 import (
+	"crypto/subtle"
+	"fmt"
+	"io"
 	"os"
 	"time"
 
@@ -33,6 +36,9 @@ import (
 // curUID is the unix user ID of the user that the control server is running as.
 var curUID = os.Getuid()
 
+// authTimeout is how long a client has to send the token after connecting.
+const authTimeout = 5 * time.Second
+
 // Server is a basic control server.
 type Server struct {
 	// socket is our bound socket.
@@ -41,8 +47,23 @@ type Server struct {
 	// server is our rpc server.
 	server *urpc.Server
 
-	// wg waits for the accept loop to terminate.
+	// token, if set, must be sent by clients right after connecting. It's
+	// immutable once serving starts.
+	token []byte
+
+	// wg waits for the accept loop and the goroutines authenticating
+	// connections to terminate.
 	wg sync.WaitGroup
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// authenticating holds the connections waiting for their token.
+	authenticating map[*unet.Socket]struct{}
+
+	// stopped is set by Stop. Connections are no longer authenticated once
+	// it's set.
+	stopped bool
 }
 
 // New returns a new bound control server.
@@ -58,8 +79,8 @@ func (s *Server) FD() int {
 	return s.socket.FD()
 }
 
-// Wait waits for the main server goroutine to exit. This should be
-// called after a call to Serve.
+// Wait waits for the main server goroutine, and the goroutines authenticating
+// connections, to exit. This should be called after a call to Serve.
 func (s *Server) Wait() {
 	s.wg.Wait()
 }
@@ -68,6 +89,15 @@ func (s *Server) Wait() {
 // and the server should not be used afterwards.
 func (s *Server) Stop(timeout time.Duration) {
 	s.socket.Close()
+
+	// Close the connections that haven't sent their token yet, so that their
+	// goroutines exit.
+	s.mu.Lock()
+	s.stopped = true
+	for conn := range s.authenticating {
+		conn.Close()
+	}
+	s.mu.Unlock()
 	s.Wait()
 
 	// This will cause existing clients to be terminated safely. If the
@@ -75,6 +105,13 @@ func (s *Server) Stop(timeout time.Duration) {
 	s.server.Stop(timeout)
 }
 
+// SetToken sets the token that clients must send right after connecting, see
+// client.ConnectToWithToken. Connections that don't send it are closed before
+// any request is handled. It must be called before StartServing.
+func (s *Server) SetToken(token []byte) {
+	s.token = append([]byte(nil), token...)
+}
+
 // StartServing starts listening for connect and spawns the main service
 // goroutine for handling incoming control requests. StartServing does not
 // block; to wait for the control server to exit, call Wait.
@@ -118,11 +155,62 @@ func (s *Server) serve() {
 			continue
 		}
 
-		// Handle the connection non-blockingly.
-		s.server.StartHandling(conn)
+		if len(s.token) == 0 {
+			// Handle the connection non-blockingly.
+			s.server.StartHandling(conn)
+			continue
+		}
+
+		// Don't block accepting other clients while waiting for the token.
+		s.mu.Lock()
+		if s.stopped {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		if s.authenticating == nil {
+			s.authenticating = make(map[*unet.Socket]struct{})
+		}
+		s.authenticating[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go func() { // S/R-SAFE: does not impact state directly.
+			defer s.wg.Done()
+			err := s.authenticate(conn)
+			s.mu.Lock()
+			delete(s.authenticating, conn)
+			stopped := s.stopped
+			s.mu.Unlock()
+			if err != nil || stopped {
+				if !stopped {
+					log.Warningf("Control auth failure: %v", err)
+				}
+				conn.Close()
+				return
+			}
+			s.server.StartHandling(conn)
+		}()
 	}
 }
 
+// authenticate reads the token from conn and checks that it matches s.token.
+func (s *Server) authenticate(conn *unet.Socket) error {
+	// Closing conn unblocks the read below if the client takes too long.
+	timer := time.AfterFunc(authTimeout, func() { conn.Close() })
+	buf := make([]byte, len(s.token))
+	_, err := io.ReadFull(conn, buf)
+	if !timer.Stop() {
+		return fmt.Errorf("timed out waiting for token")
+	}
+	if err != nil {
+		return fmt.Errorf("reading token: %v", err)
+	}
+	if subtle.ConstantTimeCompare(buf, s.token) != 1 {
+		return fmt.Errorf("invalid token")
+	}
+	return nil
+}
+
 // Register registers a specific control interface with the server.
 func (s *Server) Register(obj interface{}) {
 	s.server.Register(obj)
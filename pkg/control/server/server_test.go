@@ -0,0 +1,112 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/control/client"
+	"gvisor.dev/gvisor/pkg/unet"
+)
+
+type echo struct{}
+
+// Echo returns its argument.
+func (*echo) Echo(arg *string, out *string) error {
+	*out = *arg
+	return nil
+}
+
+func TestToken(t *testing.T) {
+	addr := fmt.Sprintf("\x00control-server-test.%d", rand.Int())
+	srv, err := Create(addr)
+	if err != nil {
+		t.Fatalf("Create(): %v", err)
+	}
+	srv.SetToken([]byte("secret"))
+	srv.Register(&echo{})
+	if err := srv.StartServing(); err != nil {
+		t.Fatalf("StartServing(): %v", err)
+	}
+	defer srv.Stop(time.Second)
+
+	for _, tc := range []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "valid", token: "secret"},
+		{name: "invalid", token: "public", wantErr: true},
+		{name: "none", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, err := client.ConnectToWithToken(addr, []byte(tc.token))
+			if err != nil {
+				t.Fatalf("ConnectToWithToken(): %v", err)
+			}
+			defer conn.Close()
+
+			arg, out := "hello", ""
+			err = conn.Call("echo.Echo", &arg, &out)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Call() succeeded, want error")
+				}
+				return
+			}
+			if err != nil || out != arg {
+				t.Errorf("Call() = %q, %v, want %q, nil", out, err, arg)
+			}
+		})
+	}
+}
+
+// TestStopWhileAuthenticating checks that Stop doesn't wait for clients that
+// haven't sent their token.
+func TestStopWhileAuthenticating(t *testing.T) {
+	addr := fmt.Sprintf("\x00control-server-test.%d", rand.Int())
+	srv, err := Create(addr)
+	if err != nil {
+		t.Fatalf("Create(): %v", err)
+	}
+	srv.SetToken([]byte("secret"))
+	if err := srv.StartServing(); err != nil {
+		t.Fatalf("StartServing(): %v", err)
+	}
+
+	conn, err := unet.Connect(addr, false)
+	if err != nil {
+		t.Fatalf("Connect(): %v", err)
+	}
+	defer conn.Close()
+	for {
+		srv.mu.Lock()
+		n := len(srv.authenticating)
+		srv.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	start := time.Now()
+	srv.Stop(time.Second)
+	if d := time.Since(start); d >= authTimeout {
+		t.Errorf("Stop() took %v, want less than %v", d, authTimeout)
+	}
+}
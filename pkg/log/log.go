@@ -255,18 +255,30 @@ func Log() *BasicLogger {
 
 // SetTarget sets the log target.
 //
-// This is not thread safe and shouldn't be called concurrently with any
-// logging calls.
+// Logging calls racing with SetTarget emit to either the old or the new
+// target.
 func SetTarget(target Emitter) {
 	logMu.Lock()
 	defer logMu.Unlock()
 	oldLog := Log()
-	log.Store(&BasicLogger{Level: oldLog.Level, Emitter: target})
+	level := Level(atomic.LoadUint32((*uint32)(&oldLog.Level)))
+	log.Store(&BasicLogger{Level: level, Emitter: target})
 }
 
 // SetLevel sets the log level.
 func SetLevel(newLevel Level) {
-	Log().SetLevel(newLevel)
+	SwapLevel(newLevel)
+}
+
+// SwapLevel sets the log level and returns the previous one.
+//
+// Logging calls racing with SwapLevel use either the old or the new level.
+// It is serialized with SetTarget so that the new level isn't lost by a
+// concurrent switch to a new target.
+func SwapLevel(newLevel Level) Level {
+	logMu.Lock()
+	defer logMu.Unlock()
+	return Level(atomic.SwapUint32((*uint32)(&Log().Level), uint32(newLevel)))
 }
 
 // Debugf logs to the global logger.
@@ -90,6 +90,31 @@ func TestCaller(t *testing.T) {
 	}
 }
 
+func TestSwapLevel(t *testing.T) {
+	orig := Log()
+	defer log.Store(orig)
+	log.Store(&BasicLogger{Level: Info, Emitter: orig.Emitter})
+
+	if old := SwapLevel(Debug); old != Info {
+		t.Errorf("SwapLevel(Debug) = %v, want %v", old, Info)
+	}
+	if !IsLogging(Debug) {
+		t.Errorf("IsLogging(Debug) = false after SwapLevel(Debug)")
+	}
+
+	// The level carries over to a new target.
+	tw := &testWriter{}
+	SetTarget(GoogleEmitter{Writer: &Writer{Next: tw}})
+	Debugf("debug")
+	if old := SwapLevel(Warning); old != Debug {
+		t.Errorf("SwapLevel(Warning) = %v, want %v", old, Debug)
+	}
+	Infof("info")
+	if len(tw.lines) != 1 || !strings.Contains(tw.lines[0], "debug") {
+		t.Errorf("got lines %q, want only the debug message", tw.lines)
+	}
+}
+
 func BenchmarkGoogleLogging(b *testing.B) {
 	tw := &testWriter{
 		limit: 1, // Only record one message.
@@ -15,22 +15,82 @@
 package control
 
 import (
+	"fmt"
+	"time"
+
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sync"
 )
 
 // Lifecycle provides functions related to starting and stopping tasks.
 type Lifecycle struct {
 	Kernel *kernel.Kernel
+
+	// mu protects paused and serializes Pause and Resume.
+	mu sync.Mutex
+
+	// paused is true if tasks were paused by Pause and haven't been resumed
+	// by Resume since.
+	paused bool
+}
+
+// PauseArgs are arguments to Pause.
+type PauseArgs struct {
+	// TimeoutMs is how long to wait for all tasks to stop, in milliseconds.
+	// If they haven't all stopped by then, Pause fails and the tasks are
+	// resumed. If 0, Pause waits until they stop.
+	TimeoutMs int64
+}
+
+// PauseResult is the result of Pause.
+type PauseResult struct {
+	// Paused is true if the call paused the tasks, and false if it was a
+	// no-op because they were already paused.
+	Paused bool
+}
+
+// ResumeResult is the result of Resume.
+type ResumeResult struct {
+	// Resumed is true if the call resumed the tasks, and false if it was a
+	// no-op because they weren't paused.
+	Resumed bool
 }
 
-// Pause pauses all tasks, blocking until they are stopped.
-func (l *Lifecycle) Pause(_, _ *struct{}) error {
-	l.Kernel.Pause()
+// Pause pauses all tasks, blocking until they are stopped. Pausing tasks that
+// are already paused is a no-op, so a single Resume always resumes them.
+func (l *Lifecycle) Pause(args *PauseArgs, result *PauseResult) error {
+	if args.TimeoutMs < 0 {
+		return fmt.Errorf("timeout (%dms) must not be negative", args.TimeoutMs)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.paused {
+		*result = PauseResult{}
+		return nil
+	}
+	if args.TimeoutMs == 0 {
+		l.Kernel.Pause()
+	} else {
+		timeout := time.Duration(args.TimeoutMs) * time.Millisecond
+		if running, ok := l.Kernel.PauseTimeout(timeout); !ok {
+			return fmt.Errorf("%d tasks didn't stop within %v, tasks were resumed; TIDs: %v", len(running), timeout, running)
+		}
+	}
+	l.paused = true
+	*result = PauseResult{Paused: true}
 	return nil
 }
 
-// Resume resumes all tasks.
-func (l *Lifecycle) Resume(_, _ *struct{}) error {
+// Resume resumes all tasks. Resuming tasks that aren't paused is a no-op.
+func (l *Lifecycle) Resume(_ *struct{}, result *ResumeResult) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.paused {
+		*result = ResumeResult{}
+		return nil
+	}
 	l.Kernel.Unpause()
+	l.paused = false
+	*result = ResumeResult{Resumed: true}
 	return nil
 }
@@ -15,6 +15,8 @@
 package control
 
 import (
+	"errors"
+	"os"
 	"runtime"
 	"runtime/pprof"
 	"runtime/trace"
@@ -54,6 +56,19 @@ type Profile struct {
 	// cpuMu protects CPU profiling.
 	cpuMu sync.Mutex
 
+	// cpuStartMu protects the fields below. CPU and StartCPU exclude each
+	// other through pprof.StartCPUProfile, which fails if a CPU profile is
+	// already running.
+	cpuStartMu sync.Mutex
+
+	// cpuOutput is the output of the CPU profile started by StartCPU. It's
+	// nil if none is running.
+	cpuOutput *os.File
+
+	// cpuTimer stops the CPU profile started by StartCPU after its duration.
+	// It's nil if there's no duration.
+	cpuTimer *time.Timer
+
 	// blockMu protects block profiling.
 	blockMu sync.Mutex
 
@@ -78,6 +93,13 @@ func NewProfile(k *kernel.Kernel) *Profile {
 // Stop implements urpc.Stopper.Stop.
 func (p *Profile) Stop() {
 	close(p.done)
+
+	// Flush the CPU profile started by StartCPU, if any.
+	p.cpuStartMu.Lock()
+	defer p.cpuStartMu.Unlock()
+	if p.cpuOutput != nil {
+		p.stopCPULocked()
+	}
 }
 
 // CPUProfileOpts contains options specifically for CPU profiles.
@@ -116,6 +138,73 @@ func (p *Profile) CPU(o *CPUProfileOpts, _ *struct{}) error {
 	return nil
 }
 
+// errNoCPUProfile is returned by StopCPU if no profile was started by StartCPU.
+var errNoCPUProfile = errors.New("no CPU profile started by StartCPU is running")
+
+// StartCPU is an RPC stub which starts collecting a CPU profile and returns
+// right away. Unlike CPU, the profile ends when StopCPU is called, or after
+// o.Duration if it's positive, whichever comes first. Only one CPU profile
+// may run at a time.
+func (p *Profile) StartCPU(o *CPUProfileOpts, _ *struct{}) error {
+	if len(o.FilePayload.Files) < 1 {
+		return errors.New("no output file for the CPU profile")
+	}
+	// The file payload is closed once the call returns, while the profile
+	// keeps running.
+	dup, err := fd.NewFromFile(o.FilePayload.Files[0])
+	if err != nil {
+		return err
+	}
+	output := dup.ReleaseToFile("cpu profile")
+
+	p.cpuStartMu.Lock()
+	defer p.cpuStartMu.Unlock()
+
+	// Returns an error if profiling is already started.
+	if err := pprof.StartCPUProfile(output); err != nil {
+		output.Close()
+		return err
+	}
+	p.cpuOutput = output
+	if o.Duration > 0 {
+		p.cpuTimer = time.AfterFunc(o.Duration, func() {
+			p.cpuStartMu.Lock()
+			defer p.cpuStartMu.Unlock()
+			// The profile may have been stopped and another one
+			// started since.
+			if p.cpuOutput == output {
+				p.stopCPULocked()
+			}
+		})
+	}
+	return nil
+}
+
+// StopCPU is an RPC stub which stops the CPU profile started by StartCPU. The
+// profile is flushed and its output closed.
+func (p *Profile) StopCPU(_, _ *struct{}) error {
+	p.cpuStartMu.Lock()
+	defer p.cpuStartMu.Unlock()
+	if p.cpuOutput == nil {
+		return errNoCPUProfile
+	}
+	return p.stopCPULocked()
+}
+
+// stopCPULocked stops the CPU profile started by StartCPU.
+//
+// Preconditions: p.cpuStartMu is locked and p.cpuOutput isn't nil.
+func (p *Profile) stopCPULocked() error {
+	if p.cpuTimer != nil {
+		p.cpuTimer.Stop()
+		p.cpuTimer = nil
+	}
+	pprof.StopCPUProfile()
+	err := p.cpuOutput.Close()
+	p.cpuOutput = nil
+	return err
+}
+
 // HeapProfileOpts contains options specifically for heap profiles.
 type HeapProfileOpts struct {
 	// FilePayload is the destination for the profiling output.
@@ -125,6 +214,11 @@ type HeapProfileOpts struct {
 	// not affect the data collected however, as the heap will
 	// continue only the memory associated with the last alloc.
 	Delay time.Duration `json:"delay"`
+
+	// SkipGC skips the garbage collection that normally runs before the
+	// profile is written. The profile then reflects the heap as of the last
+	// collection, which is cheaper but less accurate.
+	SkipGC bool `json:"skipGC"`
 }
 
 // Heap generates a heap profile.
@@ -143,7 +237,9 @@ func (p *Profile) Heap(o *HeapProfileOpts, _ *struct{}) error {
 	}
 
 	// Get up-to-date statistics.
-	runtime.GC()
+	if !o.SkipGC {
+		runtime.GC()
+	}
 
 	// Write the given profile.
 	return pprof.WriteHeapProfile(output)
@@ -153,9 +249,13 @@ func (p *Profile) Heap(o *HeapProfileOpts, _ *struct{}) error {
 type GoroutineProfileOpts struct {
 	// FilePayload is the destination for the profiling output.
 	urpc.FilePayload
+
+	// Proto writes a protobuf profile that can be read by pprof, instead of
+	// the stack traces of all goroutines as text.
+	Proto bool `json:"proto"`
 }
 
-// Goroutine dumps out the stack trace for all running goroutines.
+// Goroutine generates a goroutine profile.
 func (p *Profile) Goroutine(o *GoroutineProfileOpts, _ *struct{}) error {
 	if len(o.FilePayload.Files) < 1 {
 		return nil // Allowed.
@@ -164,7 +264,11 @@ func (p *Profile) Goroutine(o *GoroutineProfileOpts, _ *struct{}) error {
 	output := o.FilePayload.Files[0]
 	defer output.Close()
 
-	return pprof.Lookup("goroutine").WriteTo(output, 2)
+	debug := 2
+	if o.Proto {
+		debug = 0
+	}
+	return pprof.Lookup("goroutine").WriteTo(output, debug)
 }
 
 // BlockProfileOpts contains options specifically for block profiles.
@@ -0,0 +1,145 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/urpc"
+)
+
+// cpuProfileOpts returns options to write a CPU profile to a new file at path.
+// Like the URPC server, the caller closes the file once the call returns.
+func cpuProfileOpts(t *testing.T, path string, duration time.Duration) *CPUProfileOpts {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("error creating profile file: %v", err)
+	}
+	return &CPUProfileOpts{
+		FilePayload: urpc.FilePayload{Files: []*os.File{f}},
+		Duration:    duration,
+	}
+}
+
+func TestStartStopCPU(t *testing.T) {
+	p := NewProfile(nil)
+	path := filepath.Join(t.TempDir(), "cpu.prof")
+
+	o := cpuProfileOpts(t, path, 0)
+	err := p.StartCPU(o, nil)
+	o.Files[0].Close()
+	if err != nil {
+		t.Fatalf("StartCPU() failed: %v", err)
+	}
+
+	// Only one CPU profile may run at a time.
+	o = cpuProfileOpts(t, filepath.Join(t.TempDir(), "other.prof"), 0)
+	err = p.StartCPU(o, nil)
+	o.Files[0].Close()
+	if err == nil {
+		t.Errorf("second StartCPU() succeeded, want error")
+	}
+
+	if err := p.StopCPU(nil, nil); err != nil {
+		t.Fatalf("StopCPU() failed: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+		t.Errorf("profile file: %v, %v, want non-empty file", info, err)
+	}
+	if err := p.StopCPU(nil, nil); err != errNoCPUProfile {
+		t.Errorf("second StopCPU() = %v, want %v", err, errNoCPUProfile)
+	}
+}
+
+func TestStartCPUDuration(t *testing.T) {
+	p := NewProfile(nil)
+	o := cpuProfileOpts(t, filepath.Join(t.TempDir(), "cpu.prof"), 10*time.Millisecond)
+	err := p.StartCPU(o, nil)
+	o.Files[0].Close()
+	if err != nil {
+		t.Fatalf("StartCPU() failed: %v", err)
+	}
+
+	// The profile stops by itself after its duration.
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		p.cpuStartMu.Lock()
+		running := p.cpuOutput != nil
+		p.cpuStartMu.Unlock()
+		if !running {
+			break
+		}
+		if time.Now().After(deadline) {
+			p.StopCPU(nil, nil)
+			t.Fatalf("CPU profile still running after its duration")
+		}
+	}
+}
+
+func TestHeapAndGoroutineRepeated(t *testing.T) {
+	p := NewProfile(nil)
+	dir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		for _, skipGC := range []bool{false, true} {
+			path := filepath.Join(dir, "heap.prof")
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatalf("error creating profile file: %v", err)
+			}
+			o := &HeapProfileOpts{
+				FilePayload: urpc.FilePayload{Files: []*os.File{f}},
+				SkipGC:      skipGC,
+			}
+			if err := p.Heap(o, nil); err != nil {
+				t.Fatalf("Heap(SkipGC: %t) failed: %v", skipGC, err)
+			}
+			if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+				t.Errorf("Heap(SkipGC: %t) profile file: %v, %v, want non-empty file", skipGC, info, err)
+			}
+		}
+
+		for _, proto := range []bool{false, true} {
+			path := filepath.Join(dir, "goroutine.prof")
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatalf("error creating profile file: %v", err)
+			}
+			o := &GoroutineProfileOpts{
+				FilePayload: urpc.FilePayload{Files: []*os.File{f}},
+				Proto:       proto,
+			}
+			if err := p.Goroutine(o, nil); err != nil {
+				t.Fatalf("Goroutine(Proto: %t) failed: %v", proto, err)
+			}
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatalf("error reading profile file: %v", err)
+			}
+			// Protobuf profiles are gzipped, text ones start with the
+			// first goroutine's header.
+			if gzipped := bytes.HasPrefix(b, []byte{0x1f, 0x8b}); gzipped != proto {
+				t.Errorf("Goroutine(Proto: %t) wrote gzipped profile: %t", proto, gzipped)
+			}
+			if text := bytes.HasPrefix(b, []byte("goroutine ")); text == proto {
+				t.Errorf("Goroutine(Proto: %t) wrote text profile: %t", proto, text)
+			}
+		}
+	}
+}
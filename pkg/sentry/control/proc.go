@@ -30,10 +30,12 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/fs/host"
 	"gvisor.dev/gvisor/pkg/sentry/fs/user"
 	hostvfs2 "gvisor.dev/gvisor/pkg/sentry/fsimpl/host"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
 	"gvisor.dev/gvisor/pkg/sentry/limits"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/urpc"
@@ -59,6 +61,11 @@ type ExecArgs struct {
 	// Envv is a list of environment variables.
 	Envv []string `json:"envv"`
 
+	// EnvMode determines how Envv is combined with the environment of the
+	// container init process. It's applied by runsc's exec, not by
+	// Proc.Exec or ExecAsync, which always use Envv as is.
+	EnvMode EnvMode `json:"env_mode"`
+
 	// MountNamespace is the mount namespace to execute the new process in.
 	// A reference on MountNamespace must be held for the lifetime of the
 	// ExecArgs. If MountNamespace is nil, it will default to the init
@@ -89,6 +96,13 @@ type ExecArgs struct {
 	Capabilities *auth.TaskCapabilities
 
 	// StdioIsPty indicates that FDs 0, 1, and 2 are connected to a host pty FD.
+	// The three FDs then share a single TTY file, and the new process is
+	// made the leader of a new session whose foreground process group is
+	// the process' own, so that job control and signals from the terminal
+	// work. If false, the FDs are imported as regular host files.
+	//
+	// Processes in the sandbox don't get SIGWINCH when the host pty is
+	// resized; runsc's containerManager.ResizeTTY propagates it.
 	StdioIsPty bool
 
 	// FilePayload determines the files to give to the new process.
@@ -100,8 +114,57 @@ type ExecArgs struct {
 	// PIDNamespace is the pid namespace for the process being executed.
 	PIDNamespace *kernel.PIDNamespace
 
+	// NetworkNamespace is the network namespace for the process being
+	// executed. If nil, the root network namespace is used.
+	NetworkNamespace *inet.Namespace
+
 	// Limits is the limit set for the process being executed.
 	Limits *limits.LimitSet
+
+	// Rlimits overrides the container's resource limits for the process
+	// being executed, e.g. to run it with a lower RLIMIT_NOFILE. It's keyed
+	// by resource name, e.g. "RLIMIT_NOFILE". It's applied by runsc's exec
+	// to Limits, not by Proc.Exec or ExecAsync.
+	Rlimits map[string]limits.Limit `json:"rlimits"`
+
+	// TimeoutMs, if positive, is the number of milliseconds after which the
+	// process is killed with SIGKILL if it hasn't exited. It's enforced by
+	// runsc's exec, not by Proc.Exec or ExecAsync.
+	TimeoutMs int64 `json:"timeout_ms"`
+
+	// NoNewPrivs sets the no_new_privs bit of the process being executed.
+	NoNewPrivs bool `json:"no_new_privs"`
+}
+
+// EnvMode determines how ExecArgs.Envv is combined with the environment of
+// the container init process. That's the environment in the container's OCI
+// spec, which the init process was started with, like docker exec does. It
+// doesn't reflect changes the init process made to its environment since,
+// nor the contents of its /proc/[pid]/environ.
+//
+// If a variable appears more than once in Envv, the last occurrence wins. In
+// EnvMerge mode, variables from Envv take precedence over the init process'
+// variables of the same name.
+type EnvMode int
+
+const (
+	// EnvReplace uses Envv as the whole environment of the new process.
+	EnvReplace EnvMode = iota
+
+	// EnvMerge starts from the environment of the container init process
+	// and adds or overrides the variables in Envv.
+	EnvMerge
+)
+
+// String implements fmt.Stringer.
+func (m EnvMode) String() string {
+	switch m {
+	case EnvReplace:
+		return "Replace"
+	case EnvMerge:
+		return "Merge"
+	}
+	return fmt.Sprintf("unknown env mode: %d", m)
 }
 
 // String prints the arguments as a string.
@@ -175,6 +238,8 @@ func (proc *Proc) execAsync(args *ExecArgs) (*kernel.ThreadGroup, kernel.ThreadI
 		AbstractSocketNamespace: proc.Kernel.RootAbstractSocketNamespace(),
 		ContainerID:             args.ContainerID,
 		PIDNamespace:            pidns,
+		NetworkNamespace:        args.NetworkNamespace,
+		NoNewPrivs:              args.NoNewPrivs,
 	}
 	if initArgs.MountNamespace != nil {
 		// initArgs must hold a reference on MountNamespace, which will
@@ -278,6 +343,9 @@ type Process struct {
 	// Parent PID
 	PPID    kernel.ThreadID   `json:"ppid"`
 	Threads []kernel.ThreadID `json:"threads"`
+	// Process group and session IDs
+	PGID kernel.ProcessGroupID `json:"pgid"`
+	SID  kernel.SessionID      `json:"sid"`
 	// Processor utilization
 	C int32 `json:"c"`
 	// TTY name of the process. Will be of the form "pts/N" if there is a
@@ -285,10 +353,21 @@ type Process struct {
 	TTY string `json:"tty"`
 	// Start time
 	STime string `json:"stime"`
-	// CPU time
+	// System CPU time
 	Time string `json:"time"`
+	// User plus system CPU time, like the TIME column of ps(1).
+	CPUTime string `json:"cpu_time"`
 	// Executable shortname (e.g. "sh" for /bin/sh)
 	Cmd string `json:"cmd"`
+	// CPU time spent by all threads in user mode, excluding children.
+	UserTime time.Duration `json:"user_time"`
+	// CPU time spent by all threads in the sentry, excluding children.
+	SysTime time.Duration `json:"sys_time"`
+	// Resident set size in bytes. It's 0 if the process has no memory
+	// manager, e.g. because it has exited.
+	RSS uint64 `json:"rss"`
+	// Children of the process, only set in trees built by ProcessTree.
+	Children []*Process `json:"children,omitempty"`
 }
 
 // ProcessListToTable prints a table with the following format:
@@ -358,22 +437,50 @@ func Processes(k *kernel.Kernel, containerID string, out *[]*Process) error {
 			ppid = pidns.IDOfThreadGroup(p.ThreadGroup())
 		}
 		threads := tg.MemberIDs(pidns)
+		// Take a single snapshot of the CPU stats, so that all the CPU
+		// fields are consistent with each other.
+		stats := tg.CPUStats()
 		*out = append(*out, &Process{
-			UID:     tg.Leader().Credentials().EffectiveKUID,
-			PID:     pid,
-			PPID:    ppid,
-			Threads: threads,
-			STime:   formatStartTime(now, tg.Leader().StartTime()),
-			C:       percentCPU(tg.CPUStats(), tg.Leader().StartTime(), now),
-			Time:    tg.CPUStats().SysTime.String(),
-			Cmd:     tg.Leader().Name(),
-			TTY:     ttyName(tg.TTY()),
+			UID:      tg.Leader().Credentials().EffectiveKUID,
+			PID:      pid,
+			PPID:     ppid,
+			Threads:  threads,
+			PGID:     pidns.IDOfProcessGroup(tg.ProcessGroup()),
+			SID:      pidns.IDOfSession(tg.Session()),
+			STime:    formatStartTime(now, tg.Leader().StartTime()),
+			C:        percentCPU(stats, tg.Leader().StartTime(), now),
+			Time:     stats.SysTime.String(),
+			CPUTime:  (stats.UserTime + stats.SysTime).String(),
+			Cmd:      tg.Leader().Name(),
+			TTY:      ttyName(tg.TTY()),
+			UserTime: stats.UserTime,
+			SysTime:  stats.SysTime,
+			RSS:      residentSetSize(tg),
 		})
 	}
 	sort.Slice(*out, func(i, j int) bool { return (*out)[i].PID < (*out)[j].PID })
 	return nil
 }
 
+// ProcessTree arranges the processes in pl into trees, by moving each process
+// to the Children of its parent. It returns the roots, i.e. the processes
+// whose parent isn't in pl, in the order of pl.
+func ProcessTree(pl []*Process) []*Process {
+	byPID := make(map[kernel.ThreadID]*Process, len(pl))
+	for _, p := range pl {
+		byPID[p.PID] = p
+	}
+	var roots []*Process
+	for _, p := range pl {
+		if parent, ok := byPID[p.PPID]; ok && parent != p {
+			parent.Children = append(parent.Children, p)
+		} else {
+			roots = append(roots, p)
+		}
+	}
+	return roots
+}
+
 // formatStartTime formats startTime depending on the current time:
 // - If startTime was today, HH:MM is used.
 // - If startTime was not today but was this year, MonDD is used (e.g. Jan02)
@@ -409,6 +516,19 @@ func percentCPU(stats usage.CPUStats, startTime, now ktime.Time) int32 {
 	return int32(percentCPU)
 }
 
+// residentSetSize returns the RSS of tg in bytes.
+func residentSetSize(tg *kernel.ThreadGroup) uint64 {
+	var rss uint64
+	// The task mutex keeps the MemoryManager from being released while
+	// it's read, e.g. by a concurrent execve or exit.
+	tg.Leader().WithMuLocked(func(t *kernel.Task) {
+		if mm := t.MemoryManager(); mm != nil {
+			rss = mm.ResidentSetSize()
+		}
+	})
+	return rss
+}
+
 func ttyName(tty *kernel.TTY) string {
 	if tty == nil {
 		return "?"
@@ -428,3 +548,133 @@ func ContainerUsage(kr *kernel.Kernel) map[string]uint64 {
 	}
 	return cusage
 }
+
+// ContainerCPUStats retrieves per-container CPU usage, split into time spent
+// in application code and in the sentry.
+func ContainerCPUStats(kr *kernel.Kernel) map[string]usage.CPUStats {
+	cstats := make(map[string]usage.CPUStats)
+	for _, tg := range kr.TaskSet().Root.ThreadGroups() {
+		// We want each tg's usage including reaped children.
+		cid := tg.Leader().ContainerID()
+		stats := cstats[cid]
+		stats.Accumulate(tg.CPUStats())
+		stats.Accumulate(tg.JoinedChildCPUStats())
+		cstats[cid] = stats
+	}
+	return cstats
+}
+
+// ContainerMemoryUsage retrieves the per-container resident memory of live
+// processes, in bytes. Memory shared by several processes is counted for each
+// of them, like when adding up their RSS from /proc.
+func ContainerMemoryUsage(kr *kernel.Kernel) map[string]uint64 {
+	cusage := make(map[string]uint64)
+	for _, tg := range kr.TaskSet().Root.ThreadGroups() {
+		cusage[tg.Leader().ContainerID()] += residentSetSize(tg)
+	}
+	return cusage
+}
+
+// ContainerContextSwitches retrieves per-container voluntary and involuntary
+// context switch counts, see usage.CPUStats.
+func ContainerContextSwitches(kr *kernel.Kernel) (voluntary, involuntary map[string]uint64) {
+	voluntary = make(map[string]uint64)
+	involuntary = make(map[string]uint64)
+	for _, tg := range kr.TaskSet().Root.ThreadGroups() {
+		// We want each tg's switches including reaped children.
+		cid := tg.Leader().ContainerID()
+		stats := tg.CPUStats()
+		stats.Accumulate(tg.JoinedChildCPUStats())
+		voluntary[cid] += stats.VoluntarySwitches
+		involuntary[cid] += stats.InvoluntarySwitches
+	}
+	return voluntary, involuntary
+}
+
+// PageFaults contains page fault counts.
+type PageFaults struct {
+	// Minor is the number of faults satisfied without I/O.
+	Minor uint64 `json:"minor"`
+
+	// Major is the number of faults that required reading from a backing
+	// file.
+	Major uint64 `json:"major"`
+}
+
+// ContainerPageFaults retrieves per-container page fault counts, summed over
+// the address spaces of the container's processes. Faults taken by processes
+// that have since exited are not included.
+func ContainerPageFaults(kr *kernel.Kernel) map[string]PageFaults {
+	faults := make(map[string]PageFaults)
+	// Processes may share an address space (e.g. after vfork), so only count
+	// each MemoryManager once.
+	seen := make(map[*mm.MemoryManager]struct{})
+	for _, tg := range kr.TaskSet().Root.ThreadGroups() {
+		leader := tg.Leader()
+		if leader == nil {
+			continue
+		}
+		var m *mm.MemoryManager
+		leader.WithMuLocked(func(t *kernel.Task) {
+			m = t.MemoryManager()
+		})
+		if m == nil {
+			continue
+		}
+		if _, ok := seen[m]; ok {
+			continue
+		}
+		seen[m] = struct{}{}
+		// The counters are read atomically, so this doesn't need to hold
+		// a reference on m.
+		minor, major := m.PageFaults()
+		cid := leader.ContainerID()
+		f := faults[cid]
+		f.Minor += minor
+		f.Major += major
+		faults[cid] = f
+	}
+	return faults
+}
+
+// AsyncIOProcess describes the asynchronous I/O contexts of a process.
+type AsyncIOProcess struct {
+	PID      kernel.ThreadID     `json:"pid"`
+	Contexts []mm.AIOContextInfo `json:"contexts"`
+}
+
+// ContainerAsyncIO returns the asynchronous I/O contexts of the processes of
+// the given container, sorted by PID. Processes without contexts are omitted.
+// If cancel is true, requests that haven't started executing are canceled
+// after being reported, and complete with ECANCELED.
+func ContainerAsyncIO(kr *kernel.Kernel, cid string, cancel bool) []AsyncIOProcess {
+	var procs []AsyncIOProcess
+	seen := make(map[*mm.MemoryManager]struct{})
+	for _, tg := range kr.TaskSet().Root.ThreadGroups() {
+		leader := tg.Leader()
+		if leader == nil || leader.ContainerID() != cid {
+			continue
+		}
+		var m *mm.MemoryManager
+		leader.WithMuLocked(func(t *kernel.Task) {
+			m = t.MemoryManager()
+		})
+		if m == nil {
+			continue
+		}
+		// Processes sharing an address space share its contexts, so only
+		// report them for the first one.
+		if _, ok := seen[m]; ok {
+			continue
+		}
+		seen[m] = struct{}{}
+		if contexts := m.AIOContexts(cancel); len(contexts) > 0 {
+			procs = append(procs, AsyncIOProcess{
+				PID:      kr.TaskSet().Root.IDOfThreadGroup(tg),
+				Contexts: contexts,
+			})
+		}
+	}
+	sort.Slice(procs, func(i, j int) bool { return procs[i].PID < procs[j].PID })
+	return procs
+}
@@ -15,6 +15,7 @@
 package control
 
 import (
+	"fmt"
 	"testing"
 
 	"gvisor.dev/gvisor/pkg/log"
@@ -164,3 +165,32 @@ func TestPercentCPU(t *testing.T) {
 		}
 	}
 }
+
+func TestProcessTree(t *testing.T) {
+	// 1 -> 2 -> 4, 1 -> 3, and 5 whose parent isn't in the list, e.g. an
+	// exec'd process.
+	pl := []*Process{
+		{PID: 1, PPID: 0},
+		{PID: 2, PPID: 1},
+		{PID: 3, PPID: 1},
+		{PID: 4, PPID: 2},
+		{PID: 5, PPID: 42},
+	}
+	roots := ProcessTree(pl)
+
+	var format func(ps []*Process) string
+	format = func(ps []*Process) string {
+		var s string
+		for _, p := range ps {
+			s += fmt.Sprintf("%d", p.PID)
+			if len(p.Children) > 0 {
+				s += "(" + format(p.Children) + ")"
+			}
+			s += " "
+		}
+		return s
+	}
+	if got, want := format(roots), "1(2(4 ) 3 ) 5 "; got != want {
+		t.Errorf("ProcessTree(%v) got %q, want %q", pl, got, want)
+	}
+}
@@ -16,18 +16,20 @@ package control
 
 import (
 	"errors"
+	"io"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/state"
 	"gvisor.dev/gvisor/pkg/sentry/watchdog"
+	"gvisor.dev/gvisor/pkg/state/statefile"
 	"gvisor.dev/gvisor/pkg/urpc"
 )
 
 // ErrInvalidFiles is returned when the urpc call to Save does not include an
 // appropriate file payload (e.g. there is no output file!).
-var ErrInvalidFiles = errors.New("exactly one file must be provided")
+var ErrInvalidFiles = errors.New("invalid number of files provided")
 
 // State includes state-related functions.
 type State struct {
@@ -43,23 +45,46 @@ type SaveOpts struct {
 	// Metadata is the set of metadata to prepend to the state file.
 	Metadata map[string]string `json:"metadata"`
 
-	// FilePayload contains the destination for the state.
+	// Compression selects how the state is compressed. Restore detects it,
+	// so it doesn't need to be passed there. If empty,
+	// statefile.CompressionBestSpeed is used.
+	Compression statefile.Compression `json:"compression"`
+
+	// FilePayload contains the destination for the state. The state is
+	// written sequentially, so the destination doesn't need to be seekable
+	// and may be a socket or pipe connected to the restoring side.
+	//
+	// It may be followed by a second file, to which progress lines are
+	// written periodically while the state is saved, giving the phase of
+	// the save, the number of bytes written and the number of memory pages
+	// saved.
 	urpc.FilePayload
 }
 
 // Save saves the running system.
 func (s *State) Save(o *SaveOpts, _ *struct{}) error {
 	// Create an output stream.
-	if len(o.FilePayload.Files) != 1 {
+	if n := len(o.FilePayload.Files); n != 1 && n != 2 {
+		for _, f := range o.FilePayload.Files {
+			f.Close()
+		}
 		return ErrInvalidFiles
 	}
-	defer o.FilePayload.Files[0].Close()
+	for _, f := range o.FilePayload.Files {
+		defer f.Close()
+	}
+	var progress io.Writer
+	if len(o.FilePayload.Files) == 2 {
+		progress = o.FilePayload.Files[1]
+	}
 
 	// Save to the first provided stream.
 	saveOpts := state.SaveOpts{
 		Destination: o.FilePayload.Files[0],
 		Key:         o.Key,
 		Metadata:    o.Metadata,
+		Compression: o.Compression,
+		Progress:    progress,
 		Callback: func(err error) {
 			if err == nil {
 				log.Infof("Save succeeded: exiting...")
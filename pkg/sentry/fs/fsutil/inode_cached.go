@@ -891,7 +891,10 @@ func (c *CachingInodeOperations) Translate(ctx context.Context, required, option
 	}
 
 	mf := c.mfp.MemoryFile()
-	cerr := c.cache.Fill(ctx, required, maxFillRange(required, optional), uint64(c.attr.Size), mf, usage.PageCache, c.backingFile.ReadToBlocksAt)
+	cerr := c.cache.Fill(ctx, required, maxFillRange(required, optional), uint64(c.attr.Size), mf, usage.PageCache, func(ctx context.Context, dsts safemem.BlockSeq, offset uint64) (uint64, error) {
+		memmap.NoteMajorFault(ctx)
+		return c.backingFile.ReadToBlocksAt(ctx, dsts, offset)
+	})
 
 	var ts []memmap.Translation
 	var translatedEnd uint64
@@ -78,6 +78,12 @@ func (t *TTYFileOperations) ForegroundProcessGroup() *kernel.ProcessGroup {
 	return t.fgProcessGroup
 }
 
+// SetWinsize sets the window size of the host TTY, as if TIOCSWINSZ was
+// called on it. It doesn't signal the foreground process group.
+func (t *TTYFileOperations) SetWinsize(w *linux.Winsize) error {
+	return ioctlSetWinsize(t.fileOperations.iops.fileState.FD(), w)
+}
+
 // Read implements fs.FileOperations.Read.
 //
 // Reading from a TTY is only allowed for foreground process groups. Background
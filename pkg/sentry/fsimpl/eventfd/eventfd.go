@@ -111,6 +111,33 @@ func (efd *EventFileDescription) HostFD() (int, error) {
 	return efd.hostfd, nil
 }
 
+// Info describes the state of an eventfd.
+type Info struct {
+	// Value is the current value of the event counter. It's always 0 if the
+	// eventfd is passed through to the host, which maintains the counter.
+	Value uint64 `json:"value"`
+
+	// Semaphore is true if the eventfd is in semaphore mode.
+	Semaphore bool `json:"semaphore"`
+
+	// HostBacked is true if the eventfd is passed through to the host.
+	HostBacked bool `json:"hostBacked"`
+}
+
+// Info returns the state of the eventfd.
+func (efd *EventFileDescription) Info() Info {
+	efd.mu.Lock()
+	defer efd.mu.Unlock()
+	info := Info{
+		Semaphore:  efd.semMode,
+		HostBacked: efd.hostfd >= 0,
+	}
+	if !info.HostBacked {
+		info.Value = efd.val
+	}
+	return info
+}
+
 // Release implements vfs.FileDescriptionImpl.Release.
 func (efd *EventFileDescription) Release(context.Context) {
 	efd.mu.Lock()
@@ -383,5 +383,8 @@ func (fd *directoryFD) Seek(ctx context.Context, offset int64, whence int32) (in
 
 // Sync implements vfs.FileDescriptionImpl.Sync.
 func (fd *directoryFD) Sync(ctx context.Context) error {
+	if vfs.SyncPolicyFromContext(ctx) != vfs.SyncDurable {
+		return nil
+	}
 	return fd.dentry().syncRemoteFile(ctx)
 }
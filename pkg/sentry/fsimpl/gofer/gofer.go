@@ -2423,14 +2423,8 @@ func (d *dentry) syncCachedFile(ctx context.Context, forFilesystemSync bool) err
 	d.handleMu.RLock()
 	defer d.handleMu.RUnlock()
 	h := d.writeHandleLocked()
-	if h.isOpen() {
-		// Write back dirty pages to the remote file.
-		d.dataMu.Lock()
-		err := fsutil.SyncDirtyAll(ctx, &d.cache, &d.dirty, d.size.Load(), d.fs.mfp.MemoryFile(), h.writeFromBlocksAt)
-		d.dataMu.Unlock()
-		if err != nil {
-			return err
-		}
+	if err := d.writebackCachedFileLocked(ctx, h); err != nil {
+		return err
 	}
 	if err := d.syncRemoteFileLocked(ctx); err != nil {
 		if !forFilesystemSync {
@@ -2446,6 +2440,33 @@ func (d *dentry) syncCachedFile(ctx context.Context, forFilesystemSync bool) err
 	return nil
 }
 
+// fsync implements fsync(2) and fdatasync(2) for a cached file, according to
+// the vfs.SyncPolicy of ctx.
+func (d *dentry) fsync(ctx context.Context) error {
+	switch vfs.SyncPolicyFromContext(ctx) {
+	case vfs.SyncNone:
+		return nil
+	case vfs.SyncRelaxed:
+		// Make the data visible to other users of the remote file, but don't
+		// wait for it to be durable.
+		d.handleMu.RLock()
+		defer d.handleMu.RUnlock()
+		return d.writebackCachedFileLocked(ctx, d.writeHandleLocked())
+	default:
+		return d.syncCachedFile(ctx, false /* forFilesystemSync */)
+	}
+}
+
+// Preconditions: d.handleMu must be locked.
+func (d *dentry) writebackCachedFileLocked(ctx context.Context, h handle) error {
+	if !h.isOpen() {
+		return nil
+	}
+	d.dataMu.Lock()
+	defer d.dataMu.Unlock()
+	return fsutil.SyncDirtyAll(ctx, &d.cache, &d.dirty, d.size.Load(), d.fs.mfp.MemoryFile(), h.writeFromBlocksAt)
+}
+
 // incLinks increments link count.
 func (d *dentry) incLinks() {
 	if atomic.LoadUint32(&d.nlink) == 0 {
@@ -15,11 +15,17 @@
 package gofer
 
 import (
+	"fmt"
 	"testing"
 
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/p9"
 	"gvisor.dev/gvisor/pkg/sentry/contexttest"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
 	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
 )
 
 func TestDestroyIdempotent(t *testing.T) {
@@ -66,3 +72,126 @@ func TestDestroyIdempotent(t *testing.T) {
 	child.checkCachingLocked(ctx, true /* renameMuWriteLocked */)
 	child.checkCachingLocked(ctx, true /* renameMuWriteLocked */)
 }
+
+// syncPolicyContext is a context with a given vfs.SyncPolicy.
+type syncPolicyContext struct {
+	context.Context
+	policy vfs.SyncPolicy
+}
+
+// Value implements context.Context.Value.
+func (ctx syncPolicyContext) Value(key interface{}) interface{} {
+	if key == vfs.CtxSyncPolicy {
+		return ctx.policy
+	}
+	return ctx.Context.Value(key)
+}
+
+// TestSyncPolicy checks that fsync only syncs the remote file with the durable
+// sync policy.
+func TestSyncPolicy(t *testing.T) {
+	ctx := contexttest.Context(t)
+	fs := filesystem{
+		mfp:              pgalloc.MemoryFileProviderFromContext(ctx),
+		syncableDentries: make(map[*dentry]struct{}),
+		inoByQIDPath:     make(map[uint64]uint64),
+		inoByKey:         make(map[inoKey]uint64),
+	}
+	attr := &p9.Attr{
+		Mode: p9.ModeRegular,
+	}
+	mask := p9.AttrMask{
+		Mode: true,
+		Size: true,
+	}
+	d, err := fs.newDentry(ctx, p9file{}, p9.QID{}, mask, attr)
+	if err != nil {
+		t.Fatalf("fs.newDentry(): %v", err)
+	}
+
+	// Host pipes don't support fsync, so syncing the remote file fails with
+	// EINVAL iff it is attempted.
+	var fds [2]int
+	if err := unix.Pipe(fds[:]); err != nil {
+		t.Fatalf("unix.Pipe(): %v", err)
+	}
+	defer unix.Close(fds[0])
+	defer unix.Close(fds[1])
+	d.writeFD = int32(fds[1])
+	defer func() { d.writeFD = -1 }()
+
+	for _, tc := range []struct {
+		policy   vfs.SyncPolicy
+		wantSync bool
+	}{
+		{policy: vfs.SyncDurable, wantSync: true},
+		{policy: vfs.SyncRelaxed, wantSync: false},
+		{policy: vfs.SyncNone, wantSync: false},
+	} {
+		err := d.fsync(syncPolicyContext{Context: ctx, policy: tc.policy})
+		if synced := err == unix.EINVAL; synced != tc.wantSync {
+			t.Errorf("fsync with policy %v returned %v, want sync: %t", tc.policy, err, tc.wantSync)
+		}
+	}
+}
+
+// TestReadAheadFillRange checks that a larger read-ahead window reduces the
+// number of reads needed to fill the cache for sequential reads.
+func TestReadAheadFillRange(t *testing.T) {
+	const (
+		fileSize = 4 << 20
+		readSize = hostarch.PageSize
+	)
+	// fills simulates sequential reads of readSize bytes over the whole file
+	// and returns the number of cache fills, i.e. reads from the gofer.
+	fills := func(readAhead uint64) int {
+		n := 0
+		var cachedEnd uint64
+		for off := uint64(0); off < fileSize; off += readSize {
+			if off < cachedEnd {
+				continue
+			}
+			required := memmap.MappableRange{Start: off, End: off + readSize}
+			optional := memmap.MappableRange{Start: cachedEnd, End: fileSize}
+			cachedEnd = readAheadFillRange(required, optional, readAhead).End
+			n++
+		}
+		return n
+	}
+
+	for _, tc := range []struct {
+		readAhead uint64
+		want      int
+	}{
+		{readAhead: readSize, want: fileSize / readSize},
+		{readAhead: vfs.DefaultReadAheadSize, want: fileSize / vfs.DefaultReadAheadSize},
+		{readAhead: 1 << 20, want: fileSize / (1 << 20)},
+		{readAhead: fileSize, want: 1},
+	} {
+		if got := fills(tc.readAhead); got != tc.want {
+			t.Errorf("read-ahead %d: got %d fills, want %d", tc.readAhead, got, tc.want)
+		}
+	}
+}
+
+// BenchmarkReadAheadFillRange measures the number of cache fills for
+// sequential reads with different read-ahead windows.
+func BenchmarkReadAheadFillRange(b *testing.B) {
+	for _, readAhead := range []uint64{vfs.DefaultReadAheadSize, 1 << 20, 16 << 20} {
+		b.Run(fmt.Sprintf("%dK", readAhead>>10), func(b *testing.B) {
+			fills := 0
+			var cachedEnd uint64
+			for i := 0; i < b.N; i++ {
+				off := uint64(i) * hostarch.PageSize
+				if off < cachedEnd {
+					continue
+				}
+				required := memmap.MappableRange{Start: off, End: off + hostarch.PageSize}
+				optional := memmap.MappableRange{Start: off, End: off + readAhead}
+				cachedEnd = readAheadFillRange(required, optional, readAhead).End
+				fills++
+			}
+			b.ReportMetric(float64(fills)/float64(b.N), "fills/op")
+		})
+	}
+}
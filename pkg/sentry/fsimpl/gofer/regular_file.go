@@ -468,7 +468,8 @@ func (rw *dentryReadWriter) ReadToBlocks(dsts safemem.BlockSeq) (uint64, error)
 					End:   gapEnd,
 				}
 				optMR := gap.Range()
-				err := rw.d.cache.Fill(rw.ctx, reqMR, maxFillRange(reqMR, optMR), rw.d.size.Load(), mf, usage.PageCache, h.readToBlocksAt)
+				fillMR := readAheadFillRange(reqMR, optMR, vfs.ReadAheadSizeFromContext(rw.ctx))
+				err := rw.d.cache.Fill(rw.ctx, reqMR, fillMR, rw.d.size.Load(), mf, usage.PageCache, h.readToBlocksAt)
 				mf.MarkEvictable(rw.d, pgalloc.EvictableRange{optMR.Start, optMR.End})
 				seg, gap = rw.d.cache.Find(rw.off)
 				if !seg.Ok() {
@@ -698,7 +699,7 @@ func regularFileSeekLocked(ctx context.Context, d *dentry, fdOffset, offset int6
 
 // Sync implements vfs.FileDescriptionImpl.Sync.
 func (fd *regularFileFD) Sync(ctx context.Context) error {
-	return fd.dentry().syncCachedFile(ctx, false /* forFilesystemSync */)
+	return fd.dentry().fsync(ctx)
 }
 
 // ConfigureMMap implements vfs.FileDescriptionImpl.ConfigureMMap.
@@ -827,7 +828,10 @@ func (d *dentry) Translate(ctx context.Context, required, optional memmap.Mappab
 
 	mf := d.fs.mfp.MemoryFile()
 	h := d.readHandleLocked()
-	cerr := d.cache.Fill(ctx, required, maxFillRange(required, optional), d.size.Load(), mf, usage.PageCache, h.readToBlocksAt)
+	cerr := d.cache.Fill(ctx, required, maxFillRange(required, optional), d.size.Load(), mf, usage.PageCache, func(ctx context.Context, dsts safemem.BlockSeq, offset uint64) (uint64, error) {
+		memmap.NoteMajorFault(ctx)
+		return h.readToBlocksAt(ctx, dsts, offset)
+	})
 
 	var ts []memmap.Translation
 	var translatedEnd uint64
@@ -869,7 +873,15 @@ func (d *dentry) Translate(ctx context.Context, required, optional memmap.Mappab
 }
 
 func maxFillRange(required, optional memmap.MappableRange) memmap.MappableRange {
-	const maxReadahead = 64 << 10 // 64 KB, chosen arbitrarily
+	return readAheadFillRange(required, optional, vfs.DefaultReadAheadSize)
+}
+
+// readAheadFillRange returns the range to fill when required is needed and
+// optional may be filled, reading at most maxReadahead bytes beyond
+// required.Start.
+//
+// Preconditions: maxReadahead is page-aligned.
+func readAheadFillRange(required, optional memmap.MappableRange, maxReadahead uint64) memmap.MappableRange {
 	if required.Length() >= maxReadahead {
 		return required
 	}
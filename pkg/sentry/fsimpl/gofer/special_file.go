@@ -391,6 +391,10 @@ func (fd *specialFileFD) Seek(ctx context.Context, offset int64, whence int32) (
 
 // Sync implements vfs.FileDescriptionImpl.Sync.
 func (fd *specialFileFD) Sync(ctx context.Context) error {
+	// Data isn't cached, so there is nothing to write back.
+	if vfs.SyncPolicyFromContext(ctx) != vfs.SyncDurable {
+		return nil
+	}
 	return fd.sync(ctx, false /* forFilesystemSync */)
 }
 
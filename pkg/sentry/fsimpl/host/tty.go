@@ -68,6 +68,12 @@ func (t *TTYFileDescription) ForegroundProcessGroup() *kernel.ProcessGroup {
 	return t.fgProcessGroup
 }
 
+// SetWinsize sets the window size of the host TTY, as if TIOCSWINSZ was
+// called on it. It doesn't signal the foreground process group.
+func (t *TTYFileDescription) SetWinsize(w *linux.Winsize) error {
+	return ioctlSetWinsize(t.inode.hostFD, w)
+}
+
 // Release implements fs.FileOperations.Release.
 func (t *TTYFileDescription) Release(ctx context.Context) {
 	t.mu.Lock()
@@ -323,6 +323,17 @@ func clonePrivateMount(vfsObj *vfs.VirtualFilesystem, vd vfs.VirtualDentry, forc
 	return vfs.MakeVirtualDentry(newmnt, d), nil
 }
 
+// UpperFilesystem returns the filesystem of the upper layer of vfsfs, or nil if
+// vfsfs is not an overlay filesystem or has no upper layer. The returned
+// filesystem remains valid as long as vfsfs is.
+func UpperFilesystem(vfsfs *vfs.Filesystem) *vfs.Filesystem {
+	fs, ok := vfsfs.Impl().(*filesystem)
+	if !ok || !fs.opts.UpperRoot.Ok() {
+		return nil
+	}
+	return fs.opts.UpperRoot.Mount().Filesystem()
+}
+
 // Release implements vfs.FilesystemImpl.Release.
 func (fs *filesystem) Release(ctx context.Context) {
 	vfsObj := fs.vfsfs.VirtualFilesystem()
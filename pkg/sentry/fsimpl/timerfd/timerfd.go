@@ -101,6 +101,12 @@ func (tfd *TimerFileDescription) SetTime(s ktime.Setting) (ktime.Time, ktime.Set
 	return tfd.timer.SwapAnd(s, func() { tfd.val.Store(0) })
 }
 
+// Expirations returns the number of timer expirations that haven't been read
+// yet.
+func (tfd *TimerFileDescription) Expirations() uint64 {
+	return tfd.val.Load()
+}
+
 // Readiness implements waiter.Waitable.Readiness.
 func (tfd *TimerFileDescription) Readiness(mask waiter.EventMask) waiter.EventMask {
 	var ready waiter.EventMask
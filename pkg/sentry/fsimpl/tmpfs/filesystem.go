@@ -733,7 +733,7 @@ func (fs *filesystem) StatFSAt(ctx context.Context, rp *vfs.ResolvingPath) (linu
 	if _, err := resolveLocked(ctx, rp); err != nil {
 		return linux.Statfs{}, err
 	}
-	return globalStatfs, nil
+	return fs.statfs(), nil
 }
 
 // SymlinkAt implements vfs.FilesystemImpl.SymlinkAt.
@@ -145,6 +145,7 @@ func NewZeroFile(ctx context.Context, creds *auth.Credentials, mount *vfs.Mount,
 	}
 	rf := fd.inode().impl.(*regularFile)
 	rf.memoryUsageKind = usage.Anonymous
+	rf.inode.fs.sizeLimit.charge(size)
 	rf.size.Store(size)
 	return &fd.vfsfd, err
 }
@@ -188,6 +189,11 @@ func (rf *regularFile) truncateLocked(newSize uint64) (bool, error) {
 			rf.dataMu.Unlock()
 			return false, linuxerr.EPERM
 		}
+		// Is there space left in the filesystem?
+		if !rf.inode.fs.sizeLimit.tryReserve(newSize - oldSize) {
+			rf.dataMu.Unlock()
+			return false, linuxerr.ENOSPC
+		}
 		// We only need to update the file size.
 		rf.size.Store(newSize)
 		rf.dataMu.Unlock()
@@ -202,6 +208,7 @@ func (rf *regularFile) truncateLocked(newSize uint64) (bool, error) {
 
 	// Update the file size.
 	rf.size.Store(newSize)
+	rf.inode.fs.sizeLimit.release(oldSize - newSize)
 	rf.dataMu.Unlock()
 
 	// Invalidate past translations of truncated pages.
@@ -620,6 +627,23 @@ func (rw *regularFileReadWriter) WriteFromBlocks(srcs safemem.BlockSeq) (uint64,
 		}
 	}
 
+	// Check that growing the file doesn't exceed the filesystem's size limit.
+	// As on Linux, writes that would exceed it are truncated, and fail with
+	// ENOSPC if no data can be written.
+	oldSize := rw.file.size.RacyLoad()
+	var reserved uint64
+	if end > oldSize {
+		want := end - oldSize
+		reserved = rw.file.inode.fs.sizeLimit.reserve(want)
+		if reserved < want {
+			end = oldSize + reserved
+		}
+		if end <= rw.off {
+			rw.file.inode.fs.sizeLimit.release(reserved)
+			return 0, linuxerr.ENOSPC
+		}
+	}
+
 	// Page-aligned mr for when we need to allocate memory. RoundUp can't
 	// overflow since end is an int64.
 	pgstartaddr := hostarch.Addr(rw.off).RoundDown()
@@ -674,9 +698,13 @@ func (rw *regularFileReadWriter) WriteFromBlocks(srcs safemem.BlockSeq) (uint64,
 exitLoop:
 	// If the write ends beyond the file's previous size, it causes the
 	// file to grow.
-	if rw.off > rw.file.size.RacyLoad() {
+	grown := uint64(0)
+	if rw.off > oldSize {
 		rw.file.size.Store(rw.off)
+		grown = rw.off - oldSize
 	}
+	// Return space reserved for data that wasn't written.
+	rw.file.inode.fs.sizeLimit.release(reserved - grown)
 
 	return done, retErr
 }
@@ -130,6 +130,72 @@ func TestPWrite(t *testing.T) {
 	}
 }
 
+// Test that writes fail with ENOSPC once the filesystem's size limit is hit.
+func TestSizeLimit(t *testing.T) {
+	ctx := contexttest.Context(t)
+	fd, cleanup, err := newFileFD(ctx, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	fs := fd.Mount().Filesystem()
+
+	const limit = 6000
+	if err := SetSizeLimit(fs, limit); err != nil {
+		t.Fatalf("SetSizeLimit failed: %v", err)
+	}
+	checkUsage := func(want uint64) {
+		t.Helper()
+		if _, got, err := SizeUsage(fs); err != nil {
+			t.Fatalf("SizeUsage failed: %v", err)
+		} else if got != want {
+			t.Errorf("SizeUsage got usage %d, want %d", got, want)
+		}
+	}
+
+	// Writes are truncated at the limit, and then fail.
+	data := bytes.Repeat([]byte{'a'}, 4096)
+	for _, want := range []int64{4096, limit - 4096} {
+		n, err := fd.Write(ctx, usermem.BytesIOSequence(data), vfs.WriteOptions{})
+		if err != nil {
+			t.Fatalf("fd.Write failed: %v", err)
+		}
+		if n != want {
+			t.Errorf("fd.Write got %d bytes, want %d", n, want)
+		}
+	}
+	if _, err := fd.Write(ctx, usermem.BytesIOSequence(data), vfs.WriteOptions{}); !linuxerr.Equals(linuxerr.ENOSPC, err) {
+		t.Errorf("fd.Write beyond limit got err %v, want ENOSPC", err)
+	}
+	if err := fd.SetStat(ctx, vfs.SetStatOptions{Stat: linux.Statx{Mask: linux.STATX_SIZE, Size: limit + 1}}); !linuxerr.Equals(linuxerr.ENOSPC, err) {
+		t.Errorf("growing truncate beyond limit got err %v, want ENOSPC", err)
+	}
+	checkUsage(limit)
+
+	// Lowering the limit below the usage keeps existing data, which can
+	// still be overwritten, but the file can't grow.
+	if err := SetSizeLimit(fs, 1000); err != nil {
+		t.Fatalf("SetSizeLimit failed: %v", err)
+	}
+	if _, err := fd.PWrite(ctx, usermem.BytesIOSequence(data), 0, vfs.WriteOptions{}); err != nil {
+		t.Errorf("fd.PWrite within file got err %v, want nil", err)
+	}
+	if _, err := fd.PWrite(ctx, usermem.BytesIOSequence(data), limit, vfs.WriteOptions{}); !linuxerr.Equals(linuxerr.ENOSPC, err) {
+		t.Errorf("fd.PWrite beyond lowered limit got err %v, want ENOSPC", err)
+	}
+	checkUsage(limit)
+
+	// Shrinking the file frees space.
+	if err := fd.SetStat(ctx, vfs.SetStatOptions{Stat: linux.Statx{Mask: linux.STATX_SIZE, Size: 0}}); err != nil {
+		t.Fatalf("truncate failed: %v", err)
+	}
+	checkUsage(0)
+	if n, err := fd.PWrite(ctx, usermem.BytesIOSequence(data[:1000]), 0, vfs.WriteOptions{}); err != nil || n != 1000 {
+		t.Errorf("fd.PWrite after truncate got (%d, %v), want (1000, nil)", n, err)
+	}
+	checkUsage(1000)
+}
+
 func TestLocks(t *testing.T) {
 	ctx := contexttest.Context(t)
 	fd, cleanup, err := newFileFD(ctx, 0644)
@@ -17,4 +17,5 @@ package tmpfs
 // afterLoad is called by stateify.
 func (rf *regularFile) afterLoad() {
 	rf.memFile = rf.inode.fs.mfp.MemoryFile()
+	rf.inode.fs.sizeLimit.charge(rf.size.RacyLoad())
 }
@@ -0,0 +1,138 @@
+// Copyright 2019 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tmpfs
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// sizeLimit limits the total size of the regular files in a filesystem, e.g.
+// to enforce a disk quota on a container's writable layer. Sizes are apparent
+// sizes, i.e. holes in sparse files count towards the limit.
+//
+// +stateify savable
+type sizeLimit struct {
+	mu sync.Mutex `state:"nosave"`
+
+	// limit is the maximum total size in bytes, or 0 if there is no limit.
+	// limit is protected by mu.
+	limit uint64
+
+	// usage is the total size of regular files in bytes. It isn't saved,
+	// each regular file charges its size again when it's loaded. usage is
+	// protected by mu.
+	usage uint64 `state:"nosave"`
+}
+
+// reserve accounts for up to n more bytes, as allowed by the limit, and
+// returns the number of bytes accounted for. If usage already exceeds the
+// limit, e.g. because the limit was lowered, reserve returns 0.
+func (l *sizeLimit) reserve(n uint64) uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limit != 0 {
+		if l.usage >= l.limit {
+			return 0
+		}
+		if avail := l.limit - l.usage; n > avail {
+			n = avail
+		}
+	}
+	l.usage += n
+	return n
+}
+
+// tryReserve accounts for n more bytes if the limit allows it, and returns
+// true if it did.
+func (l *sizeLimit) tryReserve(n uint64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limit != 0 && (l.usage >= l.limit || n > l.limit-l.usage) {
+		return false
+	}
+	l.usage += n
+	return true
+}
+
+// charge accounts for n more bytes regardless of the limit.
+func (l *sizeLimit) charge(n uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.usage += n
+}
+
+// release stops accounting for n bytes.
+func (l *sizeLimit) release(n uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if n > l.usage {
+		panic(fmt.Sprintf("releasing %d bytes, but only %d bytes are accounted for", n, l.usage))
+	}
+	l.usage -= n
+}
+
+// statfs returns the result of statfs(2) for fs, which reflects its size
+// limit, if any.
+func (fs *filesystem) statfs() linux.Statfs {
+	statfs := globalStatfs
+	fs.sizeLimit.mu.Lock()
+	defer fs.sizeLimit.mu.Unlock()
+	if fs.sizeLimit.limit == 0 {
+		return statfs
+	}
+	blocks := fs.sizeLimit.limit / hostarch.PageSize
+	used := (fs.sizeLimit.usage + hostarch.PageSize - 1) / hostarch.PageSize
+	free := uint64(0)
+	if used < blocks {
+		free = blocks - used
+	}
+	statfs.Blocks = blocks
+	statfs.BlocksFree = free
+	statfs.BlocksAvailable = free
+	return statfs
+}
+
+// SetSizeLimit sets the maximum total size in bytes of the regular files in
+// the tmpfs filesystem vfsfs. A limit of 0 removes the limit. Writes and
+// truncations that would grow files beyond the limit fail with ENOSPC. The
+// limit may be lowered below the current usage: existing files are kept, but
+// can't grow until enough space is freed.
+func SetSizeLimit(vfsfs *vfs.Filesystem, limit uint64) error {
+	fs, ok := vfsfs.Impl().(*filesystem)
+	if !ok {
+		return fmt.Errorf("filesystem is not tmpfs")
+	}
+	fs.sizeLimit.mu.Lock()
+	defer fs.sizeLimit.mu.Unlock()
+	fs.sizeLimit.limit = limit
+	return nil
+}
+
+// SizeUsage returns the limit set by SetSizeLimit, or 0 if there is none, and
+// the total size in bytes of the regular files in the tmpfs filesystem vfsfs.
+func SizeUsage(vfsfs *vfs.Filesystem) (limit, usage uint64, err error) {
+	fs, ok := vfsfs.Impl().(*filesystem)
+	if !ok {
+		return 0, 0, fmt.Errorf("filesystem is not tmpfs")
+	}
+	fs.sizeLimit.mu.Lock()
+	defer fs.sizeLimit.mu.Unlock()
+	return fs.sizeLimit.limit, fs.sizeLimit.usage, nil
+}
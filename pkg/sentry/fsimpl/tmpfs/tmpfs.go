@@ -88,6 +88,9 @@ type filesystem struct {
 	root *dentry
 
 	maxFilenameLen int
+
+	// sizeLimit accounts for the size of regular files, see SetSizeLimit.
+	sizeLimit sizeLimit
 }
 
 // Name implements vfs.FilesystemType.Name.
@@ -489,6 +492,7 @@ func (i *inode) decRef(ctx context.Context) {
 			// no longer usable, we don't need to grab any locks or update any
 			// metadata.
 			regFile.data.DropAll(regFile.memFile)
+			i.fs.sizeLimit.release(regFile.size.RacyLoad())
 		}
 	})
 }
@@ -845,7 +849,7 @@ func (fd *fileDescription) SetStat(ctx context.Context, opts vfs.SetStatOptions)
 
 // StatFS implements vfs.FileDescriptionImpl.StatFS.
 func (fd *fileDescription) StatFS(ctx context.Context) (linux.Statfs, error) {
-	return globalStatfs, nil
+	return fd.filesystem().statfs(), nil
 }
 
 // ListXattr implements vfs.FileDescriptionImpl.ListXattr.
@@ -0,0 +1,359 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sentry/limits"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// CoreDumpInfo identifies the process that a core dump was taken from.
+type CoreDumpInfo struct {
+	// ContainerID is the ID of the container that the process belongs to.
+	ContainerID string
+
+	// PID is the process ID in the root PID namespace.
+	PID ThreadID
+
+	// Signal is the signal that caused the core dump.
+	Signal linux.Signal
+}
+
+// coreDumper holds the handler set by SetCoreDumpHandler.
+type coreDumper struct {
+	mu sync.Mutex
+
+	// maxSize is the maximum size of core dumps. Core dumps are also limited
+	// by RLIMIT_CORE.
+	maxSize uint64
+
+	// fn is called to start every core dump. It's nil if core dumps are
+	// disabled, which is the default.
+	fn CoreDumpHandler
+}
+
+// CoreDumpHandler is called to start a core dump of size bytes. The core dump
+// is then sent over chunks as it's generated, and chunks is closed once the
+// core dump is complete or aborted. The handler takes ownership of the chunks.
+//
+// The handler is called on the task goroutine of the crashing task, so it must
+// receive the chunks on another goroutine, until chunks is closed. Only
+// coreDumpQueueLen chunks are buffered, after which the crashing task waits
+// for them to be received.
+type CoreDumpHandler func(info CoreDumpInfo, size uint64, chunks <-chan []byte)
+
+// SetCoreDumpHandler enables core dumps of processes killed by signals whose
+// default action is to dump core, e.g. SIGSEGV. fn is called with each ELF core
+// dump, truncated to maxSize bytes or the process' RLIMIT_CORE, whichever is
+// smaller. Like Linux, the other threads of the process are killed first, and
+// the core dump is taken once they've exited. A nil fn disables core dumps.
+func (k *Kernel) SetCoreDumpHandler(maxSize uint64, fn CoreDumpHandler) {
+	k.coreDump.mu.Lock()
+	defer k.coreDump.mu.Unlock()
+	k.coreDump.maxSize = maxSize
+	k.coreDump.fn = fn
+}
+
+// coreDumpHandler returns the handler of core dumps of t's process and their
+// maximum size. It returns a nil handler if no core dump should be taken.
+func (t *Task) coreDumpHandler() (uint64, CoreDumpHandler) {
+	t.k.coreDump.mu.Lock()
+	maxSize, fn := t.k.coreDump.maxSize, t.k.coreDump.fn
+	t.k.coreDump.mu.Unlock()
+	if fn == nil {
+		return 0, nil
+	}
+	if rlimit := t.ThreadGroup().Limits().Get(limits.Core).Cur; rlimit < maxSize {
+		maxSize = rlimit
+	}
+	m := t.MemoryManager()
+	if maxSize == 0 || m == nil || m.Dumpability() == mm.NotDumpable {
+		return 0, nil
+	}
+	return maxSize, fn
+}
+
+// coreDumpStop is a TaskStop placed on a task dumping core while its siblings
+// exit.
+//
+// +stateify savable
+type coreDumpStop struct{}
+
+// Killable implements TaskStop.Killable.
+func (*coreDumpStop) Killable() bool { return true }
+
+// prepareCoreDump initiates a group exit of t's thread group, like
+// PrepareGroupExit, to dump core once t's siblings have exited. It returns nil
+// if no core dump should be taken, e.g. because core dumps are disabled or the
+// thread group is already exiting, in which case the caller should call
+// PrepareGroupExit instead.
+//
+// prepareCoreDump is analogous to Linux's coredump_wait().
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) prepareCoreDump(sig linux.Signal) taskRunState {
+	if _, fn := t.coreDumpHandler(); fn == nil {
+		return nil
+	}
+	t.tg.pidns.owner.mu.Lock()
+	defer t.tg.pidns.owner.mu.Unlock()
+	t.tg.signalHandlers.mu.Lock()
+	defer t.tg.signalHandlers.mu.Unlock()
+	if t.tg.exiting || t.tg.execing != nil {
+		return nil
+	}
+	t.prepareGroupExitLocked(linux.WaitStatusTerminationSignal(sig))
+	if t.tg.liveTasks > 1 {
+		// The last sibling to exit will wake t.
+		t.tg.coreDumping = t
+		t.beginInternalStopLocked((*coreDumpStop)(nil))
+	}
+	return &runCoreDump{sig}
+}
+
+// The runCoreDump state dumps core once the siblings of a task killed by a
+// signal whose default action is to dump core have exited.
+//
+// +stateify savable
+type runCoreDump struct {
+	sig linux.Signal
+}
+
+func (r *runCoreDump) execute(t *Task) taskRunState {
+	t.tg.pidns.owner.mu.Lock()
+	t.tg.coreDumping = nil
+	t.tg.pidns.owner.mu.Unlock()
+	// Don't dump core if t was killed meanwhile, e.g. because its container
+	// is destroyed.
+	if t.killed() || !t.dumpCore(r.sig) {
+		return (*runExit)(nil)
+	}
+	t.tg.signalHandlers.mu.Lock()
+	t.tg.exitStatus = t.tg.exitStatus.WithCoreDump()
+	t.exitStatus = t.tg.exitStatus
+	t.tg.signalHandlers.mu.Unlock()
+	return (*runExit)(nil)
+}
+
+const (
+	// coreDumpChunkSize is the size of the chunks in which the contents of
+	// mappings are passed to the core dump handler.
+	coreDumpChunkSize = 64 << 10
+
+	// coreDumpQueueLen is the number of chunks of a core dump buffered for
+	// the core dump handler.
+	coreDumpQueueLen = 16
+)
+
+// dumpCore passes a core dump of t's process, which is being killed by sig, to
+// the handler set by SetCoreDumpHandler. It returns true if a core dump was
+// taken, and false if it couldn't be taken or was interrupted.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) dumpCore(sig linux.Signal) bool {
+	maxSize, fn := t.coreDumpHandler()
+	if fn == nil {
+		return false
+	}
+	hdr, segs, ok := t.coreDumpHeaders(sig, maxSize)
+	if !ok {
+		t.Debugf("Core dump headers exceed the %d bytes limit, not dumping core", maxSize)
+		return false
+	}
+	size := uint64(len(hdr))
+	for _, seg := range segs {
+		size += seg.filesz
+	}
+	chunks := make(chan []byte, coreDumpQueueLen)
+	defer close(chunks)
+	fn(CoreDumpInfo{
+		ContainerID: t.ContainerID(),
+		PID:         t.k.tasks.Root.IDOfThreadGroup(t.tg),
+		Signal:      sig,
+	}, size, chunks)
+
+	if err := t.sendCoreDumpChunk(chunks, hdr); err != nil {
+		return false
+	}
+	for _, seg := range segs {
+		for off := uint64(0); off < seg.filesz; {
+			n := seg.filesz - off
+			if n > coreDumpChunkSize {
+				n = coreDumpChunkSize
+			}
+			// Unreadable pages are dumped as zeroes.
+			b := make([]byte, n)
+			t.MemoryManager().CopyIn(t, seg.start+hostarch.Addr(off), b, usermem.IOOpts{IgnorePermissions: true})
+			if err := t.sendCoreDumpChunk(chunks, b); err != nil {
+				return false
+			}
+			off += n
+		}
+	}
+	return true
+}
+
+// sendCoreDumpChunk sends b to chunks, blocking until there's room for it or
+// t is interrupted, e.g. because it's killed.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) sendCoreDumpChunk(chunks chan<- []byte, b []byte) error {
+	select {
+	case chunks <- b:
+		return nil
+	default:
+	}
+
+	t.prepareSleep()
+	defer t.completeSleep()
+	select {
+	case chunks <- b:
+		return nil
+	case <-t.interruptChan:
+		// Ensure that Task.interrupted() will return true once we return to
+		// the task run loop.
+		t.interruptSelf()
+		t.Debugf("Core dump interrupted")
+		return linuxerr.ErrInterrupted
+	}
+}
+
+// coreDumpSegment is a mapping whose first filesz bytes are included in a core
+// dump.
+type coreDumpSegment struct {
+	start  hostarch.Addr
+	filesz uint64
+}
+
+// coreDumpHeaders returns the ELF headers and notes of a core dump of t's
+// process, containing t's registers, and the mappings whose contents follow
+// them, truncated so that the core dump is at most maxSize bytes. It returns
+// false if maxSize is too small to hold the headers.
+func (t *Task) coreDumpHeaders(sig linux.Signal, maxSize uint64) ([]byte, []coreDumpSegment, bool) {
+	var machine elf.Machine
+	switch t.Arch().Arch() {
+	case arch.AMD64:
+		machine = elf.EM_X86_64
+	case arch.ARM64:
+		machine = elf.EM_AARCH64
+	default:
+		return nil, nil, false
+	}
+
+	// NT_PRSTATUS, with the registers in the same layout as PTRACE_GETREGS.
+	prstatus := linux.PrStatus{
+		Info:    linux.ElfSiginfo{Signo: int32(sig)},
+		Cursig:  int16(sig),
+		Sighold: uint64(t.SignalMask()),
+		Pid:     int32(t.tg.pidns.IDOfTask(t)),
+		Pgrp:    int32(t.tg.pidns.IDOfProcessGroup(t.tg.ProcessGroup())),
+		Sid:     int32(t.tg.pidns.IDOfSession(t.tg.Session())),
+	}
+	if parent := t.Parent(); parent != nil {
+		prstatus.Ppid = int32(t.tg.pidns.IDOfThreadGroup(parent.tg))
+	}
+	cpu := t.CPUStats()
+	prstatus.Utime = linux.DurationToTimeval(cpu.UserTime)
+	prstatus.Stime = linux.DurationToTimeval(cpu.SysTime)
+	childCPU := t.tg.JoinedChildCPUStats()
+	prstatus.Cutime = linux.DurationToTimeval(childCPU.UserTime)
+	prstatus.Cstime = linux.DurationToTimeval(childCPU.SysTime)
+	var regs bytes.Buffer
+	if _, err := t.Arch().PtraceGetRegs(&regs); err != nil {
+		t.Warningf("Failed to get registers for core dump: %v", err)
+	} else if err := binary.Read(&regs, hostarch.ByteOrder, &prstatus.Regs); err != nil {
+		t.Warningf("Failed to decode registers for core dump: %v", err)
+	}
+	var note bytes.Buffer
+	name := []byte("CORE\x00\x00\x00\x00")
+	binary.Write(&note, hostarch.ByteOrder, [3]uint32{5 /* namesz */, uint32(binary.Size(&prstatus)), uint32(elf.NT_PRSTATUS)})
+	note.Write(name)
+	binary.Write(&note, hostarch.ByteOrder, &prstatus)
+
+	mappings := t.MemoryManager().CoreSegments()
+	ehdrSize, phdrSize := uint64(binary.Size(elf.Header64{})), uint64(binary.Size(elf.Prog64{}))
+	phoff := ehdrSize
+	noteOff := phoff + phdrSize*uint64(1+len(mappings))
+	dataOff := noteOff + uint64(note.Len())
+	if dataOff > maxSize {
+		return nil, nil, false
+	}
+
+	var out bytes.Buffer
+	binary.Write(&out, hostarch.ByteOrder, elf.Header64{
+		Ident:     [elf.EI_NIDENT]byte{0x7f, 'E', 'L', 'F', byte(elf.ELFCLASS64), byte(elf.ELFDATA2LSB), byte(elf.EV_CURRENT)},
+		Type:      uint16(elf.ET_CORE),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Phoff:     phoff,
+		Ehsize:    uint16(ehdrSize),
+		Phentsize: uint16(phdrSize),
+		Phnum:     uint16(1 + len(mappings)),
+	})
+	binary.Write(&out, hostarch.ByteOrder, elf.Prog64{
+		Type:   uint32(elf.PT_NOTE),
+		Off:    noteOff,
+		Filesz: uint64(note.Len()),
+		Align:  4,
+	})
+
+	// Lay out the mappings' contents, truncating them to maxSize.
+	var segs []coreDumpSegment
+	off := dataOff
+	for _, m := range mappings {
+		var filesz uint64
+		if m.Anonymous && m.Perms.Read {
+			filesz = m.Range.Length()
+			if off+filesz > maxSize {
+				filesz = maxSize - off
+			}
+		}
+		var flags elf.ProgFlag
+		if m.Perms.Read {
+			flags |= elf.PF_R
+		}
+		if m.Perms.Write {
+			flags |= elf.PF_W
+		}
+		if m.Perms.Execute {
+			flags |= elf.PF_X
+		}
+		binary.Write(&out, hostarch.ByteOrder, elf.Prog64{
+			Type:   uint32(elf.PT_LOAD),
+			Flags:  uint32(flags),
+			Off:    off,
+			Vaddr:  uint64(m.Range.Start),
+			Filesz: filesz,
+			Memsz:  m.Range.Length(),
+			Align:  hostarch.PageSize,
+		})
+		if filesz > 0 {
+			segs = append(segs, coreDumpSegment{start: m.Range.Start, filesz: filesz})
+		}
+		off += filesz
+	}
+	out.Write(note.Bytes())
+	return out.Bytes(), segs, true
+}
@@ -0,0 +1,146 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"sync/atomic"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/atomicbitops"
+)
+
+// FutexStats contains futex wait statistics for a single container.
+type FutexStats struct {
+	// Waits is the number of futex waits that blocked.
+	Waits uint64
+
+	// WaitTime is the total time spent blocked in futex waits.
+	WaitTime time.Duration
+
+	// MaxWaitTime is the longest time spent blocked in a single futex wait.
+	MaxWaitTime time.Duration
+}
+
+// add accumulates the statistics of ts into s.
+func (s *FutexStats) add(ts *taskFutexStats) {
+	s.Waits += ts.waits.Load()
+	s.WaitTime += time.Duration(ts.waitTime.Load())
+	if max := time.Duration(ts.maxWaitTime.Load()); max > s.MaxWaitTime {
+		s.MaxWaitTime = max
+	}
+}
+
+// taskFutexStats contains futex wait statistics for a single task. They're
+// only updated by the task goroutine, and are accessed using atomic memory
+// operations so that FutexStats can read them from other goroutines.
+type taskFutexStats struct {
+	waits       atomicbitops.Uint64
+	waitTime    atomicbitops.Uint64
+	maxWaitTime atomicbitops.Uint64
+}
+
+// futexStatsSet tracks futex wait statistics of exited tasks per container.
+type futexStatsSet struct {
+	// enabled is non-zero if statistics are being collected. It is accessed
+	// using atomic memory operations so that the disabled case costs a single
+	// load on the futex wait path.
+	enabled uint32
+
+	// exited maps container IDs to the statistics of their tasks that have
+	// been reaped.
+	//
+	// exited is protected by TaskSet.mu.
+	exited map[string]FutexStats
+}
+
+// EnableFutexStats starts collecting futex wait statistics.
+func (k *Kernel) EnableFutexStats() {
+	atomic.StoreUint32(&k.futexStats.enabled, 1)
+}
+
+// FutexStatsEnabled returns true if futex wait statistics are being collected.
+func (k *Kernel) FutexStatsEnabled() bool {
+	return atomic.LoadUint32(&k.futexStats.enabled) != 0
+}
+
+// FutexStats returns the futex wait statistics for the given container.
+func (k *Kernel) FutexStats(cid string) FutexStats {
+	k.tasks.mu.RLock()
+	defer k.tasks.mu.RUnlock()
+	stats := k.futexStats.exited[cid]
+	for t := range k.tasks.Root.tids {
+		if t.containerID == cid {
+			stats.add(&t.futexStats)
+		}
+	}
+	return stats
+}
+
+// ClearFutexStats forgets the futex wait statistics of exited tasks of the
+// given container, e.g. once the container has been destroyed.
+func (k *Kernel) ClearFutexStats(cid string) {
+	k.tasks.mu.Lock()
+	defer k.tasks.mu.Unlock()
+	delete(k.futexStats.exited, cid)
+}
+
+// accumulateFutexStatsLocked records the futex wait statistics of t, which is
+// being reaped, in its container's statistics.
+//
+// Preconditions: The TaskSet mutex must be locked for writing.
+func (k *Kernel) accumulateFutexStatsLocked(t *Task) {
+	if !k.FutexStatsEnabled() || t.futexStats.waits.Load() == 0 {
+		return
+	}
+	if k.futexStats.exited == nil {
+		k.futexStats.exited = make(map[string]FutexStats)
+	}
+	stats := k.futexStats.exited[t.containerID]
+	stats.add(&t.futexStats)
+	k.futexStats.exited[t.containerID] = stats
+}
+
+// FutexWaitBegin must be called before t blocks in a futex wait. It returns a
+// value that must be passed to FutexWaitEnd once the wait completes.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) FutexWaitBegin() time.Time {
+	if !t.k.FutexStatsEnabled() {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// FutexWaitEnd accounts a futex wait started by FutexWaitBegin to t.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) FutexWaitEnd(start time.Time) {
+	if start.IsZero() {
+		return
+	}
+	t.recordFutexWait(time.Since(start))
+}
+
+// recordFutexWait accounts a futex wait of duration d to t.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) recordFutexWait(d time.Duration) {
+	s := &t.futexStats
+	s.waits.Add(1)
+	s.waitTime.Add(uint64(d))
+	if uint64(d) > s.maxWaitTime.Load() {
+		s.maxWaitTime.Store(uint64(d))
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFutexStats(t *testing.T) {
+	k := &Kernel{}
+	k.tasks = newTaskSet(newPIDNamespace(nil, nil, nil))
+	if k.FutexStatsEnabled() {
+		t.Fatalf("futex stats enabled by default")
+	}
+
+	k.EnableFutexStats()
+	if !k.FutexStatsEnabled() {
+		t.Fatalf("futex stats not enabled after EnableFutexStats")
+	}
+	foo1 := &Task{k: k, containerID: "foo"}
+	foo2 := &Task{k: k, containerID: "foo"}
+	bar := &Task{k: k, containerID: "bar"}
+	for i, task := range []*Task{foo1, foo2, bar} {
+		k.tasks.Root.tids[task] = ThreadID(i + 1)
+	}
+	foo1.recordFutexWait(time.Second)
+	foo1.recordFutexWait(3 * time.Second)
+	foo2.recordFutexWait(2 * time.Second)
+	bar.recordFutexWait(2 * time.Second)
+
+	// Statistics of reaped tasks are kept.
+	k.tasks.mu.Lock()
+	k.accumulateFutexStatsLocked(foo1)
+	delete(k.tasks.Root.tids, foo1)
+	k.tasks.mu.Unlock()
+
+	for _, tc := range []struct {
+		cid  string
+		want FutexStats
+	}{
+		{
+			cid:  "foo",
+			want: FutexStats{Waits: 3, WaitTime: 6 * time.Second, MaxWaitTime: 3 * time.Second},
+		},
+		{
+			cid:  "bar",
+			want: FutexStats{Waits: 1, WaitTime: 2 * time.Second, MaxWaitTime: 2 * time.Second},
+		},
+		{
+			cid:  "baz",
+			want: FutexStats{},
+		},
+	} {
+		if got := k.FutexStats(tc.cid); got != tc.want {
+			t.Errorf("FutexStats(%q): got %+v, want %+v", tc.cid, got, tc.want)
+		}
+	}
+
+	// Clearing the container's statistics forgets reaped tasks.
+	k.ClearFutexStats("foo")
+	want := FutexStats{Waits: 1, WaitTime: 2 * time.Second, MaxWaitTime: 2 * time.Second}
+	if got := k.FutexStats("foo"); got != want {
+		t.Errorf("FutexStats(foo) after ClearFutexStats: got %+v, want %+v", got, want)
+	}
+}
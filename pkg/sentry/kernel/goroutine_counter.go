@@ -0,0 +1,79 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// goroutineCounter counts goroutines like a sync.WaitGroup, but waiting for the
+// count to reach zero can be given up without leaving a waiter behind, which
+// would be a misuse of sync.WaitGroup once the count goes up again.
+type goroutineCounter struct {
+	mu sync.Mutex
+
+	// count is the number of goroutines. It's protected by mu.
+	count int64
+
+	// zero is closed when count drops to zero. It's nil if nobody is
+	// waiting. It's protected by mu.
+	zero chan struct{}
+}
+
+// closedChan is returned by goroutineCounter.Zero if the count is zero.
+var closedChan = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+// Add adds delta, which may be negative, to the count.
+func (c *goroutineCounter) Add(delta int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.count += int64(delta)
+	if c.count < 0 {
+		panic(fmt.Sprintf("negative goroutine count: %d", c.count))
+	}
+	if c.count == 0 && c.zero != nil {
+		close(c.zero)
+		c.zero = nil
+	}
+}
+
+// Done decrements the count by one.
+func (c *goroutineCounter) Done() {
+	c.Add(-1)
+}
+
+// Zero returns a channel that is closed once the count is zero.
+func (c *goroutineCounter) Zero() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.count == 0 {
+		return closedChan
+	}
+	if c.zero == nil {
+		c.zero = make(chan struct{})
+	}
+	return c.zero
+}
+
+// Wait blocks until the count is zero.
+func (c *goroutineCounter) Wait() {
+	<-c.Zero()
+}
@@ -0,0 +1,58 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGoroutineCounter(t *testing.T) {
+	var c goroutineCounter
+	select {
+	case <-c.Zero():
+	default:
+		t.Fatalf("Zero() of a new counter isn't closed")
+	}
+
+	c.Add(2)
+	zero := c.Zero()
+
+	// Giving up on a wait leaves nothing behind that prevents reuse.
+	timer := time.NewTimer(10 * time.Millisecond)
+	if waitZero(timer.C, &c) {
+		t.Fatalf("waitZero() succeeded with a non-zero count")
+	}
+	c.Done()
+	select {
+	case <-zero:
+		t.Fatalf("Zero() closed with a non-zero count")
+	default:
+	}
+	c.Done()
+	select {
+	case <-zero:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Zero() not closed after the count dropped to zero")
+	}
+
+	// The counter can go up again after reaching zero.
+	c.Add(1)
+	if zero := c.Zero(); zero == closedChan {
+		t.Errorf("Zero() returned a closed channel with a non-zero count")
+	}
+	c.Done()
+	c.Wait()
+}
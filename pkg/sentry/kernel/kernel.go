@@ -35,6 +35,7 @@ import (
 	"errors"
 	"fmt"
 	"path/filepath"
+	"sort"
 	"sync/atomic"
 	"time"
 
@@ -78,6 +79,7 @@ import (
 	"gvisor.dev/gvisor/pkg/state/wire"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/waiter"
 )
 
 // VFS2Enabled is set to true when VFS2 is enabled. Added as a global to allow
@@ -335,6 +337,45 @@ type Kernel struct {
 	// userCountersMa maps auth.KUID into a set of user counters.
 	userCountersMap   map[auth.KUID]*userCounters
 	userCountersMapMu sync.Mutex `state:"nosave"`
+
+	// futexStats records per-container futex wait statistics. It is only
+	// updated after EnableFutexStats is called.
+	futexStats futexStatsSet `state:"nosave"`
+
+	// readAhead holds per-container read-ahead windows set with
+	// SetReadAhead.
+	readAhead readAheadSet
+
+	// syncPolicies holds per-container sync policies set with
+	// SetSyncPolicy.
+	syncPolicies syncPolicySet
+
+	// schedLatency holds per-container scheduling latency targets set with
+	// SetSchedLatency.
+	schedLatency schedLatencySet
+
+	// syscallPolicies holds per-container syscall policies set with
+	// SetSyscallPolicy and TightenSyscallPolicy.
+	syscallPolicies syscallPolicySet
+
+	// oom holds the state of out-of-memory handling, see SetOOMBehavior.
+	oom oomHandler `state:"nosave"`
+
+	// initSignal holds the signal intercepted when sent to the global init
+	// process, see InterceptInitSignal.
+	initSignal signalInterceptor `state:"nosave"`
+
+	// coreDump holds the handler that core dumps are passed to, see
+	// SetCoreDumpHandler.
+	coreDump coreDumper `state:"nosave"`
+
+	// madviseMode is the MadviseMode in effect. It is accessed using atomic
+	// memory operations.
+	madviseMode uint32 `state:"nosave"`
+
+	// lifecycleEvents holds the handler that process lifecycle events are
+	// reported to, see SetLifecycleEventHandler.
+	lifecycleEvents lifecycleEventHandler `state:"nosave"`
 }
 
 // InitKernelArgs holds arguments to Init.
@@ -475,11 +516,29 @@ func (k *Kernel) Init(args InitKernelArgs) error {
 	return nil
 }
 
+// SaveProgressFunc is called by SaveToProgress when a phase of the save
+// starts, and as the memory file is written out during the "memory" phase,
+// with the number of pages written so far.
+type SaveProgressFunc func(phase string, pages uint64)
+
 // SaveTo saves the state of k to w.
 //
 // Preconditions: The kernel must be paused throughout the call to SaveTo.
 func (k *Kernel) SaveTo(ctx context.Context, w wire.Writer) error {
+	return k.SaveToProgress(ctx, w, nil)
+}
+
+// SaveToProgress is like SaveTo, but reports its progress to progress, if
+// it's not nil. The phases are "prepare", "kernel" and "memory".
+//
+// Preconditions: The kernel must be paused throughout the call to
+// SaveToProgress.
+func (k *Kernel) SaveToProgress(ctx context.Context, w wire.Writer, progress SaveProgressFunc) error {
+	if progress == nil {
+		progress = func(string, uint64) {}
+	}
 	saveStart := time.Now()
+	progress("prepare", 0)
 
 	// Do not allow other Kernel methods to affect it while it's being saved.
 	k.extMu.Lock()
@@ -544,6 +603,7 @@ func (k *Kernel) SaveTo(ctx context.Context, w wire.Writer) error {
 	// entire kernel, which may fail on an incompatible machine.
 	//
 	// N.B. This will also be saved along with the full kernel save below.
+	progress("kernel", 0)
 	cpuidStart := time.Now()
 	if _, err := state.Save(ctx, w, &k.featureSet); err != nil {
 		return err
@@ -562,8 +622,9 @@ func (k *Kernel) SaveTo(ctx context.Context, w wire.Writer) error {
 	log.Infof("Kernel save took [%s].", time.Since(kernelStart))
 
 	// Save the memory file's state.
+	progress("memory", 0)
 	memoryStart := time.Now()
-	if err := k.mf.SaveTo(ctx, w); err != nil {
+	if err := k.mf.SaveToProgress(ctx, w, func(pages uint64) { progress("memory", pages) }); err != nil {
 		return err
 	}
 	log.Infof("Memory save took [%s].", time.Since(memoryStart))
@@ -814,6 +875,10 @@ type CreateProcessArgs struct {
 	// PIDNamespace is the initial PID Namespace.
 	PIDNamespace *PIDNamespace
 
+	// NetworkNamespace is the initial network namespace. If nil, the root
+	// network namespace is used.
+	NetworkNamespace *inet.Namespace
+
 	// AbstractSocketNamespace is the initial Abstract Socket namespace.
 	AbstractSocketNamespace *AbstractSocketNamespace
 
@@ -833,6 +898,9 @@ type CreateProcessArgs struct {
 
 	// ContainerID is the container that the process belongs to.
 	ContainerID string
+
+	// NoNewPrivs is the no_new_privs bit of the process.
+	NoNewPrivs bool
 }
 
 // NewContext returns a context.Context that represents the task that will be
@@ -1049,6 +1117,11 @@ func (k *Kernel) CreateProcess(args CreateProcessArgs) (*ThreadGroup, ThreadID,
 	// TaskSet.NewTask().
 	args.FDTable.IncRef()
 
+	netns := args.NetworkNamespace
+	if netns == nil {
+		netns = k.RootNetworkNamespace()
+	}
+
 	// Create the task.
 	config := &TaskConfig{
 		Kernel:                  k,
@@ -1057,7 +1130,7 @@ func (k *Kernel) CreateProcess(args CreateProcessArgs) (*ThreadGroup, ThreadID,
 		FSContext:               fsContext,
 		FDTable:                 args.FDTable,
 		Credentials:             args.Credentials,
-		NetworkNamespace:        k.RootNetworkNamespace(),
+		NetworkNamespace:        netns,
 		AllowedCPUMask:          sched.NewFullCPUSet(k.applicationCores),
 		UTSNamespace:            args.UTSNamespace,
 		IPCNamespace:            args.IPCNamespace,
@@ -1065,6 +1138,7 @@ func (k *Kernel) CreateProcess(args CreateProcessArgs) (*ThreadGroup, ThreadID,
 		MountNamespaceVFS2:      mntnsVFS2,
 		ContainerID:             args.ContainerID,
 		UserCounters:            k.GetUserCounters(args.Credentials.RealKUID),
+		NoNewPrivs:              args.NoNewPrivs,
 	}
 	t, err := k.tasks.NewTask(ctx, config)
 	if err != nil {
@@ -1321,6 +1395,49 @@ func (k *Kernel) Pause() {
 	k.tasks.aioGoroutines.Wait()
 }
 
+// PauseTimeout is like Pause, but gives up if tasks haven't all stopped within
+// timeout. In that case, the pause is ended as if by Unpause, and
+// PauseTimeout returns false along with the IDs of the tasks that hadn't
+// stopped, in the root PID namespace.
+func (k *Kernel) PauseTimeout(timeout time.Duration) ([]ThreadID, bool) {
+	k.extMu.Lock()
+	k.tasks.BeginExternalStop()
+	k.extMu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	if waitZero(timer.C, &k.tasks.runningGoroutines, &k.tasks.aioGoroutines) {
+		return nil, true
+	}
+
+	var running []ThreadID
+	k.tasks.mu.RLock()
+	for t, tid := range k.tasks.Root.tids {
+		switch t.TaskGoroutineSchedInfo().State {
+		case TaskGoroutineStopped, TaskGoroutineNonexistent:
+		default:
+			running = append(running, tid)
+		}
+	}
+	k.tasks.mu.RUnlock()
+	k.Unpause()
+	sort.Slice(running, func(i, j int) bool { return running[i] < running[j] })
+	return running, false
+}
+
+// waitZero waits for each of counters to be zero in turn, like Pause. It
+// returns false if timeout fires first.
+func waitZero(timeout <-chan time.Time, counters ...*goroutineCounter) bool {
+	for _, c := range counters {
+		select {
+		case <-c.Zero():
+		case <-timeout:
+			return false
+		}
+	}
+	return true
+}
+
 // ReceiveTaskStates receives full states for all tasks.
 func (k *Kernel) ReceiveTaskStates() {
 	k.extMu.Lock()
@@ -1328,6 +1445,14 @@ func (k *Kernel) ReceiveTaskStates() {
 	k.extMu.Unlock()
 }
 
+// IsPaused returns true if a call to Pause hasn't been matched by Unpause yet.
+// It doesn't take extMu, so it doesn't block while k is being saved.
+func (k *Kernel) IsPaused() bool {
+	k.tasks.mu.RLock()
+	defer k.tasks.mu.RUnlock()
+	return k.tasks.stopCount > 0
+}
+
 // Unpause ends the effect of a previous call to Pause. If Unpause is called
 // without a matching preceding call to Pause, Unpause may panic.
 func (k *Kernel) Unpause() {
@@ -1336,6 +1461,71 @@ func (k *Kernel) Unpause() {
 	k.tasks.EndExternalStop()
 }
 
+// PauseContainer requests that all tasks of container cid temporarily stop
+// executing, and blocks until they have stopped. Tasks that the container
+// creates while it's paused start stopped. Other containers keep running.
+// Multiple calls to PauseContainer nest and require an equal number of calls
+// to UnpauseContainer to resume execution.
+//
+// If cancel is closed before all tasks have stopped, the pause is undone and
+// PauseContainer returns false. cancel may be nil.
+func (k *Kernel) PauseContainer(cid string, cancel <-chan struct{}) bool {
+	k.extMu.Lock()
+	stopped := k.tasks.beginContainerStop(cid)
+	k.extMu.Unlock()
+	if cancel == nil {
+		for _, t := range stopped {
+			t.goroutineStopped.Wait()
+		}
+		return true
+	}
+
+	e, ch := waiter.NewChannelEntry(waiter.EventIn)
+	k.tasks.goroutineStoppedQueue.EventRegister(&e)
+	defer k.tasks.goroutineStoppedQueue.EventUnregister(&e)
+	for {
+		for len(stopped) > 0 && stopped[0].goroutineStoppedOrExited() {
+			stopped = stopped[1:]
+		}
+		if len(stopped) == 0 {
+			return true
+		}
+		select {
+		case <-ch:
+		case <-cancel:
+			k.UnpauseContainer(cid)
+			return false
+		}
+	}
+}
+
+// UnpauseContainer ends the effect of a previous call to PauseContainer(cid).
+// Tasks that were stopped for other reasons, e.g. by SIGSTOP, stay stopped.
+// It returns false if the container isn't paused.
+func (k *Kernel) UnpauseContainer(cid string) bool {
+	k.extMu.Lock()
+	defer k.extMu.Unlock()
+	return k.tasks.endContainerStop(cid)
+}
+
+// ClearContainerPauses ends all pauses of container cid started by
+// PauseContainer, e.g. so that its tasks can be killed when it's destroyed.
+// Afterwards, the container's new tasks no longer start stopped.
+func (k *Kernel) ClearContainerPauses(cid string) {
+	k.extMu.Lock()
+	defer k.extMu.Unlock()
+	for k.tasks.endContainerStop(cid) {
+	}
+}
+
+// ContainerPaused returns true if container cid is paused, either by
+// PauseContainer(cid) or because the whole kernel is paused by Pause.
+func (k *Kernel) ContainerPaused(cid string) bool {
+	k.tasks.mu.RLock()
+	defer k.tasks.mu.RUnlock()
+	return k.tasks.stopCount > 0 || k.tasks.containerStops[cid] > 0
+}
+
 // SendExternalSignal injects a signal into the kernel.
 //
 // context is used only for debugging to describe how the signal was received.
@@ -1355,26 +1545,54 @@ func (k *Kernel) SendExternalSignalThreadGroup(tg *ThreadGroup, info *linux.Sign
 	return tg.SendSignal(info)
 }
 
+// SendExternalSignalThreadGroupCoalesced is like SendExternalSignalThreadGroup,
+// but also returns whether the signal was coalesced with an identical
+// standard signal already pending for tg.
+func (k *Kernel) SendExternalSignalThreadGroupCoalesced(tg *ThreadGroup, info *linux.SignalInfo) (bool, error) {
+	k.extMu.Lock()
+	defer k.extMu.Unlock()
+	tg.pidns.owner.mu.RLock()
+	defer tg.pidns.owner.mu.RUnlock()
+	tg.signalHandlers.mu.Lock()
+	defer tg.signalHandlers.mu.Unlock()
+
+	sig := linux.Signal(info.Signo)
+	coalesced := sig.IsValid() && !sig.IsRealtime() && tg.pendingSignals.pendingSet&linux.SignalSetOf(sig) != 0
+	if err := tg.leader.sendSignalLocked(info, true /* group */); err != nil {
+		return false, err
+	}
+	return coalesced, nil
+}
+
 // SendContainerSignal sends the given signal to all processes inside the
-// namespace that match the given container ID.
-func (k *Kernel) SendContainerSignal(cid string, info *linux.SignalInfo) error {
+// namespace that match the given container ID. It returns the number of
+// processes signaled. Processes that exit concurrently are skipped.
+func (k *Kernel) SendContainerSignal(cid string, info *linux.SignalInfo) (int, error) {
 	k.extMu.Lock()
 	defer k.extMu.Unlock()
 	k.tasks.mu.RLock()
 	defer k.tasks.mu.RUnlock()
 
-	var lastErr error
+	var (
+		count   int
+		lastErr error
+	)
 	for tg := range k.tasks.Root.tgids {
 		if tg.leader.ContainerID() == cid {
 			tg.signalHandlers.mu.Lock()
 			infoCopy := *info
-			if err := tg.leader.sendSignalLocked(&infoCopy, true /*group*/); err != nil {
+			switch err := tg.leader.sendSignalLocked(&infoCopy, true /*group*/); {
+			case err == nil:
+				count++
+			case linuxerr.Equals(linuxerr.ESRCH, err):
+				// The process is exiting.
+			default:
 				lastErr = err
 			}
 			tg.signalHandlers.mu.Unlock()
 		}
 	}
-	return lastErr
+	return count, lastErr
 }
 
 // RebuildTraceContexts rebuilds the trace context for all tasks.
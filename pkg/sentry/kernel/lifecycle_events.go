@@ -0,0 +1,122 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"sync/atomic"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// LifecycleEventType is the type of a LifecycleEvent.
+type LifecycleEventType int
+
+const (
+	// ProcessExitedEvent is emitted when the last task of a thread group
+	// exits.
+	ProcessExitedEvent LifecycleEventType = iota
+
+	// SignalDeliveredEvent is emitted when a signal is dequeued by a task to
+	// be handled, ignored or to take its default action. SIGKILL isn't
+	// reported, since it kills the thread group without being dequeued.
+	SignalDeliveredEvent
+
+	// OOMKilledEvent is emitted when a thread group is killed to free memory,
+	// see OOMKillVictim.
+	OOMKilledEvent
+
+	// OOMFaultEvent is emitted when a page fault by a task fails for lack of
+	// memory, whatever the OOMBehavior.
+	OOMFaultEvent
+)
+
+// String implements fmt.Stringer.
+func (t LifecycleEventType) String() string {
+	switch t {
+	case ProcessExitedEvent:
+		return "exit"
+	case SignalDeliveredEvent:
+		return "signal"
+	case OOMKilledEvent:
+		return "oom"
+	case OOMFaultEvent:
+		return "oom-fault"
+	default:
+		return "unknown"
+	}
+}
+
+// LifecycleEvent describes a process lifecycle transition.
+type LifecycleEvent struct {
+	Type LifecycleEventType
+
+	// ContainerID is the ID of the container that the process belongs to.
+	ContainerID string
+
+	// PID is the process ID in the root PID namespace.
+	PID ThreadID
+
+	// ExitStatus is the exit status of the process. It's only set for
+	// ProcessExitedEvent.
+	ExitStatus linux.WaitStatus
+
+	// Signal is the delivered signal. It's only set for SignalDeliveredEvent.
+	Signal linux.Signal
+}
+
+// lifecycleEventHandler holds the handler set by SetLifecycleEventHandler.
+type lifecycleEventHandler struct {
+	// enabled is 1 if fn is non-nil. It is accessed using atomic memory
+	// operations, so that hot paths can skip building events without
+	// locking mu.
+	enabled uint32
+
+	mu sync.RWMutex
+
+	// fn is called for every event. It's nil if events aren't reported.
+	fn func(LifecycleEvent)
+}
+
+// SetLifecycleEventHandler causes fn to be called for every process lifecycle
+// event. fn is called with kernel locks held, so it must not block or call
+// back into the kernel. A nil fn stops reporting events.
+func (k *Kernel) SetLifecycleEventHandler(fn func(LifecycleEvent)) {
+	k.lifecycleEvents.mu.Lock()
+	defer k.lifecycleEvents.mu.Unlock()
+	k.lifecycleEvents.fn = fn
+	var enabled uint32
+	if fn != nil {
+		enabled = 1
+	}
+	atomic.StoreUint32(&k.lifecycleEvents.enabled, enabled)
+}
+
+// lifecycleEventsEnabled returns true if a handler is set by
+// SetLifecycleEventHandler. Callers on hot paths check it before building an
+// event for emitLifecycleEvent.
+func (k *Kernel) lifecycleEventsEnabled() bool {
+	return atomic.LoadUint32(&k.lifecycleEvents.enabled) != 0
+}
+
+// emitLifecycleEvent reports ev to the handler set by
+// SetLifecycleEventHandler, if any.
+func (k *Kernel) emitLifecycleEvent(ev LifecycleEvent) {
+	k.lifecycleEvents.mu.RLock()
+	defer k.lifecycleEvents.mu.RUnlock()
+	if k.lifecycleEvents.fn != nil {
+		k.lifecycleEvents.fn(ev)
+	}
+}
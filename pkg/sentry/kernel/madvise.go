@@ -0,0 +1,69 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// MadviseMode determines whether the sentry passes application memory advice
+// through to the host. MADV_FREE is ignored in either mode.
+type MadviseMode uint32
+
+const (
+	// MadvisePassthrough releases memory freed with madvise(MADV_DONTNEED) to
+	// the host, along with all other freed memory. This is the default.
+	MadvisePassthrough MadviseMode = iota
+
+	// MadviseIgnore keeps freed memory committed for reuse by the sandbox
+	// instead of releasing it to the host. MADV_DONTNEED still drops the
+	// advised pages from the address space, since they must read back as
+	// zeroes.
+	MadviseIgnore
+)
+
+// String implements fmt.Stringer.
+func (m MadviseMode) String() string {
+	switch m {
+	case MadvisePassthrough:
+		return "passthrough"
+	case MadviseIgnore:
+		return "ignore"
+	default:
+		return fmt.Sprintf("MadviseMode(%d)", uint32(m))
+	}
+}
+
+// ParseMadviseMode parses a MadviseMode from its string representation.
+func ParseMadviseMode(s string) (MadviseMode, error) {
+	for _, m := range []MadviseMode{MadvisePassthrough, MadviseIgnore} {
+		if m.String() == s {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid madvise mode %q, must be 'passthrough' or 'ignore'", s)
+}
+
+// SetMadviseMode sets whether memory advice is passed through to the host.
+func (k *Kernel) SetMadviseMode(m MadviseMode) {
+	atomic.StoreUint32(&k.madviseMode, uint32(m))
+	k.mf.SetReleaseToHost(m == MadvisePassthrough)
+}
+
+// MadviseMode returns whether memory advice is passed through to the host.
+func (k *Kernel) MadviseMode() MadviseMode {
+	return MadviseMode(atomic.LoadUint32(&k.madviseMode))
+}
@@ -16,6 +16,8 @@
 package msgqueue
 
 import (
+	"math"
+
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
@@ -27,16 +29,8 @@ import (
 	"gvisor.dev/gvisor/pkg/waiter"
 )
 
-const (
-	// System-wide limit for maximum number of queues.
-	maxQueues = linux.MSGMNI
-
-	// Maximum size of a queue in bytes.
-	maxQueueBytes = linux.MSGMNB
-
-	// Maximum size of a message in bytes.
-	maxMessageBytes = linux.MSGMAX
-)
+// System-wide limit for maximum number of queues.
+const maxQueues = linux.MSGMNI
 
 // Registry contains a set of message queues that can be referenced using keys
 // or IDs.
@@ -48,13 +42,61 @@ type Registry struct {
 
 	// reg defines basic fields and operations needed for all SysV registries.
 	reg *ipc.Registry
+
+	// maxQueueBytes is the default maximum size of a queue in bytes,
+	// analogous to /proc/sys/kernel/msgmnb.
+	maxQueueBytes uint64
+
+	// maxMessageBytes is the maximum size of a message in bytes, analogous to
+	// /proc/sys/kernel/msgmax.
+	maxMessageBytes uint64
 }
 
 // NewRegistry returns a new Registry ready to be used.
 func NewRegistry(userNS *auth.UserNamespace) *Registry {
 	return &Registry{
-		reg: ipc.NewRegistry(userNS),
+		reg:             ipc.NewRegistry(userNS),
+		maxQueueBytes:   linux.MSGMNB,
+		maxMessageBytes: linux.MSGMAX,
+	}
+}
+
+// Limits returns the maximum size of a message and the default maximum size
+// of a queue, both in bytes.
+func (r *Registry) Limits() (maxMessageBytes, maxQueueBytes uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.maxMessageBytes, r.maxQueueBytes
+}
+
+// ValidateLimits returns an error if maxMessageBytes and maxQueueBytes aren't
+// valid limits for SetLimits.
+func ValidateLimits(maxMessageBytes, maxQueueBytes uint64) error {
+	if maxMessageBytes == 0 || maxMessageBytes > math.MaxInt32 || maxQueueBytes == 0 || maxQueueBytes > math.MaxInt32 {
+		return linuxerr.EINVAL
+	}
+	return nil
+}
+
+// SetLimits sets the maximum size of a message and the default maximum size of
+// a queue, both in bytes. Queues that already exist keep their current size
+// limit.
+func (r *Registry) SetLimits(maxMessageBytes, maxQueueBytes uint64) error {
+	if err := ValidateLimits(maxMessageBytes, maxQueueBytes); err != nil {
+		return err
 	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.maxMessageBytes = maxMessageBytes
+	r.maxQueueBytes = maxQueueBytes
+	return nil
+}
+
+// MaxMessageBytes returns the maximum size of a message in bytes.
+func (r *Registry) MaxMessageBytes() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.maxMessageBytes
 }
 
 // Queue represents a SysV message queue, described by sysvipc(7).
@@ -182,7 +224,7 @@ func (r *Registry) newQueueLocked(ctx context.Context, key ipc.Key, creator fs.F
 		sendTime:    ktime.ZeroTime,
 		receiveTime: ktime.ZeroTime,
 		changeTime:  ktime.NowFromContext(ctx),
-		maxBytes:    maxQueueBytes,
+		maxBytes:    r.maxQueueBytes,
 	}
 
 	err := r.reg.Register(q)
@@ -218,11 +260,13 @@ func (r *Registry) FindByID(id ipc.ID) (*Queue, error) {
 
 // IPCInfo reports global parameters for message queues. See msgctl(IPC_INFO).
 func (r *Registry) IPCInfo(ctx context.Context) *linux.MsgInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	return &linux.MsgInfo{
 		MsgPool: linux.MSGPOOL,
 		MsgMap:  linux.MSGMAP,
-		MsgMax:  linux.MSGMAX,
-		MsgMnb:  linux.MSGMNB,
+		MsgMax:  int32(r.maxMessageBytes),
+		MsgMnb:  int32(r.maxQueueBytes),
 		MsgMni:  linux.MSGMNI,
 		MsgSsz:  linux.MSGSSZ,
 		MsgTql:  linux.MSGTQL,
@@ -230,6 +274,38 @@ func (r *Registry) IPCInfo(ctx context.Context) *linux.MsgInfo {
 	}
 }
 
+// QueueInfo describes a message queue.
+type QueueInfo struct {
+	ID  ipc.ID  `json:"id"`
+	Key ipc.Key `json:"key"`
+
+	// Messages is the number of messages in the queue.
+	Messages uint64 `json:"messages"`
+
+	// Bytes is the number of message bytes in the queue.
+	Bytes uint64 `json:"bytes"`
+}
+
+// Queues returns information about all queues in the registry.
+func (r *Registry) Queues() []QueueInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var infos []QueueInfo
+	r.reg.ForAllObjects(func(o ipc.Mechanism) {
+		q := o.(*Queue)
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		infos = append(infos, QueueInfo{
+			ID:       q.obj.ID,
+			Key:      q.obj.Key,
+			Messages: q.messageCount,
+			Bytes:    q.byteCount,
+		})
+	})
+	return infos
+}
+
 // MsgInfo reports global parameters for message queues. See msgctl(MSG_INFO).
 func (r *Registry) MsgInfo(ctx context.Context) *linux.MsgInfo {
 	r.mu.Lock()
@@ -250,8 +326,8 @@ func (r *Registry) MsgInfo(ctx context.Context) *linux.MsgInfo {
 		MsgPool: int32(r.reg.ObjectCount()),
 		MsgMap:  int32(messages),
 		MsgTql:  int32(bytes),
-		MsgMax:  linux.MSGMAX,
-		MsgMnb:  linux.MSGMNB,
+		MsgMax:  int32(r.maxMessageBytes),
+		MsgMnb:  int32(r.maxQueueBytes),
 		MsgMni:  linux.MSGMNI,
 		MsgSsz:  linux.MSGSSZ,
 		MsgSeg:  linux.MSGSEG,
@@ -355,7 +431,7 @@ func (q *Queue) push(ctx context.Context, m Message, creds *auth.Credentials, pi
 
 // Receive removes a message from the queue and returns it. See msgrcv(2).
 func (q *Queue) Receive(ctx context.Context, b Blocker, mType int64, maxSize int64, wait, truncate, except bool, pid int32) (*Message, error) {
-	if maxSize < 0 || maxSize > maxMessageBytes {
+	if maxSize < 0 || uint64(maxSize) > q.registry.MaxMessageBytes() {
 		return nil, linuxerr.EINVAL
 	}
 	max := uint64(maxSize)
@@ -519,6 +595,8 @@ func (q *Queue) msgAtIndex(mType int64) *Message {
 
 // Set modifies some values of the queue. See msgctl(IPC_SET).
 func (q *Queue) Set(ctx context.Context, ds *linux.MsqidDS) error {
+	_, maxQueueBytes := q.registry.Limits()
+
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
@@ -0,0 +1,305 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/sentry/usage"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+// oomScoreAdjMin is the oom_score_adj value that disables OOM killing for a
+// process, OOM_SCORE_ADJ_MIN in Linux.
+const oomScoreAdjMin = -1000
+
+// maxOOMKills is the number of processes that OOMKillVictim kills for a
+// single page fault before giving up and failing it.
+const maxOOMKills = 3
+
+// OOMBehavior determines how the sentry reacts when it runs out of memory
+// while handling an application page fault.
+type OOMBehavior uint32
+
+const (
+	// OOMSegfault fails the faulting access, so the faulting task gets a
+	// SIGSEGV. This is the default.
+	OOMSegfault OOMBehavior = iota
+
+	// OOMKillVictim kills the process with the highest OOM score, like
+	// Linux's OOM killer, and retries the fault once it has exited. The
+	// fault fails as with OOMSegfault if there is no process to kill, or
+	// after maxOOMKills processes were killed for it.
+	OOMKillVictim
+
+	// OOMPauseAndNotify pauses the faulting task until an orchestrator, which
+	// can watch for paused tasks with Kernel.OOMState, intervenes with
+	// Kernel.ResolveOOM or Kernel.SetOOMBehavior. The fault is then retried.
+	OOMPauseAndNotify
+)
+
+// String implements fmt.Stringer.
+func (b OOMBehavior) String() string {
+	switch b {
+	case OOMSegfault:
+		return "segfault"
+	case OOMKillVictim:
+		return "kill-victim"
+	case OOMPauseAndNotify:
+		return "pause-and-notify"
+	default:
+		return fmt.Sprintf("OOMBehavior(%d)", uint32(b))
+	}
+}
+
+// oomSegfaultAlias is the former name of OOMSegfault, still accepted by
+// ParseOOMBehavior.
+const oomSegfaultAlias = "return-enomem"
+
+// ParseOOMBehavior parses an OOMBehavior from its string representation.
+func ParseOOMBehavior(s string) (OOMBehavior, error) {
+	if s == oomSegfaultAlias {
+		return OOMSegfault, nil
+	}
+	for _, b := range []OOMBehavior{OOMSegfault, OOMKillVictim, OOMPauseAndNotify} {
+		if b.String() == s {
+			return b, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid OOM behavior %q, must be 'segfault', 'kill-victim', or 'pause-and-notify'", s)
+}
+
+// OOMState reports the state of the sentry's out-of-memory handling.
+type OOMState struct {
+	// Behavior is the current OOM behavior.
+	Behavior string
+
+	// Events is the number of page faults that failed for lack of memory.
+	Events uint64
+
+	// Killed is the number of processes killed by OOMKillVictim.
+	Killed uint64
+
+	// Paused is the number of tasks currently paused by OOMPauseAndNotify.
+	Paused int
+}
+
+// oomHandler holds the state of the sentry's out-of-memory handling.
+type oomHandler struct {
+	// behavior is the OOMBehavior in effect. It is accessed using atomic
+	// memory operations.
+	behavior uint32
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	events uint64
+	killed uint64
+	paused int
+
+	// resolved is closed to wake up tasks paused by OOMPauseAndNotify. It's
+	// nil if no task is paused.
+	resolved chan struct{}
+}
+
+// SetOOMBehavior sets how the sentry reacts when it runs out of memory. Tasks
+// paused by OOMPauseAndNotify are woken up to retry under the new behavior.
+func (k *Kernel) SetOOMBehavior(b OOMBehavior) {
+	atomic.StoreUint32(&k.oom.behavior, uint32(b))
+	k.ResolveOOM()
+}
+
+// OOMBehavior returns how the sentry reacts when it runs out of memory.
+func (k *Kernel) OOMBehavior() OOMBehavior {
+	return OOMBehavior(atomic.LoadUint32(&k.oom.behavior))
+}
+
+// OOMState returns the state of the sentry's out-of-memory handling.
+func (k *Kernel) OOMState() OOMState {
+	k.oom.mu.Lock()
+	defer k.oom.mu.Unlock()
+	return OOMState{
+		Behavior: k.OOMBehavior().String(),
+		Events:   k.oom.events,
+		Killed:   k.oom.killed,
+		Paused:   k.oom.paused,
+	}
+}
+
+// ResolveOOM wakes up tasks paused by OOMPauseAndNotify, e.g. after memory has
+// been freed, so that they retry their faults.
+func (k *Kernel) ResolveOOM() {
+	k.oom.mu.Lock()
+	defer k.oom.mu.Unlock()
+	if k.oom.resolved != nil {
+		close(k.oom.resolved)
+		k.oom.resolved = nil
+	}
+}
+
+// handleOOM is called when a page fault by t failed for lack of memory. It
+// returns true if the fault should be retried.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (k *Kernel) handleOOM(t *Task) bool {
+	k.emitLifecycleEvent(LifecycleEvent{
+		Type:        OOMFaultEvent,
+		ContainerID: t.ContainerID(),
+		PID:         k.tasks.Root.IDOfThreadGroup(t.tg),
+	})
+
+	k.oom.mu.Lock()
+	k.oom.events++
+	switch k.OOMBehavior() {
+	case OOMKillVictim:
+		k.oom.mu.Unlock()
+		if t.oomKills >= maxOOMKills {
+			t.Warningf("Out of memory after killing %d processes, giving up", t.oomKills)
+			t.oomKills = 0
+			return false
+		}
+		victim := k.oomVictim()
+		if victim == nil {
+			t.Warningf("Out of memory, no process to kill")
+			t.oomKills = 0
+			return false
+		}
+		pid := k.tasks.Root.IDOfThreadGroup(victim)
+		t.Warningf("Out of memory, killing process %d", pid)
+		if err := victim.SendSignal(SignalInfoPriv(linux.SIGKILL)); err != nil {
+			t.Warningf("Failed to kill process on out of memory: %v", err)
+			t.oomKills = 0
+			return false
+		}
+		t.oomKills++
+		k.oom.mu.Lock()
+		k.oom.killed++
+		k.oom.mu.Unlock()
+		if leader := victim.Leader(); leader != nil {
+			k.emitLifecycleEvent(LifecycleEvent{
+				Type:        OOMKilledEvent,
+				ContainerID: leader.ContainerID(),
+				PID:         pid,
+			})
+		}
+		if victim != t.tg {
+			// Wait for the victim to release its memory before retrying,
+			// so that it isn't chosen again. If interrupted, e.g. by a
+			// signal, retrying the fault after handling it is still
+			// correct.
+			e, ch := waiter.NewChannelEntry(waiter.EventHUp)
+			victim.EventRegisterExited(&e)
+			if !victim.Exited() {
+				_ = t.Block(ch)
+			}
+			victim.EventUnregisterExited(&e)
+		}
+		return true
+
+	case OOMPauseAndNotify:
+		if k.oom.resolved == nil {
+			k.oom.resolved = make(chan struct{})
+		}
+		resolved := k.oom.resolved
+		k.oom.paused++
+		k.oom.mu.Unlock()
+
+		t.Warningf("Out of memory, pausing until resolved")
+		// If interrupted, e.g. by a signal, retrying the fault after
+		// handling it is still correct.
+		_ = t.Block(resolved)
+
+		k.oom.mu.Lock()
+		k.oom.paused--
+		k.oom.mu.Unlock()
+		return true
+
+	default:
+		k.oom.mu.Unlock()
+		return false
+	}
+}
+
+// oomCandidate is a process that OOMKillVictim may kill.
+type oomCandidate struct {
+	tg  *ThreadGroup
+	rss uint64
+	adj int32
+}
+
+// oomVictim returns the thread group to kill to free memory, see
+// pickOOMVictim. Thread groups that are already exiting are skipped, since
+// killing them again wouldn't free more memory. It returns nil if there is no
+// candidate.
+func (k *Kernel) oomVictim() *ThreadGroup {
+	mf := k.MemoryFile()
+	_, totalUsage := usage.MemoryAccounting.Copy()
+	totalMem := int64(usage.TotalMemory(mf.TotalSize(), totalUsage))
+
+	var leaders []*Task
+	k.tasks.mu.RLock()
+	for tg := range k.tasks.Root.tgids {
+		if tg.leader == nil {
+			continue
+		}
+		tg.signalHandlers.mu.Lock()
+		exiting := tg.exiting
+		tg.signalHandlers.mu.Unlock()
+		if !exiting {
+			leaders = append(leaders, tg.leader)
+		}
+	}
+	k.tasks.mu.RUnlock()
+
+	cands := make([]oomCandidate, 0, len(leaders))
+	for _, leader := range leaders {
+		c := oomCandidate{
+			tg:  leader.tg,
+			adj: atomic.LoadInt32(&leader.tg.oomScoreAdj),
+		}
+		leader.WithMuLocked(func(t *Task) {
+			if mm := t.MemoryManager(); mm != nil {
+				c.rss = mm.ResidentSetSize()
+			}
+		})
+		cands = append(cands, c)
+	}
+	return pickOOMVictim(cands, totalMem)
+}
+
+// pickOOMVictim returns the thread group of the candidate with the highest OOM
+// score, computed like Linux's oom_badness(): its resident set size adjusted
+// by oom_score_adj, in thousandths of totalMem. Candidates with an
+// oom_score_adj of OOM_SCORE_ADJ_MIN or without resident memory are never
+// chosen. It returns nil if there is no candidate.
+func pickOOMVictim(cands []oomCandidate, totalMem int64) *ThreadGroup {
+	var (
+		victim    *ThreadGroup
+		bestScore int64
+	)
+	for _, c := range cands {
+		if c.adj == oomScoreAdjMin || c.rss == 0 {
+			continue
+		}
+		score := int64(c.rss) + int64(c.adj)*totalMem/1000
+		if victim == nil || score > bestScore {
+			victim, bestScore = c.tg, score
+		}
+	}
+	return victim
+}
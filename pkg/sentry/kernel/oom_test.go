@@ -0,0 +1,165 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"testing"
+)
+
+func TestParseOOMBehavior(t *testing.T) {
+	for _, b := range []OOMBehavior{OOMSegfault, OOMKillVictim, OOMPauseAndNotify} {
+		got, err := ParseOOMBehavior(b.String())
+		if err != nil {
+			t.Errorf("ParseOOMBehavior(%q) failed: %v", b, err)
+		} else if got != b {
+			t.Errorf("ParseOOMBehavior(%q) = %v, want %v", b, got, b)
+		}
+	}
+	if got, err := ParseOOMBehavior("return-enomem"); err != nil || got != OOMSegfault {
+		t.Errorf("ParseOOMBehavior(return-enomem) = %v, %v, want %v", got, err, OOMSegfault)
+	}
+	if _, err := ParseOOMBehavior("invalid"); err == nil {
+		t.Errorf("ParseOOMBehavior(invalid) succeeded, want error")
+	}
+}
+
+// newOOMTestTask returns a task of container cid in a kernel without any
+// other task, along with the lifecycle events emitted by the kernel.
+func newOOMTestTask(cid string) (*Task, *[]LifecycleEvent) {
+	k := &Kernel{}
+	k.tasks = newTaskSet(newPIDNamespace(nil, nil, nil))
+	var events []LifecycleEvent
+	k.SetLifecycleEventHandler(func(ev LifecycleEvent) {
+		events = append(events, ev)
+	})
+	t := &Task{
+		k:           k,
+		tg:          &ThreadGroup{},
+		containerID: cid,
+	}
+	t.logPrefix.Store("")
+	return t, &events
+}
+
+func TestOOMSegfault(t *testing.T) {
+	task, events := newOOMTestTask("cid")
+	k := task.k
+	if got := k.OOMBehavior(); got != OOMSegfault {
+		t.Fatalf("default OOMBehavior() = %v, want %v", got, OOMSegfault)
+	}
+	if k.handleOOM(task) {
+		t.Errorf("handleOOM() = true, want false with %v", OOMSegfault)
+	}
+	want := OOMState{Behavior: OOMSegfault.String(), Events: 1}
+	if got := k.OOMState(); got != want {
+		t.Errorf("OOMState() = %+v, want %+v", got, want)
+	}
+	if len(*events) != 1 || (*events)[0].Type != OOMFaultEvent || (*events)[0].ContainerID != "cid" {
+		t.Errorf("handleOOM() emitted %+v, want a single %v event for container cid", *events, OOMFaultEvent)
+	}
+}
+
+func TestOOMKillVictimGivesUp(t *testing.T) {
+	task, events := newOOMTestTask("cid")
+	k := task.k
+	k.SetOOMBehavior(OOMKillVictim)
+	task.oomKills = maxOOMKills
+	if k.handleOOM(task) {
+		t.Errorf("handleOOM() = true after %d kills, want false", maxOOMKills)
+	}
+	if task.oomKills != 0 {
+		t.Errorf("oomKills = %d after giving up, want 0", task.oomKills)
+	}
+	want := OOMState{Behavior: OOMKillVictim.String(), Events: 1}
+	if got := k.OOMState(); got != want {
+		t.Errorf("OOMState() = %+v, want %+v", got, want)
+	}
+	for _, ev := range *events {
+		if ev.Type == OOMKilledEvent {
+			t.Errorf("handleOOM() killed a process after %d kills: %+v", maxOOMKills, ev)
+		}
+	}
+}
+
+func TestPickOOMVictim(t *testing.T) {
+	const totalMem = 1000 << 20
+	small, big, protected, adjusted := &ThreadGroup{}, &ThreadGroup{}, &ThreadGroup{}, &ThreadGroup{}
+	for _, test := range []struct {
+		name  string
+		cands []oomCandidate
+		want  *ThreadGroup
+	}{
+		{
+			name: "none",
+		},
+		{
+			name: "largest",
+			cands: []oomCandidate{
+				{tg: small, rss: 1 << 20},
+				{tg: big, rss: 100 << 20},
+			},
+			want: big,
+		},
+		{
+			name: "protected",
+			cands: []oomCandidate{
+				{tg: small, rss: 1 << 20},
+				{tg: protected, rss: 100 << 20, adj: oomScoreAdjMin},
+			},
+			want: small,
+		},
+		{
+			name: "no memory",
+			cands: []oomCandidate{
+				{tg: small},
+				{tg: protected, rss: 100 << 20, adj: oomScoreAdjMin},
+			},
+		},
+		{
+			name: "adjusted",
+			cands: []oomCandidate{
+				{tg: big, rss: 100 << 20},
+				// 1MB plus 20% of the total memory.
+				{tg: adjusted, rss: 1 << 20, adj: 200},
+			},
+			want: adjusted,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := pickOOMVictim(test.cands, totalMem); got != test.want {
+				t.Errorf("pickOOMVictim() = %p, want %p", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSetOOMBehaviorResolves(t *testing.T) {
+	k := &Kernel{}
+	resolved := make(chan struct{})
+	k.oom.resolved = resolved
+
+	k.SetOOMBehavior(OOMKillVictim)
+	select {
+	case <-resolved:
+	default:
+		t.Errorf("SetOOMBehavior() didn't wake up paused tasks")
+	}
+	if got := k.OOMBehavior(); got != OOMKillVictim {
+		t.Errorf("OOMBehavior() = %v, want %v", got, OOMKillVictim)
+	}
+
+	// Resolving without paused tasks is a noop.
+	k.ResolveOOM()
+}
@@ -127,6 +127,23 @@ func (p *pendingSignals) dequeueSpecific(sig linux.Signal) *linux.SignalInfo {
 	return ps.SignalInfo
 }
 
+// infos returns copies of all pending signals, ordered by signal number and,
+// for each signal number, in the order they were queued.
+func (p *pendingSignals) infos() []linux.SignalInfo {
+	var infos []linux.SignalInfo
+	linux.ForEachSignal(p.pendingSet, func(sig linux.Signal) {
+		for ps := p.signals[sig.Index()].pendingSignalList.Front(); ps != nil; ps = ps.Next() {
+			infos = append(infos, *ps.SignalInfo)
+		}
+	})
+	return infos
+}
+
+// discardAll causes all pending signals to be discarded.
+func (p *pendingSignals) discardAll() {
+	linux.ForEachSignal(p.pendingSet, p.discardSpecific)
+}
+
 // discardSpecific causes all pending signals with number sig to be discarded.
 func (p *pendingSignals) discardSpecific(sig linux.Signal) {
 	q := &p.signals[sig.Index()]
@@ -0,0 +1,71 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// MaxReadAheadSize is the largest read-ahead window that can be configured
+// for a container.
+const MaxReadAheadSize = 64 << 20 // 64 MB
+
+// readAheadSet holds per-container read-ahead windows.
+//
+// +stateify savable
+type readAheadSet struct {
+	// mu protects sizes.
+	mu sync.RWMutex `state:"nosave"`
+
+	// sizes maps container IDs to their read-ahead window, in bytes.
+	// Containers without an entry use vfs.DefaultReadAheadSize.
+	sizes map[string]uint64
+}
+
+// SetReadAhead sets the maximum number of bytes that filesystems may read
+// ahead when reading files on behalf of the given container. size is rounded
+// up to the page size. A size of 0 restores the default window.
+func (k *Kernel) SetReadAhead(cid string, size uint64) error {
+	if size > MaxReadAheadSize {
+		return fmt.Errorf("read-ahead size %d exceeds the maximum of %d", size, MaxReadAheadSize)
+	}
+	size, _ = hostarch.PageRoundUp(size)
+
+	k.readAhead.mu.Lock()
+	defer k.readAhead.mu.Unlock()
+	if size == 0 {
+		delete(k.readAhead.sizes, cid)
+		return nil
+	}
+	if k.readAhead.sizes == nil {
+		k.readAhead.sizes = make(map[string]uint64)
+	}
+	k.readAhead.sizes[cid] = size
+	return nil
+}
+
+// ReadAhead returns the read-ahead window used for the given container.
+func (k *Kernel) ReadAhead(cid string) uint64 {
+	k.readAhead.mu.RLock()
+	defer k.readAhead.mu.RUnlock()
+	if size, ok := k.readAhead.sizes[cid]; ok {
+		return size
+	}
+	return vfs.DefaultReadAheadSize
+}
@@ -0,0 +1,185 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// MaxSchedLatency is the largest scheduling latency that can be configured
+// for a container, like /proc/sys/kernel/sched_latency_ns.
+const MaxSchedLatency = time.Second
+
+// SchedLatency holds the scheduling latency targets of a container.
+//
+// +stateify savable
+type SchedLatency struct {
+	// Latency is the target period in which every runnable task of the
+	// container should run at least once. It's shared among the running
+	// tasks when they contend for CPUs, see Kernel.preemptTasks.
+	Latency time.Duration
+
+	// Timeslice is the minimum time a task of the container may run before
+	// being preempted, as reported by sched_rr_get_interval(2).
+	Timeslice time.Duration
+}
+
+// DefaultSchedLatency is the scheduling latency reported for containers that
+// haven't configured one. Their tasks are left to the Go runtime scheduler and
+// aren't preempted by Kernel.preemptTasks. The sentry checks for preemption
+// once per clock tick, so this is the shortest possible.
+var DefaultSchedLatency = SchedLatency{
+	Latency:   linux.ClockTick,
+	Timeslice: linux.ClockTick,
+}
+
+// schedLatencySet holds per-container scheduling latency targets.
+//
+// +stateify savable
+type schedLatencySet struct {
+	// mu protects latencies. It's locked after TaskSet.mu by
+	// Kernel.preemptTasks.
+	mu sync.RWMutex `state:"nosave"`
+
+	// latencies maps container IDs to their scheduling latency targets.
+	// Containers without an entry use DefaultSchedLatency.
+	latencies map[string]SchedLatency
+
+	// configured is the number of entries in latencies. It's only written
+	// with mu locked, and is accessed using atomic memory operations so that
+	// Kernel.preemptTasks doesn't take any lock while it's zero.
+	configured int32
+}
+
+// SetSchedLatency sets the scheduling latency targets of the given container.
+// A zero SchedLatency restores the defaults. The sentry can't preempt tasks
+// more often than once per clock tick, so finer-grained targets fail with an
+// error saying so.
+func (k *Kernel) SetSchedLatency(cid string, lat SchedLatency) error {
+	if lat != (SchedLatency{}) {
+		if lat.Timeslice <= 0 || lat.Latency < lat.Timeslice || lat.Latency > MaxSchedLatency {
+			return fmt.Errorf("invalid scheduling latency %+v: the timeslice must be positive and at most the latency, which must be at most %v", lat, MaxSchedLatency)
+		}
+		if lat.Timeslice%linux.ClockTick != 0 || lat.Latency%linux.ClockTick != 0 {
+			return fmt.Errorf("scheduling latency %+v is not supported by the sentry scheduler, values must be multiples of %v", lat, linux.ClockTick)
+		}
+	}
+
+	k.schedLatency.mu.Lock()
+	defer k.schedLatency.mu.Unlock()
+	if lat == (SchedLatency{}) {
+		k.schedLatency.deleteLocked(cid)
+		return nil
+	}
+	if k.schedLatency.latencies == nil {
+		k.schedLatency.latencies = make(map[string]SchedLatency)
+	}
+	k.schedLatency.latencies[cid] = lat
+	atomic.StoreInt32(&k.schedLatency.configured, int32(len(k.schedLatency.latencies)))
+	return nil
+}
+
+// ClearSchedLatency restores the default scheduling latency of the given
+// container. It's called when the container is destroyed, so that a new
+// container reusing its ID doesn't inherit its targets.
+func (k *Kernel) ClearSchedLatency(cid string) {
+	k.schedLatency.mu.Lock()
+	defer k.schedLatency.mu.Unlock()
+	k.schedLatency.deleteLocked(cid)
+}
+
+// deleteLocked removes the scheduling latency targets of the given container.
+//
+// Preconditions: s.mu must be locked.
+func (s *schedLatencySet) deleteLocked(cid string) {
+	delete(s.latencies, cid)
+	atomic.StoreInt32(&s.configured, int32(len(s.latencies)))
+}
+
+// SchedLatency returns the scheduling latency targets of the given container.
+func (k *Kernel) SchedLatency(cid string) SchedLatency {
+	k.schedLatency.mu.RLock()
+	defer k.schedLatency.mu.RUnlock()
+	if lat, ok := k.schedLatency.latencies[cid]; ok {
+		return lat
+	}
+	return DefaultSchedLatency
+}
+
+// timesliceTicks returns the number of clock ticks that a task may run
+// application code while running tasks contend for CPUs. Like Linux's CFS, the
+// latency is shared among the running tasks, but each gets at least the
+// timeslice.
+func (lat SchedLatency) timesliceTicks(running int64) uint64 {
+	slice := lat.Latency / time.Duration(running)
+	if slice < lat.Timeslice {
+		slice = lat.Timeslice
+	}
+	return uint64(slice / linux.ClockTick)
+}
+
+// preemptTasks interrupts the tasks that have run application code for longer
+// than their timeslice at CPU clock now, if more tasks are running than there
+// are CPUs. They then yield their CPU, see Task.preempt. Only tasks of
+// containers with scheduling latency targets set by SetSchedLatency are
+// preempted, and preemptTasks does nothing if no container has any.
+//
+// Preconditions: The caller must be the kernelCPUClockTicker.
+func (k *Kernel) preemptTasks(now uint64) {
+	if atomic.LoadInt32(&k.schedLatency.configured) == 0 {
+		return
+	}
+	running := k.runningTasks.Load()
+	if running <= int64(k.applicationCores) {
+		return
+	}
+	k.tasks.mu.RLock()
+	defer k.tasks.mu.RUnlock()
+	k.schedLatency.mu.RLock()
+	defer k.schedLatency.mu.RUnlock()
+	for t := range k.tasks.Root.tids {
+		lat, ok := k.schedLatency.latencies[t.containerID]
+		if !ok {
+			continue
+		}
+		tsched := t.TaskGoroutineSchedInfo()
+		if tsched.State != TaskGoroutineRunningApp || now-tsched.Timestamp < lat.timesliceTicks(running) {
+			continue
+		}
+		if atomic.CompareAndSwapInt32(&t.preemptPending, 0, 1) {
+			t.p.Interrupt()
+		}
+	}
+}
+
+// preempt yields the CPU if the task goroutine was interrupted by
+// Kernel.preemptTasks, which is counted as an involuntary context switch.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) preempt() {
+	if !atomic.CompareAndSwapInt32(&t.preemptPending, 1, 0) {
+		return
+	}
+	t.involuntarySwitches.Add(1)
+	// As on Linux, preemption aborts restartable sequences.
+	t.rseqPreempted = true
+	runtime.Gosched()
+}
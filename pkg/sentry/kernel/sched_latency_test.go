@@ -0,0 +1,106 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+)
+
+func TestSchedLatency(t *testing.T) {
+	k := &Kernel{}
+	if got := k.SchedLatency("foo"); got != DefaultSchedLatency {
+		t.Fatalf("default SchedLatency() = %+v, want %+v", got, DefaultSchedLatency)
+	}
+
+	want := SchedLatency{Latency: 4 * linux.ClockTick, Timeslice: 2 * linux.ClockTick}
+	if err := k.SetSchedLatency("foo", want); err != nil {
+		t.Fatalf("SetSchedLatency(%+v) failed: %v", want, err)
+	}
+	if got := k.SchedLatency("foo"); got != want {
+		t.Errorf("SchedLatency() = %+v, want %+v", got, want)
+	}
+	if got := k.SchedLatency("bar"); got != DefaultSchedLatency {
+		t.Errorf("SchedLatency() of other container = %+v, want %+v", got, DefaultSchedLatency)
+	}
+
+	for _, lat := range []SchedLatency{
+		{Latency: linux.ClockTick, Timeslice: 2 * linux.ClockTick},
+		{Latency: 2 * MaxSchedLatency, Timeslice: linux.ClockTick},
+		{Latency: linux.ClockTick},
+		{Latency: linux.ClockTick, Timeslice: linux.ClockTick / 2},
+	} {
+		if err := k.SetSchedLatency("foo", lat); err == nil {
+			t.Errorf("SetSchedLatency(%+v) succeeded, want error", lat)
+		}
+	}
+	if got := k.SchedLatency("foo"); got != want {
+		t.Errorf("SchedLatency() after invalid updates = %+v, want %+v", got, want)
+	}
+
+	if err := k.SetSchedLatency("foo", SchedLatency{}); err != nil {
+		t.Fatalf("SetSchedLatency(zero) failed: %v", err)
+	}
+	if got := k.SchedLatency("foo"); got != DefaultSchedLatency {
+		t.Errorf("SchedLatency() after reset = %+v, want %+v", got, DefaultSchedLatency)
+	}
+}
+
+func TestTimesliceTicks(t *testing.T) {
+	lat := SchedLatency{Latency: 8 * linux.ClockTick, Timeslice: 2 * linux.ClockTick}
+	for _, tc := range []struct {
+		lat     SchedLatency
+		running int64
+		want    uint64
+	}{
+		// The latency is shared among running tasks...
+		{lat: lat, running: 2, want: 4},
+		{lat: lat, running: 3, want: 2},
+		// ... but each gets at least the timeslice.
+		{lat: lat, running: 8, want: 2},
+		{lat: DefaultSchedLatency, running: 3, want: 1},
+	} {
+		if got := tc.lat.timesliceTicks(tc.running); got != tc.want {
+			t.Errorf("%+v.timesliceTicks(%d) = %d, want %d", tc.lat, tc.running, got, tc.want)
+		}
+	}
+}
+
+func TestClearSchedLatency(t *testing.T) {
+	k := &Kernel{}
+	lat := SchedLatency{Latency: 8 * linux.ClockTick, Timeslice: 2 * linux.ClockTick}
+	for _, cid := range []string{"foo", "bar"} {
+		if err := k.SetSchedLatency(cid, lat); err != nil {
+			t.Fatalf("SetSchedLatency(%q, %+v) failed: %v", cid, lat, err)
+		}
+	}
+	if got := k.schedLatency.configured; got != 2 {
+		t.Errorf("configured = %d, want 2", got)
+	}
+
+	// A new container reusing the ID gets the defaults.
+	k.ClearSchedLatency("foo")
+	if got := k.SchedLatency("foo"); got != DefaultSchedLatency {
+		t.Errorf("SchedLatency() after ClearSchedLatency() = %+v, want %+v", got, DefaultSchedLatency)
+	}
+	if got := k.SchedLatency("bar"); got != lat {
+		t.Errorf("SchedLatency() of other container = %+v, want %+v", got, lat)
+	}
+	k.ClearSchedLatency("bar")
+	if got := k.schedLatency.configured; got != 0 {
+		t.Errorf("configured after clearing all containers = %d, want 0", got)
+	}
+}
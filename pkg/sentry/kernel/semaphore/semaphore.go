@@ -251,6 +251,34 @@ func (r *Registry) newSetLocked(ctx context.Context, key ipc.Key, creator fs.Fil
 	return set, nil
 }
 
+// SetInfo describes a semaphore set.
+type SetInfo struct {
+	ID  ipc.ID  `json:"id"`
+	Key ipc.Key `json:"key"`
+
+	// Sems is the number of semaphores in the set.
+	Sems int `json:"sems"`
+}
+
+// Sets returns information about all sets in the registry.
+func (r *Registry) Sets() []SetInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var infos []SetInfo
+	r.reg.ForAllObjects(func(o ipc.Mechanism) {
+		s := o.(*Set)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		infos = append(infos, SetInfo{
+			ID:   s.obj.ID,
+			Key:  s.obj.Key,
+			Sems: len(s.sems),
+		})
+	})
+	return infos
+}
+
 // FindByID looks up a set given an ID.
 func (r *Registry) FindByID(id ipc.ID) *Set {
 	r.mu.Lock()
@@ -84,14 +84,47 @@ type Registry struct {
 	// Sum of the sizes of all existing segments rounded up to page size, in
 	// units of page size.
 	totalPages uint64
+
+	// maxSize is the maximum size of a segment in bytes, analogous to
+	// /proc/sys/kernel/shmmax.
+	maxSize uint64
 }
 
 // NewRegistry creates a new shm registry.
 func NewRegistry(userNS *auth.UserNamespace) *Registry {
 	return &Registry{
-		userNS: userNS,
-		reg:    ipc.NewRegistry(userNS),
+		userNS:  userNS,
+		reg:     ipc.NewRegistry(userNS),
+		maxSize: linux.SHMMAX,
+	}
+}
+
+// MaxSegmentSize returns the maximum size of a new segment in bytes.
+func (r *Registry) MaxSegmentSize() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.maxSize
+}
+
+// ValidateMaxSegmentSize returns an error if size isn't a valid maximum
+// segment size for SetMaxSegmentSize.
+func ValidateMaxSegmentSize(size uint64) error {
+	if size < linux.SHMMIN || size > linux.SHMMAX {
+		return linuxerr.EINVAL
+	}
+	return nil
+}
+
+// SetMaxSegmentSize sets the maximum size of a new segment in bytes. Existing
+// segments are unaffected.
+func (r *Registry) SetMaxSegmentSize(size uint64) error {
+	if err := ValidateMaxSegmentSize(size); err != nil {
+		return err
 	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.maxSize = size
+	return nil
 }
 
 // FindByID looks up a segment given an ID.
@@ -114,6 +147,84 @@ func (r *Registry) FindByID(id ipc.ID) *Shm {
 	return nil
 }
 
+// SegmentInfo describes a shared memory segment.
+type SegmentInfo struct {
+	ID  ipc.ID  `json:"id"`
+	Key ipc.Key `json:"key"`
+
+	// Size is the requested size of the segment, in bytes.
+	Size uint64 `json:"size"`
+
+	// Attaches is the number of current attaches, which may overcount
+	// transient references like in shmctl(IPC_STAT).
+	Attaches uint64 `json:"attaches"`
+
+	// CreatorPID is the PID of the process that created the segment.
+	CreatorPID int32 `json:"creatorPID"`
+
+	// PendingDestruction indicates that the segment was removed with
+	// shmctl(IPC_RMID) and will be destroyed once the last attach is gone.
+	PendingDestruction bool `json:"pendingDestruction"`
+}
+
+// Segments returns information about all segments in the registry.
+func (r *Registry) Segments() []SegmentInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var infos []SegmentInfo
+	r.reg.ForAllObjects(func(o ipc.Mechanism) {
+		s := o.(*Shm)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		refs := uint64(s.ReadRefs())
+		if refs == 0 {
+			// Being removed, see Registry.reg.
+			return
+		}
+		// Exclude the self-reference held prior to destruction.
+		if !s.pendingDestruction {
+			refs--
+		}
+		infos = append(infos, SegmentInfo{
+			ID:                 s.obj.ID,
+			Key:                s.obj.Key,
+			Size:               s.size,
+			Attaches:           refs,
+			CreatorPID:         s.creatorPID,
+			PendingDestruction: s.pendingDestruction,
+		})
+	})
+	return infos
+}
+
+// RemoveUnattached marks all segments that aren't attached by any process as
+// destroyed, as if shmctl(IPC_RMID) was called on them. It returns the IDs of
+// the segments removed.
+func (r *Registry) RemoveUnattached(ctx context.Context) []ipc.ID {
+	var unattached []*Shm
+	r.mu.Lock()
+	r.reg.ForAllObjects(func(o ipc.Mechanism) {
+		s := o.(*Shm)
+		s.mu.Lock()
+		// Only the self-reference is held.
+		orphaned := !s.pendingDestruction && s.ReadRefs() == 1
+		s.mu.Unlock()
+		if orphaned && s.TryIncRef() {
+			unattached = append(unattached, s)
+		}
+	})
+	r.mu.Unlock()
+
+	ids := make([]ipc.ID, 0, len(unattached))
+	for _, s := range unattached {
+		ids = append(ids, s.ID())
+		s.MarkDestroyed(ctx)
+		s.DecRef(ctx)
+	}
+	return ids
+}
+
 // dissociateKey removes the association between a segment and its key,
 // preventing it from being discovered in the registry. This doesn't necessarily
 // mean the segment is about to be destroyed. This is analogous to unlinking a
@@ -135,7 +246,10 @@ func (r *Registry) dissociateKey(s *Shm) {
 //
 // FindOrCreate returns a reference on Shm.
 func (r *Registry) FindOrCreate(ctx context.Context, pid int32, key ipc.Key, size uint64, mode linux.FileMode, private, create, exclusive bool) (*Shm, error) {
-	if (create || private) && (size < linux.SHMMIN || size > linux.SHMMAX) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if (create || private) && (size < linux.SHMMIN || size > r.maxSize) {
 		// "A new segment was to be created and size is less than SHMMIN or
 		// greater than SHMMAX." - man shmget(2)
 		//
@@ -144,9 +258,6 @@ func (r *Registry) FindOrCreate(ctx context.Context, pid int32, key ipc.Key, siz
 		return nil, linuxerr.EINVAL
 	}
 
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
 	if r.reg.ObjectCount() >= linux.SHMMNI {
 		// "All possible shared memory IDs have been taken (SHMMNI) ..."
 		//   - man shmget(2)
@@ -235,8 +346,10 @@ func (r *Registry) newShmLocked(ctx context.Context, pid int32, key ipc.Key, cre
 // IPCInfo reports global parameters for sysv shared memory segments on this
 // system. See shmctl(IPC_INFO).
 func (r *Registry) IPCInfo() *linux.ShmParams {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	return &linux.ShmParams{
-		ShmMax: linux.SHMMAX,
+		ShmMax: r.maxSize,
 		ShmMin: linux.SHMMIN,
 		ShmMni: linux.SHMMNI,
 		ShmSeg: linux.SHMSEG,
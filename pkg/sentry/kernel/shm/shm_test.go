@@ -0,0 +1,97 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shm
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/contexttest"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+)
+
+func TestSegmentsAndRemoveUnattached(t *testing.T) {
+	ctx := contexttest.Context(t)
+	r := NewRegistry(auth.NewRootUserNamespace())
+
+	const size = 4096
+	s, err := r.FindOrCreate(ctx, 123 /* pid */, 1234 /* key */, size, 0600, false /* private */, true /* create */, false /* exclusive */)
+	if err != nil {
+		t.Fatalf("FindOrCreate() failed: %v", err)
+	}
+
+	// The reference returned by FindOrCreate counts as an attach.
+	want := SegmentInfo{
+		ID:         s.ID(),
+		Key:        1234,
+		Size:       size,
+		Attaches:   1,
+		CreatorPID: 123,
+	}
+	if got := r.Segments(); len(got) != 1 || got[0] != want {
+		t.Fatalf("Segments() got: %+v, want: [%+v]", got, want)
+	}
+
+	// Attached segments must not be removed.
+	if removed := r.RemoveUnattached(ctx); len(removed) != 0 {
+		t.Errorf("RemoveUnattached() removed attached segments: %v", removed)
+	}
+
+	s.DecRef(ctx)
+	want.Attaches = 0
+	if got := r.Segments(); len(got) != 1 || got[0] != want {
+		t.Fatalf("Segments() got: %+v, want: [%+v]", got, want)
+	}
+
+	if removed := r.RemoveUnattached(ctx); len(removed) != 1 || removed[0] != want.ID {
+		t.Errorf("RemoveUnattached() got: %v, want: [%d]", removed, want.ID)
+	}
+	if got := r.Segments(); len(got) != 0 {
+		t.Errorf("Segments() after removal got: %+v, want: none", got)
+	}
+	if got := r.reg.ObjectCount(); got != 0 {
+		t.Errorf("registry has %d objects, want 0", got)
+	}
+}
+
+func TestMaxSegmentSize(t *testing.T) {
+	ctx := contexttest.Context(t)
+	r := NewRegistry(auth.NewRootUserNamespace())
+
+	const size = 1 << 20
+	if err := r.SetMaxSegmentSize(size / 2); err != nil {
+		t.Fatalf("SetMaxSegmentSize(%d) failed: %v", size/2, err)
+	}
+	if _, err := r.FindOrCreate(ctx, 123 /* pid */, 0 /* key */, size, 0600, true /* private */, true /* create */, false /* exclusive */); !linuxerr.Equals(linuxerr.EINVAL, err) {
+		t.Fatalf("FindOrCreate() above shmmax got error: %v, want: %v", err, linuxerr.EINVAL)
+	}
+
+	// Raising the limit allows the larger segment to be created.
+	if err := r.SetMaxSegmentSize(size); err != nil {
+		t.Fatalf("SetMaxSegmentSize(%d) failed: %v", size, err)
+	}
+	s, err := r.FindOrCreate(ctx, 123 /* pid */, 0 /* key */, size, 0600, true /* private */, true /* create */, false /* exclusive */)
+	if err != nil {
+		t.Fatalf("FindOrCreate() after raising shmmax failed: %v", err)
+	}
+	s.DecRef(ctx)
+	if got := r.IPCInfo().ShmMax; got != size {
+		t.Errorf("IPCInfo().ShmMax got: %d, want: %d", got, size)
+	}
+
+	if err := r.SetMaxSegmentSize(0); !linuxerr.Equals(linuxerr.EINVAL, err) {
+		t.Errorf("SetMaxSegmentSize(0) got error: %v, want: %v", err, linuxerr.EINVAL)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// signalInterceptor holds the signal intercepted by InterceptInitSignal.
+type signalInterceptor struct {
+	mu sync.Mutex
+
+	// sig is the intercepted signal, or 0 if no signal is intercepted.
+	sig linux.Signal
+
+	// fn is called when sig is intercepted.
+	fn func()
+}
+
+// InterceptInitSignal causes sig to be intercepted when it's sent to the
+// global init process: rather than being delivered, and regardless of the
+// process' signal mask and handlers, sig is discarded and fn is called in a
+// new goroutine. Signals that init sends to itself are intercepted as well.
+// A sig of 0 stops intercepting.
+//
+// SIGKILL and SIGSTOP can't be intercepted.
+func (k *Kernel) InterceptInitSignal(sig linux.Signal, fn func()) {
+	if sig == linux.SIGKILL || sig == linux.SIGSTOP {
+		panic("SIGKILL and SIGSTOP can't be intercepted")
+	}
+	k.initSignal.mu.Lock()
+	defer k.initSignal.mu.Unlock()
+	k.initSignal.sig = sig
+	k.initSignal.fn = fn
+}
+
+// interceptSignalLocked returns true if sig, which is being sent to t, is
+// intercepted by InterceptInitSignal and must not be delivered.
+//
+// Preconditions: The signal mutex must be locked.
+func (t *Task) interceptSignalLocked(sig linux.Signal) bool {
+	if t.tg != t.k.globalInit {
+		return false
+	}
+	is := &t.k.initSignal
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	if is.sig == 0 || is.sig != sig {
+		return false
+	}
+	t.Infof("Intercepted signal %d sent to init", sig)
+	go is.fn() // S/R-SAFE: External control flow.
+	return true
+}
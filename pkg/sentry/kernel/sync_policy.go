@@ -0,0 +1,66 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// syncPolicySet holds per-container sync policies.
+//
+// +stateify savable
+type syncPolicySet struct {
+	// mu protects policies.
+	mu sync.RWMutex `state:"nosave"`
+
+	// policies maps container IDs to their sync policy. Containers without an
+	// entry use vfs.SyncDurable.
+	policies map[string]vfs.SyncPolicy
+}
+
+// SetSyncPolicy sets how fsync(2) and fdatasync(2) issued by the given
+// container are propagated to the host, see vfs.SyncPolicy.
+func (k *Kernel) SetSyncPolicy(cid string, p vfs.SyncPolicy) {
+	k.syncPolicies.mu.Lock()
+	defer k.syncPolicies.mu.Unlock()
+	if p == vfs.SyncDurable {
+		delete(k.syncPolicies.policies, cid)
+		return
+	}
+	if k.syncPolicies.policies == nil {
+		k.syncPolicies.policies = make(map[string]vfs.SyncPolicy)
+	}
+	k.syncPolicies.policies[cid] = p
+}
+
+// ClearSyncPolicy restores the default sync policy, vfs.SyncDurable, of the
+// given container. It's called when the container is destroyed, so that a new
+// container reusing its ID doesn't inherit a relaxed policy.
+func (k *Kernel) ClearSyncPolicy(cid string) {
+	k.syncPolicies.mu.Lock()
+	defer k.syncPolicies.mu.Unlock()
+	delete(k.syncPolicies.policies, cid)
+}
+
+// SyncPolicy returns the sync policy used for the given container.
+func (k *Kernel) SyncPolicy(cid string) vfs.SyncPolicy {
+	k.syncPolicies.mu.RLock()
+	defer k.syncPolicies.mu.RUnlock()
+	if p, ok := k.syncPolicies.policies[cid]; ok {
+		return p
+	}
+	return vfs.SyncDurable
+}
@@ -0,0 +1,36 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+func TestClearSyncPolicy(t *testing.T) {
+	k := &Kernel{}
+	k.SetSyncPolicy("foo", vfs.SyncNone)
+	k.SetSyncPolicy("bar", vfs.SyncRelaxed)
+
+	// A new container reusing the ID gets the durable default.
+	k.ClearSyncPolicy("foo")
+	if got := k.SyncPolicy("foo"); got != vfs.SyncDurable {
+		t.Errorf("SyncPolicy() after ClearSyncPolicy() = %v, want %v", got, vfs.SyncDurable)
+	}
+	if got := k.SyncPolicy("bar"); got != vfs.SyncRelaxed {
+		t.Errorf("SyncPolicy() of other container = %v, want %v", got, vfs.SyncRelaxed)
+	}
+}
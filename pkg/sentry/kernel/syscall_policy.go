@@ -0,0 +1,224 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+
+	"gvisor.dev/gvisor/pkg/abi"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/sentry/arch"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// SyscallPolicy is a declarative list of syscalls that a container may or may
+// not invoke. It's enforced when syscalls are dispatched, in addition to any
+// seccomp filters installed by the application.
+type SyscallPolicy struct {
+	// Allow indicates that Syscalls is an allow list: syscalls not listed
+	// fail with ENOSYS. Otherwise, Syscalls is a deny list: syscalls listed
+	// fail with EPERM.
+	Allow bool
+
+	// Syscalls contains syscall names, e.g. "mkdir".
+	Syscalls []string
+}
+
+// syscallFilter is a SyscallPolicy resolved to syscall numbers.
+//
+// +stateify savable
+type syscallFilter struct {
+	allow  bool
+	sysnos map[uintptr]struct{}
+}
+
+// check returns the error that syscall sysno fails with, or nil if it's
+// permitted.
+func (f *syscallFilter) check(sysno uintptr) error {
+	_, listed := f.sysnos[sysno]
+	if f.allow && !listed {
+		return linuxerr.ENOSYS
+	}
+	if !f.allow && listed {
+		return linuxerr.EPERM
+	}
+	return nil
+}
+
+// tighten returns a filter that only permits syscalls permitted by both f and
+// other.
+func (f *syscallFilter) tighten(other *syscallFilter) *syscallFilter {
+	res := &syscallFilter{
+		allow:  f.allow || other.allow,
+		sysnos: make(map[uintptr]struct{}),
+	}
+	switch {
+	case f.allow && other.allow:
+		// Intersection of both allow lists.
+		for sysno := range f.sysnos {
+			if _, ok := other.sysnos[sysno]; ok {
+				res.sysnos[sysno] = struct{}{}
+			}
+		}
+	case !f.allow && !other.allow:
+		// Union of both deny lists.
+		for sysno := range f.sysnos {
+			res.sysnos[sysno] = struct{}{}
+		}
+		for sysno := range other.sysnos {
+			res.sysnos[sysno] = struct{}{}
+		}
+	default:
+		// Allow list minus deny list.
+		allow, deny := f, other
+		if other.allow {
+			allow, deny = other, f
+		}
+		for sysno := range allow.sysnos {
+			if _, ok := deny.sysnos[sysno]; !ok {
+				res.sysnos[sysno] = struct{}{}
+			}
+		}
+	}
+	return res
+}
+
+// syscallPolicySet holds per-container syscall policies.
+//
+// +stateify savable
+type syscallPolicySet struct {
+	// count is the number of entries in filters. It is accessed using atomic
+	// memory operations so that the common case, where no policy is set, costs
+	// a single load on the syscall path.
+	count int32
+
+	// mu protects filters.
+	mu sync.RWMutex `state:"nosave"`
+
+	// filters maps container IDs to their syscall filter.
+	filters map[string]*syscallFilter
+}
+
+// newSyscallFilter resolves the syscall names in policy against the host
+// syscall table.
+func newSyscallFilter(policy SyscallPolicy) (*syscallFilter, error) {
+	table, ok := LookupSyscallTable(abi.Linux, arch.Host)
+	if !ok {
+		return nil, fmt.Errorf("no syscall table for %v", arch.Host)
+	}
+	f := &syscallFilter{
+		allow:  policy.Allow,
+		sysnos: make(map[uintptr]struct{}, len(policy.Syscalls)),
+	}
+	for _, name := range policy.Syscalls {
+		sysno, err := table.LookupNo(name)
+		if err != nil {
+			return nil, err
+		}
+		f.sysnos[sysno] = struct{}{}
+	}
+	return f, nil
+}
+
+// SetSyscallPolicy sets the syscall policy of the given container, replacing
+// any previous one. It's meant to be called before the container starts, use
+// TightenSyscallPolicy to restrict a running container further.
+func (k *Kernel) SetSyscallPolicy(cid string, policy SyscallPolicy) error {
+	f, err := newSyscallFilter(policy)
+	if err != nil {
+		return err
+	}
+
+	k.syscallPolicies.mu.Lock()
+	defer k.syscallPolicies.mu.Unlock()
+	k.setSyscallFilterLocked(cid, f)
+	return nil
+}
+
+// TightenSyscallPolicy restricts the syscall policy of the given container, so
+// that only syscalls permitted by both the current policy and the given one
+// are permitted. Syscalls can never be re-enabled this way.
+func (k *Kernel) TightenSyscallPolicy(cid string, policy SyscallPolicy) error {
+	f, err := newSyscallFilter(policy)
+	if err != nil {
+		return err
+	}
+
+	k.syscallPolicies.mu.Lock()
+	defer k.syscallPolicies.mu.Unlock()
+	if cur := k.syscallPolicies.filters[cid]; cur != nil {
+		f = cur.tighten(f)
+	}
+	k.setSyscallFilterLocked(cid, f)
+	return nil
+}
+
+// Preconditions: k.syscallPolicies.mu must be locked.
+func (k *Kernel) setSyscallFilterLocked(cid string, f *syscallFilter) {
+	if k.syscallPolicies.filters == nil {
+		k.syscallPolicies.filters = make(map[string]*syscallFilter)
+	}
+	k.syscallPolicies.filters[cid] = f
+	atomic.StoreInt32(&k.syscallPolicies.count, int32(len(k.syscallPolicies.filters)))
+}
+
+// ClearSyscallPolicy removes the syscall policy of the given container.
+func (k *Kernel) ClearSyscallPolicy(cid string) {
+	k.syscallPolicies.mu.Lock()
+	defer k.syscallPolicies.mu.Unlock()
+	delete(k.syscallPolicies.filters, cid)
+	atomic.StoreInt32(&k.syscallPolicies.count, int32(len(k.syscallPolicies.filters)))
+}
+
+// SyscallPolicy returns the syscall policy of the given container. It returns
+// false if the container doesn't have one.
+func (k *Kernel) SyscallPolicy(cid string) (SyscallPolicy, bool) {
+	k.syscallPolicies.mu.RLock()
+	f := k.syscallPolicies.filters[cid]
+	k.syscallPolicies.mu.RUnlock()
+	if f == nil {
+		return SyscallPolicy{}, false
+	}
+
+	table, ok := LookupSyscallTable(abi.Linux, arch.Host)
+	if !ok {
+		return SyscallPolicy{}, false
+	}
+	policy := SyscallPolicy{Allow: f.allow}
+	for sysno := range f.sysnos {
+		policy.Syscalls = append(policy.Syscalls, table.LookupName(sysno))
+	}
+	sort.Strings(policy.Syscalls)
+	return policy, true
+}
+
+// checkSyscallPolicy returns the error that syscall sysno invoked by a task in
+// container cid fails with, or nil if the container's policy permits it.
+//
+// The syscall path is very hot; avoid defer.
+func (k *Kernel) checkSyscallPolicy(cid string, sysno uintptr) error {
+	if atomic.LoadInt32(&k.syscallPolicies.count) == 0 {
+		return nil
+	}
+	k.syscallPolicies.mu.RLock()
+	f := k.syscallPolicies.filters[cid]
+	k.syscallPolicies.mu.RUnlock()
+	if f == nil {
+		return nil
+	}
+	return f.check(sysno)
+}
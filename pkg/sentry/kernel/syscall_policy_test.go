@@ -0,0 +1,118 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+)
+
+func newTestSyscallFilter(allow bool, sysnos ...uintptr) *syscallFilter {
+	f := &syscallFilter{
+		allow:  allow,
+		sysnos: make(map[uintptr]struct{}),
+	}
+	for _, sysno := range sysnos {
+		f.sysnos[sysno] = struct{}{}
+	}
+	return f
+}
+
+func TestSyscallPolicyCheck(t *testing.T) {
+	k := &Kernel{}
+	if err := k.checkSyscallPolicy("foo", 1); err != nil {
+		t.Errorf("checkSyscallPolicy() without policy = %v, want nil", err)
+	}
+
+	k.syscallPolicies.mu.Lock()
+	k.setSyscallFilterLocked("allow", newTestSyscallFilter(true, 1, 2))
+	k.setSyscallFilterLocked("deny", newTestSyscallFilter(false, 1, 2))
+	k.syscallPolicies.mu.Unlock()
+
+	for _, tc := range []struct {
+		cid   string
+		sysno uintptr
+		want  error
+	}{
+		{cid: "allow", sysno: 1, want: nil},
+		{cid: "allow", sysno: 3, want: linuxerr.ENOSYS},
+		{cid: "deny", sysno: 1, want: linuxerr.EPERM},
+		{cid: "deny", sysno: 3, want: nil},
+		{cid: "other", sysno: 1, want: nil},
+	} {
+		if got := k.checkSyscallPolicy(tc.cid, tc.sysno); got != tc.want {
+			t.Errorf("checkSyscallPolicy(%q, %d) = %v, want %v", tc.cid, tc.sysno, got, tc.want)
+		}
+	}
+
+	k.ClearSyscallPolicy("deny")
+	if err := k.checkSyscallPolicy("deny", 1); err != nil {
+		t.Errorf("checkSyscallPolicy() after ClearSyscallPolicy = %v, want nil", err)
+	}
+}
+
+func TestSyscallFilterTighten(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		cur       *syscallFilter
+		other     *syscallFilter
+		permitted []uintptr
+		denied    []uintptr
+	}{
+		{
+			name:      "allow and allow",
+			cur:       newTestSyscallFilter(true, 1, 2, 3),
+			other:     newTestSyscallFilter(true, 2, 3, 4),
+			permitted: []uintptr{2, 3},
+			denied:    []uintptr{1, 4, 5},
+		},
+		{
+			name:      "deny and deny",
+			cur:       newTestSyscallFilter(false, 1),
+			other:     newTestSyscallFilter(false, 2),
+			permitted: []uintptr{3},
+			denied:    []uintptr{1, 2},
+		},
+		{
+			name:      "allow and deny",
+			cur:       newTestSyscallFilter(true, 1, 2),
+			other:     newTestSyscallFilter(false, 2, 3),
+			permitted: []uintptr{1},
+			denied:    []uintptr{2, 3, 4},
+		},
+		{
+			name:      "deny and allow",
+			cur:       newTestSyscallFilter(false, 2, 3),
+			other:     newTestSyscallFilter(true, 1, 2),
+			permitted: []uintptr{1},
+			denied:    []uintptr{2, 3, 4},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := tc.cur.tighten(tc.other)
+			for _, sysno := range tc.permitted {
+				if err := f.check(sysno); err != nil {
+					t.Errorf("check(%d) = %v, want nil", sysno, err)
+				}
+			}
+			for _, sysno := range tc.denied {
+				if err := f.check(sysno); err == nil {
+					t.Errorf("check(%d) = nil, want error", sysno)
+				}
+			}
+		})
+	}
+}
@@ -114,6 +114,19 @@ type Task struct {
 	// owned by the task goroutine.
 	yieldCount atomicbitops.Uint64
 
+	// involuntarySwitches is the number of times the task goroutine was
+	// preempted by Kernel.preemptTasks.
+	//
+	// involuntarySwitches is accessed using atomic memory operations.
+	// involuntarySwitches is owned by the task goroutine.
+	involuntarySwitches atomicbitops.Uint64
+
+	// preemptPending is 1 if Kernel.preemptTasks interrupted the task
+	// goroutine, which hasn't yielded yet.
+	//
+	// preemptPending is accessed using atomic memory operations.
+	preemptPending int32 `state:"nosave"`
+
 	// pendingSignals is the set of pending signals that may be handled only by
 	// this task.
 	//
@@ -322,6 +335,13 @@ type Task struct {
 	// exited.
 	goroutineStopped sync.WaitGroup `state:"nosave"`
 
+	// goroutineRunning is 1 when the task goroutine is running and 0 when
+	// the task goroutine is stopped or has exited, like the counter of
+	// goroutineStopped, but it can be read without blocking.
+	// TaskSet.goroutineStoppedQueue is notified when it becomes 0.
+	// goroutineRunning is accessed using atomic memory operations.
+	goroutineRunning int32 `state:"nosave"`
+
 	// ptraceTracer is the task that is ptrace-attached to this one. If
 	// ptraceTracer is nil, this task is not being traced. Note that due to
 	// atomic.Value limitations (atomic.Value.Store(nil) panics), a nil
@@ -598,6 +618,29 @@ type Task struct {
 	// The userCounters pointer is exclusive to the task goroutine, but the
 	// userCounters instance must be atomically accessed.
 	userCounters *userCounters
+
+	// oomKills is the number of processes killed by OOMKillVictim since the
+	// last page fault of the task that didn't run out of memory.
+	//
+	// oomKills is exclusive to the task goroutine.
+	oomKills int
+
+	// majorFault is set by memmap.NoteMajorFault while the task handles a page
+	// fault, see mm.MemoryManager.HandleUserFault.
+	//
+	// majorFault is exclusive to the task goroutine.
+	majorFault bool
+
+	// noNewPrivs is the no_new_privs bit of the task, see
+	// prctl(PR_SET_NO_NEW_PRIVS). It's inherited by clone and can't be
+	// cleared once set.
+	//
+	// noNewPrivs is protected by mu.
+	noNewPrivs bool
+
+	// futexStats are the task's futex wait statistics, see
+	// Kernel.EnableFutexStats.
+	futexStats taskFutexStats `state:"nosave"`
 }
 
 func (t *Task) savePtraceTracer() *Task {
@@ -210,6 +210,7 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 		RSeqSignature:           rseqSignature,
 		ContainerID:             t.ContainerID(),
 		UserCounters:            uc,
+		NoNewPrivs:              t.NoNewPrivs(),
 	}
 	if args.Flags&linux.CLONE_THREAD == 0 {
 		cfg.Parent = t
@@ -26,6 +26,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/kernel/ipc"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
 	"gvisor.dev/gvisor/pkg/sentry/limits"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
 	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
 	"gvisor.dev/gvisor/pkg/sentry/unimpl"
@@ -107,6 +108,10 @@ func (t *Task) contextValue(key interface{}, isTaskGoroutine bool) interface{} {
 		}
 		t.mountNamespaceVFS2.IncRef()
 		return t.mountNamespaceVFS2
+	case vfs.CtxReadAheadSize:
+		return t.k.ReadAhead(t.containerID)
+	case vfs.CtxSyncPolicy:
+		return t.k.SyncPolicy(t.containerID)
 	case fs.CtxDirentCacheLimiter:
 		return t.k.DirentCacheLimiter
 	case inet.CtxStack:
@@ -119,6 +124,11 @@ func (t *Task) contextValue(key interface{}, isTaskGoroutine bool) interface{} {
 		return func(sig linux.Signal) error {
 			return t.SendSignal(SignalInfoNoInfo(sig, t, t))
 		}
+	case memmap.CtxMajorFault:
+		if !isTaskGoroutine {
+			return nil
+		}
+		return &t.majorFault
 	case pgalloc.CtxMemoryFile:
 		return t.k.mf
 	case pgalloc.CtxMemoryFileProvider:
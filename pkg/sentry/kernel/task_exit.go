@@ -131,6 +131,11 @@ func (t *Task) PrepareExit(ws linux.WaitStatus) {
 func (t *Task) PrepareGroupExit(ws linux.WaitStatus) {
 	t.tg.signalHandlers.mu.Lock()
 	defer t.tg.signalHandlers.mu.Unlock()
+	t.prepareGroupExitLocked(ws)
+}
+
+// Preconditions: The signal mutex must be locked.
+func (t *Task) prepareGroupExitLocked(ws linux.WaitStatus) {
 	if t.tg.exiting || t.tg.execing != nil {
 		// Note that if t.tg.exiting is false but t.tg.execing is not nil, i.e.
 		// this "group exit" is being executed by the killed sibling of an
@@ -527,6 +532,20 @@ func (*runExitNotify) execute(t *Task) taskRunState {
 	defer t.tg.pidns.owner.mu.Unlock()
 	t.advanceExitStateLocked(TaskExitInitiated, TaskExitZombie)
 	t.tg.liveTasks--
+	if t.tg.liveTasks == 0 {
+		t.tg.signalHandlers.mu.Lock()
+		ws := t.tg.leader.exitStatus
+		if t.tg.exiting {
+			ws = t.tg.exitStatus
+		}
+		t.tg.signalHandlers.mu.Unlock()
+		t.k.emitLifecycleEvent(LifecycleEvent{
+			Type:        ProcessExitedEvent,
+			ContainerID: t.ContainerID(),
+			PID:         t.k.tasks.Root.tgids[t.tg],
+			ExitStatus:  ws,
+		})
+	}
 	// Check if this completes a sibling's execve.
 	if t.tg.execing != nil && t.tg.liveTasks == 1 {
 		// execing blocks the addition of new tasks to the thread group, so
@@ -538,6 +557,17 @@ func (*runExitNotify) execute(t *Task) taskRunState {
 		}
 		e.tg.signalHandlers.mu.Unlock()
 	}
+	// Check if this allows a sibling to dump core.
+	if t.tg.coreDumping != nil && t.tg.liveTasks == 1 {
+		// The exiting thread group doesn't get new tasks, so the sole living
+		// task must be the one dumping core.
+		d := t.tg.coreDumping
+		d.tg.signalHandlers.mu.Lock()
+		if _, ok := d.stop.(*coreDumpStop); ok {
+			d.endInternalStopLocked()
+		}
+		d.tg.signalHandlers.mu.Unlock()
+	}
 	t.exitNotifyLocked(false)
 	// The task goroutine will now exit.
 	return nil
@@ -658,6 +688,7 @@ func (t *Task) exitNotifyLocked(fromPtraceDetach bool) {
 		t.userCounters.decRLimitNProc()
 		t.tg.exitedCPUStats.Accumulate(t.CPUStats())
 		t.tg.ioUsage.Accumulate(t.ioUsage)
+		t.k.accumulateFutexStatsLocked(t)
 		t.tg.signalHandlers.mu.Lock()
 		t.tg.tasks.Remove(t)
 		t.tg.tasksCount--
@@ -455,6 +455,23 @@ func (t *Task) SetKeepCaps(k bool) {
 	t.creds.Store(creds)
 }
 
+// NoNewPrivs returns the no_new_privs bit of t, as returned by
+// prctl(PR_GET_NO_NEW_PRIVS). Execve behaves as if it's always set, see
+// updateCredsForExecLocked, but it's only reported once set.
+func (t *Task) NoNewPrivs() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.noNewPrivs
+}
+
+// SetNoNewPrivs sets the no_new_privs bit of t, as
+// prctl(PR_SET_NO_NEW_PRIVS) does. It can't be cleared.
+func (t *Task) SetNoNewPrivs() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.noNewPrivs = true
+}
+
 // updateCredsForExecLocked updates t.creds to reflect an execve().
 //
 // NOTE(b/30815691): We currently do not implement privileged executables
@@ -28,6 +28,7 @@ import (
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
 	"gvisor.dev/gvisor/pkg/sentry/memmap"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
+	"gvisor.dev/gvisor/pkg/waiter"
 )
 
 // A taskRunState is a reified state in the task state machine. See README.md
@@ -96,7 +97,11 @@ func (t *Task) run(threadID uintptr) {
 		if t.runState == nil {
 			t.accountTaskGoroutineEnter(TaskGoroutineNonexistent)
 			t.goroutineStopped.Done()
+			t.setGoroutineStopped()
 			t.tg.liveGoroutines.Done()
+			if atomic.AddInt32(&t.tg.liveGoroutineCount, -1) == 0 {
+				t.tg.exitedQueue.Notify(waiter.EventHUp)
+			}
 			t.tg.pidns.owner.liveGoroutines.Done()
 			t.tg.pidns.owner.runningGoroutines.Done()
 			t.p.Release()
@@ -128,6 +133,8 @@ func (t *Task) doStop() {
 	defer t.tg.pidns.owner.runningGoroutines.Add(1)
 	t.goroutineStopped.Add(-1)
 	defer t.goroutineStopped.Add(1)
+	t.setGoroutineStopped()
+	defer atomic.StoreInt32(&t.goroutineRunning, 1)
 	for t.stopCount > 0 {
 		t.endStopCond.Wait()
 	}
@@ -256,6 +263,7 @@ func (app *runApp) execute(t *Task) taskRunState {
 	case platform.ErrContextInterrupt:
 		// Interrupted by platform.Context.Interrupt(). Re-enter the run
 		// loop to figure out why.
+		t.preempt()
 		return (*runApp)(nil)
 
 	case platform.ErrContextSignal:
@@ -275,6 +283,12 @@ func (app *runApp) execute(t *Task) taskRunState {
 			if err == nil {
 				// The fault was handled appropriately.
 				// We can resume running the application.
+				t.oomKills = 0
+				return (*runApp)(nil)
+			}
+
+			// Did we run out of memory?
+			if linuxerr.Equals(linuxerr.ENOMEM, err) && t.k.handleOOM(t) {
 				return (*runApp)(nil)
 			}
 
@@ -357,6 +371,18 @@ func (t *Task) GoroutineID() int64 {
 	return t.goid.Load()
 }
 
+// setGoroutineStopped records that t's task goroutine stopped or exited.
+func (t *Task) setGoroutineStopped() {
+	atomic.StoreInt32(&t.goroutineRunning, 0)
+	t.tg.pidns.owner.goroutineStoppedQueue.Notify(waiter.EventIn)
+}
+
+// goroutineStoppedOrExited returns true if t's task goroutine is stopped or
+// has exited.
+func (t *Task) goroutineStoppedOrExited() bool {
+	return atomic.LoadInt32(&t.goroutineRunning) == 0
+}
+
 // waitGoroutineStoppedOrExited blocks until t's task goroutine stops or exits.
 func (t *Task) waitGoroutineStoppedOrExited() {
 	t.goroutineStopped.Wait()
@@ -371,6 +397,33 @@ func (tg *ThreadGroup) WaitExited() {
 	tg.liveGoroutines.Wait()
 }
 
+// Exited returns true if all tasks in tg have exited, i.e. its leader is a
+// zombie or has been reaped and no other task is left, and all of their task
+// goroutines have exited. Unlike WaitExited, it doesn't block, and it returns
+// false for a thread group that hasn't started yet.
+func (tg *ThreadGroup) Exited() bool {
+	if atomic.LoadInt32(&tg.liveGoroutineCount) != 0 {
+		return false
+	}
+	tg.pidns.owner.mu.RLock()
+	defer tg.pidns.owner.mu.RUnlock()
+	return tg.leader.exitState >= TaskExitZombie && tg.tasksCount <= 1
+}
+
+// EventRegisterExited registers e to be notified with waiter.EventHUp when all
+// task goroutines in tg have exited. Unlike WaitExited, this allows waiting
+// for tg to exit to be canceled. e isn't notified if tg had already exited, so
+// callers must check Exited after registering e.
+func (tg *ThreadGroup) EventRegisterExited(e *waiter.Entry) {
+	tg.exitedQueue.EventRegister(e)
+}
+
+// EventUnregisterExited unregisters an entry registered with
+// EventRegisterExited.
+func (tg *ThreadGroup) EventUnregisterExited(e *waiter.Entry) {
+	tg.exitedQueue.EventUnregister(e)
+}
+
 // Yield yields the processor for the calling task.
 func (t *Task) Yield() {
 	t.yieldCount.Add(1)
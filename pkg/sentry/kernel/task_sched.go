@@ -28,6 +28,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/kernel/sched"
 	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
 	"gvisor.dev/gvisor/pkg/sentry/limits"
+	"gvisor.dev/gvisor/pkg/sentry/platform"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
 )
 
@@ -180,13 +181,24 @@ func (t *Task) CPUStats() usage.CPUStats {
 	return t.cpuStatsAt(t.k.CPUClockNow())
 }
 
+// PerfCounters returns the hardware events counted while t ran application
+// code. It returns false if the platform doesn't count them.
+func (t *Task) PerfCounters() (platform.PerfCounters, bool) {
+	pc, ok := t.p.(platform.PerfCounterContext)
+	if !ok {
+		return platform.PerfCounters{}, false
+	}
+	return pc.PerfCounters(), true
+}
+
 // Preconditions: As for TaskGoroutineSchedInfo.userTicksAt.
 func (t *Task) cpuStatsAt(now uint64) usage.CPUStats {
 	tsched := t.TaskGoroutineSchedInfo()
 	return usage.CPUStats{
-		UserTime:          time.Duration(tsched.userTicksAt(now) * uint64(linux.ClockTick)),
-		SysTime:           time.Duration(tsched.sysTicksAt(now) * uint64(linux.ClockTick)),
-		VoluntarySwitches: t.yieldCount.Load(),
+		UserTime:            time.Duration(tsched.userTicksAt(now) * uint64(linux.ClockTick)),
+		SysTime:             time.Duration(tsched.sysTicksAt(now) * uint64(linux.ClockTick)),
+		VoluntarySwitches:   t.yieldCount.Load(),
+		InvoluntarySwitches: t.involuntarySwitches.Load(),
 	}
 }
 
@@ -362,6 +374,9 @@ func (ticker *kernelCPUClockTicker) NotifyTimer(exp uint64, setting ktime.Settin
 	// discontinuous jumps.
 	now := ticker.k.cpuClock.Add(1)
 
+	// Preempt tasks whose timeslice is over while others wait for a CPU.
+	ticker.k.preemptTasks(now)
+
 	// Check thread group CPU timers.
 	tgs := ticker.k.tasks.Root.ThreadGroupsAppend(ticker.tgs)
 	for _, tg := range tgs {
@@ -116,6 +116,12 @@ func computeAction(sig linux.Signal, act linux.SigAction) SignalAction {
 	}
 }
 
+// DefaultSignalAction returns the action taken for sig when its handler is
+// SIG_DFL.
+func DefaultSignalAction(sig linux.Signal) SignalAction {
+	return computeAction(sig, linux.SigAction{Handler: linux.SIG_DFL})
+}
+
 // UnblockableSignals contains the set of signals which cannot be blocked.
 var UnblockableSignals = linux.MakeSignalSet(linux.SIGKILL, linux.SIGSTOP)
 
@@ -153,10 +159,65 @@ func (t *Task) PendingSignals() linux.SignalSet {
 	return t.pendingSignals.pendingSet | t.tg.pendingSignals.pendingSet
 }
 
+// PendingSignal describes a signal that is queued but not yet delivered.
+type PendingSignal struct {
+	// Signo is the signal number.
+	Signo int32
+
+	// Code is the signal code (si_code).
+	Code int32
+
+	// PID and UID identify the sender, for signals sent by a process.
+	PID int32
+	UID int32
+
+	// TID is the thread ID, in the thread group's PID namespace, of the task
+	// the signal is queued on, or 0 if it is queued on the thread group.
+	TID ThreadID
+}
+
+// PendingSignalsInfo returns the signals that are queued on tg and its tasks.
+// If flush is true, the signals are discarded without being delivered.
+func (tg *ThreadGroup) PendingSignalsInfo(flush bool) []PendingSignal {
+	tg.pidns.owner.mu.RLock()
+	defer tg.pidns.owner.mu.RUnlock()
+	tg.signalHandlers.mu.Lock()
+	defer tg.signalHandlers.mu.Unlock()
+
+	var pending []PendingSignal
+	add := func(p *pendingSignals, tid ThreadID) {
+		for _, info := range p.infos() {
+			pending = append(pending, PendingSignal{
+				Signo: info.Signo,
+				Code:  info.Code,
+				PID:   info.PID(),
+				UID:   info.UID(),
+				TID:   tid,
+			})
+		}
+		if flush {
+			p.discardAll()
+		}
+	}
+	add(&tg.pendingSignals, 0)
+	for t := tg.tasks.Front(); t != nil; t = t.Next() {
+		add(&t.pendingSignals, tg.pidns.tids[t])
+	}
+	return pending
+}
+
 // deliverSignal delivers the given signal and returns the following run state.
 func (t *Task) deliverSignal(info *linux.SignalInfo, act linux.SigAction) taskRunState {
 	sig := linux.Signal(info.Signo)
 	sigact := computeAction(sig, act)
+	if t.k.lifecycleEventsEnabled() {
+		t.k.emitLifecycleEvent(LifecycleEvent{
+			Type:        SignalDeliveredEvent,
+			ContainerID: t.ContainerID(),
+			PID:         t.k.tasks.Root.IDOfThreadGroup(t.tg),
+			Signal:      sig,
+		})
+	}
 
 	if t.haveSyscallReturn {
 		if sre, ok := linuxerr.SyscallRestartErrorFromReturn(t.Arch().Return()); ok {
@@ -204,6 +265,11 @@ func (t *Task) deliverSignal(info *linux.SignalInfo, act linux.SigAction) taskRu
 
 		eventchannel.Emit(ucs)
 
+		if sigact == SignalActionCore {
+			if r := t.prepareCoreDump(sig); r != nil {
+				return r
+			}
+		}
 		t.PrepareGroupExit(linux.WaitStatusTerminationSignal(sig))
 		return (*runExit)(nil)
 
@@ -416,6 +482,15 @@ func (t *Task) sendSignalTimerLocked(info *linux.SignalInfo, group bool, timer *
 		return linuxerr.EINVAL
 	}
 
+	// Intercepted signals have no effect on the target, not even side
+	// effects.
+	if t.interceptSignalLocked(sig) {
+		if timer != nil {
+			timer.signalRejectedLocked()
+		}
+		return nil
+	}
+
 	// Signal side effects apply even if the signal is ultimately discarded.
 	t.tg.applySignalSideEffectsLocked(sig)
 
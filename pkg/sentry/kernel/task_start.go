@@ -15,6 +15,8 @@
 package kernel
 
 import (
+	"sync/atomic"
+
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/atomicbitops"
 	"gvisor.dev/gvisor/pkg/context"
@@ -97,6 +99,9 @@ type TaskConfig struct {
 
 	// UserCounters is user resource counters.
 	UserCounters *userCounters
+
+	// NoNewPrivs is the no_new_privs bit of the new task.
+	NoNewPrivs bool
 }
 
 // NewTask creates a new task defined by cfg.
@@ -163,6 +168,7 @@ func (ts *TaskSet) newTask(cfg *TaskConfig) (*Task, error) {
 		containerID:        cfg.ContainerID,
 		cgroups:            make(map[Cgroup]struct{}),
 		userCounters:       cfg.UserCounters,
+		noNewPrivs:         cfg.NoNewPrivs,
 	}
 	t.netns.Store(cfg.NetworkNamespace)
 	t.creds.Store(cfg.Credentials)
@@ -223,8 +229,8 @@ func (ts *TaskSet) newTask(cfg *TaskConfig) (*Task, error) {
 	tg.liveTasks++
 	tg.activeTasks++
 
-	// Propagate external TaskSet stops to the new task.
-	t.stopCount = ts.stopCount
+	// Propagate external TaskSet and container stops to the new task.
+	t.stopCount = ts.stopCount + ts.containerStops[t.containerID]
 
 	t.mu.Lock()
 	defer t.mu.Unlock()
@@ -329,7 +335,9 @@ func (t *Task) Start(tid ThreadID) {
 		return
 	}
 	t.goroutineStopped.Add(1)
+	atomic.StoreInt32(&t.goroutineRunning, 1)
 	t.tg.liveGoroutines.Add(1)
+	atomic.AddInt32(&t.tg.liveGoroutineCount, 1)
 	t.tg.pidns.owner.liveGoroutines.Add(1)
 	t.tg.pidns.owner.runningGoroutines.Add(1)
 
@@ -242,3 +242,62 @@ func (ts *TaskSet) EndExternalStop() {
 		t.tg.signalHandlers.mu.Unlock()
 	}
 }
+
+// beginContainerStop indicates the start of an external stop that applies to
+// all current and future tasks of container cid in ts. beginContainerStop
+// does not wait for task goroutines to stop; it returns the tasks that were
+// stopped so that the caller can.
+func (ts *TaskSet) beginContainerStop(cid string) []*Task {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.containerStops == nil {
+		ts.containerStops = make(map[string]int32)
+	}
+	ts.containerStops[cid]++
+	if ts.containerStops[cid] <= 0 {
+		panic(fmt.Sprintf("Invalid container stopCount: %d", ts.containerStops[cid]))
+	}
+	if ts.Root == nil {
+		return nil
+	}
+	var stopped []*Task
+	for t := range ts.Root.tids {
+		if t.containerID != cid {
+			continue
+		}
+		t.tg.signalHandlers.mu.Lock()
+		t.beginStopLocked()
+		t.tg.signalHandlers.mu.Unlock()
+		t.interrupt()
+		stopped = append(stopped, t)
+	}
+	return stopped
+}
+
+// endContainerStop indicates the end of an external stop started by a
+// previous call to TaskSet.beginContainerStop for container cid. It returns
+// false if there is no such stop. endContainerStop does not wait for task
+// goroutines to resume.
+func (ts *TaskSet) endContainerStop(cid string) bool {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.containerStops[cid] == 0 {
+		return false
+	}
+	ts.containerStops[cid]--
+	if ts.containerStops[cid] == 0 {
+		delete(ts.containerStops, cid)
+	}
+	if ts.Root == nil {
+		return true
+	}
+	for t := range ts.Root.tids {
+		if t.containerID != cid {
+			continue
+		}
+		t.tg.signalHandlers.mu.Lock()
+		t.endStopLocked()
+		t.tg.signalHandlers.mu.Unlock()
+	}
+	return true
+}
@@ -98,7 +98,10 @@ func (t *Task) executeSyscall(sysno uintptr, args arch.SyscallArguments) (rval u
 		if trace.IsEnabled() {
 			region = trace.StartRegion(t.traceContext, s.LookupName(sysno))
 		}
-		if fn != nil {
+		if policyErr := t.k.checkSyscallPolicy(t.containerID, sysno); policyErr != nil {
+			// Denied by the container's syscall policy.
+			err = policyErr
+		} else if fn != nil {
 			// Call our syscall implementation.
 			rval, ctrl, err = fn(t, args)
 		} else {
@@ -26,6 +26,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/limits"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
 	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/waiter"
 )
 
 // A ThreadGroup is a logical grouping of tasks that has widespread
@@ -158,6 +159,18 @@ type ThreadGroup struct {
 	// restarted by Task.Start.
 	liveGoroutines sync.WaitGroup `state:"nosave"`
 
+	// liveGoroutineCount is the number of non-exited task goroutines in the
+	// thread group, like liveGoroutines, but it can be read. It is accessed
+	// using atomic memory operations.
+	//
+	// liveGoroutineCount is not saved; it is reset as task goroutines are
+	// restarted by Task.Start.
+	liveGoroutineCount int32 `state:"nosave"`
+
+	// exitedQueue is notified with waiter.EventHUp when liveGoroutineCount
+	// drops to 0, see EventRegisterExited.
+	exitedQueue waiter.Queue `state:"nosave"`
+
 	timerMu sync.Mutex `state:"nosave"`
 
 	// itimerRealTimer implements ITIMER_REAL for the thread group.
@@ -75,6 +75,14 @@ type TaskSet struct {
 	// always reset to zero after restore.
 	stopCount int32 `state:"nosave"`
 
+	// containerStops maps container IDs to the number of active external
+	// stops applicable to all tasks in the container (calls to
+	// TaskSet.beginContainerStop that have not been paired with a call to
+	// TaskSet.endContainerStop). containerStops is protected by mu.
+	//
+	// containerStops is not saved for the same reason as stopCount.
+	containerStops map[string]int32 `state:"nosave"`
+
 	// liveGoroutines is the number of non-exited task goroutines in the
 	// TaskSet.
 	//
@@ -87,15 +95,19 @@ type TaskSet struct {
 	//
 	// runningGoroutines is not saved; its counter value is required to be zero
 	// at time of save (but note that this is not necessarily the same thing as
-	// sync.WaitGroup's zero value).
-	runningGoroutines sync.WaitGroup `state:"nosave"`
+	// goroutineCounter's zero value).
+	runningGoroutines goroutineCounter `state:"nosave"`
+
+	// goroutineStoppedQueue is notified with waiter.EventIn whenever a task
+	// goroutine in the TaskSet stops or exits, see Task.goroutineRunning.
+	goroutineStoppedQueue waiter.Queue `state:"nosave"`
 
 	// aioGoroutines is the number of goroutines running async I/O
 	// callbacks.
 	//
 	// aioGoroutines is not saved but is required to be zero at the time of
 	// save.
-	aioGoroutines sync.WaitGroup `state:"nosave"`
+	aioGoroutines goroutineCounter `state:"nosave"`
 }
 
 // newTaskSet returns a new, empty TaskSet.
@@ -285,6 +297,13 @@ func (ns *PIDNamespace) NumTasks() int {
 	return len(ns.tids)
 }
 
+// NumThreadGroups returns the number of thread groups in ns.
+func (ns *PIDNamespace) NumThreadGroups() int {
+	ns.owner.mu.RLock()
+	defer ns.owner.mu.RUnlock()
+	return len(ns.tgids)
+}
+
 // ThreadGroups returns a snapshot of the thread groups in ns.
 func (ns *PIDNamespace) ThreadGroups() []*ThreadGroup {
 	return ns.ThreadGroupsAppend(nil)
@@ -353,6 +372,14 @@ type threadGroupNode struct {
 	// execing is protected by the TaskSet mutex.
 	execing *Task
 
+	// If coreDumping is not nil, it is a task in the thread group that has
+	// killed all other tasks so that it can dump core once they've exited.
+	//
+	// coreDumping is analogous to Linux's signal_struct::core_state.
+	//
+	// coreDumping is protected by the TaskSet mutex.
+	coreDumping *Task
+
 	// tasks is all tasks in the thread group that have not yet been reaped.
 	//
 	// tasks is protected by both the TaskSet mutex and the signal mutex:
@@ -424,6 +424,25 @@ type File interface {
 	FD() int
 }
 
+// contextID is this package's type for context.Context.Value keys.
+type contextID int
+
+const (
+	// CtxMajorFault is a Context.Value key for a *bool that is set when
+	// handling a page fault requires reading data from a file. Contexts
+	// that can't handle page faults return nil.
+	CtxMajorFault contextID = iota
+)
+
+// NoteMajorFault records that handling the page fault in progress in ctx, if
+// any, required reading data from a file, which makes it a major fault.
+// Mappable implementations call it from Translate before such reads.
+func NoteMajorFault(ctx context.Context) {
+	if v := ctx.Value(CtxMajorFault); v != nil {
+		*v.(*bool) = true
+	}
+}
+
 // FileRange represents a range of uint64 offsets into a File.
 //
 // type FileRange <generated using go_generics>
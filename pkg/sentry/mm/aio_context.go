@@ -15,6 +15,8 @@
 package mm
 
 import (
+	"sort"
+
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
@@ -124,6 +126,11 @@ type AIOContext struct {
 
 	// dead is set when the context is destroyed.
 	dead bool `state:"zerovalue"`
+
+	// cancelGen is incremented every time pending requests are canceled.
+	// Canceled requests that haven't started executing complete with
+	// ECANCELED.
+	cancelGen uint64
 }
 
 // destroy marks the context dead.
@@ -223,6 +230,23 @@ func (ctx *AIOContext) CancelPendingRequest() {
 	ctx.checkForDone()
 }
 
+// CancelGeneration returns a value identifying the requests that are pending
+// at this point. It must be obtained before submitting a request, and passed
+// to Canceled before executing it.
+func (ctx *AIOContext) CancelGeneration() uint64 {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	return ctx.cancelGen
+}
+
+// Canceled returns true if the requests submitted after gen was returned by
+// CancelGeneration have been canceled since.
+func (ctx *AIOContext) Canceled(gen uint64) bool {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	return ctx.cancelGen != gen
+}
+
 // Drain drops all completed requests. Pending requests remain untouched.
 func (ctx *AIOContext) Drain() {
 	ctx.mu.Lock()
@@ -439,3 +463,45 @@ func (mm *MemoryManager) isValidAddr(ctx context.Context, id uint64) bool {
 	_, err := mm.CopyIn(ctx, hostarch.Addr(id), buf[:], usermem.IOOpts{})
 	return err == nil
 }
+
+// AIOContextInfo describes an asynchronous I/O context.
+type AIOContextInfo struct {
+	// ID is the context ID, as returned by io_setup(2).
+	ID uint64 `json:"id"`
+
+	// MaxOutstanding is the maximum number of outstanding requests.
+	MaxOutstanding uint32 `json:"maxOutstanding"`
+
+	// Pending is the number of submitted requests that haven't completed.
+	Pending uint32 `json:"pending"`
+
+	// Completed is the number of completed requests that haven't been
+	// reaped with io_getevents(2).
+	Completed uint32 `json:"completed"`
+}
+
+// AIOContexts returns information about all asynchronous I/O contexts of mm,
+// sorted by ID. If cancel is true, the requests pending in every context are
+// canceled after being reported.
+func (mm *MemoryManager) AIOContexts(cancel bool) []AIOContextInfo {
+	mm.aioManager.mu.Lock()
+	defer mm.aioManager.mu.Unlock()
+
+	infos := make([]AIOContextInfo, 0, len(mm.aioManager.contexts))
+	for id, aioCtx := range mm.aioManager.contexts {
+		aioCtx.mu.Lock()
+		completed := uint32(aioCtx.results.Len())
+		infos = append(infos, AIOContextInfo{
+			ID:             id,
+			MaxOutstanding: aioCtx.maxOutstanding,
+			Pending:        aioCtx.outstanding - completed,
+			Completed:      completed,
+		})
+		if cancel {
+			aioCtx.cancelGen++
+		}
+		aioCtx.mu.Unlock()
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
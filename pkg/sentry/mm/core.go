@@ -0,0 +1,50 @@
+// Copyright 2018 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mm
+
+import (
+	"gvisor.dev/gvisor/pkg/hostarch"
+)
+
+// CoreSegment describes a mapping in a core dump.
+type CoreSegment struct {
+	// Range is the mapped address range.
+	Range hostarch.AddrRange
+
+	// Perms are the permissions of the mapping.
+	Perms hostarch.AccessType
+
+	// Anonymous is true if the mapping isn't backed by a file. Like with
+	// Linux's default coredump_filter, only the contents of anonymous
+	// mappings are dumped.
+	Anonymous bool
+}
+
+// CoreSegments returns the mappings to include in a core dump of mm, in
+// address order.
+func (mm *MemoryManager) CoreSegments() []CoreSegment {
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	var segs []CoreSegment
+	for vseg := mm.vmas.FirstSegment(); vseg.Ok(); vseg = vseg.NextSegment() {
+		vma := vseg.ValuePtr()
+		segs = append(segs, CoreSegment{
+			Range:     vseg.Range(),
+			Perms:     vma.realPerms,
+			Anonymous: vma.mappable == nil,
+		})
+	}
+	return segs
+}
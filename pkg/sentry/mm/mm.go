@@ -252,6 +252,15 @@ type MemoryManager struct {
 	//
 	// membarrierRSeqEnabled is accessed using atomic memory operations.
 	membarrierRSeqEnabled uint32
+
+	// minorFaults and majorFaults are the number of page faults handled by
+	// HandleUserFault. Major faults required reading data from a file, see
+	// memmap.NoteMajorFault; all others are minor faults.
+	//
+	// minorFaults and majorFaults are accessed using atomic memory
+	// operations.
+	minorFaults uint64
+	majorFaults uint64
 }
 
 // vma represents a virtual memory area.
@@ -16,6 +16,7 @@ package mm
 
 import (
 	"testing"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
@@ -231,6 +232,57 @@ func TestIOAfterMProtect(t *testing.T) {
 	}
 }
 
+// TestDecommitReleasesMemory tests that memory decommitted with
+// madvise(MADV_DONTNEED) semantics is released to the host.
+func TestDecommitReleasesMemory(t *testing.T) {
+	ctx := contexttest.Context(t)
+	mf := pgalloc.MemoryFileFromContext(ctx)
+	mf.SetReleaseToHost(true)
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+
+	const length = 64 * hostarch.PageSize
+	addr, err := mm.MMap(ctx, memmap.MMapOpts{
+		Length:   length,
+		Private:  true,
+		Perms:    hostarch.ReadWrite,
+		MaxPerms: hostarch.AnyAccess,
+	})
+	if err != nil {
+		t.Fatalf("MMap got err %v want nil", err)
+	}
+	if _, err := mm.CopyOut(ctx, addr, make([]byte, length), usermem.IOOpts{}); err != nil {
+		t.Fatalf("CopyOut got err %v want nil", err)
+	}
+	before, err := mf.TotalUsage()
+	if err != nil {
+		t.Fatalf("TotalUsage got err %v want nil", err)
+	}
+	if before < length {
+		t.Fatalf("TotalUsage got %d want at least %d", before, length)
+	}
+
+	if err := mm.Decommit(addr, length); err != nil {
+		t.Fatalf("Decommit got err %v want nil", err)
+	}
+
+	// Memory is released asynchronously by the reclaimer goroutine.
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		after, err := mf.TotalUsage()
+		if err != nil {
+			t.Fatalf("TotalUsage got err %v want nil", err)
+		}
+		if after <= before-length {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("TotalUsage after Decommit got %d want at most %d", after, before-length)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 // TestAIOPrepareAfterDestroy tests that AIOContext should not be able to be
 // prepared after destruction.
 func TestAIOPrepareAfterDestroy(t *testing.T) {
@@ -273,3 +325,43 @@ func TestAIOLookupAfterDestroy(t *testing.T) {
 		t.Errorf("AIOContext found even after AIOContext manager is destroyed")
 	}
 }
+
+// TestAIOContextsCancel tests that pending requests are reported by
+// AIOContexts and can be canceled.
+func TestAIOContextsCancel(t *testing.T) {
+	ctx := contexttest.Context(t)
+	mm := testMemoryManager(ctx)
+	defer mm.DecUsers(ctx)
+
+	id, err := mm.NewAIOContext(ctx, 4)
+	if err != nil {
+		t.Fatalf("mm.NewAIOContext got err %v want nil", err)
+	}
+	aioCtx, ok := mm.LookupAIOContext(ctx, id)
+	if !ok {
+		t.Fatalf("AIOContext not found")
+	}
+
+	// Submit two requests and complete one of them.
+	gen := aioCtx.CancelGeneration()
+	for i := 0; i < 2; i++ {
+		if err := aioCtx.Prepare(); err != nil {
+			t.Fatalf("aioCtx.Prepare got err %v want nil", err)
+		}
+	}
+	aioCtx.FinishRequest(nil)
+
+	want := []AIOContextInfo{{ID: id, MaxOutstanding: 4, Pending: 1, Completed: 1}}
+	got := mm.AIOContexts(true /* cancel */)
+	if len(got) != 1 || got[0] != want[0] {
+		t.Errorf("mm.AIOContexts got %+v want %+v", got, want)
+	}
+	if !aioCtx.Canceled(gen) {
+		t.Errorf("aioCtx.Canceled got false want true")
+	}
+
+	// Requests submitted after the cancellation are unaffected.
+	if aioCtx.Canceled(aioCtx.CancelGeneration()) {
+		t.Errorf("aioCtx.Canceled for new request got true want false")
+	}
+}
@@ -39,6 +39,12 @@ func (mm *MemoryManager) HandleUserFault(ctx context.Context, addr hostarch.Addr
 		return linuxerr.EFAULT
 	}
 
+	// Let Mappables report whether the fault requires I/O.
+	major, _ := ctx.Value(memmap.CtxMajorFault).(*bool)
+	if major != nil {
+		*major = false
+	}
+
 	// Don't bother trying existingPMAsLocked; in most cases, if we did have
 	// existing pmas, we wouldn't have faulted.
 
@@ -68,9 +74,22 @@ func (mm *MemoryManager) HandleUserFault(ctx context.Context, addr hostarch.Addr
 	// Map the faulted page into the active AddressSpace.
 	err = mm.mapASLocked(pseg, ar, false)
 	mm.activeMu.RUnlock()
+	if err == nil {
+		if major != nil && *major {
+			atomic.AddUint64(&mm.majorFaults, 1)
+		} else {
+			atomic.AddUint64(&mm.minorFaults, 1)
+		}
+	}
 	return err
 }
 
+// PageFaults returns the number of minor and major page faults handled by
+// HandleUserFault.
+func (mm *MemoryManager) PageFaults() (minor, major uint64) {
+	return atomic.LoadUint64(&mm.minorFaults), atomic.LoadUint64(&mm.majorFaults)
+}
+
 // MMap establishes a memory mapping.
 func (mm *MemoryManager) MMap(ctx context.Context, opts memmap.MMapOpts) (hostarch.Addr, error) {
 	if opts.Length == 0 {
@@ -170,6 +170,11 @@ type MemoryFile struct {
 	// transitions from false to true.
 	reclaimCond sync.Cond
 
+	// retainReclaimed is non-zero if the reclaimer goroutine zeroes reclaimed
+	// pages instead of releasing them to the host, see SetReleaseToHost.
+	// retainReclaimed is accessed using atomic memory operations.
+	retainReclaimed uint32
+
 	// evictable maps EvictableMemoryUsers to eviction state.
 	//
 	// evictable is protected by mu.
@@ -1117,6 +1122,16 @@ func (f *MemoryFile) runReclaim() {
 			break
 		}
 
+		if atomic.LoadUint32(&f.retainReclaimed) != 0 {
+			// Keep the pages committed for reuse, but they must still be
+			// zero when reallocated.
+			if err := f.manuallyZero(fr); err != nil {
+				panic(fmt.Sprintf("Reclaim failed to zero %v: %v", fr, err))
+			}
+			f.markRetained(fr)
+			continue
+		}
+
 		if f.opts.ManualZeroing {
 			// If ManualZeroing is in effect, only hugepage-aligned regions may
 			// be safely passed to decommitFile. Pages will be zeroed on
@@ -1177,6 +1192,24 @@ func (f *MemoryFile) runReclaim() {
 	}
 }
 
+// SetReleaseToHost sets whether pages freed by their last user, e.g. after
+// munmap(2) or madvise(MADV_DONTNEED), are decommitted by the reclaimer, which
+// is the default. Otherwise, they are zeroed and stay committed, which avoids
+// host page faults when they are reallocated but keeps host memory usage high.
+func (f *MemoryFile) SetReleaseToHost(release bool) {
+	var retain uint32
+	if !release {
+		retain = 1
+	}
+	atomic.StoreUint32(&f.retainReclaimed, retain)
+}
+
+// ReleaseToHost returns whether freed pages are released to the host, see
+// SetReleaseToHost.
+func (f *MemoryFile) ReleaseToHost() bool {
+	return atomic.LoadUint32(&f.retainReclaimed) == 0
+}
+
 // findReclaimable finds memory that has been marked for reclaim.
 //
 // Note that there returned range will be removed from tracking. It
@@ -1237,6 +1270,33 @@ func (f *MemoryFile) markReclaimed(fr memmap.FileRange) {
 	f.usage.Remove(f.usage.Isolate(seg, fr))
 }
 
+// markRetained is like markReclaimed, but for pages that were zeroed instead
+// of decommitted, and may thus still be committed. They stop being accounted
+// for, since they're free for reallocation.
+func (f *MemoryFile) markRetained(fr memmap.FileRange) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	seg := f.usage.FindSegment(fr.Start)
+	// All of fr should be mapped to a single reclaimable segment accounted to
+	// System.
+	if !seg.Ok() {
+		panic(fmt.Sprintf("retained pages %v include unreferenced pages:\n%v", fr, &f.usage))
+	}
+	if !seg.Range().IsSupersetOf(fr) {
+		panic(fmt.Sprintf("retained pages %v are not entirely contained in segment %v with state %v:\n%v", fr, seg.Range(), seg.Value(), &f.usage))
+	}
+	seg = f.usage.Isolate(seg, fr)
+	val := seg.Value()
+	if val.kind != usage.System || val.refs != 0 {
+		panic(fmt.Sprintf("retained pages %v in segment %v has incorrect state %v:\n%v", fr, seg.Range(), val, &f.usage))
+	}
+	if val.knownCommitted {
+		usage.MemoryAccounting.Dec(fr.Length(), val.kind)
+		f.usageExpected -= fr.Length()
+	}
+	f.usage.Remove(seg)
+}
+
 // StartEvictions requests that f evict all evictable allocations. It does not
 // wait for eviction to complete; for this, see MemoryFile.WaitForEvictions.
 func (f *MemoryFile) StartEvictions() {
@@ -15,10 +15,16 @@
 package pgalloc
 
 import (
+	"bytes"
 	"fmt"
+	"os"
 	"testing"
 
+	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/memutil"
+	"gvisor.dev/gvisor/pkg/sentry/memmap"
+	"gvisor.dev/gvisor/pkg/sentry/usage"
 )
 
 const (
@@ -378,3 +384,76 @@ func TestFindUnallocatedRange(t *testing.T) {
 		})
 	}
 }
+
+// newTestMemoryFile returns a MemoryFile backed by a memfd.
+func newTestMemoryFile(t *testing.T) *MemoryFile {
+	t.Helper()
+	memfd, err := memutil.CreateMemFD("pgalloc-test", 0)
+	if err != nil {
+		t.Fatalf("error creating memfd: %v", err)
+	}
+	file := os.NewFile(uintptr(memfd), "pgalloc-test")
+	f, err := NewMemoryFile(file, MemoryFileOpts{})
+	if err != nil {
+		file.Close()
+		t.Fatalf("NewMemoryFile failed: %v", err)
+	}
+	return f
+}
+
+// fillPage fills the page at offset off of f with b.
+func fillPage(t *testing.T, f *MemoryFile, off uint64, b byte) {
+	t.Helper()
+	fr := memmap.FileRange{Start: off, End: off + page}
+	if err := f.forEachMappingSlice(fr, func(s []byte) {
+		for i := range s {
+			s[i] = b
+		}
+	}); err != nil {
+		t.Fatalf("error mapping %v: %v", fr, err)
+	}
+}
+
+func TestReclaimReleaseToHost(t *testing.T) {
+	for _, release := range []bool{true, false} {
+		t.Run(fmt.Sprintf("release=%t", release), func(t *testing.T) {
+			f := newTestMemoryFile(t)
+			defer f.Destroy()
+			f.SetReleaseToHost(release)
+
+			fr, err := f.Allocate(page, AllocOpts{Kind: usage.Anonymous})
+			if err != nil {
+				t.Fatalf("Allocate failed: %v", err)
+			}
+			fillPage(t, f, fr.Start, 1)
+			var before unix.Stat_t
+			if err := unix.Fstat(f.FD(), &before); err != nil {
+				t.Fatalf("fstat failed: %v", err)
+			}
+
+			// Free the page and wait for the reclaimer.
+			f.DecRef(fr)
+			f.mu.Lock()
+			f.waitForReclaimLocked()
+			if seg := f.usage.FindSegment(fr.Start); seg.Ok() {
+				t.Errorf("reclaimed page still in use: %v", seg.Value())
+			}
+			f.mu.Unlock()
+
+			var after unix.Stat_t
+			if err := unix.Fstat(f.FD(), &after); err != nil {
+				t.Fatalf("fstat failed: %v", err)
+			}
+			if released := after.Blocks < before.Blocks; released != release {
+				t.Errorf("page released to host: %t (blocks %d -> %d), want: %t", released, before.Blocks, after.Blocks, release)
+			}
+			if err := f.forEachMappingSlice(fr, func(s []byte) {
+				if !bytes.Equal(s, make([]byte, len(s))) {
+					t.Errorf("reclaimed page isn't zeroed")
+				}
+			}); err != nil {
+				t.Fatalf("error mapping %v: %v", fr, err)
+			}
+		})
+	}
+}
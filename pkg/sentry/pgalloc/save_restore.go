@@ -30,17 +30,21 @@ import (
 	"gvisor.dev/gvisor/pkg/state/wire"
 )
 
+// saveProgressBytes is the maximum number of bytes of memory written out by
+// SaveToProgress between progress reports.
+const saveProgressBytes = 64 << 20
+
 // SaveTo writes f's state to the given stream.
 func (f *MemoryFile) SaveTo(ctx context.Context, w wire.Writer) error {
-	// Wait for reclaim.
+	return f.SaveToProgress(ctx, w, nil)
+}
+
+// SaveToProgress is like SaveTo, but if progress is not nil, it's called with
+// the number of pages written out so far as the committed pages are saved.
+func (f *MemoryFile) SaveToProgress(ctx context.Context, w wire.Writer, progress func(pages uint64)) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	for f.reclaimable {
-		f.reclaimCond.Signal()
-		f.mu.Unlock()
-		runtime.Gosched()
-		f.mu.Lock()
-	}
+	f.waitForReclaimLocked()
 
 	// Ensure that there are no pending evictions.
 	if len(f.evictable) != 0 {
@@ -88,6 +92,7 @@ func (f *MemoryFile) SaveTo(ctx context.Context, w wire.Writer) error {
 	}
 
 	// Dump out committed pages.
+	var pages uint64
 	for seg := f.usage.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
 		if !seg.Value().knownCommitted {
 			continue
@@ -96,13 +101,22 @@ func (f *MemoryFile) SaveTo(ctx context.Context, w wire.Writer) error {
 		if err := state.WriteHeader(w, uint64(seg.Range().Length()), false); err != nil {
 			return err
 		}
-		// Write out data.
+		// Write out data. Mapping slices may span a whole chunk, so they are
+		// split to report progress regularly.
 		var ioErr error
 		err := f.forEachMappingSlice(seg.Range(), func(s []byte) {
-			if ioErr != nil {
-				return
+			for len(s) > 0 && ioErr == nil {
+				n := len(s)
+				if progress != nil && n > saveProgressBytes {
+					n = saveProgressBytes
+				}
+				_, ioErr = w.Write(s[:n])
+				s = s[n:]
+				if progress != nil {
+					pages += uint64(n) / hostarch.PageSize
+					progress(pages)
+				}
 			}
-			_, ioErr = w.Write(s)
 		})
 		if ioErr != nil {
 			return ioErr
@@ -115,6 +129,19 @@ func (f *MemoryFile) SaveTo(ctx context.Context, w wire.Writer) error {
 	return nil
 }
 
+// waitForReclaimLocked waits for the reclaimer goroutine to release all
+// reclaimable pages.
+//
+// +checklocks:f.mu
+func (f *MemoryFile) waitForReclaimLocked() {
+	for f.reclaimable {
+		f.reclaimCond.Signal()
+		f.mu.Unlock()
+		runtime.Gosched()
+		f.mu.Lock()
+	}
+}
+
 // LoadFrom loads MemoryFile state from the given stream.
 func (f *MemoryFile) LoadFrom(ctx context.Context, r wire.Reader) error {
 	// Load metadata.
@@ -16,6 +16,7 @@ package kvm
 
 import (
 	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/atomicbitops"
 	pkgcontext "gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/ring0"
@@ -36,6 +37,12 @@ type context struct {
 
 	// interrupt is the interrupt context.
 	interrupt interrupt.Forwarder
+
+	// perfCycles, perfInstructions and perfCacheMisses are the hardware
+	// events counted while running this context, if enabled.
+	perfCycles       atomicbitops.Uint64
+	perfInstructions atomicbitops.Uint64
+	perfCacheMisses  atomicbitops.Uint64
 }
 
 // tryCPUIDError indicates that CPUID emulation should occur.
@@ -67,6 +74,15 @@ func (c *context) Switch(ctx pkgcontext.Context, mm platform.MemoryManager, ac a
 	// that the flush can occur naturally on the next user entry.
 	cpu.active.set(localAS)
 
+	// Sample the hardware counters, if enabled.
+	var (
+		perfBefore perfValues
+		perfOK     bool
+	)
+	if c.machine.perfCounters {
+		perfBefore, perfOK = cpu.readPerf()
+	}
+
 restart:
 	// Prepare switch options.
 	switchOpts := ring0.SwitchOpts{
@@ -91,6 +107,13 @@ restart:
 		}
 	}
 
+	// Account for the events counted while in user mode.
+	if perfOK {
+		if perfAfter, ok := cpu.readPerf(); ok {
+			c.addPerf(perfBefore, perfAfter)
+		}
+	}
+
 	// Clear the address space.
 	cpu.active.set(nil)
 
@@ -46,5 +46,21 @@ func (k *KVM) SyscallFilters() seccomp.SyscallRules {
 		unix.SYS_RT_SIGTIMEDWAIT: {},
 		_SYS_KVM_RETURN_TO_HOST:  {},
 	})
+	if k.machine.perfCounters {
+		// Counters are opened for the calling thread on any CPU, outside of
+		// any group, when a vCPU moves to another thread, see openPerfEvent.
+		// cpu and group_fd are -1, sign-extended.
+		r.Merge(seccomp.SyscallRules{
+			unix.SYS_PERF_EVENT_OPEN: []seccomp.Rule{
+				{
+					seccomp.MatchAny{},
+					seccomp.EqualTo(0),
+					seccomp.EqualTo(^uintptr(0)),
+					seccomp.EqualTo(^uintptr(0)),
+					seccomp.EqualTo(unix.PERF_FLAG_FD_CLOEXEC),
+				},
+			},
+		})
+	}
 	return r
 }
@@ -83,6 +83,11 @@ type machine struct {
 
 	// usedSlots is the set of used physical addresses (not sorted).
 	usedSlots []uintptr
+
+	// perfCounters indicates that hardware events are counted while
+	// application code runs. It's set by KVM.EnablePerfCounters before any
+	// vCPU is used and doesn't change afterwards.
+	perfCounters bool
 }
 
 const (
@@ -142,6 +147,10 @@ type vCPU struct {
 	// it is used to elide unnecessary interrupts due to invalidations.
 	active atomicAddressSpace
 
+	// perf is the hardware counter group of the thread running this vCPU.
+	// It's only used by the vCPU owner.
+	perf perfGroup
+
 	// vCPUArchState is the architecture-specific state.
 	vCPUArchState
 
@@ -385,6 +394,7 @@ func (m *machine) Destroy() {
 		if err := unix.Close(int(c.fd)); err != nil {
 			panic(fmt.Sprintf("error closing vCPU fd: %v", err))
 		}
+		c.perf.close()
 	}
 
 	machinePool[m.machinePoolIndex].Store(nil)
@@ -0,0 +1,140 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvm
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/platform"
+)
+
+// perfEvents are the hardware events counted while application code runs.
+var perfEvents = [...]uint64{
+	unix.PERF_COUNT_HW_CPU_CYCLES,
+	unix.PERF_COUNT_HW_INSTRUCTIONS,
+	unix.PERF_COUNT_HW_CACHE_MISSES,
+}
+
+// perfGroup is a set of hardware counters attached to a host thread.
+type perfGroup struct {
+	// tid is the thread the counters are attached to. It's zero if no
+	// counters are open.
+	tid uint64
+
+	// fds are the counter fds, in the order of perfEvents.
+	fds [len(perfEvents)]int
+}
+
+// perfValues are the values of a perfGroup, in the order of perfEvents.
+type perfValues [len(perfEvents)]uint64
+
+// openPerfEvent opens a counter for the given event that only counts while
+// the calling thread runs in guest user mode, i.e. while it runs application
+// code. The seccomp filters only allow these arguments, see SyscallFilters.
+func openPerfEvent(event uint64) (int, error) {
+	attr := unix.PerfEventAttr{
+		Type:   unix.PERF_TYPE_HARDWARE,
+		Size:   uint32(unsafe.Sizeof(unix.PerfEventAttr{})),
+		Config: event,
+		Bits:   unix.PerfBitExcludeKernel | unix.PerfBitExcludeHv | unix.PerfBitExcludeHost,
+	}
+	return unix.PerfEventOpen(&attr, 0 /* pid */, -1 /* cpu */, -1 /* groupFd */, unix.PERF_FLAG_FD_CLOEXEC)
+}
+
+// open attaches the counters to the calling thread, whose ID is tid.
+func (g *perfGroup) open(tid uint64) error {
+	for i, event := range perfEvents {
+		fd, err := openPerfEvent(event)
+		if err != nil {
+			for _, fd := range g.fds[:i] {
+				unix.Close(fd)
+			}
+			return err
+		}
+		g.fds[i] = fd
+	}
+	g.tid = tid
+	return nil
+}
+
+// close releases the group's counters.
+func (g *perfGroup) close() {
+	if g.tid == 0 {
+		return
+	}
+	for _, fd := range g.fds {
+		unix.Close(fd)
+	}
+	g.tid = 0
+}
+
+// readPerf returns the current values of the vCPU counters. The counters are
+// attached to the thread running the vCPU first if needed. It returns false if
+// the counters can't be read.
+//
+// Precondition: the caller must own the vCPU, and run on its thread.
+func (c *vCPU) readPerf() (perfValues, bool) {
+	var vals perfValues
+	if tid := c.tid.Load(); c.perf.tid != tid {
+		// The vCPU moved to another thread.
+		c.perf.close()
+		if err := c.perf.open(tid); err != nil {
+			log.Warningf("Opening perf counters for thread %d: %v", tid, err)
+			return vals, false
+		}
+	}
+	for i, fd := range c.perf.fds {
+		n, _, errno := unix.RawSyscall(unix.SYS_READ, uintptr(fd), uintptr(unsafe.Pointer(&vals[i])), unsafe.Sizeof(vals[i]))
+		if errno != 0 || n != unsafe.Sizeof(vals[i]) {
+			return vals, false
+		}
+	}
+	return vals, true
+}
+
+// addPerf adds the difference between the given values to the context counters.
+func (c *context) addPerf(before, after perfValues) {
+	c.perfCycles.Add(after[0] - before[0])
+	c.perfInstructions.Add(after[1] - before[1])
+	c.perfCacheMisses.Add(after[2] - before[2])
+}
+
+// PerfCounters implements platform.PerfCounterContext.PerfCounters.
+func (c *context) PerfCounters() platform.PerfCounters {
+	return platform.PerfCounters{
+		Cycles:       c.perfCycles.Load(),
+		Instructions: c.perfInstructions.Load(),
+		CacheMisses:  c.perfCacheMisses.Load(),
+	}
+}
+
+// EnablePerfCounters implements platform.PerfCounterPlatform.EnablePerfCounters.
+func (k *KVM) EnablePerfCounters() error {
+	// Check that the host allows counting events for sentry threads, e.g. it
+	// may be restricted by perf_event_paranoid or unsupported in a VM.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	var g perfGroup
+	if err := g.open(uint64(unix.Gettid())); err != nil {
+		return fmt.Errorf("opening perf counters: %w", err)
+	}
+	g.close()
+	k.machine.perfCounters = true
+	return nil
+}
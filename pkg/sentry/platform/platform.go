@@ -246,6 +246,43 @@ type Context interface {
 	Release()
 }
 
+// PerfCounters are hardware performance counters accumulated while running
+// application code.
+type PerfCounters struct {
+	// Cycles is the number of CPU cycles.
+	Cycles uint64 `json:"cycles"`
+
+	// Instructions is the number of retired instructions.
+	Instructions uint64 `json:"instructions"`
+
+	// CacheMisses is the number of last level cache misses.
+	CacheMisses uint64 `json:"cacheMisses"`
+}
+
+// Add adds the counts in o to p.
+func (p *PerfCounters) Add(o PerfCounters) {
+	p.Cycles += o.Cycles
+	p.Instructions += o.Instructions
+	p.CacheMisses += o.CacheMisses
+}
+
+// PerfCounterPlatform is implemented by Platforms that can count hardware
+// events while application code runs.
+type PerfCounterPlatform interface {
+	// EnablePerfCounters starts counting hardware events in all Contexts. It
+	// must be called before any Context is switched to. It returns an error if
+	// the host doesn't allow access to the counters.
+	EnablePerfCounters() error
+}
+
+// PerfCounterContext is implemented by Contexts of a PerfCounterPlatform.
+type PerfCounterContext interface {
+	// PerfCounters returns the counts accumulated by the Context so far. All
+	// counts are zero if counting isn't enabled. It may be called
+	// concurrently with Switch.
+	PerfCounters() PerfCounters
+}
+
 var (
 	// ErrContextSignal is returned by Context.Switch() to indicate that the
 	// Context was interrupted by a signal.
@@ -37,6 +37,16 @@ type Stack struct {
 	Stack *stack.Stack `state:"manual"`
 }
 
+// ReplaceStack replaces the underlying network stack with ns, e.g. to recover
+// from a wedged network stack. Sockets created before the call keep using
+// the previous stack.
+//
+// Preconditions: The kernel must be paused, since tasks use s.Stack without
+// synchronization.
+func (s *Stack) ReplaceStack(ns *stack.Stack) {
+	s.Stack = ns
+}
+
 // SupportsIPv6 implements Stack.SupportsIPv6.
 func (s *Stack) SupportsIPv6() bool {
 	return s.Stack.CheckNetworkProtocol(ipv6.ProtocolNumber)
@@ -0,0 +1,357 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+
+	"gvisor.dev/gvisor/pkg/state"
+	"gvisor.dev/gvisor/pkg/state/wire"
+)
+
+// AddedField is a field added to a saved type. Objects are only loaded if
+// their saved fields match the fields of their type, so objects saved before
+// the field was added must be given a value for it with AddFields.
+type AddedField struct {
+	// Type is the name of the type, as returned by its StateTypeName
+	// method, e.g. "pkg/sentry/kernel.Task".
+	Type string
+
+	// Name is the name of the field.
+	Name string
+
+	// Default returns the value of the field for obj, which was saved
+	// without it. If Default is nil or returns nil, the field is loaded as
+	// its zero value.
+	Default func(obj *SavedObject) wire.Object
+}
+
+// SavedObject is an object of a state file being migrated by AddFields.
+type SavedObject struct {
+	g    *graph
+	s    *wire.Struct
+	path string
+}
+
+// Field returns the saved value of the object's field name, or nil if it
+// wasn't saved.
+func (o *SavedObject) Field(name string) wire.Object {
+	for i, f := range o.g.types[o.s.TypeID-1].Fields {
+		if f == name && i < o.s.Fields() {
+			return *o.s.Field(i)
+		}
+	}
+	return nil
+}
+
+// Referrers returns the number of saved objects of type typ whose field name
+// points to the object.
+func (o *SavedObject) Referrers(typ, name string) int {
+	return o.g.referrers(typ, name)[o.path]
+}
+
+// AddFields returns a MigrateFunc that adds the given fields to the objects
+// saved without them. Fields that were saved are left alone, so the same
+// fields may be passed to several migrations.
+//
+// Object graphs are migrated one at a time as they are read, while other
+// data, e.g. the contents of the memory file, is passed through as is.
+func AddFields(fields ...AddedField) MigrateFunc {
+	return func(r wire.Reader, _ map[string]string) (wire.Reader, error) {
+		return bufio.NewReader(&fieldAdder{r: r, fields: fields}), nil
+	}
+}
+
+// fieldAdder is an io.Reader returning the stream read from r with fields
+// added to its object graphs.
+type fieldAdder struct {
+	r      wire.Reader
+	fields []AddedField
+
+	// cur is the rest of the current graph or non-object data.
+	cur io.Reader
+}
+
+// Read implements io.Reader.Read.
+func (a *fieldAdder) Read(p []byte) (int, error) {
+	for {
+		if a.cur != nil {
+			n, err := a.cur.Read(p)
+			if n != 0 || err != io.EOF {
+				return n, err
+			}
+			a.cur = nil
+		}
+
+		length, object, err := state.ReadHeader(a.r)
+		if err != nil {
+			// Including io.EOF at the end of the stream.
+			return 0, err
+		}
+		var buf bytes.Buffer
+		if !object {
+			// Non-object data, copied as is.
+			if err := state.WriteHeader(&buf, length, false); err != nil {
+				return 0, err
+			}
+			a.cur = io.MultiReader(&buf, &io.LimitedReader{R: a.r, N: int64(length)})
+			continue
+		}
+		g, err := readGraph(a.r, length)
+		if err != nil {
+			return 0, err
+		}
+		g.addFields(a.fields)
+		if err := g.write(&buf); err != nil {
+			return 0, err
+		}
+		a.cur = &buf
+	}
+}
+
+// graphEntry is either a type definition or an object of a graph.
+type graphEntry struct {
+	typ *wire.Type
+	id  wire.Uint
+	obj wire.Object
+}
+
+// graph is an object graph saved by state.Save.
+type graph struct {
+	entries []graphEntry
+
+	// types holds the type definitions of the graph, indexed by type ID
+	// minus one.
+	types []*wire.Type
+
+	// refs caches the result of referrers.
+	refs map[string]map[string]int
+}
+
+// safely runs fn, returning the error it panics with, as pkg/state/wire uses
+// panics for errors.
+func safely(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			rErr, ok := r.(error)
+			if !ok {
+				panic(r) // Propagate.
+			}
+			err = rErr
+		}
+	}()
+	fn()
+	return nil
+}
+
+// readGraph reads a graph of numObjects objects from r, whose header has been
+// read already. The loop matches the one in state's decodeState.Load.
+func readGraph(r wire.Reader, numObjects uint64) (*graph, error) {
+	g := &graph{}
+	err := safely(func() {
+		for i := uint64(0); i < numObjects; {
+			switch we := wire.Load(r).(type) {
+			case *wire.Type:
+				g.entries = append(g.entries, graphEntry{typ: we})
+				g.types = append(g.types, we)
+			case wire.Uint:
+				i++
+				g.entries = append(g.entries, graphEntry{id: we, obj: wire.Load(r)})
+			default:
+				panic(fmt.Errorf("wanted type or object ID, got %#v", we))
+			}
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading object graph: %w", err)
+	}
+	return g, nil
+}
+
+// write writes g to w, including its header.
+func (g *graph) write(w wire.Writer) error {
+	var numObjects uint64
+	for _, e := range g.entries {
+		if e.typ == nil {
+			numObjects++
+		}
+	}
+	if err := state.WriteHeader(w, numObjects, true); err != nil {
+		return err
+	}
+	return safely(func() {
+		for _, e := range g.entries {
+			if e.typ != nil {
+				wire.Save(w, e.typ)
+				continue
+			}
+			wire.Save(w, e.id)
+			wire.Save(w, e.obj)
+		}
+	})
+}
+
+// walk calls fn on every struct in obj, which is at path, innermost first,
+// and replaces the struct with the one returned by fn. It returns obj with
+// the replacements made.
+//
+// Paths are made of the ID of the object followed by the fields and indices
+// leading to the struct, matching refKey.
+func (g *graph) walk(obj wire.Object, path string, fn func(s *wire.Struct, path string) *wire.Struct) wire.Object {
+	switch x := obj.(type) {
+	case *wire.Struct:
+		if x.TypeID == 0 {
+			return x
+		}
+		// Fields added by addFields aren't named yet, and don't need to
+		// be walked.
+		names := g.types[x.TypeID-1].Fields
+		for i := 0; i < x.Fields() && i < len(names); i++ {
+			f := x.Field(i)
+			*f = g.walk(*f, path+"."+names[i], fn)
+		}
+		return fn(x, path)
+	case *wire.Array:
+		for i := range x.Contents {
+			x.Contents[i] = g.walk(x.Contents[i], path+"["+strconv.Itoa(i)+"]", fn)
+		}
+	case *wire.Map:
+		// Map elements can't be referred to, so their path doesn't matter.
+		for i := range x.Keys {
+			x.Keys[i] = g.walk(x.Keys[i], "", fn)
+			x.Values[i] = g.walk(x.Values[i], "", fn)
+		}
+	case *wire.Interface:
+		x.Value = g.walk(x.Value, "", fn)
+	}
+	return obj
+}
+
+// walkAll calls walk on every object of g.
+func (g *graph) walkAll(fn func(s *wire.Struct, path string) *wire.Struct) {
+	for i := range g.entries {
+		if e := &g.entries[i]; e.typ == nil {
+			e.obj = g.walk(e.obj, strconv.FormatUint(uint64(e.id), 10), fn)
+		}
+	}
+}
+
+// refKey returns the path of the object ref points to.
+func refKey(ref *wire.Ref) string {
+	key := strconv.FormatUint(uint64(ref.Root), 10)
+	// Dots are stored in reverse order.
+	for i := len(ref.Dots) - 1; i >= 0; i-- {
+		switch d := ref.Dots[i].(type) {
+		case *wire.FieldName:
+			key += "." + string(*d)
+		case wire.Index:
+			key += "[" + strconv.Itoa(int(d)) + "]"
+		}
+	}
+	return key
+}
+
+// referrers returns the number of objects of type typ whose field name points
+// to each path.
+func (g *graph) referrers(typ, name string) map[string]int {
+	key := typ + "." + name
+	if refs, ok := g.refs[key]; ok {
+		return refs
+	}
+	refs := make(map[string]int)
+	g.walkAll(func(s *wire.Struct, _ string) *wire.Struct {
+		t := g.types[s.TypeID-1]
+		if t.Name != typ {
+			return s
+		}
+		for i, f := range t.Fields {
+			if f != name || i >= s.Fields() {
+				continue
+			}
+			if ref, ok := (*s.Field(i)).(*wire.Ref); ok && ref.Root != 0 {
+				refs[refKey(ref)]++
+			}
+		}
+		return s
+	})
+	if g.refs == nil {
+		g.refs = make(map[string]map[string]int)
+	}
+	g.refs[key] = refs
+	return refs
+}
+
+// addFields adds fields to the types of g that lack them, and to their
+// objects.
+func (g *graph) addFields(fields []AddedField) {
+	added := make(map[wire.TypeID][]AddedField)
+	for i, t := range g.types {
+		for _, f := range fields {
+			if f.Type == t.Name && !hasField(t, f.Name) {
+				added[wire.TypeID(i+1)] = append(added[wire.TypeID(i+1)], f)
+			}
+		}
+	}
+	if len(added) == 0 {
+		return
+	}
+
+	g.walkAll(func(s *wire.Struct, path string) *wire.Struct {
+		fs := added[s.TypeID]
+		if len(fs) == 0 {
+			return s
+		}
+		obj := &SavedObject{g: g, s: s, path: path}
+		n := s.Fields()
+		ns := &wire.Struct{TypeID: s.TypeID}
+		ns.Alloc(n + len(fs))
+		for i := 0; i < n; i++ {
+			*ns.Field(i) = *s.Field(i)
+		}
+		for i, f := range fs {
+			var v wire.Object = wire.Nil{}
+			if f.Default != nil {
+				if d := f.Default(obj); d != nil {
+					v = d
+				}
+			}
+			*ns.Field(n + i) = v
+		}
+		return ns
+	})
+
+	// Only change the types once all objects have been migrated, as
+	// SavedObject and walk rely on the saved fields.
+	for id, fs := range added {
+		t := g.types[id-1]
+		for _, f := range fs {
+			t.Fields = append(t.Fields, f.Name)
+		}
+	}
+}
+
+// hasField returns true if t has a field called name.
+func hasField(t *wire.Type, name string) bool {
+	for _, f := range t.Fields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/state"
+	"gvisor.dev/gvisor/pkg/state/wire"
+)
+
+// newStruct returns a struct of type id with the given fields.
+func newStruct(id wire.TypeID, fields ...wire.Object) *wire.Struct {
+	s := &wire.Struct{TypeID: id}
+	s.Alloc(len(fields))
+	for i, f := range fields {
+		*s.Field(i) = f
+	}
+	return s
+}
+
+func TestAddFields(t *testing.T) {
+	// A graph with a "test.Table" holding a counter, two "test.Entry"
+	// pointing to its "table" field, and a "test.Other".
+	old := &graph{
+		types: []*wire.Type{
+			{Name: "test.Root", Fields: []string{"table"}},
+			{Name: "test.Table", Fields: []string{"limit"}},
+			{Name: "test.Entry", Fields: []string{"root"}},
+			{Name: "test.Other", Fields: []string{"limit"}},
+		},
+	}
+	tableRef := &wire.Ref{Root: 1, Dots: []wire.Dot{func() wire.Dot { f := wire.FieldName("table"); return &f }()}, Type: wire.TypeID(1)}
+	old.entries = []graphEntry{
+		{typ: old.types[0]},
+		{typ: old.types[1]},
+		{id: 1, obj: newStruct(1, newStruct(2, wire.Uint(10)))},
+		{typ: old.types[2]},
+		{id: 2, obj: newStruct(3, tableRef)},
+		{id: 3, obj: newStruct(3, tableRef)},
+		{typ: old.types[3]},
+		{id: 4, obj: newStruct(4, wire.Uint(20))},
+	}
+
+	var in bytes.Buffer
+	// Non-object data must be passed through.
+	if err := state.WriteHeader(&in, 3, false); err != nil {
+		t.Fatalf("WriteHeader() failed: %v", err)
+	}
+	in.WriteString("abc")
+	if err := old.write(&in); err != nil {
+		t.Fatalf("write() failed: %v", err)
+	}
+
+	migrate := AddFields(
+		AddedField{Type: "test.Table", Name: "count", Default: func(obj *SavedObject) wire.Object {
+			return wire.Int(obj.Referrers("test.Entry", "root"))
+		}},
+		AddedField{Type: "test.Table", Name: "max", Default: func(obj *SavedObject) wire.Object {
+			return obj.Field("limit")
+		}},
+		AddedField{Type: "test.Table", Name: "zero"},
+		// Already saved.
+		AddedField{Type: "test.Table", Name: "limit", Default: constant(wire.Uint(1))},
+	)
+	r, err := migrate(bufio.NewReader(&in), nil)
+	if err != nil {
+		t.Fatalf("AddFields() failed: %v", err)
+	}
+
+	length, object, err := state.ReadHeader(r)
+	if err != nil || object || length != 3 {
+		t.Fatalf("ReadHeader() got length: %d, object: %t, err: %v, want non-object data of length 3", length, object, err)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil || string(data) != "abc" {
+		t.Fatalf("non-object data got: %q, err: %v, want: %q", data, err, "abc")
+	}
+
+	length, object, err = state.ReadHeader(r)
+	if err != nil || !object {
+		t.Fatalf("ReadHeader() got object: %t, err: %v, want an object graph", object, err)
+	}
+	g, err := readGraph(r, length)
+	if err != nil {
+		t.Fatalf("readGraph() failed: %v", err)
+	}
+	if rest, err := ioutil.ReadAll(r); err != nil || len(rest) != 0 {
+		t.Errorf("got %d bytes after the graph, err: %v, want none", len(rest), err)
+	}
+
+	if got, want := g.types[1].Fields, []string{"limit", "count", "max", "zero"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("test.Table fields got: %v, want: %v", got, want)
+	}
+	if got, want := g.types[3].Fields, []string{"limit"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("test.Other fields got: %v, want: %v", got, want)
+	}
+	table := (*g.entries[2].obj.(*wire.Struct).Field(0)).(*wire.Struct)
+	var got []wire.Object
+	for i := 0; i < table.Fields(); i++ {
+		got = append(got, *table.Field(i))
+	}
+	if want := []wire.Object{wire.Uint(10), wire.Int(2), wire.Uint(10), wire.Nil{}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("test.Table got: %v, want: %v", got, want)
+	}
+	if other := g.entries[7].obj.(*wire.Struct); other.Fields() != 1 {
+		t.Errorf("test.Other got %d fields, want 1", other.Fields())
+	}
+}
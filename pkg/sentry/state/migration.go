@@ -0,0 +1,172 @@
+// Copyright 2018 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"fmt"
+	"strconv"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/state/wire"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// Version is the current format version of state files. It must be bumped
+// whenever a change to saved objects prevents older state files from being
+// loaded as is, together with registering a Migration from the previous
+// version.
+const Version = 1
+
+// metadataVersion is the save metadata key holding the state file format
+// version. State files without it predate versioning and are version 0.
+const metadataVersion = "state_version"
+
+// MigrateFunc upgrades the object stream of a state file by one version. It
+// returns the stream in the new format, and may update metadata as well.
+type MigrateFunc func(r wire.Reader, metadata map[string]string) (wire.Reader, error)
+
+// migrations holds the upgrade steps between state file format versions.
+type migrations struct {
+	mu sync.Mutex
+
+	// steps maps a version to the function upgrading it to the next version.
+	steps map[int]MigrateFunc
+}
+
+// register registers fn as the upgrade step from version from to from+1.
+func (ms *migrations) register(from int, fn MigrateFunc) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.steps == nil {
+		ms.steps = make(map[int]MigrateFunc)
+	}
+	if _, ok := ms.steps[from]; ok {
+		panic(fmt.Sprintf("migration from state version %d registered twice", from))
+	}
+	ms.steps[from] = fn
+}
+
+// checkLocked returns the version recorded in metadata, or an error if the state
+// file can't be upgraded to version to. It fails for state files newer than
+// to, i.e. downgrades, and if an upgrade step is missing.
+//
+// Preconditions: ms.mu is locked.
+func (ms *migrations) checkLocked(metadata map[string]string, to int) (int, error) {
+	from := 0
+	if v, ok := metadata[metadataVersion]; ok {
+		var err error
+		if from, err = strconv.Atoi(v); err != nil || from < 0 {
+			return 0, fmt.Errorf("invalid state file version %q", v)
+		}
+	}
+	if from > to {
+		return 0, fmt.Errorf("state file version %d is newer than the supported version %d, downgrades are not supported", from, to)
+	}
+	for v := from; v < to; v++ {
+		if _, ok := ms.steps[v]; !ok {
+			return 0, fmt.Errorf("can't upgrade state file from version %d to %d: no migration from version %d", from, to, v)
+		}
+	}
+	return from, nil
+}
+
+// migrate upgrades the state file read by r, of the version recorded in
+// metadata, to version to. It fails if checkLocked does.
+func (ms *migrations) migrate(r wire.Reader, metadata map[string]string, to int) (wire.Reader, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	// Check for gaps before running anything.
+	from, err := ms.checkLocked(metadata, to)
+	if err != nil {
+		return nil, err
+	}
+	for v := from; v < to; v++ {
+		log.Infof("Migrating state file from version %d to %d", v, v+1)
+		if r, err = ms.steps[v](r, metadata); err != nil {
+			return nil, fmt.Errorf("migrating state file from version %d to %d: %w", v, v+1, err)
+		}
+		metadata[metadataVersion] = strconv.Itoa(v + 1)
+	}
+	return r, nil
+}
+
+// registered holds the migrations applied by LoadOpts.Load.
+var registered migrations
+
+// CheckVersion returns an error if a state file with the given metadata can't
+// be loaded because of its format version. It allows rejecting a state file
+// before anything is torn down to load it.
+func CheckVersion(metadata map[string]string) error {
+	registered.mu.Lock()
+	defer registered.mu.Unlock()
+	_, err := registered.checkLocked(metadata, Version)
+	return err
+}
+
+// RegisterMigration registers fn as the upgrade step of state files from
+// version from to from+1. It must be called at init time.
+func RegisterMigration(from int, fn MigrateFunc) {
+	registered.register(from, fn)
+}
+
+func init() {
+	// State files saved before versioning lack the fields added since. The
+	// size usage of tmpfs filesystems isn't saved, but recomputed from their
+	// files on load.
+	RegisterMigration(0, AddFields(
+		AddedField{Type: "pkg/sentry/fsimpl/tmpfs.filesystem", Name: "sizeLimit"},
+		AddedField{Type: "pkg/sentry/kernel.Kernel", Name: "readAhead"},
+		AddedField{Type: "pkg/sentry/kernel.Kernel", Name: "syncPolicies"},
+		AddedField{Type: "pkg/sentry/kernel.Kernel", Name: "schedLatency"},
+		AddedField{Type: "pkg/sentry/kernel.Kernel", Name: "syscallPolicies"},
+		AddedField{Type: "pkg/sentry/kernel.Task", Name: "oomKills"},
+		AddedField{Type: "pkg/sentry/kernel.Task", Name: "majorFault"},
+		AddedField{Type: "pkg/sentry/kernel.Task", Name: "involuntarySwitches"},
+		AddedField{Type: "pkg/sentry/kernel.Task", Name: "noNewPrivs"},
+		AddedField{Type: "pkg/sentry/kernel.threadGroupNode", Name: "coreDumping"},
+		AddedField{Type: "pkg/sentry/kernel/msgqueue.Registry", Name: "maxQueueBytes", Default: constant(wire.Uint(linux.MSGMNB))},
+		AddedField{Type: "pkg/sentry/kernel/msgqueue.Registry", Name: "maxMessageBytes", Default: constant(wire.Uint(linux.MSGMAX))},
+		AddedField{Type: "pkg/sentry/kernel/shm.Registry", Name: "maxSize", Default: constant(wire.Uint(linux.SHMMAX))},
+		AddedField{Type: "pkg/sentry/mm.AIOContext", Name: "cancelGen"},
+		AddedField{Type: "pkg/sentry/mm.MemoryManager", Name: "minorFaults"},
+		AddedField{Type: "pkg/sentry/mm.MemoryManager", Name: "majorFaults"},
+		AddedField{Type: "pkg/sentry/usage.CPUStats", Name: "InvoluntarySwitches"},
+		// The connections in the table were tracked iff the tables were
+		// modified, and none of them were removed from it.
+		AddedField{Type: "pkg/tcpip/stack.IPTables", Name: "tracking", Default: func(obj *SavedObject) wire.Object {
+			if modified, ok := obj.Field("modified").(wire.Bool); ok && bool(modified) {
+				return wire.Uint(1)
+			}
+			return nil
+		}},
+		AddedField{Type: "pkg/tcpip/stack.ConnTrack", Name: "count", Default: func(obj *SavedObject) wire.Object {
+			return wire.Int(obj.Referrers("pkg/tcpip/stack.conn", "ct"))
+		}},
+		AddedField{Type: "pkg/tcpip/stack.ConnTrack", Name: "limit"},
+		AddedField{Type: "pkg/tcpip/stack.ConnTrack", Name: "limitPolicy"},
+		AddedField{Type: "pkg/tcpip/stack.ConnTrack", Name: "lru"},
+		AddedField{Type: "pkg/tcpip/stack.conn", Name: "removed"},
+		AddedField{Type: "pkg/tcpip/stack.conn", Name: "connEntry"},
+		AddedField{Type: "pkg/tcpip/stack.conn", Name: "inLRU"},
+	))
+}
+
+// constant returns an AddedField.Default function returning v.
+func constant(v wire.Object) func(*SavedObject) wire.Object {
+	return func(*SavedObject) wire.Object {
+		return v
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2018 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/state/statefile"
+	"gvisor.dev/gvisor/pkg/state/wire"
+)
+
+// writeStateFile returns a state file with the given metadata and payload.
+func writeStateFile(t *testing.T, metadata map[string]string, payload string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := statefile.NewWriter(&buf, nil, metadata)
+	if err != nil {
+		t.Fatalf("statefile.NewWriter() failed: %v", err)
+	}
+	if _, err := w.Write([]byte(payload)); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// upper is a migration that changes the payload to upper case.
+func upper(r wire.Reader, _ map[string]string) (wire.Reader, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return bufio.NewReader(bytes.NewReader(bytes.ToUpper(b))), nil
+}
+
+func TestMigrate(t *testing.T) {
+	// Simulate a state file saved by an older version, whose payload must be
+	// upper cased to be loaded by version 2.
+	file := writeStateFile(t, map[string]string{metadataVersion: "1"}, "old state")
+	r, m, err := statefile.NewReader(bytes.NewReader(file), nil)
+	if err != nil {
+		t.Fatalf("statefile.NewReader() failed: %v", err)
+	}
+
+	var ms migrations
+	ms.register(1, upper)
+	r, err = ms.migrate(r, m, 2)
+	if err != nil {
+		t.Fatalf("migrate() failed: %v", err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll() failed: %v", err)
+	}
+	if want := "OLD STATE"; string(got) != want {
+		t.Errorf("migrated payload got: %q, want: %q", got, want)
+	}
+	if got := m[metadataVersion]; got != "2" {
+		t.Errorf("migrated version got: %q, want: %q", got, "2")
+	}
+}
+
+func TestMigrateErrors(t *testing.T) {
+	var ms migrations
+	ms.register(1, upper)
+
+	for _, tc := range []struct {
+		name     string
+		metadata map[string]string
+		want     string
+	}{
+		{
+			name:     "downgrade",
+			metadata: map[string]string{metadataVersion: "3"},
+			want:     "downgrades are not supported",
+		},
+		{
+			name:     "gap",
+			metadata: map[string]string{},
+			want:     "no migration from version 0",
+		},
+		{
+			name:     "invalid",
+			metadata: map[string]string{metadataVersion: "foo"},
+			want:     "invalid state file version",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			file := writeStateFile(t, tc.metadata, "state")
+			r, m, err := statefile.NewReader(bytes.NewReader(file), nil)
+			if err != nil {
+				t.Fatalf("statefile.NewReader() failed: %v", err)
+			}
+			if _, err := ms.migrate(r, m, 2); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("migrate() got error: %v, want: %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestMigrateRegistered(t *testing.T) {
+	// State files saved before versioning must still load.
+	file := writeStateFile(t, nil, "state")
+	r, m, err := statefile.NewReader(bytes.NewReader(file), nil)
+	if err != nil {
+		t.Fatalf("statefile.NewReader() failed: %v", err)
+	}
+	if _, err := registered.migrate(r, m, Version); err != nil {
+		t.Errorf("migrate() of unversioned state file failed: %v", err)
+	}
+}
+
+func TestCheckVersion(t *testing.T) {
+	if err := CheckVersion(map[string]string{}); err != nil {
+		t.Errorf("CheckVersion() of unversioned state file failed: %v", err)
+	}
+	if err := CheckVersion(map[string]string{metadataVersion: strconv.Itoa(Version)}); err != nil {
+		t.Errorf("CheckVersion() of current state file failed: %v", err)
+	}
+	if err := CheckVersion(map[string]string{metadataVersion: strconv.Itoa(Version + 1)}); err == nil || !strings.Contains(err.Error(), "downgrades are not supported") {
+		t.Errorf("CheckVersion() of newer state file got error: %v, want: downgrades are not supported", err)
+	}
+}
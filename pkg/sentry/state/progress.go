@@ -0,0 +1,175 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// progressInterval is how often the progress of a save is reported.
+var progressInterval = time.Second
+
+// progressQueueLen is the number of progress lines queued for writing. Lines
+// reported while the queue is full are dropped.
+const progressQueueLen = 8
+
+// saveProgress reports the progress of a save to out periodically, as lines
+// like:
+//
+//	phase=memory bytes=1048576 pages=4096
+//
+// where bytes is the number of bytes written to the destination and pages is
+// the number of memory pages written out. The last line has phase "done", or
+// "failed" followed by the error.
+//
+// Lines are written to out by a separate goroutine, so that a reader that
+// doesn't keep up, e.g. a full pipe, never delays the save. Lines that can't
+// be queued are dropped instead.
+//
+// saveProgress is also an io.Writer that forwards writes to the destination
+// to count the bytes written.
+type saveProgress struct {
+	out  io.Writer
+	dest io.Writer
+
+	// lines queues the lines to be written to out. It's closed by finish.
+	lines chan string
+
+	// written is closed once all lines have been written to out, or
+	// dropped.
+	written chan struct{}
+
+	// stop is closed to stop the reporting goroutine, which closes done
+	// once it exits.
+	stop chan struct{}
+	done chan struct{}
+
+	mu    sync.Mutex
+	phase string
+	pages uint64
+	bytes uint64
+}
+
+// newSaveProgress starts reporting the progress of a save to dest to out.
+// The caller must call finish once the save completes.
+func newSaveProgress(out, dest io.Writer) *saveProgress {
+	p := &saveProgress{
+		out:     out,
+		dest:    dest,
+		lines:   make(chan string, progressQueueLen),
+		written: make(chan struct{}),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		phase:   "pause",
+	}
+	go p.write()
+	go p.run()
+	return p
+}
+
+// Write implements io.Writer.Write.
+func (p *saveProgress) Write(b []byte) (int, error) {
+	n, err := p.dest.Write(b)
+	p.mu.Lock()
+	p.bytes += uint64(n)
+	p.mu.Unlock()
+	return n, err
+}
+
+// update implements kernel.SaveProgressFunc.
+func (p *saveProgress) update(phase string, pages uint64) {
+	p.mu.Lock()
+	p.phase = phase
+	p.pages = pages
+	p.mu.Unlock()
+}
+
+// finish stops the periodic reports and reports the result of the save. It
+// doesn't wait for the lines to be written to out.
+func (p *saveProgress) finish(err error) {
+	close(p.stop)
+	<-p.done
+	if err != nil {
+		p.report("failed", fmt.Sprintf(" error=%q", err.Error()), true /* last */)
+	} else {
+		p.report("done", "", true /* last */)
+	}
+	close(p.lines)
+}
+
+func (p *saveProgress) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	p.report("", "", false /* last */)
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.report("", "", false /* last */)
+		}
+	}
+}
+
+// report queues a progress line, with phase overriding the current phase if
+// it's not empty, followed by suffix. If the queue is full, the line is
+// dropped, unless it's the last line, which replaces the oldest queued line
+// instead.
+func (p *saveProgress) report(phase, suffix string, last bool) {
+	p.mu.Lock()
+	if phase != "" {
+		p.phase = phase
+	}
+	line := fmt.Sprintf("phase=%s bytes=%d pages=%d%s\n", p.phase, p.bytes, p.pages, suffix)
+	p.mu.Unlock()
+
+	for {
+		select {
+		case p.lines <- line:
+			return
+		default:
+		}
+		if !last {
+			return
+		}
+		select {
+		case <-p.lines:
+		default:
+		}
+	}
+}
+
+// write writes the queued lines to out until lines is closed.
+func (p *saveProgress) write() {
+	defer close(p.written)
+	failed := false
+	for line := range p.lines {
+		if failed {
+			continue
+		}
+		// Progress is only informational, so failing to report it doesn't
+		// fail the save.
+		if _, err := io.WriteString(p.out, line); err != nil {
+			log.Warningf("Failed to report save progress: %v", err)
+			failed = true
+		}
+	}
+}
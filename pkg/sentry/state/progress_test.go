@@ -0,0 +1,113 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSaveProgress(t *testing.T) {
+	// Only report the first and last lines.
+	defer func(d time.Duration) { progressInterval = d }(progressInterval)
+	progressInterval = time.Hour
+
+	for _, tc := range []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "success",
+			want: "phase=done bytes=5 pages=2",
+		},
+		{
+			name: "failure",
+			err:  errors.New("no space"),
+			want: `phase=failed bytes=5 pages=2 error="no space"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var out, dest bytes.Buffer
+			p := newSaveProgress(&out, &dest)
+			if _, err := p.Write([]byte("hello")); err != nil {
+				t.Fatalf("Write() failed: %v", err)
+			}
+			p.update("memory", 2)
+			p.finish(tc.err)
+			<-p.written
+
+			if got := dest.String(); got != "hello" {
+				t.Errorf("destination got: %q, want: %q", got, "hello")
+			}
+			// The first line is reported when the save starts.
+			lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+			if len(lines) != 2 {
+				t.Fatalf("progress got: %q, want 2 lines", out.String())
+			}
+			if lines[1] != tc.want {
+				t.Errorf("last line got: %q, want: %q", lines[1], tc.want)
+			}
+		})
+	}
+}
+
+// blockingWriter blocks writes until release is closed.
+type blockingWriter struct {
+	release chan struct{}
+	buf     bytes.Buffer
+}
+
+func (w *blockingWriter) Write(b []byte) (int, error) {
+	<-w.release
+	return w.buf.Write(b)
+}
+
+func TestSaveProgressBlockedOutput(t *testing.T) {
+	defer func(d time.Duration) { progressInterval = d }(progressInterval)
+	progressInterval = time.Millisecond
+
+	out := &blockingWriter{release: make(chan struct{})}
+	var dest bytes.Buffer
+	p := newSaveProgress(out, &dest)
+	// Let many more lines than can be queued be reported.
+	time.Sleep(100 * progressInterval * progressQueueLen)
+
+	finished := make(chan struct{})
+	go func() {
+		p.finish(nil)
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("finish() blocked on the progress output")
+	}
+
+	close(out.release)
+	<-p.written
+	// Lines were dropped while the output was blocked, but the last line
+	// got through.
+	lines := strings.Split(strings.TrimSuffix(out.buf.String(), "\n"), "\n")
+	if len(lines) > progressQueueLen+1 {
+		t.Errorf("got %d lines, want at most %d", len(lines), progressQueueLen+1)
+	}
+	if want := "phase=done bytes=0 pages=0"; lines[len(lines)-1] != want {
+		t.Errorf("last line got: %q, want: %q", lines[len(lines)-1], want)
+	}
+}
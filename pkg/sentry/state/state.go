@@ -54,12 +54,29 @@ type SaveOpts struct {
 	// Metadata is save metadata.
 	Metadata map[string]string
 
+	// Compression selects how the state is compressed. If empty,
+	// statefile.CompressionBestSpeed is used.
+	Compression statefile.Compression
+
+	// Progress, if not nil, receives periodic progress lines while the state
+	// is saved, see saveProgress.
+	Progress io.Writer
+
 	// Callback is called prior to unpause, with any save error.
 	Callback func(err error)
 }
 
 // Save saves the system state.
 func (opts SaveOpts) Save(ctx context.Context, k *kernel.Kernel, w *watchdog.Watchdog) error {
+	dest := opts.Destination
+	var progress *saveProgress
+	var progressFn kernel.SaveProgressFunc
+	if opts.Progress != nil {
+		progress = newSaveProgress(opts.Progress, opts.Destination)
+		dest = progress
+		progressFn = progress.update
+	}
+
 	log.Infof("Sandbox save started, pausing all tasks.")
 	k.Pause()
 	k.ReceiveTaskStates()
@@ -78,12 +95,12 @@ func (opts SaveOpts) Save(ctx context.Context, k *kernel.Kernel, w *watchdog.Wat
 	addSaveMetadata(opts.Metadata)
 
 	// Open the statefile.
-	wc, err := statefile.NewWriter(opts.Destination, opts.Key, opts.Metadata)
+	wc, err := statefile.NewWriterCompression(dest, opts.Key, opts.Metadata, opts.Compression)
 	if err != nil {
 		err = ErrStateFile{err}
 	} else {
 		// Save the kernel.
-		err = k.SaveTo(ctx, wc)
+		err = k.SaveToProgress(ctx, wc, progressFn)
 
 		// ENOSPC is a state file error. This error can only come from
 		// writing the state file, and not from fs.FileOperations.Fsync
@@ -96,6 +113,9 @@ func (opts SaveOpts) Save(ctx context.Context, k *kernel.Kernel, w *watchdog.Wat
 			err = ErrStateFile{closeErr}
 		}
 	}
+	if progress != nil {
+		progress.finish(err)
+	}
 	opts.Callback(err)
 	return err
 }
@@ -119,6 +139,12 @@ func (opts LoadOpts) Load(ctx context.Context, k *kernel.Kernel, timeReady chan
 
 	previousMetadata = m
 
+	// Bring state files saved by older versions to the current format.
+	r, err = registered.migrate(r, m, Version)
+	if err != nil {
+		return ErrStateFile{err}
+	}
+
 	// Restore the Kernel object graph.
 	return k.LoadFrom(ctx, r, timeReady, n, clocks, vfsOpts)
 }
@@ -19,6 +19,7 @@ package state
 
 import (
 	"fmt"
+	"strconv"
 	"time"
 
 	"gvisor.dev/gvisor/pkg/log"
@@ -45,4 +46,5 @@ func addSaveMetadata(m map[string]string) {
 	m[cpuUsage] = t.String()
 
 	m[metadataTimestamp] = fmt.Sprintf("%v", time.Now())
+	m[metadataVersion] = strconv.Itoa(Version)
 }
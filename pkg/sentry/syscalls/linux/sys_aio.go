@@ -220,7 +220,7 @@ func IoCancel(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Sysc
 
 // LINT.IfChange
 
-func getAIOCallback(t *kernel.Task, file *fs.File, cbAddr hostarch.Addr, cb *linux.IOCallback, ioseq usermem.IOSequence, actx *mm.AIOContext, eventFile *fs.File) kernel.AIOCallback {
+func getAIOCallback(t *kernel.Task, file *fs.File, cbAddr hostarch.Addr, cb *linux.IOCallback, ioseq usermem.IOSequence, actx *mm.AIOContext, gen uint64, eventFile *fs.File) kernel.AIOCallback {
 	return func(ctx context.Context) {
 		if actx.Dead() {
 			actx.CancelPendingRequest()
@@ -232,15 +232,20 @@ func getAIOCallback(t *kernel.Task, file *fs.File, cbAddr hostarch.Addr, cb *lin
 		}
 
 		var err error
-		switch cb.OpCode {
-		case linux.IOCB_CMD_PREAD, linux.IOCB_CMD_PREADV:
-			ev.Result, err = file.Preadv(ctx, ioseq, cb.Offset)
-		case linux.IOCB_CMD_PWRITE, linux.IOCB_CMD_PWRITEV:
-			ev.Result, err = file.Pwritev(ctx, ioseq, cb.Offset)
-		case linux.IOCB_CMD_FSYNC:
-			err = file.Fsync(ctx, 0, fs.FileMaxOffset, fs.SyncAll)
-		case linux.IOCB_CMD_FDSYNC:
-			err = file.Fsync(ctx, 0, fs.FileMaxOffset, fs.SyncData)
+		if actx.Canceled(gen) {
+			// The request was canceled before it started executing.
+			ev.Result = -int64(kernel.ExtractErrno(linuxerr.ECANCELED, 0))
+		} else {
+			switch cb.OpCode {
+			case linux.IOCB_CMD_PREAD, linux.IOCB_CMD_PREADV:
+				ev.Result, err = file.Preadv(ctx, ioseq, cb.Offset)
+			case linux.IOCB_CMD_PWRITE, linux.IOCB_CMD_PWRITEV:
+				ev.Result, err = file.Pwritev(ctx, ioseq, cb.Offset)
+			case linux.IOCB_CMD_FSYNC:
+				err = file.Fsync(ctx, 0, fs.FileMaxOffset, fs.SyncAll)
+			case linux.IOCB_CMD_FDSYNC:
+				err = file.Fsync(ctx, 0, fs.FileMaxOffset, fs.SyncData)
+			}
 		}
 
 		// Update the result.
@@ -308,6 +313,7 @@ func submitCallback(t *kernel.Task, id uint64, cb *linux.IOCallback, cbAddr host
 	if !ok {
 		return linuxerr.EINVAL
 	}
+	gen := ctx.CancelGeneration()
 	if err := ctx.Prepare(); err != nil {
 		return err
 	}
@@ -322,7 +328,7 @@ func submitCallback(t *kernel.Task, id uint64, cb *linux.IOCallback, cbAddr host
 
 	// Perform the request asynchronously.
 	file.IncRef()
-	t.QueueAIO(getAIOCallback(t, file, cbAddr, cb, ioseq, ctx, eventFile))
+	t.QueueAIO(getAIOCallback(t, file, cbAddr, cb, ioseq, ctx, gen, eventFile))
 
 	// All set.
 	return nil
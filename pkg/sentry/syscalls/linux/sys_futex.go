@@ -58,6 +58,7 @@ func futexWaitAbsolute(t *kernel.Task, clockRealtime bool, ts linux.Timespec, fo
 		return 0, err
 	}
 
+	start := t.FutexWaitBegin()
 	if forever {
 		err = t.Block(w.C)
 	} else if clockRealtime {
@@ -72,6 +73,7 @@ func futexWaitAbsolute(t *kernel.Task, clockRealtime bool, ts linux.Timespec, fo
 	} else {
 		err = t.BlockWithDeadline(w.C, true, ktime.FromTimespec(ts))
 	}
+	t.FutexWaitEnd(start)
 
 	t.Futex().WaitComplete(w, t)
 	return 0, linuxerr.ConvertIntr(err, linuxerr.ERESTARTSYS)
@@ -94,7 +96,9 @@ func futexWaitDuration(t *kernel.Task, duration time.Duration, forever bool, add
 		return 0, err
 	}
 
+	start := t.FutexWaitBegin()
 	remaining, err := t.BlockWithTimeout(w.C, !forever, duration)
+	t.FutexWaitEnd(start)
 	t.Futex().WaitComplete(w, t)
 	if err == nil {
 		return 0, nil
@@ -135,6 +139,7 @@ func futexLockPI(t *kernel.Task, ts linux.Timespec, forever bool, addr hostarch.
 		return nil
 	}
 
+	start := t.FutexWaitBegin()
 	if forever {
 		err = t.Block(w.C)
 	} else {
@@ -147,6 +152,7 @@ func futexLockPI(t *kernel.Task, ts linux.Timespec, forever bool, addr hostarch.
 		err = t.BlockWithTimer(w.C, tchan)
 		timer.Destroy()
 	}
+	t.FutexWaitEnd(start)
 
 	t.Futex().WaitComplete(w, t)
 	return linuxerr.ConvertIntr(err, linuxerr.ERESTARTSYS)
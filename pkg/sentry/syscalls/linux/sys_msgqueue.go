@@ -50,7 +50,8 @@ func Msgsnd(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscal
 	size := args[2].Int64()
 	flag := args[3].Int()
 
-	if size < 0 || size > linux.MSGMAX {
+	r := t.IPCNamespace().MsgqueueRegistry()
+	if size < 0 || uint64(size) > r.MaxMessageBytes() {
 		return 0, nil, linuxerr.EINVAL
 	}
 
@@ -64,7 +65,7 @@ func Msgsnd(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscal
 		return 0, nil, err
 	}
 
-	queue, err := t.IPCNamespace().MsgqueueRegistry().FindByID(id)
+	queue, err := r.FindByID(id)
 	if err != nil {
 		return 0, nil, err
 	}
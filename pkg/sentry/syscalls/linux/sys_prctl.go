@@ -162,15 +162,19 @@ func Prctl(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.Syscall
 		if args[1].Int() != 1 || args[2].Int() != 0 || args[3].Int() != 0 || args[4].Int() != 0 {
 			return 0, nil, linuxerr.EINVAL
 		}
-		// PR_SET_NO_NEW_PRIVS is assumed to always be set.
-		// See kernel.Task.updateCredsForExecLocked.
+		// Execve behaves as if no_new_privs is always set, see
+		// kernel.Task.updateCredsForExecLocked.
+		t.SetNoNewPrivs()
 		return 0, nil, nil
 
 	case linux.PR_GET_NO_NEW_PRIVS:
 		if args[1].Int() != 0 || args[2].Int() != 0 || args[3].Int() != 0 || args[4].Int() != 0 {
 			return 0, nil, linuxerr.EINVAL
 		}
-		return 1, nil, nil
+		if t.NoNewPrivs() {
+			return 1, nil, nil
+		}
+		return 0, nil, nil
 
 	case linux.PR_SET_PTRACER:
 		pid := args[1].Int()
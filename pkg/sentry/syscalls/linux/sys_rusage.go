@@ -46,6 +46,7 @@ func getrusage(t *kernel.Task, which int32) linux.Rusage {
 		UTime:  linux.NsecToTimeval(cs.UserTime.Nanoseconds()),
 		STime:  linux.NsecToTimeval(cs.SysTime.Nanoseconds()),
 		NVCSw:  int64(cs.VoluntarySwitches),
+		NIvCSw: int64(cs.InvoluntarySwitches),
 		MaxRSS: int64(t.MaxRSS(which) / 1024),
 	}
 }
@@ -99,3 +99,22 @@ func SchedGetPriorityMax(t *kernel.Task, args arch.SyscallArguments) (uintptr, *
 func SchedGetPriorityMin(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	return onlyPriority, nil, nil
 }
+
+// SchedRRGetInterval implements linux syscall sched_rr_get_interval(2).
+func SchedRRGetInterval(t *kernel.Task, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	pid := args[0].Int()
+	addr := args[1].Pointer()
+	if pid < 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	target := t
+	if pid != 0 {
+		if target = t.PIDNamespace().TaskWithID(kernel.ThreadID(pid)); target == nil {
+			return 0, nil, linuxerr.ESRCH
+		}
+	}
+	// Report the timeslice configured for the target's container.
+	timeslice := t.Kernel().SchedLatency(target.ContainerID()).Timeslice
+	ts := linux.NsecToTimespec(timeslice.Nanoseconds())
+	return 0, nil, copyTimespecOut(t, addr, &ts)
+}
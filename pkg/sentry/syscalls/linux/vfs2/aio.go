@@ -131,6 +131,7 @@ func submitCallback(t *kernel.Task, id uint64, cb *linux.IOCallback, cbAddr host
 	if !ok {
 		return linuxerr.EINVAL
 	}
+	gen := aioCtx.CancelGeneration()
 	if err := aioCtx.Prepare(); err != nil {
 		return err
 	}
@@ -145,11 +146,11 @@ func submitCallback(t *kernel.Task, id uint64, cb *linux.IOCallback, cbAddr host
 
 	// Perform the request asynchronously.
 	fd.IncRef()
-	t.QueueAIO(getAIOCallback(t, fd, eventFD, cbAddr, cb, ioseq, aioCtx))
+	t.QueueAIO(getAIOCallback(t, fd, eventFD, cbAddr, cb, ioseq, aioCtx, gen))
 	return nil
 }
 
-func getAIOCallback(t *kernel.Task, fd, eventFD *vfs.FileDescription, cbAddr hostarch.Addr, cb *linux.IOCallback, ioseq usermem.IOSequence, aioCtx *mm.AIOContext) kernel.AIOCallback {
+func getAIOCallback(t *kernel.Task, fd, eventFD *vfs.FileDescription, cbAddr hostarch.Addr, cb *linux.IOCallback, ioseq usermem.IOSequence, aioCtx *mm.AIOContext, gen uint64) kernel.AIOCallback {
 	return func(ctx context.Context) {
 		// Release references after completing the callback.
 		defer fd.DecRef(ctx)
@@ -167,13 +168,18 @@ func getAIOCallback(t *kernel.Task, fd, eventFD *vfs.FileDescription, cbAddr hos
 		}
 
 		var err error
-		switch cb.OpCode {
-		case linux.IOCB_CMD_PREAD, linux.IOCB_CMD_PREADV:
-			ev.Result, err = fd.PRead(ctx, ioseq, cb.Offset, vfs.ReadOptions{})
-		case linux.IOCB_CMD_PWRITE, linux.IOCB_CMD_PWRITEV:
-			ev.Result, err = fd.PWrite(ctx, ioseq, cb.Offset, vfs.WriteOptions{})
-		case linux.IOCB_CMD_FSYNC, linux.IOCB_CMD_FDSYNC:
-			err = fd.Sync(ctx)
+		if aioCtx.Canceled(gen) {
+			// The request was canceled before it started executing.
+			ev.Result = -int64(kernel.ExtractErrno(linuxerr.ECANCELED, 0))
+		} else {
+			switch cb.OpCode {
+			case linux.IOCB_CMD_PREAD, linux.IOCB_CMD_PREADV:
+				ev.Result, err = fd.PRead(ctx, ioseq, cb.Offset, vfs.ReadOptions{})
+			case linux.IOCB_CMD_PWRITE, linux.IOCB_CMD_PWRITEV:
+				ev.Result, err = fd.PWrite(ctx, ioseq, cb.Offset, vfs.WriteOptions{})
+			case linux.IOCB_CMD_FSYNC, linux.IOCB_CMD_FDSYNC:
+				err = fd.Sync(ctx)
+			}
 		}
 
 		// Update the result.
@@ -33,9 +33,11 @@ type CPUStats struct {
 	// ceded due to blocking, etc.
 	VoluntarySwitches uint64
 
-	// InvoluntarySwitches (struct rusage::ru_nivcsw) is unsupported, since
-	// "preemptive" scheduling is managed by the Go runtime, which doesn't
-	// provide this information.
+	// InvoluntarySwitches is the number of times control was taken away
+	// because the timeslice was over while other tasks waited for a CPU.
+	// Preemption by the Go runtime isn't counted, as it doesn't provide this
+	// information.
+	InvoluntarySwitches uint64
 }
 
 // Accumulate adds s2 to s.
@@ -43,6 +45,7 @@ func (s *CPUStats) Accumulate(s2 CPUStats) {
 	s.UserTime += s2.UserTime
 	s.SysTime += s2.SysTime
 	s.VoluntarySwitches += s2.VoluntarySwitches
+	s.InvoluntarySwitches += s2.InvoluntarySwitches
 }
 
 // DifferenceSince computes s - earlierSample.
@@ -50,8 +53,9 @@ func (s *CPUStats) Accumulate(s2 CPUStats) {
 // Precondition: s >= earlierSample.
 func (s *CPUStats) DifferenceSince(earlierSample CPUStats) CPUStats {
 	return CPUStats{
-		UserTime:          s.UserTime - earlierSample.UserTime,
-		SysTime:           s.SysTime - earlierSample.SysTime,
-		VoluntarySwitches: s.VoluntarySwitches - earlierSample.VoluntarySwitches,
+		UserTime:            s.UserTime - earlierSample.UserTime,
+		SysTime:             s.SysTime - earlierSample.SysTime,
+		VoluntarySwitches:   s.VoluntarySwitches - earlierSample.VoluntarySwitches,
+		InvoluntarySwitches: s.InvoluntarySwitches - earlierSample.InvoluntarySwitches,
 	}
 }
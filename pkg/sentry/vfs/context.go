@@ -27,8 +27,30 @@ const (
 
 	// CtxRoot is a Context.Value key for a VFS root.
 	CtxRoot
+
+	// CtxReadAheadSize is a Context.Value key for the maximum number of bytes
+	// that filesystems may read ahead when filling their page cache, as a
+	// uint64.
+	CtxReadAheadSize
+
+	// CtxSyncPolicy is a Context.Value key for the SyncPolicy applied to
+	// fsync and fdatasync.
+	CtxSyncPolicy
 )
 
+// DefaultReadAheadSize is the read-ahead window used when the context doesn't
+// specify one.
+const DefaultReadAheadSize = 64 << 10 // 64 KB, chosen arbitrarily
+
+// ReadAheadSizeFromContext returns the read-ahead window used by ctx, or
+// DefaultReadAheadSize if ctx doesn't specify one.
+func ReadAheadSizeFromContext(ctx context.Context) uint64 {
+	if v := ctx.Value(CtxReadAheadSize); v != nil {
+		return v.(uint64)
+	}
+	return DefaultReadAheadSize
+}
+
 // MountNamespaceFromContext returns the MountNamespace used by ctx. If ctx is
 // not associated with a MountNamespace, MountNamespaceFromContext returns nil.
 //
@@ -15,6 +15,8 @@
 package vfs
 
 import (
+	"sort"
+
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/context"
 	"gvisor.dev/gvisor/pkg/errors/linuxerr"
@@ -129,6 +131,45 @@ func (vfs *VirtualFilesystem) NewEpollInstanceFD(ctx context.Context) (*FileDesc
 	return &ep.vfsfd, nil
 }
 
+// EpollInterestInfo describes a file descriptor registered with an
+// EpollInstance.
+type EpollInterestInfo struct {
+	// FD is the file descriptor number with which the file was registered.
+	FD int32 `json:"fd"`
+
+	// Events is the registered event mask, including flags EPOLLET and
+	// EPOLLONESHOT.
+	Events uint32 `json:"events"`
+
+	// Data is the struct epoll_event::data associated with the
+	// registration.
+	Data [2]int32 `json:"data"`
+
+	// Ready is true if the file may be ready for I/O, i.e. it is checked by
+	// the next epoll_wait(2).
+	Ready bool `json:"ready"`
+}
+
+// Interests returns the file descriptors registered with ep, sorted by file
+// descriptor number.
+func (ep *EpollInstance) Interests() []EpollInterestInfo {
+	ep.interestMu.Lock()
+	defer ep.interestMu.Unlock()
+	ep.readyMu.Lock()
+	defer ep.readyMu.Unlock()
+	infos := make([]EpollInterestInfo, 0, len(ep.interest))
+	for key, epi := range ep.interest {
+		infos = append(infos, EpollInterestInfo{
+			FD:     key.num,
+			Events: epi.mask,
+			Data:   epi.userData,
+			Ready:  epi.ready,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].FD < infos[j].FD })
+	return infos
+}
+
 // Release implements FileDescriptionImpl.Release.
 func (ep *EpollInstance) Release(ctx context.Context) {
 	// Unregister all polled fds.
@@ -0,0 +1,75 @@
+// Copyright 2019 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfs
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/context"
+)
+
+// SyncPolicy determines how filesystems backed by a remote server handle
+// fsync(2) and fdatasync(2), trading durability for performance.
+type SyncPolicy uint32
+
+const (
+	// SyncDurable writes cached data back to the remote file and syncs it, so
+	// that it is durable on the host once the syscall returns. This is the
+	// default.
+	SyncDurable SyncPolicy = iota
+
+	// SyncRelaxed writes cached data back to the remote file without syncing
+	// it. The data is visible to other users of the remote file, but may be
+	// lost if the host crashes.
+	SyncRelaxed
+
+	// SyncNone makes fsync and fdatasync no-ops. Cached data is only written
+	// back when it's evicted or on sync(2) and syncfs(2), and may be lost if the
+	// sandbox or the host crashes.
+	SyncNone
+)
+
+// String implements fmt.Stringer.
+func (p SyncPolicy) String() string {
+	switch p {
+	case SyncDurable:
+		return "durable"
+	case SyncRelaxed:
+		return "relaxed"
+	case SyncNone:
+		return "none"
+	default:
+		return fmt.Sprintf("SyncPolicy(%d)", uint32(p))
+	}
+}
+
+// ParseSyncPolicy parses a SyncPolicy from its string representation.
+func ParseSyncPolicy(s string) (SyncPolicy, error) {
+	for _, p := range []SyncPolicy{SyncDurable, SyncRelaxed, SyncNone} {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid sync policy %q, must be 'durable', 'relaxed' or 'none'", s)
+}
+
+// SyncPolicyFromContext returns the SyncPolicy used by ctx, or SyncDurable if
+// ctx doesn't specify one.
+func SyncPolicyFromContext(ctx context.Context) SyncPolicy {
+	if v := ctx.Value(CtxSyncPolicy); v != nil {
+		return v.(SyncPolicy)
+	}
+	return SyncDurable
+}
@@ -32,6 +32,7 @@ package watchdog
 import (
 	"bytes"
 	"fmt"
+	"sort"
 	"time"
 
 	"gvisor.dev/gvisor/pkg/abi/linux"
@@ -124,9 +125,17 @@ func (a Action) String() string {
 // Watchdog is the main watchdog class. It controls a goroutine that periodically
 // analyses all tasks and reports if any of them appear to be stuck.
 type Watchdog struct {
-	// Configuration options are embedded.
+	// Configuration options are embedded. TaskTimeout and TaskTimeoutAction
+	// may be changed by SetTaskConfig, so they must be read with mu or
+	// configMu held once the watchdog has been created.
 	Opts
 
+	// configMu protects TaskTimeout, TaskTimeoutAction and period. They're
+	// only changed with both mu and configMu held, so holding either is
+	// enough to read them. The loop only takes configMu, as Stop holds mu
+	// while waiting for the loop to exit.
+	configMu sync.Mutex
+
 	// period indicates how often to check all tasks. It's calculated based on
 	// opts.TaskTimeout.
 	period time.Duration
@@ -150,6 +159,17 @@ type Watchdog struct {
 	// lastRun is set to the last time the watchdog executed a monitoring loop.
 	lastRun ktime.Time
 
+	// statusMu protects fired and suspects. Like configMu, it may be taken
+	// with mu held, but mu must not be taken with it held.
+	statusMu sync.Mutex
+
+	// fired is the number of times an action has been taken.
+	fired uint64
+
+	// suspects are the tasks that had been running in the sentry for longer
+	// than period at the last check.
+	suspects []SuspectTask
+
 	// mu protects the fields below.
 	mu sync.Mutex
 
@@ -165,6 +185,42 @@ type offender struct {
 	lastUpdateTime ktime.Time
 }
 
+// SuspectTask is a task that may be stuck.
+type SuspectTask struct {
+	// TID is the ID of the task in the root PID namespace.
+	TID kernel.ThreadID `json:"tid"`
+
+	// RunningFor is how long the task had been running in the sentry without
+	// blocking at the last check.
+	RunningFor time.Duration `json:"runningFor"`
+
+	// Stuck is true if RunningFor exceeds the task timeout, in which case the
+	// action has been taken for the task.
+	Stuck bool `json:"stuck"`
+}
+
+// Status is the state of the watchdog, see Watchdog.Status.
+type Status struct {
+	// TaskTimeout is the task timeout. It's 0 if it's disabled.
+	TaskTimeout time.Duration `json:"taskTimeout"`
+
+	// Action is taken when a task exceeds TaskTimeout.
+	Action Action `json:"action"`
+
+	// Running is true if the watchdog is checking tasks.
+	Running bool `json:"running"`
+
+	// Fired is the number of times an action has been taken since the
+	// watchdog was created, for stuck tasks, a stuck watchdog or a late
+	// start.
+	Fired uint64 `json:"fired"`
+
+	// Suspects are the tasks that had been running in the sentry without
+	// blocking for more than a quarter of TaskTimeout at the last check,
+	// sorted by TID.
+	Suspects []SuspectTask `json:"suspects"`
+}
+
 // New creates a new watchdog.
 func New(k *kernel.Kernel, opts Opts) *Watchdog {
 	// 4 is arbitrary, just don't want to prolong 'TaskTimeout' too much.
@@ -210,12 +266,9 @@ func (w *Watchdog) Start() {
 
 // Stop requests the watchdog to stop and wait for it.
 func (w *Watchdog) Stop() {
-	if w.TaskTimeout == 0 {
-		return
-	}
-
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	// The watchdog doesn't run if the task timeout is disabled.
 	if !w.running {
 		return
 	}
@@ -226,6 +279,61 @@ func (w *Watchdog) Stop() {
 	log.Infof("Watchdog stopped")
 }
 
+// TaskConfig returns the task timeout and the action taken when it's exceeded.
+func (w *Watchdog) TaskConfig() (time.Duration, Action) {
+	w.configMu.Lock()
+	defer w.configMu.Unlock()
+	return w.TaskTimeout, w.TaskTimeoutAction
+}
+
+// SetTaskConfig sets the task timeout and the action taken when it's exceeded.
+// The new timeout applies from the next check on, while a check in progress
+// completes with the previous configuration. If the task timeout was disabled
+// and Start has been called, the watchdog starts running.
+func (w *Watchdog) SetTaskConfig(timeout time.Duration, action Action) error {
+	if timeout <= 0 {
+		return fmt.Errorf("task timeout must be positive, got %v", timeout)
+	}
+	if action != LogWarning && action != Panic {
+		return fmt.Errorf("invalid watchdog action: %d", action)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.configMu.Lock()
+	w.TaskTimeout = timeout
+	w.TaskTimeoutAction = action
+	// See New.
+	w.period = timeout / 4
+	w.configMu.Unlock()
+	log.Infof("Watchdog configured, period: %v, timeout: %v, action: %v", w.period, timeout, action)
+
+	if w.startCalled && !w.running {
+		w.lastRun = w.k.MonotonicClock().Now()
+		go w.loop() // S/R-SAFE: watchdog is stopped during save and restarted after restore.
+		w.running = true
+	}
+	return nil
+}
+
+// Status returns the state of the watchdog. It doesn't wait for a check in
+// progress.
+func (w *Watchdog) Status() Status {
+	w.mu.Lock()
+	status := Status{
+		TaskTimeout: w.TaskTimeout,
+		Action:      w.TaskTimeoutAction,
+		Running:     w.running,
+	}
+	w.mu.Unlock()
+
+	w.statusMu.Lock()
+	defer w.statusMu.Unlock()
+	status.Fired = w.fired
+	status.Suspects = append([]SuspectTask(nil), w.suspects...)
+	return status
+}
+
 // waitForStart waits for Start to be called and takes action if it does not
 // happen within the startup timeout.
 func (w *Watchdog) waitForStart() {
@@ -248,11 +356,15 @@ func (w *Watchdog) waitForStart() {
 func (w *Watchdog) loop() {
 	// Loop until someone stops it.
 	for {
+		w.configMu.Lock()
+		period := w.period
+		w.configMu.Unlock()
+
 		select {
 		case <-w.stop:
 			w.done <- struct{}{}
 			return
-		case <-time.After(w.period):
+		case <-time.After(period):
 			w.runTurn()
 		}
 	}
@@ -260,6 +372,12 @@ func (w *Watchdog) loop() {
 
 // runTurn runs a single pass over all tasks and reports anything it finds.
 func (w *Watchdog) runTurn() {
+	// Use the same configuration for the whole turn, even if it changes
+	// meanwhile.
+	w.configMu.Lock()
+	timeout, action, period := w.TaskTimeout, w.TaskTimeoutAction, w.period
+	w.configMu.Unlock()
+
 	// Someone needs to watch the watchdog. The call below can get stuck if there
 	// is a deadlock affecting root's PID namespace mutex. Run it in a goroutine
 	// and report if it takes too long to return.
@@ -272,10 +390,10 @@ func (w *Watchdog) runTurn() {
 
 	select {
 	case <-done:
-	case <-time.After(w.TaskTimeout):
+	case <-time.After(timeout):
 		// Report if the watchdog is not making progress.
 		// No one is watching the watchdog watcher though.
-		w.reportStuckWatchdog()
+		w.reportStuckWatchdog(action)
 		<-done
 	}
 
@@ -288,12 +406,13 @@ func (w *Watchdog) runTurn() {
 	// since the last time the watchdog run. If the watchdog detects that scheduling
 	// is off, it will discount the entire duration since last run from 'lastUpdateTime'.
 	discount := time.Duration(0)
-	if now.Sub(w.lastRun.Add(w.period)) > descheduleThreshold {
+	if now.Sub(w.lastRun.Add(period)) > descheduleThreshold {
 		discount = now.Sub(w.lastRun)
 	}
 	w.lastRun = now
 
 	log.Infof("Watchdog starting loop, tasks: %d, discount: %v", len(tasks), discount)
+	var suspects []SuspectTask
 	for _, t := range tasks {
 		tsched := t.TaskGoroutineSchedInfo()
 
@@ -301,7 +420,14 @@ func (w *Watchdog) runTurn() {
 		if tsched.State == kernel.TaskGoroutineRunningSys {
 			lastUpdateTime := ktime.FromNanoseconds(int64(tsched.Timestamp * uint64(linux.ClockTick)))
 			elapsed := now.Sub(lastUpdateTime) - discount
-			if elapsed > w.TaskTimeout {
+			if elapsed > period {
+				suspects = append(suspects, SuspectTask{
+					TID:        w.k.TaskSet().Root.IDOfTask(t),
+					RunningFor: elapsed,
+					Stuck:      elapsed > timeout,
+				})
+			}
+			if elapsed > timeout {
 				tc, ok := w.offenders[t]
 				if !ok {
 					// New stuck task detected.
@@ -317,8 +443,13 @@ func (w *Watchdog) runTurn() {
 			}
 		}
 	}
+	sort.Slice(suspects, func(i, j int) bool { return suspects[i].TID < suspects[j].TID })
+	w.statusMu.Lock()
+	w.suspects = suspects
+	w.statusMu.Unlock()
+
 	if len(newOffenders) > 0 {
-		w.report(newOffenders, newTaskFound, now)
+		w.report(newOffenders, newTaskFound, now, action)
 	}
 
 	// Remember which tasks have been reported.
@@ -326,7 +457,7 @@ func (w *Watchdog) runTurn() {
 }
 
 // report takes appropriate action when a stuck task is detected.
-func (w *Watchdog) report(offenders map[*kernel.Task]*offender, newTaskFound bool, now ktime.Time) {
+func (w *Watchdog) report(offenders map[*kernel.Task]*offender, newTaskFound bool, now ktime.Time, action Action) {
 	var buf bytes.Buffer
 	buf.WriteString(fmt.Sprintf("Sentry detected %d stuck task(s):\n", len(offenders)))
 	for t, o := range offenders {
@@ -336,19 +467,23 @@ func (w *Watchdog) report(offenders map[*kernel.Task]*offender, newTaskFound boo
 	buf.WriteString("Search for 'goroutine <id>' in the stack dump to find the offending goroutine(s)")
 
 	// Force stack dump only if a new task is detected.
-	w.doAction(w.TaskTimeoutAction, newTaskFound, &buf)
+	w.doAction(action, newTaskFound, &buf)
 }
 
-func (w *Watchdog) reportStuckWatchdog() {
+func (w *Watchdog) reportStuckWatchdog(action Action) {
 	var buf bytes.Buffer
 	buf.WriteString("Watchdog goroutine is stuck")
-	w.doAction(w.TaskTimeoutAction, false, &buf)
+	w.doAction(action, false, &buf)
 }
 
 // doAction will take the given action. If the action is LogWarning, the stack
 // is not always dumped to the log to prevent log flooding. "forceStack"
 // guarantees that the stack will be dumped regardless.
 func (w *Watchdog) doAction(action Action, forceStack bool, msg *bytes.Buffer) {
+	w.statusMu.Lock()
+	w.fired++
+	w.statusMu.Unlock()
+
 	switch action {
 	case LogWarning:
 		// Dump stack only if forced or sometime has passed since the last time a
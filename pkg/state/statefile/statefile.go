@@ -40,7 +40,11 @@
 // not be provided by the user. In the future, this metadata may contain some
 // information relating to the state encoding itself.
 //
-// After the map, the remainder of the file is the state data.
+// After the map, the remainder of the file is the state data. It's split in
+// chunks that are each DEFLATE-compressed at the level selected by the
+// Compression passed to NewWriterCompression, which is recorded in the
+// "_compression" metadata key. Readers handle any level, so the compression
+// doesn't need to be known to restore.
 package statefile
 
 import (
@@ -84,6 +88,54 @@ var ErrInvalidMetadataLength = fmt.Errorf("metadata length invalid, maximum size
 // ErrMetadataInvalid is returned if passed metadata is invalid.
 var ErrMetadataInvalid = fmt.Errorf("metadata invalid, can't start with _")
 
+// Compression selects how the state data is compressed.
+type Compression string
+
+const (
+	// CompressionBestSpeed compresses the data at the fastest DEFLATE
+	// level. It's the default: the best compression level usually reduces
+	// the file size only a little, for much more CPU usage at save time.
+	CompressionBestSpeed Compression = "best-speed"
+
+	// CompressionBestSize compresses the data at the best DEFLATE level, for
+	// the smallest file.
+	CompressionBestSize Compression = "best-size"
+
+	// CompressionNone stores the data in uncompressed DEFLATE blocks. It's
+	// the fastest to save and restore, but the file is the largest.
+	CompressionNone Compression = "none"
+)
+
+// ErrInvalidCompression is returned if the compression is unknown.
+var ErrInvalidCompression = fmt.Errorf("invalid compression, must be one of %q, %q or %q", CompressionBestSpeed, CompressionBestSize, CompressionNone)
+
+// ParseCompression parses a compression name. The empty string means the
+// default, CompressionBestSpeed.
+func ParseCompression(s string) (Compression, error) {
+	c := Compression(s)
+	if _, err := c.level(); err != nil {
+		return "", err
+	}
+	if c == "" {
+		c = CompressionBestSpeed
+	}
+	return c, nil
+}
+
+// level returns the flate compression level for c.
+func (c Compression) level() (int, error) {
+	switch c {
+	case "", CompressionBestSpeed:
+		return flate.BestSpeed, nil
+	case CompressionBestSize:
+		return flate.BestCompression, nil
+	case CompressionNone:
+		return flate.NoCompression, nil
+	default:
+		return 0, ErrInvalidCompression
+	}
+}
+
 // WriteCloser is an io.Closer and wire.Writer.
 type WriteCloser interface {
 	wire.Writer
@@ -97,10 +149,17 @@ func writeMetadataLen(w io.Writer, val uint64) error {
 	return err
 }
 
-// NewWriter returns a state data writer for a statefile.
+// NewWriter returns a state data writer for a statefile, compressed with
+// CompressionBestSpeed.
 //
 // Note that the returned WriteCloser must be closed.
 func NewWriter(w io.Writer, key []byte, metadata map[string]string) (WriteCloser, error) {
+	return NewWriterCompression(w, key, metadata, CompressionBestSpeed)
+}
+
+// NewWriterCompression is like NewWriter, but compresses the state data as
+// selected by compression. The empty compression means CompressionBestSpeed.
+func NewWriterCompression(w io.Writer, key []byte, metadata map[string]string, compression Compression) (WriteCloser, error) {
 	if metadata == nil {
 		metadata = make(map[string]string)
 	}
@@ -109,6 +168,11 @@ func NewWriter(w io.Writer, key []byte, metadata map[string]string) (WriteCloser
 			return nil, ErrMetadataInvalid
 		}
 	}
+	compression, err := ParseCompression(string(compression))
+	if err != nil {
+		return nil, err
+	}
+	level, _ := compression.level()
 
 	// Create our HMAC function.
 	h := hmac.New(sha256.New, key)
@@ -122,6 +186,8 @@ func NewWriter(w io.Writer, key []byte, metadata map[string]string) (WriteCloser
 	// Generate a timestamp, for convenience only.
 	metadata["_timestamp"] = time.Now().UTC().String()
 	defer delete(metadata, "_timestamp")
+	metadata["_compression"] = string(compression)
+	defer delete(metadata, "_compression")
 
 	// Write the metadata.
 	b, err := json.Marshal(metadata)
@@ -152,11 +218,8 @@ func NewWriter(w io.Writer, key []byte, metadata map[string]string) (WriteCloser
 		}
 	}
 
-	// Wrap in compression. We always use "best speed" mode here. When using
-	// "best compression" mode, there is usually only a little gain in file
-	// size reduction, which translate to even smaller gain in restore
-	// latency reduction, while inccuring much more CPU usage at save time.
-	return compressio.NewWriter(w, key, compressionChunkSize, flate.BestSpeed)
+	// Wrap in compression.
+	return compressio.NewWriter(w, key, compressionChunkSize, level)
 }
 
 // MetadataUnsafe reads out the metadata from a state file without verifying any
@@ -163,9 +163,65 @@ func TestStatefile(t *testing.T) {
 	}
 }
 
+func TestCompression(t *testing.T) {
+	// Use random base64 data, which is marginally compressible.
+	var data bytes.Buffer
+	enc := base64.NewEncoder(base64.RawStdEncoding, &data)
+	if _, err := io.CopyN(enc, rand.New(rand.NewSource(0)), 3*compressionChunkSize); err != nil {
+		t.Fatalf("unable to seed random data: %v", err)
+	}
+	enc.Close()
+
+	sizes := make(map[Compression]int)
+	for _, c := range []Compression{CompressionBestSpeed, CompressionBestSize, CompressionNone} {
+		t.Run(string(c), func(t *testing.T) {
+			var bufEncoded bytes.Buffer
+			w, err := NewWriterCompression(&bufEncoded, nil, nil, c)
+			if err != nil {
+				t.Fatalf("error creating writer: got %v, expected nil", err)
+			}
+			if _, err := w.Write(data.Bytes()); err != nil {
+				t.Fatalf("error during write: got %v, expected nil", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("error during close: got %v, expected nil", err)
+			}
+			sizes[c] = bufEncoded.Len()
+
+			r, metadata, err := NewReader(bytes.NewReader(bufEncoded.Bytes()), nil)
+			if err != nil {
+				t.Fatalf("error creating reader: got %v, expected nil", err)
+			}
+			if got := metadata["_compression"]; got != string(c) {
+				t.Errorf("compression metadata: got %q, expected %q", got, c)
+			}
+			var bufDecoded bytes.Buffer
+			if _, err := io.Copy(&bufDecoded, r); err != nil {
+				t.Fatalf("error during read: got %v, expected nil", err)
+			}
+			if !bytes.Equal(data.Bytes(), bufDecoded.Bytes()) {
+				t.Fatalf("data didn't match (%d vs %d bytes)", bufDecoded.Len(), data.Len())
+			}
+		})
+	}
+	if sizes[CompressionNone] <= sizes[CompressionBestSpeed] || sizes[CompressionBestSpeed] < sizes[CompressionBestSize] {
+		t.Errorf("unexpected encoded sizes: %v", sizes)
+	}
+
+	if _, err := NewWriterCompression(&bytes.Buffer{}, nil, nil, "zip"); err != ErrInvalidCompression {
+		t.Errorf("unknown compression: got %v, expected ErrInvalidCompression", err)
+	}
+}
+
 const benchmarkDataSize = 100 * 1024 * 1024
 
 func benchmark(b *testing.B, size int, write bool, compressible bool) {
+	benchmarkCompression(b, size, write, compressible, CompressionBestSpeed)
+}
+
+// benchmarkCompression is like benchmark, but uses the given compression and
+// reports the ratio of the state file size to the data size.
+func benchmarkCompression(b *testing.B, size int, write bool, compressible bool, compression Compression) {
 	b.StopTimer()
 	b.SetBytes(benchmarkDataSize)
 
@@ -198,7 +254,7 @@ func benchmark(b *testing.B, size int, write bool, compressible bool) {
 	var stateBuf bytes.Buffer
 	writeState := func() {
 		stateBuf.Reset()
-		w, err := NewWriter(&stateBuf, key, nil)
+		w, err := NewWriterCompression(&stateBuf, key, nil, compression)
 		if err != nil {
 			b.Fatalf("error creating writer: %v", err)
 		}
@@ -238,6 +294,7 @@ func benchmark(b *testing.B, size int, write bool, compressible bool) {
 	// Generate the state once without timing to ensure that buffers have
 	// been appropriately allocated.
 	writeState()
+	b.ReportMetric(float64(stateBuf.Len())/float64(len(source)), "ratio")
 	if write {
 		b.StartTimer()
 		for i := 0; i < b.N; i++ {
@@ -285,6 +342,22 @@ func BenchmarkRead1MNoncompressible(b *testing.B) {
 	benchmark(b, 1024*1024, false, false)
 }
 
+func BenchmarkWrite1MNoncompressibleBestSize(b *testing.B) {
+	benchmarkCompression(b, 1024*1024, true, false, CompressionBestSize)
+}
+
+func BenchmarkWrite1MNoncompressibleNone(b *testing.B) {
+	benchmarkCompression(b, 1024*1024, true, false, CompressionNone)
+}
+
+func BenchmarkRead1MNoncompressibleBestSize(b *testing.B) {
+	benchmarkCompression(b, 1024*1024, false, false, CompressionBestSize)
+}
+
+func BenchmarkRead1MNoncompressibleNone(b *testing.B) {
+	benchmarkCompression(b, 1024*1024, false, false, CompressionNone)
+}
+
 func init() {
 	runtime.GOMAXPROCS(runtime.NumCPU())
 }
@@ -169,6 +169,20 @@ type conn struct {
 	//
 	// +checklocks:stateMu
 	lastUsed tcpip.MonotonicTime
+
+	// removed is set once the connection's original tuple is removed from the
+	// table.
+	//
+	// +checkatomics
+	removed uint32
+
+	// connEntry links the connection in ConnTrack.lru. It is protected by
+	// ct.limitMu.
+	connEntry
+	// inLRU is whether the connection is in ConnTrack.lru.
+	//
+	// +checklocks:ct.limitMu
+	inLRU bool
 }
 
 // timedOut returns whether the connection timed out based on its state.
@@ -245,6 +259,30 @@ type ConnTrack struct {
 	//
 	// +checklocks:mu
 	buckets []bucket
+
+	// count is the number of connections in the table, including timed out
+	// ones that haven't been reaped yet.
+	//
+	// +checkatomics
+	count int64
+
+	// limit is the maximum number of connections in the table, or 0 if
+	// unlimited.
+	//
+	// +checkatomics
+	limit int64
+
+	// limitPolicy holds the ConntrackLimitPolicy applied once limit is hit.
+	//
+	// +checkatomics
+	limitPolicy int32
+
+	limitMu sync.Mutex `state:"nosave"`
+	// lru holds the connections in the table from least to most recently
+	// used while limit is set.
+	//
+	// +checklocks:limitMu
+	lru connList
 }
 
 // +stateify savable
@@ -506,6 +544,7 @@ func (ct *ConnTrack) init() {
 	ct.mu.Lock()
 	defer ct.mu.Unlock()
 	ct.buckets = make([]bucket, numBuckets)
+	atomic.StoreInt64(&ct.count, 0)
 }
 
 // getConnAndUpdate attempts to get a connection or creates one if no
@@ -513,14 +552,16 @@ func (ct *ConnTrack) init() {
 //
 // If the packet's protocol is trackable, the connection's state is updated to
 // match the contents of the packet.
-func (ct *ConnTrack) getConnAndUpdate(pkt *PacketBuffer) *tuple {
+//
+// It returns false if the packet must be dropped because the table is full.
+func (ct *ConnTrack) getConnAndUpdate(pkt *PacketBuffer) (*tuple, bool) {
 	// Get or (maybe) create a connection.
-	t := func() *tuple {
+	t, ok := func() (*tuple, bool) {
 		var allowNewConn bool
 		tid, res := getTupleID(pkt)
 		switch res {
 		case getTupleIDNotOK:
-			return nil
+			return nil, true
 		case getTupleIDOKAndAllowNewConn:
 			allowNewConn = true
 		case getTupleIDOKAndDontAllowNewConn:
@@ -537,11 +578,18 @@ func (ct *ConnTrack) getConnAndUpdate(pkt *PacketBuffer) *tuple {
 
 		now := ct.clock.NowMonotonic()
 		if t := bkt.connForTID(tid, now); t != nil {
-			return t
+			ct.touchConn(t.conn)
+			return t, true
 		}
 
 		if !allowNewConn {
-			return nil
+			return nil, true
+		}
+
+		// Make room for the new connection before locking the bucket, as
+		// evicting a connection locks the buckets of its tuples.
+		if !ct.reserveConn() {
+			return nil, false
 		}
 
 		bkt.mu.Lock()
@@ -550,7 +598,8 @@ func (ct *ConnTrack) getConnAndUpdate(pkt *PacketBuffer) *tuple {
 		// Make sure a connection wasn't added between when we last checked the
 		// bucket and acquired the bucket's write lock.
 		if t := bkt.connForTIDRLocked(tid, now); t != nil {
-			return t
+			ct.releaseConn()
+			return t, true
 		}
 
 		// This is the first packet we're seeing for the connection. Create an entry
@@ -575,12 +624,13 @@ func (ct *ConnTrack) getConnAndUpdate(pkt *PacketBuffer) *tuple {
 		//
 		// See (*conn).finalize.
 		bkt.tuples.PushFront(&conn.original)
-		return &conn.original
+		ct.trackConn(conn)
+		return &conn.original, true
 	}()
 	if t != nil {
 		t.conn.update(pkt, t.reply)
 	}
-	return t
+	return t, ok
 }
 
 func (ct *ConnTrack) connForTID(tid tupleID) *tuple {
@@ -648,7 +698,9 @@ func (ct *ConnTrack) finalize(cn *conn) finalizeResult {
 	bkt := &buckets[id]
 	bkt.mu.Lock()
 	defer bkt.mu.Unlock()
-	bkt.tuples.Remove(&cn.original)
+	if bkt.removeTupleLocked(&cn.original) {
+		ct.connRemoved(cn)
+	}
 	return finalizeResultConflict
 }
 
@@ -1070,6 +1122,9 @@ func (ct *ConnTrack) reapTupleLocked(reapingTuple *tuple, bktID int, bkt *bucket
 	}
 
 	bkt.tuples.Remove(reapingTuple)
+	// Either reapingTuple is the original tuple, or the original tuple is
+	// removed below.
+	ct.connRemoved(reapingTuple.conn)
 
 	if !replyTupleInserted {
 		// The other tuple is the reply which has not yet been inserted.
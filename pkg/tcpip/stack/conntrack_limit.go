@@ -0,0 +1,264 @@
+// Copyright 2021 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stack
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+)
+
+// ConntrackLimitPolicy determines what happens to new connections once the
+// connection tracking table is full.
+type ConntrackLimitPolicy int32
+
+const (
+	// ConntrackDropNew drops packets that would create a new connection.
+	ConntrackDropNew ConntrackLimitPolicy = iota
+
+	// ConntrackEvictOldest stops tracking the least recently used connection
+	// to make room for the new one.
+	ConntrackEvictOldest
+)
+
+// String implements fmt.Stringer.
+func (p ConntrackLimitPolicy) String() string {
+	switch p {
+	case ConntrackDropNew:
+		return "drop-new"
+	case ConntrackEvictOldest:
+		return "evict-oldest"
+	default:
+		return fmt.Sprintf("ConntrackLimitPolicy(%d)", int32(p))
+	}
+}
+
+// setLimit sets the maximum number of connections in the table and what
+// happens to new connections once it's hit. A limit of 0 removes the limit.
+// Lowering the limit below the current count doesn't remove connections
+// right away; new connections are handled according to policy until enough
+// connections are reaped.
+//
+// Precondition: calls to setLimit are serialized.
+func (ct *ConnTrack) setLimit(limit int, policy ConntrackLimitPolicy) {
+	wasLimited := atomic.LoadInt64(&ct.limit) != 0
+	atomic.StoreInt32(&ct.limitPolicy, int32(policy))
+	atomic.StoreInt64(&ct.limit, int64(limit))
+	if limit == 0 {
+		ct.limitMu.Lock()
+		for cn := ct.lru.Front(); cn != nil; cn = ct.lru.Front() {
+			ct.lru.Remove(cn)
+			cn.inLRU = false
+		}
+		ct.limitMu.Unlock()
+		return
+	}
+	if wasLimited {
+		return
+	}
+
+	// Connections created from now on are added to the back of lru, add the
+	// existing ones in front of them.
+	existing := ct.conns()
+	lastUsed := make(map[*conn]tcpip.MonotonicTime, len(existing))
+	for _, cn := range existing {
+		cn.stateMu.RLock()
+		lastUsed[cn] = cn.lastUsed
+		cn.stateMu.RUnlock()
+	}
+	sort.Slice(existing, func(i, j int) bool {
+		return lastUsed[existing[i]].Before(lastUsed[existing[j]])
+	})
+	ct.limitMu.Lock()
+	defer ct.limitMu.Unlock()
+	for i := len(existing) - 1; i >= 0; i-- {
+		if cn := existing[i]; !cn.inLRU && !cn.isRemoved() {
+			ct.lru.PushFront(cn)
+			cn.inLRU = true
+		}
+	}
+}
+
+// connCount returns the number of connections in the table.
+func (ct *ConnTrack) connCount() int {
+	return int(atomic.LoadInt64(&ct.count))
+}
+
+// conns returns the connections in the table.
+func (ct *ConnTrack) conns() []*conn {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+	var conns []*conn
+	for i := range ct.buckets {
+		bkt := &ct.buckets[i]
+		bkt.mu.RLock()
+		for t := bkt.tuples.Front(); t != nil; t = t.Next() {
+			if !t.reply {
+				conns = append(conns, t.conn)
+			}
+		}
+		bkt.mu.RUnlock()
+	}
+	return conns
+}
+
+// reserveConn makes room for a new connection in the table, evicting the
+// least recently used connection if the policy allows it. It returns false if
+// the new connection must be dropped.
+//
+// Precondition: no bucket lock is held.
+func (ct *ConnTrack) reserveConn() bool {
+	limit := atomic.LoadInt64(&ct.limit)
+	if limit == 0 {
+		atomic.AddInt64(&ct.count, 1)
+		return true
+	}
+	for {
+		if count := atomic.LoadInt64(&ct.count); count < limit {
+			if atomic.CompareAndSwapInt64(&ct.count, count, count+1) {
+				return true
+			}
+			continue
+		}
+		if ConntrackLimitPolicy(atomic.LoadInt32(&ct.limitPolicy)) != ConntrackEvictOldest {
+			return false
+		}
+		if !ct.evictOldest() {
+			return false
+		}
+	}
+}
+
+// releaseConn gives back a reservation made by reserveConn that wasn't used.
+func (ct *ConnTrack) releaseConn() {
+	atomic.AddInt64(&ct.count, -1)
+}
+
+// connRemoved must be called once cn's original tuple is removed from the
+// table.
+func (ct *ConnTrack) connRemoved(cn *conn) {
+	if !atomic.CompareAndSwapUint32(&cn.removed, 0, 1) {
+		return
+	}
+	atomic.AddInt64(&ct.count, -1)
+	ct.limitMu.Lock()
+	defer ct.limitMu.Unlock()
+	if cn.inLRU {
+		ct.lru.Remove(cn)
+		cn.inLRU = false
+	}
+}
+
+func (cn *conn) isRemoved() bool {
+	return atomic.LoadUint32(&cn.removed) != 0
+}
+
+// trackConn records that cn was just created, so it can be evicted later.
+func (ct *ConnTrack) trackConn(cn *conn) {
+	if atomic.LoadInt64(&ct.limit) == 0 {
+		return
+	}
+	ct.limitMu.Lock()
+	defer ct.limitMu.Unlock()
+	if !cn.inLRU && !cn.isRemoved() {
+		ct.lru.PushBack(cn)
+		cn.inLRU = true
+	}
+}
+
+// touchConn records that cn was just used, making it the last connection to
+// be evicted.
+func (ct *ConnTrack) touchConn(cn *conn) {
+	if atomic.LoadInt64(&ct.limit) == 0 {
+		return
+	}
+	ct.limitMu.Lock()
+	defer ct.limitMu.Unlock()
+	if cn.inLRU && ct.lru.Back() != cn {
+		ct.lru.Remove(cn)
+		ct.lru.PushBack(cn)
+	}
+}
+
+// evictOldest removes the least recently used finalized connection from the
+// table. It returns false if there's no connection to evict.
+//
+// Precondition: no bucket lock is held.
+func (ct *ConnTrack) evictOldest() bool {
+	var cn *conn
+	ct.limitMu.Lock()
+	// Connections that aren't finalized yet may only have their original
+	// tuple in the table, leave them be. They were just created, so they are
+	// at the back of the list.
+	for c := ct.lru.Front(); c != nil; c = c.Next() {
+		if c.getFinalizeResult() == finalizeResultSuccess {
+			cn = c
+			ct.lru.Remove(cn)
+			cn.inLRU = false
+			break
+		}
+	}
+	ct.limitMu.Unlock()
+
+	if cn == nil {
+		return false
+	}
+	ct.removeConn(cn)
+	return true
+}
+
+// removeConn removes cn's tuples from the table.
+func (ct *ConnTrack) removeConn(cn *conn) {
+	ct.mu.RLock()
+	defer ct.mu.RUnlock()
+
+	origID := ct.bucket(cn.original.id())
+	replyID := ct.bucket(cn.reply.id())
+	origBkt := &ct.buckets[origID]
+	replyBkt := &ct.buckets[replyID]
+
+	// Lock the buckets in table order.
+	first, second := origBkt, replyBkt
+	if origID > replyID {
+		first, second = replyBkt, origBkt
+	}
+	first.mu.Lock()
+	defer first.mu.Unlock()
+	if second != first {
+		second.mu.Lock()
+		defer second.mu.Unlock()
+	}
+
+	if origBkt.removeTupleLocked(&cn.original) {
+		ct.connRemoved(cn)
+	}
+	replyBkt.removeTupleLocked(&cn.reply)
+}
+
+// removeTupleLocked removes t from the bucket, and returns whether it was
+// there.
+//
+// +checklocks:bkt.mu
+func (bkt *bucket) removeTupleLocked(t *tuple) bool {
+	for other := bkt.tuples.Front(); other != nil; other = other.Next() {
+		if other == t {
+			bkt.tuples.Remove(t)
+			return true
+		}
+	}
+	return false
+}
@@ -16,6 +16,7 @@ package stack
 
 import (
 	"testing"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/buffer"
@@ -44,7 +45,7 @@ func TestReap(t *testing.T) {
 	// the connection won't be considered established. Thus the timeout for
 	// reaping is unestablishedTimeout.
 	pkt1 := genTCPPacket(genTCPOpts{})
-	pkt1.tuple = ct.getConnAndUpdate(pkt1)
+	pkt1.tuple, _ = ct.getConnAndUpdate(pkt1)
 	if pkt1.tuple.conn.handlePacket(pkt1, Output, &rt) {
 		t.Fatal("handlePacket() shouldn't perform any NAT")
 	}
@@ -54,7 +55,7 @@ func TestReap(t *testing.T) {
 	// lastUsed, but per #6748 didn't.
 	clock.Advance(unestablishedTimeout / 2)
 	pkt2 := genTCPPacket(genTCPOpts{})
-	pkt2.tuple = ct.getConnAndUpdate(pkt2)
+	pkt2.tuple, _ = ct.getConnAndUpdate(pkt2)
 	if pkt2.tuple.conn.handlePacket(pkt2, Output, &rt) {
 		t.Fatal("handlePacket() shouldn't perform any NAT")
 	}
@@ -73,6 +74,116 @@ func TestReap(t *testing.T) {
 	ct.checkNumTuples(t, 0)
 }
 
+func TestConntrackLimit(t *testing.T) {
+	// Initialize conntrack.
+	clock := faketime.NewManualClock()
+	ct := ConnTrack{
+		clock: clock,
+	}
+	ct.init()
+	ct.setLimit(2, ConntrackDropNew)
+
+	// We set rt.routeInfo.Loop to avoid a panic when handlePacket calls
+	// rt.RequiresTXTransportChecksum.
+	var rt Route
+	rt.routeInfo.Loop = PacketLoop
+
+	// newConn sends a SYN from srcPort through the Output and Postrouting
+	// hooks, and returns the connection it created.
+	newConn := func(srcPort uint16) (*conn, bool) {
+		t.Helper()
+		pkt := genTCPPacket(genTCPOpts{srcPort: &srcPort})
+		tuple, ok := ct.getConnAndUpdate(pkt)
+		if !ok {
+			return nil, false
+		}
+		if tuple.conn.handlePacket(pkt, Output, &rt) {
+			t.Fatal("handlePacket() shouldn't perform any NAT")
+		}
+		tuple.conn.finalize()
+		return tuple.conn, true
+	}
+
+	first, ok := newConn(1000)
+	if !ok {
+		t.Fatalf("first connection was dropped")
+	}
+	clock.Advance(time.Second)
+	second, ok := newConn(1001)
+	if !ok {
+		t.Fatalf("second connection was dropped")
+	}
+	ct.checkNumTuples(t, 4)
+
+	// The table is full, new connections are dropped.
+	clock.Advance(time.Second)
+	if _, ok := newConn(1002); ok {
+		t.Errorf("connection over the limit wasn't dropped")
+	}
+	if got := ct.connCount(); got != 2 {
+		t.Errorf("connCount() = %d, want 2", got)
+	}
+	ct.checkNumTuples(t, 4)
+
+	// Packets of existing connections are still accepted, and make their
+	// connection the most recently used one.
+	srcPort := uint16(1000)
+	if tuple, ok := ct.getConnAndUpdate(genTCPPacket(genTCPOpts{srcPort: &srcPort})); !ok || tuple.conn != first {
+		t.Errorf("packet of existing connection got tuple %v, ok: %t", tuple, ok)
+	}
+
+	// With evict-oldest, new connections replace the least recently used
+	// one.
+	ct.setLimit(2, ConntrackEvictOldest)
+	third, ok := newConn(1002)
+	if !ok {
+		t.Fatalf("connection over the limit was dropped with %v", ConntrackEvictOldest)
+	}
+	if got := ct.connCount(); got != 2 {
+		t.Errorf("connCount() = %d, want 2", got)
+	}
+	ct.checkNumTuples(t, 4)
+	if !second.isRemoved() {
+		t.Errorf("least recently used connection wasn't evicted")
+	}
+	if first.isRemoved() {
+		t.Errorf("recently used connection was evicted")
+	}
+	ct.checkLRU(t, first, third)
+
+	// Evicted connections don't stay in the list.
+	if _, ok := newConn(1003); !ok {
+		t.Fatalf("connection over the limit was dropped with %v", ConntrackEvictOldest)
+	}
+	if !first.isRemoved() {
+		t.Errorf("least recently used connection wasn't evicted")
+	}
+	if got := ct.connCount(); got != 2 {
+		t.Errorf("connCount() = %d, want 2", got)
+	}
+
+	// Reaping connections decreases the count and removes them from the
+	// list.
+	clock.Advance(unestablishedTimeout * 2)
+	ct.reapEverything()
+	ct.checkNumTuples(t, 0)
+	if got := ct.connCount(); got != 0 {
+		t.Errorf("connCount() after reaping = %d, want 0", got)
+	}
+	ct.checkLRU(t)
+
+	// Removing the limit allows any number of connections.
+	ct.setLimit(0, ConntrackDropNew)
+	for port := uint16(2000); port < 2010; port++ {
+		if _, ok := newConn(port); !ok {
+			t.Fatalf("connection from port %d was dropped without a limit", port)
+		}
+	}
+	if got := ct.connCount(); got != 10 {
+		t.Errorf("connCount() = %d, want 10", got)
+	}
+}
+
 func TestWindowScaling(t *testing.T) {
 	tcs := []struct {
 		name        string
@@ -173,7 +284,7 @@ func testWindowScaling(t *testing.T, windowSize uint16, synScale, synAckScale ui
 		srcPort:     &originatorPort,
 		dstPort:     &responderPort,
 	})
-	synPkt.tuple = ct.getConnAndUpdate(synPkt)
+	synPkt.tuple, _ = ct.getConnAndUpdate(synPkt)
 	if synPkt.tuple.conn.handlePacket(synPkt, Output, &rt) {
 		t.Fatal("handlePacket() shouldn't perform any NAT")
 	}
@@ -205,7 +316,7 @@ func testWindowScaling(t *testing.T, windowSize uint16, synScale, synAckScale ui
 		srcPort:     &responderPort,
 		dstPort:     &originatorPort,
 	})
-	synAckPkt.tuple = ct.getConnAndUpdate(synAckPkt)
+	synAckPkt.tuple, _ = ct.getConnAndUpdate(synAckPkt)
 	if synAckPkt.tuple.conn.handlePacket(synAckPkt, Prerouting, &rt) {
 		t.Fatal("handlePacket() shouldn't perform any NAT")
 	}
@@ -236,7 +347,7 @@ func testWindowScaling(t *testing.T, windowSize uint16, synScale, synAckScale ui
 		srcPort:    &originatorPort,
 		dstPort:    &responderPort,
 	})
-	ackPkt.tuple = ct.getConnAndUpdate(ackPkt)
+	ackPkt.tuple, _ = ct.getConnAndUpdate(ackPkt)
 	if ackPkt.tuple.conn.handlePacket(ackPkt, Output, &rt) {
 		t.Fatal("handlePacket() shouldn't perform any NAT")
 	}
@@ -391,6 +502,25 @@ func (ct *ConnTrack) reapEverything() {
 	}
 }
 
+// checkLRU checks that the least recently used list holds want, in order.
+func (ct *ConnTrack) checkLRU(t *testing.T, want ...*conn) {
+	t.Helper()
+	ct.limitMu.Lock()
+	defer ct.limitMu.Unlock()
+	var got []*conn
+	for cn := ct.lru.Front(); cn != nil; cn = cn.Next() {
+		got = append(got, cn)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d connections in the LRU list, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("connection %d in the LRU list is %p, want %p", i, got[i], want[i])
+		}
+	}
+}
+
 func (cn *conn) checkOriginalSeq(t *testing.T, seq uint32) {
 	t.Helper()
 	cn.stateMu.Lock()
@@ -17,6 +17,7 @@ package stack
 import (
 	"fmt"
 	"math/rand"
+	"sync/atomic"
 	"time"
 
 	"gvisor.dev/gvisor/pkg/tcpip"
@@ -236,10 +237,7 @@ func (it *IPTables) ReplaceTable(id TableID, table Table, ipv6 bool) {
 	defer it.mu.Unlock()
 	// If iptables is being enabled, initialize the conntrack table and
 	// reaper.
-	if !it.modified {
-		it.connections.init()
-		it.startReaper(reaperDelay)
-	}
+	it.enableConntrackLocked()
 	it.modified = true
 	if ipv6 {
 		it.v6Tables[id] = table
@@ -297,6 +295,40 @@ func (it *IPTables) shouldSkipOrPopulateTables(tables []checkTable, pkt *PacketB
 	return false
 }
 
+// enableConntrackLocked initializes the conntrack table and reaper, unless
+// connections are already tracked.
+//
+// +checklocks:it.mu
+func (it *IPTables) enableConntrackLocked() {
+	if atomic.LoadUint32(&it.tracking) != 0 {
+		return
+	}
+	it.connections.init()
+	it.startReaper(reaperDelay)
+	atomic.StoreUint32(&it.tracking, 1)
+}
+
+// conntrackOnly returns whether pkt must be tracked by conntrack even though
+// IPTables is skipped, which is the case once a conntrack limit is set.
+func (it *IPTables) conntrackOnly(pkt *PacketBuffer) bool {
+	switch pkt.NetworkProtocolNumber {
+	case header.IPv4ProtocolNumber, header.IPv6ProtocolNumber:
+		return atomic.LoadUint32(&it.tracking) != 0
+	default:
+		return false
+	}
+}
+
+// finalizeConn finalizes the connection pkt belongs to, if it is tracked. It
+// returns false if the packet must be dropped.
+func finalizeConn(pkt *PacketBuffer) bool {
+	if t := pkt.tuple; t != nil {
+		pkt.tuple = nil
+		return t.conn.finalize()
+	}
+	return true
+}
+
 // CheckPrerouting performs the prerouting hook on the packet.
 //
 // Returns true iff the packet may continue traversing the stack; the packet
@@ -315,11 +347,20 @@ func (it *IPTables) CheckPrerouting(pkt *PacketBuffer, addressEP AddressableEndp
 		},
 	}
 
-	if it.shouldSkipOrPopulateTables(tables[:], pkt) {
+	skip := it.shouldSkipOrPopulateTables(tables[:], pkt)
+	if skip && !it.conntrackOnly(pkt) {
 		return true
 	}
 
-	pkt.tuple = it.connections.getConnAndUpdate(pkt)
+	tuple, ok := it.connections.getConnAndUpdate(pkt)
+	if !ok {
+		// The connection tracking table is full.
+		return false
+	}
+	pkt.tuple = tuple
+	if skip {
+		return true
+	}
 
 	for _, table := range tables {
 		if !table.fn(table.table, Prerouting, pkt, nil /* route */, addressEP, inNicName, "" /* outNicName */) {
@@ -349,7 +390,7 @@ func (it *IPTables) CheckInput(pkt *PacketBuffer, inNicName string) bool {
 	}
 
 	if it.shouldSkipOrPopulateTables(tables[:], pkt) {
-		return true
+		return finalizeConn(pkt)
 	}
 
 	for _, table := range tables {
@@ -358,11 +399,7 @@ func (it *IPTables) CheckInput(pkt *PacketBuffer, inNicName string) bool {
 		}
 	}
 
-	if t := pkt.tuple; t != nil {
-		pkt.tuple = nil
-		return t.conn.finalize()
-	}
-	return true
+	return finalizeConn(pkt)
 }
 
 // CheckForward performs the forward hook on the packet.
@@ -414,11 +451,20 @@ func (it *IPTables) CheckOutput(pkt *PacketBuffer, r *Route, outNicName string)
 		},
 	}
 
-	if it.shouldSkipOrPopulateTables(tables[:], pkt) {
+	skip := it.shouldSkipOrPopulateTables(tables[:], pkt)
+	if skip && !it.conntrackOnly(pkt) {
 		return true
 	}
 
-	pkt.tuple = it.connections.getConnAndUpdate(pkt)
+	tuple, ok := it.connections.getConnAndUpdate(pkt)
+	if !ok {
+		// The connection tracking table is full.
+		return false
+	}
+	pkt.tuple = tuple
+	if skip {
+		return true
+	}
 
 	for _, table := range tables {
 		if !table.fn(table.table, Output, pkt, r, nil /* addressEP */, "" /* inNicName */, outNicName) {
@@ -448,7 +494,7 @@ func (it *IPTables) CheckPostrouting(pkt *PacketBuffer, r *Route, addressEP Addr
 	}
 
 	if it.shouldSkipOrPopulateTables(tables[:], pkt) {
-		return true
+		return finalizeConn(pkt)
 	}
 
 	for _, table := range tables {
@@ -457,11 +503,7 @@ func (it *IPTables) CheckPostrouting(pkt *PacketBuffer, r *Route, addressEP Addr
 		}
 	}
 
-	if t := pkt.tuple; t != nil {
-		pkt.tuple = nil
-		return t.conn.finalize()
-	}
-	return true
+	return finalizeConn(pkt)
 }
 
 type checkTableFn func(table Table, hook Hook, pkt *PacketBuffer, r *Route, addressEP AddressableEndpoint, inNicName, outNicName string) bool
@@ -638,6 +680,33 @@ func (it *IPTables) checkRule(hook Hook, pkt *PacketBuffer, table Table, ruleIdx
 	return rule.Target.Action(pkt, hook, r, addressEP)
 }
 
+// SetConntrackLimit sets the maximum number of connections tracked by
+// conntrack, and what happens to packets creating new connections once it's
+// hit. A limit of 0 removes the limit. Setting a limit enables connection
+// tracking even if no iptables rules are installed, and connections remain
+// tracked after the limit is removed.
+func (it *IPTables) SetConntrackLimit(limit int, policy ConntrackLimitPolicy) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	if limit != 0 {
+		it.enableConntrackLocked()
+	}
+	it.connections.setLimit(limit, policy)
+}
+
+// ConntrackCount returns the number of connections tracked by conntrack.
+func (it *IPTables) ConntrackCount() int {
+	return it.connections.connCount()
+}
+
+// Modified returns whether the tables have been replaced, e.g. because
+// iptables rules were installed.
+func (it *IPTables) Modified() bool {
+	it.mu.RLock()
+	defer it.mu.RUnlock()
+	return it.modified
+}
+
 // OriginalDst returns the original destination of redirected connections. It
 // returns an error if the connection doesn't exist or isn't redirected.
 func (it *IPTables) OriginalDst(epID TransportEndpointID, netProto tcpip.NetworkProtocolNumber, transProto tcpip.TransportProtocolNumber) (tcpip.Address, uint16, tcpip.Error) {
@@ -321,6 +321,45 @@ func TestNATAlwaysPerformed(t *testing.T) {
 	}
 }
 
+// TestConntrackLimitWithoutRules tests that the conntrack limit is enforced
+// when no iptables rules are installed.
+func TestConntrackLimitWithoutRules(t *testing.T) {
+	clock := faketime.NewManualClock()
+	iptables := DefaultTables(clock, rand.New(rand.NewSource(0 /* seed */)))
+	iptables.SetConntrackLimit(1, ConntrackDropNew)
+	if iptables.Modified() {
+		t.Fatalf("SetConntrackLimit modified the tables")
+	}
+
+	// Output hook depends on a route but if the route is local, we don't
+	// need anything else from it.
+	r := Route{
+		routeInfo: routeInfo{
+			Loop: PacketLoop,
+		},
+	}
+	pkt := v6PacketBuffer()
+	if !iptables.CheckOutput(pkt, &r, "" /* outNicName */) {
+		t.Fatal("got iptables.CheckOutput(...) = false, want = true")
+	}
+	if !iptables.CheckPostrouting(pkt, &r, nil /* addressEP */, "" /* outNicName */) {
+		t.Fatal("got iptables.CheckPostrouting(...) = false, want = true")
+	}
+	if got := iptables.ConntrackCount(); got != 1 {
+		t.Errorf("got iptables.ConntrackCount() = %d, want = 1", got)
+	}
+
+	// The table is full, packets of new connections are dropped.
+	if iptables.CheckOutput(v6PacketBufferWithSrcAddr(testutil.MustParse6("d::4")), &r, "" /* outNicName */) {
+		t.Error("got iptables.CheckOutput(...) = true for a new connection over the limit, want = false")
+	}
+
+	// Packets of the existing connection are still accepted.
+	if !iptables.CheckOutput(v6PacketBuffer(), &r, "" /* outNicName */) {
+		t.Error("got iptables.CheckOutput(...) = false for an existing connection, want = true")
+	}
+}
+
 func TestNATConflict(t *testing.T) {
 	otherSrcAddr := testutil.MustParse6("d::4")
 
@@ -102,6 +102,13 @@ type IPTables struct {
 	//
 	// +checklocks:mu
 	modified bool
+
+	// tracking is whether connections are tracked, which is the case once
+	// tables are modified or a conntrack limit is set. It is only set while
+	// mu is held.
+	//
+	// +checkatomics
+	tracking uint32
 }
 
 // VisitTargets traverses all the targets of all tables and replaces each with
@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
+	"reflect"
 	"sync/atomic"
 	"time"
 
@@ -633,6 +634,26 @@ func (s *Stack) AddRoute(route tcpip.Route) {
 	s.routeTable = append(s.routeTable, route)
 }
 
+// InsertRoute inserts a route into the route table before the routes with a
+// shorter prefix, so that routes are matched by longest prefix. It returns
+// false, leaving the route table unchanged, if the route is already in it.
+func (s *Stack) InsertRoute(route tcpip.Route) bool {
+	s.routeMu.Lock()
+	defer s.routeMu.Unlock()
+
+	i := len(s.routeTable)
+	for j := len(s.routeTable) - 1; j >= 0; j-- {
+		if s.routeTable[j] == route {
+			return false
+		}
+		if s.routeTable[j].Destination.Prefix() < route.Destination.Prefix() {
+			i = j
+		}
+	}
+	s.routeTable = append(s.routeTable[:i], append([]tcpip.Route{route}, s.routeTable[i:]...)...)
+	return true
+}
+
 // RemoveRoutes removes matching routes from the route table.
 func (s *Stack) RemoveRoutes(match func(tcpip.Route) bool) {
 	s.routeMu.Lock()
@@ -891,6 +912,21 @@ func (s *Stack) HasNIC(id tcpip.NICID) bool {
 	return ok
 }
 
+// ResetNICStats sets the counters of the given NIC, as reported in
+// NICInfo.Stats, to zero. The stack-wide counters in Stats().NICs, which also
+// count the NIC's traffic, are left unchanged.
+func (s *Stack) ResetNICStats(id tcpip.NICID) tcpip.Error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nic, ok := s.nics[id]
+	if !ok {
+		return &tcpip.ErrUnknownNICID{}
+	}
+	tcpip.ResetStatCounters(reflect.ValueOf(&nic.stats.local).Elem())
+	return nil
+}
+
 // NICInfo returns a map of NICIDs to their associated information.
 func (s *Stack) NICInfo() map[tcpip.NICID]NICInfo {
 	s.mu.RLock()
@@ -848,6 +848,31 @@ func TestRemoveNIC(t *testing.T) {
 	}
 }
 
+func TestInsertRoute(t *testing.T) {
+	s := stack.New(stack.Options{})
+	route := func(addr tcpip.Address, mask tcpip.AddressMask) tcpip.Route {
+		subnet, err := tcpip.NewSubnet(addr, mask)
+		if err != nil {
+			t.Fatalf("NewSubnet(%q, %q) failed: %v", addr, mask, err)
+		}
+		return tcpip.Route{Destination: subnet, NIC: 1}
+	}
+	def := route("\x00\x00", "\x00\x00")
+	wide := route("\x0a\x00", "\xff\x00")
+	narrow := route("\x0a\x01", "\xff\xff")
+	s.SetRouteTable([]tcpip.Route{wide, def})
+
+	if !s.InsertRoute(narrow) {
+		t.Fatalf("InsertRoute(%s) = false, want true", narrow)
+	}
+	if s.InsertRoute(narrow) {
+		t.Errorf("InsertRoute(%s) of an existing route = true, want false", narrow)
+	}
+	if got, want := s.GetRouteTable(), []tcpip.Route{narrow, wide, def}; !cmp.Equal(got, want) {
+		t.Errorf("GetRouteTable() = %v, want %v", got, want)
+	}
+}
+
 func TestRouteWithDownNIC(t *testing.T) {
 	tests := []struct {
 		name   string
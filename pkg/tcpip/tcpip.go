@@ -1039,21 +1039,31 @@ func (*TCPInfoOption) isGettableSocketOption() {}
 
 // KeepaliveIdleOption is used by SetSockOpt/GetSockOpt to specify the time a
 // connection must remain idle before the first TCP keepalive packet is sent.
-// Once this time is reached, KeepaliveIntervalOption is used instead.
+// Once this time is reached, KeepaliveIntervalOption is used instead. As a
+// transport protocol option, it is the default for new endpoints.
 type KeepaliveIdleOption time.Duration
 
 func (*KeepaliveIdleOption) isGettableSocketOption() {}
 
 func (*KeepaliveIdleOption) isSettableSocketOption() {}
 
+func (*KeepaliveIdleOption) isGettableTransportProtocolOption() {}
+
+func (*KeepaliveIdleOption) isSettableTransportProtocolOption() {}
+
 // KeepaliveIntervalOption is used by SetSockOpt/GetSockOpt to specify the
-// interval between sending TCP keepalive packets.
+// interval between sending TCP keepalive packets. As a transport protocol
+// option, it is the default for new endpoints.
 type KeepaliveIntervalOption time.Duration
 
 func (*KeepaliveIntervalOption) isGettableSocketOption() {}
 
 func (*KeepaliveIntervalOption) isSettableSocketOption() {}
 
+func (*KeepaliveIntervalOption) isGettableTransportProtocolOption() {}
+
+func (*KeepaliveIntervalOption) isSettableTransportProtocolOption() {}
+
 // TCPUserTimeoutOption is used by SetSockOpt/GetSockOpt to specify a user
 // specified timeout for a given TCP connection.
 // See: RFC5482 for details.
@@ -2043,6 +2053,16 @@ func (m *IntegralStatCounterMap) Init() {
 	m.counterMap = make(map[uint64]*StatCounter)
 }
 
+// reset sets all counters in the map to zero. Keys are kept, so that
+// references to the counters remain valid.
+func (m *IntegralStatCounterMap) reset() {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, counter := range m.counterMap {
+		counter.count.Store(0)
+	}
+}
+
 // Increment increments the counter associated with the provided key.
 func (m *IntegralStatCounterMap) Increment(key uint64) {
 	m.mu.RLock()
@@ -2272,6 +2292,26 @@ func InitStatCounters(v reflect.Value) {
 	}
 }
 
+// ResetStatCounters recursively sets all StatCounters in v, which must be a
+// struct of StatCounters like NICStats, to zero. Counters in
+// IntegralStatCounterMaps are reset too. Nil fields are skipped.
+func ResetStatCounters(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		v := v.Field(i)
+		if s, ok := v.Addr().Interface().(**StatCounter); ok {
+			if *s != nil {
+				(*s).count.Store(0)
+			}
+		} else if s, ok := v.Addr().Interface().(**IntegralStatCounterMap); ok {
+			if *s != nil {
+				(*s).reset()
+			}
+		} else {
+			ResetStatCounters(v)
+		}
+	}
+}
+
 // FillIn returns a copy of s with nil fields initialized to new StatCounters.
 func (s Stats) FillIn() Stats {
 	InitStatCounters(reflect.ValueOf(&s).Elem())
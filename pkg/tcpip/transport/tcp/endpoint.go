@@ -912,6 +912,16 @@ func newEndpoint(s *stack.Stack, protocol *protocol, netProto tcpip.NetworkProto
 		e.maxSynRetries = uint8(synRetries)
 	}
 
+	var ki tcpip.KeepaliveIdleOption
+	if err := s.TransportProtocolOption(ProtocolNumber, &ki); err == nil {
+		e.keepalive.idle = time.Duration(ki)
+	}
+
+	var kint tcpip.KeepaliveIntervalOption
+	if err := s.TransportProtocolOption(ProtocolNumber, &kint); err == nil {
+		e.keepalive.interval = time.Duration(kint)
+	}
+
 	if p := s.GetTCPProbe(); p != nil {
 		e.probe = p
 	}
@@ -105,6 +105,8 @@ type protocol struct {
 	maxRTO                     time.Duration
 	maxRetries                 uint32
 	synRetries                 uint8
+	keepaliveIdle              time.Duration
+	keepaliveInterval          time.Duration
 	dispatcher                 dispatcher
 
 	// The following secrets are initialized once and stay unchanged after.
@@ -367,6 +369,24 @@ func (p *protocol) SetOption(option tcpip.SettableTransportProtocolOption) tcpip
 		p.mu.Unlock()
 		return nil
 
+	case *tcpip.KeepaliveIdleOption:
+		if *v <= 0 {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		p.mu.Lock()
+		p.keepaliveIdle = time.Duration(*v)
+		p.mu.Unlock()
+		return nil
+
+	case *tcpip.KeepaliveIntervalOption:
+		if *v <= 0 {
+			return &tcpip.ErrInvalidOptionValue{}
+		}
+		p.mu.Lock()
+		p.keepaliveInterval = time.Duration(*v)
+		p.mu.Unlock()
+		return nil
+
 	default:
 		return &tcpip.ErrUnknownProtocolOption{}
 	}
@@ -471,6 +491,18 @@ func (p *protocol) Option(option tcpip.GettableTransportProtocolOption) tcpip.Er
 		p.mu.RUnlock()
 		return nil
 
+	case *tcpip.KeepaliveIdleOption:
+		p.mu.RLock()
+		*v = tcpip.KeepaliveIdleOption(p.keepaliveIdle)
+		p.mu.RUnlock()
+		return nil
+
+	case *tcpip.KeepaliveIntervalOption:
+		p.mu.RLock()
+		*v = tcpip.KeepaliveIntervalOption(p.keepaliveInterval)
+		p.mu.RUnlock()
+		return nil
+
 	default:
 		return &tcpip.ErrUnknownProtocolOption{}
 	}
@@ -511,6 +543,8 @@ func NewProtocol(s *stack.Stack) stack.TransportProtocol {
 		timeWaitTimeout:            DefaultTCPTimeWaitTimeout,
 		timeWaitReuse:              tcpip.TCPTimeWaitReuseLoopbackOnly,
 		synRetries:                 DefaultSynRetries,
+		keepaliveIdle:              DefaultKeepaliveIdle,
+		keepaliveInterval:          DefaultKeepaliveInterval,
 		minRTO:                     MinRTO,
 		maxRTO:                     MaxRTO,
 		maxRetries:                 MaxRetries,
@@ -29,6 +29,8 @@ import (
 	"runtime"
 	"time"
 
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/eventfd"
 	"gvisor.dev/gvisor/pkg/fd"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sync"
@@ -44,6 +46,10 @@ var ErrTooManyFiles = errors.New("too many files")
 // ErrUnknownMethod is returned when a method is not known.
 var ErrUnknownMethod = errors.New("unknown method")
 
+// ErrCanceled is returned by methods whose call has been canceled, see
+// CancelPayload.
+var ErrCanceled = errors.New("call canceled")
+
 // errStopped is an internal error indicating the server has been stopped.
 var errStopped = errors.New("stopped")
 
@@ -54,6 +60,10 @@ var errStopped = errors.New("stopped")
 type RemoteError struct {
 	// Message is the result of calling Error() on the remote error.
 	Message string
+
+	// Code is the code of the remote error, see Error. It's 0 if the remote
+	// error had none.
+	Code ErrorCode
 }
 
 // Error returns the remote error string.
@@ -61,6 +71,54 @@ func (r RemoteError) Error() string {
 	return r.Message
 }
 
+// ErrorCode classifies errors returned by methods, so that clients don't need
+// to match error messages. What each code means is up to the methods of the
+// server, except for 0, which means that the error isn't classified.
+type ErrorCode int32
+
+// Error is an error with a code. Only the message of errors returned by
+// methods is preserved over URPC, but if one is or wraps an Error, its code is
+// returned to the client in RemoteError.Code as well.
+type Error struct {
+	// Code is the code of the error.
+	Code ErrorCode
+
+	// Err is the underlying error.
+	Err error
+}
+
+// Error implements error.Error.
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithCode returns err with the given code, or nil if err is nil.
+func WithCode(code ErrorCode, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// CodeOf returns the code of err, which is the code of the first Error or
+// RemoteError in its chain, or 0 if there's none.
+func CodeOf(err error) ErrorCode {
+	for ; err != nil; err = errors.Unwrap(err) {
+		switch e := err.(type) {
+		case *Error:
+			return e.Code
+		case RemoteError:
+			return e.Code
+		}
+	}
+	return 0
+}
+
 // FilePayload may be _embedded_ in another type in order to send or receive a
 // file as a result of an RPC. These are not actually serialized, rather they
 // are sent via an accompanying SCM_RIGHTS message (plumbed through the unet
@@ -104,6 +162,207 @@ type filePayloader interface {
 	setFilePayload([]*os.File)
 }
 
+// CancelPayload may be _embedded_ in an argument struct to allow canceling
+// calls of a method that may block for a long time. The call is canceled once
+// Timeout has elapsed, if it's not 0, or once the client hangs up, e.g.
+// because it was killed. The method should then stop waiting and return
+// ErrCanceled.
+//
+// As with FilePayload, the argument type _must_ be a pointer to the struct.
+type CancelPayload struct {
+	// Timeout is how long the call may take. If 0, the call is only
+	// canceled when the client hangs up.
+	Timeout time.Duration `json:"timeout"`
+
+	done <-chan struct{}
+}
+
+// Done returns a channel that is closed when the call is canceled. It's nil,
+// so never ready, if the argument wasn't received by a Server.
+func (c *CancelPayload) Done() <-chan struct{} {
+	return c.done
+}
+
+// timeout returns the timeout of the call.
+func (c *CancelPayload) timeout() time.Duration {
+	return c.Timeout
+}
+
+// setDone sets the channel returned by Done.
+func (c *CancelPayload) setDone(done <-chan struct{}) {
+	c.done = done
+}
+
+// canceler is implemented only by CancelPayload and types that embed it, see
+// filePayloader.
+type canceler interface {
+	timeout() time.Duration
+	setDone(<-chan struct{})
+}
+
+// watchedCall is a call watched by a callWatcher.
+type watchedCall struct {
+	// client is the socket of the client that made the call. It's
+	// immutable.
+	client *unet.Socket
+
+	// timer cancels the call after its timeout, or is nil if it has none.
+	// It's immutable.
+	timer *time.Timer
+
+	// done is closed once the call is canceled.
+	done       chan struct{}
+	cancelOnce sync.Once
+
+	// removedGen is the generation of callWatcher.calls in which the call
+	// was removed, or 0 if it's still there. It's protected by
+	// callWatcher.mu.
+	removedGen uint64
+}
+
+// cancel cancels the call.
+func (c *watchedCall) cancel() {
+	c.cancelOnce.Do(func() { close(c.done) })
+}
+
+// callWatcher cancels calls whose client hangs up. A single goroutine polls
+// the clients of all watched calls, and only runs while there are some.
+type callWatcher struct {
+	mu sync.Mutex
+
+	// cond is broadcast when polling becomes false.
+	cond sync.Cond
+
+	// wake wakes the poller up when calls changes. It's created with the
+	// first watched call.
+	wake *eventfd.Eventfd
+
+	// calls are the watched calls.
+	calls map[*watchedCall]struct{}
+
+	// gen is incremented whenever a call is removed from calls.
+	gen uint64
+
+	// running is true while the poller goroutine runs.
+	running bool
+
+	// polling is true while the poller goroutine polls the clients of calls
+	// as of generation pollGen.
+	polling bool
+	pollGen uint64
+}
+
+// watch starts watching a call made by client. The returned channel is closed
+// once timeout has elapsed, unless it's 0, or once client hangs up. stop must
+// be called when the call completes. It waits until client isn't polled
+// anymore, so client can be closed afterwards.
+func (w *callWatcher) watch(client *unet.Socket, timeout time.Duration) (done <-chan struct{}, stop func(), err error) {
+	c := &watchedCall{
+		client: client,
+		done:   make(chan struct{}),
+	}
+
+	w.mu.Lock()
+	if w.wake == nil {
+		ev, err := eventfd.Create()
+		if err != nil {
+			w.mu.Unlock()
+			return nil, nil, err
+		}
+		w.wake = &ev
+		w.cond.L = &w.mu
+		w.calls = make(map[*watchedCall]struct{})
+	}
+	w.calls[c] = struct{}{}
+	if w.running {
+		w.wake.Notify()
+	} else {
+		w.running = true
+		go w.poll() // S/R-SAFE: out of scope
+	}
+	w.mu.Unlock()
+
+	if timeout != 0 {
+		c.timer = time.AfterFunc(timeout, c.cancel)
+	}
+	return c.done, func() { w.unwatch(c) }, nil
+}
+
+// unwatch stops watching c.
+func (w *callWatcher) unwatch(c *watchedCall) {
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if c.removedGen == 0 {
+		w.removeLocked(c)
+		w.wake.Notify()
+	}
+	for w.polling && w.pollGen < c.removedGen {
+		w.cond.Wait()
+	}
+}
+
+// removeLocked removes c from the watched calls.
+//
+// +checklocks:w.mu
+func (w *callWatcher) removeLocked(c *watchedCall) {
+	delete(w.calls, c)
+	w.gen++
+	c.removedGen = w.gen
+}
+
+// poll polls the clients of the watched calls until there are none left.
+func (w *callWatcher) poll() {
+	var (
+		fds   []unix.PollFd
+		calls []*watchedCall
+	)
+	for {
+		w.mu.Lock()
+		if len(w.calls) == 0 {
+			w.running = false
+			w.mu.Unlock()
+			return
+		}
+		fds = append(fds[:0], unix.PollFd{Fd: int32(w.wake.FD()), Events: unix.POLLIN})
+		calls = calls[:0]
+		for c := range w.calls {
+			fds = append(fds, unix.PollFd{Fd: int32(c.client.FD()), Events: unix.POLLRDHUP})
+			calls = append(calls, c)
+		}
+		w.polling = true
+		w.pollGen = w.gen
+		w.mu.Unlock()
+
+		_, err := unix.Ppoll(fds, nil, nil)
+
+		w.mu.Lock()
+		w.polling = false
+		w.cond.Broadcast()
+		if err != nil && err != unix.EINTR {
+			// Calls that are still watched can't be canceled on hang up
+			// anymore, but they still complete normally.
+			log.Warningf("urpc: watching clients for hang up: %v", err)
+			w.running = false
+			w.mu.Unlock()
+			return
+		}
+		if fds[0].Revents != 0 {
+			w.wake.Read()
+		}
+		for i, c := range calls {
+			if fds[i+1].Revents != 0 && c.removedGen == 0 {
+				// The client hung up.
+				c.cancel()
+				w.removeLocked(c)
+			}
+		}
+		w.mu.Unlock()
+	}
+}
+
 // clientCall is the client=>server method call on the client side.
 type clientCall struct {
 	Method string      `json:"method"`
@@ -120,6 +379,7 @@ type serverCall struct {
 type callResult struct {
 	Success bool        `json:"success"`
 	Err     string      `json:"err"`
+	Code    ErrorCode   `json:"code,omitempty"`
 	Result  interface{} `json:"result"`
 }
 
@@ -165,7 +425,7 @@ const (
 
 // Server is an RPC server.
 type Server struct {
-	// mu protects all fields, except wg.
+	// mu protects all fields, except wg and watcher.
 	mu sync.Mutex
 
 	// methods is the set of server methods.
@@ -182,6 +442,9 @@ type Server struct {
 
 	// afterRPCCallback is called after each RPC is successfully completed.
 	afterRPCCallback func()
+
+	// watcher watches calls that may be canceled, see CancelPayload.
+	watcher callWatcher
 }
 
 // NewServer returns a new server.
@@ -333,11 +596,22 @@ func (s *Server) handleOne(client *unet.Socket) error {
 		fp.setFilePayload(newFs)
 	}
 
+	// Let the call be canceled if the method supports it.
+	if cp, ok := na.Interface().(canceler); ok {
+		done, stop, err := s.watcher.watch(client, cp.timeout())
+		if err != nil {
+			return marshal(client, &callResult{Err: err.Error()}, nil)
+		}
+		defer stop()
+		cp.setDone(done)
+	}
+
 	// Call the method.
 	re := reflect.New(rm.resultType.Elem())
 	rValues := rm.fn.Call([]reflect.Value{rm.rcvr, na, re})
 	if errVal := rValues[0].Interface(); errVal != nil {
-		return marshal(client, &callResult{Err: errVal.(error).Error()}, nil)
+		err := errVal.(error)
+		return marshal(client, &callResult{Err: err.Error(), Code: CodeOf(err)}, nil)
 	}
 
 	// Set the resulting payload.
@@ -653,7 +927,7 @@ func (c *Client) Call(method string, arg interface{}, result interface{}) error
 
 	// Did an error occur?
 	if !callR.Success {
-		return RemoteError{Message: callR.Err}
+		return RemoteError{Message: callR.Err, Code: callR.Code}
 	}
 
 	// All set.
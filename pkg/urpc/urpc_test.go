@@ -16,8 +16,10 @@ package urpc
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"gvisor.dev/gvisor/pkg/unet"
 )
@@ -47,6 +49,10 @@ func (t test) Err(a *testArg, r *testResult) error {
 	return errors.New("test error")
 }
 
+func (t test) CodedErr(a *testArg, r *testResult) error {
+	return fmt.Errorf("wrapped: %w", WithCode(ErrorCode(a.IntArg), errors.New("test error")))
+}
+
 func (t test) FailNoFile(a *testArg, r *testResult) error {
 	if a.Files == nil {
 		return errors.New("no file found")
@@ -67,6 +73,26 @@ func (t test) TooManyFiles(a *testArg, r *testResult) error {
 	return nil
 }
 
+type cancelArg struct {
+	CancelPayload
+}
+
+// blocker has a method that blocks until its call is canceled.
+type blocker struct {
+	// started is notified when Block is called.
+	started chan struct{}
+
+	// canceled is notified when a call to Block is canceled.
+	canceled chan struct{}
+}
+
+func (b blocker) Block(a *cancelArg, r *testResult) error {
+	b.started <- struct{}{}
+	<-a.Done()
+	b.canceled <- struct{}{}
+	return ErrCanceled
+}
+
 func startServer(socket *unet.Socket) {
 	s := NewServer()
 	s.Register(test{})
@@ -138,6 +164,31 @@ func TestErr(t *testing.T) {
 	}
 }
 
+func TestErrCode(t *testing.T) {
+	c, err := testClient()
+	if err != nil {
+		t.Fatalf("error creating test client: %v", err)
+	}
+	defer c.Close()
+
+	var r testResult
+	err = c.Call("test.CodedErr", &testArg{IntArg: 42}, &r)
+	if err == nil {
+		t.Fatalf("expected non-nil err, got nil")
+	}
+	if got, want := err.Error(), "wrapped: test error"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got := CodeOf(fmt.Errorf("calling: %w", err)); got != 42 {
+		t.Errorf("expected code 42, got %d", got)
+	}
+
+	// Errors without a code have code 0.
+	if err := c.Call("test.Err", &testArg{}, &r); CodeOf(err) != 0 {
+		t.Errorf("expected code 0, got %d", CodeOf(err))
+	}
+}
+
 func TestSendFile(t *testing.T) {
 	c, err := testClient()
 	if err != nil {
@@ -208,3 +259,101 @@ func TestTooManyFiles(t *testing.T) {
 		t.Errorf("expected too many files, got %v", err.Error())
 	}
 }
+
+func TestCancelTimeout(t *testing.T) {
+	serverSock, clientSock, err := unet.SocketPair(false)
+	if err != nil {
+		t.Fatalf("error creating socket pair: %v", err)
+	}
+	b := blocker{started: make(chan struct{}, 1), canceled: make(chan struct{}, 1)}
+	s := NewServer()
+	s.Register(b)
+	s.StartHandling(serverSock)
+	c := NewClient(clientSock)
+	defer c.Close()
+
+	var r testResult
+	a := cancelArg{CancelPayload{Timeout: 10 * time.Millisecond}}
+	if err := c.Call("blocker.Block", &a, &r); err == nil || err.Error() != ErrCanceled.Error() {
+		t.Errorf("Call() got error: %v, want: %v", err, ErrCanceled)
+	}
+}
+
+func TestCancelHangUp(t *testing.T) {
+	serverSock, clientSock, err := unet.SocketPair(false)
+	if err != nil {
+		t.Fatalf("error creating socket pair: %v", err)
+	}
+	b := blocker{started: make(chan struct{}, 1), canceled: make(chan struct{}, 1)}
+	s := NewServer()
+	s.Register(b)
+	s.StartHandling(serverSock)
+	c := NewClient(clientSock)
+
+	go func() {
+		var r testResult
+		c.Call("blocker.Block", &cancelArg{}, &r)
+	}()
+	<-b.started
+
+	// The call has no timeout, so it's only canceled by the client hanging
+	// up.
+	clientSock.Close()
+	select {
+	case <-b.canceled:
+	case <-time.After(10 * time.Second):
+		t.Errorf("call not canceled after the client hung up")
+	}
+}
+
+func TestCancelSharedWatcher(t *testing.T) {
+	const numClients = 3
+	b := blocker{started: make(chan struct{}, numClients), canceled: make(chan struct{}, numClients)}
+	s := NewServer()
+	s.Register(b)
+	var clientSocks []*unet.Socket
+	for i := 0; i < numClients; i++ {
+		serverSock, clientSock, err := unet.SocketPair(false)
+		if err != nil {
+			t.Fatalf("error creating socket pair: %v", err)
+		}
+		s.StartHandling(serverSock)
+		clientSocks = append(clientSocks, clientSock)
+		c := NewClient(clientSock)
+		go func() {
+			var r testResult
+			c.Call("blocker.Block", &cancelArg{}, &r)
+		}()
+		<-b.started
+	}
+
+	// Clients hanging up one at a time only cancel their own call.
+	for i, clientSock := range clientSocks {
+		clientSock.Close()
+		select {
+		case <-b.canceled:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("call %d not canceled after its client hung up", i)
+		}
+		select {
+		case <-b.canceled:
+			t.Fatalf("another call was canceled after client %d hung up", i)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	// The poller stops once no call is watched anymore.
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		s.watcher.mu.Lock()
+		running := s.watcher.running
+		s.watcher.mu.Unlock()
+		if !running {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("call watcher still running after all calls completed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/runsc/config"
+)
+
+// Version is the version of runsc, set by the command line. It's recorded in
+// checkpoints for diagnostics, but checkpoints can be restored by other
+// versions as long as they understand the state format, see
+// state.CheckVersion.
+var Version = "VERSION_MISSING"
+
+// Keys of the checkpoint metadata describing where the checkpoint was taken.
+// They are stored in the state file metadata, which follows the state file
+// magic and precedes the state, so they're read before any state is loaded.
+const (
+	// metadataCompat is the version of the set of keys below. Checkpoints
+	// with a newer version are rejected, as the keys may have changed
+	// meaning.
+	metadataCompat = "compat_version"
+
+	metadataVersion  = "runsc_version"
+	metadataPlatform = "platform"
+	metadataArch     = "arch"
+)
+
+// compatVersion is the current value of metadataCompat.
+const compatVersion = 1
+
+// addCompatMetadata records in m where the checkpoint is taken, to be checked
+// by checkCompatMetadata on restore.
+func addCompatMetadata(m map[string]string, conf *config.Config) {
+	m[metadataCompat] = strconv.Itoa(compatVersion)
+	m[metadataVersion] = Version
+	m[metadataPlatform] = conf.Platform
+	m[metadataArch] = runtime.GOARCH
+}
+
+// checkCompatMetadata returns an error naming the mismatched field if the
+// checkpoint with metadata m can't be restored with conf, i.e. if it was
+// taken on another platform or architecture. A different runsc version is
+// only logged. Checkpoints taken before the metadata was recorded aren't
+// checked.
+func checkCompatMetadata(m map[string]string, conf *config.Config) error {
+	v, ok := m[metadataCompat]
+	if !ok {
+		return nil
+	}
+	compat, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("incompatible checkpoint: invalid %s %q", metadataCompat, v)
+	}
+	if compat > compatVersion {
+		return fmt.Errorf("incompatible checkpoint: %s is %d, newer than the supported %d", metadataCompat, compat, compatVersion)
+	}
+	for _, f := range []struct {
+		key  string
+		want string
+	}{
+		{key: metadataPlatform, want: conf.Platform},
+		{key: metadataArch, want: runtime.GOARCH},
+	} {
+		if got := m[f.key]; got != f.want {
+			return fmt.Errorf("incompatible checkpoint: %s is %q, want %q", f.key, got, f.want)
+		}
+	}
+	if v := m[metadataVersion]; v != Version {
+		log.Infof("Restoring checkpoint taken by runsc version %q with version %q", v, Version)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"strings"
+	"testing"
+
+	"gvisor.dev/gvisor/runsc/config"
+)
+
+func TestCheckCompatMetadata(t *testing.T) {
+	conf := &config.Config{Platform: "ptrace"}
+	for _, tc := range []struct {
+		name   string
+		modify func(m map[string]string)
+		want   string
+	}{
+		{
+			name:   "compatible",
+			modify: func(map[string]string) {},
+		},
+		{
+			name: "unrecorded",
+			modify: func(m map[string]string) {
+				for k := range m {
+					delete(m, k)
+				}
+			},
+		},
+		{
+			name:   "newer compat version",
+			modify: func(m map[string]string) { m[metadataCompat] = "2" },
+			want:   metadataCompat,
+		},
+		{
+			// Other versions can restore the checkpoint if they understand
+			// its state format.
+			name:   "other version",
+			modify: func(m map[string]string) { m[metadataVersion] = "other" },
+		},
+		{
+			name:   "platform",
+			modify: func(m map[string]string) { m[metadataPlatform] = "kvm" },
+			want:   metadataPlatform,
+		},
+		{
+			name:   "arch",
+			modify: func(m map[string]string) { m[metadataArch] = "other" },
+			want:   metadataArch,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := make(map[string]string)
+			addCompatMetadata(m, conf)
+			tc.modify(m)
+			err := checkCompatMetadata(m, conf)
+			if tc.want == "" {
+				if err != nil {
+					t.Errorf("checkCompatMetadata() failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), "incompatible checkpoint: "+tc.want) {
+				t.Errorf("checkCompatMetadata() got error: %v, want: incompatible checkpoint: %s ...", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2018 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/control"
+	"gvisor.dev/gvisor/pkg/sentry/state"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// signalCheckpointFile holds the destination of the next checkpoint triggered
+// by the checkpoint signal.
+type signalCheckpointFile struct {
+	mu sync.Mutex
+
+	// opts contains the destination file, or nil if no file has been
+	// donated since the last checkpoint.
+	opts *control.SaveOpts
+}
+
+// set replaces the destination of the next checkpoint with opts, closing the
+// previous destination if any.
+func (f *signalCheckpointFile) set(opts *control.SaveOpts) {
+	f.mu.Lock()
+	old := f.opts
+	f.opts = opts
+	f.mu.Unlock()
+	if old != nil {
+		old.FilePayload.Files[0].Close()
+	}
+}
+
+// take returns the destination of the next checkpoint and clears it, since a
+// state file can only be written once.
+func (f *signalCheckpointFile) take() *control.SaveOpts {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	opts := f.opts
+	f.opts = nil
+	return opts
+}
+
+// checkpointOnSignal checkpoints the sandbox to the donated checkpoint file.
+// It's called when the checkpoint signal is sent to the root container's init
+// process. Like containerManager.Checkpoint, saving tears down the kernel, so
+// the sandbox is killed afterwards and must be restored from the file to
+// continue.
+func (l *Loader) checkpointOnSignal() {
+	opts := l.checkpointFile.take()
+	if opts == nil {
+		log.Warningf("Checkpoint signal intercepted, but no checkpoint file is set, ignoring")
+		return
+	}
+	defer opts.FilePayload.Files[0].Close()
+
+	log.Infof("Checkpoint signal intercepted, checkpointing sandbox")
+	if opts.Metadata == nil {
+		opts.Metadata = make(map[string]string)
+	}
+	addCompatMetadata(opts.Metadata, l.root.conf)
+	saveOpts := state.SaveOpts{
+		Destination: opts.FilePayload.Files[0],
+		Key:         opts.Key,
+		Metadata:    opts.Metadata,
+		Compression: opts.Compression,
+		Callback: func(err error) {
+			if err == nil {
+				log.Infof("Checkpoint succeeded: exiting...")
+				l.k.SetSaveSuccess(false /* autosave */)
+			} else {
+				log.Warningf("Checkpoint failed: exiting...")
+				l.k.SetSaveError(err)
+			}
+			l.k.Kill(linux.WaitStatusExit(0))
+		},
+	}
+	if err := saveOpts.Save(l.k.SupervisorContext(), l.k, l.watchdog); err != nil {
+		log.Warningf("Checkpoint triggered by signal failed: %v", err)
+	}
+}
@@ -15,25 +15,38 @@
 package boot
 
 import (
+	"bytes"
+	gocontext "context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"sync/atomic"
 	gtime "time"
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/control/server"
 	"gvisor.dev/gvisor/pkg/fd"
+	"gvisor.dev/gvisor/pkg/hostarch"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/control"
 	controlpb "gvisor.dev/gvisor/pkg/sentry/control/control_go_proto"
 	"gvisor.dev/gvisor/pkg/sentry/fs"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/tmpfs"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/ipc"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/msgqueue"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/semaphore"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/shm"
 	"gvisor.dev/gvisor/pkg/sentry/socket/netstack"
 	"gvisor.dev/gvisor/pkg/sentry/state"
 	"gvisor.dev/gvisor/pkg/sentry/time"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/sentry/watchdog"
+	"gvisor.dev/gvisor/pkg/state/statefile"
+	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
 	"gvisor.dev/gvisor/pkg/urpc"
 	"gvisor.dev/gvisor/runsc/boot/pprof"
@@ -42,9 +55,19 @@ import (
 )
 
 const (
+	// ContMgrAddDevice creates a device node in a running container.
+	ContMgrAddDevice = "containerManager.AddDevice"
+
+	// ContMgrAsyncIOStatus lists, and optionally cancels, the outstanding
+	// asynchronous I/O requests of a container.
+	ContMgrAsyncIOStatus = "containerManager.AsyncIOStatus"
+
 	// ContMgrCheckpoint checkpoints a container.
 	ContMgrCheckpoint = "containerManager.Checkpoint"
 
+	// ContMgrCheckpointContainer checkpoints a single container.
+	ContMgrCheckpointContainer = "containerManager.CheckpointContainer"
+
 	// ContMgrCreateSubcontainer creates a sub-container.
 	ContMgrCreateSubcontainer = "containerManager.CreateSubcontainer"
 
@@ -52,51 +75,299 @@ const (
 	// associated resources in the sandbox.
 	ContMgrDestroySubcontainer = "containerManager.DestroySubcontainer"
 
+	// ContMgrDiskQuota gets the size limit and usage of a container's
+	// writable layer.
+	ContMgrDiskQuota = "containerManager.DiskQuota"
+
+	// ContMgrDrainMode gets whether the sandbox is in drain mode.
+	ContMgrDrainMode = "containerManager.DrainMode"
+
 	// ContMgrEvent gets stats about the container used by "runsc events".
 	ContMgrEvent = "containerManager.Event"
 
+	// ContMgrEventStream streams structured sandbox events to a donated FD.
+	ContMgrEventStream = "containerManager.EventStream"
+
+	// ContMgrExecute executes a command in a container and waits for it to
+	// exit.
+	ContMgrExecute = "containerManager.Execute"
+
 	// ContMgrExecuteAsync executes a command in a container.
 	ContMgrExecuteAsync = "containerManager.ExecuteAsync"
 
+	// ContMgrExportState exports a lossy JSON snapshot of a container's state.
+	ContMgrExportState = "containerManager.ExportState"
+
+	// ContMgrForceUnmount detaches a mount from a running container.
+	ContMgrForceUnmount = "containerManager.ForceUnmount"
+
+	// ContMgrFutexStats gets futex wait statistics for a container.
+	ContMgrFutexStats = "containerManager.FutexStats"
+
+	// ContMgrGetIPCLimits gets the IPC limits of a container's IPC namespace.
+	ContMgrGetIPCLimits = "containerManager.GetIPCLimits"
+
+	// ContMgrHealth checks that the control server is responsive. It doesn't
+	// take any lock that other methods may hold for long.
+	ContMgrHealth = "containerManager.Health"
+
+	// ContMgrHostRootPath gets what backs a container's root filesystem on
+	// the host.
+	ContMgrHostRootPath = "containerManager.HostRootPath"
+
+	// ContMgrInitCommand gets the command of a container's init process.
+	ContMgrInitCommand = "containerManager.InitCommand"
+
+	// ContMgrIPCObjects lists, and optionally cleans up, the SysV IPC objects
+	// of a container.
+	ContMgrIPCObjects = "containerManager.IPCObjects"
+
+	// ContMgrListContainers lists the containers known to the sandbox.
+	ContMgrListContainers = "containerManager.ListContainers"
+
+	// ContMgrPauseContainer stops all processes of a container, leaving other
+	// containers running.
+	ContMgrPauseContainer = "containerManager.PauseContainer"
+
+	// ContMgrPendingSignals lists, and optionally flushes, signals queued on a
+	// container's init process.
+	ContMgrPendingSignals = "containerManager.PendingSignals"
+
+	// ContMgrPollObjects lists the epoll instances, eventfds and timerfds of
+	// a process.
+	ContMgrPollObjects = "containerManager.PollObjects"
+
+	// ContMgrPreExitHook runs a command in a container before it's
+	// destroyed.
+	ContMgrPreExitHook = "containerManager.PreExitHook"
+
+	// ContMgrPrivilegeState gets the privilege state of a process.
+	ContMgrPrivilegeState = "containerManager.PrivilegeState"
+
 	// ContMgrProcesses lists processes running in a container.
 	ContMgrProcesses = "containerManager.Processes"
 
+	// ContMgrReadAhead gets the read-ahead window of a container.
+	ContMgrReadAhead = "containerManager.ReadAhead"
+
+	// ContMgrReadMemory reads the memory of a process in a container.
+	ContMgrReadMemory = "containerManager.ReadMemory"
+
 	// ContMgrRestore restores a container from a statefile.
 	ContMgrRestore = "containerManager.Restore"
 
+	// ContMgrResizeTTY sets the window size of a process' TTY.
+	ContMgrResizeTTY = "containerManager.ResizeTTY"
+
+	// ContMgrResumeContainer resumes the processes of a container stopped by
+	// ContMgrPauseContainer.
+	ContMgrResumeContainer = "containerManager.ResumeContainer"
+
+	// ContMgrSchedLatency gets the scheduling latency targets of a container.
+	ContMgrSchedLatency = "containerManager.SchedLatency"
+
+	// ContMgrSchedPolicy gets the scheduling policy of a process.
+	ContMgrSchedPolicy = "containerManager.SchedPolicy"
+
+	// ContMgrSetCheckpointFile sets the file that the checkpoint signal
+	// checkpoints the sandbox to.
+	ContMgrSetCheckpointFile = "containerManager.SetCheckpointFile"
+
+	// ContMgrSetCoreDumpUpload sets the file that core dumps are uploaded to.
+	ContMgrSetCoreDumpUpload = "containerManager.SetCoreDumpUpload"
+
+	// ContMgrSetDiskQuota limits the size of a container's writable layer.
+	ContMgrSetDiskQuota = "containerManager.SetDiskQuota"
+
+	// ContMgrSetDrainMode enables or disables drain mode, in which the
+	// sandbox refuses to start new containers.
+	ContMgrSetDrainMode = "containerManager.SetDrainMode"
+
+	// ContMgrSetIPCLimits sets the IPC limits of a container's IPC namespace.
+	ContMgrSetIPCLimits = "containerManager.SetIPCLimits"
+
+	// ContMgrSetReadAhead sets the read-ahead window of a container.
+	ContMgrSetReadAhead = "containerManager.SetReadAhead"
+
+	// ContMgrSetSchedLatency sets the scheduling latency targets of a
+	// container.
+	ContMgrSetSchedLatency = "containerManager.SetSchedLatency"
+
+	// ContMgrSetSchedPolicy sets the scheduling policy of a process.
+	ContMgrSetSchedPolicy = "containerManager.SetSchedPolicy"
+
+	// ContMgrSetSyncPolicy sets how a container's fsync calls are propagated
+	// to the host.
+	ContMgrSetSyncPolicy = "containerManager.SetSyncPolicy"
+
 	// ContMgrSignal sends a signal to a container.
 	ContMgrSignal = "containerManager.Signal"
 
+	// ContMgrSignalProcessGroup sends a signal to a process group in a
+	// container.
+	ContMgrSignalProcessGroup = "containerManager.SignalProcessGroup"
+
 	// ContMgrStartSubcontainer starts a sub-container inside a running sandbox.
 	ContMgrStartSubcontainer = "containerManager.StartSubcontainer"
 
+	// ContMgrStatus gets the lifecycle state of a container.
+	ContMgrStatus = "containerManager.Status"
+
+	// ContMgrSyncPolicy gets the sync policy of a container.
+	ContMgrSyncPolicy = "containerManager.SyncPolicy"
+
+	// ContMgrTightenSyscallPolicy restricts the syscalls a container may
+	// invoke.
+	ContMgrTightenSyscallPolicy = "containerManager.TightenSyscallPolicy"
+
 	// ContMgrWait waits on the init process of the container and returns its
 	// ExitStatus.
 	ContMgrWait = "containerManager.Wait"
 
+	// ContMgrWaitAll returns the exit status of all exited processes that
+	// were exec'd in a container, without waiting for running ones.
+	ContMgrWaitAll = "containerManager.WaitAll"
+
+	// ContMgrWaitContainer is like ContMgrWait, but can return right away if
+	// the container is still running, and can be canceled.
+	ContMgrWaitContainer = "containerManager.WaitContainer"
+
+	// ContMgrWaitDetailed waits on the init process of the container and
+	// returns how it exited.
+	ContMgrWaitDetailed = "containerManager.WaitDetailed"
+
+	// ContMgrWaitOCI waits on the init process of the container and returns
+	// its raw wait status along with its OCI exit status.
+	ContMgrWaitOCI = "containerManager.WaitOCI"
+
 	// ContMgrWaitPID waits on a process with a certain PID in the sandbox and
 	// return its ExitStatus.
 	ContMgrWaitPID = "containerManager.WaitPID"
 
+	// ContMgrWriteMemory writes to the memory of a process in a container.
+	ContMgrWriteMemory = "containerManager.WriteMemory"
+
 	// ContMgrRootContainerStart starts a new sandbox with a root container.
 	ContMgrRootContainerStart = "containerManager.StartRoot"
 )
 
 const (
+	// NetworkAddAddress assigns an address to an interface of a running
+	// network stack.
+	NetworkAddAddress = "Network.AddAddress"
+
+	// NetworkAddRoute adds a route to a running network stack.
+	NetworkAddRoute = "Network.AddRoute"
+
 	// NetworkCreateLinksAndRoutes creates links and routes in a network stack.
 	NetworkCreateLinksAndRoutes = "Network.CreateLinksAndRoutes"
 
+	// NetworkDeleteRoute deletes a route from a running network stack.
+	NetworkDeleteRoute = "Network.DeleteRoute"
+
+	// NetworkListInterfaces gets the interfaces of a network stack and their
+	// addresses.
+	NetworkListInterfaces = "Network.ListInterfaces"
+
+	// NetworkListRoutes gets the route table of a network stack.
+	NetworkListRoutes = "Network.ListRoutes"
+
+	// NetworkReinitialize replaces the root network stack with a new one.
+	NetworkReinitialize = "Network.Reinitialize"
+
+	// NetworkRemoveAddress removes an address from an interface of a running
+	// network stack.
+	NetworkRemoveAddress = "Network.RemoveAddress"
+
+	// NetworkResetStats zeroes the NIC counters of a network stack.
+	NetworkResetStats = "Network.ResetStats"
+
+	// NetworkSetMTU changes the MTU of an interface of a running network
+	// stack.
+	NetworkSetMTU = "Network.SetMTU"
+
+	// NetworkSetNICEnabled enables or disables an interface of a running
+	// network stack.
+	NetworkSetNICEnabled = "Network.SetNICEnabled"
+
+	// NetworkSetConntrackLimit caps the number of tracked connections in a
+	// network stack.
+	NetworkSetConntrackLimit = "Network.SetConntrackLimit"
+
+	// NetworkStackStats gets the stack-wide counters of a network stack.
+	NetworkStackStats = "Network.StackStats"
+
+	// NetworkStats gets the NIC counters of a network stack.
+	NetworkStats = "Network.Stats"
+
+	// NetworkSetTCPDefaults configures the defaults of new TCP sockets in a
+	// network stack.
+	NetworkSetTCPDefaults = "Network.SetTCPDefaults"
+
+	// NetworkTCPDefaults gets the defaults of new TCP sockets in a network
+	// stack.
+	NetworkTCPDefaults = "Network.TCPDefaults"
+
 	// DebugStacks collects sandbox stacks for debugging.
 	DebugStacks = "debug.Stacks"
+
+	// DebugGoroutineHistory collects the sandbox's goroutine and thread
+	// counts over time.
+	DebugGoroutineHistory = "debug.GoroutineHistory"
+
+	// DebugEmulationInfo gets the features that the sentry emulates or
+	// passes through to the host.
+	DebugEmulationInfo = "debug.EmulationInfo"
+
+	// DebugSetLogOutput switches the sandbox logs to a donated file.
+	DebugSetLogOutput = "debug.SetLogOutput"
+
+	// DebugSetOOMBehavior sets how the sentry reacts when out of memory.
+	DebugSetOOMBehavior = "debug.SetOOMBehavior"
+
+	// DebugOOMState gets the OOM behavior and statistics.
+	DebugOOMState = "debug.OOMState"
+
+	// DebugResolveOOM resumes tasks paused on out of memory.
+	DebugResolveOOM = "debug.ResolveOOM"
+
+	// DebugGetMadviseMode gets whether memory advice is passed through to
+	// the host.
+	DebugGetMadviseMode = "debug.GetMadviseMode"
+
+	// DebugSetMadviseMode sets whether memory advice is passed through to
+	// the host.
+	DebugSetMadviseMode = "debug.SetMadviseMode"
+
+	// DebugPerfCounters gets the hardware events counted for a container.
+	DebugPerfCounters = "debug.PerfCounters"
+
+	// DebugSetWatchdogConfig changes the task timeout and action of the
+	// watchdog.
+	DebugSetWatchdogConfig = "debug.SetWatchdogConfig"
+
+	// DebugWatchdogStatus gets the watchdog configuration and the tasks that
+	// may be stuck.
+	DebugWatchdogStatus = "debug.WatchdogStatus"
+
+	// DebugSetLogLevel sets the sandbox log level and returns the previous
+	// one.
+	DebugSetLogLevel = "debug.SetLogLevel"
+
+	// DebugMetrics gets goroutine, task and host FD counts.
+	DebugMetrics = "debug.Metrics"
 )
 
 // Profiling related commands (see pprof.go for more details).
 const (
-	ProfileCPU   = "Profile.CPU"
-	ProfileHeap  = "Profile.Heap"
-	ProfileBlock = "Profile.Block"
-	ProfileMutex = "Profile.Mutex"
-	ProfileTrace = "Profile.Trace"
+	ProfileCPU       = "Profile.CPU"
+	ProfileStartCPU  = "Profile.StartCPU"
+	ProfileStopCPU   = "Profile.StopCPU"
+	ProfileHeap      = "Profile.Heap"
+	ProfileGoroutine = "Profile.Goroutine"
+	ProfileBlock     = "Profile.Block"
+	ProfileMutex     = "Profile.Mutex"
+	ProfileTrace     = "Profile.Trace"
 )
 
 // Logging related commands (see logging.go for more details).
@@ -127,6 +398,58 @@ const (
 	EventsAttachDebugEmitter = "Events.AttachDebugEmitter"
 )
 
+// Codes of errors returned by control methods, see urpc.ErrorCode. They're
+// part of the control API and must not change.
+const (
+	// ErrCodeInvalidArgument means that the arguments of the call are
+	// invalid.
+	ErrCodeInvalidArgument urpc.ErrorCode = 1
+
+	// ErrCodeNotFound means that the container or process doesn't exist.
+	ErrCodeNotFound urpc.ErrorCode = 2
+
+	// ErrCodeAlreadyExists means that the container to create already
+	// exists.
+	ErrCodeAlreadyExists urpc.ErrorCode = 3
+
+	// ErrCodeFailedPrecondition means that the sandbox or container isn't in
+	// a state that allows the call, e.g. the container hasn't started yet.
+	ErrCodeFailedPrecondition urpc.ErrorCode = 4
+
+	// ErrCodeInternal means that the call failed inside the sandbox for
+	// another reason.
+	ErrCodeInternal urpc.ErrorCode = 5
+
+	// ErrCodeUnimplemented means that the call isn't supported by the
+	// sandbox.
+	ErrCodeUnimplemented urpc.ErrorCode = 6
+
+	// ErrCodeExecTimeout means that the process was killed because it
+	// hadn't exited before its timeout, see ErrExecTimeout.
+	ErrCodeExecTimeout urpc.ErrorCode = 7
+
+	// ErrCodeStillRunning means that the container is still running, see
+	// ErrStillRunning.
+	ErrCodeStillRunning urpc.ErrorCode = 8
+
+	// ErrCodeWaitTimeout means that the process hasn't exited within the
+	// timeout, see ErrWaitTimeout.
+	ErrCodeWaitTimeout urpc.ErrorCode = 9
+)
+
+// withDefaultCode returns err with the given code, unless it already has one.
+func withDefaultCode(code urpc.ErrorCode, err error) error {
+	if urpc.CodeOf(err) != 0 {
+		return err
+	}
+	return urpc.WithCode(code, err)
+}
+
+// invalidArgf returns an error with ErrCodeInvalidArgument.
+func invalidArgf(format string, args ...interface{}) error {
+	return urpc.WithCode(ErrCodeInvalidArgument, fmt.Errorf(format, args...))
+}
+
 // ControlSocketAddr generates an abstract unix socket name for the given ID.
 func ControlSocketAddr(id string) string {
 	return fmt.Sprintf("\x00runsc-sandbox.%s", id)
@@ -140,17 +463,22 @@ type controller struct {
 
 	// manager holds the containerManager methods.
 	manager *containerManager
+
+	// stopOnce ensures that the control server is stopped once.
+	stopOnce sync.Once
 }
 
 // newController creates a new controller. The caller must call
-// controller.srv.StartServing() to start the controller.
-func newController(fd int, l *Loader) (*controller, error) {
+// controller.srv.StartServing() to start the controller. If token is set,
+// clients must authenticate with it, see client.ConnectToWithToken.
+func newController(fd int, token []byte, l *Loader) (*controller, error) {
 	ctrl := &controller{}
 	var err error
 	ctrl.srv, err = server.CreateFromFD(fd)
 	if err != nil {
 		return nil, err
 	}
+	ctrl.srv.SetToken(token)
 
 	ctrl.manager = &containerManager{
 		startChan:       make(chan struct{}),
@@ -161,9 +489,11 @@ func newController(fd int, l *Loader) (*controller, error) {
 
 	if eps, ok := l.k.RootNetworkNamespace().Stack().(*netstack.Stack); ok {
 		net := &Network{
-			Stack: eps.Stack,
+			Stack:  eps.Stack,
+			loader: l,
 		}
 		ctrl.srv.Register(net)
+		ctrl.manager.network = net
 	}
 
 	if l.root.conf.Controls.Controls != nil {
@@ -188,7 +518,15 @@ func newController(fd int, l *Loader) (*controller, error) {
 			case controlpb.ControlConfig_STATE:
 				ctrl.srv.Register(&control.State{Kernel: l.k})
 			case controlpb.ControlConfig_DEBUG:
-				ctrl.srv.Register(&debug{})
+				ctrl.srv.Register(&debug{
+					k:            l.k,
+					logFormat:    l.root.conf.DebugLogFormat,
+					goroutines:   l.goroutines,
+					emulation:    emulationInfo(l.root.conf, l.root.spec.Process.Terminal),
+					perfCounters: l.perfCounters,
+					loader:       l,
+					hostFDs:      hostFDCounter{limit: hostFDLimit()},
+				})
 			}
 		}
 	}
@@ -199,8 +537,31 @@ func newController(fd int, l *Loader) (*controller, error) {
 // stopRPCTimeout is the time for clients to complete ongoing RPCs.
 const stopRPCTimeout = 15 * gtime.Second
 
+// stopHandlersTimeout is the additional time given to RPC handlers that are
+// still running after stopRPCTimeout, e.g. because they're stuck, before stop
+// stops waiting for them.
+const stopHandlersTimeout = 5 * gtime.Second
+
+// stop stops the control server. It first closes the listening socket, which
+// releases its address, e.g. ControlSocketAddr for a new sandbox with the
+// same ID, and then waits for in-flight RPCs to complete. Connections are
+// closed once their RPC completes, or right away if they're idle after
+// stopRPCTimeout. Handlers that are still running after stopHandlersTimeout
+// are left to complete in the background, and their connections are closed
+// when they do. stop may be called more than once.
 func (c *controller) stop() {
-	c.srv.Stop(stopRPCTimeout)
+	c.stopOnce.Do(func() {
+		done := make(chan struct{})
+		go func() { // S/R-SAFE: only runs when the sandbox is destroyed.
+			c.srv.Stop(stopRPCTimeout)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-gtime.After(stopRPCTimeout + stopHandlersTimeout):
+			log.Warningf("Control server RPCs still running %v after it was stopped, not waiting for them anymore", stopRPCTimeout+stopHandlersTimeout)
+		}
+	})
 }
 
 // containerManager manages sandbox containers.
@@ -216,23 +577,90 @@ type containerManager struct {
 
 	// l is the loader that creates containers and sandboxes.
 	l *Loader
+
+	// draining is set when the sandbox refuses to start new containers, see
+	// SetDrainMode. It's accessed atomically.
+	draining uint32
+
+	// network configures the root network stack. It's nil if the sandbox
+	// doesn't use netstack.
+	network *Network
+
+	// memoryPeaks tracks the peak memory usage of containers reported by
+	// Event.
+	memoryPeaks memoryPeaks
 }
 
+// errDraining is returned when starting a container in drain mode.
+var errDraining = urpc.WithCode(ErrCodeFailedPrecondition, errors.New("sandbox is draining, new containers can't be started"))
+
 // StartRoot will start the root container process.
 func (cm *containerManager) StartRoot(cid *string, _ *struct{}) error {
 	log.Debugf("containerManager.StartRoot, cid: %s", *cid)
+	if atomic.LoadUint32(&cm.draining) != 0 {
+		return errDraining
+	}
 	// Tell the root container to start and wait for the result.
 	cm.startChan <- struct{}{}
 	if err := <-cm.startResultChan; err != nil {
-		return fmt.Errorf("starting sandbox: %v", err)
+		return withDefaultCode(ErrCodeInternal, fmt.Errorf("starting sandbox: %w", err))
+	}
+	return nil
+}
+
+// SetDrainMode enables or disables drain mode. In drain mode, the sandbox
+// refuses to start new containers, while existing containers keep running and
+// can be managed as usual. This allows a node to be decommissioned gracefully.
+func (cm *containerManager) SetDrainMode(enable *bool, _ *struct{}) error {
+	log.Debugf("containerManager.SetDrainMode, enable: %t", *enable)
+	var v uint32
+	if *enable {
+		v = 1
 	}
+	atomic.StoreUint32(&cm.draining, v)
+	return nil
+}
+
+// DrainMode returns whether the sandbox is in drain mode.
+func (cm *containerManager) DrainMode(_ *struct{}, out *bool) error {
+	log.Debugf("containerManager.DrainMode")
+	*out = atomic.LoadUint32(&cm.draining) != 0
 	return nil
 }
 
-// Processes retrieves information about processes running in the sandbox.
-func (cm *containerManager) Processes(cid *string, out *[]*control.Process) error {
-	log.Debugf("containerManager.Processes, cid: %s", *cid)
-	return control.Processes(cm.l.k, *cid, out)
+// ProcessesArgs are arguments to the Processes method.
+type ProcessesArgs struct {
+	// CID is the container whose processes are listed. Processes of all
+	// containers in the sandbox are listed if it's empty.
+	CID string
+
+	// Tree makes Processes return the processes nested in the Children of
+	// their parent, rather than a flat list. The roots are the container
+	// init and processes started with exec.
+	Tree bool
+}
+
+// Processes retrieves information about processes running in the container
+// args.CID, including processes started with exec.
+//
+// When listing a single container, processes that were reparented to a
+// process of another container, which happens when they're orphaned in a
+// container sharing the root PID namespace, are reported as children of the
+// container init.
+func (cm *containerManager) Processes(args *ProcessesArgs, out *[]*control.Process) error {
+	log.Debugf("containerManager.Processes, cid: %s, tree: %t", args.CID, args.Tree)
+	var pl []*control.Process
+	if err := control.Processes(cm.l.k, args.CID, &pl); err != nil {
+		return err
+	}
+	if args.CID != "" {
+		cm.l.reparentToContainerInit(args.CID, pl)
+	}
+	if args.Tree {
+		pl = control.ProcessTree(pl)
+	}
+	*out = pl
+	return nil
 }
 
 // CreateArgs contains arguments to the Create method.
@@ -273,6 +701,15 @@ type StartArgs struct {
 	// CID is the ID of the container to start.
 	CID string
 
+	// IsolatedNetwork indicates that the container gets its own network
+	// stack, which can be configured with Network.CreateLinksAndRoutes,
+	// instead of sharing the root container's.
+	IsolatedNetwork bool
+
+	// SyscallPolicy, if set, restricts the syscalls that the container may
+	// invoke.
+	SyscallPolicy *SyscallPolicy
+
 	// FilePayload contains, in order:
 	//   * stdin, stdout, and stderr (optional: if terminal is disabled).
 	//   * file descriptors to connect to gofer to serve the root filesystem.
@@ -283,20 +720,23 @@ type StartArgs struct {
 func (cm *containerManager) StartSubcontainer(args *StartArgs, _ *struct{}) error {
 	// Validate arguments.
 	if args == nil {
-		return errors.New("start missing arguments")
+		return invalidArgf("start missing arguments")
 	}
 	log.Debugf("containerManager.StartSubcontainer, cid: %s, args: %+v", args.CID, args)
+	if atomic.LoadUint32(&cm.draining) != 0 {
+		return errDraining
+	}
 	if args.Spec == nil {
-		return errors.New("start arguments missing spec")
+		return invalidArgf("start arguments missing spec")
 	}
 	if args.Conf == nil {
-		return errors.New("start arguments missing config")
+		return invalidArgf("start arguments missing config")
 	}
 	if args.CID == "" {
-		return errors.New("start argument missing container ID")
+		return invalidArgf("start argument missing container ID")
 	}
 	if len(args.Files) < 1 {
-		return fmt.Errorf("start arguments must contain at least one file for the container root gofer")
+		return invalidArgf("start arguments must contain at least one file for the container root gofer")
 	}
 
 	// All validation passed, logs the spec for debugging.
@@ -308,7 +748,7 @@ func (cm *containerManager) StartSubcontainer(args *StartArgs, _ *struct{}) erro
 		// When not using a terminal, stdios come as the first 3 files in the
 		// payload.
 		if l := len(args.Files); l < 4 {
-			return fmt.Errorf("start arguments (len: %d) must contain stdios and files for the container root gofer", l)
+			return invalidArgf("start arguments (len: %d) must contain stdios and files for the container root gofer", l)
 		}
 		var err error
 		stdios, err = fd.NewFromFiles(goferFiles[:3])
@@ -333,19 +773,98 @@ func (cm *containerManager) StartSubcontainer(args *StartArgs, _ *struct{}) erro
 		}
 	}()
 
-	if err := cm.l.startSubcontainer(args.Spec, args.Conf, args.CID, stdios, goferFDs); err != nil {
+	// The policy must be in place before the container runs its first
+	// syscall.
+	if args.SyscallPolicy != nil {
+		if err := cm.l.k.SetSyscallPolicy(args.CID, args.SyscallPolicy.kernelPolicy()); err != nil {
+			return urpc.WithCode(ErrCodeInvalidArgument, fmt.Errorf("setting syscall policy: %w", err))
+		}
+	}
+	if err := cm.l.startSubcontainer(args.Spec, args.Conf, args.CID, stdios, goferFDs, args.IsolatedNetwork); err != nil {
 		log.Debugf("containerManager.StartSubcontainer failed, cid: %s, args: %+v, err: %v", args.CID, args, err)
-		return err
+		cm.l.k.ClearSyscallPolicy(args.CID)
+		return withDefaultCode(ErrCodeInternal, err)
 	}
 	log.Debugf("Container started, cid: %s", args.CID)
 	return nil
 }
 
+// DestroyArgs contains arguments to the DestroySubcontainer method.
+type DestroyArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// GracefulTimeoutMs, if positive, is the number of milliseconds the
+	// container init is given to exit after SIGTERM before all processes of
+	// the container are sent SIGKILL. Otherwise, they're sent SIGKILL right
+	// away.
+	GracefulTimeoutMs int64
+}
+
 // DestroySubcontainer stops a container if it is still running and cleans up
 // its filesystem.
-func (cm *containerManager) DestroySubcontainer(cid *string, _ *struct{}) error {
-	log.Debugf("containerManager.DestroySubcontainer, cid: %s", *cid)
-	return cm.l.destroySubcontainer(*cid)
+func (cm *containerManager) DestroySubcontainer(args *DestroyArgs, _ *struct{}) error {
+	log.Debugf("containerManager.DestroySubcontainer, cid: %s, graceful timeout: %dms", args.CID, args.GracefulTimeoutMs)
+	err := cm.l.destroySubcontainer(args.CID, gtime.Duration(args.GracefulTimeoutMs)*gtime.Millisecond)
+	if err == nil {
+		cm.memoryPeaks.remove(args.CID)
+	}
+	return withDefaultCode(ErrCodeInternal, err)
+}
+
+// ErrExecTimeout is returned by Execute if the process was killed because it
+// hadn't exited before its timeout, see control.ExecArgs.TimeoutMs. It's
+// returned over URPC with ErrCodeExecTimeout.
+var ErrExecTimeout = errors.New("process killed after exceeding its timeout")
+
+// Execute runs a command on a created or running sandbox, waits for it to
+// exit and returns its wait status. Unlike ExecuteAsync followed by WaitPID,
+// this takes a single call and the status can't be lost to a concurrent
+// WaitPID.
+func (cm *containerManager) Execute(args *control.ExecArgs, waitStatus *uint32) error {
+	log.Debugf("containerManager.Execute, cid: %s, args: %+v", args.ContainerID, args)
+	ws, err := cm.l.executeSync(args)
+	if err != nil {
+		log.Debugf("containerManager.Execute failed, cid: %s, args: %+v, err: %v", args.ContainerID, args, err)
+		if errors.Is(err, ErrExecTimeout) {
+			return urpc.WithCode(ErrCodeExecTimeout, err)
+		}
+		return withDefaultCode(ErrCodeInternal, err)
+	}
+	*waitStatus = ws
+	log.Debugf("containerManager.Execute returned, cid: %s, waitStatus: %#x", args.ContainerID, ws)
+	return nil
+}
+
+// PreExitHookArgs are arguments to PreExitHook.
+type PreExitHookArgs struct {
+	control.ExecArgs
+
+	// Timeout is how long the hook may run before it's killed.
+	Timeout gtime.Duration
+}
+
+// PreExitHook runs a command in a container that is about to be destroyed,
+// and returns its wait status once it exits. If the command is still running
+// after args.Timeout, it's killed with SIGKILL and ErrExecTimeout is
+// returned. If it doesn't exit after SIGKILL either, an error with
+// ErrCodeInternal is returned.
+func (cm *containerManager) PreExitHook(args *PreExitHookArgs, waitStatus *uint32) error {
+	log.Debugf("containerManager.PreExitHook, cid: %s, args: %+v", args.ContainerID, args)
+	if args.Timeout <= 0 {
+		return invalidArgf("invalid pre-exit hook timeout %v", args.Timeout)
+	}
+	ctx, cancel := gocontext.WithTimeout(gocontext.Background(), args.Timeout)
+	defer cancel()
+	ws, err := cm.l.runPreExitHook(ctx, &args.ExecArgs)
+	if err != nil {
+		if errors.Is(err, ErrExecTimeout) {
+			return urpc.WithCode(ErrCodeExecTimeout, err)
+		}
+		return withDefaultCode(ErrCodeInternal, err)
+	}
+	*waitStatus = ws
+	return nil
 }
 
 // ExecuteAsync starts running a command on a created or running sandbox. It
@@ -362,12 +881,27 @@ func (cm *containerManager) ExecuteAsync(args *control.ExecArgs, pid *int32) err
 }
 
 // Checkpoint pauses a sandbox and saves its state.
+//
+// The state is always saved in full: the memory file is written out in
+// SaveTo by scanning all of its pages while the kernel is paused, and no
+// dirty page tracking exists that would allow saving only the pages changed
+// since an earlier checkpoint.
+//
+// The sandbox is always killed once the state is saved. Saving freezes
+// network endpoints and drops file caches in a way that only a restore
+// undoes, so the sandbox can't be resumed in place; callers that want the
+// container to keep running must restore it from the image.
 func (cm *containerManager) Checkpoint(o *control.SaveOpts, _ *struct{}) error {
 	log.Debugf("containerManager.Checkpoint")
 	// TODO(gvisor.dev/issues/6243): save/restore not supported w/ hostinet
 	if cm.l.root.conf.Network == config.NetworkHost {
-		return errors.New("checkpoint not supported when using hostinet")
+		return urpc.WithCode(ErrCodeUnimplemented, errors.New("checkpoint not supported when using hostinet"))
+	}
+
+	if o.Metadata == nil {
+		o.Metadata = make(map[string]string)
 	}
+	addCompatMetadata(o.Metadata, cm.l.root.conf)
 
 	state := control.State{
 		Kernel:   cm.l.k,
@@ -376,44 +910,152 @@ func (cm *containerManager) Checkpoint(o *control.SaveOpts, _ *struct{}) error {
 	return state.Save(o, nil)
 }
 
+// CheckpointContainerArgs are arguments to the CheckpointContainer method.
+type CheckpointContainerArgs struct {
+	control.SaveOpts
+
+	// CID is the ID of the container to checkpoint.
+	CID string
+}
+
+// CheckpointContainer is meant to save the state of a single container, with a
+// matching single-container restore. It's deferred: it isn't implemented yet
+// and always fails with ErrCodeUnimplemented, so that clients can detect it.
+//
+// Implementing it requires per-container state isolation in the save format,
+// which covers the entire kernel shared by all containers in the sandbox:
+// tasks of different containers may share memory, file descriptors, sockets
+// and namespaces, so there is no per-container state to save on its own. Until
+// then, use Checkpoint to save the whole sandbox.
+func (cm *containerManager) CheckpointContainer(args *CheckpointContainerArgs, _ *struct{}) error {
+	log.Debugf("containerManager.CheckpointContainer, cid: %s", args.CID)
+	return urpc.WithCode(ErrCodeUnimplemented, fmt.Errorf("checkpointing container %q alone is not supported, checkpoint the entire sandbox instead", args.CID))
+}
+
+// SetCheckpointFile sets the file that the sandbox is checkpointed to when
+// the checkpoint signal (see config.Config.CheckpointSignal) is sent to the
+// root container's init process. Each checkpoint uses up the file, so a new
+// one must be set before the next checkpoint. Setting a file replaces the
+// previous one, if it hasn't been used yet.
+func (cm *containerManager) SetCheckpointFile(o *control.SaveOpts, _ *struct{}) error {
+	log.Debugf("containerManager.SetCheckpointFile")
+	if len(o.FilePayload.Files) != 1 {
+		return urpc.WithCode(ErrCodeInvalidArgument, control.ErrInvalidFiles)
+	}
+	if cm.l.root.conf.CheckpointSignal == -1 {
+		o.FilePayload.Files[0].Close()
+		return urpc.WithCode(ErrCodeFailedPrecondition, errors.New("checkpoint signal is not configured, see --checkpoint-signal"))
+	}
+	// TODO(gvisor.dev/issues/6243): save/restore not supported w/ hostinet
+	if cm.l.root.conf.Network == config.NetworkHost {
+		o.FilePayload.Files[0].Close()
+		return urpc.WithCode(ErrCodeUnimplemented, errors.New("checkpoint not supported when using hostinet"))
+	}
+	cm.l.checkpointFile.set(o)
+	return nil
+}
+
 // RestoreOpts contains options related to restoring a container's file system.
 type RestoreOpts struct {
 	// FilePayload contains the state file to be restored, followed by the
-	// platform device file if necessary.
+	// platform device file if necessary. The state file may be a regular file,
+	// or a socket or pipe from which the state is streamed.
 	urpc.FilePayload
 
 	// SandboxID contains the ID of the sandbox.
 	SandboxID string
+
+	// NetworkOverride, if set, replaces the links and routes of the root
+	// network stack once the state is loaded, e.g. when restoring on a host
+	// with different addressing. The FDs of its FDBasedLinks follow the
+	// other files in FilePayload, and its own FilePayload is ignored.
+	NetworkOverride *CreateLinksAndRoutesArgs
 }
 
 // Restore loads a container from a statefile.
 // The container's current kernel is destroyed, a restore environment is
 // created, and the kernel is recreated with the restore state file. The
 // container then sends the signal to start.
-func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
+func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) (retErr error) {
 	log.Debugf("containerManager.Restore")
+	defer func() {
+		retErr = withDefaultCode(ErrCodeInternal, retErr)
+	}()
+
+	files := o.Files
+	if o.NetworkOverride != nil {
+		if cm.network == nil {
+			return urpc.WithCode(ErrCodeFailedPrecondition, fmt.Errorf("network override requires netstack"))
+		}
+		// Checked here as well, so that the old kernel keeps running.
+		if len(o.NetworkOverride.LoopbackLinks) > 0 {
+			return invalidArgf("network override can't contain loopback links")
+		}
+		wantFDs := 0
+		for _, l := range o.NetworkOverride.FDBasedLinks {
+			wantFDs += l.NumChannels
+		}
+		if wantFDs > len(files) {
+			return invalidArgf("%d files were passed to Restore but the network override needs %d", len(files), wantFDs)
+		}
+		o.NetworkOverride.FilePayload.Files = files[len(files)-wantFDs:]
+		files = files[:len(files)-wantFDs]
+	}
 
 	var specFile, deviceFile *os.File
-	switch numFiles := len(o.Files); numFiles {
+	switch numFiles := len(files); numFiles {
 	case 2:
 		// The device file is donated to the platform.
 		// Can't take ownership away from os.File. dup them to get a new FD.
-		fd, err := unix.Dup(int(o.Files[1].Fd()))
+		fd, err := unix.Dup(int(files[1].Fd()))
 		if err != nil {
 			return fmt.Errorf("failed to dup file: %v", err)
 		}
 		deviceFile = os.NewFile(uintptr(fd), "platform device")
 		fallthrough
 	case 1:
-		specFile = o.Files[0]
+		specFile = files[0]
 	case 0:
-		return fmt.Errorf("at least one file must be passed to Restore")
+		return invalidArgf("at least one file must be passed to Restore")
 	default:
-		return fmt.Errorf("at most two files may be passed to Restore")
+		return invalidArgf("at most two files may be passed to Restore")
+	}
+
+	// Validate the state file before touching the running kernel, so that it
+	// keeps running if the state file can't be loaded.
+	info, err := specFile.Stat()
+	if err != nil {
+		return err
+	}
+	// The state may also be streamed through a socket or pipe, in which case
+	// the size is unknown until the stream has been fully read.
+	if info.Mode().IsRegular() && info.Size() == 0 {
+		return invalidArgf("file cannot be empty")
+	}
+	// The header is read from the stream, so it's kept to be read again by
+	// the loader below.
+	var header bytes.Buffer
+	metadata, err := statefile.MetadataUnsafe(io.TeeReader(specFile, &header))
+	if err != nil {
+		return invalidArgf("invalid state file: %w", err)
+	}
+	if err := state.CheckVersion(metadata); err != nil {
+		return invalidArgf("invalid state file: %w", err)
+	}
+	if err := checkCompatMetadata(metadata, cm.l.root.conf); err != nil {
+		return urpc.WithCode(ErrCodeFailedPrecondition, err)
 	}
 
-	// Pause the kernel while we build a new one.
+	// Pause the kernel while we build a new one. Resume it if we fail before
+	// the new kernel starts loading the state.
 	cm.l.k.Pause()
+	oldKernel := cm.l.k
+	loading := false
+	defer func() {
+		if !loading {
+			oldKernel.Unpause()
+		}
+	}()
 
 	p, err := createPlatform(cm.l.root.conf, deviceFile)
 	if err != nil {
@@ -427,12 +1069,14 @@ func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 		return fmt.Errorf("creating memory file: %v", err)
 	}
 	k.SetMemoryFile(mf)
+	if cm.l.root.conf.FutexStats {
+		k.EnableFutexStats()
+	}
 	networkStack := cm.l.k.RootNetworkNamespace().Stack()
-	cm.l.k = k
 
 	// Set up the restore environment.
 	ctx := k.SupervisorContext()
-	mntr := newContainerMounter(&cm.l.root, cm.l.k, cm.l.mountHints, kernel.VFS2Enabled, cm.l.productName)
+	mntr := newContainerMounter(&cm.l.root, k, cm.l.mountHints, kernel.VFS2Enabled, cm.l.productName)
 	if kernel.VFS2Enabled {
 		ctx, err = mntr.configureRestore(ctx)
 		if err != nil {
@@ -450,13 +1094,6 @@ func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 	if eps, ok := networkStack.(*netstack.Stack); ok {
 		stack.StackFromEnv = eps.Stack // FIXME(b/36201077)
 	}
-	info, err := specFile.Stat()
-	if err != nil {
-		return err
-	}
-	if info.Size() == 0 {
-		return fmt.Errorf("file cannot be empty")
-	}
 
 	if cm.l.root.conf.ProfileEnable {
 		// pprof.Initialize opens /proc/self/maps, so has to be called before
@@ -469,20 +1106,31 @@ func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 		return err
 	}
 
-	// Load the state.
-	loadOpts := state.LoadOpts{Source: specFile}
+	// Load the state. From here on, the old kernel can't be resumed, as
+	// loading modifies state shared with it, like the network stack.
+	loading = true
+	cm.l.k = k
+	loadOpts := state.LoadOpts{Source: io.MultiReader(&header, specFile)}
 	if err := loadOpts.Load(ctx, k, nil, networkStack, time.NewCalibratedClocks(), &vfs.CompleteRestoreOptions{}); err != nil {
 		return err
 	}
 
-	// Since we have a new kernel we also must make a new watchdog.
+	// Replace the checkpointed network configuration before the restored
+	// tasks start using it.
+	if o.NetworkOverride != nil {
+		if err := cm.network.replaceLinksAndRoutes(o.NetworkOverride); err != nil {
+			return fmt.Errorf("overriding network configuration: %w", err)
+		}
+	}
+
+	// Since we have a new kernel we also must make a new watchdog. It keeps
+	// the configuration set by debug.SetWatchdogConfig, if any.
 	dogOpts := watchdog.DefaultOpts
-	dogOpts.TaskTimeoutAction = cm.l.root.conf.WatchdogAction
+	dogOpts.TaskTimeout, dogOpts.TaskTimeoutAction = cm.l.watchdog.TaskConfig()
 	dog := watchdog.New(k, dogOpts)
 
 	// Change the loader fields to reflect the changes made when restoring.
 	cm.l.k = k
-	cm.l.watchdog = dog
 	cm.l.root.procArgs = kernel.CreateProcessArgs{}
 	cm.l.restore = true
 
@@ -490,6 +1138,7 @@ func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 	// restore the state of multiple containers, nor exec processes.
 	cm.l.sandboxID = o.SandboxID
 	cm.l.mu.Lock()
+	cm.l.watchdog = dog
 	eid := execID{cid: o.SandboxID}
 	cm.l.processes = map[execID]*execProcess{
 		eid: {
@@ -507,86 +1156,1164 @@ func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 	return nil
 }
 
-// Wait waits for the init process in the given container.
-func (cm *containerManager) Wait(cid *string, waitStatus *uint32) error {
-	log.Debugf("containerManager.Wait, cid: %s", *cid)
-	err := cm.l.waitContainer(*cid, waitStatus)
-	log.Debugf("containerManager.Wait returned, cid: %s, waitStatus: %#x, err: %v", *cid, *waitStatus, err)
-	return err
+// PauseContainerArgs are arguments to the PauseContainer method.
+type PauseContainerArgs struct {
+	// CancelPayload allows giving up if the processes don't stop, e.g.
+	// because they're stuck in the host. The container is then resumed and
+	// urpc.ErrCanceled is returned.
+	urpc.CancelPayload
+
+	// CID is the container ID.
+	CID string
 }
 
-// WaitPIDArgs are arguments to the WaitPID method.
-type WaitPIDArgs struct {
-	// PID is the PID in the container's PID namespace.
-	PID int32
+// PauseContainer stops all processes of the given container, including the
+// ones exec'd in it and their children, and blocks until they have stopped.
+// Unlike Lifecycle.Pause, other containers in the sandbox keep running.
+func (cm *containerManager) PauseContainer(args *PauseContainerArgs, _ *struct{}) error {
+	log.Debugf("containerManager.PauseContainer, cid: %s, timeout: %v", args.CID, args.Timeout)
+	return cm.l.pauseContainer(args.CID, args.Done())
+}
+
+// ResumeContainer resumes the processes of the given container stopped by
+// PauseContainer.
+func (cm *containerManager) ResumeContainer(cid *string, _ *struct{}) error {
+	log.Debugf("containerManager.ResumeContainer, cid: %s", *cid)
+	return cm.l.resumeContainer(*cid)
+}
 
+// ContainerInfo describes a container returned by ListContainers.
+type ContainerInfo struct {
 	// CID is the container ID.
 	CID string
+
+	// PID is the PID of the container init process in the root PID
+	// namespace. It's 0 if the container hasn't started or its init process
+	// has been reaped.
+	PID int32
 }
 
-// WaitPID waits for the process with PID 'pid' in the sandbox.
-func (cm *containerManager) WaitPID(args *WaitPIDArgs, waitStatus *uint32) error {
-	log.Debugf("containerManager.Wait, cid: %s, pid: %d", args.CID, args.PID)
-	err := cm.l.waitPID(kernel.ThreadID(args.PID), args.CID, waitStatus)
-	log.Debugf("containerManager.Wait, cid: %s, pid: %d, waitStatus: %#x, err: %v", args.CID, args.PID, *waitStatus, err)
-	return err
+// ListContainers returns all containers known to the sandbox, sorted by ID,
+// whether they're started or not. This lets the host reconcile its state with
+// the sandbox's, e.g. after runsc crashed.
+func (cm *containerManager) ListContainers(_ *struct{}, out *[]ContainerInfo) error {
+	log.Debugf("containerManager.ListContainers")
+	*out = cm.l.listContainers()
+	return nil
 }
 
-// SignalDeliveryMode enumerates different signal delivery modes.
-type SignalDeliveryMode int
+// ContainerLifecycleState is the lifecycle state of a container, see Status.
+type ContainerLifecycleState int
 
 const (
-	// DeliverToProcess delivers the signal to the container process with
-	// the specified PID. If PID is 0, then the container init process is
-	// signaled.
-	DeliverToProcess SignalDeliveryMode = iota
+	// ContainerCreating means that the container is being created. The
+	// sandbox only learns about containers once they're created, so it never
+	// reports this state, which is kept to match the OCI states.
+	ContainerCreating ContainerLifecycleState = iota
 
-	// DeliverToAllProcesses delivers the signal to all processes in the
-	// container. PID must be 0.
-	DeliverToAllProcesses
+	// ContainerCreated means that the container was created, but hasn't
+	// been started yet.
+	ContainerCreated
 
-	// DeliverToForegroundProcessGroup delivers the signal to the
-	// foreground process group in the same TTY session as the specified
-	// process. If PID is 0, then the signal is delivered to the foreground
-	// process group for the TTY for the init process.
-	DeliverToForegroundProcessGroup
+	// ContainerRunning means that the container init process is running.
+	ContainerRunning
+
+	// ContainerPaused means that the container init process is running, but
+	// the container or the whole sandbox is paused.
+	ContainerPaused
+
+	// ContainerStopped means that the container init process has exited.
+	ContainerStopped
 )
 
-func (s SignalDeliveryMode) String() string {
+func (s ContainerLifecycleState) String() string {
 	switch s {
-	case DeliverToProcess:
-		return "Process"
-	case DeliverToAllProcesses:
-		return "All"
-	case DeliverToForegroundProcessGroup:
-		return "Foreground Process Group"
+	case ContainerCreating:
+		return "creating"
+	case ContainerCreated:
+		return "created"
+	case ContainerRunning:
+		return "running"
+	case ContainerPaused:
+		return "paused"
+	case ContainerStopped:
+		return "stopped"
 	}
-	return fmt.Sprintf("unknown signal delivery mode: %d", s)
+	return fmt.Sprintf("unknown container state: %d", s)
 }
 
-// SignalArgs are arguments to the Signal method.
-type SignalArgs struct {
-	// CID is the container ID.
-	CID string
-
-	// Signo is the signal to send to the process.
-	Signo int32
+// ContainerStatus is the status of a container returned by Status.
+type ContainerStatus struct {
+	// State is the lifecycle state of the container.
+	State ContainerLifecycleState
 
-	// PID is the process ID in the given container that will be signaled,
-	// relative to the root PID namespace, not the container's.
-	// If 0, the root container will be signalled.
+	// PID is the PID of the container init process in the root PID
+	// namespace. It's 0 unless the container is running or paused.
 	PID int32
 
-	// Mode is the signal delivery mode.
-	Mode SignalDeliveryMode
+	// ExitStatus is the raw wait status of the container init process. It's
+	// only set if the container is stopped.
+	ExitStatus uint32
 }
 
-// Signal sends a signal to one or more processes in a container. If args.PID
-// is 0, then the container init process is used. Depending on the
-// args.SignalDeliveryMode option, the signal may be sent directly to the
-// indicated process, to all processes in the container, or to the foreground
+// Status returns the lifecycle state of the given container. Unlike inferring
+// it from Wait, it doesn't block and doesn't consume the exit status.
+func (cm *containerManager) Status(cid *string, out *ContainerStatus) error {
+	log.Debugf("containerManager.Status, cid: %s", *cid)
+	status, err := cm.l.containerStatus(*cid)
+	if err != nil {
+		return err
+	}
+	*out = status
+	return nil
+}
+
+// Wait waits for the init process in the given container.
+func (cm *containerManager) Wait(cid *string, waitStatus *uint32) error {
+	log.Debugf("containerManager.Wait, cid: %s", *cid)
+	err := cm.l.waitContainer(*cid, false /* noHang */, nil /* cancel */, waitStatus)
+	log.Debugf("containerManager.Wait returned, cid: %s, waitStatus: %#x, err: %v", *cid, *waitStatus, err)
+	return withDefaultCode(ErrCodeInternal, err)
+}
+
+// ProcessExitStatus is the exit status of a process returned by WaitAll.
+type ProcessExitStatus struct {
+	// PID is the PID of the process.
+	PID int32
+
+	// ExitStatus is the raw wait status of the process.
+	ExitStatus uint32
+}
+
+// WaitAll returns the exit status of every process exec'd in the given
+// container that has already exited and hasn't been waited for yet, and
+// clears them so they can't be waited for again. It doesn't block on
+// processes that are still running.
+func (cm *containerManager) WaitAll(cid *string, statuses *[]ProcessExitStatus) error {
+	log.Debugf("containerManager.WaitAll, cid: %s", *cid)
+	all, err := cm.l.waitAll(*cid)
+	if err != nil {
+		return err
+	}
+	*statuses = all
+	log.Debugf("containerManager.WaitAll returned, cid: %s, statuses: %+v", *cid, all)
+	return nil
+}
+
+// WaitContainerArgs are arguments to the WaitContainer method.
+type WaitContainerArgs struct {
+	// CancelPayload allows giving up waiting, in which case
+	// urpc.ErrCanceled is returned.
+	urpc.CancelPayload
+
+	// CID is the container ID.
+	CID string
+
+	// NoHang makes WaitContainer return ErrStillRunning right away if the
+	// container is still running, like WNOHANG for waitpid(2).
+	NoHang bool
+}
+
+// ErrStillRunning is returned by WaitContainer if NoHang is set and the
+// container is still running. It's returned over URPC with
+// ErrCodeStillRunning.
+var ErrStillRunning = errors.New("container is still running")
+
+// WaitContainer waits for the init process in the given container, like Wait,
+// which is kept for callers that pass only the container ID. Unlike Wait, it
+// can be canceled, e.g. when the caller goes away.
+func (cm *containerManager) WaitContainer(args *WaitContainerArgs, waitStatus *uint32) error {
+	log.Debugf("containerManager.WaitContainer, cid: %s, noHang: %t, timeout: %v", args.CID, args.NoHang, args.Timeout)
+	err := cm.l.waitContainer(args.CID, args.NoHang, args.Done(), waitStatus)
+	log.Debugf("containerManager.WaitContainer returned, cid: %s, waitStatus: %#x, err: %v", args.CID, *waitStatus, err)
+	if errors.Is(err, ErrStillRunning) {
+		return urpc.WithCode(ErrCodeStillRunning, err)
+	}
+	return err
+}
+
+// WaitDetailed waits for the init process in the given container, like Wait,
+// and returns its exit code or terminating signal instead of the raw wait
+// status.
+func (cm *containerManager) WaitDetailed(cid *string, out *ExitResult) error {
+	log.Debugf("containerManager.WaitDetailed, cid: %s", *cid)
+	var waitStatus uint32
+	err := cm.l.waitContainer(*cid, false /* noHang */, nil /* cancel */, &waitStatus)
+	if err == nil {
+		*out = newExitResult(*cid, unix.WaitStatus(waitStatus))
+	}
+	log.Debugf("containerManager.WaitDetailed returned, cid: %s, result: %+v, err: %v", *cid, *out, err)
+	return err
+}
+
+// WaitOCI waits for the init process in the given container, like Wait, and
+// returns its exit status translated to the OCI convention in addition to the
+// raw wait status.
+func (cm *containerManager) WaitOCI(cid *string, out *WaitResult) error {
+	log.Debugf("containerManager.WaitOCI, cid: %s", *cid)
+	var waitStatus uint32
+	err := cm.l.waitContainer(*cid, false /* noHang */, nil /* cancel */, &waitStatus)
+	if err == nil {
+		*out = newWaitResult(unix.WaitStatus(waitStatus))
+	}
+	log.Debugf("containerManager.WaitOCI returned, cid: %s, waitStatus: %#x, err: %v", *cid, waitStatus, err)
+	return err
+}
+
+// WaitPIDArgs are arguments to the WaitPID method.
+type WaitPIDArgs struct {
+	// CancelPayload allows giving up waiting, in which case
+	// urpc.ErrCanceled is returned. Unlike TimeoutMs, its timeout is
+	// measured with the host's clock.
+	urpc.CancelPayload
+
+	// PID is the PID in the container's PID namespace.
+	PID int32
+
+	// CID is the container ID.
+	CID string
+
+	// TimeoutMs is how long to wait for the process to exit, in
+	// milliseconds. If 0, WaitPID blocks until the process exits.
+	TimeoutMs int64
+
+	// KeepStatus keeps the exit status of a process started with exec, so
+	// it can be waited for again. By default, the status is cleared once the
+	// process has exited, after which it can't be waited for anymore; if
+	// several callers clear the status concurrently, only one of them gets
+	// it, the others fail. It doesn't affect other processes, whose status
+	// is kept for their parent.
+	KeepStatus bool
+}
+
+// ErrWaitTimeout is returned by WaitPID if the process hasn't exited within
+// the timeout. It's returned over URPC with ErrCodeWaitTimeout.
+var ErrWaitTimeout = errors.New("timed out waiting for the process to exit")
+
+// WaitPID waits for the process with PID 'pid' in the sandbox. A wait that
+// times out doesn't consume the exit status, so the process can be waited
+// for again.
+func (cm *containerManager) WaitPID(args *WaitPIDArgs, waitStatus *uint32) error {
+	log.Debugf("containerManager.Wait, cid: %s, pid: %d, timeout: %dms", args.CID, args.PID, args.TimeoutMs)
+	if args.TimeoutMs < 0 {
+		return invalidArgf("timeout (%dms) must not be negative", args.TimeoutMs)
+	}
+	timeout := gtime.Duration(args.TimeoutMs) * gtime.Millisecond
+	err := cm.l.waitPID(kernel.ThreadID(args.PID), args.CID, timeout, !args.KeepStatus, args.Done(), waitStatus)
+	log.Debugf("containerManager.Wait, cid: %s, pid: %d, waitStatus: %#x, err: %v", args.CID, args.PID, *waitStatus, err)
+	if errors.Is(err, ErrWaitTimeout) {
+		return urpc.WithCode(ErrCodeWaitTimeout, err)
+	}
+	return err
+}
+
+// SignalDeliveryMode enumerates different signal delivery modes.
+type SignalDeliveryMode int
+
+const (
+	// DeliverToProcess delivers the signal to the container process with
+	// the specified PID. If PID is 0, then the container init process is
+	// signaled.
+	DeliverToProcess SignalDeliveryMode = iota
+
+	// DeliverToAllProcesses delivers the signal to all processes in the
+	// container. PID must be 0.
+	DeliverToAllProcesses
+
+	// DeliverToForegroundProcessGroup delivers the signal to the
+	// foreground process group in the same TTY session as the specified
+	// process. If PID is 0, then the signal is delivered to the foreground
+	// process group for the TTY for the init process.
+	DeliverToForegroundProcessGroup
+)
+
+func (s SignalDeliveryMode) String() string {
+	switch s {
+	case DeliverToProcess:
+		return "Process"
+	case DeliverToAllProcesses:
+		return "All"
+	case DeliverToForegroundProcessGroup:
+		return "Foreground Process Group"
+	}
+	return fmt.Sprintf("unknown signal delivery mode: %d", s)
+}
+
+// SignalArgs are arguments to the Signal method.
+type SignalArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// Signo is the signal to send to the process.
+	Signo int32
+
+	// PID is the process ID in the given container that will be signaled,
+	// relative to the root PID namespace, not the container's. It can be
+	// any process of the container, e.g. one started with exec. If 0, the
+	// container init process is signaled.
+	PID int32
+
+	// Mode is the signal delivery mode.
+	Mode SignalDeliveryMode
+
+	// Value is passed to the handler of realtime signals in si_value, like
+	// with sigqueue(3). It's ignored for other signals.
+	Value int64
+}
+
+// SignalResult is the result of the Signal method.
+type SignalResult struct {
+	// Count is the number of processes signaled. Processes that exited
+	// while the signal was delivered aren't counted.
+	Count int
+
+	// The fields below are only set when a single process is signaled, i.e.
+	// in DeliverToProcess mode.
+
+	// PID is the signaled process, relative to the root PID namespace.
+	PID int32
+
+	// State is the state of the process' thread group leader after the
+	// signal was sent, as reported by /proc/[pid]/status, e.g. "R (running)",
+	// "T (stopped)" or "Z (zombie)".
+	State string
+
+	// Coalesced is true if the signal was merged with the same standard
+	// signal that was already pending, i.e. it will only be delivered once.
+	Coalesced bool
+}
+
+// Signal sends a signal to one or more processes in a container. If args.PID
+// is 0, then the container init process is used. Depending on the
+// args.SignalDeliveryMode option, the signal may be sent directly to the
+// indicated process, to all processes in the container, or to the foreground
 // process group.
-func (cm *containerManager) Signal(args *SignalArgs, _ *struct{}) error {
-	log.Debugf("containerManager.Signal: cid: %s, PID: %d, signal: %d, mode: %v", args.CID, args.PID, args.Signo, args.Mode)
-	return cm.l.signal(args.CID, args.PID, args.Signo, args.Mode)
+func (cm *containerManager) Signal(args *SignalArgs, out *SignalResult) error {
+	log.Debugf("containerManager.Signal: cid: %s, PID: %d, signal: %d, mode: %v, value: %d", args.CID, args.PID, args.Signo, args.Mode, args.Value)
+	res, err := cm.l.signal(args.CID, args.PID, args.Signo, args.Value, args.Mode)
+	if err != nil {
+		return withDefaultCode(ErrCodeInternal, err)
+	}
+	*out = res
+	return nil
+}
+
+// SignalProcessGroupArgs are arguments to the SignalProcessGroup method.
+type SignalProcessGroupArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// PGID is the ID of the process group to signal, relative to the
+	// container's PID namespace.
+	PGID int32
+
+	// Signo is the signal to send to the processes.
+	Signo int32
+}
+
+// SignalProcessGroup sends a signal to every process of a container in the
+// given process group, like kill(2) with a negative PID.
+func (cm *containerManager) SignalProcessGroup(args *SignalProcessGroupArgs, out *SignalResult) error {
+	log.Debugf("containerManager.SignalProcessGroup: cid: %s, PGID: %d, signal: %d", args.CID, args.PGID, args.Signo)
+	if args.PGID <= 0 {
+		return invalidArgf("PGID (%d) must be positive", args.PGID)
+	}
+	count, err := cm.l.signalProcessGroup(args.CID, kernel.ProcessGroupID(args.PGID), args.Signo)
+	if err != nil {
+		return withDefaultCode(ErrCodeInternal, fmt.Errorf("signaling process group %d in container %q: %w", args.PGID, args.CID, err))
+	}
+	out.Count = count
+	return nil
+}
+
+// ResizeTTYArgs are arguments to the ResizeTTY method.
+type ResizeTTYArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// PID is the process whose TTY is resized, relative to the root PID
+	// namespace. It must be the container init process or a process started
+	// with exec with StdioIsPty set. If 0, the container init process is
+	// used.
+	PID int32
+
+	// Rows and Cols are the new size of the terminal, in characters.
+	Rows uint16
+	Cols uint16
+}
+
+// ResizeTTY sets the window size of the TTY of a process and sends SIGWINCH
+// to the TTY's foreground process group. It's used to propagate the size of
+// the terminal on the host side of a pty to the sandbox, whose processes
+// don't get the host's SIGWINCH.
+func (cm *containerManager) ResizeTTY(args *ResizeTTYArgs, _ *struct{}) error {
+	log.Debugf("containerManager.ResizeTTY: cid: %s, PID: %d, rows: %d, cols: %d", args.CID, args.PID, args.Rows, args.Cols)
+	ws := linux.Winsize{Row: args.Rows, Col: args.Cols}
+	if err := cm.l.resizeTTY(args.CID, kernel.ThreadID(args.PID), &ws); err != nil {
+		return withDefaultCode(ErrCodeInternal, fmt.Errorf("resizing TTY of PID %d in container %q: %w", args.PID, args.CID, err))
+	}
+	return nil
+}
+
+// FutexStats contains futex wait statistics for a single container.
+type FutexStats struct {
+	// Waits is the number of futex waits that blocked.
+	Waits uint64 `json:"waits"`
+
+	// WaitTime is the total time spent blocked in futex waits.
+	WaitTime gtime.Duration `json:"waitTime"`
+
+	// MaxWaitTime is the longest time spent blocked in a single futex wait.
+	MaxWaitTime gtime.Duration `json:"maxWaitTime"`
+}
+
+// FutexStats retrieves futex wait statistics for the given container. It
+// fails if futex statistics collection hasn't been enabled.
+func (cm *containerManager) FutexStats(cid *string, out *FutexStats) error {
+	log.Debugf("containerManager.FutexStats, cid: %s", *cid)
+	if !cm.l.k.FutexStatsEnabled() {
+		return urpc.WithCode(ErrCodeFailedPrecondition, errors.New("futex statistics are disabled, enable them with --futex-stats"))
+	}
+	stats := cm.l.k.FutexStats(*cid)
+	*out = FutexStats{
+		Waits:       stats.Waits,
+		WaitTime:    stats.WaitTime,
+		MaxWaitTime: stats.MaxWaitTime,
+	}
+	return nil
+}
+
+// SetReadAheadArgs are arguments to the SetReadAhead method.
+type SetReadAheadArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// Size is the read-ahead window in bytes. It is rounded up to the page
+	// size. 0 restores the default window.
+	Size uint64
+}
+
+// SetReadAhead sets the maximum number of bytes that are read ahead when the
+// given container reads files through the page cache. Larger windows reduce
+// the number of round trips to the gofer for large sequential reads.
+func (cm *containerManager) SetReadAhead(args *SetReadAheadArgs, _ *struct{}) error {
+	log.Debugf("containerManager.SetReadAhead, cid: %s, size: %d", args.CID, args.Size)
+	if _, err := cm.l.threadGroupFromID(execID{cid: args.CID}); err != nil {
+		return err
+	}
+	return cm.l.k.SetReadAhead(args.CID, args.Size)
+}
+
+// ReadAhead retrieves the read-ahead window of the given container.
+func (cm *containerManager) ReadAhead(cid *string, size *uint64) error {
+	log.Debugf("containerManager.ReadAhead, cid: %s", *cid)
+	*size = cm.l.k.ReadAhead(*cid)
+	return nil
+}
+
+// SetSyncPolicyArgs are arguments to the SetSyncPolicy method.
+type SetSyncPolicyArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// Policy is the sync policy: "durable", "relaxed" or "none".
+	Policy string
+}
+
+// SetSyncPolicy sets how fsync(2) and fdatasync(2) issued by the given
+// container are propagated to the host through the gofer, see vfs.SyncPolicy:
+//
+//   - "durable" writes data back to the host and syncs it, so that it survives
+//     a host crash. This is the default.
+//   - "relaxed" writes data back to the host without syncing it, which is
+//     faster but loses the data if the host crashes.
+//   - "none" skips fsync entirely, which is the fastest but may also lose data
+//     still cached in the sandbox if the sandbox crashes.
+//
+// The relaxed modes break the durability guarantees that databases and other
+// applications rely on, and must only be used when the data can be recreated.
+// sync(2) and syncfs(2) always sync.
+func (cm *containerManager) SetSyncPolicy(args *SetSyncPolicyArgs, _ *struct{}) error {
+	log.Debugf("containerManager.SetSyncPolicy, cid: %s, policy: %s", args.CID, args.Policy)
+	p, err := vfs.ParseSyncPolicy(args.Policy)
+	if err != nil {
+		return err
+	}
+	if _, err := cm.l.threadGroupFromID(execID{cid: args.CID}); err != nil {
+		return err
+	}
+	cm.l.k.SetSyncPolicy(args.CID, p)
+	return nil
+}
+
+// SyncPolicy retrieves the sync policy of the given container.
+func (cm *containerManager) SyncPolicy(cid *string, policy *string) error {
+	log.Debugf("containerManager.SyncPolicy, cid: %s", *cid)
+	*policy = cm.l.k.SyncPolicy(*cid).String()
+	return nil
+}
+
+// SchedLatency holds the scheduling latency targets of a container, see
+// kernel.SchedLatency.
+type SchedLatency struct {
+	// Latency is the target period in which every runnable task of the
+	// container should run at least once.
+	Latency gtime.Duration `json:"latency"`
+
+	// Timeslice is the minimum time a task of the container may run before
+	// being preempted.
+	Timeslice gtime.Duration `json:"timeslice"`
+}
+
+// SetSchedLatencyArgs are arguments to the SetSchedLatency method.
+type SetSchedLatencyArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// Latency holds the new targets. A zero value restores the defaults.
+	Latency SchedLatency
+}
+
+// SetSchedLatency sets the scheduling latency targets of the given container,
+// trading throughput for latency. Targets that the sentry scheduler can't
+// honor fail with an error saying so.
+func (cm *containerManager) SetSchedLatency(args *SetSchedLatencyArgs, _ *struct{}) error {
+	log.Debugf("containerManager.SetSchedLatency, cid: %s, latency: %+v", args.CID, args.Latency)
+	if _, err := cm.l.threadGroupFromID(execID{cid: args.CID}); err != nil {
+		return err
+	}
+	return cm.l.k.SetSchedLatency(args.CID, kernel.SchedLatency{
+		Latency:   args.Latency.Latency,
+		Timeslice: args.Latency.Timeslice,
+	})
+}
+
+// SchedLatency retrieves the scheduling latency targets of the given container.
+func (cm *containerManager) SchedLatency(cid *string, out *SchedLatency) error {
+	log.Debugf("containerManager.SchedLatency, cid: %s", *cid)
+	lat := cm.l.k.SchedLatency(*cid)
+	*out = SchedLatency{
+		Latency:   lat.Latency,
+		Timeslice: lat.Timeslice,
+	}
+	return nil
+}
+
+// SetDiskQuotaArgs are arguments to the SetDiskQuota method.
+type SetDiskQuotaArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// Limit is the maximum size of the container's writable layer in bytes.
+	// 0 removes the limit.
+	Limit uint64
+}
+
+// DiskQuota reports the size limit and usage of a container's writable layer.
+type DiskQuota struct {
+	// Limit is the maximum size in bytes, or 0 if there is no limit.
+	Limit uint64 `json:"limit"`
+
+	// Usage is the total size of the files in the writable layer in bytes.
+	Usage uint64 `json:"usage"`
+}
+
+// SetDiskQuota limits the size of the given container's writable layer, which
+// holds the changes made to its root filesystem when running with --overlay.
+// Writes that would exceed the limit fail with ENOSPC. The limit may be lowered
+// below the current usage, in which case files can still be overwritten or
+// shrunk, but not grown until usage drops below the limit.
+func (cm *containerManager) SetDiskQuota(args *SetDiskQuotaArgs, _ *struct{}) error {
+	log.Debugf("containerManager.SetDiskQuota, cid: %s, limit: %d", args.CID, args.Limit)
+	return cm.l.withWritableLayer(args.CID, func(upper *vfs.Filesystem) error {
+		return tmpfs.SetSizeLimit(upper, args.Limit)
+	})
+}
+
+// DiskQuota retrieves the size limit and usage of the given container's
+// writable layer.
+func (cm *containerManager) DiskQuota(cid *string, out *DiskQuota) error {
+	log.Debugf("containerManager.DiskQuota, cid: %s", *cid)
+	return cm.l.withWritableLayer(*cid, func(upper *vfs.Filesystem) error {
+		limit, usage, err := tmpfs.SizeUsage(upper)
+		if err != nil {
+			return err
+		}
+		*out = DiskQuota{Limit: limit, Usage: usage}
+		return nil
+	})
+}
+
+// ReadMemoryArgs are arguments to the ReadMemory method.
+type ReadMemoryArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// PID is the process ID in the sandbox.
+	PID int32
+
+	// Addr is the address to read from.
+	Addr uint64
+
+	// Length is the number of bytes to read. It is capped to 1 MB.
+	Length uint64
+}
+
+// ReadMemory reads from the address space of a process in a container. It is
+// only allowed when the sandbox runs with --debug-memory-access, given that
+// it exposes application data.
+func (cm *containerManager) ReadMemory(args *ReadMemoryArgs, out *[]byte) error {
+	log.Debugf("containerManager.ReadMemory, cid: %s, PID: %d, addr: %#x, length: %d", args.CID, args.PID, args.Addr, args.Length)
+	if !cm.l.root.conf.DebugMemoryAccess {
+		return urpc.WithCode(ErrCodeFailedPrecondition, errors.New("reading process memory is disabled, enable it with --debug-memory-access"))
+	}
+	buf, err := cm.l.readMemory(args.CID, kernel.ThreadID(args.PID), hostarch.Addr(args.Addr), args.Length)
+	if err != nil {
+		return withDefaultCode(ErrCodeInternal, err)
+	}
+	*out = buf
+	return nil
+}
+
+// WriteMemoryArgs are arguments to the WriteMemory method.
+type WriteMemoryArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// PID is the process ID in the sandbox.
+	PID int32
+
+	// Addr is the address to write to.
+	Addr uint64
+
+	// Data is written at Addr. It is limited to 1 MB.
+	Data []byte
+}
+
+// WriteMemory writes to the address space of a process in a container. Pages
+// must be writable by the process. It is only allowed when the sandbox runs
+// with --debug-memory-write, and every write is logged.
+func (cm *containerManager) WriteMemory(args *WriteMemoryArgs, _ *struct{}) error {
+	log.Debugf("containerManager.WriteMemory, cid: %s, PID: %d, addr: %#x, length: %d", args.CID, args.PID, args.Addr, len(args.Data))
+	if !cm.l.root.conf.DebugMemoryWrite {
+		return urpc.WithCode(ErrCodeFailedPrecondition, errors.New("writing process memory is disabled, enable it with --debug-memory-write"))
+	}
+	return withDefaultCode(ErrCodeInternal, cm.l.writeMemory(args.CID, kernel.ThreadID(args.PID), hostarch.Addr(args.Addr), args.Data))
+}
+
+// SchedPolicyArgs are arguments to the SchedPolicy and SetSchedPolicy
+// methods.
+type SchedPolicyArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// PID is the process ID in the sandbox.
+	PID int32
+
+	// SchedPolicy is the policy to set. It's ignored by SchedPolicy.
+	SchedPolicy
+}
+
+// SchedPolicy retrieves the scheduling policy of a process in a container.
+func (cm *containerManager) SchedPolicy(args *SchedPolicyArgs, out *SchedPolicy) error {
+	log.Debugf("containerManager.SchedPolicy, cid: %s, PID: %d", args.CID, args.PID)
+	policy, err := cm.l.schedPolicy(args.CID, kernel.ThreadID(args.PID))
+	if err != nil {
+		return err
+	}
+	*out = policy
+	return nil
+}
+
+// SetSchedPolicy sets the scheduling policy of a process in a container. The
+// sentry scheduler only supports SCHED_NORMAL, so other valid policies fail
+// with ErrCodeUnimplemented.
+func (cm *containerManager) SetSchedPolicy(args *SchedPolicyArgs, _ *struct{}) error {
+	log.Debugf("containerManager.SetSchedPolicy, cid: %s, PID: %d, policy: %d, priority: %d", args.CID, args.PID, args.Policy, args.Priority)
+	return cm.l.setSchedPolicy(args.CID, kernel.ThreadID(args.PID), args.SchedPolicy)
+}
+
+// AddDeviceArgs are arguments to the AddDevice method.
+type AddDeviceArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// Device describes the device node to create.
+	Device specs.LinuxDevice
+}
+
+// AddDevice creates a device node in the filesystem of a running container,
+// e.g. for workloads that need a device after they start. Only character
+// devices that are implemented by the sentry are allowed. Block devices fail
+// with ErrCodeUnimplemented, as the sentry has no block device drivers.
+func (cm *containerManager) AddDevice(args *AddDeviceArgs, _ *struct{}) error {
+	log.Debugf("containerManager.AddDevice, cid: %s, device: %+v", args.CID, args.Device)
+	return cm.l.addDevice(args.CID, &args.Device)
+}
+
+// ForceUnmountArgs are arguments to the ForceUnmount method.
+type ForceUnmountArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// Target is the path of the mount to detach, in the container's mount
+	// namespace.
+	Target string
+}
+
+// ForceUnmount lazily detaches a single mount from a running container, e.g.
+// when it got stuck because its gofer died, without destroying the container.
+func (cm *containerManager) ForceUnmount(args *ForceUnmountArgs, _ *struct{}) error {
+	log.Debugf("containerManager.ForceUnmount, cid: %s, target: %q", args.CID, args.Target)
+	return cm.l.forceUnmount(args.CID, args.Target)
+}
+
+// SyscallPolicyArgs are arguments to the TightenSyscallPolicy method.
+type SyscallPolicyArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// SyscallPolicy is combined with the container's current policy.
+	SyscallPolicy
+}
+
+// TightenSyscallPolicy restricts the syscalls that a container may invoke to
+// the ones permitted by both its current policy and the given one. It can't be
+// used to re-enable syscalls.
+func (cm *containerManager) TightenSyscallPolicy(args *SyscallPolicyArgs, _ *struct{}) error {
+	log.Debugf("containerManager.TightenSyscallPolicy, cid: %s, policy: %+v", args.CID, args.SyscallPolicy)
+	if _, err := cm.l.threadGroupFromID(execID{cid: args.CID}); err != nil {
+		return err
+	}
+	return cm.l.k.TightenSyscallPolicy(args.CID, args.SyscallPolicy.kernelPolicy())
+}
+
+// PrivilegeStateArgs are arguments to the PrivilegeState method.
+type PrivilegeStateArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// PID is the process ID in the sandbox. If 0, the container's init
+	// process is used.
+	PID int32
+}
+
+// PrivilegeState retrieves the no_new_privs and securebits state of a process
+// in a container.
+func (cm *containerManager) PrivilegeState(args *PrivilegeStateArgs, out *PrivilegeState) error {
+	log.Debugf("containerManager.PrivilegeState, cid: %s, PID: %d", args.CID, args.PID)
+	state, err := cm.l.privilegeState(args.CID, kernel.ThreadID(args.PID))
+	if err != nil {
+		return err
+	}
+	*out = state
+	return nil
+}
+
+// PollObjectsArgs are arguments to the PollObjects method.
+type PollObjectsArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// PID is the process ID in the sandbox.
+	PID int32
+}
+
+// PollObjects lists the epoll instances, along with the file descriptors they
+// watch, and the eventfds and timerfds open in a process in a container. This
+// helps diagnose stuck event loops.
+func (cm *containerManager) PollObjects(args *PollObjectsArgs, out *PollObjects) error {
+	log.Debugf("containerManager.PollObjects, cid: %s, PID: %d", args.CID, args.PID)
+	objs, err := cm.l.pollObjects(args.CID, kernel.ThreadID(args.PID))
+	if err != nil {
+		return err
+	}
+	*out = objs
+	return nil
+}
+
+// IPCObjectsArgs are arguments to the IPCObjects method.
+type IPCObjectsArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// RemoveOrphaned indicates that shared memory segments that aren't
+	// attached by any process must be removed, as with shmctl(IPC_RMID).
+	RemoveOrphaned bool
+}
+
+// IPCObjects describes the SysV IPC objects in a container's IPC namespace.
+type IPCObjects struct {
+	SharedMemory  []shm.SegmentInfo    `json:"sharedMemory"`
+	Semaphores    []semaphore.SetInfo  `json:"semaphores"`
+	MessageQueues []msgqueue.QueueInfo `json:"messageQueues"`
+
+	// Removed contains the IDs of the shared memory segments removed when
+	// IPCObjectsArgs.RemoveOrphaned is set.
+	Removed []ipc.ID `json:"removed,omitempty"`
+}
+
+// IPCObjects lists the SysV IPC objects in the IPC namespace of the given
+// container. Note that containers share the root IPC namespace unless they
+// are configured with their own.
+//
+// POSIX message queues aren't listed: the mq_* syscalls aren't implemented,
+// so containers can't create any.
+func (cm *containerManager) IPCObjects(args *IPCObjectsArgs, out *IPCObjects) error {
+	log.Debugf("containerManager.IPCObjects, cid: %s, remove orphaned: %t", args.CID, args.RemoveOrphaned)
+	ipcns, err := cm.ipcNamespace(args.CID)
+	if err != nil {
+		return err
+	}
+
+	if args.RemoveOrphaned {
+		out.Removed = ipcns.ShmRegistry().RemoveUnattached(cm.l.k.SupervisorContext())
+	}
+	out.SharedMemory = ipcns.ShmRegistry().Segments()
+	out.Semaphores = ipcns.SemaphoreRegistry().Sets()
+	out.MessageQueues = ipcns.MsgqueueRegistry().Queues()
+	return nil
+}
+
+// IPCLimits are the adjustable limits of an IPC namespace. They are named
+// after the corresponding sysctl files.
+type IPCLimits struct {
+	// MsgMax is the maximum size of a SysV message in bytes.
+	MsgMax uint64 `json:"msgmax"`
+
+	// MsgMnb is the default maximum size of a SysV message queue in bytes.
+	MsgMnb uint64 `json:"msgmnb"`
+
+	// ShmMax is the maximum size of a SysV shared memory segment in bytes.
+	ShmMax uint64 `json:"shmmax"`
+}
+
+// SetIPCLimitsArgs are arguments to the SetIPCLimits method.
+type SetIPCLimitsArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// Limits are the new limits. Zero fields are left unchanged.
+	Limits IPCLimits
+}
+
+// GetIPCLimits gets the IPC limits of the IPC namespace of the given
+// container.
+func (cm *containerManager) GetIPCLimits(cid *string, out *IPCLimits) error {
+	log.Debugf("containerManager.GetIPCLimits, cid: %s", *cid)
+	ipcns, err := cm.ipcNamespace(*cid)
+	if err != nil {
+		return err
+	}
+	*out = ipcLimits(ipcns)
+	return nil
+}
+
+// SetIPCLimits sets the IPC limits of the IPC namespace of the given
+// container. New limits apply to objects created afterwards. All limits are
+// validated before any is set, so none is changed on error.
+//
+// POSIX message queue limits can't be set, as the mq_* syscalls aren't
+// implemented.
+func (cm *containerManager) SetIPCLimits(args *SetIPCLimitsArgs, _ *struct{}) error {
+	log.Debugf("containerManager.SetIPCLimits, cid: %s, limits: %+v", args.CID, args.Limits)
+	ipcns, err := cm.ipcNamespace(args.CID)
+	if err != nil {
+		return err
+	}
+
+	limits := ipcLimits(ipcns)
+	if args.Limits.ShmMax != 0 {
+		limits.ShmMax = args.Limits.ShmMax
+	}
+	if args.Limits.MsgMax != 0 {
+		limits.MsgMax = args.Limits.MsgMax
+	}
+	if args.Limits.MsgMnb != 0 {
+		limits.MsgMnb = args.Limits.MsgMnb
+	}
+	if err := shm.ValidateMaxSegmentSize(limits.ShmMax); err != nil {
+		return invalidArgf("invalid shmmax %d: %w", limits.ShmMax, err)
+	}
+	if err := msgqueue.ValidateLimits(limits.MsgMax, limits.MsgMnb); err != nil {
+		return invalidArgf("invalid msgmax %d or msgmnb %d: %w", limits.MsgMax, limits.MsgMnb, err)
+	}
+
+	if err := ipcns.ShmRegistry().SetMaxSegmentSize(limits.ShmMax); err != nil {
+		return fmt.Errorf("setting shmmax %d: %w", limits.ShmMax, err)
+	}
+	if err := ipcns.MsgqueueRegistry().SetLimits(limits.MsgMax, limits.MsgMnb); err != nil {
+		return fmt.Errorf("setting msgmax %d and msgmnb %d: %w", limits.MsgMax, limits.MsgMnb, err)
+	}
+	return nil
+}
+
+// ipcNamespace returns the IPC namespace of container cid's init process.
+func (cm *containerManager) ipcNamespace(cid string) (*kernel.IPCNamespace, error) {
+	tg, err := cm.l.threadGroupFromID(execID{cid: cid})
+	if err != nil {
+		return nil, err
+	}
+	leader := tg.Leader()
+	if leader == nil {
+		return nil, urpc.WithCode(ErrCodeFailedPrecondition, fmt.Errorf("container %q has exited", cid))
+	}
+	ipcns := leader.IPCNamespace()
+	if ipcns == nil {
+		return nil, urpc.WithCode(ErrCodeFailedPrecondition, fmt.Errorf("container %q has exited", cid))
+	}
+	return ipcns, nil
+}
+
+// HealthArgs are arguments to the Health method.
+type HealthArgs struct {
+	// Nonce is returned as is, so that callers can match replies to
+	// requests.
+	Nonce uint64
+}
+
+// HealthStatus is the result of the Health method.
+type HealthStatus struct {
+	// Nonce is HealthArgs.Nonce.
+	Nonce uint64 `json:"nonce"`
+
+	// Uptime is how long the sandbox has been running.
+	Uptime gtime.Duration `json:"uptime"`
+
+	// KernelPaused is true if the whole kernel is paused, e.g. while being
+	// checkpointed. Paused containers don't count.
+	KernelPaused bool `json:"kernelPaused"`
+}
+
+// Health returns right away, so that callers can tell whether the sandbox is
+// responsive. It must not take l.mu or kernel locks held during long
+// operations, so that it stays responsive while they run.
+func (cm *containerManager) Health(args *HealthArgs, out *HealthStatus) error {
+	log.Debugf("containerManager.Health, nonce: %d", args.Nonce)
+	*out = HealthStatus{
+		Nonce:        args.Nonce,
+		Uptime:       gtime.Since(cm.l.startTime),
+		KernelPaused: cm.l.k.IsPaused(),
+	}
+	return nil
+}
+
+// ipcLimits returns the current limits of the given IPC namespace.
+func ipcLimits(ipcns *kernel.IPCNamespace) IPCLimits {
+	var limits IPCLimits
+	limits.ShmMax = ipcns.ShmRegistry().MaxSegmentSize()
+	limits.MsgMax, limits.MsgMnb = ipcns.MsgqueueRegistry().Limits()
+	return limits
+}
+
+// AsyncIOStatusArgs are arguments to the AsyncIOStatus method.
+type AsyncIOStatusArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// Cancel indicates that the requests that haven't started executing must
+	// be canceled after being reported.
+	Cancel bool
+}
+
+// AsyncIOStatus lists the asynchronous I/O contexts of the processes of the
+// given container along with their outstanding requests. Canceled requests
+// complete with ECANCELED, so that processes waiting for them with
+// io_getevents(2) are woken up before the container is destroyed.
+func (cm *containerManager) AsyncIOStatus(args *AsyncIOStatusArgs, out *[]control.AsyncIOProcess) error {
+	log.Debugf("containerManager.AsyncIOStatus, cid: %s, cancel: %t", args.CID, args.Cancel)
+	if _, err := cm.l.threadGroupFromID(execID{cid: args.CID}); err != nil {
+		return err
+	}
+	*out = control.ContainerAsyncIO(cm.l.k, args.CID, args.Cancel)
+	return nil
+}
+
+// InitCommand is the command of a container init process.
+type InitCommand struct {
+	// Comm is the process name, as in /proc/[pid]/comm.
+	Comm string `json:"comm"`
+
+	// Argv is the argument list the process was started with.
+	Argv []string `json:"argv"`
+}
+
+// newInitCommand returns the command of tg, which was started with argv.
+func newInitCommand(tg *kernel.ThreadGroup, argv []string) InitCommand {
+	var cmd InitCommand
+	if leader := tg.Leader(); leader != nil {
+		cmd.Comm = leader.Name()
+	}
+	cmd.Argv = append(cmd.Argv, argv...)
+	return cmd
+}
+
+// InitCommand returns the command of the init process of the given container,
+// as recorded when the container started. Unlike /proc/[pid]/cmdline, it isn't
+// affected by the process rewriting its own arguments, so it can be used to
+// identify the container along with its labels.
+func (cm *containerManager) InitCommand(cid *string, out *InitCommand) error {
+	log.Debugf("containerManager.InitCommand, cid: %s", *cid)
+	cm.l.mu.Lock()
+	defer cm.l.mu.Unlock()
+	ep := cm.l.processes[execID{cid: *cid}]
+	if ep == nil {
+		return urpc.WithCode(ErrCodeNotFound, fmt.Errorf("container %q not found", *cid))
+	}
+	if ep.tg == nil {
+		return urpc.WithCode(ErrCodeFailedPrecondition, fmt.Errorf("container %q not started", *cid))
+	}
+	*out = ep.initCommand
+	return nil
+}
+
+// PendingSignalsArgs are arguments to the PendingSignals method.
+type PendingSignalsArgs struct {
+	// CID is the container ID.
+	CID string
+
+	// Flush indicates that the pending signals must be discarded after being
+	// reported.
+	Flush bool
+}
+
+// PendingSignal describes a signal that is queued but not yet delivered.
+type PendingSignal struct {
+	// Signo is the signal number.
+	Signo int32 `json:"signo"`
+
+	// Code is the signal code (si_code).
+	Code int32 `json:"code"`
+
+	// PID and UID identify the sender, for signals sent by a process.
+	PID int32 `json:"pid"`
+	UID int32 `json:"uid"`
+
+	// TID is the thread ID, in the container's PID namespace, of the thread
+	// the signal is queued on, or 0 if it is queued on the process.
+	TID int32 `json:"tid"`
+}
+
+// PendingSignals reports the signals that are queued but not yet delivered to
+// the init process of the given container. This is useful to diagnose why a
+// container isn't reacting to signals sent to it.
+func (cm *containerManager) PendingSignals(args *PendingSignalsArgs, out *[]PendingSignal) error {
+	log.Debugf("containerManager.PendingSignals, cid: %s, flush: %t", args.CID, args.Flush)
+	tg, err := cm.l.threadGroupFromID(execID{cid: args.CID})
+	if err != nil {
+		return err
+	}
+	var pending []PendingSignal
+	for _, p := range tg.PendingSignalsInfo(args.Flush) {
+		pending = append(pending, PendingSignal{
+			Signo: p.Signo,
+			Code:  p.Code,
+			PID:   p.PID,
+			UID:   p.UID,
+			TID:   int32(p.TID),
+		})
+	}
+	*out = pending
+	return nil
+}
+
+// ExportState returns a JSON-friendly snapshot of the given container's state:
+// its spec, labels, resource usage, processes, mounts and network interfaces.
+// The snapshot is lossy and can't be used to restore the container.
+func (cm *containerManager) ExportState(cid *string, out *ContainerState) error {
+	log.Debugf("containerManager.ExportState, cid: %s", *cid)
+	state, err := cm.l.exportState(*cid)
+	if err != nil {
+		return err
+	}
+	*out = *state
+	return nil
+}
+
+// EventStreamArgs contains arguments to the EventStream method.
+type EventStreamArgs struct {
+	// FilePayload contains the file that events are written to.
+	urpc.FilePayload
+}
+
+// EventStream starts writing events about all containers in the sandbox to
+// the donated file, one StreamEvent JSON object per line. Events are written
+// until the reader closes the file or a write to it fails.
+func (cm *containerManager) EventStream(args *EventStreamArgs, _ *struct{}) error {
+	log.Debugf("containerManager.EventStream")
+	if len(args.Files) != 1 {
+		return invalidArgf("EventStream requires exactly one file, got %d", len(args.Files))
+	}
+	cm.l.attachEventStream(args.Files[0])
+	return nil
+}
+
+// HostRootPath describes what backs a container's root filesystem on the host.
+type HostRootPath struct {
+	// Path is the host path of the root filesystem, taken from the container
+	// spec. The sentry can't access it directly, it's served by the gofer.
+	Path string `json:"path"`
+
+	// GoferFD is the sandbox FD of the gofer connection serving Path, or 0
+	// if unknown, e.g. after restore.
+	GoferFD int `json:"goferFD,omitempty"`
+
+	// Overlay is true if the root filesystem is overlaid with an in-sandbox
+	// writable layer, in which case changes aren't written to Path.
+	Overlay bool `json:"overlay"`
+}
+
+// HostRootPath returns what backs the root filesystem of the given container
+// on the host, which helps host-side tooling find the container's files. Since
+// it exposes host paths, it's only available when debugging is enabled.
+func (cm *containerManager) HostRootPath(cid *string, out *HostRootPath) error {
+	log.Debugf("containerManager.HostRootPath, cid: %s", *cid)
+	if !cm.l.root.conf.Debug {
+		return urpc.WithCode(ErrCodeFailedPrecondition, errors.New("host root path is only available with --debug"))
+	}
+
+	cm.l.mu.Lock()
+	defer cm.l.mu.Unlock()
+	ep, ok := cm.l.processes[execID{cid: *cid}]
+	if !ok {
+		return urpc.WithCode(ErrCodeNotFound, fmt.Errorf("container %q not found", *cid))
+	}
+	if ep.spec == nil {
+		return urpc.WithCode(ErrCodeFailedPrecondition, fmt.Errorf("container %q not started", *cid))
+	}
+	*out = HostRootPath{
+		Path:    ep.spec.Root.Path,
+		GoferFD: ep.rootGoferFD,
+		Overlay: cm.l.root.conf.Overlay && !ep.spec.Root.Readonly,
+	}
+	return nil
+}
+
+// SetCoreDumpUploadArgs contains arguments to the SetCoreDumpUpload method.
+type SetCoreDumpUploadArgs struct {
+	// MaxSize is the maximum size of core dumps, which are truncated beyond
+	// it. If 0, DefaultCoreDumpMaxSize is used.
+	MaxSize uint64
+
+	// FilePayload contains the file that core dumps are written to.
+	urpc.FilePayload
+}
+
+// SetCoreDumpUpload enables core dumps for all containers in the sandbox.
+// When a process is killed by a signal whose default action is to dump core,
+// e.g. SIGSEGV, its core dump is written to the donated file, prefixed with a
+// CoreDumpHeader. Core dumps are truncated to RLIMIT_CORE of the process and
+// to MaxSize. Setting a file replaces the previous one.
+func (cm *containerManager) SetCoreDumpUpload(args *SetCoreDumpUploadArgs, _ *struct{}) error {
+	log.Debugf("containerManager.SetCoreDumpUpload, max size: %d", args.MaxSize)
+	if len(args.Files) != 1 {
+		return invalidArgf("SetCoreDumpUpload requires exactly one file, got %d", len(args.Files))
+	}
+	maxSize := args.MaxSize
+	if maxSize == 0 {
+		maxSize = DefaultCoreDumpMaxSize
+	}
+	cm.l.coreDumps.set(args.Files[0])
+	cm.l.k.SetCoreDumpHandler(maxSize, cm.l.coreDumps.start)
+	return nil
 }
@@ -0,0 +1,170 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// DefaultCoreDumpMaxSize is the maximum size of uploaded core dumps if none
+// is set.
+const DefaultCoreDumpMaxSize = 64 << 20
+
+// CoreDumpHeader precedes each core dump written to the core dump upload
+// file, as a JSON line. It's followed by Size bytes of ELF core dump. If the
+// core dump is aborted, e.g. because the sandbox is checkpointed, its missing
+// part is filled with zeroes.
+type CoreDumpHeader struct {
+	// CID is the ID of the container of the crashed process.
+	CID string `json:"cid"`
+
+	// PID is the ID of the crashed process in the sandbox root PID
+	// namespace.
+	PID int32 `json:"pid"`
+
+	// Signal is the signal that killed the process.
+	Signal int `json:"signal"`
+
+	// Size is the size of the core dump that follows.
+	Size int `json:"size"`
+}
+
+// coreDumpUpload writes core dumps to the file donated with
+// containerManager.SetCoreDumpUpload.
+type coreDumpUpload struct {
+	// mu protects file.
+	mu sync.Mutex
+
+	// file is the upload destination. It's nil if uploads are disabled.
+	//
+	// file is guarded by mu.
+	file *os.File
+
+	// uploadMu serializes uploads, so that core dumps don't interleave. It's
+	// held by the goroutines writing the core dumps, never by the crashing
+	// tasks.
+	uploadMu sync.Mutex
+}
+
+// set replaces the upload destination with f, closing the previous one if
+// any. An upload in progress to the previous destination fails.
+func (u *coreDumpUpload) set(f *os.File) {
+	u.mu.Lock()
+	old := u.file
+	u.file = f
+	u.mu.Unlock()
+	if old != nil {
+		_ = old.Close()
+	}
+}
+
+// drop disables uploads to f after a failed write, which leaves a partial
+// core dump in f that the following ones can't be told apart from. It does
+// nothing if f was already replaced with set, which closed it.
+func (u *coreDumpUpload) drop(f *os.File) {
+	u.mu.Lock()
+	if u.file != f {
+		u.mu.Unlock()
+		return
+	}
+	u.file = nil
+	u.mu.Unlock()
+	log.Warningf("Disabling core dump uploads after a failed upload")
+	_ = f.Close()
+}
+
+// start implements kernel.CoreDumpHandler. It writes the core dump received
+// from chunks, prefixed with a CoreDumpHeader, to the upload file in a new
+// goroutine.
+func (u *coreDumpUpload) start(info kernel.CoreDumpInfo, size uint64, chunks <-chan []byte) {
+	u.mu.Lock()
+	f := u.file
+	u.mu.Unlock()
+	go u.upload(f, info, size, chunks)
+}
+
+// upload writes a core dump to f. It receives all chunks, even if the upload
+// fails, so that the crashing task doesn't wait for it. If writing to f
+// fails, f is dropped, see drop.
+func (u *coreDumpUpload) upload(f *os.File, info kernel.CoreDumpInfo, size uint64, chunks <-chan []byte) {
+	defer func() {
+		// Discard what's left of the core dump.
+		for range chunks {
+		}
+	}()
+	if f == nil {
+		return
+	}
+	hdr, err := json.Marshal(&CoreDumpHeader{
+		CID:    info.ContainerID,
+		PID:    int32(info.PID),
+		Signal: int(info.Signal),
+		Size:   int(size),
+	})
+	if err != nil {
+		log.Warningf("Failed to encode core dump header: %v", err)
+		return
+	}
+
+	u.uploadMu.Lock()
+	defer u.uploadMu.Unlock()
+	log.Infof("Uploading %d bytes core dump of PID %d in container %q, signal: %v", size, info.PID, info.ContainerID, info.Signal)
+	// Buffer the header with the start of the core dump, so that they're
+	// written together.
+	w := bufio.NewWriterSize(f, coreDumpUploadBufferSize)
+	w.Write(hdr)
+	w.WriteByte('\n')
+	var written uint64
+	for chunk := range chunks {
+		if _, err := w.Write(chunk); err != nil {
+			log.Warningf("Failed to upload core dump: %v", err)
+			u.drop(f)
+			return
+		}
+		written += uint64(len(chunk))
+	}
+	if written < size {
+		// Keep the size given in the header, so that the following core
+		// dumps can still be read.
+		log.Warningf("Core dump of PID %d in container %q was aborted after %d of %d bytes", info.PID, info.ContainerID, written, size)
+		var zeroes [4096]byte
+		for written < size {
+			n := uint64(len(zeroes))
+			if size-written < n {
+				n = size - written
+			}
+			if _, err := w.Write(zeroes[:n]); err != nil {
+				log.Warningf("Failed to upload core dump: %v", err)
+				u.drop(f)
+				return
+			}
+			written += n
+		}
+	}
+	if err := w.Flush(); err != nil {
+		log.Warningf("Failed to upload core dump: %v", err)
+		u.drop(f)
+	}
+}
+
+// coreDumpUploadBufferSize is the size of the writes of core dumps to the
+// upload file.
+const coreDumpUploadBufferSize = 64 << 10
@@ -0,0 +1,45 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"os"
+	"testing"
+
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+)
+
+// TestCoreDumpUploadDropOnError checks that the upload file is dropped once a
+// write to it fails, as it then holds a partial core dump.
+func TestCoreDumpUploadDropOnError(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe() failed: %v", err)
+	}
+	r.Close()
+
+	var u coreDumpUpload
+	u.set(w)
+	chunks := make(chan []byte, 1)
+	chunks <- []byte("core")
+	close(chunks)
+	u.upload(w, kernel.CoreDumpInfo{ContainerID: "cid", PID: 1}, 4, chunks)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.file != nil {
+		t.Errorf("upload file still set after a failed upload")
+	}
+}
@@ -15,15 +15,562 @@
 package boot
 
 import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/platform"
+	"gvisor.dev/gvisor/pkg/sentry/watchdog"
+	"gvisor.dev/gvisor/pkg/sync"
+	"gvisor.dev/gvisor/pkg/urpc"
+	"gvisor.dev/gvisor/runsc/config"
 )
 
 type debug struct {
+	// k is the sandbox kernel.
+	k *kernel.Kernel
+
+	// logFormat is the format used by emitters created by SetLogOutput.
+	logFormat string
+
+	// goroutines is the sandbox's goroutine history. It's nil if sampling is
+	// disabled.
+	goroutines *goroutineHistory
+
+	// emulation describes the features emulated by the sentry. It doesn't
+	// change after the sandbox is created.
+	emulation EmulationInfo
+
+	// perfCounters is nil if hardware events are counted, or the reason they
+	// aren't.
+	perfCounters error
+
+	// loader is used to reach the watchdog, which is replaced on restore.
+	loader *Loader
+
+	// hostFDs counts the host FDs reported by Metrics.
+	hostFDs hostFDCounter
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// logOutput is the log output donated by the last call to SetLogOutput.
+	// It's nil if the log output hasn't been changed.
+	logOutput *logOutput
+}
+
+// logOutput is a log file donated by SetLogOutput. Logging calls that loaded
+// the emitter writing to it before it was replaced may still be running, so
+// once it's replaced their writes are redirected to the new output. This lets
+// the file be closed without any writer reaching its FD, which may be reused.
+type logOutput struct {
+	mu sync.RWMutex
+
+	// f is the log file. It's nil once next is set.
+	//
+	// +checklocks:mu
+	f *os.File
+
+	// next is the output that replaced this one.
+	//
+	// +checklocks:mu
+	next *logOutput
 }
 
-// Stacks collects all sandbox stacks and copies them to 'stacks'.
-func (*debug) Stacks(_ *struct{}, stacks *string) error {
+// Write implements io.Writer.
+func (o *logOutput) Write(b []byte) (int, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if o.next != nil {
+		return o.next.Write(b)
+	}
+	return o.f.Write(b)
+}
+
+// replace redirects writes to next and closes the log file. It must only be
+// called once the emitter writing to o is no longer the log target.
+func (o *logOutput) replace(next *logOutput) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.next = next
+	err := o.f.Close()
+	o.f = nil
+	return err
+}
+
+// withLogEmitter returns target with the emitter writing to the log file
+// replaced by e. If target is a MultiEmitter, the log file emitter is its
+// first emitter (see runsc/cli/main.go), and the others, e.g. writing to
+// stderr, are kept.
+func withLogEmitter(target log.Emitter, e log.Emitter) log.Emitter {
+	m, ok := target.(*log.MultiEmitter)
+	if !ok || len(*m) == 0 {
+		return e
+	}
+	newM := make(log.MultiEmitter, len(*m))
+	copy(newM, *m)
+	newM[0] = e
+	return &newM
+}
+
+// StacksArgs are arguments to the Stacks method. All stacks are returned if
+// no filter is set.
+type StacksArgs struct {
+	// CID, if set, keeps only the stacks of goroutines running tasks of the
+	// given container.
+	CID string
+
+	// Match, if set, keeps only the stacks that contain it, e.g. a function
+	// name.
+	Match string
+
+	// MaxBytes, if positive, caps the size of the returned stacks. Stacks
+	// that would exceed it are left out, which is noted at the end.
+	MaxBytes int
+}
+
+// Stacks collects sandbox stacks, filtered by args, and copies them to
+// 'stacks'.
+func (d *debug) Stacks(args *StacksArgs, stacks *string) error {
 	buf := log.Stacks(true)
-	*stacks = string(buf)
+	if args.CID == "" && args.Match == "" && args.MaxBytes <= 0 {
+		*stacks = string(buf)
+		return nil
+	}
+
+	var goids map[int64]struct{}
+	if args.CID != "" {
+		goids = make(map[int64]struct{})
+		for _, t := range d.k.TaskSet().Root.Tasks() {
+			if t.ContainerID() == args.CID {
+				goids[t.GoroutineID()] = struct{}{}
+			}
+		}
+	}
+	*stacks = filterStacks(string(buf), args, goids)
+	return nil
+}
+
+// filterStacks returns the goroutine stacks in the output of runtime.Stack
+// that pass the filters of args. If args.CID is set, goids are the goroutines
+// running tasks of that container.
+func filterStacks(stacks string, args *StacksArgs, goids map[int64]struct{}) string {
+	var b strings.Builder
+	omitted := 0
+	// Goroutine stacks are separated by an empty line.
+	for _, g := range strings.Split(strings.TrimRight(stacks, "\n"), "\n\n") {
+		if args.CID != "" {
+			if _, ok := goids[goroutineID(g)]; !ok {
+				continue
+			}
+		}
+		if args.Match != "" && !strings.Contains(g, args.Match) {
+			continue
+		}
+		if args.MaxBytes > 0 && b.Len()+len(g)+2 > args.MaxBytes {
+			omitted++
+			continue
+		}
+		b.WriteString(g)
+		b.WriteString("\n\n")
+	}
+	if omitted > 0 {
+		fmt.Fprintf(&b, "...[%d stacks omitted to stay within %d bytes]\n", omitted, args.MaxBytes)
+	}
+	return b.String()
+}
+
+// goroutineID returns the ID of the goroutine in the header of its stack,
+// e.g. "goroutine 42 [running]:", or 0 if there's none.
+func goroutineID(stack string) int64 {
+	fields := strings.Fields(stack)
+	if len(fields) < 2 || fields[0] != "goroutine" {
+		return 0
+	}
+	id, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+// GoroutineHistory returns the goroutine and thread counts sampled every
+// --goroutine-sample-interval, oldest first.
+func (d *debug) GoroutineHistory(_ *struct{}, out *[]GoroutineSample) error {
+	if d.goroutines == nil {
+		return fmt.Errorf("goroutine sampling is disabled, enable it with --goroutine-sample-interval")
+	}
+	*out = d.goroutines.history()
+	return nil
+}
+
+// EmulationInfo returns which features the sentry emulates and which it passes
+// through to the host, which helps explain behavior that differs from a native
+// kernel.
+func (d *debug) EmulationInfo(_ *struct{}, out *EmulationInfo) error {
+	*out = d.emulation
+	return nil
+}
+
+// SetOOMBehavior sets how the sentry reacts when it runs out of memory while
+// handling a page fault: "segfault", "kill-victim", or "pause-and-notify".
+// "return-enomem" is accepted as the former name of "segfault".
+func (d *debug) SetOOMBehavior(behavior *string, _ *struct{}) error {
+	b, err := kernel.ParseOOMBehavior(*behavior)
+	if err != nil {
+		return err
+	}
+	log.Infof("Setting OOM behavior to %v", b)
+	d.k.SetOOMBehavior(b)
+	return nil
+}
+
+// OOMState reports the state of the sentry's out-of-memory handling.
+type OOMState struct {
+	// Behavior is the current OOM behavior.
+	Behavior string `json:"behavior"`
+
+	// Events is the number of page faults that failed for lack of memory.
+	Events uint64 `json:"events"`
+
+	// Killed is the number of processes killed by the "kill-victim"
+	// behavior.
+	Killed uint64 `json:"killed"`
+
+	// Paused is the number of tasks currently paused by the
+	// "pause-and-notify" behavior.
+	Paused int `json:"paused"`
+}
+
+// OOMState returns the current OOM behavior, along with OOM statistics and the
+// number of tasks paused waiting for ResolveOOM.
+func (d *debug) OOMState(_ *struct{}, out *OOMState) error {
+	state := d.k.OOMState()
+	*out = OOMState{
+		Behavior: state.Behavior,
+		Events:   state.Events,
+		Killed:   state.Killed,
+		Paused:   state.Paused,
+	}
 	return nil
 }
+
+// ResolveOOM resumes tasks paused by the "pause-and-notify" OOM behavior,
+// which retry their allocations, e.g. after the orchestrator freed memory.
+func (d *debug) ResolveOOM(_, _ *struct{}) error {
+	log.Infof("Resolving OOM")
+	d.k.ResolveOOM()
+	return nil
+}
+
+// GetMadviseMode returns whether memory freed by the application, e.g. with
+// madvise(MADV_DONTNEED), is released to the host: "passthrough" or "ignore".
+func (d *debug) GetMadviseMode(_ *struct{}, out *string) error {
+	*out = d.k.MadviseMode().String()
+	return nil
+}
+
+// SetMadviseMode sets whether memory freed by the application is released to
+// the host, see kernel.MadviseMode. Releasing memory lowers host memory
+// pressure, e.g. with many idle containers, while keeping it avoids host page
+// faults when the memory is reused.
+func (d *debug) SetMadviseMode(mode *string, _ *struct{}) error {
+	m, err := kernel.ParseMadviseMode(*mode)
+	if err != nil {
+		return err
+	}
+	log.Infof("Setting madvise mode to %v", m)
+	d.k.SetMadviseMode(m)
+	return nil
+}
+
+// PerfCounters returns the hardware events counted while the tasks of the
+// given container ran application code: CPU cycles, instructions and cache
+// misses. Events counted by tasks that have exited are not included.
+func (d *debug) PerfCounters(cid *string, out *platform.PerfCounters) error {
+	if d.perfCounters != nil {
+		return d.perfCounters
+	}
+	var (
+		total platform.PerfCounters
+		found bool
+	)
+	for _, t := range d.k.TaskSet().Root.Tasks() {
+		if t.ContainerID() != *cid {
+			continue
+		}
+		c, ok := t.PerfCounters()
+		if !ok {
+			return fmt.Errorf("perf counters are not supported by the platform")
+		}
+		total.Add(c)
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("container %q has no running tasks", *cid)
+	}
+	*out = total
+	return nil
+}
+
+// WatchdogConfig is the configuration of the watchdog set by
+// SetWatchdogConfig.
+type WatchdogConfig struct {
+	// TaskTimeout is how long a task may run a syscall without blocking
+	// before it's declared stuck. It must be positive.
+	TaskTimeout time.Duration
+
+	// Action is what the watchdog does when a task is stuck.
+	Action watchdog.Action
+}
+
+// SetWatchdogConfig changes the task timeout and action of the running
+// watchdog, e.g. to make it panic while debugging a stuck sandbox. The new
+// timeout applies from the next check on. The configuration is kept across
+// restore.
+func (d *debug) SetWatchdogConfig(args *WatchdogConfig, _ *struct{}) error {
+	if err := d.loader.currentWatchdog().SetTaskConfig(args.TaskTimeout, args.Action); err != nil {
+		return err
+	}
+	log.Infof("Watchdog task timeout set to %v, action: %v", args.TaskTimeout, args.Action)
+	return nil
+}
+
+// WatchdogStatus returns the configuration of the watchdog, how many times it
+// took its action and the tasks that may be stuck, so that monitoring can
+// alert before the action is taken.
+func (d *debug) WatchdogStatus(_ *struct{}, out *watchdog.Status) error {
+	*out = d.loader.currentWatchdog().Status()
+	return nil
+}
+
+// enablePerfCounters enables counting hardware events in p, see
+// conf.PerfCounters. It returns the reason they aren't counted, if any.
+func enablePerfCounters(conf *config.Config, p platform.Platform) error {
+	if !conf.PerfCounters {
+		return fmt.Errorf("perf counters are disabled, enable them with --perf-counters")
+	}
+	pp, ok := p.(platform.PerfCounterPlatform)
+	if !ok {
+		return fmt.Errorf("perf counters are not supported by platform %q", conf.Platform)
+	}
+	if err := pp.EnablePerfCounters(); err != nil {
+		return fmt.Errorf("perf counters are not supported by the host: %w", err)
+	}
+	return nil
+}
+
+// SetLogOutputArgs are arguments to the SetLogOutput method.
+type SetLogOutputArgs struct {
+	// FilePayload contains the writable file to send logs to.
+	urpc.FilePayload
+}
+
+// SetLogOutput switches the sandbox logs to the donated file, e.g. after the
+// host rotated the log file. Other emitters of the log target, e.g. writing to
+// stderr, are kept. The file donated by a previous call is closed once no
+// logging call can write to it, while the original log output, which isn't
+// owned by the debug object, is left open.
+func (d *debug) SetLogOutput(args *SetLogOutputArgs, _ *struct{}) error {
+	if len(args.Files) != 1 {
+		return fmt.Errorf("expected one log file, got %d", len(args.Files))
+	}
+	f := args.Files[0]
+	out := &logOutput{f: f}
+	e, err := newLogEmitter(d.logFormat, out)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	log.Infof("Switching log output to %q", f.Name())
+	log.SetTarget(withLogEmitter(log.Log().Emitter, e))
+	if d.logOutput != nil {
+		if err := d.logOutput.replace(out); err != nil {
+			log.Warningf("Closing previous log file: %v", err)
+		}
+	}
+	d.logOutput = out
+	log.Infof("Log output switched")
+	return nil
+}
+
+// SetLogLevel sets the log level of the sandbox, e.g. to Debug while
+// reproducing a problem, and returns the previous level so that the caller
+// can restore it afterwards. It applies to all messages logged once it
+// returns.
+func (d *debug) SetLogLevel(level *log.Level, old *log.Level) error {
+	if *level > log.Debug {
+		return fmt.Errorf("invalid log level %d", *level)
+	}
+	*old = log.SwapLevel(*level)
+	log.Infof("Log level changed from %v to %v", *old, *level)
+	return nil
+}
+
+// Metrics are counters that can be scraped frequently to catch leaks.
+type Metrics struct {
+	// Goroutines is the number of sentry goroutines.
+	Goroutines int
+
+	// ThreadGroups is the number of thread groups in the sandbox, including
+	// zombies that haven't been reaped yet.
+	ThreadGroups int
+
+	// Tasks is the number of tasks in the sandbox, including zombies that
+	// haven't been reaped yet.
+	Tasks int
+
+	// HostFDs is the number of host FDs open in the sentry. It's -1 if they
+	// couldn't be counted.
+	HostFDs int
+
+	// KernelPaused is true if the sandbox is paused.
+	KernelPaused bool
+}
+
+// Metrics returns the current sandbox metrics. It only takes the task set
+// lock for reading, doesn't read any files, and only probes all host FDs once
+// every hostFDFullScanInterval, so it's cheap enough to be called every second.
+func (d *debug) Metrics(_ *struct{}, out *Metrics) error {
+	hostFDs, err := d.hostFDs.count()
+	if err != nil {
+		log.Warningf("Counting host FDs: %v", err)
+		hostFDs = -1
+	}
+	ns := d.k.RootPIDNamespace()
+	*out = Metrics{
+		Goroutines:   runtime.NumGoroutine(),
+		ThreadGroups: ns.NumThreadGroups(),
+		Tasks:        ns.NumTasks(),
+		HostFDs:      hostFDs,
+		KernelPaused: d.k.IsPaused(),
+	}
+	return nil
+}
+
+// maxHostFDLimit caps the number of FDs scanned by countHostFDs, as the
+// RLIMIT_NOFILE of the sentry may be huge.
+const maxHostFDLimit = 1 << 20
+
+// hostFDLimit returns the number of FDs to scan to count the host FDs open in
+// the sentry, i.e. its RLIMIT_NOFILE. It must be called before seccomp filters
+// are installed, as they don't allow getrlimit(2).
+func hostFDLimit() int {
+	var rl unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &rl); err != nil {
+		log.Warningf("Getting RLIMIT_NOFILE: %v, host FDs won't be counted", err)
+		return 0
+	}
+	if rl.Cur > maxHostFDLimit {
+		return maxHostFDLimit
+	}
+	return int(rl.Cur)
+}
+
+// hostFDBatch is the number of FDs probed by each ppoll(2) call of
+// countHostFDs.
+const hostFDBatch = 1024
+
+// hostFDFullScanInterval is how often hostFDCounter probes all FDs below its
+// limit. In between, it only probes one batch past the highest open FD, as the
+// host allocates the lowest free FD first.
+const hostFDFullScanInterval = time.Minute
+
+// hostFDCounter counts the host FDs open in the sentry.
+type hostFDCounter struct {
+	// limit bounds the FDs counted, see hostFDLimit. It's immutable.
+	limit int
+
+	mu sync.Mutex
+
+	// highest is the highest open FD found by the last count, or -1.
+	//
+	// +checklocks:mu
+	highest int
+
+	// lastFullScan is when all FDs below limit were last probed.
+	//
+	// +checklocks:mu
+	lastFullScan time.Time
+}
+
+// count returns the number of open host FDs. FDs opened more than a batch
+// past the highest open FD are only counted by the next full scan.
+func (c *hostFDCounter) count() (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	limit := c.limit
+	full := time.Since(c.lastFullScan) >= hostFDFullScanInterval
+	if !full && c.highest+1+hostFDBatch < limit {
+		limit = c.highest + 1 + hostFDBatch
+	}
+	count, highest, err := countHostFDs(limit)
+	if err != nil {
+		return 0, err
+	}
+	c.highest = highest
+	if full {
+		c.lastFullScan = time.Now()
+	}
+	return count, nil
+}
+
+// countHostFDs returns the number of host FDs below limit that are open, and
+// the highest of them or -1. The seccomp filters don't allow reading
+// /proc/self/fd, so FDs are probed in batches with ppoll(2), which reports
+// POLLNVAL for FDs that aren't open.
+func countHostFDs(limit int) (int, int, error) {
+	if limit <= 0 {
+		return 0, 0, fmt.Errorf("unknown FD limit")
+	}
+	fds := make([]unix.PollFd, hostFDBatch)
+	count, highest := 0, -1
+	for start := 0; start < limit; start += hostFDBatch {
+		n := limit - start
+		if n > hostFDBatch {
+			n = hostFDBatch
+		}
+		for i := range fds[:n] {
+			fds[i] = unix.PollFd{Fd: int32(start + i)}
+		}
+		for {
+			_, err := unix.Ppoll(fds[:n], &unix.Timespec{}, nil)
+			if err == nil {
+				break
+			}
+			if err != unix.EINTR {
+				return 0, 0, fmt.Errorf("ppoll: %w", err)
+			}
+		}
+		for _, fd := range fds[:n] {
+			if fd.Revents&unix.POLLNVAL == 0 {
+				count++
+				highest = int(fd.Fd)
+			}
+		}
+	}
+	return count, highest, nil
+}
+
+// newLogEmitter returns an emitter writing to w in the given format.
+func newLogEmitter(format string, w io.Writer) (log.Emitter, error) {
+	switch format {
+	case "", "text":
+		return log.GoogleEmitter{&log.Writer{Next: w}}, nil
+	case "json":
+		return log.JSONEmitter{&log.Writer{Next: w}}, nil
+	case "json-k8s":
+		return log.K8sJSONEmitter{&log.Writer{Next: w}}, nil
+	}
+	return nil, fmt.Errorf("invalid log format %q, must be 'text', 'json', or 'json-k8s'", format)
+}
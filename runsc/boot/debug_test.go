@@ -0,0 +1,329 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/watchdog"
+	"gvisor.dev/gvisor/pkg/urpc"
+)
+
+func openLogFile(t *testing.T, path string) *os.File {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("error opening log file: %v", err)
+	}
+	return f
+}
+
+func readLogFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("error reading log file: %v", err)
+	}
+	return string(b)
+}
+
+// TestSetLogOutput checks that logs are written to the donated file after
+// SetLogOutput, and no longer to the previous one.
+func TestSetLogOutput(t *testing.T) {
+	oldLog := log.Log()
+	defer log.SetTarget(oldLog.Emitter)
+	defer log.SetLevel(oldLog.Level)
+	log.SetLevel(log.Info)
+
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.log")
+	second := filepath.Join(dir, "second.log")
+
+	// Another emitter of the log target, e.g. writing to stderr, must be
+	// kept.
+	var other strings.Builder
+	log.SetTarget(&log.MultiEmitter{
+		log.GoogleEmitter{&log.Writer{Next: ioutil.Discard}},
+		log.GoogleEmitter{&log.Writer{Next: &other}},
+	})
+
+	d := &debug{logFormat: "text"}
+	var firstEmitter log.Emitter
+	for _, path := range []string{first, second} {
+		args := SetLogOutputArgs{
+			FilePayload: urpc.FilePayload{Files: []*os.File{openLogFile(t, path)}},
+		}
+		if err := d.SetLogOutput(&args, nil); err != nil {
+			t.Fatalf("SetLogOutput(%q) failed: %v", path, err)
+		}
+		log.Infof("logging to %s", filepath.Base(path))
+		if firstEmitter == nil {
+			firstEmitter = log.Log().Emitter
+		}
+	}
+	defer closeLogOutput(d)
+
+	// A logging call that loaded the emitter before the second switch writes
+	// to the second file, not to the closed first one.
+	firstEmitter.Emit(0, log.Info, time.Now(), "late message")
+
+	if got := readLogFile(t, first); !strings.Contains(got, "logging to first.log") || strings.Contains(got, "logging to second.log") || strings.Contains(got, "late message") {
+		t.Errorf("first log file got: %q, want only first message", got)
+	}
+	if got := readLogFile(t, second); !strings.Contains(got, "logging to second.log") || !strings.Contains(got, "late message") {
+		t.Errorf("second log file got: %q, want second and late messages", got)
+	}
+	if got := other.String(); !strings.Contains(got, "logging to first.log") || !strings.Contains(got, "logging to second.log") {
+		t.Errorf("other emitter got: %q, want both messages", got)
+	}
+}
+
+// closeLogOutput closes the log file donated to d.
+func closeLogOutput(d *debug) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.logOutput.mu.Lock()
+	defer d.logOutput.mu.Unlock()
+	_ = d.logOutput.f.Close()
+}
+
+func TestSetLogOutputInvalid(t *testing.T) {
+	d := &debug{logFormat: "text"}
+	if err := d.SetLogOutput(&SetLogOutputArgs{}, nil); err == nil {
+		t.Errorf("SetLogOutput() with no files succeeded, want error")
+	}
+
+	d = &debug{logFormat: "invalid"}
+	args := SetLogOutputArgs{
+		FilePayload: urpc.FilePayload{Files: []*os.File{openLogFile(t, filepath.Join(t.TempDir(), "log"))}},
+	}
+	if err := d.SetLogOutput(&args, nil); err == nil {
+		t.Errorf("SetLogOutput() with invalid format succeeded, want error")
+	}
+}
+
+// TestSetLogLevel checks that SetLogLevel changes the level of messages that
+// are logged and returns the previous level.
+func TestSetLogLevel(t *testing.T) {
+	oldLog := log.Log()
+	defer log.SetTarget(oldLog.Emitter)
+	defer log.SetLevel(oldLog.Level)
+	log.SetLevel(log.Warning)
+
+	path := filepath.Join(t.TempDir(), "log")
+	f := openLogFile(t, path)
+	defer f.Close()
+	log.SetTarget(log.GoogleEmitter{&log.Writer{Next: f}})
+
+	d := &debug{}
+	for _, tc := range []struct {
+		level log.Level
+		old   log.Level
+	}{
+		{level: log.Debug, old: log.Warning},
+		{level: log.Info, old: log.Debug},
+	} {
+		var old log.Level
+		if err := d.SetLogLevel(&tc.level, &old); err != nil {
+			t.Fatalf("SetLogLevel(%v) failed: %v", tc.level, err)
+		}
+		if old != tc.old {
+			t.Errorf("SetLogLevel(%v) returned %v, want %v", tc.level, old, tc.old)
+		}
+		log.Debugf("debug message at %v", tc.level)
+	}
+	if got := readLogFile(t, path); !strings.Contains(got, "debug message at Debug") || strings.Contains(got, "debug message at Info") {
+		t.Errorf("log file got: %q, want only the debug message logged at Debug", got)
+	}
+
+	invalid := log.Debug + 1
+	var old log.Level
+	if err := d.SetLogLevel(&invalid, &old); err == nil {
+		t.Errorf("SetLogLevel(%d) succeeded, want error", invalid)
+	}
+}
+
+// TestSetWatchdogConfig checks that SetWatchdogConfig changes the watchdog's
+// task timeout and action, and rejects invalid ones.
+func TestSetWatchdogConfig(t *testing.T) {
+	l, cleanup, err := createLoader(true, testSpec(), 0)
+	if err != nil {
+		t.Fatalf("error creating loader: %v", err)
+	}
+	defer l.Destroy()
+	defer cleanup()
+	d := &debug{loader: l}
+
+	want := WatchdogConfig{TaskTimeout: time.Minute, Action: watchdog.Panic}
+	if err := d.SetWatchdogConfig(&want, nil); err != nil {
+		t.Fatalf("SetWatchdogConfig(%+v) failed: %v", want, err)
+	}
+	for _, invalid := range []WatchdogConfig{
+		{TaskTimeout: 0, Action: watchdog.LogWarning},
+		{TaskTimeout: time.Minute, Action: watchdog.Action(-1)},
+	} {
+		if err := d.SetWatchdogConfig(&invalid, nil); err == nil {
+			// Action.String panics on invalid actions.
+			t.Errorf("SetWatchdogConfig(timeout: %v, action: %d) succeeded, want error", invalid.TaskTimeout, int(invalid.Action))
+		}
+	}
+	if timeout, action := l.watchdog.TaskConfig(); timeout != want.TaskTimeout || action != want.Action {
+		t.Errorf("TaskConfig() = %v, %v, want %v, %v", timeout, action, want.TaskTimeout, want.Action)
+	}
+}
+
+// TestWatchdogStatus checks that WatchdogStatus reports the watchdog
+// configuration of a sandbox that hasn't started.
+func TestWatchdogStatus(t *testing.T) {
+	l, cleanup, err := createLoader(true, testSpec(), 0)
+	if err != nil {
+		t.Fatalf("error creating loader: %v", err)
+	}
+	defer l.Destroy()
+	defer cleanup()
+	d := &debug{loader: l}
+
+	cfg := WatchdogConfig{TaskTimeout: time.Minute, Action: watchdog.Panic}
+	if err := d.SetWatchdogConfig(&cfg, nil); err != nil {
+		t.Fatalf("SetWatchdogConfig(%+v) failed: %v", cfg, err)
+	}
+	var status watchdog.Status
+	if err := d.WatchdogStatus(nil, &status); err != nil {
+		t.Fatalf("WatchdogStatus() failed: %v", err)
+	}
+	want := watchdog.Status{TaskTimeout: cfg.TaskTimeout, Action: cfg.Action}
+	if status.TaskTimeout != want.TaskTimeout || status.Action != want.Action || status.Running || status.Fired != 0 || len(status.Suspects) != 0 {
+		t.Errorf("WatchdogStatus() = %+v, want %+v", status, want)
+	}
+}
+
+func TestFilterStacks(t *testing.T) {
+	const stacks = "goroutine 1 [running]:\nmain.main()\n\n" +
+		"goroutine 2 [select]:\nfoo.Bar()\n\n" +
+		"goroutine 3 [chan receive]:\nfoo.Baz()\n"
+	for _, tc := range []struct {
+		name  string
+		args  StacksArgs
+		goids map[int64]struct{}
+		want  string
+	}{
+		{
+			name:  "container",
+			args:  StacksArgs{CID: "foo"},
+			goids: map[int64]struct{}{2: {}},
+			want:  "goroutine 2 [select]:\nfoo.Bar()\n\n",
+		},
+		{
+			name: "match",
+			args: StacksArgs{Match: "foo."},
+			want: "goroutine 2 [select]:\nfoo.Bar()\n\ngoroutine 3 [chan receive]:\nfoo.Baz()\n\n",
+		},
+		{
+			name:  "container and match",
+			args:  StacksArgs{CID: "foo", Match: "Baz"},
+			goids: map[int64]struct{}{2: {}},
+			want:  "",
+		},
+		{
+			name: "max bytes",
+			args: StacksArgs{MaxBytes: 40},
+			want: "goroutine 1 [running]:\nmain.main()\n\n...[2 stacks omitted to stay within 40 bytes]\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := filterStacks(stacks, &tc.args, tc.goids); got != tc.want {
+				t.Errorf("filterStacks(%+v) = %q, want %q", tc.args, got, tc.want)
+			}
+		})
+	}
+}
+
+// TestCountHostFDs checks that countHostFDs counts newly opened FDs.
+func TestCountHostFDs(t *testing.T) {
+	limit := hostFDLimit()
+	before, _, err := countHostFDs(limit)
+	if err != nil {
+		t.Fatalf("countHostFDs(%d) failed: %v", limit, err)
+	}
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatalf("error opening %q: %v", os.DevNull, err)
+	}
+	defer f.Close()
+	after, highest, err := countHostFDs(limit)
+	if err != nil || after != before+1 {
+		t.Errorf("countHostFDs(%d) after opening a file = %d, %v, want %d, nil", limit, after, err, before+1)
+	}
+	if highest < int(f.Fd()) {
+		t.Errorf("countHostFDs(%d) highest FD = %d, want at least %d", limit, highest, f.Fd())
+	}
+	if _, _, err := countHostFDs(0); err == nil {
+		t.Errorf("countHostFDs(0) succeeded, want error")
+	}
+}
+
+// TestHostFDCounter checks that hostFDCounter counts newly opened FDs between
+// full scans.
+func TestHostFDCounter(t *testing.T) {
+	c := hostFDCounter{limit: hostFDLimit()}
+	before, err := c.count()
+	if err != nil {
+		t.Fatalf("count() failed: %v", err)
+	}
+	if c.lastFullScan.IsZero() {
+		t.Errorf("count() didn't do a full scan the first time")
+	}
+	lastFullScan := c.lastFullScan
+
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatalf("error opening %q: %v", os.DevNull, err)
+	}
+	defer f.Close()
+	if after, err := c.count(); err != nil || after != before+1 {
+		t.Errorf("count() after opening a file = %d, %v, want %d, nil", after, err, before+1)
+	}
+	if c.lastFullScan != lastFullScan {
+		t.Errorf("count() did a full scan again within %v", hostFDFullScanInterval)
+	}
+}
+
+// TestMetrics checks the metrics of a sandbox that hasn't started.
+func TestMetrics(t *testing.T) {
+	l, cleanup, err := createLoader(true, testSpec(), 0)
+	if err != nil {
+		t.Fatalf("error creating loader: %v", err)
+	}
+	defer l.Destroy()
+	defer cleanup()
+	d := &debug{k: l.k, hostFDs: hostFDCounter{limit: hostFDLimit()}}
+
+	var m Metrics
+	if err := d.Metrics(nil, &m); err != nil {
+		t.Fatalf("Metrics() failed: %v", err)
+	}
+	if m.Goroutines <= 0 || m.HostFDs <= 0 {
+		t.Errorf("Metrics() = %+v, want positive goroutine and host FD counts", m)
+	}
+	if m.ThreadGroups != 0 || m.Tasks != 0 || m.KernelPaused {
+		t.Errorf("Metrics() = %+v, want no tasks and kernel not paused", m)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/fspath"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+	"gvisor.dev/gvisor/pkg/urpc"
+)
+
+// hotplugDevice identifies a device that may be added to a running container.
+type hotplugDevice struct {
+	kind  vfs.DeviceKind
+	major uint32
+	minor uint32
+}
+
+// hotplugDevices is the allowlist of devices that may be added to a running
+// container. They're all implemented by the sentry and don't give access to
+// host resources. It only has character devices: the sentry has no block
+// device drivers, so block devices are rejected by addDevice.
+var hotplugDevices = map[hotplugDevice]string{
+	{vfs.CharDevice, linux.MEM_MAJOR, 3}:    "null",
+	{vfs.CharDevice, linux.MEM_MAJOR, 5}:    "zero",
+	{vfs.CharDevice, linux.MEM_MAJOR, 7}:    "full",
+	{vfs.CharDevice, linux.MEM_MAJOR, 8}:    "random",
+	{vfs.CharDevice, linux.MEM_MAJOR, 9}:    "urandom",
+	{vfs.CharDevice, linux.TTYAUX_MAJOR, 0}: "tty",
+}
+
+// addDevice creates the device node described by dev in container cid's
+// filesystem. The node's parent directory must exist. The device must be in
+// hotplugDevices, which ensures that it's backed by a sentry driver. Block
+// devices fail with ErrCodeUnimplemented.
+func (l *Loader) addDevice(cid string, dev *specs.LinuxDevice) error {
+	if !l.root.conf.VFS2 {
+		return fmt.Errorf("adding devices requires VFS2")
+	}
+
+	var hd hotplugDevice
+	var fileType linux.FileMode
+	switch dev.Type {
+	case "c", "u":
+		hd.kind = vfs.CharDevice
+		fileType = linux.ModeCharacterDevice
+	case "b":
+		return urpc.WithCode(ErrCodeUnimplemented, fmt.Errorf("can't add block device %q: block devices aren't supported by the sentry", dev.Path))
+	default:
+		return fmt.Errorf("invalid device type %q", dev.Type)
+	}
+	if dev.Major < 0 || dev.Minor < 0 {
+		return fmt.Errorf("invalid device number (%d, %d)", dev.Major, dev.Minor)
+	}
+	hd.major, hd.minor = uint32(dev.Major), uint32(dev.Minor)
+	if _, ok := hotplugDevices[hd]; !ok {
+		return fmt.Errorf("%s device (%d, %d) is not allowed", hd.kind, hd.major, hd.minor)
+	}
+	if !fspath.Parse(dev.Path).Absolute {
+		return fmt.Errorf("device path %q must be absolute", dev.Path)
+	}
+	perms := linux.FileMode(0666)
+	if dev.FileMode != nil {
+		perms = linux.FileMode(dev.FileMode.Perm())
+	}
+
+	mntns, err := l.containerMountNamespace(cid)
+	if err != nil {
+		return err
+	}
+	ctx := l.k.SupervisorContext()
+	defer mntns.DecRef(ctx)
+
+	root := mntns.Root()
+	root.IncRef()
+	defer root.DecRef(ctx)
+	pop := vfs.PathOperation{
+		Root:  root,
+		Start: root,
+		Path:  fspath.Parse(dev.Path),
+	}
+	creds := auth.NewRootCredentials(l.k.RootUserNamespace())
+	if err := l.k.VFS().MknodAt(ctx, creds, &pop, &vfs.MknodOptions{
+		Mode:     fileType | perms,
+		DevMajor: hd.major,
+		DevMinor: hd.minor,
+	}); err != nil {
+		return fmt.Errorf("creating device %q: %w", dev.Path, err)
+	}
+
+	var stat linux.Statx
+	if dev.UID != nil {
+		stat.Mask |= linux.STATX_UID
+		stat.UID = *dev.UID
+	}
+	if dev.GID != nil {
+		stat.Mask |= linux.STATX_GID
+		stat.GID = *dev.GID
+	}
+	if stat.Mask != 0 {
+		if err := l.k.VFS().SetStatAt(ctx, creds, &pop, &vfs.SetStatOptions{Stat: stat}); err != nil {
+			return fmt.Errorf("changing owner of device %q: %w", dev.Path, err)
+		}
+	}
+	return nil
+}
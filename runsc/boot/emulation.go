@@ -0,0 +1,107 @@
+// Copyright 2018 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"gvisor.dev/gvisor/runsc/config"
+)
+
+// EmulationStatus describes how the sentry provides a feature of the host
+// kernel to the application.
+type EmulationStatus string
+
+const (
+	// Emulated features are implemented by the sentry, and may behave
+	// differently from the host kernel.
+	Emulated EmulationStatus = "emulated"
+
+	// Passthrough features are forwarded to the host kernel, and behave
+	// like the host kernel, e.g. use its configuration and limits.
+	Passthrough EmulationStatus = "passthrough"
+
+	// Disabled features aren't available to the application.
+	Disabled EmulationStatus = "disabled"
+)
+
+// EmulationInfo describes which features the sentry emulates and which it
+// passes through to the host with the sandbox's configuration.
+type EmulationInfo struct {
+	// Platform is the platform used to intercept syscalls and run
+	// application code.
+	Platform string `json:"platform"`
+
+	// Features maps feature names to their status. Features whose status is
+	// the same in all configurations, e.g. syscalls, memory management or
+	// procfs, which are always emulated, are omitted.
+	Features map[string]EmulationStatus `json:"features"`
+}
+
+func statusIf(enabled bool, status EmulationStatus) EmulationStatus {
+	if !enabled {
+		return Disabled
+	}
+	return status
+}
+
+// emulationInfo derives the EmulationInfo of a sandbox from its configuration.
+// terminal is true if the root container's stdio is a host terminal.
+func emulationInfo(conf *config.Config, terminal bool) EmulationInfo {
+	hostNetwork := conf.Network == config.NetworkHost
+	network := Emulated
+	if hostNetwork {
+		network = Passthrough
+	}
+	tty := Emulated
+	if terminal {
+		tty = Passthrough
+	}
+	// Segmentation and checksums are computed by the host when using its
+	// network stack, and by the sandbox's network stack unless they are
+	// offloaded to the host.
+	gso, txChecksum, rxChecksum := Passthrough, Passthrough, Passthrough
+	if !hostNetwork {
+		switch {
+		case conf.HardwareGSO:
+			gso = Passthrough
+		case conf.SoftwareGSO:
+			gso = Emulated
+		default:
+			gso = Disabled
+		}
+		if !conf.TXChecksumOffload {
+			txChecksum = Emulated
+		}
+		if !conf.RXChecksumOffload {
+			rxChecksum = Emulated
+		}
+	}
+
+	return EmulationInfo{
+		Platform: conf.Platform,
+		Features: map[string]EmulationStatus{
+			"cgroupfs":             statusIf(conf.Cgroupfs, Emulated),
+			"fuse":                 statusIf(conf.FUSE, Emulated),
+			"ioctl/net-interfaces": network,
+			"ioctl/tty":            tty,
+			"network/gso":          gso,
+			"network/rx-checksum":  rxChecksum,
+			"network/tx-checksum":  txChecksum,
+			"seccomp/oci":          statusIf(conf.OCISeccomp, Emulated),
+			"socket/inet":          network,
+			"socket/raw":           statusIf(conf.EnableRaw, network),
+			"socket/unix-host":     statusIf(conf.FSGoferHostUDS, Passthrough),
+		},
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2018 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"testing"
+
+	"gvisor.dev/gvisor/runsc/config"
+)
+
+func TestEmulationInfo(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		conf     func(*config.Config)
+		terminal bool
+		want     map[string]EmulationStatus
+	}{
+		{
+			name: "netstack",
+			conf: func(conf *config.Config) {
+				conf.Network = config.NetworkSandbox
+				conf.SoftwareGSO = true
+				conf.EnableRaw = false
+			},
+			want: map[string]EmulationStatus{
+				"ioctl/net-interfaces": Emulated,
+				"ioctl/tty":            Emulated,
+				"network/gso":          Emulated,
+				"network/tx-checksum":  Emulated,
+				"socket/inet":          Emulated,
+				"socket/raw":           Disabled,
+			},
+		},
+		{
+			name: "hostinet",
+			conf: func(conf *config.Config) {
+				conf.Network = config.NetworkHost
+				conf.EnableRaw = true
+			},
+			want: map[string]EmulationStatus{
+				"ioctl/net-interfaces": Passthrough,
+				"network/gso":          Passthrough,
+				"network/tx-checksum":  Passthrough,
+				"socket/inet":          Passthrough,
+				"socket/raw":           Passthrough,
+			},
+		},
+		{
+			name: "host features",
+			conf: func(conf *config.Config) {
+				conf.FSGoferHostUDS = true
+				conf.HardwareGSO = true
+				conf.TXChecksumOffload = true
+			},
+			terminal: true,
+			want: map[string]EmulationStatus{
+				"ioctl/tty":           Passthrough,
+				"network/gso":         Passthrough,
+				"network/tx-checksum": Passthrough,
+				"socket/unix-host":    Passthrough,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := &config.Config{Platform: "ptrace"}
+			tc.conf(conf)
+			info := emulationInfo(conf, tc.terminal)
+			if info.Platform != conf.Platform {
+				t.Errorf("platform got: %q, want: %q", info.Platform, conf.Platform)
+			}
+			for feature, want := range tc.want {
+				if got := info.Features[feature]; got != want {
+					t.Errorf("feature %q got: %q, want: %q", feature, got, want)
+				}
+			}
+		})
+	}
+}
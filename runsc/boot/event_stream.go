@@ -0,0 +1,251 @@
+// Copyright 2018 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// eventStreamBacklog is the number of events buffered for writing to event
+// streams. Events are dropped when the buffer is full, so that slow readers
+// can't block the sandbox.
+const eventStreamBacklog = 1024
+
+// StreamEvent is a structured event written to event streams as a JSON line.
+type StreamEvent struct {
+	// Type is one of "start", "exit", "oom", "oom-fault" or "signal".
+	Type string `json:"type"`
+
+	// CID is the ID of the container the event refers to.
+	CID string `json:"cid"`
+
+	// Time is when the event happened.
+	Time time.Time `json:"time"`
+
+	// PID is the process the event refers to, in the sandbox root PID
+	// namespace.
+	PID int32 `json:"pid,omitempty"`
+
+	// ExitCode is the exit code of a process that exited normally. It's only
+	// set for "exit" events.
+	ExitCode int `json:"exitCode,omitempty"`
+
+	// Signal is the delivered signal for "signal" events, and the signal
+	// that killed the process for "exit" events.
+	Signal int `json:"signal,omitempty"`
+
+	// Init is set for "exit" events of container init processes, i.e. when
+	// the container stops.
+	Init bool `json:"init,omitempty"`
+}
+
+// eventStream writes sandbox events to files donated with
+// containerManager.EventStream.
+type eventStream struct {
+	mu sync.Mutex
+
+	// files are the streams that events are written to. Files are closed
+	// and removed once a write fails, e.g. because the reader went away.
+	//
+	// files is guarded by mu.
+	files []*os.File
+
+	// events is the queue of events to write, read by the writer goroutine.
+	// It's nil until the first file is attached.
+	//
+	// events is guarded by mu.
+	events chan StreamEvent
+
+	// inits maps container IDs to the PID of their init process, to tell
+	// when containers stop. It's maintained whether or not files are
+	// attached.
+	//
+	// inits is guarded by mu.
+	inits map[string]int32
+}
+
+// attach adds f to the streams that events are written to, taking ownership
+// of f. It returns true if f is the first stream attached.
+func (s *eventStream) attach(f *os.File) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files = append(s.files, f)
+	go s.watch(f) // S/R-SAFE: doesn't touch kernel state.
+	if s.events != nil {
+		return false
+	}
+	s.events = make(chan StreamEvent, eventStreamBacklog)
+	go s.run(s.events) // S/R-SAFE: doesn't touch kernel state.
+	return true
+}
+
+// emit queues ev to be written to all attached streams. It never blocks.
+func (s *eventStream) emit(ev StreamEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.files) == 0 {
+		return
+	}
+	select {
+	case s.events <- ev:
+	default:
+		log.Warningf("Event stream backlog full, dropping %q event for container %q", ev.Type, ev.CID)
+	}
+}
+
+// run writes queued events to the attached streams.
+func (s *eventStream) run(events <-chan StreamEvent) {
+	for ev := range events {
+		b, err := json.Marshal(&ev)
+		if err != nil {
+			log.Warningf("Failed to encode event %+v: %v", ev, err)
+			continue
+		}
+		b = append(b, '\n')
+
+		s.mu.Lock()
+		files := append([]*os.File(nil), s.files...)
+		s.mu.Unlock()
+
+		for _, f := range files {
+			if _, err := f.Write(b); err != nil {
+				log.Infof("Event stream closed: %v", err)
+				s.detach(f)
+			}
+		}
+	}
+}
+
+// detach removes f from the attached streams and closes it, unless it was
+// already removed.
+func (s *eventStream) detach(f *os.File) {
+	s.mu.Lock()
+	found := false
+	for i, other := range s.files {
+		if other == f {
+			s.files = append(s.files[:i], s.files[i+1:]...)
+			found = true
+			break
+		}
+	}
+	s.mu.Unlock()
+	if found {
+		_ = f.Close()
+	}
+}
+
+// watchInterval is how often watch checks whether the reader of a stream went
+// away.
+const watchInterval = time.Second
+
+// watch detaches f once its reader goes away, e.g. when the read end of a pipe
+// or the peer of a socket is closed, rather than on the next failed write,
+// which may be long after if no events happen. It returns once f is closed.
+func (s *eventStream) watch(f *os.File) {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		log.Warningf("Failed to watch event stream: %v", err)
+		return
+	}
+	ts := unix.NsecToTimespec(watchInterval.Nanoseconds())
+	for {
+		var hup bool
+		// Control keeps the FD open while it's polled.
+		if err := rc.Control(func(fd uintptr) {
+			fds := []unix.PollFd{{Fd: int32(fd)}}
+			if n, _ := unix.Ppoll(fds, &ts, nil); n > 0 {
+				hup = fds[0].Revents&(unix.POLLERR|unix.POLLHUP|unix.POLLNVAL) != 0
+			}
+		}); err != nil {
+			// f was closed.
+			return
+		}
+		if hup {
+			log.Infof("Event stream reader went away")
+			s.detach(f)
+			return
+		}
+	}
+}
+
+// setInit records that pid is the init process of container cid.
+func (s *eventStream) setInit(cid string, pid int32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inits == nil {
+		s.inits = make(map[string]int32)
+	}
+	s.inits[cid] = pid
+}
+
+// initExited returns true if pid is the init process of container cid, and
+// forgets about it.
+func (s *eventStream) initExited(cid string, pid int32) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if initPID, ok := s.inits[cid]; !ok || initPID != pid {
+		return false
+	}
+	delete(s.inits, cid)
+	return true
+}
+
+// attachEventStream starts writing sandbox events to f.
+func (l *Loader) attachEventStream(f *os.File) {
+	if l.events.attach(f) {
+		l.k.SetLifecycleEventHandler(l.emitLifecycleEvent)
+	}
+}
+
+// emitContainerStart reports that the init process of container cid started.
+func (l *Loader) emitContainerStart(cid string, tg *kernel.ThreadGroup) {
+	pid := int32(l.k.TaskSet().Root.IDOfThreadGroup(tg))
+	l.events.setInit(cid, pid)
+	l.events.emit(StreamEvent{
+		Type: "start",
+		CID:  cid,
+		Time: time.Now(),
+		PID:  pid,
+	})
+}
+
+// emitLifecycleEvent converts kernel lifecycle events to stream events.
+func (l *Loader) emitLifecycleEvent(kev kernel.LifecycleEvent) {
+	ev := StreamEvent{
+		Type: kev.Type.String(),
+		CID:  kev.ContainerID,
+		Time: time.Now(),
+		PID:  int32(kev.PID),
+	}
+	switch kev.Type {
+	case kernel.ProcessExitedEvent:
+		ev.Init = l.events.initExited(ev.CID, ev.PID)
+		if kev.ExitStatus.Signaled() {
+			ev.Signal = int(kev.ExitStatus.TerminationSignal())
+		} else {
+			ev.ExitCode = int(kev.ExitStatus.ExitStatus())
+		}
+	case kernel.SignalDeliveredEvent:
+		ev.Signal = int(kev.Signal)
+	}
+	l.events.emit(ev)
+}
@@ -17,6 +17,7 @@ package boot
 import (
 	"gvisor.dev/gvisor/pkg/sentry/control"
 	"gvisor.dev/gvisor/pkg/sentry/usage"
+	"gvisor.dev/gvisor/pkg/sync"
 )
 
 // EventOut is the return type of the Event command.
@@ -25,6 +26,67 @@ type EventOut struct {
 
 	// ContainerUsage maps each container ID to its total CPU usage.
 	ContainerUsage map[string]uint64 `json:"containerUsage"`
+
+	// ContainerVoluntarySwitches maps each container ID to its total number
+	// of voluntary context switches.
+	ContainerVoluntarySwitches map[string]uint64 `json:"containerVoluntarySwitches"`
+
+	// ContainerInvoluntarySwitches maps each container ID to its total number
+	// of involuntary context switches.
+	ContainerInvoluntarySwitches map[string]uint64 `json:"containerInvoluntarySwitches"`
+
+	// ContainerPageFaults maps each container ID to its page fault counts.
+	ContainerPageFaults map[string]control.PageFaults `json:"containerPageFaults"`
+
+	// ContainerCPU maps each container ID to its CPU usage split into user
+	// and kernel time, in nanoseconds. Total is the sum of both.
+	ContainerCPU map[string]CPUUsage `json:"containerCPU"`
+
+	// ContainerMemory maps the ID of each started container to its memory
+	// stats.
+	ContainerMemory map[string]MemoryStats `json:"containerMemory"`
+}
+
+// MemoryStats contains the memory stats of a container.
+type MemoryStats struct {
+	// Usage is the resident memory of the container's processes, in bytes.
+	// Memory shared by several processes is counted for each of them.
+	Usage uint64 `json:"usage"`
+
+	// MaxUsage is the highest Usage reported so far. Usage is only sampled
+	// when stats are retrieved, so spikes in between are missed.
+	MaxUsage uint64 `json:"maxUsage"`
+
+	// Limit is the memory limit in the container's spec or, if it has none,
+	// the memory available to the sandbox, as reported in /proc/meminfo.
+	Limit uint64 `json:"limit"`
+}
+
+// memoryPeaks tracks the highest memory usage reported for each container.
+type memoryPeaks struct {
+	mu    sync.Mutex
+	peaks map[string]uint64
+}
+
+// update records the current usage of container cid and returns its peak
+// usage.
+func (m *memoryPeaks) update(cid string, cur uint64) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.peaks == nil {
+		m.peaks = make(map[string]uint64)
+	}
+	if cur > m.peaks[cid] {
+		m.peaks[cid] = cur
+	}
+	return m.peaks[cid]
+}
+
+// remove forgets the peak usage of container cid.
+func (m *memoryPeaks) remove(cid string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.peaks, cid)
 }
 
 // Event struct for encoding the event data to JSON. Corresponds to runc's
@@ -65,11 +127,32 @@ type Memory struct {
 	Kernel    MemoryEntry       `json:"kernel,omitempty"`
 	KernelTCP MemoryEntry       `json:"kernelTCP,omitempty"`
 	Raw       map[string]uint64 `json:"raw,omitempty"`
+
+	// PageFaults counts faults on application memory.
+	PageFaults control.PageFaults `json:"pageFaults"`
+
+	// ContainerUsage is the resident memory of the processes of the selected
+	// container, see MemoryStats. It's only set if EventArgs.CID is set;
+	// Usage always reports the whole sandbox.
+	ContainerUsage MemoryEntry `json:"containerUsage,omitempty"`
 }
 
 // CPU contains stats on the CPU.
 type CPU struct {
-	Usage CPUUsage `json:"usage"`
+	Usage           CPUUsage        `json:"usage"`
+	ContextSwitches ContextSwitches `json:"contextSwitches"`
+}
+
+// ContextSwitches contains stats on context switches.
+type ContextSwitches struct {
+	// Voluntary is the number of times tasks ceded the CPU, e.g. to block.
+	Voluntary uint64 `json:"voluntary"`
+
+	// Involuntary is the number of times tasks were preempted because their
+	// timeslice was over while other tasks waited for a CPU. Only tasks of
+	// containers with scheduling latency targets are preempted, see
+	// containerManager.SetSchedLatency.
+	Involuntary uint64 `json:"involuntary"`
 }
 
 // CPUUsage contains stats on CPU usage.
@@ -80,11 +163,20 @@ type CPUUsage struct {
 	PerCPU []uint64 `json:"percpu,omitempty"`
 }
 
+// EventArgs are arguments to the Event method.
+type EventArgs struct {
+	// CID is the container that EventOut.Event reports stats of. Only
+	// sandbox-wide stats are reported in EventOut.Event if it's empty. The
+	// per-container maps of EventOut always cover all containers.
+	CID string
+}
+
 // Event gets the events from the container.
-func (cm *containerManager) Event(_ *struct{}, out *EventOut) error {
+func (cm *containerManager) Event(args *EventArgs, out *EventOut) error {
 	*out = EventOut{
 		Event: Event{
 			Type: "stats",
+			ID:   args.CID,
 		},
 	}
 
@@ -97,12 +189,86 @@ func (cm *containerManager) Event(_ *struct{}, out *EventOut) error {
 		Usage: totalUsage,
 	}
 
+	// Memory usage by container, from the RSS of its processes.
+	sandboxLimit := usage.TotalMemory(mem.TotalSize(), totalUsage)
+	memUsage := control.ContainerMemoryUsage(cm.l.k)
+	out.ContainerMemory = make(map[string]MemoryStats)
+	for cid, limit := range cm.l.containerMemoryLimits() {
+		if limit == 0 || limit > sandboxLimit {
+			limit = sandboxLimit
+		}
+		out.ContainerMemory[cid] = MemoryStats{
+			Usage:    memUsage[cid],
+			MaxUsage: cm.memoryPeaks.update(cid, memUsage[cid]),
+			Limit:    limit,
+		}
+	}
+
 	// PIDs.
 	// TODO(gvisor.dev/issue/172): Per-container accounting.
 	out.Event.Data.Pids.Current = uint64(len(cm.l.k.TaskSet().Root.ThreadGroups()))
 
 	// CPU usage by container.
 	out.ContainerUsage = control.ContainerUsage(cm.l.k)
+	out.ContainerCPU = make(map[string]CPUUsage)
+	for cid, stats := range control.ContainerCPUStats(cm.l.k) {
+		user := uint64(stats.UserTime.Nanoseconds())
+		kernel := uint64(stats.SysTime.Nanoseconds())
+		out.ContainerCPU[cid] = CPUUsage{
+			User:   user,
+			Kernel: kernel,
+			Total:  user + kernel,
+		}
+	}
 
+	// Context switches by container.
+	out.ContainerVoluntarySwitches, out.ContainerInvoluntarySwitches = control.ContainerContextSwitches(cm.l.k)
+
+	// Page faults by container.
+	out.ContainerPageFaults = control.ContainerPageFaults(cm.l.k)
+
+	if args.CID != "" {
+		out.selectContainer(args.CID)
+	}
 	return nil
 }
+
+// selectContainer fills the stats of container cid in e.Event from the
+// per-container maps.
+func (e *EventOut) selectContainer(cid string) {
+	data := &e.Event.Data
+	data.CPU.Usage = e.ContainerCPU[cid]
+	data.CPU.ContextSwitches.Voluntary = e.ContainerVoluntarySwitches[cid]
+	data.CPU.ContextSwitches.Involuntary = e.ContainerInvoluntarySwitches[cid]
+	data.Memory.PageFaults = e.ContainerPageFaults[cid]
+	if mem, ok := e.ContainerMemory[cid]; ok {
+		// Usage is left as is: it includes memory that isn't mapped by any
+		// process, e.g. the page cache and tmpfs.
+		data.Memory.ContainerUsage = MemoryEntry{
+			Usage: mem.Usage,
+			Max:   mem.MaxUsage,
+			Limit: mem.Limit,
+		}
+	}
+}
+
+// containerMemoryLimits returns the memory limit in the spec of each started
+// container, or 0 if it has none.
+func (l *Loader) containerMemoryLimits() map[string]uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limits := make(map[string]uint64)
+	for eid, ep := range l.processes {
+		if eid.pid != 0 || ep.spec == nil {
+			continue
+		}
+		var limit uint64
+		if sl := ep.spec.Linux; sl != nil && sl.Resources != nil && sl.Resources.Memory != nil {
+			if m := sl.Resources.Memory.Limit; m != nil && *m > 0 {
+				limit = uint64(*m)
+			}
+		}
+		limits[eid.cid] = limit
+	}
+	return limits
+}
@@ -0,0 +1,52 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"testing"
+)
+
+func TestEventSelectContainer(t *testing.T) {
+	e := EventOut{
+		ContainerCPU: map[string]CPUUsage{
+			"busy":  {User: 900, Kernel: 100, Total: 1000},
+			"sleep": {User: 1, Kernel: 2, Total: 3},
+		},
+		ContainerVoluntarySwitches:   map[string]uint64{"busy": 5, "sleep": 50},
+		ContainerInvoluntarySwitches: map[string]uint64{"busy": 70, "sleep": 1},
+		ContainerMemory: map[string]MemoryStats{
+			"busy": {Usage: 10, MaxUsage: 20, Limit: 30},
+		},
+	}
+	e.Event.Data.Memory.Usage.Usage = 100
+
+	e.selectContainer("busy")
+	data := e.Event.Data
+	if got, want := data.CPU.Usage, e.ContainerCPU["busy"]; got.Total != want.Total || got.User != want.User || got.Kernel != want.Kernel {
+		t.Errorf("CPU usage got: %+v, want: %+v", got, want)
+	}
+	if got := data.CPU.ContextSwitches.Voluntary; got != 5 {
+		t.Errorf("voluntary context switches got: %d, want: 5", got)
+	}
+	if got := data.CPU.ContextSwitches.Involuntary; got != 70 {
+		t.Errorf("involuntary context switches got: %d, want: 70", got)
+	}
+	if got, want := data.Memory.ContainerUsage, (MemoryEntry{Usage: 10, Max: 20, Limit: 30}); got != want {
+		t.Errorf("container memory usage got: %+v, want: %+v", got, want)
+	}
+	if got, want := data.Memory.Usage, (MemoryEntry{Usage: 100}); got != want {
+		t.Errorf("sandbox memory usage got: %+v, want: %+v", got, want)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import "golang.org/x/sys/unix"
+
+// WaitResult is the result of waiting on a process.
+type WaitResult struct {
+	// WaitStatus is the raw wait status of the process.
+	WaitStatus unix.WaitStatus `json:"waitStatus"`
+
+	// ExitStatus is the exit status of the process translated to the OCI
+	// convention, see OCIExitStatus.
+	ExitStatus int `json:"exitStatus"`
+}
+
+// newWaitResult returns the WaitResult for the given wait status.
+func newWaitResult(ws unix.WaitStatus) WaitResult {
+	return WaitResult{
+		WaitStatus: ws,
+		ExitStatus: OCIExitStatus(ws),
+	}
+}
+
+// OCIExitStatus translates a wait status to an exit status following the
+// convention used by runc and other OCI runtimes: processes that exited
+// normally report their exit status, while processes killed by a signal report
+// 128 + the signal number.
+func OCIExitStatus(ws unix.WaitStatus) int {
+	if ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return ws.ExitStatus()
+}
+
+// ExitResult describes how a container's init process exited.
+type ExitResult struct {
+	// CID is the container ID.
+	CID string `json:"cid"`
+
+	// ExitCode is the exit code of the process if it exited normally, or 0
+	// if it was killed by a signal.
+	ExitCode int `json:"exitCode"`
+
+	// Signal is the signal that killed the process, or 0 if it exited
+	// normally.
+	Signal unix.Signal `json:"signal"`
+
+	// CoreDumped is true if a core dump of the process was written when it
+	// was killed.
+	CoreDumped bool `json:"coreDumped"`
+}
+
+// newExitResult returns the ExitResult of container cid for the given wait
+// status.
+func newExitResult(cid string, ws unix.WaitStatus) ExitResult {
+	result := ExitResult{CID: cid}
+	if !ws.Signaled() {
+		result.ExitCode = ws.ExitStatus()
+		return result
+	}
+	result.Signal = ws.Signal()
+	result.CoreDumped = ws.CoreDump()
+	return result
+}
@@ -0,0 +1,99 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestOCIExitStatus(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		ws   unix.WaitStatus
+		want int
+	}{
+		{
+			name: "success",
+			ws:   0,
+			want: 0,
+		},
+		{
+			name: "exited",
+			ws:   unix.WaitStatus(42 << 8),
+			want: 42,
+		},
+		{
+			name: "killed",
+			ws:   unix.WaitStatus(unix.SIGKILL),
+			want: 128 + int(unix.SIGKILL),
+		},
+		{
+			name: "terminated with core dump",
+			ws:   unix.WaitStatus(unix.SIGSEGV) | 0x80,
+			want: 128 + int(unix.SIGSEGV),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := OCIExitStatus(tc.ws); got != tc.want {
+				t.Errorf("OCIExitStatus(%#x) = %d, want %d", uint32(tc.ws), got, tc.want)
+			}
+			if got := newWaitResult(tc.ws); got.WaitStatus != tc.ws || got.ExitStatus != tc.want {
+				t.Errorf("newWaitResult(%#x) = %+v, want raw status %#x and exit status %d", uint32(tc.ws), got, uint32(tc.ws), tc.want)
+			}
+		})
+	}
+}
+
+func TestNewExitResult(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		ws   unix.WaitStatus
+		want ExitResult
+	}{
+		{
+			name: "success",
+			ws:   0,
+			want: ExitResult{CID: "cid"},
+		},
+		{
+			name: "exited",
+			ws:   unix.WaitStatus(42 << 8),
+			want: ExitResult{CID: "cid", ExitCode: 42},
+		},
+		{
+			name: "killed",
+			ws:   unix.WaitStatus(unix.SIGKILL),
+			want: ExitResult{CID: "cid", Signal: unix.SIGKILL},
+		},
+		{
+			name: "killed by core signal without core dump",
+			ws:   unix.WaitStatus(unix.SIGSEGV),
+			want: ExitResult{CID: "cid", Signal: unix.SIGSEGV},
+		},
+		{
+			name: "terminated with core dump",
+			ws:   unix.WaitStatus(unix.SIGABRT) | 0x80,
+			want: ExitResult{CID: "cid", Signal: unix.SIGABRT, CoreDumped: true},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := newExitResult("cid", tc.ws); got != tc.want {
+				t.Errorf("newExitResult(%#x) = %+v, want %+v", uint32(tc.ws), got, tc.want)
+			}
+		})
+	}
+}
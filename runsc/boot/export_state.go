@@ -0,0 +1,232 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/pkg/sentry/control"
+	"gvisor.dev/gvisor/pkg/sentry/inet"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// ContainerStateVersion is the version of the ContainerState format. It's
+// bumped whenever fields are removed or change meaning.
+const ContainerStateVersion = 1
+
+// ContainerState is a portable snapshot of a container's state, meant to be
+// serialized as JSON for inspection and debugging by external tools.
+//
+// The snapshot is lossy: it describes the container, but omits memory,
+// file descriptors, socket state and everything else needed to recreate it.
+// It can't be used to restore a container; use checkpoint for that.
+type ContainerState struct {
+	// Version is the format version, see ContainerStateVersion.
+	Version int `json:"version"`
+
+	// ID is the container ID.
+	ID string `json:"id"`
+
+	// Spec is the OCI spec the container was started with. The environment
+	// of the process is redacted, since it often holds secrets.
+	Spec *specs.Spec `json:"spec"`
+
+	// Labels are the spec annotations.
+	Labels map[string]string `json:"labels"`
+
+	// Usage is the container's resource usage.
+	Usage ContainerUsage `json:"usage"`
+
+	// Processes are the container's running processes.
+	Processes []*control.Process `json:"processes"`
+
+	// Mounts are the mounts in the container's mount namespace, as listed in
+	// /proc/[pid]/mounts. They're only reported with VFS2, and omitted
+	// otherwise.
+	Mounts []MountState `json:"mounts,omitempty"`
+
+	// Interfaces are the network interfaces in the container's network
+	// namespace.
+	Interfaces []InterfaceState `json:"interfaces"`
+}
+
+// ContainerUsage is the resource usage part of ContainerState.
+type ContainerUsage struct {
+	// CPUTime is the CPU time consumed by the container, in nanoseconds,
+	// including reaped children.
+	CPUTime uint64 `json:"cpuTime"`
+
+	// VoluntarySwitches is the number of voluntary context switches,
+	// including reaped children.
+	VoluntarySwitches uint64 `json:"voluntarySwitches"`
+
+	// InvoluntarySwitches is the number of times the container's tasks were
+	// preempted, including reaped children.
+	InvoluntarySwitches uint64 `json:"involuntarySwitches"`
+}
+
+// MountState describes a single mount in ContainerState.
+type MountState struct {
+	Source  string   `json:"source"`
+	Target  string   `json:"target"`
+	Type    string   `json:"type"`
+	Options []string `json:"options"`
+}
+
+// InterfaceState describes a single network interface in ContainerState.
+type InterfaceState struct {
+	Name      string   `json:"name"`
+	MTU       uint32   `json:"mtu"`
+	Addresses []string `json:"addresses"`
+}
+
+// exportState builds a ContainerState snapshot of container cid.
+func (l *Loader) exportState(cid string) (*ContainerState, error) {
+	l.mu.Lock()
+	ep := l.processes[execID{cid: cid}]
+	if ep == nil || ep.tg == nil {
+		l.mu.Unlock()
+		return nil, fmt.Errorf("container %q not started", cid)
+	}
+	spec := ep.spec
+	netns := ep.netns
+	leader := ep.tg.Leader()
+	l.mu.Unlock()
+
+	if leader == nil {
+		return nil, fmt.Errorf("container %q init process has exited", cid)
+	}
+	if netns == nil {
+		netns = l.k.RootNetworkNamespace()
+	}
+
+	state := &ContainerState{
+		Version:    ContainerStateVersion,
+		ID:         cid,
+		Spec:       redactSpec(spec),
+		Labels:     map[string]string{},
+		Processes:  []*control.Process{},
+		Interfaces: []InterfaceState{},
+	}
+	if spec != nil {
+		for k, v := range spec.Annotations {
+			state.Labels[k] = v
+		}
+	}
+
+	state.Usage.CPUTime = control.ContainerUsage(l.k)[cid]
+	voluntary, involuntary := control.ContainerContextSwitches(l.k)
+	state.Usage.VoluntarySwitches = voluntary[cid]
+	state.Usage.InvoluntarySwitches = involuntary[cid]
+	if err := control.Processes(l.k, cid, &state.Processes); err != nil {
+		return nil, fmt.Errorf("listing processes: %w", err)
+	}
+
+	if l.root.conf.VFS2 {
+		mounts, err := l.containerMounts(leader.MountNamespaceVFS2())
+		if err != nil {
+			return nil, err
+		}
+		state.Mounts = mounts
+	}
+	state.Interfaces = containerInterfaces(netns.Stack())
+	return state, nil
+}
+
+// redactSpec returns a copy of spec without the environment of the process.
+// spec isn't modified.
+func redactSpec(spec *specs.Spec) *specs.Spec {
+	if spec == nil || spec.Process == nil {
+		return spec
+	}
+	redacted := *spec
+	process := *spec.Process
+	process.Env = nil
+	redacted.Process = &process
+	return &redacted
+}
+
+// containerMounts returns the mounts visible in mntns. It must only be called
+// with VFS2.
+func (l *Loader) containerMounts(mntns *vfs.MountNamespace) ([]MountState, error) {
+	// The mount namespace is released when the init process exits, which may
+	// race with this.
+	if mntns == nil || !mntns.TryIncRef() {
+		return nil, fmt.Errorf("container mount namespace is gone")
+	}
+	ctx := l.k.SupervisorContext()
+	defer mntns.DecRef(ctx)
+
+	root := mntns.Root()
+	root.IncRef()
+	defer root.DecRef(ctx)
+
+	var buf bytes.Buffer
+	l.k.VFS().GenerateProcMounts(ctx, root, &buf)
+
+	mounts := []MountState{}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		// Each line is "source target type options dump pass".
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		mounts = append(mounts, MountState{
+			Source:  fields[0],
+			Target:  fields[1],
+			Type:    fields[2],
+			Options: strings.Split(fields[3], ","),
+		})
+	}
+	return mounts, nil
+}
+
+// containerInterfaces returns the network interfaces of stack, ordered by
+// index.
+func containerInterfaces(stack inet.Stack) []InterfaceState {
+	ifaces := []InterfaceState{}
+	if stack == nil {
+		return ifaces
+	}
+	addrs := stack.InterfaceAddrs()
+	var idxs []int32
+	all := stack.Interfaces()
+	for idx := range all {
+		idxs = append(idxs, idx)
+	}
+	sort.Slice(idxs, func(i, j int) bool { return idxs[i] < idxs[j] })
+
+	for _, idx := range idxs {
+		iface := InterfaceState{
+			Name:      all[idx].Name,
+			MTU:       all[idx].MTU,
+			Addresses: []string{},
+		}
+		for _, addr := range addrs[idx] {
+			ipNet := net.IPNet{
+				IP:   net.IP(addr.Addr),
+				Mask: net.CIDRMask(int(addr.PrefixLen), len(addr.Addr)*8),
+			}
+			iface.Addresses = append(iface.Addresses, ipNet.String())
+		}
+		ifaces = append(ifaces, iface)
+	}
+	return ifaces
+}
@@ -948,6 +948,44 @@ func (c *containerMounter) mountSubmount(ctx context.Context, conf *config.Confi
 	return nil
 }
 
+// forceUnmountVFS1 detaches the mount at target in mns, after flushing the
+// dirent references cached by the mount.
+func forceUnmountVFS1(ctx context.Context, mns *fs.MountNamespace, target string) error {
+	root := mns.Root()
+	defer root.DecRef(ctx)
+
+	maxTraversals := uint(0)
+	dirent, err := mns.FindInode(ctx, root, root, target, &maxTraversals)
+	if err != nil {
+		return fmt.Errorf("can't find mount %q: %v", target, err)
+	}
+	defer dirent.DecRef(ctx)
+	if dirent == root {
+		return fmt.Errorf("can't unmount root")
+	}
+
+	// Check that target is a mount point before flushing, so that a bad
+	// target doesn't flush the dirent cache of the mount it belongs to.
+	mnt := mns.FindMount(dirent)
+	if mnt == nil || mnt.IsRoot() {
+		return fmt.Errorf("%q is not a mount point", target)
+	}
+	mntRoot := mnt.Root()
+	if mntRoot == nil {
+		return fmt.Errorf("mount %q is being released", target)
+	}
+	defer mntRoot.DecRef(ctx)
+	if mntRoot != dirent {
+		return fmt.Errorf("%q is not a mount point", target)
+	}
+
+	dirent.Inode.MountSource.FlushDirentRefs()
+	if err := mns.Unmount(ctx, dirent, true /* detachOnly */); err != nil {
+		return fmt.Errorf("unmounting %q: %w", target, err)
+	}
+	return nil
+}
+
 // mountSharedSubmount binds mount to a previously mounted volume that is shared
 // among containers in the same pod.
 func (c *containerMounter) mountSharedSubmount(ctx context.Context, mns *fs.MountNamespace, root *fs.Dirent, mount *specs.Mount, source *mountHint) error {
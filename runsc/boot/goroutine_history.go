@@ -0,0 +1,120 @@
+// Copyright 2018 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"runtime"
+	"runtime/pprof"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sync"
+)
+
+// goroutineHistorySize is the number of samples kept by goroutineHistory. At
+// the default interval of a few seconds, it covers hours of history.
+const goroutineHistorySize = 4096
+
+// GoroutineSample is a sample of the sandbox's goroutine and thread counts.
+type GoroutineSample struct {
+	// Time is when the sample was taken.
+	Time time.Time
+
+	// Goroutines is the number of goroutines in the sandbox.
+	Goroutines int
+
+	// Threads is the number of OS threads created by the Go runtime.
+	Threads int
+}
+
+// goroutineHistory periodically samples goroutine and thread counts into a
+// bounded ring buffer, to spot slow leaks that a single sample would miss.
+type goroutineHistory struct {
+	// threads is the profile counting created OS threads. It's immutable.
+	threads *pprof.Profile
+
+	// stopCh is closed to stop sampling.
+	stopCh chan struct{}
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// samples is the ring buffer. It only grows until it reaches its
+	// capacity, then the oldest sample is overwritten.
+	samples []GoroutineSample
+
+	// next is the index in samples of the oldest sample, which is overwritten
+	// next once samples is full.
+	next int
+}
+
+func newGoroutineHistory(size int) *goroutineHistory {
+	return &goroutineHistory{
+		threads: pprof.Lookup("threadcreate"),
+		stopCh:  make(chan struct{}),
+		samples: make([]GoroutineSample, 0, size),
+	}
+}
+
+// start samples goroutine and thread counts every interval until stop is
+// called.
+func (h *goroutineHistory) start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			h.sample(time.Now())
+			select {
+			case <-ticker.C:
+			case <-h.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// stop stops sampling started by start.
+func (h *goroutineHistory) stop() {
+	close(h.stopCh)
+}
+
+// sample records the current counts. Both counters are cheap to read, they
+// don't stop the world.
+func (h *goroutineHistory) sample(now time.Time) {
+	h.add(GoroutineSample{
+		Time:       now,
+		Goroutines: runtime.NumGoroutine(),
+		Threads:    h.threads.Count(),
+	})
+}
+
+func (h *goroutineHistory) add(s GoroutineSample) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.samples) < cap(h.samples) {
+		h.samples = append(h.samples, s)
+		return
+	}
+	h.samples[h.next] = s
+	h.next = (h.next + 1) % len(h.samples)
+}
+
+// history returns the samples, oldest first.
+func (h *goroutineHistory) history() []GoroutineSample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]GoroutineSample, 0, len(h.samples))
+	out = append(out, h.samples[h.next:]...)
+	return append(out, h.samples[:h.next]...)
+}
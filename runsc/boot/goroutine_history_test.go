@@ -0,0 +1,70 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGoroutineHistoryBounded(t *testing.T) {
+	const size = 4
+	h := newGoroutineHistory(size)
+	if got := h.history(); len(got) != 0 {
+		t.Fatalf("history() of new history got: %+v, want empty", got)
+	}
+
+	// The history grows until it's full, then drops the oldest samples.
+	for i := 0; i < size*2+1; i++ {
+		h.add(GoroutineSample{Goroutines: i})
+		got := h.history()
+		wantLen := i + 1
+		if wantLen > size {
+			wantLen = size
+		}
+		if len(got) != wantLen {
+			t.Fatalf("after %d samples, len(history()) = %d, want %d", i+1, len(got), wantLen)
+		}
+		for j, s := range got {
+			if want := i + 1 - wantLen + j; s.Goroutines != want {
+				t.Errorf("after %d samples, history()[%d].Goroutines = %d, want %d", i+1, j, s.Goroutines, want)
+			}
+		}
+	}
+}
+
+func TestGoroutineHistorySampling(t *testing.T) {
+	h := newGoroutineHistory(goroutineHistorySize)
+	h.start(time.Millisecond)
+	defer h.stop()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for len(h.history()) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("history didn't grow, got: %+v", h.history())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	history := h.history()
+	for i, s := range history {
+		if s.Goroutines <= 0 || s.Threads <= 0 {
+			t.Errorf("history()[%d] = %+v, want positive counts", i, s)
+		}
+		if i > 0 && s.Time.Before(history[i-1].Time) {
+			t.Errorf("history()[%d] = %+v is older than the previous sample %+v", i, s, history[i-1])
+		}
+	}
+}
@@ -152,3 +152,27 @@ func createLimitSet(spec *specs.Spec) (*limits.LimitSet, error) {
 	}
 	return ls, nil
 }
+
+// applyRlimits overrides the limits in ls with rlimits, which are keyed by
+// resource name, e.g. "RLIMIT_NOFILE". As for an unprivileged setrlimit(2),
+// they may lower the hard limits but not raise them above the container's.
+func applyRlimits(ls *limits.LimitSet, rlimits map[string]limits.Limit) error {
+	for name, l := range rlimits {
+		lt, ok := fromLinuxResource[name]
+		if !ok {
+			return invalidArgf("unknown resource %q", name)
+		}
+		if l.Cur > l.Max {
+			return invalidArgf("invalid %s: soft limit %d exceeds hard limit %d", name, l.Cur, l.Max)
+		}
+		if max := ls.Get(lt).Max; l.Max > max {
+			return invalidArgf("invalid %s: hard limit %d exceeds the container's hard limit %d", name, l.Max, max)
+		}
+	}
+	for name, l := range rlimits {
+		if _, err := ls.Set(fromLinuxResource[name], l, false /* privileged */); err != nil {
+			return invalidArgf("setting %s: %v", name, err)
+		}
+	}
+	return nil
+}
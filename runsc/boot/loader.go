@@ -16,11 +16,13 @@
 package boot
 
 import (
+	gocontext "context"
 	"errors"
 	"fmt"
 	mrand "math/rand"
 	"os"
 	"runtime"
+	"sort"
 	"sync/atomic"
 	gtime "time"
 
@@ -46,6 +48,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/inet"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
 	"gvisor.dev/gvisor/pkg/sentry/loader"
 	"gvisor.dev/gvisor/pkg/sentry/pgalloc"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
@@ -70,6 +73,8 @@ import (
 	"gvisor.dev/gvisor/pkg/tcpip/transport/raw"
 	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
 	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+	"gvisor.dev/gvisor/pkg/urpc"
+	"gvisor.dev/gvisor/pkg/waiter"
 	"gvisor.dev/gvisor/runsc/boot/filter"
 	_ "gvisor.dev/gvisor/runsc/boot/platforms" // register all platforms.
 	"gvisor.dev/gvisor/runsc/boot/pprof"
@@ -115,6 +120,10 @@ type Loader struct {
 	// root contains information about the root container in the sandbox.
 	root containerInfo
 
+	// watchdog is replaced on restore. Goroutines other than the one running
+	// the restore must read it with currentWatchdog.
+	//
+	// watchdog is guarded by mu.
 	watchdog *watchdog.Watchdog
 
 	// stopSignalForwarding disables forwarding of signals to the sandboxed
@@ -125,13 +134,36 @@ type Loader struct {
 	// should be called when a sandbox is destroyed.
 	stopProfiling func()
 
+	// goroutines samples goroutine and thread counts. It's nil if
+	// conf.GoroutineSampleInterval is 0.
+	goroutines *goroutineHistory
+
+	// checkpointFile holds the destination of checkpoints triggered by
+	// conf.CheckpointSignal.
+	checkpointFile signalCheckpointFile
+
+	// events writes sandbox events to streams attached with
+	// containerManager.EventStream.
+	events eventStream
+
+	// coreDumps uploads core dumps to the file set with
+	// containerManager.SetCoreDumpUpload.
+	coreDumps coreDumpUpload
+
+	// perfCounters is nil if the platform counts hardware events for the
+	// debug.PerfCounters endpoint, or the reason it doesn't.
+	perfCounters error
+
 	// restore is set to true if we are restoring a container.
 	restore bool
 
 	// sandboxID is the ID for the whole sandbox.
 	sandboxID string
 
-	// mu guards processes.
+	// startTime is when the Loader was created. It's immutable.
+	startTime gtime.Time
+
+	// mu guards processes and watchdog.
 	mu sync.Mutex
 
 	// processes maps containers init process and invocation of exec. Root
@@ -174,6 +206,60 @@ type execProcess struct {
 	// TTY file is passed during container create and must be saved until
 	// container start.
 	hostTTY *fd.FD
+
+	// netns is the network namespace of a container started with an isolated
+	// network. It's nil if the container shares the root network namespace.
+	netns *inet.Namespace
+
+	// linkFDs are the FDs used by the fd-based links of netns's stack. They
+	// are closed along with the stack when the container is destroyed.
+	linkFDs []int
+
+	// spec is the OCI spec the container was started with. It's only set
+	// for container init processes, and only after the container starts.
+	spec *specs.Spec
+
+	// initCommand is the command of the container init process, recorded
+	// when the container starts. It's only set for container init processes.
+	initCommand InitCommand
+
+	// rootGoferFD is the sandbox FD of the gofer connection serving the
+	// container root filesystem. It's only set for container init processes,
+	// and is 0 if unknown, e.g. after restore.
+	rootGoferFD int
+
+	// killTimer kills an exec'd process that outlives its timeout. It's nil
+	// if the process has no timeout.
+	killTimer *execKillTimer
+}
+
+// execKillTimer kills an exec'd process with SIGKILL if it hasn't exited
+// before its timeout, see control.ExecArgs.TimeoutMs.
+type execKillTimer struct {
+	tg *kernel.ThreadGroup
+
+	// killed is set once the process has been killed. It's accessed
+	// atomically.
+	killed uint32
+}
+
+// NotifyTimer implements ktime.Listener.NotifyTimer.
+func (kt *execKillTimer) NotifyTimer(uint64, ktime.Setting) (ktime.Setting, bool) {
+	if kt.tg.Exited() {
+		return ktime.Setting{}, false
+	}
+	if err := kt.tg.SendSignal(&linux.SignalInfo{Signo: int32(linux.SIGKILL)}); err != nil {
+		log.Warningf("Killing exec'd process after its timeout failed: %v", err)
+		return ktime.Setting{}, false
+	}
+	log.Infof("Killed exec'd process after its timeout")
+	atomic.StoreUint32(&kt.killed, 1)
+	return ktime.Setting{}, false
+}
+
+// timedOut returns true if the process has been killed after its timeout.
+func (kt *execKillTimer) timedOut() bool {
+	return kt != nil && atomic.LoadUint32(&kt.killed) != 0
 }
 
 func init() {
@@ -192,6 +278,9 @@ type Args struct {
 	// ControllerFD is the FD to the URPC controller. The Loader takes ownership
 	// of this FD and may close it at any time.
 	ControllerFD int
+	// ControlToken is an optional token that clients must send to the control
+	// server before making requests.
+	ControlToken []byte
 	// Device is an optional argument that is passed to the platform. The Loader
 	// takes ownership of this file and may close it at any time.
 	Device *os.File
@@ -223,6 +312,10 @@ type Args struct {
 	// TraceFD is the file descriptor to write a Go execution trace to.
 	// Valid if >=0.
 	TraceFD int
+	// ReadyFD is the file descriptor to notify once the loader has been created
+	// and the control server is serving. The Loader takes ownership of this FD.
+	// Valid if >0.
+	ReadyFD int
 	// ProductName is the value to show in
 	// /sys/devices/virtual/dmi/id/product_name.
 	ProductName string
@@ -289,6 +382,10 @@ func New(args Args) (*Loader, error) {
 	k := &kernel.Kernel{
 		Platform: p,
 	}
+	perfCounters := enablePerfCounters(args.Conf, p)
+	if args.Conf.PerfCounters && perfCounters != nil {
+		log.Warningf("Perf counters unavailable: %v", perfCounters)
+	}
 
 	// Create memory file.
 	mf, err := createMemoryFile()
@@ -376,6 +473,20 @@ func New(args Args) (*Loader, error) {
 		}
 	}
 
+	if args.Conf.FutexStats {
+		k.EnableFutexStats()
+	}
+
+	policy, err := SyscallPolicyFromSpec(args.Spec)
+	if err != nil {
+		return nil, err
+	}
+	if policy != nil {
+		if err := k.SetSyscallPolicy(args.ID, policy.kernelPolicy()); err != nil {
+			return nil, fmt.Errorf("setting syscall policy: %w", err)
+		}
+	}
+
 	if err := adjustDirentCache(k); err != nil {
 		return nil, err
 	}
@@ -427,11 +538,16 @@ func New(args Args) (*Loader, error) {
 		k:             k,
 		watchdog:      dog,
 		sandboxID:     args.ID,
+		startTime:     gtime.Now(),
 		processes:     map[execID]*execProcess{eid: {}},
 		mountHints:    mountHints,
 		root:          info,
 		stopProfiling: stopProfiling,
 		productName:   args.ProductName,
+		perfCounters:  perfCounters,
+	}
+	if args.Conf.GoroutineSampleInterval > 0 {
+		l.goroutines = newGoroutineHistory(goroutineHistorySize)
 	}
 
 	// We don't care about child signals; some platforms can generate a
@@ -444,7 +560,7 @@ func New(args Args) (*Loader, error) {
 	//
 	// This must be done *after* we have initialized the kernel since the
 	// controller is used to configure the kernel's network stack.
-	ctrl, err := newController(args.ControllerFD, l)
+	ctrl, err := newController(args.ControllerFD, args.ControlToken, l)
 	if err != nil {
 		return nil, fmt.Errorf("creating control server: %w", err)
 	}
@@ -456,9 +572,30 @@ func New(args Args) (*Loader, error) {
 		return nil, fmt.Errorf("starting control server: %w", err)
 	}
 
+	// Let the client know that it can start issuing requests to the control
+	// server, so it doesn't need to poll for it.
+	if args.ReadyFD > 0 {
+		if err := notifyReady(args.ReadyFD); err != nil {
+			return nil, fmt.Errorf("notifying loader readiness: %w", err)
+		}
+	}
+
+	if l.goroutines != nil {
+		l.goroutines.start(args.Conf.GoroutineSampleInterval)
+	}
 	return l, nil
 }
 
+// notifyReady writes a single byte to the given FD and closes it.
+func notifyReady(fd int) error {
+	f := os.NewFile(uintptr(fd), "ready file")
+	defer f.Close()
+	if _, err := f.Write([]byte{0}); err != nil {
+		return err
+	}
+	return nil
+}
+
 // createProcessArgs creates args that can be used with kernel.CreateProcess.
 func createProcessArgs(id string, spec *specs.Spec, creds *auth.Credentials, k *kernel.Kernel, pidns *kernel.PIDNamespace) (kernel.CreateProcessArgs, error) {
 	// Create initial limits.
@@ -490,6 +627,7 @@ func createProcessArgs(id string, spec *specs.Spec, creds *auth.Credentials, k *
 		AbstractSocketNamespace: k.RootAbstractSocketNamespace(),
 		ContainerID:             id,
 		PIDNamespace:            pidns,
+		NoNewPrivs:              spec.Process.NoNewPrivileges,
 	}
 
 	return procArgs, nil
@@ -498,8 +636,9 @@ func createProcessArgs(id string, spec *specs.Spec, creds *auth.Credentials, k *
 // Destroy cleans up all resources used by the loader.
 //
 // Note that this will block until all open control server connections have
-// been closed. For that reason, this should NOT be called in a defer, because
-// a panic in a control server rpc would then hang forever.
+// been closed, or for at most stopRPCTimeout + stopHandlersTimeout. For that
+// reason, this should NOT be called in a defer, because a panic in a control
+// server rpc would then delay the exit.
 func (l *Loader) Destroy() {
 	if l.stopSignalForwarding != nil {
 		l.stopSignalForwarding()
@@ -529,6 +668,9 @@ func (l *Loader) Destroy() {
 	}
 
 	l.stopProfiling()
+	if l.goroutines != nil {
+		l.goroutines.stop()
+	}
 }
 
 func createPlatform(conf *config.Config, deviceFile *os.File) (platform.Platform, error) {
@@ -626,6 +768,9 @@ func (l *Loader) run() error {
 
 		// Create the root container init task. It will begin running
 		// when the kernel is started.
+		if len(l.root.goferFDs) > 0 {
+			ep.rootGoferFD = l.root.goferFDs[0].FD()
+		}
 		var err error
 		_, ep.tty, ep.ttyVFS2, err = l.createContainerProcess(true, l.sandboxID, &l.root)
 		if err != nil {
@@ -634,6 +779,8 @@ func (l *Loader) run() error {
 	}
 
 	ep.tg = l.k.GlobalInit()
+	ep.spec = l.root.spec
+	ep.initCommand = newInitCommand(ep.tg, l.root.procArgs.Argv)
 	if ns, ok := specutils.GetNS(specs.PIDNamespace, l.root.spec); ok {
 		ep.pidnsPath = ns.Path
 	}
@@ -655,14 +802,22 @@ func (l *Loader) run() error {
 			deliveryMode = DeliverToForegroundProcessGroup
 		}
 		log.Infof("Received external signal %d, mode: %s", sig, deliveryMode)
-		if err := l.signal(l.sandboxID, 0, int32(sig), deliveryMode); err != nil {
+		if _, err := l.signal(l.sandboxID, 0, int32(sig), 0 /* value */, deliveryMode); err != nil {
 			log.Warningf("error sending signal %s to container %q: %s", sig, l.sandboxID, err)
 		}
 	})
 
+	if sig := l.root.conf.CheckpointSignal; sig != -1 {
+		l.k.InterceptInitSignal(linux.Signal(sig), l.checkpointOnSignal)
+	}
+
 	log.Infof("Process should have started...")
 	l.watchdog.Start()
-	return l.k.Start()
+	if err := l.k.Start(); err != nil {
+		return err
+	}
+	l.emitContainerStart(l.sandboxID, ep.tg)
+	return nil
 }
 
 // createSubcontainer creates a new container inside the sandbox.
@@ -672,7 +827,7 @@ func (l *Loader) createSubcontainer(cid string, tty *fd.FD) error {
 
 	eid := execID{cid: cid}
 	if _, ok := l.processes[eid]; ok {
-		return fmt.Errorf("container %q already exists", cid)
+		return urpc.WithCode(ErrCodeAlreadyExists, fmt.Errorf("container %q already exists", cid))
 	}
 	l.processes[eid] = &execProcess{hostTTY: tty}
 	return nil
@@ -680,8 +835,14 @@ func (l *Loader) createSubcontainer(cid string, tty *fd.FD) error {
 
 // startSubcontainer starts a child container. It returns the thread group ID of
 // the newly created process. Used FDs are either closed or released. It's safe
-// for the caller to close any remaining files upon return.
-func (l *Loader) startSubcontainer(spec *specs.Spec, conf *config.Config, cid string, stdioFDs, goferFDs []*fd.FD) error {
+// for the caller to close any remaining files upon return. If isolatedNetwork
+// is true, the container gets its own network stack instead of sharing the
+// root container's.
+func (l *Loader) startSubcontainer(spec *specs.Spec, conf *config.Config, cid string, stdioFDs, goferFDs []*fd.FD, isolatedNetwork bool) error {
+	if isolatedNetwork && conf.Network == config.NetworkHost {
+		return fmt.Errorf("isolated container network is not supported with --network=%v", config.NetworkHost)
+	}
+
 	// Create capabilities.
 	caps, err := specutils.Capabilities(conf.EnableRaw, spec.Process.Capabilities)
 	if err != nil {
@@ -693,7 +854,7 @@ func (l *Loader) startSubcontainer(spec *specs.Spec, conf *config.Config, cid st
 
 	ep := l.processes[execID{cid: cid}]
 	if ep == nil {
-		return fmt.Errorf("trying to start a deleted container %q", cid)
+		return urpc.WithCode(ErrCodeNotFound, fmt.Errorf("trying to start a deleted container %q", cid))
 	}
 
 	// Convert the spec's additional GIDs to KGIDs.
@@ -740,6 +901,10 @@ func (l *Loader) startSubcontainer(spec *specs.Spec, conf *config.Config, cid st
 	if err != nil {
 		return fmt.Errorf("creating new process: %w", err)
 	}
+	if isolatedNetwork {
+		ep.netns = inet.NewNamespace(l.k.RootNetworkNamespace())
+		info.procArgs.NetworkNamespace = ep.netns
+	}
 
 	// Use stdios or TTY depending on the spec configuration.
 	if spec.Process.Terminal {
@@ -755,11 +920,15 @@ func (l *Loader) startSubcontainer(spec *specs.Spec, conf *config.Config, cid st
 		info.stdioFDs = stdioFDs
 	}
 
+	ep.rootGoferFD = goferFDs[0].FD()
 	ep.tg, ep.tty, ep.ttyVFS2, err = l.createContainerProcess(false, cid, info)
 	if err != nil {
 		return err
 	}
+	ep.spec = spec
+	ep.initCommand = newInitCommand(ep.tg, info.procArgs.Argv)
 	l.k.StartProcess(ep.tg)
+	l.emitContainerStart(cid, ep.tg)
 	return nil
 }
 
@@ -891,19 +1060,44 @@ func (l *Loader) startGoferMonitor(cid string, rootfsGoferFD int32) {
 }
 
 // destroySubcontainer stops a container if it is still running and cleans up
-// its filesystem.
-func (l *Loader) destroySubcontainer(cid string) error {
+// its filesystem. If grace isn't 0, the container init is first sent SIGTERM
+// and given up to grace to exit before all processes are sent SIGKILL.
+func (l *Loader) destroySubcontainer(cid string, grace gtime.Duration) error {
+	if grace > 0 {
+		l.terminateContainer(cid, grace)
+	}
+
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
 	tg, err := l.tryThreadGroupFromIDLocked(execID{cid: cid})
 	if err != nil {
-		// Container doesn't exist.
+		// The container doesn't exist, but a partial destroy may have left
+		// entries for its exec'd processes behind. They may still be running,
+		// so kill them before forgetting about them.
+		l.k.ClearContainerPauses(cid)
+		for key, ep := range l.processes {
+			if key.cid != cid || ep.tg == nil || ep.tg.Exited() {
+				continue
+			}
+			if err := ep.tg.SendSignal(&linux.SignalInfo{Signo: int32(linux.SIGKILL)}); err != nil {
+				log.Warningf("Killing leftover process %d of container %q: %v", key.pid, cid, err)
+				continue
+			}
+			ep.tg.WaitExited()
+		}
+		if l.removeContainerLocked(cid) {
+			log.Warningf("Cleaned up leftovers of partially destroyed container %q", cid)
+			return nil
+		}
 		return err
 	}
 
 	// The container exists, but has it been started?
 	if tg != nil {
+		// Paused tasks can't exit, so the container must be resumed for the
+		// SIGKILL below to take effect.
+		l.k.ClearContainerPauses(cid)
 		if err := l.signalAllProcesses(cid, int32(linux.SIGKILL)); err != nil {
 			return fmt.Errorf("sending SIGKILL to all container processes: %w", err)
 		}
@@ -917,7 +1111,9 @@ func (l *Loader) destroySubcontainer(cid string) error {
 
 		// At this point, all processes inside of the container have exited,
 		// releasing all references to the container's MountNamespace and
-		// causing all submounts and overlays to be unmounted.
+		// causing all submounts and overlays to be unmounted. Submounts aren't
+		// unmounted one by one, so a failing one can't leave the others
+		// mounted.
 		//
 		// Since the container's MountNamespace has been released,
 		// MountNamespace.destroy() will have executed, but that function may
@@ -927,19 +1123,173 @@ func (l *Loader) destroySubcontainer(cid string) error {
 		fs.AsyncBarrier()
 	}
 
-	// No more failure from this point on. Remove all container thread groups
-	// from the map.
+	// No more failure from this point on.
+	l.removeContainerLocked(cid)
+	log.Debugf("Container destroyed, cid: %s", cid)
+	return nil
+}
+
+// removeContainerLocked removes all thread groups of container cid from the
+// processes map, closes its isolated network stack, if any, and resets its
+// per-container kernel settings, including pauses, so that they don't apply
+// to a new container with the same ID. It returns true if the map had any
+// entry for the container.
+//
+// Preconditions: l.mu must be locked.
+func (l *Loader) removeContainerLocked(cid string) bool {
+	if ep := l.processes[execID{cid: cid}]; ep != nil && ep.netns != nil {
+		ep.closeNetwork()
+	}
+	found := false
 	for key := range l.processes {
 		if key.cid == cid {
 			delete(l.processes, key)
+			found = true
 		}
 	}
+	// Restoring the default can't fail.
+	_ = l.k.SetReadAhead(cid, 0)
+	l.k.ClearSyscallPolicy(cid)
+	l.k.ClearSyncPolicy(cid)
+	l.k.ClearContainerPauses(cid)
+	l.k.ClearFutexStats(cid)
+	l.k.ClearSchedLatency(cid)
+	return found
+}
 
-	log.Debugf("Container destroyed, cid: %s", cid)
-	return nil
+// graceTick is how often terminateContainer checks whether the container is
+// paused, as the grace period doesn't run while it is.
+const graceTick = 100 * gtime.Millisecond
+
+// terminateContainer resumes container cid if it's paused, sends SIGTERM to
+// its init process and waits up to grace for it to exit. Time during which the
+// container is paused again, e.g. because the whole sandbox is, doesn't count
+// towards grace. It doesn't fail: the container is killed afterwards anyway if
+// it's still running.
+//
+// It must not be called with l.mu held, as that would block all other
+// container operations for up to grace.
+func (l *Loader) terminateContainer(cid string, grace gtime.Duration) {
+	tg, err := l.threadGroupFromID(execID{cid: cid})
+	if err != nil {
+		// Not started or already destroyed, there is nothing to terminate.
+		return
+	}
+	// Paused tasks can't handle SIGTERM.
+	l.k.ClearContainerPauses(cid)
+	if err := l.k.SendExternalSignalThreadGroup(tg, newSignalInfo(int32(linux.SIGTERM), 0)); err != nil {
+		log.Warningf("Sending SIGTERM to container %q: %v", cid, err)
+		return
+	}
+
+	e, done := waiter.NewChannelEntry(waiter.EventHUp)
+	tg.EventRegisterExited(&e)
+	defer tg.EventUnregisterExited(&e)
+	if tg.Exited() {
+		return
+	}
+	ticker := gtime.NewTicker(graceTick)
+	defer ticker.Stop()
+	for left := grace; left > 0; {
+		select {
+		case <-done:
+			log.Debugf("Container %q exited after SIGTERM", cid)
+			return
+		case <-ticker.C:
+			if !l.k.ContainerPaused(cid) {
+				left -= graceTick
+			}
+		}
+	}
+	log.Infof("Container %q didn't exit %v after SIGTERM, sending SIGKILL", cid, grace)
 }
 
 func (l *Loader) executeAsync(args *control.ExecArgs) (kernel.ThreadID, error) {
+	_, tgid, err := l.startExec(args)
+	return tgid, err
+}
+
+// executeSync is like executeAsync, but waits for the process to exit and
+// returns its exit status. The process is waited for directly rather than
+// through the processes map, so the status is returned even if a concurrent
+// WaitPID clears it. Otherwise, executeSync clears it, as it has been
+// returned.
+//
+// If the process is killed after its timeout, ErrExecTimeout is returned.
+func (l *Loader) executeSync(args *control.ExecArgs) (uint32, error) {
+	ep, tgid, err := l.startExec(args)
+	if err != nil {
+		return 0, err
+	}
+	ws := l.wait(ep.tg)
+
+	l.mu.Lock()
+	eid := execID{cid: args.ContainerID, pid: tgid}
+	if l.processes[eid] == ep {
+		delete(l.processes, eid)
+		log.Debugf("updated processes (removal): %v", l.processes)
+	}
+	l.mu.Unlock()
+
+	if ep.killTimer.timedOut() {
+		return ws, ErrExecTimeout
+	}
+	return ws, nil
+}
+
+// preExitHookKillTimeout is how long runPreExitHook waits for the pre-exit
+// hook to exit after sending it SIGKILL.
+const preExitHookKillTimeout = 5 * gtime.Second
+
+// runPreExitHook is like executeSync, but kills the process with SIGKILL once
+// ctx is done, in which case ErrExecTimeout is returned along with the status
+// of the killed process. If the process still hasn't exited
+// preExitHookKillTimeout after SIGKILL, an error is returned without waiting
+// further.
+func (l *Loader) runPreExitHook(ctx gocontext.Context, args *control.ExecArgs) (uint32, error) {
+	ep, tgid, err := l.startExec(args)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		eid := execID{cid: args.ContainerID, pid: tgid}
+		if l.processes[eid] == ep {
+			delete(l.processes, eid)
+			log.Debugf("updated processes (removal): %v", l.processes)
+		}
+	}()
+
+	e, exited := waiter.NewChannelEntry(waiter.EventHUp)
+	ep.tg.EventRegisterExited(&e)
+	defer ep.tg.EventUnregisterExited(&e)
+	if ep.tg.Exited() {
+		return uint32(ep.tg.ExitStatus()), nil
+	}
+	select {
+	case <-exited:
+		return uint32(ep.tg.ExitStatus()), nil
+	case <-ctx.Done():
+	}
+
+	// Paused tasks can't handle SIGKILL.
+	l.k.ClearContainerPauses(args.ContainerID)
+	if err := l.k.SendExternalSignalThreadGroup(ep.tg, newSignalInfo(int32(linux.SIGKILL), 0)); err != nil {
+		return 0, fmt.Errorf("killing pre-exit hook: %w", err)
+	}
+	select {
+	case <-exited:
+		return uint32(ep.tg.ExitStatus()), ErrExecTimeout
+	case <-gtime.After(preExitHookKillTimeout):
+		return 0, fmt.Errorf("pre-exit hook didn't exit %v after SIGKILL", preExitHookKillTimeout)
+	}
+}
+
+// startExec starts the process described by args in its container, and
+// registers it in the processes map. If args.TimeoutMs is positive, the
+// process is killed if it hasn't exited after the timeout.
+func (l *Loader) startExec(args *control.ExecArgs) (*execProcess, kernel.ThreadID, error) {
 	// Hold the lock for the entire operation to ensure that exec'd process is
 	// added to 'processes' in case it races with destroyContainer().
 	l.mu.Lock()
@@ -947,10 +1297,23 @@ func (l *Loader) executeAsync(args *control.ExecArgs) (kernel.ThreadID, error) {
 
 	tg, err := l.tryThreadGroupFromIDLocked(execID{cid: args.ContainerID})
 	if err != nil {
-		return 0, err
+		return nil, 0, err
 	}
 	if tg == nil {
-		return 0, fmt.Errorf("container %q not started", args.ContainerID)
+		return nil, 0, fmt.Errorf("container %q not started", args.ContainerID)
+	}
+
+	if args.WorkingDirectory != "" {
+		args.WorkingDirectory, err = cleanWorkingDirectory(args.WorkingDirectory)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	// Run the process in the container's isolated network stack, if any.
+	initEP := l.processes[execID{cid: args.ContainerID}]
+	if initEP != nil {
+		args.NetworkNamespace = initEP.netns
 	}
 
 	// Get the container MountNamespace from the Task. Try to acquire ref may fail
@@ -959,7 +1322,7 @@ func (l *Loader) executeAsync(args *control.ExecArgs) (kernel.ThreadID, error) {
 		// task.MountNamespaceVFS2() does not take a ref, so we must do so ourselves.
 		args.MountNamespaceVFS2 = tg.Leader().MountNamespaceVFS2()
 		if args.MountNamespaceVFS2 == nil || !args.MountNamespaceVFS2.TryIncRef() {
-			return 0, fmt.Errorf("container %q has stopped", args.ContainerID)
+			return nil, 0, fmt.Errorf("container %q has stopped", args.ContainerID)
 		}
 	} else {
 		var reffed bool
@@ -969,13 +1332,26 @@ func (l *Loader) executeAsync(args *control.ExecArgs) (kernel.ThreadID, error) {
 			reffed = args.MountNamespace.TryIncRef()
 		})
 		if !reffed {
-			return 0, fmt.Errorf("container %q has stopped", args.ContainerID)
+			return nil, 0, fmt.Errorf("container %q has stopped", args.ContainerID)
 		}
 	}
 
-	args.Envv, err = specutils.ResolveEnvs(args.Envv)
+	switch args.EnvMode {
+	case control.EnvReplace:
+		args.Envv, err = specutils.ResolveEnvs(args.Envv)
+	case control.EnvMerge:
+		// Merge with the environment the init process was started with,
+		// not its live environment, see control.EnvMode.
+		var initEnvv []string
+		if initEP != nil && initEP.spec != nil && initEP.spec.Process != nil {
+			initEnvv = initEP.spec.Process.Env
+		}
+		args.Envv, err = specutils.ResolveEnvs(initEnvv, args.Envv)
+	default:
+		err = fmt.Errorf("invalid env mode %v", args.EnvMode)
+	}
 	if err != nil {
-		return 0, fmt.Errorf("resolving env: %w", err)
+		return nil, 0, fmt.Errorf("resolving env: %w", err)
 	}
 
 	// Add the HOME environment variable if it is not already set.
@@ -983,9 +1359,14 @@ func (l *Loader) executeAsync(args *control.ExecArgs) (kernel.ThreadID, error) {
 		root := args.MountNamespaceVFS2.Root()
 		ctx := vfs.WithRoot(l.k.SupervisorContext(), root)
 		defer args.MountNamespaceVFS2.DecRef(ctx)
+		if args.WorkingDirectory != "" {
+			if err := checkWorkingDirectoryVFS2(ctx, l.k.VFS(), args.MountNamespaceVFS2, args.WorkingDirectory); err != nil {
+				return nil, 0, err
+			}
+		}
 		envv, err := user.MaybeAddExecUserHomeVFS2(ctx, args.MountNamespaceVFS2, args.KUID, args.Envv)
 		if err != nil {
-			return 0, err
+			return nil, 0, err
 		}
 		args.Envv = envv
 	} else {
@@ -993,9 +1374,14 @@ func (l *Loader) executeAsync(args *control.ExecArgs) (kernel.ThreadID, error) {
 		ctx := fs.WithRoot(l.k.SupervisorContext(), root)
 		defer args.MountNamespace.DecRef(ctx)
 		defer root.DecRef(ctx)
+		if args.WorkingDirectory != "" {
+			if err := checkWorkingDirectory(ctx, args.MountNamespace, root, args.WorkingDirectory); err != nil {
+				return nil, 0, err
+			}
+		}
 		envv, err := user.MaybeAddExecUserHome(ctx, args.MountNamespace, args.KUID, args.Envv)
 		if err != nil {
-			return 0, err
+			return nil, 0, err
 		}
 		args.Envv = envv
 	}
@@ -1003,39 +1389,82 @@ func (l *Loader) executeAsync(args *control.ExecArgs) (kernel.ThreadID, error) {
 
 	args.Limits, err = createLimitSet(l.root.spec)
 	if err != nil {
-		return 0, fmt.Errorf("creating limits: %w", err)
+		return nil, 0, fmt.Errorf("creating limits: %w", err)
+	}
+	if err := applyRlimits(args.Limits, args.Rlimits); err != nil {
+		return nil, 0, fmt.Errorf("applying rlimits: %w", err)
 	}
 
 	// Start the process.
 	proc := control.Proc{Kernel: l.k}
 	newTG, tgid, ttyFile, ttyFileVFS2, err := control.ExecAsync(&proc, args)
 	if err != nil {
-		return 0, err
+		return nil, 0, err
 	}
 
-	eid := execID{cid: args.ContainerID, pid: tgid}
-	l.processes[eid] = &execProcess{
+	ep := &execProcess{
 		tg:      newTG,
 		tty:     ttyFile,
 		ttyVFS2: ttyFileVFS2,
 	}
+	if args.TimeoutMs > 0 {
+		ep.killTimer = l.killAfterTimeout(newTG, gtime.Duration(args.TimeoutMs)*gtime.Millisecond)
+	}
+	eid := execID{cid: args.ContainerID, pid: tgid}
+	l.processes[eid] = ep
 	log.Debugf("updated processes: %v", l.processes)
 
-	return tgid, nil
+	return ep, tgid, nil
 }
 
-// waitContainer waits for the init process of a container to exit.
-func (l *Loader) waitContainer(cid string, waitStatus *uint32) error {
+// killAfterTimeout kills tg if it hasn't exited after timeout. Like
+// waitTimeout, the timeout is measured with the sandbox's monotonic clock, so
+// it follows the sandbox's view of time, e.g. across save and restore. If it
+// expires while the sandbox is paused, the process dies once it's resumed.
+func (l *Loader) killAfterTimeout(tg *kernel.ThreadGroup, timeout gtime.Duration) *execKillTimer {
+	kt := &execKillTimer{tg: tg}
+	clock := l.k.MonotonicClock()
+	timer := ktime.NewTimer(clock, kt)
+	timer.Swap(ktime.Setting{
+		Enabled: true,
+		Next:    clock.Now().Add(timeout),
+	})
+	// Cancel the timer once the process exits. The goroutine doesn't outlive
+	// the process, which is killed at the latest when the timer fires.
+	go func() {
+		tg.WaitExited()
+		timer.Destroy()
+	}()
+	return kt
+}
+
+// currentWatchdog returns the watchdog, which is replaced on restore.
+func (l *Loader) currentWatchdog() *watchdog.Watchdog {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.watchdog
+}
+
+// waitContainer waits for the init process of container cid to exit. If
+// noHang is true and the process is still running, it returns ErrStillRunning
+// right away instead.
+func (l *Loader) waitContainer(cid string, noHang bool, cancel <-chan struct{}, waitStatus *uint32) error {
 	// Don't defer unlock, as doing so would make it impossible for
 	// multiple clients to wait on the same container.
 	tg, err := l.threadGroupFromID(execID{cid: cid})
 	if err != nil {
 		return fmt.Errorf("can't wait for container %q: %w", cid, err)
 	}
+	if noHang && !tg.Exited() {
+		return ErrStillRunning
+	}
 
 	// If the thread either has already exited or exits during waiting,
 	// consider the container exited.
-	ws := l.wait(tg)
+	ws, err := l.waitTimeout(tg, 0, cancel)
+	if err != nil {
+		return err
+	}
 	*waitStatus = ws
 
 	// Check for leaks and write coverage report after the root container has
@@ -1049,22 +1478,144 @@ func (l *Loader) waitContainer(cid string, waitStatus *uint32) error {
 	return nil
 }
 
-func (l *Loader) waitPID(tgid kernel.ThreadID, cid string, waitStatus *uint32) error {
+// pauseContainer stops all processes of container cid, including the ones
+// exec'd in it and their children, and blocks until they have stopped. Other
+// containers keep running. If cancel is closed before they have stopped, the
+// container is resumed and urpc.ErrCanceled is returned.
+func (l *Loader) pauseContainer(cid string, cancel <-chan struct{}) error {
+	if _, err := l.threadGroupFromID(execID{cid: cid}); err != nil {
+		return fmt.Errorf("can't pause container %q: %w", cid, err)
+	}
+	if !l.k.PauseContainer(cid, cancel) {
+		return urpc.ErrCanceled
+	}
+	return nil
+}
+
+// resumeContainer resumes the processes of container cid stopped by
+// pauseContainer. Processes that were already stopped before, e.g. by
+// SIGSTOP, stay stopped.
+func (l *Loader) resumeContainer(cid string) error {
+	if !l.k.UnpauseContainer(cid) {
+		return fmt.Errorf("container %q is not paused", cid)
+	}
+	return nil
+}
+
+// listContainers returns all containers in l.processes, sorted by ID. It holds
+// mu, so containers being created, started or destroyed concurrently are
+// either fully listed or not at all.
+func (l *Loader) listContainers() []ContainerInfo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var infos []ContainerInfo
+	for eid, ep := range l.processes {
+		if eid.pid != 0 {
+			// Exec'd process.
+			continue
+		}
+		info := ContainerInfo{CID: eid.cid}
+		if ep.tg != nil {
+			info.PID = int32(l.k.TaskSet().Root.IDOfThreadGroup(ep.tg))
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].CID < infos[j].CID })
+	return infos
+}
+
+// containerStatus returns the lifecycle state of container cid. It holds mu,
+// so the container can't be started or destroyed concurrently.
+func (l *Loader) containerStatus(cid string) (ContainerStatus, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	tg, err := l.tryThreadGroupFromIDLocked(execID{cid: cid})
+	if err != nil {
+		return ContainerStatus{}, err
+	}
+
+	var status ContainerStatus
+	switch {
+	case tg == nil:
+		status.State = ContainerCreated
+	case tg.Exited():
+		status.State = ContainerStopped
+		status.ExitStatus = uint32(tg.ExitStatus())
+	default:
+		status.State = ContainerRunning
+		if l.k.ContainerPaused(cid) {
+			status.State = ContainerPaused
+		}
+		status.PID = int32(l.k.TaskSet().Root.IDOfThreadGroup(tg))
+	}
+	return status, nil
+}
+
+// waitAll returns the exit status of every process exec'd in container cid
+// that has exited and whose status hasn't been cleared yet, sorted by PID, and
+// clears them. It doesn't wait for processes that are still running. The init
+// process of the container isn't included, use waitContainer for it.
+func (l *Loader) waitAll(cid string) ([]ProcessExitStatus, error) {
+	// Hold mu while collecting, so that a concurrent waitPID or waitAll
+	// can't get the same exit status.
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.processes[execID{cid: cid}]; !ok {
+		return nil, fmt.Errorf("container %q not found", cid)
+	}
+
+	var statuses []ProcessExitStatus
+	for eid, ep := range l.processes {
+		if eid.cid != cid || eid.pid == 0 || ep.tg == nil || !ep.tg.Exited() {
+			continue
+		}
+		statuses = append(statuses, ProcessExitStatus{
+			PID:        int32(eid.pid),
+			ExitStatus: uint32(ep.tg.ExitStatus()),
+		})
+		delete(l.processes, eid)
+	}
+	if len(statuses) > 0 {
+		log.Debugf("updated processes (removal): %v", l.processes)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].PID < statuses[j].PID })
+	return statuses, nil
+}
+
+// waitPID waits for process tgid of container cid to exit. If timeout isn't
+// zero and the process hasn't exited by then, ErrWaitTimeout is returned and
+// the process can be waited for again.
+//
+// If clearStatus is true, the exit status of an exec'd process is cleared once
+// the process has exited, so that exactly one of the callers clearing it gets
+// the status and later waits fail. The status is never cleared before the
+// process exits, e.g. when the wait times out.
+func (l *Loader) waitPID(tgid kernel.ThreadID, cid string, timeout gtime.Duration, clearStatus bool, cancel <-chan struct{}, waitStatus *uint32) error {
 	if tgid <= 0 {
-		return fmt.Errorf("PID (%d) must be positive", tgid)
+		return invalidArgf("PID (%d) must be positive", tgid)
 	}
 
 	// Try to find a process that was exec'd
 	eid := execID{cid: cid, pid: tgid}
 	execTG, err := l.threadGroupFromID(eid)
 	if err == nil {
-		ws := l.wait(execTG)
+		ws, err := l.waitTimeout(execTG, timeout, cancel)
+		if err != nil {
+			return err
+		}
+		if clearStatus {
+			l.mu.Lock()
+			// Another waiter may have cleared the status while we were
+			// waiting, and the PID may even have been reused since.
+			if ep := l.processes[eid]; ep == nil || ep.tg != execTG {
+				l.mu.Unlock()
+				return urpc.WithCode(ErrCodeNotFound, fmt.Errorf("waiting for PID %d: exit status already cleared", tgid))
+			}
+			delete(l.processes, eid)
+			log.Debugf("updated processes (removal): %v", l.processes)
+			l.mu.Unlock()
+		}
 		*waitStatus = ws
-
-		l.mu.Lock()
-		delete(l.processes, eid)
-		log.Debugf("updated processes (removal): %v", l.processes)
-		l.mu.Unlock()
 		return nil
 	}
 
@@ -1076,12 +1627,15 @@ func (l *Loader) waitPID(tgid kernel.ThreadID, cid string, waitStatus *uint32) e
 	}
 	tg := initTG.PIDNamespace().ThreadGroupWithID(tgid)
 	if tg == nil {
-		return fmt.Errorf("waiting for PID %d: no such process", tgid)
+		return urpc.WithCode(ErrCodeNotFound, fmt.Errorf("waiting for PID %d: no such process", tgid))
 	}
 	if tg.Leader().ContainerID() != cid {
-		return fmt.Errorf("process %d is part of a different container: %q", tgid, tg.Leader().ContainerID())
+		return urpc.WithCode(ErrCodeNotFound, fmt.Errorf("process %d is part of a different container: %q", tgid, tg.Leader().ContainerID()))
+	}
+	ws, err := l.waitTimeout(tg, timeout, cancel)
+	if err != nil {
+		return err
 	}
-	ws := l.wait(tg)
 	*waitStatus = ws
 	return nil
 }
@@ -1093,6 +1647,46 @@ func (l *Loader) wait(tg *kernel.ThreadGroup) uint32 {
 	return uint32(tg.ExitStatus())
 }
 
+// waitTimeout is like wait, but gives up with ErrWaitTimeout after timeout
+// unless it's zero, or with urpc.ErrCanceled once cancel is closed unless
+// it's nil. The timeout is measured with the sandbox's monotonic clock rather
+// than the host's, so it follows the sandbox's view of time, e.g. across save
+// and restore.
+func (l *Loader) waitTimeout(tg *kernel.ThreadGroup, timeout gtime.Duration, cancel <-chan struct{}) (uint32, error) {
+	if timeout == 0 && cancel == nil {
+		return l.wait(tg), nil
+	}
+
+	e, exited := waiter.NewChannelEntry(waiter.EventHUp)
+	tg.EventRegisterExited(&e)
+	defer tg.EventUnregisterExited(&e)
+	if tg.Exited() {
+		return uint32(tg.ExitStatus()), nil
+	}
+
+	var expired <-chan struct{}
+	if timeout != 0 {
+		clock := l.k.MonotonicClock()
+		var listener ktime.Listener
+		listener, expired = ktime.NewChannelNotifier()
+		timer := ktime.NewTimer(clock, listener)
+		defer timer.Destroy()
+		timer.Swap(ktime.Setting{
+			Enabled: true,
+			Next:    clock.Now().Add(timeout),
+		})
+	}
+
+	select {
+	case <-exited:
+		return uint32(tg.ExitStatus()), nil
+	case <-expired:
+		return 0, ErrWaitTimeout
+	case <-cancel:
+		return 0, urpc.ErrCanceled
+	}
+}
+
 // WaitForStartSignal waits for a start signal from the control server.
 func (l *Loader) WaitForStartSignal() {
 	<-l.ctrl.manager.startChan
@@ -1223,83 +1817,111 @@ func (f *sandboxNetstackCreator) CreateStack() (inet.Stack, error) {
 // then the container init process is used. Depending on the SignalDeliveryMode
 // option, the signal may be sent directly to the indicated process, to all
 // processes in the container, or to the foreground process group. pid is
-// relative to the root PID namespace, not the container's.
-func (l *Loader) signal(cid string, pid, signo int32, mode SignalDeliveryMode) error {
+// relative to the root PID namespace, not the container's. value is passed
+// to the handler of realtime signals, see newSignalInfo. The result describes
+// the target process only when a single process is signaled.
+func (l *Loader) signal(cid string, pid, signo int32, value int64, mode SignalDeliveryMode) (SignalResult, error) {
 	if pid < 0 {
-		return fmt.Errorf("PID (%d) must be positive", pid)
+		return SignalResult{}, invalidArgf("PID (%d) must be positive", pid)
 	}
+	info := newSignalInfo(signo, value)
 
 	switch mode {
 	case DeliverToProcess:
-		if err := l.signalProcess(cid, kernel.ThreadID(pid), signo); err != nil {
-			return fmt.Errorf("signaling process in container %q PID %d: %w", cid, pid, err)
+		res, err := l.signalProcess(cid, kernel.ThreadID(pid), info)
+		if err != nil {
+			return SignalResult{}, fmt.Errorf("signaling process in container %q PID %d: %w", cid, pid, err)
 		}
-		return nil
+		return res, nil
 
 	case DeliverToForegroundProcessGroup:
-		if err := l.signalForegrondProcessGroup(cid, kernel.ThreadID(pid), signo); err != nil {
-			return fmt.Errorf("signaling foreground process group in container %q PID %d: %w", cid, pid, err)
+		count, err := l.signalForegrondProcessGroup(cid, kernel.ThreadID(pid), info)
+		if err != nil {
+			return SignalResult{Count: count}, fmt.Errorf("signaling foreground process group in container %q PID %d: %w", cid, pid, err)
 		}
-		return nil
+		return SignalResult{Count: count}, nil
 
 	case DeliverToAllProcesses:
 		if pid != 0 {
-			return fmt.Errorf("PID (%d) cannot be set when signaling all processes", pid)
+			return SignalResult{}, invalidArgf("PID (%d) cannot be set when signaling all processes", pid)
 		}
 		// Check that the container has actually started before signaling it.
 		if _, err := l.threadGroupFromID(execID{cid: cid}); err != nil {
-			return err
+			return SignalResult{}, err
 		}
-		if err := l.signalAllProcesses(cid, signo); err != nil {
-			return fmt.Errorf("signaling all processes in container %q: %w", cid, err)
+		count, err := l.signalAllProcesses(cid, info)
+		if err != nil {
+			return SignalResult{Count: count}, fmt.Errorf("signaling all processes in container %q: %w", cid, err)
 		}
-		return nil
+		return SignalResult{Count: count}, nil
 
 	default:
 		panic(fmt.Sprintf("unknown signal delivery mode %v", mode))
 	}
 }
 
+// newSignalInfo returns the siginfo of a signal sent from outside the sandbox.
+// Like sigqueue(3), realtime signals carry value in si_value. It's ignored for
+// standard signals, which can't be queued.
+func newSignalInfo(signo int32, value int64) *linux.SignalInfo {
+	info := &linux.SignalInfo{Signo: signo}
+	if sig := linux.Signal(signo); sig.IsValid() && sig.IsRealtime() {
+		info.Code = linux.SI_QUEUE
+		info.SetSigval(uint64(value))
+	}
+	return info
+}
+
 // signalProcess sends signal to process in the given container. tgid is
 // relative to the root PID namespace, not the container's.
-func (l *Loader) signalProcess(cid string, tgid kernel.ThreadID, signo int32) error {
-	execTG, err := l.threadGroupFromID(execID{cid: cid, pid: tgid})
-	if err == nil {
-		// Send signal directly to the identified process.
-		return l.k.SendExternalSignalThreadGroup(execTG, &linux.SignalInfo{Signo: signo})
+func (l *Loader) signalProcess(cid string, tgid kernel.ThreadID, info *linux.SignalInfo) (SignalResult, error) {
+	tg, err := l.threadGroupFromID(execID{cid: cid, pid: tgid})
+	if err != nil {
+		// The caller may be signaling a process not started directly via
+		// exec. In this case, find the process and check that the process
+		// belongs to the container in question.
+		tg = l.k.RootPIDNamespace().ThreadGroupWithID(tgid)
+		if tg == nil {
+			// Don't use ESRCH, so that callers can tell a bad PID from a
+			// process that exited while being signaled.
+			return SignalResult{}, urpc.WithCode(ErrCodeNotFound, fmt.Errorf("process %d not found", tgid))
+		}
+		if tg.Leader().ContainerID() != cid {
+			return SignalResult{}, urpc.WithCode(ErrCodeNotFound, fmt.Errorf("process %d belongs to a different container: %q", tgid, tg.Leader().ContainerID()))
+		}
 	}
 
-	// The caller may be signaling a process not started directly via exec.
-	// In this case, find the process and check that the process belongs to the
-	// container in question.
-	tg := l.k.RootPIDNamespace().ThreadGroupWithID(tgid)
-	if tg == nil {
-		return fmt.Errorf("no such process with PID %d", tgid)
-	}
-	if tg.Leader().ContainerID() != cid {
-		return fmt.Errorf("process %d belongs to a different container: %q", tgid, tg.Leader().ContainerID())
-	}
-	return l.k.SendExternalSignalThreadGroup(tg, &linux.SignalInfo{Signo: signo})
+	coalesced, err := l.k.SendExternalSignalThreadGroupCoalesced(tg, info)
+	if err != nil {
+		return SignalResult{}, err
+	}
+	return SignalResult{
+		Count:     1,
+		PID:       int32(l.k.RootPIDNamespace().IDOfThreadGroup(tg)),
+		State:     tg.Leader().StateStatus(),
+		Coalesced: coalesced,
+	}, nil
 }
 
 // signalForegrondProcessGroup looks up foreground process group from the TTY
-// for the given "tgid" inside container "cid", and send the signal to it.
-func (l *Loader) signalForegrondProcessGroup(cid string, tgid kernel.ThreadID, signo int32) error {
+// for the given "tgid" inside container "cid", and send the signal to it. It
+// returns the number of processes signaled.
+func (l *Loader) signalForegrondProcessGroup(cid string, tgid kernel.ThreadID, info *linux.SignalInfo) (int, error) {
 	l.mu.Lock()
 	tg, err := l.tryThreadGroupFromIDLocked(execID{cid: cid, pid: tgid})
 	if err != nil {
 		l.mu.Unlock()
-		return fmt.Errorf("no thread group found: %w", err)
+		return 0, fmt.Errorf("no thread group found: %w", err)
 	}
 	if tg == nil {
 		l.mu.Unlock()
-		return fmt.Errorf("container %q not started", cid)
+		return 0, fmt.Errorf("container %q not started", cid)
 	}
 
 	tty, ttyVFS2, err := l.ttyFromIDLocked(execID{cid: cid, pid: tgid})
 	l.mu.Unlock()
 	if err != nil {
-		return fmt.Errorf("no thread group found: %w", err)
+		return 0, fmt.Errorf("no thread group found: %w", err)
 	}
 
 	var pg *kernel.ProcessGroup
@@ -1309,36 +1931,157 @@ func (l *Loader) signalForegrondProcessGroup(cid string, tgid kernel.ThreadID, s
 	case tty != nil:
 		pg = tty.ForegroundProcessGroup()
 	default:
-		return fmt.Errorf("no TTY attached")
+		return 0, fmt.Errorf("no TTY attached")
 	}
 	if pg == nil {
 		// No foreground process group has been set. Signal the
 		// original thread group.
 		log.Warningf("No foreground process group for container %q and PID %d. Sending signal directly to PID %d.", cid, tgid, tgid)
-		return l.k.SendExternalSignalThreadGroup(tg, &linux.SignalInfo{Signo: signo})
+		if err := l.k.SendExternalSignalThreadGroup(tg, info); err != nil {
+			return 0, err
+		}
+		return 1, nil
 	}
 	// Send the signal to all processes in the process group.
-	var lastErr error
+	var (
+		count   int
+		lastErr error
+	)
 	for _, tg := range l.k.TaskSet().Root.ThreadGroups() {
 		if tg.ProcessGroup() != pg {
 			continue
 		}
+		// Each queued signal needs its own siginfo.
+		infoCopy := *info
+		if err := l.k.SendExternalSignalThreadGroup(tg, &infoCopy); err != nil {
+			lastErr = err
+			continue
+		}
+		count++
+	}
+	return count, lastErr
+}
+
+// resizeTTY sets the window size of the TTY attached to the given "tgid"
+// inside container "cid" and sends SIGWINCH to its foreground process group,
+// like the terminal driver does when the size of a terminal changes.
+func (l *Loader) resizeTTY(cid string, tgid kernel.ThreadID, ws *linux.Winsize) error {
+	l.mu.Lock()
+	tty, ttyVFS2, err := l.ttyFromIDLocked(execID{cid: cid, pid: tgid})
+	l.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case ttyVFS2 != nil:
+		err = ttyVFS2.SetWinsize(ws)
+	case tty != nil:
+		err = tty.SetWinsize(ws)
+	default:
+		return urpc.WithCode(ErrCodeFailedPrecondition, fmt.Errorf("no TTY attached"))
+	}
+	if err != nil {
+		return fmt.Errorf("setting window size: %w", err)
+	}
+
+	info := newSignalInfo(int32(linux.SIGWINCH), 0)
+	if _, err := l.signalForegrondProcessGroup(cid, tgid, info); err != nil {
+		return fmt.Errorf("signaling foreground process group: %w", err)
+	}
+	return nil
+}
+
+// signalProcessGroup sends a signal to all processes of the container in
+// process group pgid, which is relative to the container's PID namespace. The
+// group may have members left after its leader exited. It returns the number
+// of processes signaled.
+func (l *Loader) signalProcessGroup(cid string, pgid kernel.ProcessGroupID, signo int32) (int, error) {
+	initTG, err := l.threadGroupFromID(execID{cid: cid})
+	if err != nil {
+		return 0, err
+	}
+	pg := initTG.PIDNamespace().ProcessGroupWithID(pgid)
+	if pg == nil {
+		return 0, urpc.WithCode(ErrCodeNotFound, fmt.Errorf("process group %d not found", pgid))
+	}
+	var (
+		count   int
+		lastErr error
+	)
+	for _, tg := range l.k.TaskSet().Root.ThreadGroups() {
+		if tg.ProcessGroup() != pg || tg.Leader().ContainerID() != cid {
+			continue
+		}
 		if err := l.k.SendExternalSignalThreadGroup(tg, &linux.SignalInfo{Signo: signo}); err != nil {
 			lastErr = err
+			continue
 		}
+		count++
 	}
-	return lastErr
+	if count == 0 && lastErr == nil {
+		return 0, urpc.WithCode(ErrCodeNotFound, fmt.Errorf("process group %d has no processes in container %q", pgid, cid))
+	}
+	return count, lastErr
 }
 
 // signalAllProcesses that belong to specified container. It's a noop if the
-// container hasn't started or has exited.
-func (l *Loader) signalAllProcesses(cid string, signo int32) error {
+// container hasn't started or has exited. It returns the number of processes
+// signaled.
+func (l *Loader) signalAllProcesses(cid string, info *linux.SignalInfo) (int, error) {
 	// Pause the kernel to prevent new processes from being created while
 	// the signal is delivered. This prevents process leaks when SIGKILL is
 	// sent to the entire container.
 	l.k.Pause()
 	defer l.k.Unpause()
-	return l.k.SendContainerSignal(cid, &linux.SignalInfo{Signo: signo})
+	return l.k.SendContainerSignal(cid, info)
+}
+
+// closeNetwork closes the isolated network stack of the container and the FDs
+// of its links, waiting for its endpoints to stop.
+func (ep *execProcess) closeNetwork() {
+	if eps, ok := ep.netns.Stack().(*netstack.Stack); ok {
+		closeNetworkStack(eps.Stack)
+	}
+	for _, fd := range ep.linkFDs {
+		_ = unix.Close(fd)
+	}
+	ep.linkFDs = nil
+}
+
+// addLinkFDs records fds, the FDs of links created in the network stack of
+// container cid, so that they are closed along with it. It returns false if
+// the container doesn't exist anymore.
+func (l *Loader) addLinkFDs(cid string, fds []int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ep := l.processes[execID{cid: cid}]
+	if ep == nil || ep.netns == nil {
+		return false
+	}
+	ep.linkFDs = append(ep.linkFDs, fds...)
+	return true
+}
+
+// networkStack returns the netstack of the given container. It fails if the
+// container shares the root network namespace, which is configured without a
+// container ID.
+func (l *Loader) networkStack(cid string) (*stack.Stack, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ep := l.processes[execID{cid: cid}]
+	if ep == nil {
+		return nil, fmt.Errorf("container %q not found", cid)
+	}
+	if ep.netns == nil {
+		return nil, fmt.Errorf("container %q doesn't have its own network namespace", cid)
+	}
+	eps, ok := ep.netns.Stack().(*netstack.Stack)
+	if !ok {
+		return nil, fmt.Errorf("container %q doesn't use netstack", cid)
+	}
+	return eps.Stack, nil
 }
 
 // threadGroupFromID is similar to tryThreadGroupFromIDLocked except that it
@@ -1352,7 +2095,7 @@ func (l *Loader) threadGroupFromID(key execID) (*kernel.ThreadGroup, error) {
 		return nil, err
 	}
 	if tg == nil {
-		return nil, fmt.Errorf("container %q not started", key.cid)
+		return nil, urpc.WithCode(ErrCodeFailedPrecondition, fmt.Errorf("container %q not started", key.cid))
 	}
 	return tg, nil
 }
@@ -1364,11 +2107,37 @@ func (l *Loader) threadGroupFromID(key execID) (*kernel.ThreadGroup, error) {
 func (l *Loader) tryThreadGroupFromIDLocked(key execID) (*kernel.ThreadGroup, error) {
 	ep := l.processes[key]
 	if ep == nil {
-		return nil, fmt.Errorf("container %q not found", key.cid)
+		return nil, urpc.WithCode(ErrCodeNotFound, fmt.Errorf("container %q not found", key.cid))
 	}
 	return ep.tg, nil
 }
 
+// reparentToContainerInit sets the parent of the processes of container cid in
+// pl whose parent isn't in pl to the container init. Such processes were
+// orphaned and reparented to the init of the PID namespace, which is another
+// container's init if the container shares the root PID namespace. Processes
+// without a parent, like the container init and exec'd processes, are left
+// alone.
+func (l *Loader) reparentToContainerInit(cid string, pl []*control.Process) {
+	tg, err := l.threadGroupFromID(execID{cid: cid})
+	if err != nil {
+		return
+	}
+	initPID := l.k.TaskSet().Root.IDOfThreadGroup(tg)
+	if initPID == 0 {
+		return
+	}
+	inContainer := make(map[kernel.ThreadID]bool, len(pl))
+	for _, p := range pl {
+		inContainer[p.PID] = true
+	}
+	for _, p := range pl {
+		if p.PPID != 0 && p.PID != initPID && !inContainer[p.PPID] {
+			p.PPID = initPID
+		}
+	}
+}
+
 // ttyFromIDLocked returns the TTY files for the given execution ID. It may
 // return nil in case the container has not started yet. Returns error if
 // execution ID is invalid or if the container cannot be found (maybe it has
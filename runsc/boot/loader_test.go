@@ -16,6 +16,7 @@ package boot
 
 import (
 	"fmt"
+	"io"
 	"math/rand"
 	"os"
 	"reflect"
@@ -30,10 +31,12 @@ import (
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/p9"
 	"gvisor.dev/gvisor/pkg/sentry/contexttest"
+	"gvisor.dev/gvisor/pkg/sentry/control"
 	"gvisor.dev/gvisor/pkg/sentry/fs"
 	"gvisor.dev/gvisor/pkg/sentry/vfs"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/unet"
+	"gvisor.dev/gvisor/pkg/urpc"
 	"gvisor.dev/gvisor/runsc/config"
 	"gvisor.dev/gvisor/runsc/flag"
 	"gvisor.dev/gvisor/runsc/fsgofer"
@@ -110,7 +113,7 @@ func startGofer(root string) (int, func(), error) {
 	return sandboxEnd, cleanup, nil
 }
 
-func createLoader(vfsEnabled bool, spec *specs.Spec) (*Loader, func(), error) {
+func createLoader(vfsEnabled bool, spec *specs.Spec, readyFD int) (*Loader, func(), error) {
 	fd, err := server.CreateSocket(ControlSocketAddr(fmt.Sprintf("%010d", rand.Int())[:10]))
 	if err != nil {
 		return nil, nil, err
@@ -140,6 +143,7 @@ func createLoader(vfsEnabled bool, spec *specs.Spec) (*Loader, func(), error) {
 		ControllerFD: fd,
 		GoferFDs:     []int{sandEnd},
 		StdioFDs:     stdio,
+		ReadyFD:      readyFD,
 	}
 	l, err := New(args)
 	if err != nil {
@@ -160,7 +164,7 @@ func TestRunVFS2(t *testing.T) {
 }
 
 func doRun(t *testing.T, vfsEnabled bool) {
-	l, cleanup, err := createLoader(vfsEnabled, testSpec())
+	l, cleanup, err := createLoader(vfsEnabled, testSpec(), 0)
 	if err != nil {
 		t.Fatalf("error creating loader: %v", err)
 	}
@@ -207,7 +211,7 @@ func TestStartSignalVFS2(t *testing.T) {
 }
 
 func doStartSignal(t *testing.T, vfsEnabled bool) {
-	l, cleanup, err := createLoader(vfsEnabled, testSpec())
+	l, cleanup, err := createLoader(vfsEnabled, testSpec(), 0)
 	if err != nil {
 		t.Fatalf("error creating loader: %v", err)
 	}
@@ -255,6 +259,257 @@ func doStartSignal(t *testing.T, vfsEnabled bool) {
 
 }
 
+// TestDestroyPartiallyDestroyedContainer checks that destroying a container
+// whose init process entry is gone also removes the leftover entries of its
+// exec'd processes.
+func TestDestroyPartiallyDestroyedContainer(t *testing.T) {
+	l, cleanup, err := createLoader(true, testSpec(), 0)
+	if err != nil {
+		t.Fatalf("error creating loader: %v", err)
+	}
+	defer l.Destroy()
+	defer cleanup()
+	defer l.ctrl.srv.Stop(time.Hour)
+
+	// Simulate a destroy that removed the container init, but not an exec'd
+	// process.
+	const cid = "partial"
+	l.mu.Lock()
+	l.processes[execID{cid: cid, pid: 42}] = &execProcess{}
+	l.mu.Unlock()
+
+	if err := l.destroySubcontainer(cid, 0); err != nil {
+		t.Fatalf("destroySubcontainer(%q) failed: %v", cid, err)
+	}
+	l.mu.Lock()
+	for eid := range l.processes {
+		if eid.cid == cid {
+			t.Errorf("entry %+v left after destroy", eid)
+		}
+	}
+	l.mu.Unlock()
+
+	// There is nothing left to destroy anymore.
+	if err := l.destroySubcontainer(cid, 0); err == nil {
+		t.Errorf("destroySubcontainer(%q) of a destroyed container succeeded", cid)
+	}
+}
+
+// TestControllerStop checks that stopping the control server releases its
+// address, so a new sandbox with the same ID can use it.
+func TestControllerStop(t *testing.T) {
+	l, cleanup, err := createLoader(true, testSpec(), 0)
+	if err != nil {
+		t.Fatalf("error creating loader: %v", err)
+	}
+	defer l.Destroy()
+	defer cleanup()
+
+	sa, err := unix.Getsockname(l.ctrl.srv.FD())
+	if err != nil {
+		t.Fatalf("getsockname(): %v", err)
+	}
+	// Abstract socket names are reported with a leading '@'.
+	addr := "\x00" + sa.(*unix.SockaddrUnix).Name[1:]
+	s, err := unet.Connect(addr, false)
+	if err != nil {
+		t.Fatalf("connecting to the control server: %v", err)
+	}
+	// Idle connections would delay stop by stopRPCTimeout.
+	s.Close()
+
+	l.ctrl.stop()
+	if s, err := unet.Connect(addr, false); err == nil {
+		s.Close()
+		t.Errorf("connecting to the control server succeeded after stop")
+	}
+	fd, err := server.CreateSocket(addr)
+	if err != nil {
+		t.Fatalf("creating a control socket with the address of the stopped server: %v", err)
+	}
+	unix.Close(fd)
+
+	// Stopping again, e.g. in Destroy, is a no-op.
+	l.ctrl.stop()
+}
+
+// TestHealth checks that Health reports the kernel pause state without taking
+// the loader lock.
+func TestHealth(t *testing.T) {
+	l, cleanup, err := createLoader(true, testSpec(), 0)
+	if err != nil {
+		t.Fatalf("error creating loader: %v", err)
+	}
+	defer l.Destroy()
+	defer cleanup()
+
+	// Health would deadlock if it took the loader lock.
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, paused := range []bool{false, true} {
+		if paused {
+			l.k.Pause()
+		}
+		args := HealthArgs{Nonce: 42}
+		var status HealthStatus
+		if err := l.ctrl.manager.Health(&args, &status); err != nil {
+			t.Fatalf("Health(): %v", err)
+		}
+		if status.Nonce != args.Nonce || status.KernelPaused != paused || status.Uptime <= 0 {
+			t.Errorf("Health() = %+v, want nonce %d, kernel paused %t and positive uptime", status, args.Nonce, paused)
+		}
+		if paused {
+			l.k.Unpause()
+		}
+	}
+}
+
+// TestErrorCodes checks the codes of errors returned by control methods.
+func TestErrorCodes(t *testing.T) {
+	l, cleanup, err := createLoader(true, testSpec(), 0)
+	if err != nil {
+		t.Fatalf("error creating loader: %v", err)
+	}
+	defer l.Destroy()
+	defer cleanup()
+	cm := l.ctrl.manager
+
+	for _, tc := range []struct {
+		name string
+		call func() error
+		want urpc.ErrorCode
+	}{
+		{
+			name: "start without spec",
+			call: func() error { return cm.StartSubcontainer(&StartArgs{CID: "bar"}, nil) },
+			want: ErrCodeInvalidArgument,
+		},
+		{
+			name: "create existing",
+			call: func() error { return cm.CreateSubcontainer(&CreateArgs{CID: "foo"}, nil) },
+			want: ErrCodeAlreadyExists,
+		},
+		{
+			name: "destroy unknown",
+			call: func() error { return cm.DestroySubcontainer(&DestroyArgs{CID: "bar"}, nil) },
+			want: ErrCodeNotFound,
+		},
+		{
+			name: "signal unknown",
+			call: func() error {
+				return cm.Signal(&SignalArgs{CID: "bar", Signo: int32(unix.SIGTERM), PID: 1, Mode: DeliverToProcess}, &SignalResult{})
+			},
+			want: ErrCodeNotFound,
+		},
+		{
+			name: "signal negative PID",
+			call: func() error {
+				return cm.Signal(&SignalArgs{CID: "foo", Signo: int32(unix.SIGTERM), PID: -1}, &SignalResult{})
+			},
+			want: ErrCodeInvalidArgument,
+		},
+		{
+			name: "wait not started",
+			call: func() error {
+				cid := "foo"
+				var ws uint32
+				return cm.Wait(&cid, &ws)
+			},
+			want: ErrCodeFailedPrecondition,
+		},
+		{
+			name: "restore without files",
+			call: func() error { return cm.Restore(&RestoreOpts{}, nil) },
+			want: ErrCodeInvalidArgument,
+		},
+		{
+			name: "wait PID negative timeout",
+			call: func() error {
+				var ws uint32
+				return cm.WaitPID(&WaitPIDArgs{CID: "foo", PID: 1, TimeoutMs: -1}, &ws)
+			},
+			want: ErrCodeInvalidArgument,
+		},
+		{
+			name: "signal process group zero PGID",
+			call: func() error {
+				return cm.SignalProcessGroup(&SignalProcessGroupArgs{CID: "foo", Signo: int32(unix.SIGTERM)}, &SignalResult{})
+			},
+			want: ErrCodeInvalidArgument,
+		},
+		{
+			name: "init command unknown",
+			call: func() error {
+				cid := "bar"
+				return cm.InitCommand(&cid, &InitCommand{})
+			},
+			want: ErrCodeNotFound,
+		},
+		{
+			name: "read memory disabled",
+			call: func() error { return cm.ReadMemory(&ReadMemoryArgs{CID: "foo", PID: 1, Length: 1}, new([]byte)) },
+			want: ErrCodeFailedPrecondition,
+		},
+		{
+			name: "event stream without files",
+			call: func() error { return cm.EventStream(&EventStreamArgs{}, nil) },
+			want: ErrCodeInvalidArgument,
+		},
+		{
+			name: "core dump upload without files",
+			call: func() error { return cm.SetCoreDumpUpload(&SetCoreDumpUploadArgs{}, nil) },
+			want: ErrCodeInvalidArgument,
+		},
+		{
+			name: "checkpoint file without files",
+			call: func() error { return cm.SetCheckpointFile(&control.SaveOpts{}, nil) },
+			want: ErrCodeInvalidArgument,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.call()
+			if got := urpc.CodeOf(err); got != tc.want {
+				t.Errorf("got error %v with code %d, want code %d", err, got, tc.want)
+			}
+		})
+	}
+}
+
+// TestReadyNotification checks that the loader notifies the ready FD once the
+// control server is serving.
+func TestReadyNotification(t *testing.T) {
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("error creating pipe: %v", err)
+	}
+	defer readyReader.Close()
+
+	// Loader takes ownership of the ready FD.
+	readyFD, err := unix.Dup(int(readyWriter.Fd()))
+	if err != nil {
+		t.Fatalf("error duplicating ready FD: %v", err)
+	}
+	readyWriter.Close()
+
+	l, cleanup, err := createLoader(true /* VFS2 Enabled */, testSpec(), readyFD)
+	if err != nil {
+		t.Fatalf("error creating loader: %v", err)
+	}
+	defer l.Destroy()
+	defer cleanup()
+	defer l.ctrl.srv.Stop(time.Hour)
+
+	buf := make([]byte, 2)
+	if n, err := readyReader.Read(buf); err != nil || n != 1 {
+		t.Fatalf("reading ready notification, got: %d, %v, want: 1, nil", n, err)
+	}
+	// The loader must close the FD after the notification.
+	if n, err := readyReader.Read(buf); err != io.EOF {
+		t.Errorf("reading after ready notification, got: %d, %v, want: 0, EOF", n, err)
+	}
+}
+
 type CreateMountTestcase struct {
 	name string
 	// Spec that will be used to create the mount manager.  Note
@@ -480,7 +735,7 @@ func TestCreateMountNamespaceVFS2(t *testing.T) {
 			spec.Root = tc.spec.Root
 
 			t.Logf("Using root: %q", spec.Root.Path)
-			l, loaderCleanup, err := createLoader(true /* VFS2 Enabled */, spec)
+			l, loaderCleanup, err := createLoader(true /* VFS2 Enabled */, spec, 0)
 			if err != nil {
 				t.Fatalf("failed to create loader: %v", err)
 			}
@@ -0,0 +1,113 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/hostarch"
+	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/sentry/mm"
+	"gvisor.dev/gvisor/pkg/urpc"
+	"gvisor.dev/gvisor/pkg/usermem"
+)
+
+// maxMemoryAccessLength is the maximum number of bytes that can be accessed
+// in a process's memory with a single request.
+const maxMemoryAccessLength = 1 << 20 // 1 MB
+
+// processLeader returns the leader of the process with the given PID, which
+// must belong to container cid.
+func (l *Loader) processLeader(cid string, pid kernel.ThreadID) (*kernel.Task, error) {
+	tg := l.k.RootPIDNamespace().ThreadGroupWithID(pid)
+	if tg == nil {
+		return nil, urpc.WithCode(ErrCodeNotFound, fmt.Errorf("no such process with PID %d", pid))
+	}
+	leader := tg.Leader()
+	if leader == nil {
+		return nil, urpc.WithCode(ErrCodeNotFound, fmt.Errorf("process %d has exited", pid))
+	}
+	if leader.ContainerID() != cid {
+		return nil, urpc.WithCode(ErrCodeNotFound, fmt.Errorf("process %d belongs to a different container: %q", pid, leader.ContainerID()))
+	}
+	return leader, nil
+}
+
+// processMemoryManager returns the MemoryManager of the process with the given
+// PID, which must belong to container cid. The caller must release the
+// returned MemoryManager with DecUsers.
+func (l *Loader) processMemoryManager(cid string, pid kernel.ThreadID) (*mm.MemoryManager, error) {
+	leader, err := l.processLeader(cid, pid)
+	if err != nil {
+		return nil, err
+	}
+	var m *mm.MemoryManager
+	leader.WithMuLocked(func(t *kernel.Task) {
+		m = t.MemoryManager()
+	})
+	if m == nil || !m.IncUsers() {
+		return nil, urpc.WithCode(ErrCodeNotFound, fmt.Errorf("process %d has exited", pid))
+	}
+	return m, nil
+}
+
+// readMemory reads length bytes at addr in the address space of process pid in
+// container cid. Reading unmapped memory fails instead of returning a partial
+// result.
+func (l *Loader) readMemory(cid string, pid kernel.ThreadID, addr hostarch.Addr, length uint64) ([]byte, error) {
+	if length > maxMemoryAccessLength {
+		return nil, invalidArgf("length %d exceeds the maximum of %d bytes", length, maxMemoryAccessLength)
+	}
+	if _, ok := addr.AddLength(length); !ok {
+		return nil, invalidArgf("range at %#x of %d bytes overflows", addr, length)
+	}
+	m, err := l.processMemoryManager(cid, pid)
+	if err != nil {
+		return nil, err
+	}
+	ctx := l.k.SupervisorContext()
+	defer m.DecUsers(ctx)
+
+	buf := make([]byte, length)
+	if n, err := m.CopyIn(ctx, addr, buf, usermem.IOOpts{IgnorePermissions: true}); err != nil {
+		return nil, invalidArgf("reading %d bytes at %#x, only %d bytes read: %w", length, addr, n, err)
+	}
+	return buf, nil
+}
+
+// writeMemory writes buf at addr in the address space of process pid in
+// container cid. Memory protections are respected, e.g. writing to read-only
+// pages fails.
+func (l *Loader) writeMemory(cid string, pid kernel.ThreadID, addr hostarch.Addr, buf []byte) error {
+	if len(buf) > maxMemoryAccessLength {
+		return invalidArgf("length %d exceeds the maximum of %d bytes", len(buf), maxMemoryAccessLength)
+	}
+	if _, ok := addr.AddLength(uint64(len(buf))); !ok {
+		return invalidArgf("range at %#x of %d bytes overflows", addr, len(buf))
+	}
+	m, err := l.processMemoryManager(cid, pid)
+	if err != nil {
+		return err
+	}
+	ctx := l.k.SupervisorContext()
+	defer m.DecUsers(ctx)
+
+	log.Warningf("Writing %d bytes at %#x in the memory of PID %d in container %q", len(buf), addr, pid, cid)
+	if n, err := m.CopyOut(ctx, addr, buf, usermem.IOOpts{}); err != nil {
+		return invalidArgf("writing %d bytes at %#x, only %d bytes written: %w", len(buf), addr, n, err)
+	}
+	return nil
+}
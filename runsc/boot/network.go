@@ -17,21 +17,30 @@ package boot
 import (
 	"fmt"
 	"net"
+	"os"
 	"runtime"
+	"sort"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/socket/netstack"
+	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
 	"gvisor.dev/gvisor/pkg/tcpip/link/ethernet"
 	"gvisor.dev/gvisor/pkg/tcpip/link/fdbased"
 	"gvisor.dev/gvisor/pkg/tcpip/link/loopback"
+	"gvisor.dev/gvisor/pkg/tcpip/link/nested"
 	"gvisor.dev/gvisor/pkg/tcpip/link/packetsocket"
 	"gvisor.dev/gvisor/pkg/tcpip/link/qdisc/fifo"
 	"gvisor.dev/gvisor/pkg/tcpip/link/sniffer"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
 	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
 	"gvisor.dev/gvisor/pkg/urpc"
 	"gvisor.dev/gvisor/runsc/config"
 )
@@ -62,9 +71,33 @@ var (
 	}
 )
 
+// IsolatedNetworkAnnotation is the annotation used to request that a
+// sub-container gets its own network stack instead of sharing the root
+// container's. Its value must be "true" or "false".
+const IsolatedNetworkAnnotation = "dev.gvisor.spec.network.isolated"
+
 // Network exposes methods that can be used to configure a network stack.
 type Network struct {
+	// loader is used to find the network stacks of containers started with
+	// an isolated network. It may be nil, in which case only Stack can be
+	// configured.
+	loader *Loader
+
+	// mu protects the fields below once Network is registered as a control
+	// server. It's held while the root network stack is reconfigured as a
+	// whole, e.g. by Reinitialize.
+	mu sync.Mutex
+
+	// Stack is the root network stack. It's replaced by Reinitialize.
 	Stack *stack.Stack
+
+	// links is the configuration of the root network stack's links, kept
+	// to recreate them in Reinitialize. Its files are owned by Network.
+	links *CreateLinksAndRoutesArgs
+
+	// linkFDs are the FDs used by the fd-based links of Stack. They are
+	// closed when Stack is replaced by Reinitialize.
+	linkFDs []int
 }
 
 // Route represents a route in the network stack.
@@ -73,7 +106,9 @@ type Route struct {
 	Gateway     net.IP
 }
 
-// DefaultRoute represents a catch all route to the default gateway.
+// DefaultRoute represents a catch all route to the default gateway. If
+// Route.Destination isn't set, it's the catch all subnet of the gateway's IP
+// version, i.e. 0.0.0.0/0 or ::/0.
 type DefaultRoute struct {
 	Route Route
 	Name  string
@@ -122,6 +157,15 @@ type CreateLinksAndRoutesArgs struct {
 
 	Defaultv4Gateway DefaultRoute
 	Defaultv6Gateway DefaultRoute
+
+	// LoopbackOnly creates only DefaultLoopbackLink and its routes, for
+	// containers that only need localhost networking. No other links, routes
+	// or files may be given.
+	LoopbackOnly bool
+
+	// CID is the ID of the container whose network stack is configured. If
+	// empty, the root network stack is configured.
+	CID string
 }
 
 // IPWithPrefix is an address with its subnet prefix length.
@@ -143,6 +187,9 @@ func (r *Route) Empty() bool {
 }
 
 func (r *Route) toTcpipRoute(id tcpip.NICID) (tcpip.Route, error) {
+	if r.Gateway != nil && (r.Gateway.To4() != nil) != (r.Destination.IP.To4() != nil) {
+		return tcpip.Route{}, fmt.Errorf("gateway %s and destination %s are of different IP versions", r.Gateway, &r.Destination)
+	}
 	subnet, err := tcpip.NewSubnet(ipToAddress(r.Destination.IP), ipMaskToAddressMask(r.Destination.Mask))
 	if err != nil {
 		return tcpip.Route{}, err
@@ -154,9 +201,40 @@ func (r *Route) toTcpipRoute(id tcpip.NICID) (tcpip.Route, error) {
 	}, nil
 }
 
+// toTcpipRoute returns the default route through the NIC named d.Name in nics.
+// v6 is whether it's the IPv6 default route.
+func (d *DefaultRoute) toTcpipRoute(nics map[string]tcpip.NICID, v6 bool) (tcpip.Route, error) {
+	nicID, ok := nics[d.Name]
+	if !ok {
+		return tcpip.Route{}, fmt.Errorf("invalid interface name %q for default route", d.Name)
+	}
+	r := d.Route
+	if r.Gateway != nil && (r.Gateway.To4() == nil) != v6 {
+		return tcpip.Route{}, fmt.Errorf("default gateway %s has the wrong IP version", r.Gateway)
+	}
+	if r.Destination.IP == nil && r.Destination.Mask == nil {
+		r.Destination = net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 8*net.IPv4len)}
+		if v6 {
+			r.Destination = net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 8*net.IPv6len)}
+		}
+	}
+	return r.toTcpipRoute(nicID)
+}
+
 // CreateLinksAndRoutes creates links and routes in a network stack.  It should
 // only be called once.
 func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct{}) error {
+	if args.LoopbackOnly {
+		if len(args.LoopbackLinks) > 0 || len(args.FDBasedLinks) > 0 || len(args.FilePayload.Files) > 0 ||
+			!args.Defaultv4Gateway.Route.Empty() || !args.Defaultv6Gateway.Route.Empty() {
+			return fmt.Errorf("links, routes and files can't be given with LoopbackOnly")
+		}
+		args = &CreateLinksAndRoutesArgs{
+			LoopbackLinks: []LoopbackLink{DefaultLoopbackLink},
+			CID:           args.CID,
+		}
+	}
+
 	wantFDs := 0
 	for _, l := range args.FDBasedLinks {
 		wantFDs += l.NumChannels
@@ -165,7 +243,72 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 		return fmt.Errorf("args.FilePayload.Files has %d FD's but we need %d entries based on FDBasedLinks", got, wantFDs)
 	}
 
+	if args.CID != "" {
+		s, err := n.containerStack(args.CID)
+		if err != nil {
+			return err
+		}
+		cn := &Network{Stack: s}
+		if err := cn.createLinksAndRoutes(args, false /* disabled */); err != nil {
+			return err
+		}
+		if !n.loader.addLinkFDs(args.CID, cn.linkFDs) {
+			// The container was destroyed meanwhile, along with its network
+			// stack.
+			for _, fd := range cn.linkFDs {
+				unix.Close(fd)
+			}
+			return fmt.Errorf("container %q not found", args.CID)
+		}
+		return nil
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.createLinksAndRoutes(args, false /* disabled */); err != nil {
+		return err
+	}
+	return n.saveLinks(args)
+}
+
+// saveLinks keeps a copy of args, including the link FDs, so that the root
+// network stack's links can be recreated by Reinitialize.
+//
+// Preconditions: n.mu must be locked.
+func (n *Network) saveLinks(args *CreateLinksAndRoutesArgs) error {
+	links := *args
+	// Copied, as SetMTU updates the saved links.
+	links.FDBasedLinks = append([]FDBasedLink(nil), args.FDBasedLinks...)
+	links.FilePayload = urpc.FilePayload{Files: make([]*os.File, 0, len(args.FilePayload.Files))}
+	for _, f := range args.FilePayload.Files {
+		fd, err := unix.Dup(int(f.Fd()))
+		if err != nil {
+			for _, saved := range links.FilePayload.Files {
+				saved.Close()
+			}
+			return fmt.Errorf("failed to dup FD %v: %v", f.Fd(), err)
+		}
+		links.FilePayload.Files = append(links.FilePayload.Files, os.NewFile(uintptr(fd), f.Name()))
+	}
+	n.links = &links
+	return nil
+}
+
+// createLinksAndRoutes creates the links and routes described by args in
+// n.Stack. The FDs of the fd-based links are added to n.linkFDs. If disabled
+// is true, the interfaces are created disabled and must be enabled with
+// stack.Stack.EnableNIC.
+//
+// Preconditions: n.mu must be locked, if n is shared.
+func (n *Network) createLinksAndRoutes(args *CreateLinksAndRoutesArgs, disabled bool) error {
+	// Start after the existing NICs, e.g. the loopback interface created
+	// together with a container's isolated stack.
 	var nicID tcpip.NICID
+	for id := range n.Stack.NICInfo() {
+		if id > nicID {
+			nicID = id
+		}
+	}
 	nicids := make(map[string]tcpip.NICID)
 
 	// Collect routes from all links.
@@ -179,7 +322,10 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 		linkEP := packetsocket.New(ethernet.New(loopback.New()))
 
 		log.Infof("Enabling loopback interface %q with id %d on addresses %+v", link.Name, nicID, link.Addresses)
-		opts := stack.NICOptions{Name: link.Name}
+		opts := stack.NICOptions{
+			Name:     link.Name,
+			Disabled: disabled,
+		}
 		if err := n.createNICWithAddrs(nicID, linkEP, opts, link.Addresses); err != nil {
 			return err
 		}
@@ -208,9 +354,14 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 				return fmt.Errorf("failed to dup FD %v: %v", oldFD, err)
 			}
 			FDs = append(FDs, newFD)
+			n.linkFDs = append(n.linkFDs, newFD)
 			fdOffset++
 		}
 
+		if err := validateMTU(uint32(link.MTU), link.Addresses); err != nil {
+			return fmt.Errorf("link %q: %v", link.Name, err)
+		}
+
 		mac := tcpip.LinkAddress(link.LinkAddress)
 		log.Infof("gso max size is: %d", link.GSOMaxSize)
 
@@ -232,6 +383,9 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 		// Wrap linkEP in a sniffer to enable packet logging.
 		sniffEP := sniffer.New(packetsocket.New(linkEP))
 
+		// Allow changing the MTU with SetMTU.
+		mtuEP := newMTUEndpoint(sniffEP, uint32(link.MTU))
+
 		var qDisc stack.QueueingDiscipline
 		switch link.QDisc {
 		case config.QDiscNone:
@@ -242,10 +396,11 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 
 		log.Infof("Enabling interface %q with id %d on addresses %+v (%v) w/ %d channels", link.Name, nicID, link.Addresses, mac, link.NumChannels)
 		opts := stack.NICOptions{
-			Name:  link.Name,
-			QDisc: qDisc,
+			Name:     link.Name,
+			QDisc:    qDisc,
+			Disabled: disabled,
 		}
-		if err := n.createNICWithAddrs(nicID, sniffEP, opts, link.Addresses); err != nil {
+		if err := n.createNICWithAddrs(nicID, mtuEP, opts, link.Addresses); err != nil {
 			return err
 		}
 
@@ -265,11 +420,7 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 	}
 
 	if !args.Defaultv4Gateway.Route.Empty() {
-		nicID, ok := nicids[args.Defaultv4Gateway.Name]
-		if !ok {
-			return fmt.Errorf("invalid interface name %q for default route", args.Defaultv4Gateway.Name)
-		}
-		route, err := args.Defaultv4Gateway.Route.toTcpipRoute(nicID)
+		route, err := args.Defaultv4Gateway.toTcpipRoute(nicids, false /* v6 */)
 		if err != nil {
 			return err
 		}
@@ -277,11 +428,7 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 	}
 
 	if !args.Defaultv6Gateway.Route.Empty() {
-		nicID, ok := nicids[args.Defaultv6Gateway.Name]
-		if !ok {
-			return fmt.Errorf("invalid interface name %q for default route", args.Defaultv6Gateway.Name)
-		}
-		route, err := args.Defaultv6Gateway.Route.toTcpipRoute(nicID)
+		route, err := args.Defaultv6Gateway.toTcpipRoute(nicids, true /* v6 */)
 		if err != nil {
 			return err
 		}
@@ -293,6 +440,884 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 	return nil
 }
 
+// Reinitialize replaces the root network stack with a new one and recreates
+// its links and routes from the configuration given to CreateLinksAndRoutes,
+// which allows recovering from a wedged network stack without restarting the
+// containers. All tasks are paused while the stack is replaced, so network
+// I/O stops briefly. If the new stack can't be built, the old one is kept.
+//
+// Sockets created before the call remain bound to the old stack, which is
+// closed: established connections are lost and listening sockets stop
+// accepting connections, so applications must open new sockets, e.g. to
+// reconnect. iptables rules are carried over to the new stack. Other
+// settings changed at runtime, like those set by SetTCPDefaults and
+// SetConntrackLimit, are reset. Containers with an isolated network stack
+// are not affected.
+func (n *Network) Reinitialize(_, _ *struct{}) error {
+	log.Debugf("Network.Reinitialize")
+	if n.loader == nil {
+		return fmt.Errorf("reinitializing the network stack is not supported")
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.links == nil {
+		return fmt.Errorf("network links have not been created")
+	}
+	eps, ok := n.loader.k.RootNetworkNamespace().Stack().(*netstack.Stack)
+	if !ok {
+		return fmt.Errorf("sandbox doesn't use netstack")
+	}
+	s, err := newEmptySandboxNetworkStack(n.loader.k.Timekeeper(), n.loader.k, n.loader.root.conf.AllowPacketEndpointWrite)
+	if err != nil {
+		return fmt.Errorf("creating network stack: %w", err)
+	}
+	newStack := s.(*netstack.Stack).Stack
+
+	n.loader.k.Pause()
+	defer n.loader.k.Unpause()
+
+	oldStack := n.Stack
+	if ipt := oldStack.IPTables(); ipt.Modified() {
+		for id := stack.TableID(0); id < stack.NumTables; id++ {
+			for _, ipv6 := range []bool{false, true} {
+				newStack.IPTables().ReplaceTable(id, ipt.GetTable(id, ipv6), ipv6)
+			}
+		}
+	}
+
+	// Build the new links before touching the old stack, so that it's kept
+	// if they can't be created. They're created disabled: until the old
+	// links are removed, both read packets from the same host FDs, and the
+	// new stack must drop them rather than answer for the old stack's
+	// connections.
+	next := &Network{Stack: newStack}
+	if err := next.createLinksAndRoutes(n.links, true /* disabled */); err != nil {
+		closeNetworkStack(newStack)
+		for _, fd := range next.linkFDs {
+			unix.Close(fd)
+		}
+		return fmt.Errorf("recreating links and routes: %w", err)
+	}
+
+	// Stop the old links, which keep reading packets from the host FDs
+	// otherwise, and close the old stack.
+	closeNetworkStack(oldStack)
+	for _, fd := range n.linkFDs {
+		unix.Close(fd)
+	}
+
+	eps.ReplaceStack(newStack)
+	n.Stack = newStack
+	n.linkFDs = next.linkFDs
+	for id := range newStack.NICInfo() {
+		if err := newStack.EnableNIC(id); err != nil {
+			log.Warningf("Enabling NIC %d of the new network stack: %s", id, err)
+		}
+	}
+	log.Infof("Network stack reinitialized")
+	return nil
+}
+
+// closeNetworkStack removes the NICs of s, which stops their links, and
+// closes s, waiting for its endpoints to stop.
+func closeNetworkStack(s *stack.Stack) {
+	for id := range s.NICInfo() {
+		if err := s.RemoveNIC(id); err != nil {
+			log.Warningf("Removing NIC %d: %s", id, err)
+		}
+	}
+	s.Close()
+	s.Wait()
+}
+
+// replaceLinksAndRoutes replaces the links and routes of the root network
+// stack with the ones described by args, e.g. after a checkpoint was
+// restored on a host with different addressing. The loopback interfaces
+// can't be removed from a stack, so they are kept along with their routes,
+// and args can't contain loopback links.
+func (n *Network) replaceLinksAndRoutes(args *CreateLinksAndRoutesArgs) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(args.LoopbackLinks) > 0 || args.LoopbackOnly {
+		return fmt.Errorf("loopback links can't be replaced")
+	}
+	wantFDs := 0
+	for _, l := range args.FDBasedLinks {
+		wantFDs += l.NumChannels
+	}
+	if got := len(args.FilePayload.Files); got != wantFDs {
+		return fmt.Errorf("args.FilePayload.Files has %d FD's but we need %d entries based on FDBasedLinks", got, wantFDs)
+	}
+
+	loopbacks := make(map[tcpip.NICID]bool)
+	for id, info := range n.Stack.NICInfo() {
+		if info.Flags.Loopback {
+			loopbacks[id] = true
+			continue
+		}
+		// Removing the NIC stops its link from reading packets, so the
+		// FDs can be closed below.
+		if err := n.Stack.RemoveNIC(id); err != nil {
+			return fmt.Errorf("removing NIC %d: %v", id, err)
+		}
+	}
+	var loopbackRoutes []tcpip.Route
+	for _, r := range n.Stack.GetRouteTable() {
+		if loopbacks[r.NIC] {
+			loopbackRoutes = append(loopbackRoutes, r)
+		}
+	}
+	for _, fd := range n.linkFDs {
+		unix.Close(fd)
+	}
+	n.linkFDs = nil
+
+	if err := n.createLinksAndRoutes(args, false /* disabled */); err != nil {
+		return err
+	}
+	// Loopback routes normally appear before the others.
+	n.Stack.SetRouteTable(append(loopbackRoutes, n.Stack.GetRouteTable()...))
+
+	// Keep the loopback links to recreate them in Reinitialize.
+	links := *args
+	if n.links != nil {
+		links.LoopbackLinks = n.links.LoopbackLinks
+		for _, f := range n.links.FilePayload.Files {
+			f.Close()
+		}
+		n.links = nil
+	}
+	return n.saveLinks(&links)
+}
+
+// containerStack returns the network stack of container cid, or the root
+// network stack if cid is empty. It fails if container cid doesn't have its
+// own network namespace, instead of falling back to the root network stack.
+func (n *Network) containerStack(cid string) (*stack.Stack, error) {
+	if cid == "" {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		return n.Stack, nil
+	}
+	if n.loader == nil {
+		return nil, fmt.Errorf("configuring the network of container %q is not supported", cid)
+	}
+	return n.loader.networkStack(cid)
+}
+
+// SetConntrackLimitArgs are arguments to SetConntrackLimit.
+type SetConntrackLimitArgs struct {
+	// CID is the ID of the container whose network stack is configured. If
+	// empty, the root network stack is configured.
+	CID string
+
+	// Limit is the maximum number of tracked connections. 0 removes the
+	// limit.
+	Limit int
+
+	// Policy is what happens to new connections once Limit is hit, either
+	// "drop-new" or "evict-oldest".
+	Policy string
+}
+
+// SetConntrackLimit caps the number of connections tracked by the network
+// stack's connection tracking table, which protects the sandbox from
+// connection floods exhausting it. It returns the number of connections
+// currently tracked in count. The limit applies whether or not iptables
+// rules are installed.
+func (n *Network) SetConntrackLimit(args *SetConntrackLimitArgs, count *int) error {
+	log.Debugf("Network.SetConntrackLimit, cid: %q, limit: %d, policy: %q", args.CID, args.Limit, args.Policy)
+	if args.Limit < 0 {
+		return fmt.Errorf("invalid conntrack limit %d", args.Limit)
+	}
+	var policy stack.ConntrackLimitPolicy
+	switch args.Policy {
+	case "", stack.ConntrackDropNew.String():
+		policy = stack.ConntrackDropNew
+	case stack.ConntrackEvictOldest.String():
+		policy = stack.ConntrackEvictOldest
+	default:
+		return fmt.Errorf("invalid conntrack limit policy %q, must be %q or %q", args.Policy, stack.ConntrackDropNew, stack.ConntrackEvictOldest)
+	}
+
+	s, err := n.containerStack(args.CID)
+	if err != nil {
+		return err
+	}
+	s.IPTables().SetConntrackLimit(args.Limit, policy)
+	*count = s.IPTables().ConntrackCount()
+	return nil
+}
+
+// TCPDefaults are the defaults applied to new TCP sockets.
+type TCPDefaults struct {
+	// KeepaliveIdle is how long a connection must be idle before keepalive
+	// probes are sent, as set by TCP_KEEPIDLE.
+	KeepaliveIdle time.Duration
+
+	// KeepaliveInterval is the time between keepalive probes, as set by
+	// TCP_KEEPINTVL.
+	KeepaliveInterval time.Duration
+
+	// SendBufferSize is the send buffer size, as set by SO_SNDBUF.
+	SendBufferSize int
+
+	// ReceiveBufferSize is the receive buffer size, as set by SO_RCVBUF.
+	ReceiveBufferSize int
+}
+
+// SetTCPDefaultsArgs are arguments to SetTCPDefaults.
+type SetTCPDefaultsArgs struct {
+	// CID is the ID of the container whose network stack is configured. If
+	// empty, the root network stack is configured.
+	CID string
+
+	// Defaults are the new defaults. Zero fields are left unchanged.
+	Defaults TCPDefaults
+}
+
+// SetTCPDefaults configures the defaults of TCP sockets created from now on,
+// for applications that don't set the socket options themselves. Existing
+// sockets are not affected. Buffer sizes must be within the stack's buffer
+// size limits.
+func (n *Network) SetTCPDefaults(args *SetTCPDefaultsArgs, _ *struct{}) error {
+	log.Debugf("Network.SetTCPDefaults, cid: %q, defaults: %+v", args.CID, args.Defaults)
+	d := args.Defaults
+	if d.KeepaliveIdle < 0 || d.KeepaliveInterval < 0 || d.SendBufferSize < 0 || d.ReceiveBufferSize < 0 {
+		return fmt.Errorf("invalid TCP defaults %+v", d)
+	}
+
+	s, err := n.containerStack(args.CID)
+	if err != nil {
+		return err
+	}
+
+	// Check the buffer sizes before changing anything, so that invalid
+	// arguments leave the defaults untouched.
+	var ss tcpip.TCPSendBufferSizeRangeOption
+	if err := s.TransportProtocolOption(tcp.ProtocolNumber, &ss); err != nil {
+		return fmt.Errorf("getting TCP send buffer size: %s", err)
+	}
+	if d.SendBufferSize != 0 {
+		if d.SendBufferSize < ss.Min || d.SendBufferSize > ss.Max {
+			return fmt.Errorf("TCP send buffer size %d out of range [%d, %d]", d.SendBufferSize, ss.Min, ss.Max)
+		}
+		ss.Default = d.SendBufferSize
+	}
+	var rs tcpip.TCPReceiveBufferSizeRangeOption
+	if err := s.TransportProtocolOption(tcp.ProtocolNumber, &rs); err != nil {
+		return fmt.Errorf("getting TCP receive buffer size: %s", err)
+	}
+	if d.ReceiveBufferSize != 0 {
+		if d.ReceiveBufferSize < rs.Min || d.ReceiveBufferSize > rs.Max {
+			return fmt.Errorf("TCP receive buffer size %d out of range [%d, %d]", d.ReceiveBufferSize, rs.Min, rs.Max)
+		}
+		rs.Default = d.ReceiveBufferSize
+	}
+
+	opts := []tcpip.SettableTransportProtocolOption{&ss, &rs}
+	if d.KeepaliveIdle != 0 {
+		opt := tcpip.KeepaliveIdleOption(d.KeepaliveIdle)
+		opts = append(opts, &opt)
+	}
+	if d.KeepaliveInterval != 0 {
+		opt := tcpip.KeepaliveIntervalOption(d.KeepaliveInterval)
+		opts = append(opts, &opt)
+	}
+	for _, opt := range opts {
+		if err := s.SetTransportProtocolOption(tcp.ProtocolNumber, opt); err != nil {
+			return fmt.Errorf("SetTransportProtocolOption(%d, %T): %s", tcp.ProtocolNumber, opt, err)
+		}
+	}
+	return nil
+}
+
+// TCPDefaults returns the defaults applied to new TCP sockets in the network
+// stack of container cid, or the root network stack if cid is empty.
+func (n *Network) TCPDefaults(cid *string, out *TCPDefaults) error {
+	log.Debugf("Network.TCPDefaults, cid: %q", *cid)
+	s, err := n.containerStack(*cid)
+	if err != nil {
+		return err
+	}
+
+	var (
+		ki   tcpip.KeepaliveIdleOption
+		kint tcpip.KeepaliveIntervalOption
+		ss   tcpip.TCPSendBufferSizeRangeOption
+		rs   tcpip.TCPReceiveBufferSizeRangeOption
+	)
+	for _, opt := range []tcpip.GettableTransportProtocolOption{&ki, &kint, &ss, &rs} {
+		if err := s.TransportProtocolOption(tcp.ProtocolNumber, opt); err != nil {
+			return fmt.Errorf("TransportProtocolOption(%d, %T): %s", tcp.ProtocolNumber, opt, err)
+		}
+	}
+	*out = TCPDefaults{
+		KeepaliveIdle:     time.Duration(ki),
+		KeepaliveInterval: time.Duration(kint),
+		SendBufferSize:    ss.Default,
+		ReceiveBufferSize: rs.Default,
+	}
+	return nil
+}
+
+// NICStats are the traffic counters of a network interface.
+type NICStats struct {
+	// ID is the NIC ID of the interface.
+	ID int32
+
+	// Name is the name of the interface.
+	Name string
+
+	// RxPackets and RxBytes count the packets received while the interface
+	// was enabled.
+	RxPackets uint64
+	RxBytes   uint64
+
+	// TxPackets and TxBytes count the packets sent.
+	TxPackets uint64
+	TxBytes   uint64
+
+	// MalformedL4RcvdPackets counts received packets whose transport header
+	// couldn't be parsed.
+	MalformedL4RcvdPackets uint64
+
+	// UnknownL3ProtocolRcvdPackets and UnknownL4ProtocolRcvdPackets count
+	// received packets dropped because their network or transport protocol
+	// isn't supported by the stack.
+	UnknownL3ProtocolRcvdPackets uint64
+	UnknownL4ProtocolRcvdPackets uint64
+
+	// DisabledRxPackets and DisabledRxBytes count the packets dropped because
+	// they were received while the interface was disabled.
+	DisabledRxPackets uint64
+	DisabledRxBytes   uint64
+}
+
+// sumCounts returns the sum of the counters in m.
+func sumCounts(m *tcpip.IntegralStatCounterMap) uint64 {
+	var sum uint64
+	for _, k := range m.Keys() {
+		if c, ok := m.Get(k); ok {
+			sum += c.Value()
+		}
+	}
+	return sum
+}
+
+// Stats returns the counters of the interfaces in the network stack of
+// container cid, or the root network stack if cid is empty, sorted by name. It
+// fails if container cid shares the root network stack.
+func (n *Network) Stats(cid *string, out *[]NICStats) error {
+	log.Debugf("Network.Stats, cid: %q", *cid)
+	s, err := n.containerStack(*cid)
+	if err != nil {
+		return err
+	}
+	var stats []NICStats
+	for id, info := range s.NICInfo() {
+		stats = append(stats, NICStats{
+			ID:                           int32(id),
+			Name:                         info.Name,
+			RxPackets:                    info.Stats.Rx.Packets.Value(),
+			RxBytes:                      info.Stats.Rx.Bytes.Value(),
+			TxPackets:                    info.Stats.Tx.Packets.Value(),
+			TxBytes:                      info.Stats.Tx.Bytes.Value(),
+			MalformedL4RcvdPackets:       info.Stats.MalformedL4RcvdPackets.Value(),
+			UnknownL3ProtocolRcvdPackets: sumCounts(info.Stats.UnknownL3ProtocolRcvdPacketCounts),
+			UnknownL4ProtocolRcvdPackets: sumCounts(info.Stats.UnknownL4ProtocolRcvdPacketCounts),
+			DisabledRxPackets:            info.Stats.DisabledRx.Packets.Value(),
+			DisabledRxBytes:              info.Stats.DisabledRx.Bytes.Value(),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	*out = stats
+	return nil
+}
+
+// ResetStats zeroes the counters of all interfaces in the network stack of
+// container cid, or the root network stack if cid is empty, which allows
+// measuring traffic over a window with Stats. All per-interface counters are
+// reset, including those not reported by Stats. Stack-wide counters, e.g.
+// those reported in /proc/net/snmp, and gauges like the number of open
+// connections are left unchanged. It fails if container cid shares the root
+// network stack, whose counters are reset without a container ID.
+func (n *Network) ResetStats(cid *string, _ *struct{}) error {
+	log.Debugf("Network.ResetStats, cid: %q", *cid)
+	s, err := n.containerStack(*cid)
+	if err != nil {
+		return err
+	}
+	for id := range s.NICInfo() {
+		if err := s.ResetNICStats(id); err != nil {
+			return fmt.Errorf("ResetNICStats(%d): %s", id, err)
+		}
+	}
+	return nil
+}
+
+// StackStats are the stack-wide counters of a network stack, i.e. the
+// traffic of all its interfaces and endpoints.
+type StackStats struct {
+	// DroppedPackets counts the packets dropped by the stack, e.g. because
+	// their checksum was wrong or no endpoint wanted them.
+	DroppedPackets uint64
+
+	// IP counters, for IPv4 and IPv6 combined.
+	IPPacketsReceived          uint64
+	IPPacketsDelivered         uint64
+	IPPacketsSent              uint64
+	IPOutgoingPacketErrors     uint64
+	IPMalformedPacketsReceived uint64
+
+	// TCP counters. TCPCurrentEstablished is a gauge of the connections
+	// currently in the ESTABLISHED state.
+	TCPActiveConnectionOpenings  uint64
+	TCPPassiveConnectionOpenings uint64
+	TCPCurrentEstablished        uint64
+	TCPEstablishedResets         uint64
+	TCPFailedConnectionAttempts  uint64
+	TCPValidSegmentsReceived     uint64
+	TCPInvalidSegmentsReceived   uint64
+	TCPSegmentsSent              uint64
+	TCPSegmentSendErrors         uint64
+	TCPResetsSent                uint64
+	TCPResetsReceived            uint64
+	TCPRetransmits               uint64
+	TCPTimeouts                  uint64
+	TCPChecksumErrors            uint64
+
+	// UDP counters.
+	UDPPacketsReceived          uint64
+	UDPUnknownPortErrors        uint64
+	UDPReceiveBufferErrors      uint64
+	UDPMalformedPacketsReceived uint64
+	UDPPacketsSent              uint64
+	UDPPacketSendErrors         uint64
+	UDPChecksumErrors           uint64
+}
+
+// StackStats returns the stack-wide counters of the network stack of
+// container cid, or the root network stack if cid is empty. Unlike the
+// counters returned by Stats, they aren't zeroed by ResetStats.
+func (n *Network) StackStats(cid *string, out *StackStats) error {
+	log.Debugf("Network.StackStats, cid: %q", *cid)
+	s, err := n.containerStack(*cid)
+	if err != nil {
+		return err
+	}
+	stats := s.Stats()
+	*out = StackStats{
+		DroppedPackets: stats.DroppedPackets.Value(),
+
+		IPPacketsReceived:          stats.IP.PacketsReceived.Value(),
+		IPPacketsDelivered:         stats.IP.PacketsDelivered.Value(),
+		IPPacketsSent:              stats.IP.PacketsSent.Value(),
+		IPOutgoingPacketErrors:     stats.IP.OutgoingPacketErrors.Value(),
+		IPMalformedPacketsReceived: stats.IP.MalformedPacketsReceived.Value(),
+
+		TCPActiveConnectionOpenings:  stats.TCP.ActiveConnectionOpenings.Value(),
+		TCPPassiveConnectionOpenings: stats.TCP.PassiveConnectionOpenings.Value(),
+		TCPCurrentEstablished:        stats.TCP.CurrentEstablished.Value(),
+		TCPEstablishedResets:         stats.TCP.EstablishedResets.Value(),
+		TCPFailedConnectionAttempts:  stats.TCP.FailedConnectionAttempts.Value(),
+		TCPValidSegmentsReceived:     stats.TCP.ValidSegmentsReceived.Value(),
+		TCPInvalidSegmentsReceived:   stats.TCP.InvalidSegmentsReceived.Value(),
+		TCPSegmentsSent:              stats.TCP.SegmentsSent.Value(),
+		TCPSegmentSendErrors:         stats.TCP.SegmentSendErrors.Value(),
+		TCPResetsSent:                stats.TCP.ResetsSent.Value(),
+		TCPResetsReceived:            stats.TCP.ResetsReceived.Value(),
+		TCPRetransmits:               stats.TCP.Retransmits.Value(),
+		TCPTimeouts:                  stats.TCP.Timeouts.Value(),
+		TCPChecksumErrors:            stats.TCP.ChecksumErrors.Value(),
+
+		UDPPacketsReceived:          stats.UDP.PacketsReceived.Value(),
+		UDPUnknownPortErrors:        stats.UDP.UnknownPortErrors.Value(),
+		UDPReceiveBufferErrors:      stats.UDP.ReceiveBufferErrors.Value(),
+		UDPMalformedPacketsReceived: stats.UDP.MalformedPacketsReceived.Value(),
+		UDPPacketsSent:              stats.UDP.PacketsSent.Value(),
+		UDPPacketSendErrors:         stats.UDP.PacketSendErrors.Value(),
+		UDPChecksumErrors:           stats.UDP.ChecksumErrors.Value(),
+	}
+	return nil
+}
+
+// RouteArgs are arguments to AddRoute and DeleteRoute.
+type RouteArgs struct {
+	// CID is the ID of the container whose network stack is configured. If
+	// empty, the root network stack is configured.
+	CID string
+
+	// NIC is the name of the interface that the route goes through.
+	NIC string
+
+	// Route is the route. Its gateway is nil for a directly connected
+	// destination.
+	Route Route
+}
+
+// AddRoute adds a route to a running network stack, e.g. to follow a change
+// of the host's network. Routes are matched in order, so the route is
+// inserted before the routes with a shorter prefix to get longest-prefix
+// matching. Adding a route that already exists fails.
+func (n *Network) AddRoute(args *RouteArgs, _ *struct{}) error {
+	log.Debugf("Network.AddRoute, cid: %q, nic: %q, route: %+v", args.CID, args.NIC, args.Route)
+	s, route, err := n.routeFromArgs(args)
+	if err != nil {
+		return err
+	}
+	log.Infof("Adding route %s", route)
+	if !s.InsertRoute(route) {
+		return fmt.Errorf("route %s already exists", route)
+	}
+	return nil
+}
+
+// DeleteRoute deletes a route from a running network stack. It fails if there
+// is no route with the same destination, gateway and interface.
+func (n *Network) DeleteRoute(args *RouteArgs, _ *struct{}) error {
+	log.Debugf("Network.DeleteRoute, cid: %q, nic: %q, route: %+v", args.CID, args.NIC, args.Route)
+	s, route, err := n.routeFromArgs(args)
+	if err != nil {
+		return err
+	}
+	log.Infof("Deleting route %s", route)
+	found := false
+	s.RemoveRoutes(func(r tcpip.Route) bool {
+		if r == route {
+			found = true
+			return true
+		}
+		return false
+	})
+	if !found {
+		return fmt.Errorf("route %s not found", route)
+	}
+	return nil
+}
+
+// SetNICEnabledArgs are arguments to SetNICEnabled.
+type SetNICEnabledArgs struct {
+	// CID is the ID of the container whose network stack is configured. If
+	// empty, the root network stack is configured.
+	CID string
+
+	// NIC is the name of the interface.
+	NIC string
+
+	// Enabled is whether the interface is enabled.
+	Enabled bool
+}
+
+// SetNICEnabled enables or disables an interface of a running network stack,
+// e.g. to follow a host interface going down and up without tearing down the
+// network. A disabled interface drops the packets it receives, and routes
+// through it are skipped, so sending fails with a routing error unless
+// another route matches. Its addresses and routes are kept for when it's
+// enabled again.
+func (n *Network) SetNICEnabled(args *SetNICEnabledArgs, _ *struct{}) error {
+	log.Debugf("Network.SetNICEnabled, cid: %q, nic: %q, enabled: %t", args.CID, args.NIC, args.Enabled)
+	s, err := n.containerStack(args.CID)
+	if err != nil {
+		return err
+	}
+	id, err := nicByName(s, args.NIC)
+	if err != nil {
+		return err
+	}
+	if !args.Enabled {
+		log.Infof("Disabling interface %q", args.NIC)
+		if err := s.DisableNIC(id); err != nil {
+			return fmt.Errorf("DisableNIC(%d): %s", id, err)
+		}
+		return nil
+	}
+	log.Infof("Enabling interface %q", args.NIC)
+	if err := s.EnableNIC(id); err != nil {
+		return fmt.Errorf("EnableNIC(%d): %s", id, err)
+	}
+	return nil
+}
+
+// AddressArgs are arguments to AddAddress and RemoveAddress.
+type AddressArgs struct {
+	// CID is the ID of the container whose network stack is configured. If
+	// empty, the root network stack is configured.
+	CID string
+
+	// NIC is the name of the interface.
+	NIC string
+
+	// Address is the IPv4 or IPv6 address and its prefix length.
+	Address IPWithPrefix
+}
+
+// AddAddress assigns an address to an interface of a running network stack,
+// e.g. to add an IPv6 address after the container started. The first address
+// of each IP version assigned to an interface is its primary address, which
+// is used as source address of outgoing packets. No route is added for the
+// address's subnet. Adding an address that's already assigned to the
+// interface fails.
+func (n *Network) AddAddress(args *AddressArgs, _ *struct{}) error {
+	log.Debugf("Network.AddAddress, cid: %q, nic: %q, address: %s", args.CID, args.NIC, args.Address)
+	s, err := n.containerStack(args.CID)
+	if err != nil {
+		return err
+	}
+	id, err := nicByName(s, args.NIC)
+	if err != nil {
+		return err
+	}
+	protocolAddr, err := toProtocolAddress(args.Address)
+	if err != nil {
+		return err
+	}
+	if mtu := s.NICInfo()[id].MTU; protocolAddr.Protocol == ipv6.ProtocolNumber && mtu < header.IPv6MinimumMTU {
+		return fmt.Errorf("interface %q has MTU %d, smaller than the IPv6 minimum of %d", args.NIC, mtu, header.IPv6MinimumMTU)
+	}
+	log.Infof("Adding address %s to interface %q", args.Address, args.NIC)
+	switch err := s.AddProtocolAddress(id, protocolAddr, stack.AddressProperties{}).(type) {
+	case nil:
+		return nil
+	case *tcpip.ErrDuplicateAddress:
+		return fmt.Errorf("address %s already exists on interface %q", args.Address.Address, args.NIC)
+	default:
+		return fmt.Errorf("AddProtocolAddress(%d, %+v, {}) failed: %s", id, protocolAddr, err)
+	}
+}
+
+// RemoveAddress removes an address from an interface of a running network
+// stack. It fails if the address isn't assigned to the interface with the
+// same prefix length. Unlike Linux, removing the primary address doesn't
+// remove the other addresses of its subnet: the next address of the same IP
+// version becomes the primary address. Connections using the removed address
+// are not closed, but can no longer receive packets.
+func (n *Network) RemoveAddress(args *AddressArgs, _ *struct{}) error {
+	log.Debugf("Network.RemoveAddress, cid: %q, nic: %q, address: %s", args.CID, args.NIC, args.Address)
+	s, err := n.containerStack(args.CID)
+	if err != nil {
+		return err
+	}
+	id, err := nicByName(s, args.NIC)
+	if err != nil {
+		return err
+	}
+	protocolAddr, err := toProtocolAddress(args.Address)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, addr := range s.AllAddresses()[id] {
+		if addr == protocolAddr {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("address %s not found on interface %q", args.Address, args.NIC)
+	}
+	log.Infof("Removing address %s from interface %q", args.Address, args.NIC)
+	if err := s.RemoveAddress(id, protocolAddr.AddressWithPrefix.Address); err != nil {
+		return fmt.Errorf("RemoveAddress(%d, %s) failed: %s", id, protocolAddr.AddressWithPrefix.Address, err)
+	}
+	return nil
+}
+
+// SetMTUArgs are arguments to SetMTU.
+type SetMTUArgs struct {
+	// CID is the ID of the container whose network stack is configured. If
+	// empty, the root network stack is configured.
+	CID string
+
+	// NIC is the name of the interface.
+	NIC string
+
+	// MTU is the new maximum transmission unit of the interface.
+	MTU uint32
+}
+
+// SetMTU changes the MTU of an interface of a running network stack, e.g. to
+// follow a tunnel on the host that reduces the MTU. It applies to the packets
+// sent after the call, without recreating the interface. Established TCP
+// connections keep the MSS they negotiated, so their larger segments are
+// fragmented. Only the fd-based links created by CreateLinksAndRoutes
+// support changing their MTU.
+func (n *Network) SetMTU(args *SetMTUArgs, _ *struct{}) error {
+	log.Debugf("Network.SetMTU, cid: %q, nic: %q, mtu: %d", args.CID, args.NIC, args.MTU)
+	var s *stack.Stack
+	if args.CID == "" {
+		// Hold n.mu until the saved links are updated, so that Reinitialize
+		// doesn't recreate the links with the old MTU meanwhile.
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		s = n.Stack
+	} else {
+		var err error
+		if s, err = n.containerStack(args.CID); err != nil {
+			return err
+		}
+	}
+	id, err := nicByName(s, args.NIC)
+	if err != nil {
+		return err
+	}
+	ep, ok := s.GetLinkEndpointByName(args.NIC).(*mtuEndpoint)
+	if !ok {
+		return fmt.Errorf("interface %q doesn't support changing its MTU", args.NIC)
+	}
+	var addrs []IPWithPrefix
+	for _, addr := range s.AllAddresses()[id] {
+		addrs = append(addrs, IPWithPrefix{
+			Address:   net.IP(addr.AddressWithPrefix.Address),
+			PrefixLen: addr.AddressWithPrefix.PrefixLen,
+		})
+	}
+	if err := validateMTU(args.MTU, addrs); err != nil {
+		return fmt.Errorf("interface %q: %v", args.NIC, err)
+	}
+	log.Infof("Setting MTU of interface %q to %d", args.NIC, args.MTU)
+	ep.SetMTU(args.MTU)
+
+	// Keep the MTU if the links are recreated by Reinitialize.
+	if args.CID == "" && n.links != nil {
+		for i := range n.links.FDBasedLinks {
+			if link := &n.links.FDBasedLinks[i]; link.Name == args.NIC {
+				link.MTU = int(args.MTU)
+			}
+		}
+	}
+	return nil
+}
+
+// Interface describes a network interface returned by ListInterfaces.
+type Interface struct {
+	// ID is the netstack ID of the interface.
+	ID int32
+
+	// Name is the name of the interface.
+	Name string
+
+	// LinkAddress is the link address of the interface, if any.
+	LinkAddress net.HardwareAddr
+
+	// MTU is the maximum transmission unit of the interface.
+	MTU uint32
+
+	// Enabled is false if the interface has been disabled, e.g. by
+	// SetNICEnabled.
+	Enabled bool
+
+	// Loopback is true for loopback interfaces.
+	Loopback bool
+
+	// Addresses are the addresses of all network protocols assigned to the
+	// interface.
+	Addresses []IPWithPrefix
+}
+
+// ListInterfaces returns the interfaces of the network stack of container cid,
+// or the root network stack if cid is empty, sorted by ID, like "ip addr".
+func (n *Network) ListInterfaces(cid *string, out *[]Interface) error {
+	log.Debugf("Network.ListInterfaces, cid: %q", *cid)
+	s, err := n.containerStack(*cid)
+	if err != nil {
+		return err
+	}
+	var ifaces []Interface
+	for id, info := range s.NICInfo() {
+		iface := Interface{
+			ID:       int32(id),
+			Name:     info.Name,
+			MTU:      info.MTU,
+			Enabled:  info.Flags.Running,
+			Loopback: info.Flags.Loopback,
+		}
+		if info.LinkAddress != "" {
+			iface.LinkAddress = net.HardwareAddr(info.LinkAddress)
+		}
+		for _, addr := range info.ProtocolAddresses {
+			iface.Addresses = append(iface.Addresses, IPWithPrefix{
+				Address:   net.IP(addr.AddressWithPrefix.Address),
+				PrefixLen: addr.AddressWithPrefix.PrefixLen,
+			})
+		}
+		ifaces = append(ifaces, iface)
+	}
+	sort.Slice(ifaces, func(i, j int) bool { return ifaces[i].ID < ifaces[j].ID })
+	*out = ifaces
+	return nil
+}
+
+// RouteEntry is a route of the route table returned by ListRoutes.
+type RouteEntry struct {
+	// NIC is the name of the interface that the route goes through.
+	NIC string
+
+	// Route is the route. Its gateway is nil for a directly connected
+	// destination.
+	Route Route
+}
+
+// ListRoutes returns the route table of the network stack of container cid,
+// or the root network stack if cid is empty, like "ip route". Routes are
+// listed in the order in which they're matched.
+func (n *Network) ListRoutes(cid *string, out *[]RouteEntry) error {
+	log.Debugf("Network.ListRoutes, cid: %q", *cid)
+	s, err := n.containerStack(*cid)
+	if err != nil {
+		return err
+	}
+	nics := s.NICInfo()
+	var routes []RouteEntry
+	for _, r := range s.GetRouteTable() {
+		entry := RouteEntry{
+			NIC: nics[r.NIC].Name,
+			Route: Route{
+				Destination: net.IPNet{
+					IP:   net.IP(r.Destination.ID()),
+					Mask: net.IPMask(r.Destination.Mask()),
+				},
+			},
+		}
+		if r.Gateway != "" {
+			entry.Route.Gateway = net.IP(r.Gateway)
+		}
+		routes = append(routes, entry)
+	}
+	*out = routes
+	return nil
+}
+
+// routeFromArgs returns the network stack and the route described by args.
+func (n *Network) routeFromArgs(args *RouteArgs) (*stack.Stack, tcpip.Route, error) {
+	s, err := n.containerStack(args.CID)
+	if err != nil {
+		return nil, tcpip.Route{}, err
+	}
+	id, err := nicByName(s, args.NIC)
+	if err != nil {
+		return nil, tcpip.Route{}, err
+	}
+	if args.Route.Destination.IP == nil || args.Route.Destination.Mask == nil {
+		return nil, tcpip.Route{}, fmt.Errorf("route has no destination")
+	}
+	route, err := args.Route.toTcpipRoute(id)
+	if err != nil {
+		return nil, tcpip.Route{}, fmt.Errorf("invalid route: %v", err)
+	}
+	return s, route, nil
+}
+
+// nicByName returns the ID of the interface called name in s.
+func nicByName(s *stack.Stack, name string) (tcpip.NICID, error) {
+	for id, info := range s.NICInfo() {
+		if info.Name == name {
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("no interface named %q", name)
+}
+
 // createNICWithAddrs creates a NIC in the network stack and adds the given
 // addresses.
 func (n *Network) createNICWithAddrs(id tcpip.NICID, ep stack.LinkEndpoint, opts stack.NICOptions, addrs []IPWithPrefix) error {
@@ -301,13 +1326,9 @@ func (n *Network) createNICWithAddrs(id tcpip.NICID, ep stack.LinkEndpoint, opts
 	}
 
 	for _, addr := range addrs {
-		proto, tcpipAddr := ipToAddressAndProto(addr.Address)
-		protocolAddr := tcpip.ProtocolAddress{
-			Protocol: proto,
-			AddressWithPrefix: tcpip.AddressWithPrefix{
-				Address:   tcpipAddr,
-				PrefixLen: addr.PrefixLen,
-			},
+		protocolAddr, err := toProtocolAddress(addr)
+		if err != nil {
+			return err
 		}
 		if err := n.Stack.AddProtocolAddress(id, protocolAddr, stack.AddressProperties{}); err != nil {
 			return fmt.Errorf("AddProtocolAddress(%d, %+v, {}) failed: %s", id, protocolAddr, err)
@@ -316,6 +1337,69 @@ func (n *Network) createNICWithAddrs(id tcpip.NICID, ep stack.LinkEndpoint, opts
 	return nil
 }
 
+// maxMTU is the largest MTU of an interface, i.e. the largest IP packet.
+const maxMTU = 65535
+
+// validateMTU checks that mtu is a valid MTU for an interface with the given
+// addresses. IPv4 requires an MTU of at least 68 bytes, and IPv6 at least
+// 1280 bytes.
+func validateMTU(mtu uint32, addrs []IPWithPrefix) error {
+	if mtu > maxMTU {
+		return fmt.Errorf("MTU %d is larger than the maximum of %d", mtu, maxMTU)
+	}
+	if mtu < header.IPv4MinimumMTU {
+		return fmt.Errorf("MTU %d is smaller than the IPv4 minimum of %d", mtu, header.IPv4MinimumMTU)
+	}
+	for _, addr := range addrs {
+		if addr.Address.To4() == nil && mtu < header.IPv6MinimumMTU {
+			return fmt.Errorf("MTU %d is smaller than the IPv6 minimum of %d required by address %s", mtu, header.IPv6MinimumMTU, addr)
+		}
+	}
+	return nil
+}
+
+// mtuEndpoint is a link endpoint whose MTU can be changed while it's in use.
+type mtuEndpoint struct {
+	nested.Endpoint
+
+	// mtu is the MTU of the endpoint. It's accessed atomically.
+	mtu uint32
+}
+
+// newMTUEndpoint returns an endpoint that wraps lower and reports mtu as its
+// MTU until it's changed by SetMTU.
+func newMTUEndpoint(lower stack.LinkEndpoint, mtu uint32) *mtuEndpoint {
+	e := &mtuEndpoint{mtu: mtu}
+	e.Endpoint.Init(lower, e)
+	return e
+}
+
+// MTU implements stack.LinkEndpoint.MTU.
+func (e *mtuEndpoint) MTU() uint32 {
+	return atomic.LoadUint32(&e.mtu)
+}
+
+// SetMTU changes the MTU of the endpoint.
+func (e *mtuEndpoint) SetMTU(mtu uint32) {
+	atomic.StoreUint32(&e.mtu, mtu)
+}
+
+// toProtocolAddress converts addr to a tcpip.ProtocolAddress, checking that
+// its prefix length is valid for its IP version.
+func toProtocolAddress(addr IPWithPrefix) (tcpip.ProtocolAddress, error) {
+	proto, tcpipAddr := ipToAddressAndProto(addr.Address)
+	if addr.PrefixLen < 0 || addr.PrefixLen > 8*len(tcpipAddr) {
+		return tcpip.ProtocolAddress{}, fmt.Errorf("invalid prefix length for address %s", addr)
+	}
+	return tcpip.ProtocolAddress{
+		Protocol: proto,
+		AddressWithPrefix: tcpip.AddressWithPrefix{
+			Address:   tcpipAddr,
+			PrefixLen: addr.PrefixLen,
+		},
+	}, nil
+}
+
 // ipToAddressAndProto converts IP to tcpip.Address and a protocol number.
 //
 // Note: don't use 'len(ip)' to determine IP version because length is always 16.
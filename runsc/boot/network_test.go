@@ -0,0 +1,894 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/icmp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/urpc"
+	"gvisor.dev/gvisor/pkg/waiter"
+)
+
+func newTestNetwork() *Network {
+	return &Network{
+		Stack: stack.New(stack.Options{
+			NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+			TransportProtocols: []stack.TransportProtocolFactory{tcp.NewProtocol},
+		}),
+	}
+}
+
+func TestSetTCPDefaults(t *testing.T) {
+	n := newTestNetwork()
+	defer n.Stack.Close()
+
+	want := TCPDefaults{
+		KeepaliveIdle:     30 * time.Second,
+		KeepaliveInterval: 5 * time.Second,
+		SendBufferSize:    64 << 10,
+		ReceiveBufferSize: 128 << 10,
+	}
+	if err := n.SetTCPDefaults(&SetTCPDefaultsArgs{Defaults: want}, nil); err != nil {
+		t.Fatalf("SetTCPDefaults(%+v): %v", want, err)
+	}
+	cid := ""
+	var got TCPDefaults
+	if err := n.TCPDefaults(&cid, &got); err != nil {
+		t.Fatalf("TCPDefaults(): %v", err)
+	}
+	if got != want {
+		t.Errorf("TCPDefaults() = %+v, want: %+v", got, want)
+	}
+
+	// A new socket inherits the defaults.
+	var wq waiter.Queue
+	ep, err := n.Stack.NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, &wq)
+	if err != nil {
+		t.Fatalf("NewEndpoint(): %s", err)
+	}
+	defer ep.Close()
+	var idle tcpip.KeepaliveIdleOption
+	if err := ep.GetSockOpt(&idle); err != nil {
+		t.Fatalf("GetSockOpt(KeepaliveIdleOption): %s", err)
+	}
+	if got := time.Duration(idle); got != want.KeepaliveIdle {
+		t.Errorf("keepalive idle got: %v, want: %v", got, want.KeepaliveIdle)
+	}
+	var interval tcpip.KeepaliveIntervalOption
+	if err := ep.GetSockOpt(&interval); err != nil {
+		t.Fatalf("GetSockOpt(KeepaliveIntervalOption): %s", err)
+	}
+	if got := time.Duration(interval); got != want.KeepaliveInterval {
+		t.Errorf("keepalive interval got: %v, want: %v", got, want.KeepaliveInterval)
+	}
+	if got := ep.SocketOptions().GetSendBufferSize(); got != int64(want.SendBufferSize) {
+		t.Errorf("send buffer size got: %d, want: %d", got, want.SendBufferSize)
+	}
+	if got := ep.SocketOptions().GetReceiveBufferSize(); got != int64(want.ReceiveBufferSize) {
+		t.Errorf("receive buffer size got: %d, want: %d", got, want.ReceiveBufferSize)
+	}
+}
+
+func TestSetTCPDefaultsInvalid(t *testing.T) {
+	n := newTestNetwork()
+	defer n.Stack.Close()
+
+	cid := ""
+	var before TCPDefaults
+	if err := n.TCPDefaults(&cid, &before); err != nil {
+		t.Fatalf("TCPDefaults(): %v", err)
+	}
+	for _, d := range []TCPDefaults{
+		{KeepaliveIdle: -time.Second},
+		{SendBufferSize: -1},
+		{SendBufferSize: 1},
+		{KeepaliveInterval: time.Second, ReceiveBufferSize: 1 << 40},
+	} {
+		if err := n.SetTCPDefaults(&SetTCPDefaultsArgs{Defaults: d}, nil); err == nil {
+			t.Errorf("SetTCPDefaults(%+v) succeeded, want error", d)
+		}
+	}
+	var after TCPDefaults
+	if err := n.TCPDefaults(&cid, &after); err != nil {
+		t.Fatalf("TCPDefaults(): %v", err)
+	}
+	if after != before {
+		t.Errorf("TCPDefaults() after failed updates = %+v, want: %+v", after, before)
+	}
+}
+
+func TestResetStats(t *testing.T) {
+	n := newTestNetwork()
+	defer n.Stack.Close()
+
+	ep := channel.New(1, 1500, "")
+	if err := n.Stack.CreateNICWithOptions(1, ep, stack.NICOptions{Name: "eth0"}); err != nil {
+		t.Fatalf("CreateNICWithOptions(): %s", err)
+	}
+	inject := func() {
+		pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+			Data: buffer.NewViewFromBytes([]byte{1, 2, 3, 4}).ToVectorisedView(),
+		})
+		// The protocol is unknown, so the packet is only counted.
+		ep.InjectInbound(0x1234, pkt)
+		pkt.DecRef()
+	}
+	cid := ""
+	check := func(wantPackets, wantBytes uint64) {
+		t.Helper()
+		var stats []NICStats
+		if err := n.Stats(&cid, &stats); err != nil {
+			t.Fatalf("Stats(): %v", err)
+		}
+		if len(stats) != 1 || stats[0].Name != "eth0" {
+			t.Fatalf("Stats() = %+v, want stats of eth0", stats)
+		}
+		if stats[0].RxPackets != wantPackets || stats[0].RxBytes != wantBytes {
+			t.Errorf("Stats() = %+v, want RxPackets: %d, RxBytes: %d", stats[0], wantPackets, wantBytes)
+		}
+	}
+
+	inject()
+	inject()
+	check(2, 8)
+
+	if err := n.ResetStats(&cid, nil); err != nil {
+		t.Fatalf("ResetStats(): %v", err)
+	}
+	check(0, 0)
+
+	// Counting resumes after the reset.
+	inject()
+	check(1, 4)
+}
+
+func TestStatsDropCounters(t *testing.T) {
+	n := newTestNetwork()
+	defer n.Stack.Close()
+
+	ep := channel.New(1, 1500, "")
+	if err := n.Stack.CreateNICWithOptions(1, ep, stack.NICOptions{Name: "eth0"}); err != nil {
+		t.Fatalf("CreateNICWithOptions(): %s", err)
+	}
+	inject := func(proto tcpip.NetworkProtocolNumber) {
+		pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+			Data: buffer.NewViewFromBytes([]byte{1, 2, 3, 4}).ToVectorisedView(),
+		})
+		ep.InjectInbound(proto, pkt)
+		pkt.DecRef()
+	}
+	// An unknown protocol, a truncated IPv4 header, and a packet received
+	// while the interface is disabled.
+	inject(0x1234)
+	inject(ipv4.ProtocolNumber)
+	if err := n.Stack.DisableNIC(1); err != nil {
+		t.Fatalf("DisableNIC(): %s", err)
+	}
+	inject(ipv4.ProtocolNumber)
+
+	cid := ""
+	var stats []NICStats
+	if err := n.Stats(&cid, &stats); err != nil {
+		t.Fatalf("Stats(): %v", err)
+	}
+	want := NICStats{
+		ID:                           1,
+		Name:                         "eth0",
+		RxPackets:                    2,
+		RxBytes:                      8,
+		UnknownL3ProtocolRcvdPackets: 1,
+		DisabledRxPackets:            1,
+		DisabledRxBytes:              4,
+	}
+	if len(stats) != 1 || stats[0] != want {
+		t.Errorf("Stats() = %+v, want: [%+v]", stats, want)
+	}
+
+	checkStackStats := func() {
+		t.Helper()
+		var got StackStats
+		if err := n.StackStats(&cid, &got); err != nil {
+			t.Fatalf("StackStats(): %v", err)
+		}
+		if got.IPPacketsReceived != 1 || got.IPMalformedPacketsReceived != 1 || got.IPPacketsDelivered != 0 {
+			t.Errorf("StackStats() = %+v, want IPPacketsReceived: 1, IPMalformedPacketsReceived: 1, IPPacketsDelivered: 0", got)
+		}
+	}
+	checkStackStats()
+
+	// Stack-wide counters are left unchanged by ResetStats.
+	if err := n.ResetStats(&cid, nil); err != nil {
+		t.Fatalf("ResetStats(): %v", err)
+	}
+	checkStackStats()
+}
+
+// linkFile returns one end of a socket pair to back an fd-based link.
+func linkFile(t *testing.T) *os.File {
+	t.Helper()
+	f, _ := linkFilePair(t)
+	return f
+}
+
+// linkFilePair is like linkFile, but also returns the FD of the other end of
+// the socket pair, which sees the packets sent on the link.
+func linkFilePair(t *testing.T) (*os.File, int) {
+	t.Helper()
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET, 0)
+	if err != nil {
+		t.Fatalf("Socketpair(): %v", err)
+	}
+	t.Cleanup(func() { unix.Close(fds[1]) })
+	f := os.NewFile(uintptr(fds[0]), "link")
+	t.Cleanup(func() { f.Close() })
+	return f, fds[1]
+}
+
+func TestReplaceLinksAndRoutes(t *testing.T) {
+	n := newTestNetwork()
+	defer n.Stack.Close()
+
+	lo := LoopbackLink{
+		Name:      "lo",
+		Addresses: []IPWithPrefix{{Address: net.IPv4(127, 0, 0, 1).To4(), PrefixLen: 8}},
+		Routes: []Route{{
+			Destination: net.IPNet{IP: net.IPv4(127, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)},
+		}},
+	}
+	eth := func(addr net.IP) FDBasedLink {
+		return FDBasedLink{
+			Name:        "eth0",
+			MTU:         1500,
+			Addresses:   []IPWithPrefix{{Address: addr, PrefixLen: 24}},
+			NumChannels: 1,
+			Routes: []Route{{
+				Destination: net.IPNet{IP: addr.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)},
+			}},
+		}
+	}
+	args := &CreateLinksAndRoutesArgs{
+		FilePayload:   urpc.FilePayload{Files: []*os.File{linkFile(t)}},
+		LoopbackLinks: []LoopbackLink{lo},
+		FDBasedLinks:  []FDBasedLink{eth(net.IPv4(10, 0, 0, 2).To4())},
+	}
+	if err := n.CreateLinksAndRoutes(args, nil); err != nil {
+		t.Fatalf("CreateLinksAndRoutes(): %v", err)
+	}
+
+	want := net.IPv4(192, 168, 1, 2).To4()
+	override := &CreateLinksAndRoutesArgs{
+		FilePayload:  urpc.FilePayload{Files: []*os.File{linkFile(t)}},
+		FDBasedLinks: []FDBasedLink{eth(want)},
+	}
+	if err := n.replaceLinksAndRoutes(override); err != nil {
+		t.Fatalf("replaceLinksAndRoutes(): %v", err)
+	}
+
+	// The loopback interface is kept and eth0 is recreated.
+	names := make(map[string]tcpip.NICID)
+	for id, info := range n.Stack.NICInfo() {
+		names[info.Name] = id
+	}
+	if len(names) != 2 {
+		t.Fatalf("NICInfo() = %+v, want lo and eth0", n.Stack.NICInfo())
+	}
+	ethID, ok := names["eth0"]
+	if !ok {
+		t.Fatalf("eth0 not found in %+v", names)
+	}
+	addr, err := n.Stack.GetMainNICAddress(ethID, ipv4.ProtocolNumber)
+	if err != nil {
+		t.Fatalf("GetMainNICAddress(): %s", err)
+	}
+	if got := net.IP(addr.Address); !got.Equal(want) {
+		t.Errorf("eth0 address got: %v, want: %v", got, want)
+	}
+
+	// The loopback route comes first, followed by the new route only.
+	routes := n.Stack.GetRouteTable()
+	if len(routes) != 2 || routes[0].NIC != names["lo"] || routes[1].NIC != ethID {
+		t.Fatalf("GetRouteTable() = %+v, want the lo route followed by the eth0 route", routes)
+	}
+	if got := net.IP(routes[1].Destination.ID()); !got.Equal(want.Mask(net.CIDRMask(24, 32))) {
+		t.Errorf("eth0 route destination got: %v, want: %v", got, want.Mask(net.CIDRMask(24, 32)))
+	}
+
+	// Loopback links can't be replaced.
+	if err := n.replaceLinksAndRoutes(&CreateLinksAndRoutesArgs{LoopbackLinks: []LoopbackLink{lo}}); err == nil {
+		t.Errorf("replaceLinksAndRoutes() with loopback links succeeded, want error")
+	}
+}
+
+func TestCreateLinksAndRoutesLoopbackOnly(t *testing.T) {
+	n := &Network{
+		Stack: stack.New(stack.Options{
+			NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol},
+			TransportProtocols: []stack.TransportProtocolFactory{tcp.NewProtocol},
+		}),
+	}
+	defer n.Stack.Close()
+
+	// Other links can't be combined with LoopbackOnly.
+	if err := n.CreateLinksAndRoutes(&CreateLinksAndRoutesArgs{
+		LoopbackOnly:  true,
+		LoopbackLinks: []LoopbackLink{DefaultLoopbackLink},
+	}, nil); err == nil {
+		t.Errorf("CreateLinksAndRoutes() with LoopbackOnly and loopback links succeeded, want error")
+	}
+
+	if err := n.CreateLinksAndRoutes(&CreateLinksAndRoutesArgs{LoopbackOnly: true}, nil); err != nil {
+		t.Fatalf("CreateLinksAndRoutes(): %v", err)
+	}
+	nics := n.Stack.NICInfo()
+	if len(nics) != 1 {
+		t.Fatalf("NICInfo() = %+v, want lo only", nics)
+	}
+	for _, info := range nics {
+		if info.Name != "lo" || !info.Flags.Loopback {
+			t.Errorf("NICInfo() = %+v, want lo only", nics)
+		}
+	}
+	if routes := n.Stack.GetRouteTable(); len(routes) != len(DefaultLoopbackLink.Routes) {
+		t.Errorf("GetRouteTable() = %+v, want the routes of DefaultLoopbackLink", routes)
+	}
+
+	// Processes can bind and connect to localhost.
+	for _, tc := range []struct {
+		addr  net.IP
+		proto tcpip.NetworkProtocolNumber
+	}{
+		{addr: net.IPv4(127, 0, 0, 1).To4(), proto: ipv4.ProtocolNumber},
+		{addr: net.IPv6loopback, proto: ipv6.ProtocolNumber},
+	} {
+		addr := tcpip.FullAddress{Addr: tcpip.Address(tc.addr), Port: 8080}
+		l, err := gonet.ListenTCP(n.Stack, addr, tc.proto)
+		if err != nil {
+			t.Fatalf("ListenTCP(%s): %v", tc.addr, err)
+		}
+		accepted := make(chan error, 1)
+		go func() {
+			c, err := l.Accept()
+			if err == nil {
+				_, err = c.Write([]byte("hello"))
+				c.Close()
+			}
+			accepted <- err
+		}()
+		c, err := gonet.DialTCP(n.Stack, addr, tc.proto)
+		if err != nil {
+			l.Close()
+			t.Fatalf("DialTCP(%s): %v", tc.addr, err)
+		}
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(c, buf); err != nil || string(buf) != "hello" {
+			t.Errorf("ReadFull() from %s = %q, %v, want: %q", tc.addr, buf, err, "hello")
+		}
+		c.Close()
+		if err := <-accepted; err != nil {
+			t.Errorf("accepting on %s: %v", tc.addr, err)
+		}
+		l.Close()
+	}
+}
+
+func TestAddDeleteRoute(t *testing.T) {
+	n := newTestNetwork()
+	defer n.Stack.Close()
+
+	if err := n.Stack.CreateNICWithOptions(1, channel.New(1, 1500, ""), stack.NICOptions{Name: "eth0"}); err != nil {
+		t.Fatalf("CreateNICWithOptions(): %s", err)
+	}
+	defaultRoute := Route{
+		Destination: net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)},
+		Gateway:     net.IPv4(10, 0, 0, 1).To4(),
+	}
+	if err := n.AddRoute(&RouteArgs{NIC: "eth0", Route: defaultRoute}, nil); err != nil {
+		t.Fatalf("AddRoute(default): %v", err)
+	}
+	route := Route{
+		Destination: net.IPNet{IP: net.IPv4(10, 1, 0, 0).To4(), Mask: net.CIDRMask(16, 32)},
+		Gateway:     net.IPv4(10, 0, 0, 2).To4(),
+	}
+	args := &RouteArgs{NIC: "eth0", Route: route}
+	if err := n.AddRoute(args, nil); err != nil {
+		t.Fatalf("AddRoute(%+v): %v", args, err)
+	}
+
+	// The more specific route is matched first.
+	routes := n.Stack.GetRouteTable()
+	if len(routes) != 2 || routes[0].Destination.Prefix() != 16 || routes[1].Destination.Prefix() != 0 {
+		t.Fatalf("GetRouteTable() = %+v, want the new route followed by the default route", routes)
+	}
+	if got := net.IP(routes[0].Gateway); !got.Equal(route.Gateway) || routes[0].NIC != 1 {
+		t.Errorf("GetRouteTable()[0] = %+v, want gateway %v on NIC 1", routes[0], route.Gateway)
+	}
+
+	for _, bad := range []*RouteArgs{
+		// Duplicate.
+		args,
+		// Unknown NIC.
+		{NIC: "eth1", Route: route},
+		// Gateway of another IP version.
+		{NIC: "eth0", Route: Route{Destination: route.Destination, Gateway: net.IPv6loopback}},
+		// Destination with bits outside of the mask.
+		{NIC: "eth0", Route: Route{Destination: net.IPNet{IP: net.IPv4(10, 1, 0, 1).To4(), Mask: net.CIDRMask(16, 32)}}},
+	} {
+		if err := n.AddRoute(bad, nil); err == nil {
+			t.Errorf("AddRoute(%+v) succeeded, want error", bad)
+		}
+	}
+	if got := len(n.Stack.GetRouteTable()); got != 2 {
+		t.Errorf("failed AddRoute calls changed the route table: %+v", n.Stack.GetRouteTable())
+	}
+
+	if err := n.DeleteRoute(args, nil); err != nil {
+		t.Fatalf("DeleteRoute(%+v): %v", args, err)
+	}
+	routes = n.Stack.GetRouteTable()
+	if len(routes) != 1 || routes[0].Destination.Prefix() != 0 {
+		t.Errorf("GetRouteTable() = %+v, want only the default route", routes)
+	}
+	if err := n.DeleteRoute(args, nil); err == nil {
+		t.Errorf("DeleteRoute(%+v) of a deleted route succeeded, want error", args)
+	}
+}
+
+func TestSetNICEnabled(t *testing.T) {
+	n := newTestNetwork()
+	defer n.Stack.Close()
+
+	ep := channel.New(1, 1500, "")
+	if err := n.createNICWithAddrs(1, ep, stack.NICOptions{Name: "eth0"}, []IPWithPrefix{{Address: net.IPv4(10, 0, 0, 1).To4(), PrefixLen: 24}}); err != nil {
+		t.Fatalf("createNICWithAddrs(): %v", err)
+	}
+	route := Route{Destination: net.IPNet{IP: net.IPv4(10, 0, 0, 0).To4(), Mask: net.CIDRMask(24, 32)}}
+	if err := n.AddRoute(&RouteArgs{NIC: "eth0", Route: route}, nil); err != nil {
+		t.Fatalf("AddRoute(): %v", err)
+	}
+
+	cid := ""
+	check := func(wantEnabled bool, wantRxPackets uint64) {
+		t.Helper()
+		// Connectivity follows the state of the interface.
+		r, err := n.Stack.FindRoute(0, "", tcpip.Address(net.IPv4(10, 0, 0, 2).To4()), ipv4.ProtocolNumber, false)
+		if r != nil {
+			r.Release()
+		}
+		if got := err == nil; got != wantEnabled {
+			t.Errorf("FindRoute() got error: %v, want success: %t", err, wantEnabled)
+		}
+		if got := n.Stack.CheckNIC(1); got != wantEnabled {
+			t.Errorf("CheckNIC() = %t, want: %t", got, wantEnabled)
+		}
+
+		// Received packets are only delivered while the interface is enabled.
+		pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+			Data: buffer.NewViewFromBytes([]byte{1, 2, 3, 4}).ToVectorisedView(),
+		})
+		ep.InjectInbound(0x1234, pkt)
+		pkt.DecRef()
+		var stats []NICStats
+		if err := n.Stats(&cid, &stats); err != nil {
+			t.Fatalf("Stats(): %v", err)
+		}
+		if len(stats) != 1 || stats[0].RxPackets != wantRxPackets {
+			t.Errorf("Stats() = %+v, want RxPackets: %d", stats, wantRxPackets)
+		}
+	}
+
+	check(true, 1)
+	if err := n.SetNICEnabled(&SetNICEnabledArgs{NIC: "eth0", Enabled: false}, nil); err != nil {
+		t.Fatalf("SetNICEnabled(false): %v", err)
+	}
+	check(false, 1)
+	if err := n.SetNICEnabled(&SetNICEnabledArgs{NIC: "eth0", Enabled: true}, nil); err != nil {
+		t.Fatalf("SetNICEnabled(true): %v", err)
+	}
+	check(true, 2)
+
+	if err := n.SetNICEnabled(&SetNICEnabledArgs{NIC: "eth1"}, nil); err == nil {
+		t.Errorf("SetNICEnabled() of an unknown interface succeeded, want error")
+	}
+}
+
+func TestAddRemoveAddress(t *testing.T) {
+	n := &Network{
+		Stack: stack.New(stack.Options{
+			NetworkProtocols: []stack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol},
+		}),
+	}
+	defer n.Stack.Close()
+
+	ep := channel.New(1, 1500, "")
+	if err := n.createNICWithAddrs(1, ep, stack.NICOptions{Name: "eth0"}, nil); err != nil {
+		t.Fatalf("createNICWithAddrs(): %v", err)
+	}
+	primary := IPWithPrefix{Address: net.IPv4(10, 0, 0, 1).To4(), PrefixLen: 24}
+	secondary := IPWithPrefix{Address: net.IPv4(10, 0, 0, 2).To4(), PrefixLen: 24}
+	v6 := IPWithPrefix{Address: net.ParseIP("fd00::1"), PrefixLen: 64}
+	for _, addr := range []IPWithPrefix{primary, secondary, v6} {
+		if err := n.AddAddress(&AddressArgs{NIC: "eth0", Address: addr}, nil); err != nil {
+			t.Fatalf("AddAddress(%s): %v", addr, err)
+		}
+	}
+	if err := n.AddAddress(&AddressArgs{NIC: "eth0", Address: primary}, nil); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("AddAddress(%s) again got error: %v, want already exists error", primary, err)
+	}
+	for _, args := range []AddressArgs{
+		{NIC: "eth0", Address: IPWithPrefix{Address: net.IPv4(10, 0, 0, 3).To4(), PrefixLen: 33}},
+		{NIC: "eth1", Address: IPWithPrefix{Address: net.IPv4(10, 0, 0, 3).To4(), PrefixLen: 24}},
+	} {
+		if err := n.AddAddress(&args, nil); err == nil {
+			t.Errorf("AddAddress(%+v) succeeded, want error", args)
+		}
+	}
+
+	checkPrimary := func(want IPWithPrefix) {
+		t.Helper()
+		got, err := n.Stack.GetMainNICAddress(1, ipv4.ProtocolNumber)
+		if err != nil {
+			t.Fatalf("GetMainNICAddress(): %s", err)
+		}
+		if got.Address != tcpip.Address(want.Address) || got.PrefixLen != want.PrefixLen {
+			t.Errorf("GetMainNICAddress() = %s, want: %s", got, want)
+		}
+	}
+	checkPrimary(primary)
+
+	// The address must match, including its prefix length.
+	for _, addr := range []IPWithPrefix{
+		{Address: primary.Address, PrefixLen: 16},
+		{Address: net.IPv4(10, 0, 0, 3).To4(), PrefixLen: 24},
+	} {
+		if err := n.RemoveAddress(&AddressArgs{NIC: "eth0", Address: addr}, nil); err == nil {
+			t.Errorf("RemoveAddress(%s) succeeded, want error", addr)
+		}
+	}
+
+	// Removing the primary address promotes the secondary one.
+	if err := n.RemoveAddress(&AddressArgs{NIC: "eth0", Address: primary}, nil); err != nil {
+		t.Fatalf("RemoveAddress(%s): %v", primary, err)
+	}
+	checkPrimary(secondary)
+	if err := n.RemoveAddress(&AddressArgs{NIC: "eth0", Address: primary}, nil); err == nil {
+		t.Errorf("RemoveAddress(%s) again succeeded, want error", primary)
+	}
+
+	if err := n.RemoveAddress(&AddressArgs{NIC: "eth0", Address: v6}, nil); err != nil {
+		t.Fatalf("RemoveAddress(%s): %v", v6, err)
+	}
+	want := []tcpip.ProtocolAddress{{
+		Protocol: ipv4.ProtocolNumber,
+		AddressWithPrefix: tcpip.AddressWithPrefix{
+			Address:   tcpip.Address(secondary.Address),
+			PrefixLen: secondary.PrefixLen,
+		},
+	}}
+	if got := n.Stack.AllAddresses()[1]; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("AllAddresses()[1] = %+v, want: %+v", got, want)
+	}
+}
+
+func TestSetMTU(t *testing.T) {
+	n := newTestNetwork()
+	defer n.Stack.Close()
+
+	addr := IPWithPrefix{Address: net.IPv4(10, 0, 0, 1).To4(), PrefixLen: 24}
+	args := &CreateLinksAndRoutesArgs{
+		FilePayload: urpc.FilePayload{Files: []*os.File{linkFile(t)}},
+		LoopbackLinks: []LoopbackLink{{
+			Name:      "lo",
+			Addresses: []IPWithPrefix{{Address: net.IPv4(127, 0, 0, 1).To4(), PrefixLen: 8}},
+		}},
+		FDBasedLinks: []FDBasedLink{{
+			Name:        "eth0",
+			MTU:         1500,
+			Addresses:   []IPWithPrefix{addr},
+			NumChannels: 1,
+			Routes: []Route{{
+				Destination: net.IPNet{IP: net.IPv4(10, 0, 0, 0).To4(), Mask: net.CIDRMask(24, 32)},
+			}},
+		}},
+	}
+	if err := n.CreateLinksAndRoutes(args, nil); err != nil {
+		t.Fatalf("CreateLinksAndRoutes(): %v", err)
+	}
+	id, err := nicByName(n.Stack, "eth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(want uint32) {
+		t.Helper()
+		if got := n.Stack.NICInfo()[id].MTU; got != want {
+			t.Errorf("NICInfo()[%d].MTU = %d, want: %d", id, got, want)
+		}
+		// Routes use the new MTU without recreating the interface.
+		r, err := n.Stack.FindRoute(0, "", tcpip.Address(net.IPv4(10, 0, 0, 2).To4()), ipv4.ProtocolNumber, false)
+		if err != nil {
+			t.Fatalf("FindRoute(): %s", err)
+		}
+		defer r.Release()
+		if got, want := r.MTU(), want-header.IPv4MinimumSize; got != want {
+			t.Errorf("route MTU = %d, want: %d", got, want)
+		}
+	}
+	check(1500)
+
+	// IPv4 allows an MTU smaller than the IPv6 minimum.
+	for _, mtu := range []uint32{1400, 1000} {
+		if err := n.SetMTU(&SetMTUArgs{NIC: "eth0", MTU: mtu}, nil); err != nil {
+			t.Fatalf("SetMTU(%d): %v", mtu, err)
+		}
+		check(mtu)
+	}
+	if got := n.links.FDBasedLinks[0].MTU; got != 1000 {
+		t.Errorf("saved MTU = %d, want: 1000", got)
+	}
+	if got := args.FDBasedLinks[0].MTU; got != 1500 {
+		t.Errorf("SetMTU() changed the MTU in the arguments of CreateLinksAndRoutes to %d", got)
+	}
+
+	for _, args := range []SetMTUArgs{
+		{NIC: "eth0", MTU: 67},
+		{NIC: "eth0", MTU: 65536},
+		{NIC: "lo", MTU: 1500},
+		{NIC: "eth1", MTU: 1500},
+	} {
+		if err := n.SetMTU(&args, nil); err == nil {
+			t.Errorf("SetMTU(%+v) succeeded, want error", args)
+		}
+	}
+	check(1000)
+
+	// Links with IPv6 addresses require the IPv6 minimum MTU.
+	v6 := &CreateLinksAndRoutesArgs{
+		FilePayload: urpc.FilePayload{Files: []*os.File{linkFile(t)}},
+		FDBasedLinks: []FDBasedLink{{
+			Name:        "eth1",
+			MTU:         1000,
+			Addresses:   []IPWithPrefix{{Address: net.ParseIP("fd00::1"), PrefixLen: 64}},
+			NumChannels: 1,
+		}},
+	}
+	if err := n.createLinksAndRoutes(v6, false /* disabled */); err == nil {
+		t.Errorf("createLinksAndRoutes() with MTU 1000 and an IPv6 address succeeded, want error")
+	}
+}
+
+func TestListInterfacesAndRoutes(t *testing.T) {
+	n := &Network{
+		Stack: stack.New(stack.Options{
+			NetworkProtocols: []stack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol},
+		}),
+	}
+	defer n.Stack.Close()
+
+	mac := net.HardwareAddr{0x02, 0, 0, 0, 0, 1}
+	v4 := IPWithPrefix{Address: net.IPv4(10, 0, 0, 1).To4(), PrefixLen: 24}
+	v6 := IPWithPrefix{Address: net.ParseIP("fd00::1"), PrefixLen: 64}
+	ep := channel.New(1, 1500, tcpip.LinkAddress(mac))
+	if err := n.createNICWithAddrs(1, ep, stack.NICOptions{Name: "eth0"}, []IPWithPrefix{v4, v6}); err != nil {
+		t.Fatalf("createNICWithAddrs(): %v", err)
+	}
+	gw := net.IPv4(10, 0, 0, 254).To4()
+	for _, r := range []Route{
+		{Destination: net.IPNet{IP: net.IPv4(10, 0, 0, 0).To4(), Mask: net.CIDRMask(24, 32)}},
+		{Destination: net.IPNet{IP: net.ParseIP("fd00::"), Mask: net.CIDRMask(64, 128)}},
+		{Destination: net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}, Gateway: gw},
+	} {
+		if err := n.AddRoute(&RouteArgs{NIC: "eth0", Route: r}, nil); err != nil {
+			t.Fatalf("AddRoute(%+v): %v", r, err)
+		}
+	}
+
+	cid := ""
+	var ifaces []Interface
+	if err := n.ListInterfaces(&cid, &ifaces); err != nil {
+		t.Fatalf("ListInterfaces(): %v", err)
+	}
+	if len(ifaces) != 1 {
+		t.Fatalf("ListInterfaces() = %+v, want eth0 only", ifaces)
+	}
+	iface := ifaces[0]
+	if iface.ID != 1 || iface.Name != "eth0" || iface.MTU != 1500 || !iface.Enabled || iface.Loopback || iface.LinkAddress.String() != mac.String() {
+		t.Errorf("ListInterfaces() = %+v, want enabled eth0 with ID 1, MTU 1500 and link address %v", iface, mac)
+	}
+	got := make(map[string]bool)
+	for _, addr := range iface.Addresses {
+		got[addr.String()] = true
+	}
+	for _, want := range []IPWithPrefix{v4, v6} {
+		if !got[want.String()] {
+			t.Errorf("ListInterfaces() addresses = %v, want %v", iface.Addresses, want)
+		}
+	}
+
+	var routes []RouteEntry
+	if err := n.ListRoutes(&cid, &routes); err != nil {
+		t.Fatalf("ListRoutes(): %v", err)
+	}
+	var gotRoutes []string
+	for _, r := range routes {
+		route := fmt.Sprintf("%s nic %s", &r.Route.Destination, r.NIC)
+		if r.Route.Gateway != nil {
+			route += fmt.Sprintf(" via %s", r.Route.Gateway)
+		}
+		gotRoutes = append(gotRoutes, route)
+	}
+	wantRoutes := []string{
+		"fd00::/64 nic eth0",
+		"10.0.0.0/24 nic eth0",
+		"0.0.0.0/0 nic eth0 via 10.0.0.254",
+	}
+	if strings.Join(gotRoutes, ", ") != strings.Join(wantRoutes, ", ") {
+		t.Errorf("ListRoutes() = %v, want: %v", gotRoutes, wantRoutes)
+	}
+}
+
+// TestCreateLinksAndRoutesIPv6 pings an IPv6 host through the default route of
+// a dual-stack link.
+func TestCreateLinksAndRoutesIPv6(t *testing.T) {
+	n := &Network{
+		Stack: stack.New(stack.Options{
+			NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol},
+			TransportProtocols: []stack.TransportProtocolFactory{icmp.NewProtocol6},
+		}),
+	}
+	defer n.Stack.Close()
+
+	local := net.ParseIP("fd00::2")
+	subnet := func(ip string, prefix int) net.IPNet {
+		_, ipNet, err := net.ParseCIDR(fmt.Sprintf("%s/%d", ip, prefix))
+		if err != nil {
+			t.Fatalf("ParseCIDR(): %v", err)
+		}
+		return *ipNet
+	}
+	linkEnd, peer := linkFilePair(t)
+	args := &CreateLinksAndRoutesArgs{
+		FilePayload: urpc.FilePayload{Files: []*os.File{linkEnd}},
+		FDBasedLinks: []FDBasedLink{{
+			Name: "eth0",
+			MTU:  1500,
+			Addresses: []IPWithPrefix{
+				{Address: net.IPv4(10, 0, 0, 2).To4(), PrefixLen: 24},
+				{Address: local, PrefixLen: 64},
+				{Address: net.ParseIP("fe80::2"), PrefixLen: 64},
+			},
+			Routes: []Route{
+				{Destination: subnet("10.0.0.0", 24)},
+				{Destination: subnet("fd00::", 64)},
+				{Destination: subnet("fe80::", 64)},
+			},
+			NumChannels: 1,
+		}},
+		// The destination is implied by the gateway.
+		Defaultv6Gateway: DefaultRoute{
+			Name:  "eth0",
+			Route: Route{Gateway: net.ParseIP("fd00::1")},
+		},
+	}
+	if err := n.CreateLinksAndRoutes(args, nil); err != nil {
+		t.Fatalf("CreateLinksAndRoutes(): %v", err)
+	}
+
+	routes := n.Stack.GetRouteTable()
+	if len(routes) != 4 {
+		t.Fatalf("GetRouteTable() = %+v, want 3 link routes and the default route", routes)
+	}
+	if def := routes[3]; def.Destination.Prefix() != 0 || len(def.Destination.ID()) != net.IPv6len {
+		t.Errorf("default route = %s, want ::/0", def)
+	}
+
+	// Ping a host that is only reachable through the default route.
+	remote := net.ParseIP("2001:db8::1")
+	var wq waiter.Queue
+	we, ch := waiter.NewChannelEntry(waiter.ReadableEvents)
+	wq.EventRegister(&we)
+	defer wq.EventUnregister(&we)
+	ep, err := n.Stack.NewEndpoint(icmp.ProtocolNumber6, ipv6.ProtocolNumber, &wq)
+	if err != nil {
+		t.Fatalf("NewEndpoint(): %s", err)
+	}
+	defer ep.Close()
+	if err := ep.Connect(tcpip.FullAddress{Addr: tcpip.Address(remote)}); err != nil {
+		t.Fatalf("Connect(%s): %s", remote, err)
+	}
+	request := header.ICMPv6(make([]byte, header.ICMPv6EchoMinimumSize))
+	request.SetType(header.ICMPv6EchoRequest)
+	request.SetSequence(1)
+	var r bytes.Reader
+	r.Reset(request)
+	if _, err := ep.Write(&r, tcpip.WriteOptions{}); err != nil {
+		t.Fatalf("Write(): %s", err)
+	}
+
+	// The request is sent on the link, from the global address. Skip other
+	// packets, e.g. router solicitations.
+	buf := make([]byte, 1500)
+	var (
+		pkt  header.IPv6
+		echo header.ICMPv6
+		nr   int
+	)
+	for {
+		var err error
+		nr, err = unix.Read(peer, buf)
+		if err != nil {
+			t.Fatalf("reading the link: %v", err)
+		}
+		pkt = header.IPv6(buf[:nr])
+		if !pkt.IsValid(nr) {
+			t.Fatalf("sent packet isn't IPv6: %x", buf[:nr])
+		}
+		echo = header.ICMPv6(pkt.Payload())
+		if pkt.TransportProtocol() == header.ICMPv6ProtocolNumber && len(echo) >= header.ICMPv6EchoMinimumSize && echo.Type() == header.ICMPv6EchoRequest {
+			break
+		}
+	}
+	if got := net.IP(pkt.DestinationAddress()); !got.Equal(remote) {
+		t.Errorf("sent packet destination got: %v, want: %v", got, remote)
+	}
+	if got := net.IP(pkt.SourceAddress()); !got.Equal(local) {
+		t.Errorf("sent packet source got: %v, want: %v", got, local)
+	}
+
+	// Reply to it.
+	src, dst := pkt.SourceAddress(), pkt.DestinationAddress()
+	pkt.SetSourceAddress(dst)
+	pkt.SetDestinationAddress(src)
+	echo.SetType(header.ICMPv6EchoReply)
+	echo.SetChecksum(header.ICMPv6Checksum(header.ICMPv6ChecksumParams{
+		Header:      echo[:header.ICMPv6EchoMinimumSize],
+		Src:         dst,
+		Dst:         src,
+		PayloadCsum: header.Checksum(echo[header.ICMPv6EchoMinimumSize:], 0),
+		PayloadLen:  len(echo) - header.ICMPv6EchoMinimumSize,
+	}))
+	if _, err := unix.Write(peer, buf[:nr]); err != nil {
+		t.Fatalf("writing the link: %v", err)
+	}
+
+	select {
+	case <-ch:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timed out waiting for the echo reply")
+	}
+	var reply bytes.Buffer
+	if _, err := ep.Read(&reply, tcpip.ReadOptions{}); err != nil {
+		t.Fatalf("Read(): %s", err)
+	}
+	if got := header.ICMPv6(reply.Bytes()); len(got) < header.ICMPv6EchoMinimumSize || got.Type() != header.ICMPv6EchoReply || got.Sequence() != 1 {
+		t.Errorf("Read() = %x, want an echo reply with sequence 1", reply.Bytes())
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"time"
+
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/eventfd"
+	"gvisor.dev/gvisor/pkg/sentry/fsimpl/timerfd"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	ktime "gvisor.dev/gvisor/pkg/sentry/kernel/time"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// PollObjects describes the event notification objects open in a process.
+// Objects are sorted by file descriptor number.
+type PollObjects struct {
+	Epolls   []EpollObject   `json:"epolls"`
+	EventFDs []EventFDObject `json:"eventfds"`
+	TimerFDs []TimerFDObject `json:"timerfds"`
+}
+
+// EpollObject describes an epoll instance and the file descriptors it
+// watches.
+type EpollObject struct {
+	// FD is the file descriptor of the epoll instance.
+	FD int32 `json:"fd"`
+
+	// Interests are the watched file descriptors, as registered with
+	// epoll_ctl(2).
+	Interests []vfs.EpollInterestInfo `json:"interests"`
+}
+
+// EventFDObject describes an eventfd.
+type EventFDObject struct {
+	// FD is the file descriptor of the eventfd.
+	FD int32 `json:"fd"`
+
+	eventfd.Info
+}
+
+// TimerFDObject describes a timerfd.
+type TimerFDObject struct {
+	// FD is the file descriptor of the timerfd.
+	FD int32 `json:"fd"`
+
+	// Clock is the clock measuring the timer: "realtime" or "monotonic".
+	Clock string `json:"clock"`
+
+	// Value is the time until the next expiration, or 0 if the timer is
+	// disarmed.
+	Value time.Duration `json:"value"`
+
+	// Interval is the period of the timer, or 0 if it only expires once.
+	Interval time.Duration `json:"interval"`
+
+	// Expirations is the number of expirations that haven't been read yet.
+	Expirations uint64 `json:"expirations"`
+}
+
+// pollObjects returns the epoll instances, eventfds and timerfds open in
+// process pid of container cid.
+func (l *Loader) pollObjects(cid string, pid kernel.ThreadID) (PollObjects, error) {
+	if !l.root.conf.VFS2 {
+		return PollObjects{}, fmt.Errorf("poll objects are only accessible with VFS2")
+	}
+	leader, err := l.processLeader(cid, pid)
+	if err != nil {
+		return PollObjects{}, err
+	}
+
+	ctx := l.k.SupervisorContext()
+	var (
+		fds   []int32
+		files []*vfs.FileDescription
+	)
+	leader.WithMuLocked(func(t *kernel.Task) {
+		fdTable := t.FDTable()
+		if fdTable == nil {
+			return
+		}
+		for _, fd := range fdTable.GetFDs(ctx) {
+			if file, _ := fdTable.GetVFS2(fd); file != nil {
+				fds = append(fds, fd)
+				files = append(files, file)
+			}
+		}
+	})
+	defer func() {
+		for _, file := range files {
+			file.DecRef(ctx)
+		}
+	}()
+
+	objs := PollObjects{
+		Epolls:   []EpollObject{},
+		EventFDs: []EventFDObject{},
+		TimerFDs: []TimerFDObject{},
+	}
+	for i, file := range files {
+		switch impl := file.Impl().(type) {
+		case *vfs.EpollInstance:
+			objs.Epolls = append(objs.Epolls, EpollObject{
+				FD:        fds[i],
+				Interests: impl.Interests(),
+			})
+		case *eventfd.EventFileDescription:
+			objs.EventFDs = append(objs.EventFDs, EventFDObject{
+				FD:   fds[i],
+				Info: impl.Info(),
+			})
+		case *timerfd.TimerFileDescription:
+			now, setting := impl.GetTime()
+			value, interval := ktime.SpecFromSetting(now, setting)
+			clock := "monotonic"
+			if impl.Clock() == l.k.RealtimeClock() {
+				clock = "realtime"
+			}
+			objs.TimerFDs = append(objs.TimerFDs, TimerFDObject{
+				FD:          fds[i],
+				Clock:       clock,
+				Value:       value,
+				Interval:    interval,
+				Expirations: impl.Expirations(),
+			})
+		}
+	}
+	return objs, nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+)
+
+// PrivilegeState is the state of the privilege-escalation protections of a
+// process.
+type PrivilegeState struct {
+	// NoNewPrivs is the process' no_new_privs bit, as returned by
+	// prctl(PR_GET_NO_NEW_PRIVS).
+	NoNewPrivs bool `json:"noNewPrivs"`
+
+	// Securebits is the process' securebits, see linux.SECBIT_*.
+	Securebits uint32 `json:"securebits"`
+}
+
+// privilegeState returns the privilege state of process pid in container cid.
+// If pid is 0, the container's init process is used.
+func (l *Loader) privilegeState(cid string, pid kernel.ThreadID) (PrivilegeState, error) {
+	var leader *kernel.Task
+	if pid == 0 {
+		tg, err := l.threadGroupFromID(execID{cid: cid})
+		if err != nil {
+			return PrivilegeState{}, err
+		}
+		if leader = tg.Leader(); leader == nil {
+			return PrivilegeState{}, fmt.Errorf("container %q init process has exited", cid)
+		}
+	} else {
+		var err error
+		if leader, err = l.processLeader(cid, pid); err != nil {
+			return PrivilegeState{}, err
+		}
+	}
+
+	creds := leader.Credentials()
+	state := PrivilegeState{
+		NoNewPrivs: leader.NoNewPrivs(),
+	}
+	// KeepCaps is the only securebit tracked by the sentry.
+	if creds.KeepCaps {
+		state.Securebits |= linux.SECBIT_KEEP_CAPS
+	}
+	return state, nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+	"gvisor.dev/gvisor/pkg/urpc"
+)
+
+// SchedPolicy is the scheduling policy of a process.
+type SchedPolicy struct {
+	// Policy is the scheduling policy, e.g. linux.SCHED_NORMAL.
+	Policy int32 `json:"policy"`
+
+	// Priority is the static scheduling priority. It must be 0 for
+	// non-real-time policies, and between 1 and 99 for real-time ones.
+	Priority int32 `json:"priority"`
+}
+
+// schedPolicy returns the scheduling policy of process pid in container cid.
+// The sentry scheduler doesn't support scheduling policies, so all tasks run
+// with SCHED_NORMAL, consistently with sched_getscheduler(2).
+func (l *Loader) schedPolicy(cid string, pid kernel.ThreadID) (SchedPolicy, error) {
+	if _, err := l.processLeader(cid, pid); err != nil {
+		return SchedPolicy{}, err
+	}
+	return SchedPolicy{Policy: linux.SCHED_NORMAL}, nil
+}
+
+// setSchedPolicy sets the scheduling policy of process pid in container cid.
+// Real-time policies require the process to have CAP_SYS_NICE, like
+// sched_setscheduler(2).
+//
+// The sentry scheduler runs all tasks with SCHED_NORMAL, leaving them to the
+// Go runtime scheduler, which has no notion of priorities. Setting
+// SCHED_NORMAL is thus a no-op, and other valid policies fail with
+// ErrCodeUnimplemented.
+func (l *Loader) setSchedPolicy(cid string, pid kernel.ThreadID, policy SchedPolicy) error {
+	leader, err := l.processLeader(cid, pid)
+	if err != nil {
+		return err
+	}
+
+	switch policy.Policy {
+	case linux.SCHED_NORMAL, linux.SCHED_BATCH, linux.SCHED_IDLE:
+		if policy.Priority != 0 {
+			return invalidArgf("priority must be 0 for non-real-time policies, got %d", policy.Priority)
+		}
+	case linux.SCHED_FIFO, linux.SCHED_RR:
+		if policy.Priority < 1 || policy.Priority > 99 {
+			return invalidArgf("priority must be between 1 and 99 for real-time policies, got %d", policy.Priority)
+		}
+		if !leader.Credentials().HasCapability(linux.CAP_SYS_NICE) {
+			return urpc.WithCode(ErrCodeFailedPrecondition, fmt.Errorf("process %d doesn't have CAP_SYS_NICE, required for real-time policies", pid))
+		}
+	default:
+		return invalidArgf("invalid scheduling policy %d", policy.Policy)
+	}
+
+	if policy.Policy != linux.SCHED_NORMAL {
+		return urpc.WithCode(ErrCodeUnimplemented, fmt.Errorf("scheduling policy %d is not supported by the sentry scheduler, only SCHED_NORMAL is", policy.Policy))
+	}
+	return nil
+}
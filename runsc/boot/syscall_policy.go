@@ -0,0 +1,81 @@
+// Copyright 2018 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"gvisor.dev/gvisor/pkg/sentry/kernel"
+)
+
+const (
+	// SyscallAllowAnnotation is the annotation used to restrict the syscalls
+	// that a container may invoke. Its value is a comma separated list of
+	// syscall names, other syscalls fail with ENOSYS.
+	SyscallAllowAnnotation = "dev.gvisor.spec.syscalls.allow"
+
+	// SyscallDenyAnnotation is the annotation used to prevent a container from
+	// invoking some syscalls. Its value is a comma separated list of syscall
+	// names, which fail with EPERM.
+	SyscallDenyAnnotation = "dev.gvisor.spec.syscalls.deny"
+)
+
+// SyscallPolicy is a declarative list of syscalls that a container may or may
+// not invoke, see kernel.SyscallPolicy.
+type SyscallPolicy struct {
+	// Allow indicates that Syscalls is an allow list: syscalls not listed
+	// fail with ENOSYS. Otherwise, Syscalls is a deny list: syscalls listed
+	// fail with EPERM.
+	Allow bool `json:"allow"`
+
+	// Syscalls contains syscall names, e.g. "mkdir".
+	Syscalls []string `json:"syscalls"`
+}
+
+// kernelPolicy returns p as a kernel.SyscallPolicy.
+func (p *SyscallPolicy) kernelPolicy() kernel.SyscallPolicy {
+	return kernel.SyscallPolicy{
+		Allow:    p.Allow,
+		Syscalls: p.Syscalls,
+	}
+}
+
+// SyscallPolicyFromSpec returns the syscall policy requested by the spec
+// annotations, or nil if there is none.
+func SyscallPolicyFromSpec(spec *specs.Spec) (*SyscallPolicy, error) {
+	allow, hasAllow := spec.Annotations[SyscallAllowAnnotation]
+	deny, hasDeny := spec.Annotations[SyscallDenyAnnotation]
+	switch {
+	case hasAllow && hasDeny:
+		return nil, fmt.Errorf("annotations %q and %q are mutually exclusive", SyscallAllowAnnotation, SyscallDenyAnnotation)
+	case hasAllow:
+		return &SyscallPolicy{Allow: true, Syscalls: splitSyscalls(allow)}, nil
+	case hasDeny:
+		return &SyscallPolicy{Syscalls: splitSyscalls(deny)}, nil
+	}
+	return nil, nil
+}
+
+func splitSyscalls(val string) []string {
+	var names []string
+	for _, name := range strings.Split(val, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
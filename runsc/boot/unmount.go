@@ -0,0 +1,87 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/fspath"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// mountNamespaceContext is a context that resolves vfs.CtxMountNamespace to a
+// given mount namespace, instead of the global init's one.
+type mountNamespaceContext struct {
+	context.Context
+	mntns *vfs.MountNamespace
+}
+
+// Value implements context.Context.Value.
+func (ctx *mountNamespaceContext) Value(key interface{}) interface{} {
+	if key == vfs.CtxMountNamespace {
+		ctx.mntns.IncRef()
+		return ctx.mntns
+	}
+	return ctx.Context.Value(key)
+}
+
+// forceUnmount lazily unmounts the mount at target in container cid's mount
+// namespace, like umount2(target, MNT_DETACH). The mount is detached right
+// away and released once it's no longer in use, so this succeeds even if the
+// mount is stuck, e.g. because its gofer died. It fails if target isn't a
+// mount point or is the container's root.
+func (l *Loader) forceUnmount(cid, target string) error {
+	ctx := l.k.SupervisorContext()
+	if !l.root.conf.VFS2 {
+		tg, err := l.threadGroupFromID(execID{cid: cid})
+		if err != nil {
+			return err
+		}
+		leader := tg.Leader()
+		if leader == nil {
+			return fmt.Errorf("container %q init process has exited", cid)
+		}
+		mns := leader.MountNamespace()
+		if mns == nil || !mns.TryIncRef() {
+			return fmt.Errorf("container %q init process has exited", cid)
+		}
+		defer mns.DecRef(ctx)
+		return forceUnmountVFS1(ctx, mns, target)
+	}
+
+	mntns, err := l.containerMountNamespace(cid)
+	if err != nil {
+		return err
+	}
+	defer mntns.DecRef(ctx)
+
+	root := mntns.Root()
+	root.IncRef()
+	defer root.DecRef(ctx)
+	pop := vfs.PathOperation{
+		Root:  root,
+		Start: root,
+		Path:  fspath.Parse(target),
+	}
+	creds := auth.NewRootCredentials(l.k.RootUserNamespace())
+	mntCtx := &mountNamespaceContext{Context: ctx, mntns: mntns}
+	if err := l.k.VFS().UmountAt(mntCtx, creds, &pop, &vfs.UmountOptions{Flags: linux.MNT_DETACH}); err != nil {
+		return fmt.Errorf("unmounting %q: %w", target, err)
+	}
+	return nil
+}
@@ -842,3 +842,48 @@ func (c *containerMounter) configureRestore(ctx context.Context) (context.Contex
 	}
 	return context.WithValue(ctx, gofer.CtxRestoreServerFDMap, fdmap), nil
 }
+
+// containerMountNamespace returns the VFS2 mount namespace of container cid's
+// init process. A reference is taken on the returned mount namespace.
+func (l *Loader) containerMountNamespace(cid string) (*vfs.MountNamespace, error) {
+	tg, err := l.threadGroupFromID(execID{cid: cid})
+	if err != nil {
+		return nil, err
+	}
+	leader := tg.Leader()
+	if leader == nil {
+		return nil, fmt.Errorf("container %q init process has exited", cid)
+	}
+	// The mount namespace is released when the init process exits, which may
+	// race with this.
+	mntns := leader.MountNamespaceVFS2()
+	if mntns == nil || !mntns.TryIncRef() {
+		return nil, fmt.Errorf("container %q init process has exited", cid)
+	}
+	return mntns, nil
+}
+
+// withWritableLayer calls fn with the tmpfs filesystem that holds the changes
+// made to container cid's root filesystem, i.e. the upper layer of the root
+// overlay.
+func (l *Loader) withWritableLayer(cid string, fn func(upper *vfs.Filesystem) error) error {
+	if !l.root.conf.VFS2 {
+		return fmt.Errorf("the writable layer is only accessible with VFS2")
+	}
+	mntns, err := l.containerMountNamespace(cid)
+	if err != nil {
+		return err
+	}
+	ctx := l.k.SupervisorContext()
+	defer mntns.DecRef(ctx)
+
+	root := mntns.Root()
+	root.IncRef()
+	defer root.DecRef(ctx)
+
+	upper := overlay.UpperFilesystem(root.Mount().Filesystem())
+	if upper == nil {
+		return fmt.Errorf("container %q root filesystem has no writable layer, it requires --overlay and a writable root", cid)
+	}
+	return fn(upper)
+}
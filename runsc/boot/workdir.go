@@ -0,0 +1,96 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/abi/linux"
+	"gvisor.dev/gvisor/pkg/context"
+	"gvisor.dev/gvisor/pkg/errors/linuxerr"
+	"gvisor.dev/gvisor/pkg/fspath"
+	"gvisor.dev/gvisor/pkg/sentry/fs"
+	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/vfs"
+)
+
+// cleanWorkingDirectory returns the absolute, clean form of the working
+// directory wd of a process, which is relative to the container root if it's
+// not absolute. It fails if wd has ".." components that go above the root,
+// e.g. "/../etc", which path resolution would silently turn into "/etc".
+func cleanWorkingDirectory(wd string) (string, error) {
+	depth := 0
+	for _, c := range strings.Split(wd, "/") {
+		switch c {
+		case "", ".":
+		case "..":
+			depth--
+			if depth < 0 {
+				return "", fmt.Errorf("working directory %q escapes the container root", wd)
+			}
+		default:
+			depth++
+		}
+	}
+	return path.Clean("/" + wd), nil
+}
+
+// workingDirectoryError turns the error of looking up the working directory
+// wd into one that says what's wrong with it.
+func workingDirectoryError(wd string, err error) error {
+	switch {
+	case linuxerr.Equals(linuxerr.ENOENT, err):
+		return fmt.Errorf("working directory %q: no such directory", wd)
+	case linuxerr.Equals(linuxerr.ENOTDIR, err):
+		return fmt.Errorf("working directory %q: not a directory", wd)
+	}
+	return fmt.Errorf("working directory %q: %w", wd, err)
+}
+
+// checkWorkingDirectoryVFS2 checks that wd is a directory in mns. Permissions
+// are left for the process to check, as ctx may have other credentials.
+func checkWorkingDirectoryVFS2(ctx context.Context, vfsObj *vfs.VirtualFilesystem, mns *vfs.MountNamespace, wd string) error {
+	root := mns.Root()
+	pop := vfs.PathOperation{
+		Root:               root,
+		Start:              root,
+		Path:               fspath.Parse(wd),
+		FollowFinalSymlink: true,
+	}
+	stat, err := vfsObj.StatAt(ctx, auth.CredentialsFromContext(ctx), &pop, &vfs.StatOptions{Mask: linux.STATX_TYPE})
+	if err != nil {
+		return workingDirectoryError(wd, err)
+	}
+	if linux.FileMode(stat.Mode).FileType() != linux.ModeDirectory {
+		return workingDirectoryError(wd, linuxerr.ENOTDIR)
+	}
+	return nil
+}
+
+// checkWorkingDirectory checks that wd is a directory in mns.
+func checkWorkingDirectory(ctx context.Context, mns *fs.MountNamespace, root *fs.Dirent, wd string) error {
+	maxTraversals := uint(linux.MaxSymlinkTraversals)
+	d, err := mns.FindInode(ctx, root, root, wd, &maxTraversals)
+	if err != nil {
+		return workingDirectoryError(wd, err)
+	}
+	defer d.DecRef(ctx)
+	if !fs.IsDir(d.Inode.StableAttr) {
+		return workingDirectoryError(wd, linuxerr.ENOTDIR)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2022 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"testing"
+)
+
+func TestCleanWorkingDirectory(t *testing.T) {
+	for _, tc := range []struct {
+		wd      string
+		want    string
+		wantErr bool
+	}{
+		{wd: "/", want: "/"},
+		{wd: "/tmp", want: "/tmp"},
+		{wd: "tmp/", want: "/tmp"},
+		{wd: "//usr/./lib/", want: "/usr/lib"},
+		{wd: "/usr/../tmp", want: "/tmp"},
+		{wd: "/usr/lib/../..", want: "/"},
+		{wd: "/..", wantErr: true},
+		{wd: "..", wantErr: true},
+		{wd: "/../etc", wantErr: true},
+		{wd: "/usr/../../etc", wantErr: true},
+	} {
+		got, err := cleanWorkingDirectory(tc.wd)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("cleanWorkingDirectory(%q) = %q, want error", tc.wd, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("cleanWorkingDirectory(%q) = %q, %v, want %q, nil", tc.wd, got, err, tc.want)
+		}
+	}
+}
@@ -46,6 +46,10 @@ type Boot struct {
 	// control server that is donated to this process.
 	controllerFD int
 
+	// controlTokenFD is the file descriptor to read the token that clients
+	// must send to the control server from. Valid if >= 0.
+	controlTokenFD int
+
 	// deviceFD is the file descriptor for the platform device file.
 	deviceFD int
 
@@ -101,6 +105,10 @@ type Boot struct {
 	// Valid if >= 0.
 	traceFD int
 
+	// readyFD is the file descriptor to notify once the loader has been created
+	// and the control server is serving. Valid if > 0.
+	readyFD int
+
 	// pidns is set if the sandbox is in its own pid namespace.
 	pidns bool
 
@@ -143,6 +151,7 @@ func (b *Boot) SetFlags(f *flag.FlagSet) {
 	// Open FDs that are donated to the sandbox.
 	f.IntVar(&b.specFD, "spec-fd", -1, "required fd with the container spec")
 	f.IntVar(&b.controllerFD, "controller-fd", -1, "required FD of a stream socket for the control server that must be donated to this process")
+	f.IntVar(&b.controlTokenFD, "control-token-fd", -1, "FD to read the token that clients must send to the control server from. -1 disables authentication.")
 	f.IntVar(&b.deviceFD, "device-fd", -1, "FD for the platform device file")
 	f.Var(&b.ioFDs, "io-fds", "list of FDs to connect 9P clients. They must follow this order: root first, then mounts as defined in the spec")
 	f.Var(&b.stdioFDs, "stdio-fds", "list of FDs containing sandbox stdin, stdout, and stderr in that order")
@@ -154,6 +163,7 @@ func (b *Boot) SetFlags(f *flag.FlagSet) {
 	f.IntVar(&b.profileHeapFD, "profile-heap-fd", -1, "file descriptor to write heap profile to. -1 disables profiling.")
 	f.IntVar(&b.profileMutexFD, "profile-mutex-fd", -1, "file descriptor to write mutex profile to. -1 disables profiling.")
 	f.IntVar(&b.traceFD, "trace-fd", -1, "file descriptor to write Go execution trace to. -1 disables tracing.")
+	f.IntVar(&b.readyFD, "ready-fd", 0, "file descriptor to notify once the control server is ready to accept requests. 0 disables notification.")
 }
 
 // Execute implements subcommands.Command.Execute.  It starts a sandbox in a
@@ -255,6 +265,16 @@ func (b *Boot) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 	mountsFile.Close()
 	spec.Mounts = cleanMounts
 
+	var controlToken []byte
+	if b.controlTokenFD >= 0 {
+		tokenFile := os.NewFile(uintptr(b.controlTokenFD), "control token file")
+		controlToken, err = ioutil.ReadAll(tokenFile)
+		tokenFile.Close()
+		if err != nil {
+			Fatalf("Error reading control token: %v", err)
+		}
+	}
+
 	if conf.EnableCoreTags {
 		if err := coretag.Enable(); err != nil {
 			Fatalf("Failed to core tag sentry: %v", err)
@@ -278,6 +298,7 @@ func (b *Boot) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 		Spec:           spec,
 		Conf:           conf,
 		ControllerFD:   b.controllerFD,
+		ControlToken:   controlToken,
 		Device:         os.NewFile(uintptr(b.deviceFD), "platform device"),
 		GoferFDs:       b.ioFDs.GetArray(),
 		StdioFDs:       b.stdioFDs.GetArray(),
@@ -289,6 +310,7 @@ func (b *Boot) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 		ProfileHeapFD:  b.profileHeapFD,
 		ProfileMutexFD: b.profileMutexFD,
 		TraceFD:        b.traceFD,
+		ReadyFD:        b.readyFD,
 		ProductName:    b.productName,
 	}
 	l, err := boot.New(bootArgs)
@@ -22,6 +22,8 @@ import (
 	"github.com/google/subcommands"
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/sentry/control"
+	"gvisor.dev/gvisor/pkg/state/statefile"
 	"gvisor.dev/gvisor/runsc/config"
 	"gvisor.dev/gvisor/runsc/container"
 	"gvisor.dev/gvisor/runsc/flag"
@@ -35,6 +37,8 @@ const checkpointFileName = "checkpoint.img"
 type Checkpoint struct {
 	imagePath    string
 	leaveRunning bool
+	compression  string
+	progress     bool
 }
 
 // Name implements subcommands.Command.Name.
@@ -57,6 +61,8 @@ func (*Checkpoint) Usage() string {
 func (c *Checkpoint) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&c.imagePath, "image-path", "", "directory path to saved container image")
 	f.BoolVar(&c.leaveRunning, "leave-running", false, "restart the container after checkpointing")
+	f.StringVar(&c.compression, "compression", string(statefile.CompressionBestSpeed), "how to compress the checkpoint image: best-speed, best-size or none")
+	f.BoolVar(&c.progress, "progress", false, "print the progress of the checkpoint to stdout")
 
 	// Unimplemented flags necessary for compatibility with docker.
 	var wp string
@@ -83,6 +89,10 @@ func (c *Checkpoint) Execute(_ context.Context, f *flag.FlagSet, args ...interfa
 	if c.imagePath == "" {
 		Fatalf("image-path flag must be provided")
 	}
+	compression, err := statefile.ParseCompression(c.compression)
+	if err != nil {
+		Fatalf("invalid compression flag: %v", err)
+	}
 
 	if err := os.MkdirAll(c.imagePath, 0755); err != nil {
 		Fatalf("making directories at path provided: %v", err)
@@ -97,7 +107,13 @@ func (c *Checkpoint) Execute(_ context.Context, f *flag.FlagSet, args ...interfa
 	}
 	defer file.Close()
 
-	if err := cont.Checkpoint(file); err != nil {
+	opts := control.SaveOpts{
+		Compression: compression,
+	}
+	if c.progress {
+		opts.FilePayload.Files = []*os.File{os.Stdout}
+	}
+	if err := cont.CheckpointWithOpts(file, opts); err != nil {
 		Fatalf("checkpoint failed: %v", err)
 	}
 
@@ -105,6 +121,10 @@ func (c *Checkpoint) Execute(_ context.Context, f *flag.FlagSet, args ...interfa
 		return subcommands.ExitSuccess
 	}
 
+	// The sandbox can't be resumed in place after a save (see
+	// containerManager.Checkpoint), so -leave-running restores the image
+	// into a new sandbox instead.
+	//
 	// TODO(b/110843694): Make it possible to restore into same container.
 	// For now, we can fake it by destroying the container and making a
 	// new container with the same ID. This hack does not work with docker
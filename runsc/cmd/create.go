@@ -16,6 +16,7 @@ package cmd
 
 import (
 	"context"
+	"os"
 
 	"github.com/google/subcommands"
 	"gvisor.dev/gvisor/runsc/config"
@@ -47,6 +48,10 @@ type Create struct {
 	// container, e.g. unsuported syscalls, while the later is more verbose and
 	// consumed by developers.
 	userLog string
+
+	// readyFD is the file descriptor to notify once the sandbox's control
+	// server is ready to accept requests. -1 disables notification.
+	readyFD int
 }
 
 // Name implements subcommands.Command.Name.
@@ -71,6 +76,7 @@ func (c *Create) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&c.consoleSocket, "console-socket", "", "path to an AF_UNIX socket which will receive a file descriptor referencing the master end of the console's pseudoterminal")
 	f.StringVar(&c.pidFile, "pid-file", "", "filename that the container pid will be written to")
 	f.StringVar(&c.userLog, "user-log", "", "filename to send user-visible logs to. Empty means no logging.")
+	f.IntVar(&c.readyFD, "ready-fd", -1, "file descriptor to write a byte to once the sandbox's control server is ready to accept requests. -1 disables notification.")
 }
 
 // Execute implements subcommands.Command.Execute.
@@ -107,9 +113,22 @@ func (c *Create) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}
 		ConsoleSocket: c.consoleSocket,
 		PIDFile:       c.pidFile,
 		UserLog:       c.userLog,
+		ReadyFile:     c.readyFile(),
+	}
+	if contArgs.ReadyFile != nil {
+		defer contArgs.ReadyFile.Close()
 	}
 	if _, err := container.New(conf, contArgs); err != nil {
 		return Errorf("creating container: %v", err)
 	}
 	return subcommands.ExitSuccess
 }
+
+// readyFile returns the file to notify once the sandbox's control server is
+// ready, or nil if none was passed.
+func (c *Create) readyFile() *os.File {
+	if c.readyFD < 0 {
+		return nil
+	}
+	return os.NewFile(uintptr(c.readyFD), "ready file")
+}
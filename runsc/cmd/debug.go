@@ -16,6 +16,9 @@ package cmd
 
 import (
 	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"os"
 	"os/signal"
 	"strconv"
@@ -27,6 +30,7 @@ import (
 	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/control"
+	"gvisor.dev/gvisor/runsc/boot"
 	"gvisor.dev/gvisor/runsc/config"
 	"gvisor.dev/gvisor/runsc/container"
 	"gvisor.dev/gvisor/runsc/flag"
@@ -34,21 +38,32 @@ import (
 
 // Debug implements subcommands.Command for the "debug" command.
 type Debug struct {
-	pid          int
-	stacks       bool
-	signal       int
-	profileBlock string
-	profileCPU   string
-	profileHeap  string
-	profileMutex string
-	trace        string
-	strace       string
-	logLevel     string
-	logPackets   string
-	delay        time.Duration
-	duration     time.Duration
-	ps           bool
-	cat          stringSlice
+	pid              int
+	stacks           bool
+	stacksCID        string
+	stacksMatch      string
+	stacksMax        int
+	signal           int
+	profileBlock     string
+	profileCPU       string
+	profileHeap      string
+	profileHeapNoGC  bool
+	profileGoroutine string
+	profileMutex     string
+	trace            string
+	strace           string
+	logLevel         string
+	logPackets       string
+	delay            time.Duration
+	duration         time.Duration
+	ps               bool
+	cat              stringSlice
+	futexStats       bool
+	perfCounters     bool
+	goroutines       bool
+	emulation        bool
+	readMemory       string
+	logOutput        string
 }
 
 // Name implements subcommands.Command.
@@ -70,9 +85,14 @@ func (*Debug) Usage() string {
 func (d *Debug) SetFlags(f *flag.FlagSet) {
 	f.IntVar(&d.pid, "pid", 0, "sandbox process ID. Container ID is not necessary if this is set")
 	f.BoolVar(&d.stacks, "stacks", false, "if true, dumps all sandbox stacks to the log")
+	f.StringVar(&d.stacksCID, "stacks-container", "", "with -stacks, only dumps the stacks of tasks in the given container")
+	f.StringVar(&d.stacksMatch, "stacks-match", "", "with -stacks, only dumps the stacks that contain the given string")
+	f.IntVar(&d.stacksMax, "stacks-max-bytes", 0, "with -stacks, caps the size of the dump. 0 means no limit")
 	f.StringVar(&d.profileBlock, "profile-block", "", "writes block profile to the given file.")
 	f.StringVar(&d.profileCPU, "profile-cpu", "", "writes CPU profile to the given file.")
 	f.StringVar(&d.profileHeap, "profile-heap", "", "writes heap profile to the given file.")
+	f.BoolVar(&d.profileHeapNoGC, "profile-heap-no-gc", false, "with -profile-heap, skips the garbage collection done before writing the heap profile.")
+	f.StringVar(&d.profileGoroutine, "profile-goroutine", "", "writes goroutine profile to the given file.")
 	f.StringVar(&d.profileMutex, "profile-mutex", "", "writes mutex profile to the given file.")
 	f.DurationVar(&d.delay, "delay", time.Hour, "amount of time to delay for collecting heap and goroutine profiles.")
 	f.DurationVar(&d.duration, "duration", time.Hour, "amount of time to wait for CPU and trace profiles.")
@@ -80,9 +100,15 @@ func (d *Debug) SetFlags(f *flag.FlagSet) {
 	f.IntVar(&d.signal, "signal", -1, "sends signal to the sandbox")
 	f.StringVar(&d.strace, "strace", "", `A comma separated list of syscalls to trace. "all" enables all traces, "off" disables all.`)
 	f.StringVar(&d.logLevel, "log-level", "", "The log level to set: warning (0), info (1), or debug (2).")
+	f.StringVar(&d.logOutput, "log-output", "", "switches the sandbox logs to the given file, e.g. after log rotation.")
 	f.StringVar(&d.logPackets, "log-packets", "", "A boolean value to enable or disable packet logging: true or false.")
 	f.BoolVar(&d.ps, "ps", false, "lists processes")
 	f.Var(&d.cat, "cat", "reads files and print to standard output")
+	f.BoolVar(&d.futexStats, "futex-stats", false, "prints futex wait statistics for the container. Requires the sandbox to run with --futex-stats")
+	f.BoolVar(&d.perfCounters, "perf-counters", false, "prints the hardware events counted for the container. Requires the sandbox to run with --perf-counters")
+	f.BoolVar(&d.goroutines, "goroutine-history", false, "prints the goroutine and thread counts sampled by the sandbox. Requires the sandbox to run with --goroutine-sample-interval")
+	f.BoolVar(&d.emulation, "emulation-info", false, "prints which features the sandbox emulates and which it passes through to the host")
+	f.StringVar(&d.readMemory, "read-memory", "", "dumps process memory in hex/ascii to standard output. Format: <PID>:<address>:<length>. Requires the sandbox to run with --debug-memory-access")
 }
 
 // Execute implements subcommands.Command.Execute.
@@ -151,7 +177,11 @@ func (d *Debug) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 	}
 	if d.stacks {
 		log.Infof("Retrieving sandbox stacks")
-		stacks, err := c.Sandbox.Stacks()
+		stacks, err := c.Sandbox.Stacks(boot.StacksArgs{
+			CID:      d.stacksCID,
+			Match:    d.stacksMatch,
+			MaxBytes: d.stacksMax,
+		})
 		if err != nil {
 			return Errorf("retrieving stacks: %v", err)
 		}
@@ -224,14 +254,94 @@ func (d *Debug) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 		}
 		log.Infof(o)
 	}
+	if d.futexStats {
+		stats, err := c.FutexStats()
+		if err != nil {
+			return Errorf("retrieving futex stats: %v", err)
+		}
+		b, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			return Errorf("generating JSON: %v", err)
+		}
+		log.Infof("     *** Futex stats ***\n%s", b)
+	}
+	if d.perfCounters {
+		counters, err := c.PerfCounters()
+		if err != nil {
+			return Errorf("retrieving perf counters: %v", err)
+		}
+		b, err := json.MarshalIndent(counters, "", "  ")
+		if err != nil {
+			return Errorf("generating JSON: %v", err)
+		}
+		log.Infof("     *** Perf counters ***\n%s", b)
+	}
+	if d.goroutines {
+		history, err := c.Sandbox.GoroutineHistory()
+		if err != nil {
+			return Errorf("retrieving goroutine history: %v", err)
+		}
+		var b strings.Builder
+		for _, s := range history {
+			fmt.Fprintf(&b, "%s goroutines: %d, threads: %d\n", s.Time.Format(time.RFC3339), s.Goroutines, s.Threads)
+		}
+		log.Infof("     *** Goroutine history ***\n%s", b.String())
+	}
+	if d.emulation {
+		info, err := c.Sandbox.EmulationInfo()
+		if err != nil {
+			return Errorf("retrieving emulation info: %v", err)
+		}
+		b, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			return Errorf("generating JSON: %v", err)
+		}
+		log.Infof("     *** Emulation info ***\n%s", b)
+	}
+	if d.readMemory != "" {
+		parts := strings.Split(d.readMemory, ":")
+		if len(parts) != 3 {
+			return Errorf("invalid -read-memory value %q, format is <PID>:<address>:<length>", d.readMemory)
+		}
+		pid, err := strconv.ParseInt(parts[0], 10, 32)
+		if err != nil {
+			return Errorf("invalid PID %q: %v", parts[0], err)
+		}
+		addr, err := strconv.ParseUint(parts[1], 0, 64)
+		if err != nil {
+			return Errorf("invalid address %q: %v", parts[1], err)
+		}
+		length, err := strconv.ParseUint(parts[2], 0, 64)
+		if err != nil {
+			return Errorf("invalid length %q: %v", parts[2], err)
+		}
+		buf, err := c.ReadMemory(int32(pid), addr, length)
+		if err != nil {
+			return Errorf("reading memory: %v", err)
+		}
+		os.Stdout.WriteString(hex.Dump(buf))
+	}
+
+	if d.logOutput != "" {
+		f, err := os.OpenFile(d.logOutput, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return Errorf("error opening log output: %v", err)
+		}
+		defer f.Close()
+		if err := c.Sandbox.SetLogOutput(f); err != nil {
+			return Errorf(err.Error())
+		}
+		log.Infof("Sandbox log output switched to %q", d.logOutput)
+	}
 
 	// Open profiling files.
 	var (
-		blockFile *os.File
-		cpuFile   *os.File
-		heapFile  *os.File
-		mutexFile *os.File
-		traceFile *os.File
+		blockFile     *os.File
+		cpuFile       *os.File
+		heapFile      *os.File
+		goroutineFile *os.File
+		mutexFile     *os.File
+		traceFile     *os.File
 	)
 	if d.profileBlock != "" {
 		f, err := os.OpenFile(d.profileBlock, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
@@ -257,6 +367,14 @@ func (d *Debug) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 		defer f.Close()
 		heapFile = f
 	}
+	if d.profileGoroutine != "" {
+		f, err := os.OpenFile(d.profileGoroutine, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return Errorf("error opening goroutine profile output: %v", err)
+		}
+		defer f.Close()
+		goroutineFile = f
+	}
 	if d.profileMutex != "" {
 		f, err := os.OpenFile(d.profileMutex, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 		if err != nil {
@@ -275,12 +393,13 @@ func (d *Debug) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 
 	// Collect profiles.
 	var (
-		wg       sync.WaitGroup
-		blockErr error
-		cpuErr   error
-		heapErr  error
-		mutexErr error
-		traceErr error
+		wg           sync.WaitGroup
+		blockErr     error
+		cpuErr       error
+		heapErr      error
+		goroutineErr error
+		mutexErr     error
+		traceErr     error
 	)
 	if blockFile != nil {
 		wg.Add(1)
@@ -300,7 +419,14 @@ func (d *Debug) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			heapErr = c.Sandbox.HeapProfile(heapFile, d.delay)
+			heapErr = c.Sandbox.HeapProfile(heapFile, d.delay, d.profileHeapNoGC)
+		}()
+	}
+	if goroutineFile != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			goroutineErr = c.Sandbox.GoroutineProfile(goroutineFile)
 		}()
 	}
 	if mutexFile != nil {
@@ -362,6 +488,11 @@ func (d *Debug) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 		log.Infof("error collecting heap profile: %v", heapErr)
 		os.Remove(heapFile.Name())
 	}
+	if goroutineErr != nil {
+		errorCount++
+		log.Infof("error collecting goroutine profile: %v", goroutineErr)
+		os.Remove(goroutineFile.Name())
+	}
 	if mutexErr != nil {
 		errorCount++
 		log.Infof("error collecting mutex profile: %v", mutexErr)
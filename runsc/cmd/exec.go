@@ -32,6 +32,7 @@ import (
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/control"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/limits"
 	"gvisor.dev/gvisor/pkg/urpc"
 	"gvisor.dev/gvisor/runsc/config"
 	"gvisor.dev/gvisor/runsc/console"
@@ -52,6 +53,7 @@ type Exec struct {
 	processPath     string
 	pidFile         string
 	internalPidFile string
+	timeout         time.Duration
 
 	// consoleSocket is the path to an AF_UNIX socket which will receive a
 	// file descriptor referencing the master end of the console's
@@ -99,6 +101,7 @@ func (ex *Exec) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&ex.processPath, "process", "", "path to the process.json")
 	f.StringVar(&ex.pidFile, "pid-file", "", "filename that the container pid will be written to")
 	f.StringVar(&ex.internalPidFile, "internal-pid-file", "", "filename that the container-internal pid will be written to")
+	f.DurationVar(&ex.timeout, "timeout", 0, "kill the process if it hasn't exited after this duration, 0 means no timeout")
 	f.StringVar(&ex.consoleSocket, "console-socket", "", "path to an AF_UNIX socket which will receive a file descriptor referencing the master end of the console's pseudoterminal")
 }
 
@@ -111,6 +114,13 @@ func (ex *Exec) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 		Fatalf("parsing process spec: %v", err)
 	}
 	waitStatus := args[1].(*unix.WaitStatus)
+	if ex.timeout > 0 {
+		e.TimeoutMs = ex.timeout.Milliseconds()
+		if e.TimeoutMs == 0 {
+			// Don't turn a short timeout into no timeout.
+			e.TimeoutMs = 1
+		}
+	}
 
 	c, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
 	if err != nil {
@@ -369,6 +379,15 @@ func argsFromProcess(p *specs.Process, enableRaw bool) (*control.ExecArgs, error
 		extraKGIDs = append(extraKGIDs, auth.KGID(GID))
 	}
 
+	// The resource names are validated by the sandbox.
+	var rlimits map[string]limits.Limit
+	if len(p.Rlimits) > 0 {
+		rlimits = make(map[string]limits.Limit, len(p.Rlimits))
+		for _, rl := range p.Rlimits {
+			rlimits[rl.Type] = limits.Limit{Cur: rl.Soft, Max: rl.Hard}
+		}
+	}
+
 	return &control.ExecArgs{
 		Argv:             p.Args,
 		Envv:             p.Env,
@@ -379,6 +398,8 @@ func argsFromProcess(p *specs.Process, enableRaw bool) (*control.ExecArgs, error
 		Capabilities:     caps,
 		StdioIsPty:       p.Terminal,
 		FilePayload:      urpc.FilePayload{Files: []*os.File{os.Stdin, os.Stdout, os.Stderr}},
+		Rlimits:          rlimits,
+		NoNewPrivs:       p.NoNewPrivileges,
 	}, nil
 }
 
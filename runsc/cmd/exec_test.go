@@ -24,6 +24,7 @@ import (
 	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/sentry/control"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/limits"
 	"gvisor.dev/gvisor/pkg/urpc"
 )
 
@@ -141,6 +142,24 @@ func TestJSONArgs(t *testing.T) {
 				},
 			},
 		},
+		{
+			p: specs.Process{
+				Args: []string{"ls", "/"},
+				Rlimits: []specs.POSIXRlimit{
+					{Type: "RLIMIT_NOFILE", Hard: 1024, Soft: 512},
+					{Type: "RLIMIT_CPU", Hard: 10, Soft: 5},
+				},
+			},
+			expected: control.ExecArgs{
+				Argv:        []string{"ls", "/"},
+				FilePayload: urpc.FilePayload{Files: []*os.File{os.Stdin, os.Stdout, os.Stderr}},
+				ExtraKGIDs:  []auth.KGID{},
+				Rlimits: map[string]limits.Limit{
+					"RLIMIT_NOFILE": {Cur: 512, Max: 1024},
+					"RLIMIT_CPU":    {Cur: 5, Max: 10},
+				},
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -47,7 +47,7 @@ func (*PS) Usage() string {
 
 // SetFlags implements subcommands.Command.SetFlags.
 func (ps *PS) SetFlags(f *flag.FlagSet) {
-	f.StringVar(&ps.format, "format", "table", "output format. Select one of: table or json (default: table)")
+	f.StringVar(&ps.format, "format", "table", "output format. Select one of: table, json or tree (default: table)")
 }
 
 // Execute implements subcommands.Command.Execute.
@@ -64,6 +64,19 @@ func (ps *PS) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{})
 	if err != nil {
 		Fatalf("loading sandbox: %v", err)
 	}
+	if ps.format == "tree" {
+		tree, err := c.ProcessTree()
+		if err != nil {
+			Fatalf("getting process tree for container: %v", err)
+		}
+		o, err := control.ProcessListToJSON(tree)
+		if err != nil {
+			Fatalf("generating JSON: %v", err)
+		}
+		fmt.Println(o)
+		return subcommands.ExitSuccess
+	}
+
 	pList, err := c.Processes()
 	if err != nil {
 		Fatalf("getting processes for container: %v", err)
@@ -96,6 +96,10 @@ func (r *Run) Execute(_ context.Context, f *flag.FlagSet, args ...interface{}) s
 		PIDFile:       r.pidFile,
 		UserLog:       r.userLog,
 		Attached:      !r.detach,
+		ReadyFile:     r.readyFile(),
+	}
+	if runArgs.ReadyFile != nil {
+		defer runArgs.ReadyFile.Close()
 	}
 	ws, err := container.Run(conf, runArgs)
 	if err != nil {
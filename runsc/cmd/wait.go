@@ -18,9 +18,11 @@ import (
 	"context"
 	"encoding/json"
 	"os"
+	"time"
 
 	"github.com/google/subcommands"
 	"golang.org/x/sys/unix"
+	"gvisor.dev/gvisor/runsc/boot"
 	"gvisor.dev/gvisor/runsc/config"
 	"gvisor.dev/gvisor/runsc/container"
 	"gvisor.dev/gvisor/runsc/flag"
@@ -34,6 +36,7 @@ const (
 type Wait struct {
 	rootPID int
 	pid     int
+	timeout time.Duration
 }
 
 // Name implements subcommands.Command.Name.
@@ -55,6 +58,7 @@ func (*Wait) Usage() string {
 func (wt *Wait) SetFlags(f *flag.FlagSet) {
 	f.IntVar(&wt.rootPID, "rootpid", unsetPID, "select a PID in the sandbox root PID namespace to wait on instead of the container's root process")
 	f.IntVar(&wt.pid, "pid", unsetPID, "select a PID in the container's PID namespace to wait on instead of the container's root process")
+	f.DurationVar(&wt.timeout, "timeout", 0, "with -pid, give up if the process hasn't exited after this long. 0 waits forever")
 }
 
 // Execute implements subcommands.Command.Execute. It waits for a process in a
@@ -68,6 +72,9 @@ func (wt *Wait) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 	if wt.rootPID != unsetPID && wt.pid != unsetPID {
 		Fatalf("only one of -pid and -rootPid can be set")
 	}
+	if wt.timeout != 0 && wt.pid == unsetPID {
+		Fatalf("-timeout can only be used with -pid")
+	}
 
 	id := f.Arg(0)
 	conf := args[0].(*config.Config)
@@ -95,7 +102,7 @@ func (wt *Wait) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 		waitStatus = ws
 	// Wait on a PID in the container's PID namespace.
 	case wt.pid != unsetPID:
-		ws, err := c.WaitPID(int32(wt.pid))
+		ws, err := c.WaitPIDTimeout(int32(wt.pid), wt.timeout)
 		if err != nil {
 			Fatalf("waiting on PID %d in container %q: %v", wt.pid, c.ID, err)
 		}
@@ -103,7 +110,7 @@ func (wt *Wait) Execute(_ context.Context, f *flag.FlagSet, args ...interface{})
 	}
 	result := waitResult{
 		ID:         id,
-		ExitStatus: exitStatus(waitStatus),
+		ExitStatus: boot.OCIExitStatus(waitStatus),
 	}
 	// Write json-encoded wait result directly to stdout.
 	if err := json.NewEncoder(os.Stdout).Encode(result); err != nil {
@@ -116,12 +123,3 @@ type waitResult struct {
 	ID         string `json:"id"`
 	ExitStatus int    `json:"exitStatus"`
 }
-
-// exitStatus returns the correct exit status for a process based on if it
-// was signaled or exited cleanly.
-func exitStatus(status unix.WaitStatus) int {
-	if status.Signaled() {
-		return 128 + int(status.Signal())
-	}
-	return status.ExitStatus()
-}
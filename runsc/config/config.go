@@ -20,7 +20,9 @@ package config
 import (
 	"fmt"
 	"strings"
+	"time"
 
+	"gvisor.dev/gvisor/pkg/abi/linux"
 	"gvisor.dev/gvisor/pkg/refs"
 	controlpb "gvisor.dev/gvisor/pkg/sentry/control/control_go_proto"
 	"gvisor.dev/gvisor/pkg/sentry/watchdog"
@@ -152,9 +154,38 @@ type Config struct {
 	// SIGUSR2(12) to troubleshoot hangs. -1 disables it.
 	PanicSignal int `flag:"panic-signal"`
 
+	// CheckpointSignal is a signal that checkpoints the sandbox when it's sent
+	// to the root container's init process, which doesn't receive it. The
+	// checkpoint is written to the file donated with the SetCheckpointFile
+	// control call, and the sandbox exits afterwards, as with runsc
+	// checkpoint. This lets applications request checkpoints of themselves.
+	// -1 disables it.
+	CheckpointSignal int `flag:"checkpoint-signal"`
+
 	// ProfileEnable is set to prepare the sandbox to be profiled.
 	ProfileEnable bool `flag:"profile"`
 
+	// FutexStats enables collection of per-container futex wait statistics.
+	FutexStats bool `flag:"futex-stats"`
+
+	// PerfCounters enables counting hardware events, e.g. CPU cycles and cache
+	// misses, while application code runs. Only supported by some platforms.
+	PerfCounters bool `flag:"perf-counters"`
+
+	// DebugMemoryAccess allows reading the memory of processes in the sandbox
+	// through the control server. It must only be used for debugging since it
+	// exposes application data.
+	DebugMemoryAccess bool `flag:"debug-memory-access"`
+
+	// DebugMemoryWrite allows writing to the memory of processes in the
+	// sandbox through the control server. Requires DebugMemoryAccess.
+	DebugMemoryWrite bool `flag:"debug-memory-write"`
+
+	// GoroutineSampleInterval is how often the sandbox samples its goroutine
+	// and thread counts, which can be retrieved with runsc debug
+	// --goroutine-history. 0 disables sampling.
+	GoroutineSampleInterval time.Duration `flag:"goroutine-sample-interval"`
+
 	// ProfileBlock collects a block profile to the passed file for the
 	// duration of the container execution. Requires ProfileEnabled.
 	ProfileBlock string `flag:"profile-block"`
@@ -266,6 +297,18 @@ func (c *Config) validate() error {
 	if c.ProfileMutex != "" && !c.ProfileEnable {
 		return fmt.Errorf("profile-mutex flag requires enabling profiling with profile flag")
 	}
+	if c.DebugMemoryWrite && !c.DebugMemoryAccess {
+		return fmt.Errorf("debug-memory-write flag requires enabling memory access with debug-memory-access flag")
+	}
+	if c.GoroutineSampleInterval < 0 {
+		return fmt.Errorf("goroutine-sample-interval must be >= 0, got: %v", c.GoroutineSampleInterval)
+	}
+	if c.CheckpointSignal != -1 {
+		// SIGKILL and SIGSTOP can't be intercepted on Linux either.
+		if sig := linux.Signal(c.CheckpointSignal); !sig.IsValid() || sig == linux.SIGKILL || sig == linux.SIGSTOP {
+			return fmt.Errorf("checkpoint-signal must be -1 or a signal other than SIGKILL and SIGSTOP, got: %d", c.CheckpointSignal)
+		}
+	}
 	return nil
 }
 
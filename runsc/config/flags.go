@@ -48,6 +48,11 @@ func RegisterFlags(flagSet *flag.FlagSet) {
 	flagSet.Bool("alsologtostderr", false, "send log messages to stderr.")
 	flagSet.Bool("allow-flag-override", false, "allow OCI annotations (dev.gvisor.flag.<name>) to override flags for debugging.")
 	flagSet.String("traceback", "system", "golang runtime's traceback level")
+	flagSet.Bool("futex-stats", false, "collect per-container futex wait statistics, which can be retrieved with runsc debug --futex-stats.")
+	flagSet.Bool("perf-counters", false, "count hardware events while application code runs, which can be retrieved with runsc debug --perf-counters. Only supported by the KVM platform, and loosens the seccomp protection added to the sandbox.")
+	flagSet.Bool("debug-memory-access", false, "allow reading the memory of processes in the sandbox with runsc debug --read-memory. Exposes application data (DO NOT USE IN PRODUCTION).")
+	flagSet.Bool("debug-memory-write", false, "allow writing to the memory of processes in the sandbox through the control server. Requires -debug-memory-access=true. Every write is logged (DO NOT USE IN PRODUCTION).")
+	flagSet.Duration("goroutine-sample-interval", 0, "how often to sample goroutine and thread counts in the sandbox, which can be retrieved with runsc debug --goroutine-history. 0 disables sampling.")
 
 	// Debugging flags: strace related
 	flagSet.Bool("strace", false, "enable strace.")
@@ -60,6 +65,7 @@ func RegisterFlags(flagSet *flag.FlagSet) {
 	flagSet.String("platform_device_path", "", "path to a platform-specific device file (e.g. /dev/kvm for KVM platform). If unset, will use a sane platform-specific default.")
 	flagSet.Var(watchdogActionPtr(watchdog.LogWarning), "watchdog-action", "sets what action the watchdog takes when triggered: log (default), panic.")
 	flagSet.Int("panic-signal", -1, "register signal handling that panics. Usually set to SIGUSR2(12) to troubleshoot hangs. -1 disables it.")
+	flagSet.Int("checkpoint-signal", -1, "checkpoint the sandbox to the file set with SetCheckpointFile when this signal is sent to the root container's init process, instead of delivering it. -1 disables it.")
 	flagSet.Bool("profile", false, "prepares the sandbox to use Golang profiler. Note that enabling profiler loosens the seccomp protection added to the sandbox (DO NOT USE IN PRODUCTION).")
 	flagSet.String("profile-block", "", "collects a block profile to this file path for the duration of the container execution. Requires -profile=true.")
 	flagSet.String("profile-cpu", "", "collects a CPU profile to this file path for the duration of the container execution. Requires -profile=true.")
@@ -362,6 +362,78 @@ func TestJobControlSignalExec(t *testing.T) {
 	}
 }
 
+// Test that resizing the TTY of a process started with "exec -ti" changes its
+// window size and sends it SIGWINCH.
+func TestResizeTTYExec(t *testing.T) {
+	spec := testutil.NewSpecWithArgs("/bin/sleep", "10000")
+	conf := testutil.TestConfig(t)
+
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	c, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer c.Destroy()
+	if err := c.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	ptyMaster, ptyReplica, err := pty.Open()
+	if err != nil {
+		t.Fatalf("error opening pty: %v", err)
+	}
+	defer ptyMaster.Close()
+	defer ptyReplica.Close()
+
+	// Print the window size once SIGWINCH is received.
+	script := "trap 'stty size; exit 0' WINCH; echo ready; while true; do sleep 0.1; done"
+	execArgs := &control.ExecArgs{
+		Filename: "/bin/bash",
+		Argv:     []string{"/bin/bash", "--noprofile", "--norc", "-c", script},
+		FilePayload: urpc.FilePayload{
+			Files: []*os.File{ptyReplica, ptyReplica, ptyReplica},
+		},
+		StdioIsPty: true,
+	}
+	pid, err := c.Execute(conf, execArgs)
+	if err != nil {
+		t.Fatalf("error executing: %v", err)
+	}
+	if err := testutil.WaitUntilRead(ptyMaster, "ready", 5*time.Second); err != nil {
+		t.Fatalf("bash did not start: %v", err)
+	}
+
+	if err := c.ResizeTTY(pid, 37, 91); err != nil {
+		t.Fatalf("ResizeTTY(%d, 37, 91): %v", pid, err)
+	}
+	if err := testutil.WaitUntilRead(ptyMaster, "37 91", 5*time.Second); err != nil {
+		t.Fatalf("bash did not report the new window size: %v", err)
+	}
+	ws, err := c.WaitPID(pid)
+	if err != nil {
+		t.Fatalf("waiting on PID %d: %v", pid, err)
+	}
+	if !ws.Exited() || ws.ExitStatus() != 0 {
+		t.Errorf("exec got wait status %v, want exit status 0", ws)
+	}
+
+	// The container init process has no TTY.
+	if err := c.ResizeTTY(0, 37, 91); err == nil {
+		t.Errorf("ResizeTTY(0, 37, 91) on a process without a TTY succeeded")
+	}
+}
+
 // Test that job control signals work on a console created with "run -ti".
 func TestJobControlSignalRootContainer(t *testing.T) {
 	conf := testutil.TestConfig(t)
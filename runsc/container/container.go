@@ -35,7 +35,9 @@ import (
 	"gvisor.dev/gvisor/pkg/cleanup"
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/control"
+	"gvisor.dev/gvisor/pkg/sentry/platform"
 	"gvisor.dev/gvisor/pkg/sighandling"
+	"gvisor.dev/gvisor/pkg/state/statefile"
 	"gvisor.dev/gvisor/runsc/boot"
 	"gvisor.dev/gvisor/runsc/cgroup"
 	"gvisor.dev/gvisor/runsc/config"
@@ -171,6 +173,13 @@ type Args struct {
 	//
 	// It only applies for the init container.
 	Attached bool
+
+	// ReadyFile, if set, is written to by the sandbox once its control server
+	// is ready to accept requests. It may be nil. The caller keeps ownership
+	// of the file.
+	//
+	// It only applies for the init container.
+	ReadyFile *os.File
 }
 
 // New creates the container in a new Sandbox process, unless the metadata
@@ -274,6 +283,7 @@ func New(conf *config.Config, args Args) (*Container, error) {
 				MountsFile:    specFile,
 				Cgroup:        parentCgroup,
 				Attached:      args.Attached,
+				ReadyFile:     args.ReadyFile,
 			}
 			sand, err := sandbox.New(conf, sandArgs)
 			if err != nil {
@@ -450,6 +460,21 @@ func (c *Container) Start(conf *config.Config) error {
 // Restore takes a container and replaces its kernel and file system
 // to restore a container from its state file.
 func (c *Container) Restore(spec *specs.Spec, conf *config.Config, restoreFile string) error {
+	return c.restore(func() error {
+		return c.Sandbox.Restore(c.ID, spec, conf, restoreFile)
+	})
+}
+
+// RestoreFromFile is similar to Restore, but reads the state from the given
+// file. The file doesn't need to be seekable, which allows the state to be
+// streamed from a socket.
+func (c *Container) RestoreFromFile(spec *specs.Spec, conf *config.Config, f *os.File) error {
+	return c.restore(func() error {
+		return c.Sandbox.RestoreFromFile(c.ID, spec, conf, f)
+	})
+}
+
+func (c *Container) restore(restore func() error) error {
 	log.Debugf("Restore container, cid: %s", c.ID)
 	if err := c.Saver.lock(); err != nil {
 		return err
@@ -466,7 +491,7 @@ func (c *Container) Restore(spec *specs.Spec, conf *config.Config, restoreFile s
 		log.Warningf("StartContainer hook skipped because running inside container namespace is not supported")
 	}
 
-	if err := c.Sandbox.Restore(c.ID, spec, conf, restoreFile); err != nil {
+	if err := restore(); err != nil {
 		return err
 	}
 	c.changeStatus(Running)
@@ -515,6 +540,17 @@ func (c *Container) Execute(conf *config.Config, args *control.ExecArgs) (int32,
 	return c.Sandbox.Execute(conf, args)
 }
 
+// ExecuteSync runs the specified command in the container, waits for it to
+// exit and returns its wait status.
+func (c *Container) ExecuteSync(conf *config.Config, args *control.ExecArgs) (unix.WaitStatus, error) {
+	log.Debugf("Execute synchronously in container, cid: %s, args: %+v", c.ID, args)
+	if err := c.requireStatus("execute in", Created, Running); err != nil {
+		return 0, err
+	}
+	args.ContainerID = c.ID
+	return c.Sandbox.ExecuteSync(conf, args)
+}
+
 // Event returns events for the container.
 func (c *Container) Event() (*boot.EventOut, error) {
 	log.Debugf("Getting events for container, cid: %s", c.ID)
@@ -532,6 +568,275 @@ func (c *Container) Event() (*boot.EventOut, error) {
 	return event, nil
 }
 
+// FutexStats returns futex wait statistics for the container.
+func (c *Container) FutexStats() (*boot.FutexStats, error) {
+	log.Debugf("Getting futex stats for container, cid: %s", c.ID)
+	if err := c.requireStatus("get futex stats for", Created, Running, Paused); err != nil {
+		return nil, err
+	}
+	return c.Sandbox.FutexStats(c.ID)
+}
+
+// PerfCounters returns the hardware events counted while the container ran
+// application code.
+func (c *Container) PerfCounters() (*platform.PerfCounters, error) {
+	log.Debugf("Getting perf counters for container, cid: %s", c.ID)
+	if err := c.requireStatus("get perf counters for", Running, Paused); err != nil {
+		return nil, err
+	}
+	return c.Sandbox.PerfCounters(c.ID)
+}
+
+// IPCObjects lists the SysV IPC objects of the container. If removeOrphaned is
+// true, shared memory segments that aren't attached by any process are
+// removed.
+func (c *Container) IPCObjects(removeOrphaned bool) (*boot.IPCObjects, error) {
+	log.Debugf("Getting IPC objects for container, cid: %s, remove orphaned: %t", c.ID, removeOrphaned)
+	if err := c.requireStatus("get IPC objects for", Running, Paused); err != nil {
+		return nil, err
+	}
+	return c.Sandbox.IPCObjects(c.ID, removeOrphaned)
+}
+
+// AddDevice creates the device node described by dev in the container's
+// filesystem. Only character devices implemented by the sandbox are allowed.
+func (c *Container) AddDevice(dev specs.LinuxDevice) error {
+	log.Debugf("Adding device for container, cid: %s, path: %q", c.ID, dev.Path)
+	if err := c.requireStatus("add device to", Running, Paused); err != nil {
+		return err
+	}
+	return c.Sandbox.AddDevice(c.ID, dev)
+}
+
+// AsyncIOStatus lists the asynchronous I/O contexts of the container's
+// processes. If cancel is true, requests that haven't started executing are
+// canceled.
+func (c *Container) AsyncIOStatus(cancel bool) ([]control.AsyncIOProcess, error) {
+	log.Debugf("Getting async I/O status for container, cid: %s, cancel: %t", c.ID, cancel)
+	if err := c.requireStatus("get async I/O status for", Running, Paused); err != nil {
+		return nil, err
+	}
+	return c.Sandbox.AsyncIOStatus(c.ID, cancel)
+}
+
+// HostRootPath returns what backs the container's root filesystem on the
+// host. The sandbox must run with --debug.
+func (c *Container) HostRootPath() (boot.HostRootPath, error) {
+	log.Debugf("Getting host root path for container, cid: %s", c.ID)
+	if err := c.requireStatus("get host root path for", Running, Paused); err != nil {
+		return boot.HostRootPath{}, err
+	}
+	return c.Sandbox.HostRootPath(c.ID)
+}
+
+// InitCommand returns the command of the container's init process, as
+// recorded when it started.
+func (c *Container) InitCommand() (boot.InitCommand, error) {
+	log.Debugf("Getting init command for container, cid: %s", c.ID)
+	if err := c.requireStatus("get init command for", Running, Paused); err != nil {
+		return boot.InitCommand{}, err
+	}
+	return c.Sandbox.InitCommand(c.ID)
+}
+
+// IPCLimits returns the IPC limits of the container's IPC namespace.
+func (c *Container) IPCLimits() (boot.IPCLimits, error) {
+	log.Debugf("Getting IPC limits for container, cid: %s", c.ID)
+	if err := c.requireStatus("get IPC limits for", Running, Paused); err != nil {
+		return boot.IPCLimits{}, err
+	}
+	return c.Sandbox.IPCLimits(c.ID)
+}
+
+// SetIPCLimits sets the IPC limits of the container's IPC namespace. Zero
+// fields of limits are left unchanged. Note that containers share the root
+// IPC namespace unless they are configured with their own.
+func (c *Container) SetIPCLimits(limits boot.IPCLimits) error {
+	log.Debugf("Setting IPC limits for container, cid: %s, limits: %+v", c.ID, limits)
+	if err := c.requireStatus("set IPC limits for", Running, Paused); err != nil {
+		return err
+	}
+	return c.Sandbox.SetIPCLimits(c.ID, limits)
+}
+
+// PendingSignals returns the signals queued on the container's init process.
+// If flush is true, the signals are discarded without being delivered.
+func (c *Container) PendingSignals(flush bool) ([]boot.PendingSignal, error) {
+	log.Debugf("Getting pending signals for container, cid: %s, flush: %t", c.ID, flush)
+	if err := c.requireStatus("get pending signals for", Running, Paused); err != nil {
+		return nil, err
+	}
+	return c.Sandbox.PendingSignals(c.ID, flush)
+}
+
+// SetReadAhead sets the read-ahead window, in bytes, used for the container's
+// file reads. 0 restores the default window.
+func (c *Container) SetReadAhead(size uint64) error {
+	log.Debugf("Setting read-ahead for container, cid: %s, size: %d", c.ID, size)
+	if err := c.requireStatus("set read-ahead for", Running, Paused); err != nil {
+		return err
+	}
+	return c.Sandbox.SetReadAhead(c.ID, size)
+}
+
+// ReadAhead returns the read-ahead window, in bytes, used for the container's
+// file reads.
+func (c *Container) ReadAhead() (uint64, error) {
+	log.Debugf("Getting read-ahead for container, cid: %s", c.ID)
+	if err := c.requireStatus("get read-ahead for", Created, Running, Paused); err != nil {
+		return 0, err
+	}
+	return c.Sandbox.ReadAhead(c.ID)
+}
+
+// SetSyncPolicy sets how the container's fsync calls are propagated to the
+// host: "durable", "relaxed" or "none".
+func (c *Container) SetSyncPolicy(policy string) error {
+	log.Debugf("Setting sync policy for container, cid: %s, policy: %s", c.ID, policy)
+	if err := c.requireStatus("set sync policy for", Running, Paused); err != nil {
+		return err
+	}
+	return c.Sandbox.SetSyncPolicy(c.ID, policy)
+}
+
+// SyncPolicy returns the sync policy of the container's fsync calls.
+func (c *Container) SyncPolicy() (string, error) {
+	log.Debugf("Getting sync policy for container, cid: %s", c.ID)
+	if err := c.requireStatus("get sync policy for", Created, Running, Paused); err != nil {
+		return "", err
+	}
+	return c.Sandbox.SyncPolicy(c.ID)
+}
+
+// SetSchedLatency sets the scheduling latency targets of the container's
+// tasks. A zero value restores the defaults.
+func (c *Container) SetSchedLatency(lat boot.SchedLatency) error {
+	log.Debugf("Setting scheduling latency for container, cid: %s, latency: %+v", c.ID, lat)
+	if err := c.requireStatus("set scheduling latency for", Running, Paused); err != nil {
+		return err
+	}
+	return c.Sandbox.SetSchedLatency(c.ID, lat)
+}
+
+// SchedLatency returns the scheduling latency targets of the container's
+// tasks.
+func (c *Container) SchedLatency() (boot.SchedLatency, error) {
+	log.Debugf("Getting scheduling latency for container, cid: %s", c.ID)
+	if err := c.requireStatus("get scheduling latency for", Running, Paused); err != nil {
+		return boot.SchedLatency{}, err
+	}
+	return c.Sandbox.SchedLatency(c.ID)
+}
+
+// SetDiskQuota limits the size of the container's writable layer, which holds
+// the changes to its root filesystem with --overlay, to limit bytes. 0 removes
+// the limit.
+func (c *Container) SetDiskQuota(limit uint64) error {
+	log.Debugf("Setting disk quota for container, cid: %s, limit: %d", c.ID, limit)
+	if err := c.requireStatus("set disk quota for", Running, Paused); err != nil {
+		return err
+	}
+	return c.Sandbox.SetDiskQuota(c.ID, limit)
+}
+
+// DiskQuota returns the size limit and usage of the container's writable
+// layer.
+func (c *Container) DiskQuota() (boot.DiskQuota, error) {
+	log.Debugf("Getting disk quota for container, cid: %s", c.ID)
+	if err := c.requireStatus("get disk quota for", Running, Paused); err != nil {
+		return boot.DiskQuota{}, err
+	}
+	return c.Sandbox.DiskQuota(c.ID)
+}
+
+// ReadMemory reads length bytes at addr in the memory of process pid. It
+// requires the sandbox to run with --debug-memory-access.
+func (c *Container) ReadMemory(pid int32, addr, length uint64) ([]byte, error) {
+	log.Debugf("Reading memory of process %d in container, cid: %s", pid, c.ID)
+	if err := c.requireStatus("read memory of", Running, Paused); err != nil {
+		return nil, err
+	}
+	return c.Sandbox.ReadMemory(c.ID, pid, addr, length)
+}
+
+// WriteMemory writes data at addr in the memory of process pid. It requires
+// the sandbox to run with --debug-memory-write.
+func (c *Container) WriteMemory(pid int32, addr uint64, data []byte) error {
+	log.Debugf("Writing memory of process %d in container, cid: %s", pid, c.ID)
+	if err := c.requireStatus("write memory of", Running, Paused); err != nil {
+		return err
+	}
+	return c.Sandbox.WriteMemory(c.ID, pid, addr, data)
+}
+
+// SchedPolicy returns the scheduling policy of process pid.
+func (c *Container) SchedPolicy(pid int32) (*boot.SchedPolicy, error) {
+	log.Debugf("Getting scheduling policy of process %d in container, cid: %s", pid, c.ID)
+	if err := c.requireStatus("get scheduling policy in", Running, Paused); err != nil {
+		return nil, err
+	}
+	return c.Sandbox.SchedPolicy(c.ID, pid)
+}
+
+// SetSchedPolicy sets the scheduling policy of process pid.
+func (c *Container) SetSchedPolicy(pid int32, policy boot.SchedPolicy) error {
+	log.Debugf("Setting scheduling policy of process %d in container, cid: %s, policy: %+v", pid, c.ID, policy)
+	if err := c.requireStatus("set scheduling policy in", Running, Paused); err != nil {
+		return err
+	}
+	return c.Sandbox.SetSchedPolicy(c.ID, pid, policy)
+}
+
+// PrivilegeState returns the no_new_privs and securebits state of process
+// pid. If pid is 0, the container's init process is used.
+func (c *Container) PrivilegeState(pid int32) (*boot.PrivilegeState, error) {
+	log.Debugf("Getting privilege state of process %d in container, cid: %s", pid, c.ID)
+	if err := c.requireStatus("get privilege state in", Running, Paused); err != nil {
+		return nil, err
+	}
+	return c.Sandbox.PrivilegeState(c.ID, pid)
+}
+
+// PollObjects lists the epoll instances, eventfds and timerfds open in a
+// process in the container.
+func (c *Container) PollObjects(pid int32) (*boot.PollObjects, error) {
+	log.Debugf("Getting poll objects of process %d in container, cid: %s", pid, c.ID)
+	if err := c.requireStatus("get poll objects in", Running, Paused); err != nil {
+		return nil, err
+	}
+	return c.Sandbox.PollObjects(c.ID, pid)
+}
+
+// ForceUnmount lazily detaches the mount at target from the container, without
+// tearing down the container.
+func (c *Container) ForceUnmount(target string) error {
+	log.Debugf("Force unmounting %q in container, cid: %s", target, c.ID)
+	if err := c.requireStatus("force unmount in", Running, Paused); err != nil {
+		return err
+	}
+	return c.Sandbox.ForceUnmount(c.ID, target)
+}
+
+// TightenSyscallPolicy restricts the syscalls that the container may invoke.
+// Syscalls that are already denied can't be re-enabled.
+func (c *Container) TightenSyscallPolicy(policy boot.SyscallPolicy) error {
+	log.Debugf("Tightening syscall policy of container, cid: %s, policy: %+v", c.ID, policy)
+	if err := c.requireStatus("tighten syscall policy of", Running, Paused); err != nil {
+		return err
+	}
+	return c.Sandbox.TightenSyscallPolicy(c.ID, policy)
+}
+
+// ExportState returns a JSON-friendly snapshot of the container's state. The
+// snapshot is lossy and can't be used to restore the container.
+func (c *Container) ExportState() (*boot.ContainerState, error) {
+	log.Debugf("Exporting state of container, cid: %s", c.ID)
+	if err := c.requireStatus("export state of", Running, Paused); err != nil {
+		return nil, err
+	}
+	return c.Sandbox.ExportState(c.ID)
+}
+
 // SandboxPid returns the Getpid of the sandbox the container is running in, or -1 if the
 // container is not running.
 func (c *Container) SandboxPid() int {
@@ -554,6 +859,52 @@ func (c *Container) Wait() (unix.WaitStatus, error) {
 	return ws, err
 }
 
+// WaitNoHang is like Wait, but returns an error wrapping boot.ErrStillRunning
+// right away if the container hasn't exited yet.
+func (c *Container) WaitNoHang() (unix.WaitStatus, error) {
+	log.Debugf("Wait on container without blocking, cid: %s", c.ID)
+	ws, err := c.Sandbox.WaitNoHang(c.ID)
+	if err == nil {
+		// Wait succeeded, container is not running anymore.
+		c.changeStatus(Stopped)
+	}
+	return ws, err
+}
+
+// WaitAll returns the exit status of all processes exec'd in the container
+// that have exited but haven't been waited for yet. It doesn't wait for
+// processes that are still running.
+func (c *Container) WaitAll() ([]boot.ProcessExitStatus, error) {
+	log.Debugf("Wait on all exited processes in container, cid: %s", c.ID)
+	if !c.IsSandboxRunning() {
+		return nil, fmt.Errorf("sandbox is not running")
+	}
+	return c.Sandbox.WaitAll(c.ID)
+}
+
+// WaitDetailed waits for the container to exit, and returns how it exited.
+func (c *Container) WaitDetailed() (*boot.ExitResult, error) {
+	log.Debugf("Wait on container with detailed result, cid: %s", c.ID)
+	result, err := c.Sandbox.WaitDetailed(c.ID)
+	if err == nil {
+		// Wait succeeded, container is not running anymore.
+		c.changeStatus(Stopped)
+	}
+	return result, err
+}
+
+// WaitOCI waits for the container to exit, and returns its raw wait status
+// along with its exit status translated to the OCI convention.
+func (c *Container) WaitOCI() (*boot.WaitResult, error) {
+	log.Debugf("Wait on container with OCI exit status, cid: %s", c.ID)
+	result, err := c.Sandbox.WaitOCI(c.ID)
+	if err == nil {
+		// Wait succeeded, container is not running anymore.
+		c.changeStatus(Stopped)
+	}
+	return result, err
+}
+
 // WaitRootPID waits for process 'pid' in the sandbox's PID namespace and
 // returns its WaitStatus.
 func (c *Container) WaitRootPID(pid int32) (unix.WaitStatus, error) {
@@ -574,6 +925,17 @@ func (c *Container) WaitPID(pid int32) (unix.WaitStatus, error) {
 	return c.Sandbox.WaitPID(c.ID, pid)
 }
 
+// WaitPIDTimeout is like WaitPID, but gives up after timeout unless it's 0.
+// The returned error wraps boot.ErrWaitTimeout if the process hasn't exited
+// by then, and the process can be waited for again.
+func (c *Container) WaitPIDTimeout(pid int32, timeout time.Duration) (unix.WaitStatus, error) {
+	log.Debugf("Wait on process %d in container, cid: %s, timeout: %v", pid, c.ID, timeout)
+	if !c.IsSandboxRunning() {
+		return 0, fmt.Errorf("sandbox is not running")
+	}
+	return c.Sandbox.WaitPIDTimeout(c.ID, pid, timeout)
+}
+
 // SignalContainer sends the signal to the container. If all is true and signal
 // is SIGKILL, then waits for all processes to exit before returning.
 // SignalContainer returns an error if the container is already stopped.
@@ -606,6 +968,48 @@ func (c *Container) SignalProcess(sig unix.Signal, pid int32) error {
 	return c.Sandbox.SignalProcess(c.ID, int32(pid), sig, false)
 }
 
+// QueueSignal sends the realtime signal sig to a specific process in the
+// container, passing value to its handler like sigqueue(3).
+func (c *Container) QueueSignal(sig unix.Signal, pid int32, value int64) error {
+	log.Debugf("Queue signal to process %d in container, cid: %s, signal: %v (%d), value: %d", pid, c.ID, sig, sig, value)
+	if s := linux.Signal(sig); !s.IsValid() || !s.IsRealtime() {
+		return fmt.Errorf("signal %v is not a realtime signal", sig)
+	}
+	if err := c.requireStatus("queue a signal to a process inside", Running); err != nil {
+		return err
+	}
+	if !c.IsSandboxRunning() {
+		return fmt.Errorf("sandbox is not running")
+	}
+	return c.Sandbox.QueueSignal(c.ID, pid, sig, value)
+}
+
+// SignalProcessGroup sends sig to all processes of the container in process
+// group pgid, which is relative to the container's PID namespace. It returns
+// the number of processes signaled.
+func (c *Container) SignalProcessGroup(sig unix.Signal, pgid int32) (int, error) {
+	log.Debugf("Signal process group %d in container, cid: %s, signal: %v (%d)", pgid, c.ID, sig, sig)
+	if err := c.requireStatus("signal a process group inside", Running); err != nil {
+		return 0, err
+	}
+	if !c.IsSandboxRunning() {
+		return 0, fmt.Errorf("sandbox is not running")
+	}
+	return c.Sandbox.SignalProcessGroup(c.ID, pgid, sig)
+}
+
+// ResizeTTY sets the window size of the TTY of a process in the container,
+// e.g. one started with exec with StdioIsPty set, and sends SIGWINCH to the
+// TTY's foreground process group. If pid is 0, the container init process is
+// used.
+func (c *Container) ResizeTTY(pid int32, rows, cols uint16) error {
+	log.Debugf("Resize TTY of process %d in container, cid: %s, size: %dx%d", pid, c.ID, cols, rows)
+	if err := c.requireStatus("resize the TTY of a process inside", Running); err != nil {
+		return err
+	}
+	return c.Sandbox.ResizeTTY(c.ID, pid, rows, cols)
+}
+
 // ForwardSignals forwards all signals received by the current process to the
 // container process inside the sandbox. It returns a function that will stop
 // forwarding signals.
@@ -624,7 +1028,8 @@ func (c *Container) ForwardSignals(pid int32, fgProcess bool) func() {
 }
 
 // Checkpoint sends the checkpoint call to the container.
-// The statefile will be written to f, the file at the specified image-path.
+// The statefile will be written to f, the file at the specified image-path or
+// a socket streaming the state to its destination.
 func (c *Container) Checkpoint(f *os.File) error {
 	log.Debugf("Checkpoint container, cid: %s", c.ID)
 	if err := c.requireStatus("checkpoint", Created, Running, Paused); err != nil {
@@ -633,6 +1038,47 @@ func (c *Container) Checkpoint(f *os.File) error {
 	return c.Sandbox.Checkpoint(c.ID, f)
 }
 
+// CheckpointCompression is like Checkpoint, but compresses the statefile as
+// selected by compression.
+func (c *Container) CheckpointCompression(f *os.File, compression statefile.Compression) error {
+	log.Debugf("Checkpoint container, cid: %s, compression: %q", c.ID, compression)
+	if err := c.requireStatus("checkpoint", Created, Running, Paused); err != nil {
+		return err
+	}
+	return c.Sandbox.CheckpointCompression(c.ID, f, compression)
+}
+
+// CheckpointWithOpts is like Checkpoint, but takes the options of the save.
+func (c *Container) CheckpointWithOpts(f *os.File, opts control.SaveOpts) error {
+	log.Debugf("Checkpoint container, cid: %s, compression: %q", c.ID, opts.Compression)
+	if err := c.requireStatus("checkpoint", Created, Running, Paused); err != nil {
+		return err
+	}
+	return c.Sandbox.CheckpointWithOpts(c.ID, f, opts)
+}
+
+// CheckpointContainer is meant to save the state of this container only. It's
+// deferred and always fails with boot.ErrCodeUnimplemented, see
+// boot.containerManager.CheckpointContainer. Use Checkpoint instead.
+func (c *Container) CheckpointContainer(f *os.File) error {
+	log.Debugf("Checkpoint single container, cid: %s", c.ID)
+	if err := c.requireStatus("checkpoint", Created, Running, Paused); err != nil {
+		return err
+	}
+	return c.Sandbox.CheckpointContainer(c.ID, f)
+}
+
+// SetCheckpointFile sets the file that the sandbox is checkpointed to when the
+// checkpoint signal (see config.Config.CheckpointSignal) is sent to the root
+// container's init process.
+func (c *Container) SetCheckpointFile(f *os.File) error {
+	log.Debugf("Set checkpoint file, cid: %s", c.ID)
+	if err := c.requireStatus("set checkpoint file in", Created, Running, Paused); err != nil {
+		return err
+	}
+	return c.Sandbox.SetCheckpointFile(f)
+}
+
 // Pause suspends the container and its kernel.
 // The call only succeeds if the container's status is created or running.
 func (c *Container) Pause() error {
@@ -672,6 +1118,20 @@ func (c *Container) Resume() error {
 	return c.saveLocked()
 }
 
+// SandboxStatus returns the lifecycle state of the container as seen by the
+// sandbox. Unlike c.Status, which is only updated by runsc, it also reflects
+// the container init process exiting on its own.
+func (c *Container) SandboxStatus() (boot.ContainerStatus, error) {
+	log.Debugf("Getting sandbox status of container, cid: %s", c.ID)
+	if err := c.requireStatus("get sandbox status of", Created, Running, Paused, Stopped); err != nil {
+		return boot.ContainerStatus{}, err
+	}
+	if c.Sandbox == nil {
+		return boot.ContainerStatus{}, fmt.Errorf("container %q has been destroyed", c.ID)
+	}
+	return c.Sandbox.ContainerStatus(c.ID)
+}
+
 // Cat prints out the content of the files.
 func (c *Container) Cat(files []string, out *os.File) error {
 	log.Debugf("Cat in container, cid: %s, files: %+v", c.ID, files)
@@ -723,9 +1183,46 @@ func (c *Container) Processes() ([]*control.Process, error) {
 	return c.Sandbox.Processes(c.ID)
 }
 
+// ProcessTree retrieves the processes of the container arranged in trees by
+// parent, rooted at the container init and at processes started with exec.
+func (c *Container) ProcessTree() ([]*control.Process, error) {
+	if err := c.requireStatus("get processes of", Running, Paused); err != nil {
+		return nil, err
+	}
+	return c.Sandbox.ProcessTree(c.ID)
+}
+
+// DefaultPreExitTimeout is how long DestroyWithArgs waits for the pre-exit
+// hook to exit if DestroyArgs.PreExitTimeout isn't set.
+const DefaultPreExitTimeout = 10 * time.Second
+
+// DestroyArgs are optional arguments to DestroyWithArgs.
+type DestroyArgs struct {
+	// PreExitHook is a command to run inside the container before its
+	// processes are killed, e.g. to flush buffers or deregister from service
+	// discovery. It's skipped if nil or if the container isn't running.
+	PreExitHook *control.ExecArgs
+
+	// PreExitTimeout is how long to wait for PreExitHook to exit before
+	// destroying the container anyway. Zero means DefaultPreExitTimeout.
+	PreExitTimeout time.Duration
+
+	// GracePeriod, if not zero, is how long the container init is given to
+	// exit after SIGTERM before the container is killed with SIGKILL.
+	// Otherwise, the container is killed right away.
+	GracePeriod time.Duration
+}
+
 // Destroy stops all processes and frees all resources associated with the
 // container.
 func (c *Container) Destroy() error {
+	return c.DestroyWithArgs(nil, DestroyArgs{})
+}
+
+// DestroyWithArgs is like Destroy, but it first runs args.PreExitHook inside
+// the container, if set. Failures of the hook are logged and don't prevent the
+// container from being destroyed. conf is only used to run the hook.
+func (c *Container) DestroyWithArgs(conf *config.Config, args DestroyArgs) error {
 	log.Debugf("Destroy container, cid: %s", c.ID)
 
 	if err := c.Saver.lock(); err != nil {
@@ -736,6 +1233,10 @@ func (c *Container) Destroy() error {
 		_ = c.Saver.close()
 	}()
 
+	if args.PreExitHook != nil {
+		c.runPreExitHook(conf, args.PreExitHook, args.PreExitTimeout)
+	}
+
 	// Stored for later use as stop() sets c.Sandbox to nil.
 	sb := c.Sandbox
 
@@ -748,7 +1249,7 @@ func (c *Container) Destroy() error {
 	// do our best to perform all of the cleanups. Hence, we keep a slice
 	// of errors return their concatenation.
 	var errs []string
-	if err := c.stop(); err != nil {
+	if err := c.stop(args.GracePeriod); err != nil {
 		err = fmt.Errorf("stopping container: %v", err)
 		log.Warningf("%v", err)
 		errs = append(errs, err.Error())
@@ -804,15 +1305,42 @@ func (c *Container) saveLocked() error {
 	return nil
 }
 
+// runPreExitHook executes hook inside the container and waits for it to exit.
+// The sandbox kills the hook if it's still running after timeout. Errors are
+// only logged.
+func (c *Container) runPreExitHook(conf *config.Config, hook *control.ExecArgs, timeout time.Duration) {
+	if c.Sandbox == nil || c.Status != Running {
+		log.Warningf("Skipping pre-exit hook of container %q in state %s", c.ID, c.Status)
+		return
+	}
+	if timeout == 0 {
+		timeout = DefaultPreExitTimeout
+	}
+
+	hook.ContainerID = c.ID
+	ws, err := c.Sandbox.RunPreExitHook(conf, hook, timeout)
+	if err != nil {
+		log.Warningf("Pre-exit hook of container %q: %v", c.ID, err)
+		return
+	}
+	if ws.Signaled() || ws.ExitStatus() != 0 {
+		log.Warningf("Pre-exit hook of container %q failed, status: %#x", c.ID, ws)
+		return
+	}
+	log.Debugf("Pre-exit hook of container %q succeeded", c.ID)
+}
+
 // stop stops the container (for regular containers) or the sandbox (for
 // root containers), and waits for the container or sandbox and the gofer
 // to stop. If any of them doesn't stop before timeout, an error is returned.
-func (c *Container) stop() error {
+// If grace isn't zero, the container init is first given that long to exit
+// after SIGTERM.
+func (c *Container) stop(grace time.Duration) error {
 	var parentCgroup cgroup.Cgroup
 
 	if c.Sandbox != nil {
 		log.Debugf("Destroying container, cid: %s", c.ID)
-		if err := c.Sandbox.DestroyContainer(c.ID); err != nil {
+		if err := c.Sandbox.DestroyContainerGracefully(c.ID, grace); err != nil {
 			return fmt.Errorf("destroying container %q: %v", c.ID, err)
 		}
 		// Only uninstall parentCgroup for sandbox stop.
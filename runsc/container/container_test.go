@@ -15,7 +15,10 @@
 package container
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -38,10 +41,12 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/control"
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sentry/kernel/auth"
+	"gvisor.dev/gvisor/pkg/sentry/limits"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/test/testutil"
 	"gvisor.dev/gvisor/pkg/urpc"
+	"gvisor.dev/gvisor/runsc/boot"
 	"gvisor.dev/gvisor/runsc/config"
 	"gvisor.dev/gvisor/runsc/flag"
 	"gvisor.dev/gvisor/runsc/specutils"
@@ -440,6 +445,35 @@ func sleepSpecConf(t *testing.T) (*specs.Spec, *config.Config) {
 	return testutil.NewSpecWithArgs("sleep", "1000"), testutil.TestConfig(t)
 }
 
+// startContainer sets up the bundle and root directories for spec, then creates
+// and starts a container from it. The returned cleanup function destroys the
+// container and removes the directories.
+func startContainer(conf *config.Config, spec *specs.Spec) (*Container, func(), error) {
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error setting up container: %v", err)
+	}
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("error creating container: %v", err)
+	}
+	destroy := func() {
+		cont.Destroy()
+		cleanup()
+	}
+	if err := cont.Start(conf); err != nil {
+		destroy()
+		return nil, nil, fmt.Errorf("error starting container: %v", err)
+	}
+	return cont, destroy, nil
+}
+
 // TestLifecycle tests the basic Create/Start/Signal/Destroy container lifecycle.
 // It verifies after each step that the container can be loaded from disk, and
 // has the correct status.
@@ -1204,6 +1238,188 @@ func TestCheckpointRestore(t *testing.T) {
 	}
 }
 
+// TestCheckpointRestoreSocket checks that a container can be checkpointed
+// directly into a socket and restored from the other end of it.
+func TestCheckpointRestoreSocket(t *testing.T) {
+	// Skip overlay because test requires writing to host file.
+	for name, conf := range configs(t, true /* noOverlay */) {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir(testutil.TmpDir(), "checkpoint-test")
+			if err != nil {
+				t.Fatalf("ioutil.TempDir failed: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			if err := os.Chmod(dir, 0777); err != nil {
+				t.Fatalf("error chmoding file: %q, %v", dir, err)
+			}
+
+			outputPath := filepath.Join(dir, "output")
+			outputFile, err := createWriteableOutputFile(outputPath)
+			if err != nil {
+				t.Fatalf("error creating output file: %v", err)
+			}
+			defer outputFile.Close()
+
+			script := fmt.Sprintf("for ((i=0; ;i++)); do echo $i >> %q; sleep 1; done", outputPath)
+			spec := testutil.NewSpecWithArgs("bash", "-c", script)
+			_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+			if err != nil {
+				t.Fatalf("error setting up container: %v", err)
+			}
+			defer cleanup()
+
+			// Create and start the container.
+			args := Args{
+				ID:        testutil.RandomContainerID(),
+				Spec:      spec,
+				BundleDir: bundleDir,
+			}
+			cont, err := New(conf, args)
+			if err != nil {
+				t.Fatalf("error creating container: %v", err)
+			}
+			defer cont.Destroy()
+			if err := cont.Start(conf); err != nil {
+				t.Fatalf("error starting container: %v", err)
+			}
+
+			// Wait until application has ran.
+			if err := waitForFileNotEmpty(outputFile); err != nil {
+				t.Fatalf("Failed to wait for output file: %v", err)
+			}
+
+			fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+			if err != nil {
+				t.Fatalf("unix.Socketpair failed: %v", err)
+			}
+			saveSock := os.NewFile(uintptr(fds[0]), "save-socket")
+			restoreSock := os.NewFile(uintptr(fds[1]), "restore-socket")
+			defer restoreSock.Close()
+
+			// Create the container to restore into.
+			args2 := Args{
+				ID:        testutil.RandomContainerID(),
+				Spec:      spec,
+				BundleDir: bundleDir,
+			}
+			cont2, err := New(conf, args2)
+			if err != nil {
+				t.Fatalf("error creating container: %v", err)
+			}
+			defer cont2.Destroy()
+
+			// The state doesn't fit in the socket buffer, so checkpoint and
+			// restore must run concurrently.
+			saveErr := make(chan error, 1)
+			go func() {
+				defer saveSock.Close()
+				saveErr <- cont.Checkpoint(saveSock)
+			}()
+
+			if err := cont2.RestoreFromFile(spec, conf, restoreSock); err != nil {
+				t.Fatalf("error restoring container: %v", err)
+			}
+			if err := <-saveErr; err != nil {
+				t.Fatalf("error checkpointing container into socket: %v", err)
+			}
+
+			lastNum, err := readOutputNum(outputPath, -1)
+			if err != nil {
+				t.Fatalf("error with outputFile: %v", err)
+			}
+
+			// Check that the restored application keeps running.
+			op := func() error {
+				num, err := readOutputNum(outputPath, -1)
+				if err != nil {
+					return err
+				}
+				if num <= lastNum {
+					return fmt.Errorf("restored container hasn't made progress, last number: %d", num)
+				}
+				return nil
+			}
+			if err := testutil.Poll(op, 30*time.Second); err != nil {
+				t.Fatalf("error waiting for restored container: %v", err)
+			}
+		})
+	}
+}
+
+// TestRestoreInvalidStateFile checks that restoring an invalid state file
+// fails without affecting the running kernel.
+func TestRestoreInvalidStateFile(t *testing.T) {
+	conf := testutil.TestConfig(t)
+	// Restore sets up the network again, which is a no-op with hostinet.
+	conf.Network = config.NetworkHost
+	spec := testutil.NewSpecWithArgs("sleep", "1000")
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+	}{
+		{
+			name: "garbage",
+			data: []byte("this is not a state file"),
+		},
+		{
+			// The magic header followed by a truncated metadata length.
+			name: "truncated",
+			data: []byte("\x67\x56\x69\x73\x6f\x72\x53\x46\x00\x00"),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := ioutil.TempFile(testutil.TmpDir(), "state")
+			if err != nil {
+				t.Fatalf("error creating state file: %v", err)
+			}
+			defer os.Remove(f.Name())
+			defer f.Close()
+			if _, err := f.Write(tc.data); err != nil {
+				t.Fatalf("error writing state file: %v", err)
+			}
+			if _, err := f.Seek(0, 0); err != nil {
+				t.Fatalf("error seeking state file: %v", err)
+			}
+
+			if err := cont.Sandbox.RestoreFromFile(cont.ID, spec, conf, f); err == nil {
+				t.Fatalf("restoring from an invalid state file succeeded")
+			}
+
+			// The running kernel must be unaffected.
+			if ws, err := execute(conf, cont, "/bin/true"); err != nil || ws != 0 {
+				t.Errorf("exec after failed restore got status: %v, err: %v, want: 0", ws, err)
+			}
+			expectedPL := []*control.Process{
+				newProcessBuilder().PID(1).Cmd("sleep").Process(),
+			}
+			if err := waitForProcessList(cont, expectedPL); err != nil {
+				t.Errorf("container is not running after failed restore: %v", err)
+			}
+		})
+	}
+}
+
 // TestUnixDomainSockets checks that Checkpoint/Restore works in cases
 // with filesystem Unix Domain Socket use.
 func TestUnixDomainSockets(t *testing.T) {
@@ -1418,6 +1634,69 @@ func TestPauseResume(t *testing.T) {
 	}
 }
 
+// TestSandboxStatus checks that the sandbox reports the lifecycle state of a
+// container as it's started, paused, resumed and exits.
+func TestSandboxStatus(t *testing.T) {
+	spec, conf := sleepSpecConf(t)
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+
+	checkState := func(want boot.ContainerLifecycleState) boot.ContainerStatus {
+		t.Helper()
+		status, err := cont.SandboxStatus()
+		if err != nil {
+			t.Fatalf("SandboxStatus() failed: %v", err)
+		}
+		if status.State != want {
+			t.Errorf("SandboxStatus() state got: %v, want: %v", status.State, want)
+		}
+		return status
+	}
+
+	checkState(boot.ContainerCreated)
+
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+	if status := checkState(boot.ContainerRunning); status.PID == 0 {
+		t.Errorf("SandboxStatus() of running container has no PID: %+v", status)
+	}
+
+	if err := cont.Pause(); err != nil {
+		t.Fatalf("error pausing container: %v", err)
+	}
+	checkState(boot.ContainerPaused)
+	if err := cont.Resume(); err != nil {
+		t.Fatalf("error resuming container: %v", err)
+	}
+	checkState(boot.ContainerRunning)
+
+	if err := cont.SignalContainer(unix.SIGKILL, false); err != nil {
+		t.Fatalf("error killing container: %v", err)
+	}
+	if _, err := cont.Wait(); err != nil {
+		t.Fatalf("error waiting for container: %v", err)
+	}
+	status := checkState(boot.ContainerStopped)
+	if ws := unix.WaitStatus(status.ExitStatus); !ws.Signaled() || ws.Signal() != unix.SIGKILL {
+		t.Errorf("SandboxStatus() exit status got: %#x, want killed by SIGKILL", status.ExitStatus)
+	}
+}
+
 // TestPauseResumeStatus makes sure that the statuses are set correctly
 // with calls to pause and resume and that pausing and resuming only
 // occurs given the correct state.
@@ -1477,6 +1756,2396 @@ func TestPauseResumeStatus(t *testing.T) {
 	}
 }
 
+// TestPendingSignals checks that signals queued on a container's init process
+// are reported and can be flushed without being delivered.
+func TestPendingSignals(t *testing.T) {
+	spec, conf := sleepSpecConf(t)
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	if pending, err := cont.PendingSignals(false); err != nil {
+		t.Fatalf("PendingSignals() failed: %v", err)
+	} else if len(pending) != 0 {
+		t.Errorf("PendingSignals() got: %+v, want: none", pending)
+	}
+
+	// Pause the container so that the signal stays queued, as if it was
+	// blocked.
+	if err := cont.Pause(); err != nil {
+		t.Fatalf("error pausing container: %v", err)
+	}
+	if err := cont.Sandbox.SignalContainer(cont.ID, unix.SIGUSR1, false); err != nil {
+		t.Fatalf("error signaling container: %v", err)
+	}
+
+	pending, err := cont.PendingSignals(false)
+	if err != nil {
+		t.Fatalf("PendingSignals() failed: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Signo != int32(unix.SIGUSR1) {
+		t.Fatalf("PendingSignals() got: %+v, want: SIGUSR1", pending)
+	}
+
+	// Flush the signal, it must not be reported again nor delivered.
+	if _, err := cont.PendingSignals(true); err != nil {
+		t.Fatalf("PendingSignals(flush) failed: %v", err)
+	}
+	if pending, err := cont.PendingSignals(false); err != nil {
+		t.Fatalf("PendingSignals() failed: %v", err)
+	} else if len(pending) != 0 {
+		t.Errorf("PendingSignals() after flush got: %+v, want: none", pending)
+	}
+	if err := cont.Resume(); err != nil {
+		t.Fatalf("error resuming container: %v", err)
+	}
+
+	// SIGUSR1 would have killed sleep. Give it a bit of time to be delivered
+	// in case flush didn't work, and check that sleep is still running.
+	time.Sleep(200 * time.Millisecond)
+	expectedPL := []*control.Process{
+		newProcessBuilder().Cmd("sleep").Process(),
+	}
+	if err := waitForProcessList(cont, expectedPL); err != nil {
+		t.Errorf("container isn't running after flushing signals: %v", err)
+	}
+}
+
+// TestReadMemory checks that the memory of a process in the container can be
+// read, and that reading unmapped memory fails.
+func TestReadMemory(t *testing.T) {
+	spec, conf := sleepSpecConf(t)
+	conf.DebugMemoryAccess = true
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	// Find the mapping of the start of the sleep binary, which contains the
+	// ELF header.
+	out, err := executeCombinedOutput(conf, cont, "/bin/cat", "/proc/1/maps")
+	if err != nil {
+		t.Fatalf("error reading /proc/1/maps: %v", err)
+	}
+	var addr uint64
+	for _, line := range strings.Split(string(out), "\n") {
+		// Format: <start>-<end> <perms> <offset> <dev> <inode> <path>
+		fields := strings.Fields(line)
+		if len(fields) < 6 || fields[2] != "00000000" || !strings.HasPrefix(fields[5], "/") {
+			continue
+		}
+		addr, err = strconv.ParseUint(strings.Split(fields[0], "-")[0], 16, 64)
+		if err != nil {
+			t.Fatalf("invalid mapping %q: %v", line, err)
+		}
+		break
+	}
+	if addr == 0 {
+		t.Fatalf("no file mapping found in /proc/1/maps:\n%s", out)
+	}
+
+	buf, err := cont.ReadMemory(1, addr, 4)
+	if err != nil {
+		t.Fatalf("ReadMemory(%#x) failed: %v", addr, err)
+	}
+	if want := "\x7fELF"; string(buf) != want {
+		t.Errorf("ReadMemory(%#x) got: %q, want: %q", addr, buf, want)
+	}
+
+	// The first page is never mapped.
+	if _, err := cont.ReadMemory(1, 0, 4); err == nil {
+		t.Errorf("ReadMemory(0) succeeded, want error")
+	}
+	// Too large requests are rejected.
+	if _, err := cont.ReadMemory(1, addr, 1<<30); err == nil {
+		t.Errorf("ReadMemory(%#x, 1GB) succeeded, want error", addr)
+	}
+}
+
+// TestWriteMemory checks that the memory of a process in the container can be
+// modified, and that read-only memory is protected.
+func TestWriteMemory(t *testing.T) {
+	spec, conf := sleepSpecConf(t)
+	spec.Process.Env = append(spec.Process.Env, "GVISOR_TEST=aaaa")
+	conf.DebugMemoryAccess = true
+	conf.DebugMemoryWrite = true
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	// The environment is stored at the top of the stack, which is writable.
+	// Also find a read-only mapping.
+	out, err := executeCombinedOutput(conf, cont, "/bin/cat", "/proc/1/maps")
+	if err != nil {
+		t.Fatalf("error reading /proc/1/maps: %v", err)
+	}
+	var stackStart, stackEnd, roAddr uint64
+	for _, line := range strings.Split(string(out), "\n") {
+		// Format: <start>-<end> <perms> <offset> <dev> <inode> [<path>]
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+		var start, end uint64
+		if _, err := fmt.Sscanf(fields[0], "%x-%x", &start, &end); err != nil {
+			t.Fatalf("invalid mapping %q: %v", line, err)
+		}
+		if len(fields) == 6 && fields[5] == "[stack]" {
+			stackStart, stackEnd = start, end
+		} else if roAddr == 0 && fields[1][1] == '-' {
+			roAddr = start
+		}
+	}
+	if stackEnd == 0 || roAddr == 0 {
+		t.Fatalf("stack or read-only mapping not found in /proc/1/maps:\n%s", out)
+	}
+
+	// Find the environment variable at the top of the stack.
+	length := stackEnd - stackStart
+	if length > 1<<20 {
+		length = 1 << 20
+	}
+	buf, err := cont.ReadMemory(1, stackEnd-length, length)
+	if err != nil {
+		t.Fatalf("ReadMemory failed: %v", err)
+	}
+	idx := bytes.Index(buf, []byte("GVISOR_TEST=aaaa"))
+	if idx < 0 {
+		t.Fatalf("GVISOR_TEST not found in the stack")
+	}
+	addr := stackEnd - length + uint64(idx) + uint64(len("GVISOR_TEST="))
+	if err := cont.WriteMemory(1, addr, []byte("bbbb")); err != nil {
+		t.Fatalf("WriteMemory(%#x) failed: %v", addr, err)
+	}
+
+	// The process's environment, read from its memory, must reflect the change.
+	out, err = executeCombinedOutput(conf, cont, "/bin/cat", "/proc/1/environ")
+	if err != nil {
+		t.Fatalf("error reading /proc/1/environ: %v", err)
+	}
+	if !bytes.Contains(out, []byte("GVISOR_TEST=bbbb")) {
+		t.Errorf("/proc/1/environ doesn't contain the change: %q", out)
+	}
+
+	// Writing to read-only memory must fail.
+	if err := cont.WriteMemory(1, roAddr, []byte("x")); err == nil {
+		t.Errorf("WriteMemory(%#x) to read-only memory succeeded, want error", roAddr)
+	}
+}
+
+// TestSchedPolicy checks that the scheduling policy of a process can be set
+// and read back, and that policies the sentry can't honor are rejected.
+func TestSchedPolicy(t *testing.T) {
+	spec, conf := sleepSpecConf(t)
+	cont, cleanup, err := startContainer(conf, spec)
+	if err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+	defer cleanup()
+
+	want := boot.SchedPolicy{Policy: linux.SCHED_NORMAL}
+	if err := cont.SetSchedPolicy(1, want); err != nil {
+		t.Fatalf("SetSchedPolicy(%+v) failed: %v", want, err)
+	}
+	got, err := cont.SchedPolicy(1)
+	if err != nil {
+		t.Fatalf("SchedPolicy() failed: %v", err)
+	}
+	if *got != want {
+		t.Errorf("SchedPolicy() got: %+v, want: %+v", *got, want)
+	}
+
+	for _, tc := range []struct {
+		policy boot.SchedPolicy
+		want   urpc.ErrorCode
+	}{
+		{policy: boot.SchedPolicy{Policy: linux.SCHED_FIFO, Priority: 10}, want: boot.ErrCodeUnimplemented},
+		{policy: boot.SchedPolicy{Policy: linux.SCHED_RR, Priority: 10}, want: boot.ErrCodeUnimplemented},
+		{policy: boot.SchedPolicy{Policy: linux.SCHED_BATCH}, want: boot.ErrCodeUnimplemented},
+		{policy: boot.SchedPolicy{Policy: linux.SCHED_FIFO, Priority: 0}, want: boot.ErrCodeInvalidArgument},
+		{policy: boot.SchedPolicy{Policy: linux.SCHED_NORMAL, Priority: 10}, want: boot.ErrCodeInvalidArgument},
+		{policy: boot.SchedPolicy{Policy: 1234}, want: boot.ErrCodeInvalidArgument},
+	} {
+		if err := cont.SetSchedPolicy(1, tc.policy); urpc.CodeOf(err) != tc.want {
+			t.Errorf("SetSchedPolicy(%+v) got error: %v, want code %d", tc.policy, err, tc.want)
+		}
+	}
+	if got, err := cont.SchedPolicy(1); err != nil {
+		t.Fatalf("SchedPolicy() failed: %v", err)
+	} else if *got != want {
+		t.Errorf("SchedPolicy() after failures got: %+v, want: %+v", *got, want)
+	}
+}
+
+// TestPrivilegeState checks that no_new_privs and securebits are reported for
+// containers launched with and without no_new_privs.
+func TestPrivilegeState(t *testing.T) {
+	for _, noNewPrivs := range []bool{true, false} {
+		t.Run(fmt.Sprintf("noNewPrivs=%t", noNewPrivs), func(t *testing.T) {
+			spec, conf := sleepSpecConf(t)
+			spec.Process.NoNewPrivileges = noNewPrivs
+			cont, cleanup, err := startContainer(conf, spec)
+			if err != nil {
+				t.Fatalf("error starting container: %v", err)
+			}
+			defer cleanup()
+
+			want := boot.PrivilegeState{NoNewPrivs: noNewPrivs}
+			for _, pid := range []int32{0, 1} {
+				got, err := cont.PrivilegeState(pid)
+				if err != nil {
+					t.Fatalf("PrivilegeState(%d) failed: %v", pid, err)
+				}
+				if *got != want {
+					t.Errorf("PrivilegeState(%d) got: %+v, want: %+v", pid, *got, want)
+				}
+			}
+			if _, err := cont.PrivilegeState(1234); err == nil {
+				t.Errorf("PrivilegeState(1234) succeeded, want error")
+			}
+		})
+	}
+}
+
+// TestPollObjects checks that the epoll instances, eventfds and timerfds of a
+// process are listed.
+func TestPollObjects(t *testing.T) {
+	app, err := testutil.FindFile("test/cmd/test_app/test_app")
+	if err != nil {
+		t.Fatal("error finding test_app:", err)
+	}
+	conf := testutil.TestConfig(t)
+	spec := testutil.NewSpecWithArgs(app, "poll-objects", "--event-value=3")
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	// Wait for the app to register the fds with the epoll instance.
+	var objs *boot.PollObjects
+	cb := func() error {
+		var err error
+		objs, err = cont.PollObjects(1)
+		if err != nil {
+			return &backoff.PermanentError{Err: err}
+		}
+		if len(objs.Epolls) != 1 || len(objs.Epolls[0].Interests) != 2 {
+			return fmt.Errorf("epoll instance not set up yet: %+v", objs)
+		}
+		return nil
+	}
+	if err := testutil.Poll(cb, 30*time.Second); err != nil {
+		t.Fatalf("PollObjects() failed: %v", err)
+	}
+
+	if len(objs.EventFDs) != 1 || len(objs.TimerFDs) != 1 {
+		t.Fatalf("PollObjects() got: %+v, want one eventfd and one timerfd", objs)
+	}
+	efd, tfd := objs.EventFDs[0], objs.TimerFDs[0]
+	if efd.Value != 3 || efd.Semaphore {
+		t.Errorf("eventfd got: %+v, want value 3 without semaphore mode", efd)
+	}
+	if tfd.Clock != "monotonic" || tfd.Interval != time.Hour || tfd.Value <= 0 {
+		t.Errorf("timerfd got: %+v, want an armed monotonic timer with a 1h interval", tfd)
+	}
+	for i, fd := range []int32{efd.FD, tfd.FD} {
+		interest := objs.Epolls[0].Interests[i]
+		if interest.FD != fd || interest.Events != linux.EPOLLIN {
+			t.Errorf("epoll interest %d got: %+v, want fd %d with EPOLLIN", i, interest, fd)
+		}
+	}
+
+	if _, err := cont.PollObjects(1234); err == nil {
+		t.Errorf("PollObjects(1234) succeeded, want error")
+	}
+}
+
+// TestSignalProcessGroup checks that all members of a process group are
+// signaled.
+func TestSignalProcessGroup(t *testing.T) {
+	conf := testutil.TestConfig(t)
+	// The shell is the process group leader, and its children inherit the
+	// group.
+	spec := testutil.NewSpecWithArgs("sh", "-c", "sleep 1000 & sleep 1000 & wait")
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+	if err := waitForProcessCount(cont, 3); err != nil {
+		t.Fatalf("error waiting for processes: %v", err)
+	}
+
+	if _, err := cont.SignalProcessGroup(unix.SIGKILL, 1234); err == nil {
+		t.Errorf("SignalProcessGroup(1234) succeeded, want error")
+	}
+
+	count, err := cont.SignalProcessGroup(unix.SIGKILL, 1)
+	if err != nil {
+		t.Fatalf("SignalProcessGroup(1): %v", err)
+	}
+	if count != 3 {
+		t.Errorf("SignalProcessGroup(1) signaled %d processes, want: 3", count)
+	}
+	ws, err := cont.Wait()
+	if err != nil {
+		t.Fatalf("error waiting for container: %v", err)
+	}
+	if !ws.Signaled() || ws.Signal() != unix.SIGKILL {
+		t.Errorf("container exit status got: %v, want: killed by SIGKILL", ws)
+	}
+}
+
+// TestQueueSignal checks that the value queued with a realtime signal is
+// passed to the process.
+func TestQueueSignal(t *testing.T) {
+	app, err := testutil.FindFile("test/cmd/test_app/test_app")
+	if err != nil {
+		t.Fatal("error finding test_app:", err)
+	}
+	conf := testutil.TestConfig(t)
+	spec := testutil.NewSpecWithArgs("sleep", "1000")
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	// Skip the realtime signals used internally by glibc.
+	sig := unix.Signal(linux.FirstRTSignal + 4)
+	const value = 0x1234
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe(): %v", err)
+	}
+	defer r.Close()
+	execArgs := &control.ExecArgs{
+		Filename:    app,
+		Argv:        []string{app, "sigqueue-wait", fmt.Sprintf("--signal=%d", sig), fmt.Sprintf("--value=%d", value)},
+		FilePayload: urpc.FilePayload{Files: []*os.File{os.Stdin, w, w}},
+	}
+	pid, err := cont.Execute(conf, execArgs)
+	w.Close()
+	if err != nil {
+		t.Fatalf("error executing sigqueue-wait: %v", err)
+	}
+
+	// Wait for the signal to be blocked, otherwise it kills the process.
+	br := bufio.NewReader(r)
+	if line, err := br.ReadString('\n'); err != nil || line != "ready\n" {
+		t.Fatalf("reading sigqueue-wait output got: %q, %v, want: %q", line, err, "ready\n")
+	}
+
+	if err := cont.QueueSignal(unix.SIGUSR1, pid, value); err == nil {
+		t.Errorf("QueueSignal(SIGUSR1) succeeded, want error")
+	}
+	if err := cont.QueueSignal(sig, pid, value); err != nil {
+		t.Fatalf("QueueSignal(%v): %v", sig, err)
+	}
+	ws, err := cont.WaitPID(pid)
+	if err != nil {
+		t.Fatalf("WaitPID(%d): %v", pid, err)
+	}
+	if ws.ExitStatus() != 0 {
+		out, _ := ioutil.ReadAll(br)
+		t.Errorf("sigqueue-wait failed, status: %v, output: %s", ws, out)
+	}
+}
+
+// TestWaitNoHang checks that WaitNoHang doesn't block while the container is
+// running, and returns its exit status once it has exited.
+func TestWaitNoHang(t *testing.T) {
+	conf := testutil.TestConfig(t)
+	spec := testutil.NewSpecWithArgs("sleep", "1000")
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	if _, err := cont.WaitNoHang(); !errors.Is(err, boot.ErrStillRunning) {
+		t.Fatalf("WaitNoHang() got error: %v, want: %v", err, boot.ErrStillRunning)
+	}
+
+	if err := cont.SignalContainer(unix.SIGKILL, false); err != nil {
+		t.Fatalf("error killing container: %v", err)
+	}
+	var ws unix.WaitStatus
+	cb := func() error {
+		var err error
+		ws, err = cont.WaitNoHang()
+		if err != nil && !errors.Is(err, boot.ErrStillRunning) {
+			return &backoff.PermanentError{Err: err}
+		}
+		return err
+	}
+	if err := testutil.Poll(cb, 30*time.Second); err != nil {
+		t.Fatalf("WaitNoHang() failed: %v", err)
+	}
+	if !ws.Signaled() || ws.Signal() != unix.SIGKILL {
+		t.Errorf("container exit status got: %v, want: killed by SIGKILL", ws)
+	}
+}
+
+// TestWaitAll checks that WaitAll returns the exit status of exited exec'd
+// processes only once, and skips the ones still running.
+func TestWaitAll(t *testing.T) {
+	conf := testutil.TestConfig(t)
+	spec := testutil.NewSpecWithArgs("sleep", "1000")
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	exitPID, err := cont.Execute(conf, &control.ExecArgs{
+		Filename: "/bin/sh",
+		Argv:     []string{"sh", "-c", "exit 3"},
+	})
+	if err != nil {
+		t.Fatalf("error executing sh: %v", err)
+	}
+	if _, err := cont.Execute(conf, &control.ExecArgs{
+		Filename: "/bin/sleep",
+		Argv:     []string{"sleep", "1000"},
+	}); err != nil {
+		t.Fatalf("error executing sleep: %v", err)
+	}
+
+	var statuses []boot.ProcessExitStatus
+	cb := func() error {
+		var err error
+		statuses, err = cont.WaitAll()
+		if err != nil {
+			return &backoff.PermanentError{Err: err}
+		}
+		if len(statuses) == 0 {
+			return fmt.Errorf("no exited process yet")
+		}
+		return nil
+	}
+	if err := testutil.Poll(cb, 30*time.Second); err != nil {
+		t.Fatalf("WaitAll() failed: %v", err)
+	}
+	want := []boot.ProcessExitStatus{{PID: exitPID, ExitStatus: uint32(3 << 8)}}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("WaitAll() got: %+v, want: %+v", statuses, want)
+	}
+
+	// The exit status must have been cleared.
+	if statuses, err := cont.WaitAll(); err != nil || len(statuses) != 0 {
+		t.Errorf("WaitAll() got: %+v, err: %v, want: no status", statuses, err)
+	}
+}
+
+// TestWaitPIDClearStatus checks that only one of several concurrent WaitPID
+// calls gets the exit status of an exec'd process, as they clear it.
+func TestWaitPIDClearStatus(t *testing.T) {
+	conf := testutil.TestConfig(t)
+	spec := testutil.NewSpecWithArgs("sleep", "1000")
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	execArgs := &control.ExecArgs{
+		Filename: "/bin/sleep",
+		Argv:     []string{"sleep", "1"},
+	}
+	pid, err := cont.Execute(conf, execArgs)
+	if err != nil {
+		t.Fatalf("error executing sleep: %v", err)
+	}
+
+	const waiters = 2
+	errs := make(chan error, waiters)
+	for i := 0; i < waiters; i++ {
+		go func() {
+			_, err := cont.WaitPID(pid)
+			errs <- err
+		}()
+	}
+	succeeded := 0
+	for i := 0; i < waiters; i++ {
+		if err := <-errs; err == nil {
+			succeeded++
+		} else {
+			t.Logf("WaitPID(%d): %v", pid, err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d WaitPID calls got the exit status, want: 1", succeeded)
+	}
+}
+
+// TestExecuteSync checks that ExecuteSync returns the exit status of the
+// process and doesn't leave it to be waited for.
+func TestExecuteSync(t *testing.T) {
+	conf := testutil.TestConfig(t)
+	spec := testutil.NewSpecWithArgs("sleep", "1000")
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	for _, tc := range []struct {
+		argv []string
+		want unix.WaitStatus
+	}{
+		{argv: []string{"sh", "-c", "exit 0"}, want: 0},
+		{argv: []string{"sh", "-c", "exit 3"}, want: 3 << 8},
+		{argv: []string{"sh", "-c", "kill -TERM $$"}, want: unix.WaitStatus(unix.SIGTERM)},
+	} {
+		ws, err := cont.ExecuteSync(conf, &control.ExecArgs{
+			Filename: "/bin/sh",
+			Argv:     tc.argv,
+		})
+		if err != nil {
+			t.Fatalf("ExecuteSync(%v) failed: %v", tc.argv, err)
+		}
+		if ws != tc.want {
+			t.Errorf("ExecuteSync(%v) got status: %#x, want: %#x", tc.argv, ws, tc.want)
+		}
+	}
+
+	// The exit statuses have been returned, so they must have been cleared.
+	if statuses, err := cont.WaitAll(); err != nil || len(statuses) != 0 {
+		t.Errorf("WaitAll() got: %+v, err: %v, want: no status", statuses, err)
+	}
+}
+
+// TestExecuteTimeout checks that an exec'd process is killed once it exceeds
+// its timeout, and only then.
+func TestExecuteTimeout(t *testing.T) {
+	conf := testutil.TestConfig(t)
+	spec := testutil.NewSpecWithArgs("sleep", "1000")
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	ws, err := cont.ExecuteSync(conf, &control.ExecArgs{
+		Filename:  "/bin/sleep",
+		Argv:      []string{"sleep", "1000"},
+		TimeoutMs: 100,
+	})
+	if !errors.Is(err, boot.ErrExecTimeout) {
+		t.Fatalf("ExecuteSync(sleep 1000) got err: %v, want: %v", err, boot.ErrExecTimeout)
+	}
+	if !ws.Signaled() || ws.Signal() != unix.SIGKILL {
+		t.Errorf("ExecuteSync(sleep 1000) got status: %v, want killed by SIGKILL", ws)
+	}
+
+	// Processes that exit in time aren't affected, including when many run
+	// concurrently.
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ws, err := cont.ExecuteSync(conf, &control.ExecArgs{
+				Filename:  "/bin/true",
+				Argv:      []string{"true"},
+				TimeoutMs: 30000,
+			})
+			if err == nil && ws != 0 {
+				err = fmt.Errorf("got status: %v, want: 0", ws)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("ExecuteSync(true): %v", err)
+		}
+	}
+}
+
+// TestExecuteRlimits checks that resource limits can be overridden for an
+// exec'd process.
+func TestExecuteRlimits(t *testing.T) {
+	conf := testutil.TestConfig(t)
+	spec := testutil.NewSpecWithArgs("sleep", "1000")
+	spec.Process.Rlimits = []specs.POSIXRlimit{
+		{Type: "RLIMIT_NOFILE", Soft: 500, Hard: 500},
+	}
+	cont, cleanup, err := startContainer(conf, spec)
+	if err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+	defer cleanup()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe(): %v", err)
+	}
+	defer r.Close()
+	ws, err := cont.ExecuteSync(conf, &control.ExecArgs{
+		Filename:    "/bin/sh",
+		Argv:        []string{"sh", "-c", "ulimit -Sn; ulimit -Hn"},
+		FilePayload: urpc.FilePayload{Files: []*os.File{os.Stdin, w, w}},
+		Rlimits: map[string]limits.Limit{
+			"RLIMIT_NOFILE": {Cur: 100, Max: 200},
+		},
+	})
+	w.Close()
+	if err != nil || ws != 0 {
+		t.Fatalf("ExecuteSync(ulimit) failed, status: %v, err: %v", ws, err)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("error reading output: %v", err)
+	}
+	if got, want := string(out), "100\n200\n"; got != want {
+		t.Errorf("ulimit got: %q, want: %q", got, want)
+	}
+
+	for _, rlimits := range []map[string]limits.Limit{
+		{"RLIMIT_FOO": {Cur: 1, Max: 1}},
+		{"RLIMIT_NOFILE": {Cur: 200, Max: 100}},
+		// Exceeds the container's hard limit.
+		{"RLIMIT_NOFILE": {Cur: 100, Max: 1000}},
+	} {
+		_, err := cont.ExecuteSync(conf, &control.ExecArgs{
+			Filename: "/bin/true",
+			Argv:     []string{"true"},
+			Rlimits:  rlimits,
+		})
+		if got := urpc.CodeOf(err); got != boot.ErrCodeInvalidArgument {
+			t.Errorf("ExecuteSync(true) with rlimits %+v: got code %d (err: %v), want %d", rlimits, got, err, boot.ErrCodeInvalidArgument)
+		}
+	}
+}
+
+// TestExecuteEnvMode checks that exec'd processes get only the given
+// environment in EnvReplace mode, and the container's environment overridden
+// by the given one in EnvMerge mode.
+func TestExecuteEnvMode(t *testing.T) {
+	conf := testutil.TestConfig(t)
+	spec := testutil.NewSpecWithArgs("sleep", "1000")
+	spec.Process.Env = append(spec.Process.Env, "FOO=init", "BAR=init")
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	for _, tc := range []struct {
+		mode    control.EnvMode
+		want    []string
+		notWant []string
+	}{
+		{
+			mode:    control.EnvReplace,
+			want:    []string{"BAR=exec", "BAZ=exec"},
+			notWant: []string{"FOO=init", "BAR=init"},
+		},
+		{
+			mode:    control.EnvMerge,
+			want:    []string{"FOO=init", "BAR=exec", "BAZ=exec"},
+			notWant: []string{"BAR=init"},
+		},
+	} {
+		t.Run(tc.mode.String(), func(t *testing.T) {
+			r, w, err := os.Pipe()
+			if err != nil {
+				t.Fatalf("os.Pipe(): %v", err)
+			}
+			defer r.Close()
+			ws, err := cont.ExecuteSync(conf, &control.ExecArgs{
+				Filename:    "/bin/cat",
+				Argv:        []string{"cat", "/proc/self/environ"},
+				Envv:        []string{"BAR=dup", "BAR=exec", "BAZ=exec"},
+				EnvMode:     tc.mode,
+				FilePayload: urpc.FilePayload{Files: []*os.File{os.Stdin, w, w}},
+			})
+			w.Close()
+			if err != nil || ws != 0 {
+				t.Fatalf("ExecuteSync(cat) failed, status: %v, err: %v", ws, err)
+			}
+			out, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("error reading output: %v", err)
+			}
+			env := make(map[string]bool)
+			for _, v := range strings.Split(string(out), "\x00") {
+				env[v] = true
+			}
+			for _, v := range tc.want {
+				if !env[v] {
+					t.Errorf("environment %q doesn't contain %q", out, v)
+				}
+			}
+			for _, v := range append(tc.notWant, "BAR=dup") {
+				if env[v] {
+					t.Errorf("environment %q contains %q", out, v)
+				}
+			}
+		})
+	}
+}
+
+// TestExecuteWorkingDirectory checks that exec'd processes run in the given
+// working directory, and that bad working directories are rejected.
+func TestExecuteWorkingDirectory(t *testing.T) {
+	conf := testutil.TestConfig(t)
+	spec := testutil.NewSpecWithArgs("sleep", "1000")
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe(): %v", err)
+	}
+	defer r.Close()
+	ws, err := cont.ExecuteSync(conf, &control.ExecArgs{
+		Filename:         "/bin/sh",
+		Argv:             []string{"sh", "-c", "pwd"},
+		WorkingDirectory: "/usr/../tmp/",
+		FilePayload:      urpc.FilePayload{Files: []*os.File{os.Stdin, w, w}},
+	})
+	w.Close()
+	if err != nil || ws != 0 {
+		t.Fatalf("ExecuteSync(pwd) failed, status: %v, err: %v", ws, err)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("error reading output: %v", err)
+	}
+	if got, want := string(out), "/tmp\n"; got != want {
+		t.Errorf("pwd got: %q, want: %q", got, want)
+	}
+
+	for _, tc := range []struct {
+		wd   string
+		want string
+	}{
+		{wd: "/does-not-exist", want: "no such directory"},
+		{wd: "/bin/sh", want: "not a directory"},
+		{wd: "/../tmp", want: "escapes the container root"},
+	} {
+		_, err := cont.Execute(conf, &control.ExecArgs{
+			Filename:         "/bin/true",
+			Argv:             []string{"true"},
+			WorkingDirectory: tc.wd,
+		})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Execute(true) in %q got error: %v, want error containing %q", tc.wd, err, tc.want)
+		}
+	}
+}
+
+// TestProcessesUsage checks that the process list reports the CPU time and
+// RSS of processes.
+func TestProcessesUsage(t *testing.T) {
+	conf := testutil.TestConfig(t)
+	spec := testutil.NewSpecWithArgs("/bin/sh", "-c", "while true; do :; done")
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	cb := func() error {
+		pss, err := cont.Processes()
+		if err != nil {
+			err = fmt.Errorf("error getting process data from container: %w", err)
+			return &backoff.PermanentError{Err: err}
+		}
+		for _, ps := range pss {
+			if ps.PID != 1 {
+				continue
+			}
+			if ps.UserTime+ps.SysTime == 0 {
+				return fmt.Errorf("spinning process has no CPU time: %+v", ps)
+			}
+			if ps.RSS == 0 {
+				return fmt.Errorf("spinning process has no RSS: %+v", ps)
+			}
+			return nil
+		}
+		return &backoff.PermanentError{Err: fmt.Errorf("PID 1 not found in %+v", pss)}
+	}
+	if err := testutil.Poll(cb, 30*time.Second); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestWaitPIDTimeout checks that WaitPID gives up after the timeout, and that
+// the process can be waited for again.
+func TestWaitPIDTimeout(t *testing.T) {
+	conf := testutil.TestConfig(t)
+	spec := testutil.NewSpecWithArgs("sleep", "1000")
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	execArgs := &control.ExecArgs{
+		Filename: "/bin/sleep",
+		Argv:     []string{"sleep", "1000"},
+	}
+	pid, err := cont.Execute(conf, execArgs)
+	if err != nil {
+		t.Fatalf("error executing sleep: %v", err)
+	}
+
+	if _, err := cont.WaitPIDTimeout(pid, 100*time.Millisecond); !errors.Is(err, boot.ErrWaitTimeout) {
+		t.Fatalf("WaitPIDTimeout(%d) got error: %v, want: %v", pid, err, boot.ErrWaitTimeout)
+	}
+
+	if err := cont.SignalProcess(unix.SIGKILL, pid); err != nil {
+		t.Fatalf("SignalProcess(SIGKILL, %d): %v", pid, err)
+	}
+	ws, err := cont.WaitPIDTimeout(pid, 30*time.Second)
+	if err != nil {
+		t.Fatalf("WaitPIDTimeout(%d): %v", pid, err)
+	}
+	if !ws.Signaled() || ws.Signal() != unix.SIGKILL {
+		t.Errorf("process exit status got: %v, want: killed by SIGKILL", ws)
+	}
+}
+
+// TestReinitializeNetwork checks that containers keep running after the
+// network stack is reinitialized, and that new connections can be made.
+func TestReinitializeNetwork(t *testing.T) {
+	app, err := testutil.FindFile("test/cmd/test_app/test_app")
+	if err != nil {
+		t.Fatal("error finding test_app:", err)
+	}
+	conf := testutil.TestConfig(t)
+	spec := testutil.NewSpecWithArgs("sleep", "1000")
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	if out, err := executeCombinedOutput(conf, cont, app, "tcp-ping"); err != nil {
+		t.Fatalf("tcp-ping failed before reinitializing: %v, output: %s", err, out)
+	}
+
+	// Reinitialize twice to check that the recreated links can be torn down
+	// again.
+	for i := 0; i < 2; i++ {
+		if err := cont.Sandbox.ReinitializeNetwork(); err != nil {
+			t.Fatalf("ReinitializeNetwork() failed: %v", err)
+		}
+		if err := waitForProcessList(cont, []*control.Process{newProcessBuilder().Cmd("sleep").Process()}); err != nil {
+			t.Fatalf("container not running after reinitializing the network: %v", err)
+		}
+		if out, err := executeCombinedOutput(conf, cont, app, "tcp-ping"); err != nil {
+			t.Fatalf("tcp-ping failed after reinitializing: %v, output: %s", err, out)
+		}
+	}
+}
+
+// TestWaitOCI checks that WaitOCI translates normal and signaled exits to the
+// OCI convention, and keeps the raw wait status.
+func TestWaitOCI(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		cmd    []string
+		signal unix.Signal
+		want   int
+	}{
+		{
+			name: "exited",
+			cmd:  []string{"/bin/sh", "-c", "exit 3"},
+			want: 3,
+		},
+		{
+			name:   "signaled",
+			cmd:    []string{"/bin/sleep", "1000"},
+			signal: unix.SIGKILL,
+			want:   128 + int(unix.SIGKILL),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			spec, conf := sleepSpecConf(t)
+			spec.Process.Args = tc.cmd
+			_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+			if err != nil {
+				t.Fatalf("error setting up container: %v", err)
+			}
+			defer cleanup()
+
+			// Create and start the container.
+			args := Args{
+				ID:        testutil.RandomContainerID(),
+				Spec:      spec,
+				BundleDir: bundleDir,
+			}
+			cont, err := New(conf, args)
+			if err != nil {
+				t.Fatalf("error creating container: %v", err)
+			}
+			defer cont.Destroy()
+			if err := cont.Start(conf); err != nil {
+				t.Fatalf("error starting container: %v", err)
+			}
+
+			if tc.signal != 0 {
+				if err := cont.SignalContainer(tc.signal, false); err != nil {
+					t.Fatalf("error signaling container: %v", err)
+				}
+			}
+			result, err := cont.WaitOCI()
+			if err != nil {
+				t.Fatalf("WaitOCI() failed: %v", err)
+			}
+			if result.ExitStatus != tc.want {
+				t.Errorf("WaitOCI() exit status got: %d, want: %d", result.ExitStatus, tc.want)
+			}
+			if tc.signal != 0 {
+				if !result.WaitStatus.Signaled() || result.WaitStatus.Signal() != tc.signal {
+					t.Errorf("WaitOCI() raw status got: %#x, want signaled with %v", uint32(result.WaitStatus), tc.signal)
+				}
+			} else if !result.WaitStatus.Exited() || result.WaitStatus.ExitStatus() != tc.want {
+				t.Errorf("WaitOCI() raw status got: %#x, want exited with %d", uint32(result.WaitStatus), tc.want)
+			}
+		})
+	}
+}
+
+// TestContextSwitches checks that the voluntary context switches reported for
+// a container grow while its processes block.
+func TestContextSwitches(t *testing.T) {
+	spec, conf := sleepSpecConf(t)
+	spec.Process.Args = []string{"/bin/sh", "-c", "while true; do sleep 0.01; done"}
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	evt, err := cont.Event()
+	if err != nil {
+		t.Fatalf("Event() failed: %v", err)
+	}
+	first := evt.Event.Data.CPU.ContextSwitches
+	if got := evt.ContainerVoluntarySwitches[cont.ID]; got != first.Voluntary {
+		t.Errorf("Event() voluntary switches got: %d, want: %d as in container map", first.Voluntary, got)
+	}
+
+	cb := func() error {
+		evt, err := cont.Event()
+		if err != nil {
+			return &backoff.PermanentError{Err: err}
+		}
+		if got := evt.Event.Data.CPU.ContextSwitches.Voluntary; got <= first.Voluntary {
+			return fmt.Errorf("voluntary context switches didn't grow, got: %d, first: %d", got, first.Voluntary)
+		}
+		return nil
+	}
+	if err := testutil.Poll(cb, 10*time.Second); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestInvoluntaryContextSwitches checks that the involuntary context switches
+// reported for a container with scheduling latency targets grow while more of
+// its processes are CPU-bound than there are CPUs.
+func TestInvoluntaryContextSwitches(t *testing.T) {
+	spec, conf := sleepSpecConf(t)
+	spec.Process.Args = []string{"/bin/sh", "-c", `
+n=$(($(nproc) + 1))
+while [ $n -gt 0 ]; do
+  (while :; do :; done) &
+  n=$((n - 1))
+done
+wait`}
+	cont, cleanup, err := startContainer(conf, spec)
+	if err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+	defer cleanup()
+
+	// Tasks are only preempted in containers with latency targets.
+	lat := boot.SchedLatency{Latency: 4 * linux.ClockTick, Timeslice: linux.ClockTick}
+	if err := cont.SetSchedLatency(lat); err != nil {
+		t.Fatalf("SetSchedLatency(%+v) failed: %v", lat, err)
+	}
+
+	evt, err := cont.Event()
+	if err != nil {
+		t.Fatalf("Event() failed: %v", err)
+	}
+	first := evt.Event.Data.CPU.ContextSwitches
+	if got := evt.ContainerInvoluntarySwitches[cont.ID]; got != first.Involuntary {
+		t.Errorf("Event() involuntary switches got: %d, want: %d as in container map", first.Involuntary, got)
+	}
+
+	cb := func() error {
+		evt, err := cont.Event()
+		if err != nil {
+			return &backoff.PermanentError{Err: err}
+		}
+		if got := evt.Event.Data.CPU.ContextSwitches.Involuntary; got <= first.Involuntary {
+			return fmt.Errorf("involuntary context switches didn't grow, got: %d, first: %d", got, first.Involuntary)
+		}
+		return nil
+	}
+	if err := testutil.Poll(cb, 10*time.Second); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestPageFaults checks that page faults taken by a container's processes are
+// reported by Event.
+func TestPageFaults(t *testing.T) {
+	spec, conf := sleepSpecConf(t)
+	// Each fork makes the shell's writable pages copy-on-write, so the shell
+	// keeps faulting on pages that it hasn't touched since.
+	spec.Process.Args = []string{"/bin/sh", "-c", "while true; do sleep 0.01; done"}
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	evt, err := cont.Event()
+	if err != nil {
+		t.Fatalf("Event() failed: %v", err)
+	}
+	first := evt.Event.Data.Memory.PageFaults
+	if got := evt.ContainerPageFaults[cont.ID]; got != first {
+		t.Errorf("Event() page faults got: %+v, want: %+v as in container map", first, got)
+	}
+
+	cb := func() error {
+		evt, err := cont.Event()
+		if err != nil {
+			return &backoff.PermanentError{Err: err}
+		}
+		if got := evt.Event.Data.Memory.PageFaults.Minor; got <= first.Minor {
+			return fmt.Errorf("minor page faults didn't grow, got: %d, first: %d", got, first.Minor)
+		}
+		return nil
+	}
+	if err := testutil.Poll(cb, 10*time.Second); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestEventMemoryAndCPU checks that Event reports the memory usage, peak and
+// limit of the container, and its CPU usage split into user and kernel time.
+func TestEventMemoryAndCPU(t *testing.T) {
+	conf := testutil.TestConfig(t)
+	spec := testutil.NewSpecWithArgs("/bin/sh", "-c", "while true; do :; done")
+	limit := int64(1 << 30)
+	spec.Linux = &specs.Linux{
+		Resources: &specs.LinuxResources{
+			Memory: &specs.LinuxMemory{Limit: &limit},
+		},
+	}
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	cb := func() error {
+		evt, err := cont.Event()
+		if err != nil {
+			return &backoff.PermanentError{Err: err}
+		}
+		mem := evt.Event.Data.Memory.Usage
+		if mem.Usage == 0 || mem.Max < mem.Usage {
+			return fmt.Errorf("bad memory usage: %+v", mem)
+		}
+		if mem.Limit != uint64(limit) {
+			return &backoff.PermanentError{Err: fmt.Errorf("memory limit got: %d, want: %d", mem.Limit, limit)}
+		}
+		cpu := evt.Event.Data.CPU.Usage
+		if cpu.User+cpu.Kernel == 0 {
+			return fmt.Errorf("no CPU usage: %+v", cpu)
+		}
+		if got := evt.ContainerCPU[cont.ID]; got.Total != got.User+got.Kernel {
+			return &backoff.PermanentError{Err: fmt.Errorf("CPU total %d isn't user %d + kernel %d", got.Total, got.User, got.Kernel)}
+		}
+		return nil
+	}
+	if err := testutil.Poll(cb, 10*time.Second); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestForceUnmount checks that a single mount can be detached from a running
+// container.
+func TestForceUnmount(t *testing.T) {
+	for name, conf := range configs(t, false /* noOverlay */) {
+		t.Run(name, func(t *testing.T) {
+			spec, _ := sleepSpecConf(t)
+			spec.Mounts = append(spec.Mounts, specs.Mount{
+				Destination: "/mnt",
+				Type:        "tmpfs",
+			})
+			_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+			if err != nil {
+				t.Fatalf("error setting up container: %v", err)
+			}
+			defer cleanup()
+
+			// Create and start the container.
+			args := Args{
+				ID:        testutil.RandomContainerID(),
+				Spec:      spec,
+				BundleDir: bundleDir,
+			}
+			cont, err := New(conf, args)
+			if err != nil {
+				t.Fatalf("error creating container: %v", err)
+			}
+			defer cont.Destroy()
+			if err := cont.Start(conf); err != nil {
+				t.Fatalf("error starting container: %v", err)
+			}
+
+			if err := cont.ForceUnmount("/mnt"); err != nil {
+				t.Fatalf("ForceUnmount(/mnt) failed: %v", err)
+			}
+			out, err := executeCombinedOutput(conf, cont, "/bin/cat", "/proc/self/mounts")
+			if err != nil {
+				t.Fatalf("exec failed: %v, out: %s", err, out)
+			}
+			if strings.Contains(string(out), " /mnt ") {
+				t.Errorf("/mnt still mounted after ForceUnmount:\n%s", out)
+			}
+
+			// The container keeps running.
+			if ws, err := execute(conf, cont, "/bin/true"); err != nil || ws != 0 {
+				t.Errorf("exec after ForceUnmount, status: %v, err: %v", ws, err)
+			}
+
+			for _, target := range []string{"/mnt", "/bin", "/nonexistent", "/"} {
+				if err := cont.ForceUnmount(target); err == nil {
+					t.Errorf("ForceUnmount(%s) succeeded, want error", target)
+				}
+			}
+		})
+	}
+}
+
+// TestSyscallPolicy checks that syscalls denied by the container's syscall
+// policy fail, while others keep working.
+func TestSyscallPolicy(t *testing.T) {
+	spec, conf := sleepSpecConf(t)
+	spec.Annotations = map[string]string{
+		boot.SyscallDenyAnnotation: "mkdir,mkdirat",
+	}
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	if ws, err := execute(conf, cont, "/bin/mkdir", "/tmp/denied"); err != nil || ws == 0 {
+		t.Errorf("mkdir succeeded with syscall denied, status: %v, err: %v", ws, err)
+	}
+	if ws, err := execute(conf, cont, "/bin/sh", "-c", "cd /tmp"); err != nil || ws != 0 {
+		t.Fatalf("cd failed, status: %v, err: %v", ws, err)
+	}
+
+	// Tighten the policy further, and check that it's enforced right away.
+	if err := cont.TightenSyscallPolicy(boot.SyscallPolicy{Syscalls: []string{"chdir"}}); err != nil {
+		t.Fatalf("TightenSyscallPolicy() failed: %v", err)
+	}
+	if ws, err := execute(conf, cont, "/bin/sh", "-c", "cd /tmp"); err != nil || ws == 0 {
+		t.Errorf("cd succeeded with syscall denied, status: %v, err: %v", ws, err)
+	}
+	if ws, err := execute(conf, cont, "/bin/mkdir", "/tmp/denied"); err != nil || ws == 0 {
+		t.Errorf("mkdir succeeded after tightening, status: %v, err: %v", ws, err)
+	}
+	if ws, err := execute(conf, cont, "/bin/true"); err != nil || ws != 0 {
+		t.Errorf("true failed, status: %v, err: %v", ws, err)
+	}
+
+	if err := cont.TightenSyscallPolicy(boot.SyscallPolicy{Syscalls: []string{"nonexistent"}}); err == nil {
+		t.Errorf("TightenSyscallPolicy() with unknown syscall succeeded, want error")
+	}
+}
+
+// TestSyscallPolicyRestore checks that syscall policies set on a running
+// container are kept across checkpoint and restore.
+func TestSyscallPolicyRestore(t *testing.T) {
+	dir, err := ioutil.TempDir(testutil.TmpDir(), "syscall-policy-test")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chmod(dir, 0777); err != nil {
+		t.Fatalf("error chmoding file: %q, %v", dir, err)
+	}
+
+	outputPath := filepath.Join(dir, "output")
+	outputFile, err := createWriteableOutputFile(outputPath)
+	if err != nil {
+		t.Fatalf("error creating output file: %v", err)
+	}
+	defer outputFile.Close()
+
+	newDir := filepath.Join(dir, "new")
+	script := fmt.Sprintf("while true; do if mkdir %q; then rmdir %q; echo created; else echo denied; fi >> %q; sleep 1; done", newDir, newDir, outputPath)
+	spec := testutil.NewSpecWithArgs("bash", "-c", script)
+	conf := testutil.TestConfig(t)
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+	if err := cont.TightenSyscallPolicy(boot.SyscallPolicy{Syscalls: []string{"mkdir", "mkdirat"}}); err != nil {
+		t.Fatalf("TightenSyscallPolicy() failed: %v", err)
+	}
+
+	imagePath := filepath.Join(dir, "test-image-file")
+	file, err := os.OpenFile(imagePath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("error opening new file at imagePath: %v", err)
+	}
+	defer file.Close()
+	if err := cont.Checkpoint(file); err != nil {
+		t.Fatalf("error checkpointing container: %v", err)
+	}
+	cont.Destroy()
+
+	// Delete and recreate the output file before restoring.
+	if err := os.Remove(outputPath); err != nil {
+		t.Fatalf("error removing file: %v", err)
+	}
+	outputFile2, err := createWriteableOutputFile(outputPath)
+	if err != nil {
+		t.Fatalf("error creating output file: %v", err)
+	}
+	defer outputFile2.Close()
+
+	// Restore into a new container, whose spec doesn't have a syscall policy.
+	args2 := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont2, err := New(conf, args2)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont2.Destroy()
+	if err := cont2.Restore(spec, conf, imagePath); err != nil {
+		t.Fatalf("error restoring container: %v", err)
+	}
+
+	if err := waitForFileNotEmpty(outputFile2); err != nil {
+		t.Fatalf("Failed to wait for output file: %v", err)
+	}
+	out, err := ioutil.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("error reading output file: %v", err)
+	}
+	if got := string(out); strings.Contains(got, "created") || !strings.Contains(got, "denied") {
+		t.Errorf("mkdir after restore got: %q, want it denied", got)
+	}
+}
+
+// TestOOMBehavior checks that the OOM behavior of the sandbox can be changed
+// and queried.
+func TestOOMBehavior(t *testing.T) {
+	spec, conf := sleepSpecConf(t)
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	state, err := cont.Sandbox.OOMState()
+	if err != nil {
+		t.Fatalf("OOMState() failed: %v", err)
+	}
+	if want := kernel.OOMSegfault.String(); state.Behavior != want {
+		t.Errorf("default OOM behavior got: %q, want: %q", state.Behavior, want)
+	}
+
+	for _, b := range []kernel.OOMBehavior{kernel.OOMKillVictim, kernel.OOMPauseAndNotify, kernel.OOMSegfault} {
+		if err := cont.Sandbox.SetOOMBehavior(b.String()); err != nil {
+			t.Fatalf("SetOOMBehavior(%v) failed: %v", b, err)
+		}
+		state, err := cont.Sandbox.OOMState()
+		if err != nil {
+			t.Fatalf("OOMState() failed: %v", err)
+		}
+		if state.Behavior != b.String() || state.Paused != 0 {
+			t.Errorf("OOMState() after SetOOMBehavior(%v) got: %+v", b, state)
+		}
+	}
+	if err := cont.Sandbox.ResolveOOM(); err != nil {
+		t.Errorf("ResolveOOM() failed: %v", err)
+	}
+	if err := cont.Sandbox.SetOOMBehavior("invalid"); err == nil {
+		t.Errorf("SetOOMBehavior(invalid) succeeded, want error")
+	}
+}
+
+// TestExportState checks that the exported container state has the documented
+// JSON schema.
+func TestExportState(t *testing.T) {
+	spec, conf := sleepSpecConf(t)
+	conf.VFS2 = true
+	spec.Annotations = map[string]string{"test.label": "value"}
+	spec.Process.Env = append(spec.Process.Env, "SECRET=hunter2")
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	state, err := cont.ExportState()
+	if err != nil {
+		t.Fatalf("ExportState() failed: %v", err)
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatalf("json.Marshal() failed: %v", err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("json.Unmarshal() failed: %v", err)
+	}
+
+	for key, want := range map[string]string{
+		"version":    "float64",
+		"id":         "string",
+		"spec":       "map[string]interface {}",
+		"labels":     "map[string]interface {}",
+		"usage":      "map[string]interface {}",
+		"processes":  "[]interface {}",
+		"mounts":     "[]interface {}",
+		"interfaces": "[]interface {}",
+	} {
+		if got := fmt.Sprintf("%T", doc[key]); got != want {
+			t.Errorf("key %q got type: %s, want: %s", key, got, want)
+		}
+	}
+	if doc["id"] != cont.ID {
+		t.Errorf("id got: %v, want: %s", doc["id"], cont.ID)
+	}
+	if labels, _ := doc["labels"].(map[string]interface{}); labels["test.label"] != "value" {
+		t.Errorf("labels got: %v, want test.label=value", doc["labels"])
+	}
+	if procs, _ := doc["processes"].([]interface{}); len(procs) == 0 {
+		t.Errorf("processes is empty")
+	}
+	if strings.Contains(string(data), "hunter2") {
+		t.Errorf("exported state contains the process environment: %s", data)
+	}
+
+	var root bool
+	mounts, _ := doc["mounts"].([]interface{})
+	for _, m := range mounts {
+		mount, _ := m.(map[string]interface{})
+		for _, key := range []string{"source", "target", "type"} {
+			if _, ok := mount[key].(string); !ok {
+				t.Errorf("mount %v has no string %q", m, key)
+			}
+		}
+		if _, ok := mount["options"].([]interface{}); !ok {
+			t.Errorf("mount %v has no options list", m)
+		}
+		if mount["target"] == "/" {
+			root = true
+		}
+	}
+	if !root {
+		t.Errorf("mounts don't include the root mount: %v", mounts)
+	}
+
+	var lo bool
+	ifaces, _ := doc["interfaces"].([]interface{})
+	for _, i := range ifaces {
+		iface, _ := i.(map[string]interface{})
+		if iface["name"] == "lo" {
+			lo = true
+		}
+	}
+	if !lo {
+		t.Errorf("interfaces don't include loopback: %v", ifaces)
+	}
+}
+
+// TestReadyFile checks that the ready file is notified once the sandbox is
+// created.
+func TestReadyFile(t *testing.T) {
+	conf := testutil.TestConfig(t)
+	spec, _ := sleepSpecConf(t)
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe() failed: %v", err)
+	}
+	defer readyReader.Close()
+
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+		ReadyFile: readyWriter,
+	}
+	cont, err := New(conf, args)
+	readyWriter.Close()
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+
+	b := make([]byte, 2)
+	if n, err := readyReader.Read(b); err != nil || n != 1 {
+		t.Fatalf("reading ready file got %d bytes, err: %v, want 1 byte", n, err)
+	}
+	// The sandbox closes the file once notified.
+	if n, err := readyReader.Read(b); err != io.EOF {
+		t.Errorf("reading ready file again got %d bytes, err: %v, want EOF", n, err)
+	}
+}
+
+// TestDestroyPreExitHook checks that the pre-exit hook runs inside the
+// container before it's killed, and that a hung hook is killed instead of
+// blocking Destroy.
+func TestDestroyPreExitHook(t *testing.T) {
+	for name, conf := range configs(t, false /* noOverlay */) {
+		t.Run(name, func(t *testing.T) {
+			dir, err := ioutil.TempDir(testutil.TmpDir(), "pre-exit")
+			if err != nil {
+				t.Fatalf("ioutil.TempDir() failed: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			if err := os.Chmod(dir, 0777); err != nil {
+				t.Fatalf("os.Chmod(%q) failed: %v", dir, err)
+			}
+
+			spec, _ := sleepSpecConf(t)
+			spec.Mounts = append(spec.Mounts, specs.Mount{
+				Type:        "bind",
+				Destination: "/pre-exit",
+				Source:      dir,
+			})
+			_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+			if err != nil {
+				t.Fatalf("error setting up container: %v", err)
+			}
+			defer cleanup()
+
+			// Create and start the container.
+			args := Args{
+				ID:        testutil.RandomContainerID(),
+				Spec:      spec,
+				BundleDir: bundleDir,
+			}
+			cont, err := New(conf, args)
+			if err != nil {
+				t.Fatalf("error creating container: %v", err)
+			}
+			if err := cont.Start(conf); err != nil {
+				t.Fatalf("error starting container: %v", err)
+			}
+
+			// A hook that outlives its timeout is killed inside the sandbox.
+			hung := &control.ExecArgs{
+				ContainerID: cont.ID,
+				Filename:    "/bin/sleep",
+				Argv:        []string{"/bin/sleep", "1000"},
+			}
+			ws, err := cont.Sandbox.RunPreExitHook(conf, hung, time.Second)
+			if !errors.Is(err, boot.ErrExecTimeout) {
+				t.Errorf("RunPreExitHook() with a hung hook got error %v, want %v", err, boot.ErrExecTimeout)
+			}
+			if !ws.Signaled() || ws.Signal() != unix.SIGKILL {
+				t.Errorf("RunPreExitHook() with a hung hook got status %#x, want killed by SIGKILL", ws)
+			}
+			if procs, err := cont.Processes(); err != nil {
+				t.Errorf("Processes() failed: %v", err)
+			} else if len(procs) != 1 {
+				t.Errorf("hung pre-exit hook is still running, processes: %+v", procs)
+			}
+
+			// The hook records whether the container's init process is still
+			// alive when it runs.
+			hook := &control.ExecArgs{
+				Filename: "/bin/sh",
+				Argv:     []string{"/bin/sh", "-c", "kill -0 1 && touch /pre-exit/ran; sleep 1000"},
+			}
+			start := time.Now()
+			destroyArgs := DestroyArgs{
+				PreExitHook:    hook,
+				PreExitTimeout: 5 * time.Second,
+			}
+			if err := cont.DestroyWithArgs(conf, destroyArgs); err != nil {
+				t.Fatalf("DestroyWithArgs() failed: %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Minute {
+				t.Errorf("DestroyWithArgs() took %v with a hung hook", elapsed)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "ran")); err != nil {
+				t.Errorf("pre-exit hook didn't run before the container was killed: %v", err)
+			}
+			if cont.Status != Stopped {
+				t.Errorf("container status got: %v, want: %v", cont.Status, Stopped)
+			}
+		})
+	}
+}
+
+// TestCheckpointSignal checks that the checkpoint signal sent to init
+// checkpoints the sandbox instead of being delivered, and that the sandbox
+// exits afterwards and can be restored from the checkpoint.
+func TestCheckpointSignal(t *testing.T) {
+	spec, conf := sleepSpecConf(t)
+	conf.CheckpointSignal = int(unix.SIGUSR1)
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	imagePath := filepath.Join(bundleDir, "checkpoint-image")
+	file, err := os.OpenFile(imagePath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("error opening new file at imagePath: %v", err)
+	}
+	err = cont.SetCheckpointFile(file)
+	file.Close()
+	if err != nil {
+		t.Fatalf("SetCheckpointFile() failed: %v", err)
+	}
+
+	if err := cont.SignalContainer(unix.SIGUSR1, false); err != nil {
+		t.Fatalf("SignalContainer(SIGUSR1) failed: %v", err)
+	}
+
+	// The sandbox exits once the checkpoint is written. Init isn't killed by
+	// the signal, since it's intercepted.
+	ws, err := cont.Wait()
+	if err != nil {
+		t.Fatalf("error waiting for container: %v", err)
+	}
+	if ws.Signaled() {
+		t.Errorf("container was killed by signal %v, want checkpoint", ws.Signal())
+	}
+	if info, err := os.Stat(imagePath); err != nil || info.Size() == 0 {
+		t.Fatalf("checkpoint image is missing or empty, err: %v", err)
+	}
+	if err := cont.Destroy(); err != nil {
+		t.Fatalf("error destroying container: %v", err)
+	}
+
+	// Restore into a new container, where init continues to run.
+	args2 := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont2, err := New(conf, args2)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont2.Destroy()
+	if err := cont2.Restore(spec, conf, imagePath); err != nil {
+		t.Fatalf("error restoring container: %v", err)
+	}
+	expectedPL := []*control.Process{newProcessBuilder().PID(1).PPID(0).Cmd("sleep").Process()}
+	if err := waitForProcessList(cont2, expectedPL); err != nil {
+		t.Errorf("init process isn't running after the restore: %v", err)
+	}
+}
+
+// TestDiskQuota checks that writes to the root filesystem fail once the
+// container's disk quota is exceeded.
+func TestDiskQuota(t *testing.T) {
+	spec, conf := sleepSpecConf(t)
+	conf.VFS2 = true
+	conf.Overlay = true
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	const limit = 1 << 20
+	if err := cont.SetDiskQuota(limit); err != nil {
+		t.Fatalf("SetDiskQuota(%d) failed: %v", limit, err)
+	}
+
+	// Writing within the quota succeeds.
+	if ws, err := execute(conf, cont, "/bin/sh", "-c", "head -c 1000 /dev/zero > /small"); err != nil || ws != 0 {
+		t.Fatalf("writing within quota failed, status: %v, err: %v", ws, err)
+	}
+
+	// Writing beyond the quota fails.
+	ws, err := execute(conf, cont, "/bin/sh", "-c", "head -c 2000000 /dev/zero > /large")
+	if err != nil {
+		t.Fatalf("error executing write: %v", err)
+	}
+	if ws == 0 {
+		t.Errorf("writing beyond quota succeeded, want failure")
+	}
+
+	quota, err := cont.DiskQuota()
+	if err != nil {
+		t.Fatalf("DiskQuota() failed: %v", err)
+	}
+	if quota.Limit != limit {
+		t.Errorf("DiskQuota() limit got: %d, want: %d", quota.Limit, limit)
+	}
+	if quota.Usage < 1000 || quota.Usage > limit {
+		t.Errorf("DiskQuota() usage got: %d, want in [1000, %d]", quota.Usage, limit)
+	}
+
+	// Removing files frees space.
+	if ws, err := execute(conf, cont, "/bin/rm", "-f", "/large"); err != nil || ws != 0 {
+		t.Fatalf("removing file failed, status: %v, err: %v", ws, err)
+	}
+	if ws, err := execute(conf, cont, "/bin/sh", "-c", "head -c 1000 /dev/zero > /small2"); err != nil || ws != 0 {
+		t.Errorf("writing after freeing space failed, status: %v, err: %v", ws, err)
+	}
+}
+
+// TestIPCLimits checks that the IPC limits of a container can be changed.
+func TestIPCLimits(t *testing.T) {
+	spec, conf := sleepSpecConf(t)
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	want, err := cont.IPCLimits()
+	if err != nil {
+		t.Fatalf("IPCLimits() failed: %v", err)
+	}
+	if want.MsgMax != linux.MSGMAX || want.MsgMnb != linux.MSGMNB || want.ShmMax != linux.SHMMAX {
+		t.Errorf("IPCLimits() got: %+v, want defaults", want)
+	}
+
+	// Only non-zero limits are changed.
+	want.MsgMax = 2 * linux.MSGMAX
+	want.ShmMax = 1 << 20
+	if err := cont.SetIPCLimits(boot.IPCLimits{MsgMax: want.MsgMax, ShmMax: want.ShmMax}); err != nil {
+		t.Fatalf("SetIPCLimits() failed: %v", err)
+	}
+	if got, err := cont.IPCLimits(); err != nil {
+		t.Fatalf("IPCLimits() failed: %v", err)
+	} else if got != want {
+		t.Errorf("IPCLimits() got: %+v, want: %+v", got, want)
+	}
+
+	// Out of range limits are rejected, and the valid limits set along with
+	// them are left unchanged.
+	if err := cont.SetIPCLimits(boot.IPCLimits{ShmMax: 2 << 20, MsgMnb: math.MaxInt32 + 1}); err == nil {
+		t.Errorf("SetIPCLimits() with out of range msgmnb succeeded, want error")
+	}
+	if got, err := cont.IPCLimits(); err != nil {
+		t.Fatalf("IPCLimits() failed: %v", err)
+	} else if got != want {
+		t.Errorf("IPCLimits() after failed SetIPCLimits() got: %+v, want: %+v", got, want)
+	}
+}
+
+// TestInitCommand checks that the recorded init command matches the spec.
+func TestInitCommand(t *testing.T) {
+	spec, conf := sleepSpecConf(t)
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	cmd, err := cont.InitCommand()
+	if err != nil {
+		t.Fatalf("InitCommand() failed: %v", err)
+	}
+	if want := filepath.Base(spec.Process.Args[0]); cmd.Comm != want {
+		t.Errorf("InitCommand() comm got: %q, want: %q", cmd.Comm, want)
+	}
+	if !reflect.DeepEqual(cmd.Argv, spec.Process.Args) {
+		t.Errorf("InitCommand() argv got: %q, want: %q", cmd.Argv, spec.Process.Args)
+	}
+}
+
+// TestHostRootPath checks that the host path backing the container root is
+// reported, and only in debug mode.
+func TestHostRootPath(t *testing.T) {
+	for _, debug := range []bool{true, false} {
+		t.Run(fmt.Sprintf("debug=%t", debug), func(t *testing.T) {
+			spec, conf := sleepSpecConf(t)
+			conf.Debug = debug
+			_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+			if err != nil {
+				t.Fatalf("error setting up container: %v", err)
+			}
+			defer cleanup()
+
+			// Create and start the container.
+			args := Args{
+				ID:        testutil.RandomContainerID(),
+				Spec:      spec,
+				BundleDir: bundleDir,
+			}
+			cont, err := New(conf, args)
+			if err != nil {
+				t.Fatalf("error creating container: %v", err)
+			}
+			defer cont.Destroy()
+			if err := cont.Start(conf); err != nil {
+				t.Fatalf("error starting container: %v", err)
+			}
+
+			root, err := cont.HostRootPath()
+			if !debug {
+				if err == nil {
+					t.Fatalf("HostRootPath() without debug succeeded: %+v", root)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("HostRootPath() failed: %v", err)
+			}
+			if root.Path != spec.Root.Path {
+				t.Errorf("HostRootPath() path got: %q, want: %q", root.Path, spec.Root.Path)
+			}
+			if root.GoferFD <= 0 {
+				t.Errorf("HostRootPath() gofer FD got: %d, want: > 0", root.GoferFD)
+			}
+		})
+	}
+}
+
+// TestCoreDumpUpload checks that a crashing process uploads its core dump with
+// the right metadata.
+func TestCoreDumpUpload(t *testing.T) {
+	spec, conf := sleepSpecConf(t)
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("error creating pipe: %v", err)
+	}
+	defer r.Close()
+	const maxSize = 1 << 20
+	err = cont.Sandbox.SetCoreDumpUpload(w, maxSize)
+	w.Close()
+	if err != nil {
+		t.Fatalf("SetCoreDumpUpload() failed: %v", err)
+	}
+
+	// Read the upload concurrently, since the crashing process waits for the
+	// upload once a few chunks of its core dump are pending.
+	type upload struct {
+		hdr  boot.CoreDumpHeader
+		core []byte
+		err  error
+	}
+	ch := make(chan upload, 1)
+	go func() {
+		var u upload
+		defer func() { ch <- u }()
+		br := bufio.NewReader(r)
+		line, err := br.ReadBytes('\n')
+		if err != nil {
+			u.err = fmt.Errorf("reading header: %v", err)
+			return
+		}
+		if err := json.Unmarshal(line, &u.hdr); err != nil {
+			u.err = fmt.Errorf("decoding header %q: %v", line, err)
+			return
+		}
+		u.core = make([]byte, u.hdr.Size)
+		if _, err := io.ReadFull(br, u.core); err != nil {
+			u.err = fmt.Errorf("reading core dump: %v", err)
+		}
+	}()
+
+	ws, err := execute(conf, cont, "/bin/sh", "-c", "kill -SEGV $$")
+	if err != nil {
+		t.Fatalf("exec failed: %v", err)
+	}
+	if !ws.Signaled() || ws.Signal() != unix.SIGSEGV || !ws.CoreDump() {
+		t.Errorf("exec got wait status: %v, want: killed by SIGSEGV with core dump", ws)
+	}
+
+	var u upload
+	select {
+	case u = <-ch:
+	case <-time.After(30 * time.Second):
+		t.Fatalf("timed out waiting for core dump upload")
+	}
+	if u.err != nil {
+		t.Fatalf("core dump upload: %v", u.err)
+	}
+	if u.hdr.CID != cont.ID || u.hdr.PID <= 0 || u.hdr.Signal != int(unix.SIGSEGV) {
+		t.Errorf("core dump header got: %+v, want CID: %q, signal: %d", u.hdr, cont.ID, unix.SIGSEGV)
+	}
+	if u.hdr.Size > maxSize {
+		t.Errorf("core dump size got: %d, want: <= %d", u.hdr.Size, maxSize)
+	}
+	if !bytes.HasPrefix(u.core, []byte("\x7fELF")) {
+		t.Errorf("core dump doesn't start with the ELF magic")
+	}
+}
+
+// TestPerfCounters checks that hardware events are counted while the
+// container runs application code, on platforms that support it.
+func TestPerfCounters(t *testing.T) {
+	conf := testutil.TestConfig(t)
+	conf.PerfCounters = true
+	// The loop runs in the shell itself, which is still alive when the counters
+	// are retrieved.
+	spec := testutil.NewSpecWithArgs("/bin/sh", "-c", "i=0; while [ $i -lt 100000 ]; do i=$((i+1)); done; sleep 1000")
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	if _, err := cont.PerfCounters(); err != nil && strings.Contains(err.Error(), "not supported") {
+		t.Skipf("perf counters not supported: %v", err)
+	}
+	cb := func() error {
+		counters, err := cont.PerfCounters()
+		if err != nil {
+			return &backoff.PermanentError{Err: err}
+		}
+		if counters.Cycles == 0 || counters.Instructions == 0 {
+			return fmt.Errorf("no events counted: %+v", counters)
+		}
+		return nil
+	}
+	if err := testutil.Poll(cb, 30*time.Second); err != nil {
+		t.Fatalf("PerfCounters() failed: %v", err)
+	}
+}
+
+// TestAddDevice checks that devices can be added to a running container.
+func TestAddDevice(t *testing.T) {
+	spec, conf := sleepSpecConf(t)
+	conf.VFS2 = true
+	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	// Create and start the container.
+	args := Args{
+		ID:        testutil.RandomContainerID(),
+		Spec:      spec,
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	mode := os.FileMode(0666)
+	dev := specs.LinuxDevice{
+		Path:     "/dev/null2",
+		Type:     "c",
+		Major:    1,
+		Minor:    3,
+		FileMode: &mode,
+	}
+	if err := cont.AddDevice(dev); err != nil {
+		t.Fatalf("AddDevice(%+v) failed: %v", dev, err)
+	}
+
+	// The device behaves like /dev/null.
+	if ws, err := execute(conf, cont, "/bin/sh", "-c", "test -c /dev/null2 && echo foo > /dev/null2 && test -z \"$(cat /dev/null2)\""); err != nil || ws != 0 {
+		t.Errorf("using added device failed, status: %v, err: %v", ws, err)
+	}
+
+	// Devices outside of the allowlist are rejected.
+	dev = specs.LinuxDevice{
+		Path:  "/dev/mem",
+		Type:  "c",
+		Major: 1,
+		Minor: 1,
+	}
+	if err := cont.AddDevice(dev); err == nil {
+		t.Errorf("AddDevice(%+v) succeeded, want error", dev)
+	}
+
+	// Block devices aren't supported.
+	dev = specs.LinuxDevice{
+		Path:  "/dev/sda",
+		Type:  "b",
+		Major: 8,
+		Minor: 0,
+	}
+	if err := cont.AddDevice(dev); urpc.CodeOf(err) != boot.ErrCodeUnimplemented {
+		t.Errorf("AddDevice(%+v) got error: %v, want code %d", dev, err, boot.ErrCodeUnimplemented)
+	}
+}
+
 // TestCapabilities verifies that:
 // - Running exec as non-root UID and GID will result in an error (because the
 //   executable file can't be read).
@@ -1990,8 +4659,8 @@ func TestUserLog(t *testing.T) {
 		t.Fatal("error finding test_app:", err)
 	}
 
-	// sched_rr_get_interval - not implemented in gvisor.
-	num := strconv.Itoa(unix.SYS_SCHED_RR_GET_INTERVAL)
+	// fanotify_init - not implemented in gvisor.
+	num := strconv.Itoa(unix.SYS_FANOTIFY_INIT)
 	spec := testutil.NewSpecWithArgs(app, "syscall", "--syscall="+num)
 	conf := testutil.TestConfig(t)
 	_, bundleDir, cleanup, err := testutil.SetupContainer(spec, conf)
@@ -2026,7 +4695,7 @@ func TestUserLog(t *testing.T) {
 	if err != nil {
 		t.Fatalf("error opening user log file %q: %v", userLog, err)
 	}
-	if want := "Unsupported syscall sched_rr_get_interval("; !strings.Contains(string(out), want) {
+	if want := "Unsupported syscall fanotify_init("; !strings.Contains(string(out), want) {
 		t.Errorf("user log file doesn't contain %q, out: %s", want, string(out))
 	}
 }
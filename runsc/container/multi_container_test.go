@@ -15,12 +15,17 @@
 package container
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math"
+	"net"
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -33,6 +38,7 @@ import (
 	"gvisor.dev/gvisor/pkg/sentry/kernel"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/test/testutil"
+	"gvisor.dev/gvisor/pkg/urpc"
 	"gvisor.dev/gvisor/runsc/boot"
 	"gvisor.dev/gvisor/runsc/config"
 	"gvisor.dev/gvisor/runsc/specutils"
@@ -172,6 +178,54 @@ func TestMultiContainerSanity(t *testing.T) {
 	}
 }
 
+// TestMultiContainerProcessTree checks that orphaned processes of a container
+// sharing the root PID namespace are reported as children of the container
+// init, although the kernel reparents them to the root container init.
+func TestMultiContainerProcessTree(t *testing.T) {
+	rootDir, cleanup, err := testutil.SetupRootDir()
+	if err != nil {
+		t.Fatalf("error creating root dir: %v", err)
+	}
+	defer cleanup()
+	conf := testutil.TestConfig(t)
+	conf.RootDir = rootDir
+
+	// The subshell exits right away, orphaning its sleep.
+	sleep := []string{"sleep", "100"}
+	orphan := []string{"sh", "-c", "(sleep 100 &); exec sleep 100"}
+	specs, ids := createSpecs(sleep, orphan)
+	containers, cleanup, err := startContainers(conf, specs, ids)
+	if err != nil {
+		t.Fatalf("error starting containers: %v", err)
+	}
+	defer cleanup()
+
+	if err := waitForProcessCount(containers[1], 2); err != nil {
+		t.Fatalf("failed to wait for processes: %v", err)
+	}
+	pl, err := containers[1].Processes()
+	if err != nil {
+		t.Fatalf("Processes(): %v", err)
+	}
+	initProc := pl[0]
+	for _, p := range pl[1:] {
+		if p.PPID != initProc.PID {
+			t.Errorf("orphan %+v has PPID %d, want container init PID %d", p, p.PPID, initProc.PID)
+		}
+		if p.SID == 0 || p.PGID == 0 {
+			t.Errorf("orphan %+v has no session or process group", p)
+		}
+	}
+
+	tree, err := containers[1].ProcessTree()
+	if err != nil {
+		t.Fatalf("ProcessTree(): %v", err)
+	}
+	if len(tree) != 1 || tree[0].PID != initProc.PID || len(tree[0].Children) != 1 {
+		t.Errorf("ProcessTree() got %+v, want container init %d with one child", tree, initProc.PID)
+	}
+}
+
 // TestMultiPIDNS checks that it is possible to run 2 dead-simple containers in
 // the same sandbox with different pidns.
 func TestMultiPIDNS(t *testing.T) {
@@ -445,6 +499,13 @@ func TestMultiPIDNSKill(t *testing.T) {
 				if !strings.Contains(err.Error(), "belongs to a different container") {
 					t.Errorf("wrong error message from killing another container's: %v", err)
 				}
+
+				// Finally, check that signaling a nonexistent process fails.
+				if err := c.SignalProcess(unix.SIGKILL, 12345); err == nil {
+					t.Errorf("killing a nonexistent process should fail")
+				} else if !strings.Contains(err.Error(), "process 12345 not found") {
+					t.Errorf("wrong error message from killing a nonexistent process: %v", err)
+				}
 			}
 		})
 	}
@@ -711,6 +772,141 @@ func TestMultiContainerSignal(t *testing.T) {
 	}
 }
 
+// TestMultiContainerPauseContainer checks that pausing a container stops its
+// processes, including new ones, without stopping other containers.
+func TestMultiContainerPauseContainer(t *testing.T) {
+	rootDir, cleanup, err := testutil.SetupRootDir()
+	if err != nil {
+		t.Fatalf("error creating root dir: %v", err)
+	}
+	defer cleanup()
+
+	conf := testutil.TestConfig(t)
+	conf.RootDir = rootDir
+
+	// Setup the containers.
+	sleep := []string{"sleep", "100"}
+	specs, ids := createSpecs(sleep, sleep)
+	containers, cleanup, err := startContainers(conf, specs, ids)
+	if err != nil {
+		t.Fatalf("error starting containers: %v", err)
+	}
+	defer cleanup()
+
+	if err := containers[1].Sandbox.PauseContainer(containers[1].ID); err != nil {
+		t.Fatalf("PauseContainer(): %v", err)
+	}
+
+	// Processes started in the other container must run.
+	execArgs := &control.ExecArgs{
+		Filename: "/bin/true",
+		Argv:     []string{"true"},
+	}
+	if ws, err := execute(conf, containers[0], "/bin/true"); err != nil || ws != 0 {
+		t.Fatalf("exec in running container got status: %v, err: %v, want: 0", ws, err)
+	}
+
+	// Processes started in the paused container must not run until it's
+	// resumed.
+	pid, err := containers[1].Execute(conf, execArgs)
+	if err != nil {
+		t.Fatalf("error executing true: %v", err)
+	}
+	if _, err := containers[1].WaitPIDTimeout(pid, time.Second); !errors.Is(err, boot.ErrWaitTimeout) {
+		t.Fatalf("WaitPIDTimeout() in paused container got error: %v, want: %v", err, boot.ErrWaitTimeout)
+	}
+
+	if err := containers[1].Sandbox.ResumeContainer(containers[1].ID); err != nil {
+		t.Fatalf("ResumeContainer(): %v", err)
+	}
+	if ws, err := containers[1].WaitPID(pid); err != nil || ws != 0 {
+		t.Fatalf("WaitPID() after resume got status: %v, err: %v, want: 0", ws, err)
+	}
+
+	// The container isn't paused anymore.
+	if err := containers[1].Sandbox.ResumeContainer(containers[1].ID); err == nil {
+		t.Errorf("ResumeContainer() on a running container succeeded")
+	}
+}
+
+// TestMultiContainerDestroyPaused checks that a paused container can be
+// destroyed, and that it doesn't stop other containers.
+func TestMultiContainerDestroyPaused(t *testing.T) {
+	rootDir, cleanup, err := testutil.SetupRootDir()
+	if err != nil {
+		t.Fatalf("error creating root dir: %v", err)
+	}
+	defer cleanup()
+
+	conf := testutil.TestConfig(t)
+	conf.RootDir = rootDir
+
+	sleep := []string{"sleep", "100"}
+	specs, ids := createSpecs(sleep, sleep)
+	containers, cleanup, err := startContainers(conf, specs, ids)
+	if err != nil {
+		t.Fatalf("error starting containers: %v", err)
+	}
+	defer cleanup()
+
+	if err := containers[1].Sandbox.PauseContainer(containers[1].ID); err != nil {
+		t.Fatalf("PauseContainer(): %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- containers[1].Destroy()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Destroy() of paused container: %v", err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatalf("Destroy() of paused container didn't return")
+	}
+
+	// The sandbox isn't deadlocked, and the other container still runs.
+	if ws, err := execute(conf, containers[0], "/bin/true"); err != nil || ws != 0 {
+		t.Fatalf("exec in remaining container got status: %v, err: %v, want: 0", ws, err)
+	}
+}
+
+// TestMultiContainerDestroyPausedGracefully checks that a paused container
+// destroyed with a grace period is resumed to handle SIGTERM, instead of
+// waiting for the whole grace period.
+func TestMultiContainerDestroyPausedGracefully(t *testing.T) {
+	rootDir, cleanup, err := testutil.SetupRootDir()
+	if err != nil {
+		t.Fatalf("error creating root dir: %v", err)
+	}
+	defer cleanup()
+
+	conf := testutil.TestConfig(t)
+	conf.RootDir = rootDir
+
+	sleep := []string{"sleep", "100"}
+	specs, ids := createSpecs(sleep, sleep)
+	containers, cleanup, err := startContainers(conf, specs, ids)
+	if err != nil {
+		t.Fatalf("error starting containers: %v", err)
+	}
+	defer cleanup()
+
+	if err := containers[1].Sandbox.PauseContainer(containers[1].ID); err != nil {
+		t.Fatalf("PauseContainer(): %v", err)
+	}
+
+	const grace = time.Minute
+	start := time.Now()
+	if err := containers[1].DestroyWithArgs(conf, DestroyArgs{GracePeriod: grace}); err != nil {
+		t.Fatalf("DestroyWithArgs() of paused container: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= grace {
+		t.Errorf("DestroyWithArgs() took %v, want less than the %v grace period", elapsed, grace)
+	}
+}
+
 // TestMultiContainerDestroy checks that container are properly cleaned-up when
 // they are destroyed.
 func TestMultiContainerDestroy(t *testing.T) {
@@ -782,6 +978,207 @@ func TestMultiContainerDestroy(t *testing.T) {
 	}
 }
 
+// TestMultiContainerDestroySubmounts checks that destroying a container
+// releases all of its submounts, even if one of them was detached beforehand,
+// as if it was stuck.
+func TestMultiContainerDestroySubmounts(t *testing.T) {
+	for name, conf := range configs(t, false /* noOverlay */) {
+		t.Run(name, func(t *testing.T) {
+			rootDir, cleanup, err := testutil.SetupRootDir()
+			if err != nil {
+				t.Fatalf("error creating root dir: %v", err)
+			}
+			defer cleanup()
+			conf.RootDir = rootDir
+
+			sleep := []string{"sleep", "100"}
+			podSpecs, ids := createSpecs(sleep, sleep)
+			for _, name := range []string{"a", "b", "c"} {
+				src, err := ioutil.TempDir(testutil.TmpDir(), "submount")
+				if err != nil {
+					t.Fatal("ioutil.TempDir failed:", err)
+				}
+				defer os.RemoveAll(src)
+				podSpecs[1].Mounts = append(podSpecs[1].Mounts, specs.Mount{
+					Source:      src,
+					Destination: filepath.Join("/mnt", name),
+					Type:        "bind",
+				})
+			}
+			containers, cleanup, err := startContainers(conf, podSpecs, ids)
+			if err != nil {
+				t.Fatalf("error starting containers: %v", err)
+			}
+			defer cleanup()
+
+			if err := containers[1].ForceUnmount("/mnt/b"); err != nil {
+				t.Fatalf("ForceUnmount(/mnt/b) failed: %v", err)
+			}
+
+			// goferPid is reset when container is destroyed.
+			goferPid := containers[1].GoferPid
+			if err := containers[1].Destroy(); err != nil {
+				t.Fatalf("error destroying container: %v", err)
+			}
+
+			// The gofer serves all the bind mounts of the container, and
+			// only exits once they're all released.
+			_, _, err = specutils.RetryEintr(func() (uintptr, uintptr, error) {
+				cpid, err := unix.Wait4(goferPid, nil, 0, nil)
+				return uintptr(cpid), 0, err
+			})
+			if err != unix.ECHILD {
+				t.Errorf("error waiting for gofer to exit: %v", err)
+			}
+
+			// The root container is unaffected.
+			expectedPL := []*control.Process{
+				newProcessBuilder().PID(1).Cmd("sleep").Process(),
+			}
+			if err := waitForProcessList(containers[0], expectedPL); err != nil {
+				t.Errorf("failed to wait for sleep: %v", err)
+			}
+		})
+	}
+}
+
+// TestMultiContainerDestroyGraceful checks that destroying a container with a
+// grace period gives its init a chance to handle SIGTERM, and that it's still
+// killed if it ignores SIGTERM.
+func TestMultiContainerDestroyGraceful(t *testing.T) {
+	for name, conf := range configs(t, false /* noOverlay */) {
+		t.Run(name, func(t *testing.T) {
+			rootDir, cleanup, err := testutil.SetupRootDir()
+			if err != nil {
+				t.Fatalf("error creating root dir: %v", err)
+			}
+			defer cleanup()
+			conf.RootDir = rootDir
+
+			dir, err := ioutil.TempDir(testutil.TmpDir(), "graceful")
+			if err != nil {
+				t.Fatalf("ioutil.TempDir() failed: %v", err)
+			}
+			defer os.RemoveAll(dir)
+			if err := os.Chmod(dir, 0777); err != nil {
+				t.Fatalf("os.Chmod(%q) failed: %v", dir, err)
+			}
+
+			podSpecs, ids := createSpecs(
+				[]string{"sleep", "100"},
+				[]string{"/bin/sh", "-c", "trap 'touch /graceful/term; exit 0' TERM; touch /graceful/ready; while true; do sleep 0.1; done"},
+				[]string{"/bin/sh", "-c", "trap '' TERM; while true; do sleep 0.1; done"})
+			for _, spec := range podSpecs[1:] {
+				spec.Mounts = append(spec.Mounts, specs.Mount{
+					Type:        "bind",
+					Destination: "/graceful",
+					Source:      dir,
+				})
+			}
+			containers, cleanup, err := startContainers(conf, podSpecs, ids)
+			if err != nil {
+				t.Fatalf("error starting containers: %v", err)
+			}
+			defer cleanup()
+
+			// Wait for the SIGTERM handler to be installed.
+			ready := filepath.Join(dir, "ready")
+			if err := testutil.Poll(func() error {
+				_, err := os.Stat(ready)
+				return err
+			}, 5*time.Second); err != nil {
+				t.Fatalf("container didn't get ready: %v", err)
+			}
+
+			// The first container exits on SIGTERM, well before the grace period.
+			start := time.Now()
+			if err := containers[1].DestroyWithArgs(conf, DestroyArgs{GracePeriod: time.Minute}); err != nil {
+				t.Fatalf("error destroying container: %v", err)
+			}
+			if elapsed := time.Since(start); elapsed >= time.Minute {
+				t.Errorf("destroy took %v, container should have exited on SIGTERM", elapsed)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "term")); err != nil {
+				t.Errorf("container didn't handle SIGTERM: %v", err)
+			}
+
+			// The second container ignores SIGTERM and is killed after the grace
+			// period.
+			const grace = time.Second
+			start = time.Now()
+			if err := containers[2].DestroyWithArgs(conf, DestroyArgs{GracePeriod: grace}); err != nil {
+				t.Fatalf("error destroying container: %v", err)
+			}
+			if elapsed := time.Since(start); elapsed < grace {
+				t.Errorf("destroy took %v, want at least %v", elapsed, grace)
+			}
+
+			// Only the root container should be left.
+			expectedPL := []*control.Process{
+				newProcessBuilder().PID(1).Cmd("sleep").Process(),
+			}
+			if err := waitForProcessList(containers[0], expectedPL); err != nil {
+				t.Errorf("failed to wait for process list: %v", err)
+			}
+		})
+	}
+}
+
+// TestMultiContainerListContainers checks that the sandbox lists all of its
+// containers.
+func TestMultiContainerListContainers(t *testing.T) {
+	rootDir, cleanup, err := testutil.SetupRootDir()
+	if err != nil {
+		t.Fatalf("error creating root dir: %v", err)
+	}
+	defer cleanup()
+
+	conf := testutil.TestConfig(t)
+	conf.RootDir = rootDir
+
+	sleep := []string{"sleep", "100"}
+	podSpecs, ids := createSpecs(sleep, sleep, sleep)
+	containers, cleanup, err := startContainers(conf, podSpecs, ids)
+	if err != nil {
+		t.Fatalf("error starting containers: %v", err)
+	}
+	defer cleanup()
+
+	infos, err := containers[0].Sandbox.ListContainers()
+	if err != nil {
+		t.Fatalf("ListContainers() failed: %v", err)
+	}
+	var got []string
+	for _, info := range infos {
+		if info.PID == 0 {
+			t.Errorf("container %q has no PID", info.CID)
+		}
+		got = append(got, info.CID)
+	}
+	want := append([]string(nil), ids...)
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListContainers() got containers: %v, want: %v", got, want)
+	}
+
+	// Destroyed containers are no longer listed.
+	if err := containers[2].Destroy(); err != nil {
+		t.Fatalf("error destroying container: %v", err)
+	}
+	infos, err = containers[0].Sandbox.ListContainers()
+	if err != nil {
+		t.Fatalf("ListContainers() failed: %v", err)
+	}
+	for _, info := range infos {
+		if info.CID == ids[2] {
+			t.Errorf("destroyed container %q is still listed", info.CID)
+		}
+	}
+	if len(infos) != 2 {
+		t.Errorf("ListContainers() got %d containers, want 2: %+v", len(infos), infos)
+	}
+}
+
 func TestMultiContainerProcesses(t *testing.T) {
 	rootDir, cleanup, err := testutil.SetupRootDir()
 	if err != nil {
@@ -986,6 +1383,164 @@ func TestMultiContainerDestroyNotStarted(t *testing.T) {
 	}
 }
 
+// TestMultiContainerDrainMode checks that sub-containers can't be started in
+// drain mode, while running containers can still be signaled.
+func TestMultiContainerDrainMode(t *testing.T) {
+	specs, ids := createSpecs(
+		[]string{"/bin/sleep", "100"},
+		[]string{"/bin/sleep", "100"})
+
+	conf := testutil.TestConfig(t)
+	_, bundleDir, cleanup, err := testutil.SetupContainer(specs[0], conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	rootArgs := Args{
+		ID:        ids[0],
+		Spec:      specs[0],
+		BundleDir: bundleDir,
+	}
+	root, err := New(conf, rootArgs)
+	if err != nil {
+		t.Fatalf("error creating root container: %v", err)
+	}
+	defer root.Destroy()
+	if err := root.Start(conf); err != nil {
+		t.Fatalf("error starting root container: %v", err)
+	}
+
+	if err := root.Sandbox.SetDrainMode(true); err != nil {
+		t.Fatalf("SetDrainMode(true) failed: %v", err)
+	}
+	if draining, err := root.Sandbox.DrainMode(); err != nil || !draining {
+		t.Fatalf("DrainMode() got: %t, %v, want: true, nil", draining, err)
+	}
+
+	bundleDir, cleanupSub, err := testutil.SetupBundleDir(specs[1])
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanupSub()
+
+	args := Args{
+		ID:        ids[1],
+		Spec:      specs[1],
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err == nil || !strings.Contains(err.Error(), "draining") {
+		t.Fatalf("starting container in drain mode got error: %v, want draining error", err)
+	}
+
+	// Running containers can still be managed.
+	if err := root.SignalContainer(unix.SIGKILL, false); err != nil {
+		t.Fatalf("error sending SIGKILL to root container: %v", err)
+	}
+	if ws, err := root.Wait(); err != nil || ws.Signal() != unix.SIGKILL {
+		t.Errorf("root container wait got: %v, %v, want: killed by SIGKILL", ws, err)
+	}
+}
+
+// TestMultiContainerEventStream checks that start and exit events of a
+// subcontainer are written to the event stream, and that the exit of its init
+// process is marked.
+func TestMultiContainerEventStream(t *testing.T) {
+	specs, ids := createSpecs(
+		[]string{"/bin/sleep", "100"},
+		[]string{"/bin/sh", "-c", "exit 3"})
+
+	conf := testutil.TestConfig(t)
+	_, bundleDir, cleanup, err := testutil.SetupContainer(specs[0], conf)
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanup()
+
+	rootArgs := Args{
+		ID:        ids[0],
+		Spec:      specs[0],
+		BundleDir: bundleDir,
+	}
+	root, err := New(conf, rootArgs)
+	if err != nil {
+		t.Fatalf("error creating root container: %v", err)
+	}
+	defer root.Destroy()
+	if err := root.Start(conf); err != nil {
+		t.Fatalf("error starting root container: %v", err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("error creating pipe: %v", err)
+	}
+	defer r.Close()
+	err = root.Sandbox.EventStream(w)
+	w.Close()
+	if err != nil {
+		t.Fatalf("EventStream() failed: %v", err)
+	}
+
+	bundleDir, cleanupSub, err := testutil.SetupBundleDir(specs[1])
+	if err != nil {
+		t.Fatalf("error setting up container: %v", err)
+	}
+	defer cleanupSub()
+
+	args := Args{
+		ID:        ids[1],
+		Spec:      specs[1],
+		BundleDir: bundleDir,
+	}
+	cont, err := New(conf, args)
+	if err != nil {
+		t.Fatalf("error creating container: %v", err)
+	}
+	defer cont.Destroy()
+	if err := cont.Start(conf); err != nil {
+		t.Fatalf("error starting container: %v", err)
+	}
+
+	if err := r.SetReadDeadline(time.Now().Add(30 * time.Second)); err != nil {
+		t.Fatalf("error setting read deadline: %v", err)
+	}
+	var started bool
+	dec := json.NewDecoder(r)
+	for {
+		var ev boot.StreamEvent
+		if err := dec.Decode(&ev); err != nil {
+			t.Fatalf("error reading event stream (started: %t): %v", started, err)
+		}
+		if ev.CID != ids[1] {
+			continue
+		}
+		if ev.Time.IsZero() {
+			t.Errorf("event %+v has no timestamp", ev)
+		}
+		switch ev.Type {
+		case "start":
+			started = true
+		case "exit":
+			if !started {
+				t.Fatalf("got exit event before start event")
+			}
+			if ev.ExitCode != 3 {
+				t.Errorf("exit event got exit code: %d, want: 3", ev.ExitCode)
+			}
+			if !ev.Init {
+				t.Errorf("exit event of the container init isn't marked as such: %+v", ev)
+			}
+			return
+		}
+	}
+}
+
 // TestMultiContainerDestroyStarting attempts to force a race between start
 // and destroy.
 func TestMultiContainerDestroyStarting(t *testing.T) {
@@ -2213,3 +2768,135 @@ func TestMultiContainerShm(t *testing.T) {
 		t.Fatalf("wrong output, want: %q, got: %v", want, out)
 	}
 }
+
+// TestMultiContainerIsolatedNetwork checks that a container started with an
+// isolated network gets its own network stack, while other containers keep
+// sharing the root container's.
+func TestMultiContainerIsolatedNetwork(t *testing.T) {
+	rootDir, cleanup, err := testutil.SetupRootDir()
+	if err != nil {
+		t.Fatalf("error creating root dir: %v", err)
+	}
+	defer cleanup()
+
+	conf := testutil.TestConfig(t)
+	conf.RootDir = rootDir
+
+	sleep := []string{"sleep", "100"}
+	specs, ids := createSpecs(sleep, sleep, sleep)
+	specs[2].Annotations[boot.IsolatedNetworkAnnotation] = "true"
+	containers, cleanup, err := startContainers(conf, specs, ids)
+	if err != nil {
+		t.Fatalf("error starting containers: %v", err)
+	}
+	defer cleanup()
+
+	// Add a link only to the isolated container's stack.
+	args := &boot.CreateLinksAndRoutesArgs{
+		CID: ids[2],
+		LoopbackLinks: []boot.LoopbackLink{
+			{
+				Name: "lo1",
+				Addresses: []boot.IPWithPrefix{
+					{Address: net.IPv4(127, 0, 1, 1), PrefixLen: 8},
+				},
+			},
+		},
+	}
+	if err := containers[0].Sandbox.CreateLinksAndRoutes(args); err != nil {
+		t.Fatalf("CreateLinksAndRoutes() failed: %v", err)
+	}
+
+	for i, c := range containers {
+		ws, err := execute(conf, c, "/bin/grep", "-q", "lo1", "/proc/net/dev")
+		if err != nil {
+			t.Fatalf("error executing in container %d: %v", i, err)
+		}
+		if isolated := i == 2; isolated != (ws.ExitStatus() == 0) {
+			t.Errorf("container %d: link lo1 visible: %t, want: %t", i, ws.ExitStatus() == 0, isolated)
+		}
+	}
+
+	// Containers sharing the root network stack can't be configured by ID.
+	sharedArgs := *args
+	sharedArgs.CID = ids[1]
+	if err := containers[0].Sandbox.CreateLinksAndRoutes(&sharedArgs); err == nil {
+		t.Errorf("CreateLinksAndRoutes() on container without its own network namespace succeeded, want error")
+	}
+	if _, err := containers[0].Sandbox.NetworkStats(ids[1]); err == nil {
+		t.Errorf("NetworkStats() on container without its own network namespace succeeded, want error")
+	}
+	if err := containers[0].Sandbox.ResetNetworkStats(ids[1]); err == nil {
+		t.Errorf("ResetNetworkStats() on container without its own network namespace succeeded, want error")
+	}
+	if stats, err := containers[0].Sandbox.NetworkStats(ids[2]); err != nil {
+		t.Errorf("NetworkStats() on isolated container failed: %v", err)
+	} else if len(stats) == 0 {
+		t.Errorf("NetworkStats() on isolated container returned no interfaces")
+	}
+
+	// Destroying the isolated container closes its network stack, which can't
+	// be configured anymore, and leaves the root container's alone.
+	if err := containers[2].Destroy(); err != nil {
+		t.Fatalf("error destroying isolated container: %v", err)
+	}
+	if err := containers[0].Sandbox.CreateLinksAndRoutes(args); err == nil {
+		t.Errorf("CreateLinksAndRoutes() on destroyed container succeeded, want error")
+	}
+	if ws, err := execute(conf, containers[0], "/bin/grep", "-q", "lo", "/proc/net/dev"); err != nil || ws.ExitStatus() != 0 {
+		t.Errorf("root container lost its network stack, status: %v, err: %v", ws, err)
+	}
+
+	// Sharing the host network can't be combined with an isolated stack.
+	hostConf := testutil.TestConfig(t)
+	hostConf.RootDir = rootDir
+	hostConf.Network = config.NetworkHost
+	hostSpecs, hostIDs := createSpecs(sleep, sleep)
+	hostSpecs[1].Annotations[boot.IsolatedNetworkAnnotation] = "true"
+	if _, hostCleanup, err := startContainers(hostConf, hostSpecs, hostIDs); err == nil {
+		hostCleanup()
+		t.Fatalf("starting isolated container with --network=host succeeded, want error")
+	}
+}
+
+// TestMultiContainerCheckpointContainer checks that checkpointing a single
+// container is rejected as unimplemented and doesn't affect the sandbox.
+func TestMultiContainerCheckpointContainer(t *testing.T) {
+	rootDir, cleanup, err := testutil.SetupRootDir()
+	if err != nil {
+		t.Fatalf("error creating root dir: %v", err)
+	}
+	defer cleanup()
+
+	conf := testutil.TestConfig(t)
+	conf.RootDir = rootDir
+
+	sleep := []string{"sleep", "100"}
+	specs, ids := createSpecs(sleep, sleep)
+	containers, cleanup, err := startContainers(conf, specs, ids)
+	if err != nil {
+		t.Fatalf("error starting containers: %v", err)
+	}
+	defer cleanup()
+
+	file, err := ioutil.TempFile(testutil.TmpDir(), "checkpoint")
+	if err != nil {
+		t.Fatalf("error creating checkpoint file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	for _, c := range containers {
+		err := c.CheckpointContainer(file)
+		if got := urpc.CodeOf(err); got != boot.ErrCodeUnimplemented {
+			t.Errorf("CheckpointContainer(%q) got error: %v (code %d), want code %d", c.ID, err, got, boot.ErrCodeUnimplemented)
+		}
+	}
+
+	// Containers must not be affected by the failed attempts.
+	for _, c := range containers {
+		if _, err := execute(conf, c, "/bin/true"); err != nil {
+			t.Errorf("error executing in container %q: %v", c.ID, err)
+		}
+	}
+}
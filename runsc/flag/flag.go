@@ -29,6 +29,7 @@ type FlagSet = flag.FlagSet
 var (
 	Bool        = flag.Bool
 	CommandLine = flag.CommandLine
+	Duration    = flag.Duration
 	Int         = flag.Int
 	Int64       = flag.Int64
 	NewFlagSet  = flag.NewFlagSet
@@ -17,7 +17,9 @@ package sandbox
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -41,6 +43,8 @@ import (
 	"gvisor.dev/gvisor/pkg/log"
 	"gvisor.dev/gvisor/pkg/sentry/control"
 	"gvisor.dev/gvisor/pkg/sentry/platform"
+	"gvisor.dev/gvisor/pkg/sentry/watchdog"
+	"gvisor.dev/gvisor/pkg/state/statefile"
 	"gvisor.dev/gvisor/pkg/sync"
 	"gvisor.dev/gvisor/pkg/unet"
 	"gvisor.dev/gvisor/pkg/urpc"
@@ -52,6 +56,10 @@ import (
 	"gvisor.dev/gvisor/runsc/specutils"
 )
 
+// controlTokenLen is the length of the token that clients must send to the
+// control server.
+const controlTokenLen = 32
+
 // pid is an atomic type that implements JSON marshal/unmarshal interfaces.
 type pid struct {
 	val atomicbitops.Int64
@@ -111,6 +119,11 @@ type Sandbox struct {
 	// started, before it may be modified.
 	OriginalOOMScoreAdj int `json:"originalOomScoreAdj"`
 
+	// ControlToken is sent to the control server to authenticate, so that only
+	// processes that can read the container state can control the sandbox. It
+	// may be empty for sandboxes created by older versions.
+	ControlToken []byte `json:"controlToken"`
+
 	// child is set if a sandbox process is a child of the current process.
 	//
 	// This field isn't saved to json, because only a creator of sandbox
@@ -166,6 +179,10 @@ type Args struct {
 	// Attached indicates that the sandbox lifecycle is attached with the caller.
 	// If the caller exits, the sandbox should exit too.
 	Attached bool
+
+	// ReadyFile, if set, is written to by the sandbox once the loader has been
+	// created and the control server is ready to accept requests. It may be nil.
+	ReadyFile *os.File
 }
 
 // New creates the sandbox process. The caller must call Destroy() on the
@@ -250,7 +267,7 @@ func (s *Sandbox) CreateSubcontainer(conf *config.Config, cid string, tty *os.Fi
 		FilePayload: urpc.FilePayload{Files: files},
 	}
 	if err := sandboxConn.Call(boot.ContMgrCreateSubcontainer, &args, nil); err != nil {
-		return fmt.Errorf("creating sub-container %q: %v", cid, err)
+		return fmt.Errorf("creating sub-container %q: %w", cid, err)
 	}
 	return nil
 }
@@ -273,7 +290,7 @@ func (s *Sandbox) StartRoot(spec *specs.Spec, conf *config.Config) error {
 	// Send a message to the sandbox control server to start the root
 	// container.
 	if err := conn.Call(boot.ContMgrRootContainerStart, &s.ID, nil); err != nil {
-		return fmt.Errorf("starting root container: %v", err)
+		return fmt.Errorf("starting root container: %w", err)
 	}
 
 	return nil
@@ -299,34 +316,82 @@ func (s *Sandbox) StartSubcontainer(spec *specs.Spec, conf *config.Config, cid s
 	payload.Files = append(payload.Files, stdios...)
 	payload.Files = append(payload.Files, goferFiles...)
 
+	isolatedNetwork := false
+	if val, ok := spec.Annotations[boot.IsolatedNetworkAnnotation]; ok {
+		isolatedNetwork, err = strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("invalid value %q for annotation %q: %v", val, boot.IsolatedNetworkAnnotation, err)
+		}
+	}
+
+	syscallPolicy, err := boot.SyscallPolicyFromSpec(spec)
+	if err != nil {
+		return err
+	}
+
 	// Start running the container.
 	args := boot.StartArgs{
-		Spec:        spec,
-		Conf:        conf,
-		CID:         cid,
-		FilePayload: payload,
+		Spec:            spec,
+		Conf:            conf,
+		CID:             cid,
+		IsolatedNetwork: isolatedNetwork,
+		SyscallPolicy:   syscallPolicy,
+		FilePayload:     payload,
 	}
 	if err := sandboxConn.Call(boot.ContMgrStartSubcontainer, &args, nil); err != nil {
-		return fmt.Errorf("starting sub-container %v: %v", spec.Process.Args, err)
+		return fmt.Errorf("starting sub-container %v: %w", spec.Process.Args, err)
+	}
+	return nil
+}
+
+// CreateLinksAndRoutes configures network links and routes in the sandbox.
+// If args.CID is set, the isolated network stack of that container is
+// configured instead of the root one.
+func (s *Sandbox) CreateLinksAndRoutes(args *boot.CreateLinksAndRoutesArgs) error {
+	log.Debugf("Create links and routes in sandbox %q, CID: %q", s.ID, args.CID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.Call(boot.NetworkCreateLinksAndRoutes, args, nil); err != nil {
+		return fmt.Errorf("creating links and routes: %v", err)
 	}
 	return nil
 }
 
 // Restore sends the restore call for a container in the sandbox.
 func (s *Sandbox) Restore(cid string, spec *specs.Spec, conf *config.Config, filename string) error {
-	log.Debugf("Restore sandbox %q", s.ID)
-
 	rf, err := os.Open(filename)
 	if err != nil {
 		return fmt.Errorf("opening restore file %q failed: %v", filename, err)
 	}
 	defer rf.Close()
 
+	return s.RestoreFromFile(cid, spec, conf, rf)
+}
+
+// RestoreFromFile sends the restore call for a container in the sandbox,
+// reading the state from rf. rf doesn't need to be seekable, e.g. it may be a
+// socket connected to the checkpointing sandbox.
+func (s *Sandbox) RestoreFromFile(cid string, spec *specs.Spec, conf *config.Config, rf *os.File) error {
+	return s.RestoreFromFileWithNetwork(cid, spec, conf, rf, nil)
+}
+
+// RestoreFromFileWithNetwork is like RestoreFromFile, but if network is not
+// nil, it replaces the links and routes saved in the checkpoint, e.g. to
+// restore on a host with different addressing. Its files are the FDs of its
+// fd-based links.
+func (s *Sandbox) RestoreFromFileWithNetwork(cid string, spec *specs.Spec, conf *config.Config, rf *os.File, network *boot.CreateLinksAndRoutesArgs) error {
+	log.Debugf("Restore sandbox %q", s.ID)
+
 	opt := boot.RestoreOpts{
 		FilePayload: urpc.FilePayload{
 			Files: []*os.File{rf},
 		},
-		SandboxID: s.ID,
+		SandboxID:       s.ID,
+		NetworkOverride: network,
 	}
 
 	// If the platform needs a device FD we must pass it in.
@@ -336,6 +401,9 @@ func (s *Sandbox) Restore(cid string, spec *specs.Spec, conf *config.Config, fil
 		defer deviceFile.Close()
 		opt.FilePayload.Files = append(opt.FilePayload.Files, deviceFile)
 	}
+	if network != nil {
+		opt.FilePayload.Files = append(opt.FilePayload.Files, network.FilePayload.Files...)
+	}
 
 	conn, err := s.sandboxConnect()
 	if err != nil {
@@ -350,14 +418,15 @@ func (s *Sandbox) Restore(cid string, spec *specs.Spec, conf *config.Config, fil
 
 	// Restore the container and start the root container.
 	if err := conn.Call(boot.ContMgrRestore, &opt, nil); err != nil {
-		return fmt.Errorf("restoring container %q: %v", cid, err)
+		return fmt.Errorf("restoring container %q: %w", cid, err)
 	}
 
 	return nil
 }
 
 // Processes retrieves the list of processes and associated metadata for a
-// given container in this sandbox.
+// given container in this sandbox. If cid is empty, the processes of all
+// containers are returned.
 func (s *Sandbox) Processes(cid string) ([]*control.Process, error) {
 	log.Debugf("Getting processes for container %q in sandbox %q", cid, s.ID)
 	conn, err := s.sandboxConnect()
@@ -366,13 +435,33 @@ func (s *Sandbox) Processes(cid string) ([]*control.Process, error) {
 	}
 	defer conn.Close()
 
+	args := boot.ProcessesArgs{CID: cid}
 	var pl []*control.Process
-	if err := conn.Call(boot.ContMgrProcesses, &cid, &pl); err != nil {
+	if err := conn.Call(boot.ContMgrProcesses, &args, &pl); err != nil {
 		return nil, fmt.Errorf("retrieving process data from sandbox: %v", err)
 	}
 	return pl, nil
 }
 
+// ProcessTree retrieves the processes of a given container in this sandbox
+// arranged in trees, see control.ProcessTree. The first root is the container
+// init, followed by processes started with exec.
+func (s *Sandbox) ProcessTree(cid string) ([]*control.Process, error) {
+	log.Debugf("Getting process tree for container %q in sandbox %q", cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	args := boot.ProcessesArgs{CID: cid, Tree: true}
+	var pl []*control.Process
+	if err := conn.Call(boot.ContMgrProcesses, &args, &pl); err != nil {
+		return nil, fmt.Errorf("retrieving process tree from sandbox: %v", err)
+	}
+	return pl, nil
+}
+
 // NewCGroup returns the sandbox's Cgroup, or an error if it does not have one.
 func (s *Sandbox) NewCGroup() (cgroup.Cgroup, error) {
 	return cgroup.NewFromPid(s.Pid.load(), false /* useSystemd */)
@@ -396,11 +485,68 @@ func (s *Sandbox) Execute(conf *config.Config, args *control.ExecArgs) (int32, e
 	// Send a message to the sandbox control server to start the container.
 	var pid int32
 	if err := conn.Call(boot.ContMgrExecuteAsync, args, &pid); err != nil {
-		return 0, fmt.Errorf("executing command %q in sandbox: %v", args, err)
+		return 0, fmt.Errorf("executing command %q in sandbox: %w", args, err)
 	}
 	return pid, nil
 }
 
+// ExecuteSync runs a command in a container in the sandbox, waits for it to
+// exit and returns its wait status. If the process is killed after
+// args.TimeoutMs, the returned error wraps boot.ErrExecTimeout and the status
+// is the one of a process killed by SIGKILL.
+func (s *Sandbox) ExecuteSync(conf *config.Config, args *control.ExecArgs) (unix.WaitStatus, error) {
+	log.Debugf("Executing new process synchronously in container %q in sandbox %q", args.ContainerID, s.ID)
+
+	if err := s.configureStdios(conf, args.Files); err != nil {
+		return 0, err
+	}
+
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return 0, s.connError(err)
+	}
+	defer conn.Close()
+
+	var ws unix.WaitStatus
+	if err := conn.Call(boot.ContMgrExecute, args, &ws); err != nil {
+		if urpc.CodeOf(err) == boot.ErrCodeExecTimeout {
+			return unix.WaitStatus(unix.SIGKILL), fmt.Errorf("executing command %q in sandbox: %w", args, boot.ErrExecTimeout)
+		}
+		return 0, fmt.Errorf("executing command %q in sandbox: %w", args, err)
+	}
+	return ws, nil
+}
+
+// RunPreExitHook runs a command in a container that is about to be destroyed,
+// and waits for it to exit. The command is killed if it's still running after
+// timeout, in which case the returned error wraps boot.ErrExecTimeout.
+func (s *Sandbox) RunPreExitHook(conf *config.Config, args *control.ExecArgs, timeout time.Duration) (unix.WaitStatus, error) {
+	log.Debugf("Running pre-exit hook in container %q in sandbox %q", args.ContainerID, s.ID)
+
+	if err := s.configureStdios(conf, args.Files); err != nil {
+		return 0, err
+	}
+
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return 0, s.connError(err)
+	}
+	defer conn.Close()
+
+	hookArgs := boot.PreExitHookArgs{
+		ExecArgs: *args,
+		Timeout:  timeout,
+	}
+	var ws unix.WaitStatus
+	if err := conn.Call(boot.ContMgrPreExitHook, &hookArgs, &ws); err != nil {
+		if urpc.CodeOf(err) == boot.ErrCodeExecTimeout {
+			return unix.WaitStatus(unix.SIGKILL), fmt.Errorf("running pre-exit hook %q in sandbox: %w", args, boot.ErrExecTimeout)
+		}
+		return 0, fmt.Errorf("running pre-exit hook %q in sandbox: %v", args, err)
+	}
+	return ws, nil
+}
+
 // Event retrieves stats about the sandbox such as memory and CPU utilization.
 func (s *Sandbox) Event(cid string) (*boot.EventOut, error) {
 	log.Debugf("Getting events for container %q in sandbox %q", cid, s.ID)
@@ -410,170 +556,1014 @@ func (s *Sandbox) Event(cid string) (*boot.EventOut, error) {
 	}
 	defer conn.Close()
 
+	args := boot.EventArgs{CID: cid}
 	var e boot.EventOut
-	// TODO(b/129292330): Pass in the container id (cid) here. The sandbox
-	// should return events only for that container.
-	if err := conn.Call(boot.ContMgrEvent, nil, &e); err != nil {
+	if err := conn.Call(boot.ContMgrEvent, &args, &e); err != nil {
 		return nil, fmt.Errorf("retrieving event data from sandbox: %v", err)
 	}
-	e.Event.ID = cid
 	return &e, nil
 }
 
-func (s *Sandbox) sandboxConnect() (*urpc.Client, error) {
-	log.Debugf("Connecting to sandbox %q", s.ID)
-	conn, err := client.ConnectTo(boot.ControlSocketAddr(s.ID))
+// FutexStats retrieves futex wait statistics for the given container. The
+// sandbox must have been started with futex statistics enabled.
+func (s *Sandbox) FutexStats(cid string) (*boot.FutexStats, error) {
+	log.Debugf("Getting futex stats for container %q in sandbox %q", cid, s.ID)
+	conn, err := s.sandboxConnect()
 	if err != nil {
-		return nil, s.connError(err)
+		return nil, err
 	}
-	return conn, nil
-}
+	defer conn.Close()
 
-func (s *Sandbox) connError(err error) error {
-	return fmt.Errorf("connecting to control server at PID %d: %v", s.Pid.load(), err)
+	var stats boot.FutexStats
+	if err := conn.Call(boot.ContMgrFutexStats, &cid, &stats); err != nil {
+		return nil, fmt.Errorf("retrieving futex stats from sandbox: %w", err)
+	}
+	return &stats, nil
 }
 
-// createSandboxProcess starts the sandbox as a subprocess by running the "boot"
-// command, passing in the bundle dir.
-func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyncFile *os.File) error {
-	donations := donation.Agency{}
-	defer donations.Close()
+// PerfCounters retrieves the hardware events counted while the given
+// container ran application code. The sandbox must have been started with
+// perf counters enabled, on a platform that supports them.
+func (s *Sandbox) PerfCounters(cid string) (*platform.PerfCounters, error) {
+	log.Debugf("Getting perf counters for container %q in sandbox %q", cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
 
-	//
-	// These flags must come BEFORE the "boot" command in cmd.Args.
-	//
+	var counters platform.PerfCounters
+	if err := conn.Call(boot.DebugPerfCounters, &cid, &counters); err != nil {
+		return nil, fmt.Errorf("retrieving perf counters from sandbox: %v", err)
+	}
+	return &counters, nil
+}
 
-	// Open the log files to pass to the sandbox as FDs.
-	if err := donations.OpenAndDonate("log-fd", conf.LogFilename, os.O_CREATE|os.O_WRONLY|os.O_APPEND); err != nil {
-		return err
+// PendingSignals returns the signals queued on the init process of the given
+// container. If flush is true, the signals are discarded.
+func (s *Sandbox) PendingSignals(cid string, flush bool) ([]boot.PendingSignal, error) {
+	log.Debugf("Getting pending signals for container %q in sandbox %q, flush: %t", cid, s.ID, flush)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
 	}
+	defer conn.Close()
 
-	test := ""
-	if len(conf.TestOnlyTestNameEnv) != 0 {
-		// Fetch test name if one is provided and the test only flag was set.
-		if t, ok := specutils.EnvVar(args.Spec.Process.Env, conf.TestOnlyTestNameEnv); ok {
-			test = t
-		}
+	args := boot.PendingSignalsArgs{
+		CID:   cid,
+		Flush: flush,
 	}
-	if err := donations.DonateDebugLogFile("debug-log-fd", conf.DebugLog, "boot", test); err != nil {
-		return err
+	var pending []boot.PendingSignal
+	if err := conn.Call(boot.ContMgrPendingSignals, &args, &pending); err != nil {
+		return nil, fmt.Errorf("retrieving pending signals from sandbox: %v", err)
 	}
-	if err := donations.DonateDebugLogFile("panic-log-fd", conf.PanicLog, "panic", test); err != nil {
+	return pending, nil
+}
+
+// SetReadAhead sets the read-ahead window, in bytes, of the given container.
+func (s *Sandbox) SetReadAhead(cid string, size uint64) error {
+	log.Debugf("Setting read-ahead of container %q in sandbox %q to %d bytes", cid, s.ID, size)
+	conn, err := s.sandboxConnect()
+	if err != nil {
 		return err
 	}
-	covFilename := conf.CoverageReport
-	if covFilename == "" {
-		covFilename = os.Getenv("GO_COVERAGE_FILE")
+	defer conn.Close()
+
+	args := boot.SetReadAheadArgs{
+		CID:  cid,
+		Size: size,
 	}
-	if covFilename != "" && coverage.Available() {
-		if err := donations.DonateDebugLogFile("coverage-fd", covFilename, "cov", test); err != nil {
-			return err
-		}
+	if err := conn.Call(boot.ContMgrSetReadAhead, &args, nil); err != nil {
+		return fmt.Errorf("setting read-ahead: %v", err)
 	}
+	return nil
+}
 
-	cmd := exec.Command(specutils.ExePath, conf.ToFlags()...)
-	cmd.SysProcAttr = &unix.SysProcAttr{
-		// Detach from this session, otherwise cmd will get SIGHUP and SIGCONT
-		// when re-parented.
-		Setsid: true,
+// ReadAhead returns the read-ahead window, in bytes, of the given container.
+func (s *Sandbox) ReadAhead(cid string) (uint64, error) {
+	log.Debugf("Getting read-ahead of container %q in sandbox %q", cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return 0, err
 	}
+	defer conn.Close()
 
-	// Set Args[0] to make easier to spot the sandbox process. Otherwise it's
-	// shown as `exe`.
-	cmd.Args[0] = "runsc-sandbox"
-
-	// Tranfer FDs that need to be present before the "boot" command.
-	// Start at 3 because 0, 1, and 2 are taken by stdin/out/err.
-	nextFD := donations.Transfer(cmd, 3)
-
-	// Add the "boot" command to the args.
-	//
-	// All flags after this must be for the boot command
-	cmd.Args = append(cmd.Args, "boot", "--bundle="+args.BundleDir)
+	var size uint64
+	if err := conn.Call(boot.ContMgrReadAhead, &cid, &size); err != nil {
+		return 0, fmt.Errorf("getting read-ahead: %v", err)
+	}
+	return size, nil
+}
 
-	// If there is a gofer, sends all socket ends to the sandbox.
-	donations.DonateAndClose("io-fds", args.IOFiles...)
-	donations.DonateAndClose("mounts-fd", args.MountsFile)
-	donations.Donate("start-sync-fd", startSyncFile)
-	if err := donations.OpenAndDonate("user-log-fd", args.UserLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND); err != nil {
+// SetSyncPolicy sets how fsync calls of the given container are propagated to
+// the host: "durable", "relaxed" or "none".
+func (s *Sandbox) SetSyncPolicy(cid, policy string) error {
+	log.Debugf("Setting sync policy of container %q in sandbox %q to %q", cid, s.ID, policy)
+	conn, err := s.sandboxConnect()
+	if err != nil {
 		return err
 	}
-	const profFlags = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
-	if err := donations.OpenAndDonate("profile-block-fd", conf.ProfileBlock, profFlags); err != nil {
-		return err
+	defer conn.Close()
+
+	args := boot.SetSyncPolicyArgs{
+		CID:    cid,
+		Policy: policy,
 	}
-	if err := donations.OpenAndDonate("profile-cpu-fd", conf.ProfileCPU, profFlags); err != nil {
-		return err
+	if err := conn.Call(boot.ContMgrSetSyncPolicy, &args, nil); err != nil {
+		return fmt.Errorf("setting sync policy: %v", err)
 	}
-	if err := donations.OpenAndDonate("profile-heap-fd", conf.ProfileHeap, profFlags); err != nil {
-		return err
+	return nil
+}
+
+// SyncPolicy returns the sync policy of the given container.
+func (s *Sandbox) SyncPolicy(cid string) (string, error) {
+	log.Debugf("Getting sync policy of container %q in sandbox %q", cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return "", err
 	}
-	if err := donations.OpenAndDonate("profile-mutex-fd", conf.ProfileMutex, profFlags); err != nil {
-		return err
+	defer conn.Close()
+
+	var policy string
+	if err := conn.Call(boot.ContMgrSyncPolicy, &cid, &policy); err != nil {
+		return "", fmt.Errorf("getting sync policy: %v", err)
 	}
-	if err := donations.OpenAndDonate("trace-fd", conf.TraceFile, profFlags); err != nil {
+	return policy, nil
+}
+
+// SetSchedLatency sets the scheduling latency targets of the given container.
+func (s *Sandbox) SetSchedLatency(cid string, lat boot.SchedLatency) error {
+	log.Debugf("Setting scheduling latency of container %q in sandbox %q to %+v", cid, s.ID, lat)
+	conn, err := s.sandboxConnect()
+	if err != nil {
 		return err
 	}
+	defer conn.Close()
 
-	// Create a socket for the control server and donate it to the sandbox.
-	addr := boot.ControlSocketAddr(s.ID)
-	sockFD, err := server.CreateSocket(addr)
-	log.Infof("Creating sandbox process with addr: %s", addr[1:]) // skip "\00".
-	if err != nil {
-		return fmt.Errorf("creating control server socket for sandbox %q: %v", s.ID, err)
+	args := boot.SetSchedLatencyArgs{
+		CID:     cid,
+		Latency: lat,
 	}
-	donations.DonateAndClose("controller-fd", os.NewFile(uintptr(sockFD), "control_server_socket"))
+	if err := conn.Call(boot.ContMgrSetSchedLatency, &args, nil); err != nil {
+		return fmt.Errorf("setting scheduling latency: %v", err)
+	}
+	return nil
+}
 
-	specFile, err := specutils.OpenSpec(args.BundleDir)
+// SchedLatency returns the scheduling latency targets of the given container.
+func (s *Sandbox) SchedLatency(cid string) (boot.SchedLatency, error) {
+	log.Debugf("Getting scheduling latency of container %q in sandbox %q", cid, s.ID)
+	conn, err := s.sandboxConnect()
 	if err != nil {
-		return err
+		return boot.SchedLatency{}, err
 	}
-	donations.DonateAndClose("spec-fd", specFile)
+	defer conn.Close()
 
-	gPlatform, err := platform.Lookup(conf.Platform)
+	var lat boot.SchedLatency
+	if err := conn.Call(boot.ContMgrSchedLatency, &cid, &lat); err != nil {
+		return boot.SchedLatency{}, fmt.Errorf("getting scheduling latency: %v", err)
+	}
+	return lat, nil
+}
+
+// SetDiskQuota limits the size of the writable layer of the given container
+// to limit bytes. 0 removes the limit.
+func (s *Sandbox) SetDiskQuota(cid string, limit uint64) error {
+	log.Debugf("Setting disk quota of container %q in sandbox %q to %d bytes", cid, s.ID, limit)
+	conn, err := s.sandboxConnect()
 	if err != nil {
 		return err
 	}
-	if deviceFile, err := gPlatform.OpenDevice(conf.PlatformDevicePath); err != nil {
-		return fmt.Errorf("opening device file for platform %q: %v", conf.Platform, err)
-	} else if deviceFile != nil {
-		donations.DonateAndClose("device-fd", deviceFile)
+	defer conn.Close()
+
+	args := boot.SetDiskQuotaArgs{
+		CID:   cid,
+		Limit: limit,
+	}
+	if err := conn.Call(boot.ContMgrSetDiskQuota, &args, nil); err != nil {
+		return fmt.Errorf("setting disk quota: %v", err)
 	}
+	return nil
+}
 
-	// TODO(b/151157106): syscall tests fail by timeout if asyncpreemptoff
-	// isn't set.
-	if conf.Platform == "kvm" {
-		cmd.Env = append(cmd.Env, "GODEBUG=asyncpreemptoff=1")
+// DiskQuota returns the size limit and usage of the writable layer of the given
+// container.
+func (s *Sandbox) DiskQuota(cid string) (boot.DiskQuota, error) {
+	log.Debugf("Getting disk quota of container %q in sandbox %q", cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return boot.DiskQuota{}, err
 	}
+	defer conn.Close()
 
-	// nss is the set of namespaces to join or create before starting the sandbox
-	// process. Mount, IPC and UTS namespaces from the host are not used as they
-	// are virtualized inside the sandbox. Be paranoid and run inside an empty
-	// namespace for these. Don't unshare cgroup because sandbox is added to a
-	// cgroup in the caller's namespace.
-	log.Infof("Sandbox will be started in new mount, IPC and UTS namespaces")
-	nss := []specs.LinuxNamespace{
-		{Type: specs.IPCNamespace},
-		{Type: specs.MountNamespace},
-		{Type: specs.UTSNamespace},
+	var quota boot.DiskQuota
+	if err := conn.Call(boot.ContMgrDiskQuota, &cid, &quota); err != nil {
+		return boot.DiskQuota{}, fmt.Errorf("getting disk quota: %v", err)
 	}
+	return quota, nil
+}
 
-	if gPlatform.Requirements().RequiresCurrentPIDNS {
-		// TODO(b/75837838): Also set a new PID namespace so that we limit
-		// access to other host processes.
-		log.Infof("Sandbox will be started in the current PID namespace")
-	} else {
-		log.Infof("Sandbox will be started in a new PID namespace")
-		nss = append(nss, specs.LinuxNamespace{Type: specs.PIDNamespace})
-		cmd.Args = append(cmd.Args, "--pidns=true")
+// ReadMemory reads length bytes at addr in the memory of process pid of the
+// given container.
+func (s *Sandbox) ReadMemory(cid string, pid int32, addr, length uint64) ([]byte, error) {
+	log.Debugf("Reading memory of PID %d in container %q in sandbox %q, addr: %#x, length: %d", pid, cid, s.ID, addr, length)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
 	}
+	defer conn.Close()
 
-	// Joins the network namespace if network is enabled. the sandbox talks
-	// directly to the host network, which may have been configured in the
-	// namespace.
-	if ns, ok := specutils.GetNS(specs.NetworkNamespace, args.Spec); ok && conf.Network != config.NetworkNone {
-		log.Infof("Sandbox will be started in the container's network namespace: %+v", ns)
-		nss = append(nss, ns)
+	args := boot.ReadMemoryArgs{
+		CID:    cid,
+		PID:    pid,
+		Addr:   addr,
+		Length: length,
+	}
+	var buf []byte
+	if err := conn.Call(boot.ContMgrReadMemory, &args, &buf); err != nil {
+		return nil, fmt.Errorf("reading process memory: %w", err)
+	}
+	return buf, nil
+}
+
+// WriteMemory writes data at addr in the memory of process pid of the given
+// container.
+func (s *Sandbox) WriteMemory(cid string, pid int32, addr uint64, data []byte) error {
+	log.Debugf("Writing memory of PID %d in container %q in sandbox %q, addr: %#x, length: %d", pid, cid, s.ID, addr, len(data))
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.WriteMemoryArgs{
+		CID:  cid,
+		PID:  pid,
+		Addr: addr,
+		Data: data,
+	}
+	if err := conn.Call(boot.ContMgrWriteMemory, &args, nil); err != nil {
+		return fmt.Errorf("writing process memory: %w", err)
+	}
+	return nil
+}
+
+// SchedPolicy returns the scheduling policy of process pid of the given
+// container.
+func (s *Sandbox) SchedPolicy(cid string, pid int32) (*boot.SchedPolicy, error) {
+	log.Debugf("Getting scheduling policy of PID %d in container %q in sandbox %q", pid, cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	args := boot.SchedPolicyArgs{
+		CID: cid,
+		PID: pid,
+	}
+	var policy boot.SchedPolicy
+	if err := conn.Call(boot.ContMgrSchedPolicy, &args, &policy); err != nil {
+		return nil, fmt.Errorf("getting scheduling policy: %w", err)
+	}
+	return &policy, nil
+}
+
+// SetSchedPolicy sets the scheduling policy of process pid of the given
+// container.
+func (s *Sandbox) SetSchedPolicy(cid string, pid int32, policy boot.SchedPolicy) error {
+	log.Debugf("Setting scheduling policy of PID %d in container %q in sandbox %q to %+v", pid, cid, s.ID, policy)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.SchedPolicyArgs{
+		CID:         cid,
+		PID:         pid,
+		SchedPolicy: policy,
+	}
+	if err := conn.Call(boot.ContMgrSetSchedPolicy, &args, nil); err != nil {
+		return fmt.Errorf("setting scheduling policy: %w", err)
+	}
+	return nil
+}
+
+// IPCObjects lists the SysV IPC objects of the given container. If
+// removeOrphaned is true, shared memory segments that aren't attached by any
+// process are removed.
+func (s *Sandbox) IPCObjects(cid string, removeOrphaned bool) (*boot.IPCObjects, error) {
+	log.Debugf("Getting IPC objects of container %q in sandbox %q, remove orphaned: %t", cid, s.ID, removeOrphaned)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	args := boot.IPCObjectsArgs{
+		CID:            cid,
+		RemoveOrphaned: removeOrphaned,
+	}
+	var objs boot.IPCObjects
+	if err := conn.Call(boot.ContMgrIPCObjects, &args, &objs); err != nil {
+		return nil, fmt.Errorf("getting IPC objects: %v", err)
+	}
+	return &objs, nil
+}
+
+// AddDevice creates the device node described by dev in the given container.
+func (s *Sandbox) AddDevice(cid string, dev specs.LinuxDevice) error {
+	log.Debugf("Adding device %q to container %q in sandbox %q", dev.Path, cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.AddDeviceArgs{
+		CID:    cid,
+		Device: dev,
+	}
+	if err := conn.Call(boot.ContMgrAddDevice, &args, nil); err != nil {
+		return fmt.Errorf("adding device: %w", err)
+	}
+	return nil
+}
+
+// AsyncIOStatus lists the asynchronous I/O contexts of the processes of the
+// given container. If cancel is true, requests that haven't started executing
+// are canceled.
+func (s *Sandbox) AsyncIOStatus(cid string, cancel bool) ([]control.AsyncIOProcess, error) {
+	log.Debugf("Getting async I/O status of container %q in sandbox %q, cancel: %t", cid, s.ID, cancel)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	args := boot.AsyncIOStatusArgs{
+		CID:    cid,
+		Cancel: cancel,
+	}
+	var procs []control.AsyncIOProcess
+	if err := conn.Call(boot.ContMgrAsyncIOStatus, &args, &procs); err != nil {
+		return nil, fmt.Errorf("getting async I/O status: %v", err)
+	}
+	return procs, nil
+}
+
+// HostRootPath returns what backs the root filesystem of the given container
+// on the host. The sandbox must run with --debug.
+func (s *Sandbox) HostRootPath(cid string) (boot.HostRootPath, error) {
+	log.Debugf("Getting host root path of container %q in sandbox %q", cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return boot.HostRootPath{}, err
+	}
+	defer conn.Close()
+
+	var root boot.HostRootPath
+	if err := conn.Call(boot.ContMgrHostRootPath, &cid, &root); err != nil {
+		return boot.HostRootPath{}, fmt.Errorf("getting host root path: %v", err)
+	}
+	return root, nil
+}
+
+// InitCommand returns the command of the init process of the given container,
+// as recorded when it started.
+func (s *Sandbox) InitCommand(cid string) (boot.InitCommand, error) {
+	log.Debugf("Getting init command of container %q in sandbox %q", cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return boot.InitCommand{}, err
+	}
+	defer conn.Close()
+
+	var cmd boot.InitCommand
+	if err := conn.Call(boot.ContMgrInitCommand, &cid, &cmd); err != nil {
+		return boot.InitCommand{}, fmt.Errorf("getting init command: %w", err)
+	}
+	return cmd, nil
+}
+
+// IPCLimits returns the IPC limits of the given container's IPC namespace.
+func (s *Sandbox) IPCLimits(cid string) (boot.IPCLimits, error) {
+	log.Debugf("Getting IPC limits of container %q in sandbox %q", cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return boot.IPCLimits{}, err
+	}
+	defer conn.Close()
+
+	var limits boot.IPCLimits
+	if err := conn.Call(boot.ContMgrGetIPCLimits, &cid, &limits); err != nil {
+		return boot.IPCLimits{}, fmt.Errorf("getting IPC limits: %v", err)
+	}
+	return limits, nil
+}
+
+// Health checks that the sandbox control server is responsive. nonce is
+// returned as is in the status.
+func (s *Sandbox) Health(nonce uint64) (*boot.HealthStatus, error) {
+	log.Debugf("Checking health of sandbox %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	args := boot.HealthArgs{Nonce: nonce}
+	var status boot.HealthStatus
+	if err := conn.Call(boot.ContMgrHealth, &args, &status); err != nil {
+		return nil, fmt.Errorf("checking sandbox health: %v", err)
+	}
+	return &status, nil
+}
+
+// SetIPCLimits sets the IPC limits of the given container's IPC namespace.
+// Zero fields of limits are left unchanged.
+func (s *Sandbox) SetIPCLimits(cid string, limits boot.IPCLimits) error {
+	log.Debugf("Setting IPC limits of container %q in sandbox %q to %+v", cid, s.ID, limits)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.SetIPCLimitsArgs{
+		CID:    cid,
+		Limits: limits,
+	}
+	if err := conn.Call(boot.ContMgrSetIPCLimits, &args, nil); err != nil {
+		return fmt.Errorf("setting IPC limits: %v", err)
+	}
+	return nil
+}
+
+// PrivilegeState returns the no_new_privs and securebits state of process pid
+// of the given container. If pid is 0, the container's init process is used.
+func (s *Sandbox) PrivilegeState(cid string, pid int32) (*boot.PrivilegeState, error) {
+	log.Debugf("Getting privilege state of PID %d in container %q in sandbox %q", pid, cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	args := boot.PrivilegeStateArgs{
+		CID: cid,
+		PID: pid,
+	}
+	var state boot.PrivilegeState
+	if err := conn.Call(boot.ContMgrPrivilegeState, &args, &state); err != nil {
+		return nil, fmt.Errorf("getting privilege state: %v", err)
+	}
+	return &state, nil
+}
+
+// PollObjects lists the epoll instances, eventfds and timerfds open in the
+// process with the given PID in the given container.
+func (s *Sandbox) PollObjects(cid string, pid int32) (*boot.PollObjects, error) {
+	log.Debugf("Getting poll objects of PID %d in container %q in sandbox %q", pid, cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	args := boot.PollObjectsArgs{
+		CID: cid,
+		PID: pid,
+	}
+	var objs boot.PollObjects
+	if err := conn.Call(boot.ContMgrPollObjects, &args, &objs); err != nil {
+		return nil, fmt.Errorf("getting poll objects: %v", err)
+	}
+	return &objs, nil
+}
+
+// ForceUnmount lazily detaches the mount at target from the given container.
+func (s *Sandbox) ForceUnmount(cid, target string) error {
+	log.Debugf("Force unmounting %q in container %q in sandbox %q", target, cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.ForceUnmountArgs{
+		CID:    cid,
+		Target: target,
+	}
+	if err := conn.Call(boot.ContMgrForceUnmount, &args, nil); err != nil {
+		return fmt.Errorf("force unmounting %q: %v", target, err)
+	}
+	return nil
+}
+
+// TightenSyscallPolicy restricts the syscalls that the given container may
+// invoke, see boot.containerManager.TightenSyscallPolicy.
+func (s *Sandbox) TightenSyscallPolicy(cid string, policy boot.SyscallPolicy) error {
+	log.Debugf("Tightening syscall policy of container %q in sandbox %q: %+v", cid, s.ID, policy)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.SyscallPolicyArgs{
+		CID:           cid,
+		SyscallPolicy: policy,
+	}
+	if err := conn.Call(boot.ContMgrTightenSyscallPolicy, &args, nil); err != nil {
+		return fmt.Errorf("tightening syscall policy: %v", err)
+	}
+	return nil
+}
+
+// ExportState returns a lossy JSON-friendly snapshot of the state of
+// container cid.
+func (s *Sandbox) ExportState(cid string) (*boot.ContainerState, error) {
+	log.Debugf("Exporting state of container %q in sandbox %q", cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var state boot.ContainerState
+	if err := conn.Call(boot.ContMgrExportState, &cid, &state); err != nil {
+		return nil, fmt.Errorf("exporting state of container %q: %v", cid, err)
+	}
+	return &state, nil
+}
+
+// SetConntrackLimit caps the number of connections tracked by the network
+// stack of container cid, or the root network stack if cid is empty. It
+// returns the number of connections currently tracked.
+func (s *Sandbox) SetConntrackLimit(cid string, limit int, policy string) (int, error) {
+	log.Debugf("Setting conntrack limit of container %q in sandbox %q to %d, policy: %q", cid, s.ID, limit, policy)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	args := boot.SetConntrackLimitArgs{
+		CID:    cid,
+		Limit:  limit,
+		Policy: policy,
+	}
+	var count int
+	if err := conn.Call(boot.NetworkSetConntrackLimit, &args, &count); err != nil {
+		return 0, fmt.Errorf("setting conntrack limit: %v", err)
+	}
+	return count, nil
+}
+
+// SetTCPDefaults configures the defaults of TCP sockets created from now on
+// in the network stack of container cid, or the root network stack if cid is
+// empty. Zero fields of defaults are left unchanged.
+func (s *Sandbox) SetTCPDefaults(cid string, defaults boot.TCPDefaults) error {
+	log.Debugf("Setting TCP defaults of container %q in sandbox %q to %+v", cid, s.ID, defaults)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.SetTCPDefaultsArgs{
+		CID:      cid,
+		Defaults: defaults,
+	}
+	if err := conn.Call(boot.NetworkSetTCPDefaults, &args, nil); err != nil {
+		return fmt.Errorf("setting TCP defaults: %v", err)
+	}
+	return nil
+}
+
+// TCPDefaults returns the defaults of new TCP sockets in the network stack of
+// container cid, or the root network stack if cid is empty.
+func (s *Sandbox) TCPDefaults(cid string) (boot.TCPDefaults, error) {
+	log.Debugf("Getting TCP defaults of container %q in sandbox %q", cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return boot.TCPDefaults{}, err
+	}
+	defer conn.Close()
+
+	var defaults boot.TCPDefaults
+	if err := conn.Call(boot.NetworkTCPDefaults, &cid, &defaults); err != nil {
+		return boot.TCPDefaults{}, fmt.Errorf("getting TCP defaults: %v", err)
+	}
+	return defaults, nil
+}
+
+// NetworkStats returns the interface counters of the network stack of
+// container cid, or the root network stack if cid is empty. It fails if
+// container cid shares the root network stack.
+func (s *Sandbox) NetworkStats(cid string) ([]boot.NICStats, error) {
+	log.Debugf("Getting network stats of container %q in sandbox %q", cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var stats []boot.NICStats
+	if err := conn.Call(boot.NetworkStats, &cid, &stats); err != nil {
+		return nil, fmt.Errorf("getting network stats: %v", err)
+	}
+	return stats, nil
+}
+
+// NetworkStackStats returns the stack-wide counters of the network stack of
+// container cid, or the root network stack if cid is empty.
+func (s *Sandbox) NetworkStackStats(cid string) (boot.StackStats, error) {
+	log.Debugf("Getting network stack stats of container %q in sandbox %q", cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return boot.StackStats{}, err
+	}
+	defer conn.Close()
+
+	var stats boot.StackStats
+	if err := conn.Call(boot.NetworkStackStats, &cid, &stats); err != nil {
+		return boot.StackStats{}, fmt.Errorf("getting network stack stats: %v", err)
+	}
+	return stats, nil
+}
+
+// ResetNetworkStats zeroes the interface counters of the network stack of
+// container cid, or the root network stack if cid is empty. It fails if
+// container cid shares the root network stack.
+func (s *Sandbox) ResetNetworkStats(cid string) error {
+	log.Debugf("Resetting network stats of container %q in sandbox %q", cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.Call(boot.NetworkResetStats, &cid, nil); err != nil {
+		return fmt.Errorf("resetting network stats: %v", err)
+	}
+	return nil
+}
+
+// AddRoute adds route through interface nic to the network stack of container
+// cid, or the root network stack if cid is empty.
+func (s *Sandbox) AddRoute(cid, nic string, route boot.Route) error {
+	log.Debugf("Adding route %+v via %q to container %q in sandbox %q", route, nic, cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.RouteArgs{
+		CID:   cid,
+		NIC:   nic,
+		Route: route,
+	}
+	if err := conn.Call(boot.NetworkAddRoute, &args, nil); err != nil {
+		return fmt.Errorf("adding route: %v", err)
+	}
+	return nil
+}
+
+// DeleteRoute deletes route through interface nic from the network stack of
+// container cid, or the root network stack if cid is empty.
+func (s *Sandbox) DeleteRoute(cid, nic string, route boot.Route) error {
+	log.Debugf("Deleting route %+v via %q from container %q in sandbox %q", route, nic, cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.RouteArgs{
+		CID:   cid,
+		NIC:   nic,
+		Route: route,
+	}
+	if err := conn.Call(boot.NetworkDeleteRoute, &args, nil); err != nil {
+		return fmt.Errorf("deleting route: %v", err)
+	}
+	return nil
+}
+
+// SetNICEnabled enables or disables interface nic in the network stack of
+// container cid, or the root network stack if cid is empty.
+func (s *Sandbox) SetNICEnabled(cid, nic string, enabled bool) error {
+	log.Debugf("Setting interface %q enabled: %t in container %q in sandbox %q", nic, enabled, cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.SetNICEnabledArgs{
+		CID:     cid,
+		NIC:     nic,
+		Enabled: enabled,
+	}
+	if err := conn.Call(boot.NetworkSetNICEnabled, &args, nil); err != nil {
+		return fmt.Errorf("setting interface %q enabled: %t: %v", nic, enabled, err)
+	}
+	return nil
+}
+
+// SetMTU changes the MTU of interface nic of the network stack of container
+// cid, or the root network stack if cid is empty.
+func (s *Sandbox) SetMTU(cid, nic string, mtu uint32) error {
+	log.Debugf("Setting MTU of interface %q to %d in container %q in sandbox %q", nic, mtu, cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.SetMTUArgs{
+		CID: cid,
+		NIC: nic,
+		MTU: mtu,
+	}
+	if err := conn.Call(boot.NetworkSetMTU, &args, nil); err != nil {
+		return fmt.Errorf("setting MTU of interface %q: %v", nic, err)
+	}
+	return nil
+}
+
+// AddAddress assigns addr to interface nic of the network stack of container
+// cid, or the root network stack if cid is empty.
+func (s *Sandbox) AddAddress(cid, nic string, addr boot.IPWithPrefix) error {
+	log.Debugf("Adding address %s to interface %q in container %q in sandbox %q", addr, nic, cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.AddressArgs{
+		CID:     cid,
+		NIC:     nic,
+		Address: addr,
+	}
+	if err := conn.Call(boot.NetworkAddAddress, &args, nil); err != nil {
+		return fmt.Errorf("adding address: %v", err)
+	}
+	return nil
+}
+
+// RemoveAddress removes addr from interface nic of the network stack of
+// container cid, or the root network stack if cid is empty.
+func (s *Sandbox) RemoveAddress(cid, nic string, addr boot.IPWithPrefix) error {
+	log.Debugf("Removing address %s from interface %q in container %q in sandbox %q", addr, nic, cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.AddressArgs{
+		CID:     cid,
+		NIC:     nic,
+		Address: addr,
+	}
+	if err := conn.Call(boot.NetworkRemoveAddress, &args, nil); err != nil {
+		return fmt.Errorf("removing address: %v", err)
+	}
+	return nil
+}
+
+// ListInterfaces returns the interfaces of the network stack of container cid,
+// or the root network stack if cid is empty, with their addresses.
+func (s *Sandbox) ListInterfaces(cid string) ([]boot.Interface, error) {
+	log.Debugf("Listing interfaces of container %q in sandbox %q", cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var ifaces []boot.Interface
+	if err := conn.Call(boot.NetworkListInterfaces, &cid, &ifaces); err != nil {
+		return nil, fmt.Errorf("listing interfaces: %v", err)
+	}
+	return ifaces, nil
+}
+
+// ListRoutes returns the route table of the network stack of container cid,
+// or the root network stack if cid is empty.
+func (s *Sandbox) ListRoutes(cid string) ([]boot.RouteEntry, error) {
+	log.Debugf("Listing routes of container %q in sandbox %q", cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var routes []boot.RouteEntry
+	if err := conn.Call(boot.NetworkListRoutes, &cid, &routes); err != nil {
+		return nil, fmt.Errorf("listing routes: %v", err)
+	}
+	return routes, nil
+}
+
+// ReinitializeNetwork replaces the root network stack of the sandbox with a
+// new one, keeping the containers running. Established connections are lost.
+func (s *Sandbox) ReinitializeNetwork() error {
+	log.Debugf("Reinitializing network of sandbox %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.Call(boot.NetworkReinitialize, nil, nil); err != nil {
+		return fmt.Errorf("reinitializing network: %v", err)
+	}
+	return nil
+}
+
+func (s *Sandbox) sandboxConnect() (*urpc.Client, error) {
+	log.Debugf("Connecting to sandbox %q", s.ID)
+	conn, err := client.ConnectToWithToken(boot.ControlSocketAddr(s.ID), s.ControlToken)
+	if err != nil {
+		return nil, s.connError(err)
+	}
+	return conn, nil
+}
+
+func (s *Sandbox) connError(err error) error {
+	return fmt.Errorf("connecting to control server at PID %d: %v", s.Pid.load(), err)
+}
+
+// createSandboxProcess starts the sandbox as a subprocess by running the "boot"
+// command, passing in the bundle dir.
+func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyncFile *os.File) error {
+	donations := donation.Agency{}
+	defer donations.Close()
+
+	//
+	// These flags must come BEFORE the "boot" command in cmd.Args.
+	//
+
+	// Open the log files to pass to the sandbox as FDs.
+	if err := donations.OpenAndDonate("log-fd", conf.LogFilename, os.O_CREATE|os.O_WRONLY|os.O_APPEND); err != nil {
+		return err
+	}
+
+	test := ""
+	if len(conf.TestOnlyTestNameEnv) != 0 {
+		// Fetch test name if one is provided and the test only flag was set.
+		if t, ok := specutils.EnvVar(args.Spec.Process.Env, conf.TestOnlyTestNameEnv); ok {
+			test = t
+		}
+	}
+	if err := donations.DonateDebugLogFile("debug-log-fd", conf.DebugLog, "boot", test); err != nil {
+		return err
+	}
+	if err := donations.DonateDebugLogFile("panic-log-fd", conf.PanicLog, "panic", test); err != nil {
+		return err
+	}
+	covFilename := conf.CoverageReport
+	if covFilename == "" {
+		covFilename = os.Getenv("GO_COVERAGE_FILE")
+	}
+	if covFilename != "" && coverage.Available() {
+		if err := donations.DonateDebugLogFile("coverage-fd", covFilename, "cov", test); err != nil {
+			return err
+		}
+	}
+
+	cmd := exec.Command(specutils.ExePath, conf.ToFlags()...)
+	cmd.SysProcAttr = &unix.SysProcAttr{
+		// Detach from this session, otherwise cmd will get SIGHUP and SIGCONT
+		// when re-parented.
+		Setsid: true,
+	}
+
+	// Set Args[0] to make easier to spot the sandbox process. Otherwise it's
+	// shown as `exe`.
+	cmd.Args[0] = "runsc-sandbox"
+
+	// Tranfer FDs that need to be present before the "boot" command.
+	// Start at 3 because 0, 1, and 2 are taken by stdin/out/err.
+	nextFD := donations.Transfer(cmd, 3)
+
+	// Add the "boot" command to the args.
+	//
+	// All flags after this must be for the boot command
+	cmd.Args = append(cmd.Args, "boot", "--bundle="+args.BundleDir)
+
+	// If there is a gofer, sends all socket ends to the sandbox.
+	donations.DonateAndClose("io-fds", args.IOFiles...)
+	donations.DonateAndClose("mounts-fd", args.MountsFile)
+	donations.Donate("start-sync-fd", startSyncFile)
+	if args.ReadyFile != nil {
+		donations.Donate("ready-fd", args.ReadyFile)
+	}
+	if err := donations.OpenAndDonate("user-log-fd", args.UserLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND); err != nil {
+		return err
+	}
+	const profFlags = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if err := donations.OpenAndDonate("profile-block-fd", conf.ProfileBlock, profFlags); err != nil {
+		return err
+	}
+	if err := donations.OpenAndDonate("profile-cpu-fd", conf.ProfileCPU, profFlags); err != nil {
+		return err
+	}
+	if err := donations.OpenAndDonate("profile-heap-fd", conf.ProfileHeap, profFlags); err != nil {
+		return err
+	}
+	if err := donations.OpenAndDonate("profile-mutex-fd", conf.ProfileMutex, profFlags); err != nil {
+		return err
+	}
+	if err := donations.OpenAndDonate("trace-fd", conf.TraceFile, profFlags); err != nil {
+		return err
+	}
+
+	// Create a socket for the control server and donate it to the sandbox.
+	addr := boot.ControlSocketAddr(s.ID)
+	sockFD, err := server.CreateSocket(addr)
+	log.Infof("Creating sandbox process with addr: %s", addr[1:]) // skip "\00".
+	if err != nil {
+		return fmt.Errorf("creating control server socket for sandbox %q: %v", s.ID, err)
+	}
+	donations.DonateAndClose("controller-fd", os.NewFile(uintptr(sockFD), "control_server_socket"))
+
+	// Pass the control token through a pipe, so that it doesn't show up in the
+	// command line.
+	token := make([]byte, controlTokenLen)
+	if _, err := rand.Read(token); err != nil {
+		return fmt.Errorf("generating control token: %v", err)
+	}
+	tokenReader, tokenWriter, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("creating control token pipe: %v", err)
+	}
+	_, err = tokenWriter.Write(token)
+	tokenWriter.Close()
+	if err != nil {
+		tokenReader.Close()
+		return fmt.Errorf("writing control token: %v", err)
+	}
+	donations.DonateAndClose("control-token-fd", tokenReader)
+	s.ControlToken = token
+
+	specFile, err := specutils.OpenSpec(args.BundleDir)
+	if err != nil {
+		return err
+	}
+	donations.DonateAndClose("spec-fd", specFile)
+
+	gPlatform, err := platform.Lookup(conf.Platform)
+	if err != nil {
+		return err
+	}
+	if deviceFile, err := gPlatform.OpenDevice(conf.PlatformDevicePath); err != nil {
+		return fmt.Errorf("opening device file for platform %q: %v", conf.Platform, err)
+	} else if deviceFile != nil {
+		donations.DonateAndClose("device-fd", deviceFile)
+	}
+
+	// TODO(b/151157106): syscall tests fail by timeout if asyncpreemptoff
+	// isn't set.
+	if conf.Platform == "kvm" {
+		cmd.Env = append(cmd.Env, "GODEBUG=asyncpreemptoff=1")
+	}
+
+	// nss is the set of namespaces to join or create before starting the sandbox
+	// process. Mount, IPC and UTS namespaces from the host are not used as they
+	// are virtualized inside the sandbox. Be paranoid and run inside an empty
+	// namespace for these. Don't unshare cgroup because sandbox is added to a
+	// cgroup in the caller's namespace.
+	log.Infof("Sandbox will be started in new mount, IPC and UTS namespaces")
+	nss := []specs.LinuxNamespace{
+		{Type: specs.IPCNamespace},
+		{Type: specs.MountNamespace},
+		{Type: specs.UTSNamespace},
+	}
+
+	if gPlatform.Requirements().RequiresCurrentPIDNS {
+		// TODO(b/75837838): Also set a new PID namespace so that we limit
+		// access to other host processes.
+		log.Infof("Sandbox will be started in the current PID namespace")
+	} else {
+		log.Infof("Sandbox will be started in a new PID namespace")
+		nss = append(nss, specs.LinuxNamespace{Type: specs.PIDNamespace})
+		cmd.Args = append(cmd.Args, "--pidns=true")
+	}
+
+	// Joins the network namespace if network is enabled. the sandbox talks
+	// directly to the host network, which may have been configured in the
+	// namespace.
+	if ns, ok := specutils.GetNS(specs.NetworkNamespace, args.Spec); ok && conf.Network != config.NetworkNone {
+		log.Infof("Sandbox will be started in the container's network namespace: %+v", ns)
+		nss = append(nss, ns)
 	} else if conf.Network == config.NetworkHost {
 		log.Infof("Sandbox will be started in the host network namespace")
 	} else {
@@ -825,9 +1815,11 @@ func (s *Sandbox) Wait(cid string) (unix.WaitStatus, error) {
 	} else {
 		defer conn.Close()
 
-		// Try the Wait RPC to the sandbox.
+		// Try the Wait RPC to the sandbox. Unlike ContMgrWait,
+		// ContMgrWaitContainer stops waiting in the sandbox if we go away.
 		var ws unix.WaitStatus
-		err = conn.Call(boot.ContMgrWait, &cid, &ws)
+		args := boot.WaitContainerArgs{CID: cid}
+		err = conn.Call(boot.ContMgrWaitContainer, &args, &ws)
 		conn.Close()
 		if err == nil {
 			if s.IsRootContainer(cid) {
@@ -863,10 +1855,107 @@ func (s *Sandbox) Wait(cid string) (unix.WaitStatus, error) {
 	return s.status, nil
 }
 
+// WaitDetailed waits for the init process of the given container, like Wait,
+// and returns how it exited. Unlike Wait, it doesn't fall back to the sandbox
+// exit status if the sandbox is gone.
+func (s *Sandbox) WaitDetailed(cid string) (*boot.ExitResult, error) {
+	log.Debugf("Waiting for container %q in sandbox %q, detailed result", cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var result boot.ExitResult
+	if err := conn.Call(boot.ContMgrWaitDetailed, &cid, &result); err != nil {
+		return nil, fmt.Errorf("waiting on container %q: %v", cid, err)
+	}
+	if s.IsRootContainer(cid) {
+		if err := s.waitForStopped(); err != nil {
+			return nil, err
+		}
+	}
+	return &result, nil
+}
+
+// WaitOCI waits for the init process of the given container, like Wait, and
+// returns its raw wait status along with its exit status translated to the OCI
+// convention. Unlike Wait, it doesn't fall back to the sandbox exit status if
+// the sandbox is gone.
+func (s *Sandbox) WaitOCI(cid string) (*boot.WaitResult, error) {
+	log.Debugf("Waiting for container %q in sandbox %q, OCI exit status", cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var result boot.WaitResult
+	if err := conn.Call(boot.ContMgrWaitOCI, &cid, &result); err != nil {
+		return nil, fmt.Errorf("waiting on container %q: %v", cid, err)
+	}
+	if s.IsRootContainer(cid) {
+		if err := s.waitForStopped(); err != nil {
+			return nil, err
+		}
+	}
+	return &result, nil
+}
+
+// WaitNoHang returns the WaitStatus of the containerized process if it has
+// exited. Otherwise, it returns an error wrapping boot.ErrStillRunning without
+// waiting.
+func (s *Sandbox) WaitNoHang(cid string) (unix.WaitStatus, error) {
+	log.Debugf("Checking if container %q in sandbox %q has exited", cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return unix.WaitStatus(0), err
+	}
+	defer conn.Close()
+
+	args := boot.WaitContainerArgs{
+		CID:    cid,
+		NoHang: true,
+	}
+	var ws unix.WaitStatus
+	if err := conn.Call(boot.ContMgrWaitContainer, &args, &ws); err != nil {
+		if urpc.CodeOf(err) == boot.ErrCodeStillRunning {
+			return unix.WaitStatus(0), fmt.Errorf("waiting on container %q: %w", cid, boot.ErrStillRunning)
+		}
+		return unix.WaitStatus(0), fmt.Errorf("waiting on container %q: %w", cid, err)
+	}
+	return ws, nil
+}
+
+// WaitAll returns the exit status of all processes exec'd in container cid
+// that have exited but haven't been waited for yet, without waiting for the
+// others.
+func (s *Sandbox) WaitAll(cid string) ([]boot.ProcessExitStatus, error) {
+	log.Debugf("Collecting exited processes of container %q in sandbox %q", cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var statuses []boot.ProcessExitStatus
+	if err := conn.Call(boot.ContMgrWaitAll, &cid, &statuses); err != nil {
+		return nil, fmt.Errorf("waiting on processes of container %q: %v", cid, err)
+	}
+	return statuses, nil
+}
+
 // WaitPID waits for process 'pid' in the container's sandbox and returns its
 // WaitStatus.
 func (s *Sandbox) WaitPID(cid string, pid int32) (unix.WaitStatus, error) {
-	log.Debugf("Waiting for PID %d in sandbox %q", pid, s.ID)
+	return s.WaitPIDTimeout(cid, pid, 0)
+}
+
+// WaitPIDTimeout is like WaitPID, but gives up after timeout unless it's 0.
+// The returned error wraps boot.ErrWaitTimeout if the process hasn't exited
+// by then. Once the process has exited, its exit status is cleared.
+func (s *Sandbox) WaitPIDTimeout(cid string, pid int32, timeout time.Duration) (unix.WaitStatus, error) {
+	log.Debugf("Waiting for PID %d in sandbox %q, timeout: %v", pid, s.ID, timeout)
 	var ws unix.WaitStatus
 	conn, err := s.sandboxConnect()
 	if err != nil {
@@ -875,11 +1964,19 @@ func (s *Sandbox) WaitPID(cid string, pid int32) (unix.WaitStatus, error) {
 	defer conn.Close()
 
 	args := &boot.WaitPIDArgs{
-		PID: pid,
-		CID: cid,
+		PID:       pid,
+		CID:       cid,
+		TimeoutMs: timeout.Milliseconds(),
+	}
+	if timeout > 0 && args.TimeoutMs == 0 {
+		// Don't turn a short timeout into an unbounded wait.
+		args.TimeoutMs = 1
 	}
 	if err := conn.Call(boot.ContMgrWaitPID, args, &ws); err != nil {
-		return ws, fmt.Errorf("waiting on PID %d in sandbox %q: %v", pid, s.ID, err)
+		if urpc.CodeOf(err) == boot.ErrCodeWaitTimeout {
+			return ws, fmt.Errorf("waiting on PID %d in sandbox %q: %w", pid, s.ID, boot.ErrWaitTimeout)
+		}
+		return ws, fmt.Errorf("waiting on PID %d in sandbox %q: %w", pid, s.ID, err)
 	}
 	return ws, nil
 }
@@ -908,114 +2005,379 @@ func (s *Sandbox) destroy() error {
 	return nil
 }
 
-// SignalContainer sends the signal to a container in the sandbox. If all is
-// true and signal is SIGKILL, then waits for all processes to exit before
-// returning.
-func (s *Sandbox) SignalContainer(cid string, sig unix.Signal, all bool) error {
-	log.Debugf("Signal sandbox %q", s.ID)
+// SignalContainer sends the signal to a container in the sandbox. If all is
+// true and signal is SIGKILL, then waits for all processes to exit before
+// returning.
+func (s *Sandbox) SignalContainer(cid string, sig unix.Signal, all bool) error {
+	log.Debugf("Signal sandbox %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	mode := boot.DeliverToProcess
+	if all {
+		mode = boot.DeliverToAllProcesses
+	}
+
+	args := boot.SignalArgs{
+		CID:   cid,
+		Signo: int32(sig),
+		Mode:  mode,
+	}
+	var res boot.SignalResult
+	if err := conn.Call(boot.ContMgrSignal, &args, &res); err != nil {
+		return fmt.Errorf("signaling container %q: %w", cid, err)
+	}
+	log.Debugf("Signal %v delivered to %d processes in container %q", sig, res.Count, cid)
+	return nil
+}
+
+// SignalProcess sends the signal to a particular process in the container. If
+// fgProcess is true, then the signal is sent to the foreground process group
+// in the same session that PID belongs to. This is only valid if the process
+// is attached to a host TTY.
+func (s *Sandbox) SignalProcess(cid string, pid int32, sig unix.Signal, fgProcess bool) error {
+	log.Debugf("Signal sandbox %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	mode := boot.DeliverToProcess
+	if fgProcess {
+		mode = boot.DeliverToForegroundProcessGroup
+	}
+
+	args := boot.SignalArgs{
+		CID:   cid,
+		Signo: int32(sig),
+		PID:   pid,
+		Mode:  mode,
+	}
+	var res boot.SignalResult
+	if err := conn.Call(boot.ContMgrSignal, &args, &res); err != nil {
+		return fmt.Errorf("signaling container %q PID %d: %w", cid, pid, err)
+	}
+	log.Debugf("Signal %v sent to container %q PID %d: %+v", sig, cid, pid, res)
+	return nil
+}
+
+// QueueSignal sends the realtime signal sig to a particular process in the
+// container, passing value to its handler like sigqueue(3). The value is
+// ignored for standard signals.
+func (s *Sandbox) QueueSignal(cid string, pid int32, sig unix.Signal, value int64) error {
+	log.Debugf("Queue signal %v with value %d to container %q PID %d in sandbox %q", sig, value, cid, pid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.SignalArgs{
+		CID:   cid,
+		Signo: int32(sig),
+		PID:   pid,
+		Mode:  boot.DeliverToProcess,
+		Value: value,
+	}
+	var res boot.SignalResult
+	if err := conn.Call(boot.ContMgrSignal, &args, &res); err != nil {
+		return fmt.Errorf("queuing signal to container %q PID %d: %w", cid, pid, err)
+	}
+	return nil
+}
+
+// SignalProcessGroup sends the signal to all processes of the container in the
+// given process group. pgid is relative to the container's PID namespace. It
+// returns the number of processes signaled.
+func (s *Sandbox) SignalProcessGroup(cid string, pgid int32, sig unix.Signal) (int, error) {
+	log.Debugf("Signal process group %d of container %q in sandbox %q", pgid, cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	args := boot.SignalProcessGroupArgs{
+		CID:   cid,
+		PGID:  pgid,
+		Signo: int32(sig),
+	}
+	var res boot.SignalResult
+	if err := conn.Call(boot.ContMgrSignalProcessGroup, &args, &res); err != nil {
+		return 0, fmt.Errorf("signaling container %q process group %d: %w", cid, pgid, err)
+	}
+	return res.Count, nil
+}
+
+// ResizeTTY sets the window size of the TTY of a process in the container and
+// sends SIGWINCH to the TTY's foreground process group. If pid is 0, the
+// container init process is used.
+func (s *Sandbox) ResizeTTY(cid string, pid int32, rows, cols uint16) error {
+	log.Debugf("Resize TTY of container %q PID %d in sandbox %q to %dx%d", cid, pid, s.ID, cols, rows)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.ResizeTTYArgs{
+		CID:  cid,
+		PID:  pid,
+		Rows: rows,
+		Cols: cols,
+	}
+	if err := conn.Call(boot.ContMgrResizeTTY, &args, nil); err != nil {
+		return fmt.Errorf("resizing TTY of container %q PID %d: %w", cid, pid, err)
+	}
+	return nil
+}
+
+// Checkpoint sends the checkpoint call for a container in the sandbox.
+// The statefile will be written to f, which may be a regular file or a socket
+// that streams the state to the restoring side.
+func (s *Sandbox) Checkpoint(cid string, f *os.File) error {
+	return s.CheckpointCompression(cid, f, statefile.CompressionBestSpeed)
+}
+
+// CheckpointCompression is like Checkpoint, but compresses the statefile as
+// selected by compression.
+func (s *Sandbox) CheckpointCompression(cid string, f *os.File, compression statefile.Compression) error {
+	return s.CheckpointWithOpts(cid, f, control.SaveOpts{Compression: compression})
+}
+
+// CheckpointWithOpts is like Checkpoint, but takes the options of the save.
+// The statefile is written to f,
+// which is prepended to opt's file payload. The payload may contain a file to
+// report the progress of the checkpoint to.
+func (s *Sandbox) CheckpointWithOpts(cid string, f *os.File, opt control.SaveOpts) error {
+	log.Debugf("Checkpoint sandbox %q, compression: %q", s.ID, opt.Compression)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	opt.FilePayload = urpc.FilePayload{
+		Files: append([]*os.File{f}, opt.FilePayload.Files...),
+	}
+
+	if err := conn.Call(boot.ContMgrCheckpoint, &opt, nil); err != nil {
+		return fmt.Errorf("checkpointing container %q: %w", cid, err)
+	}
+	return nil
+}
+
+// CheckpointContainer sends the checkpoint call for a single container in the
+// sandbox. It's deferred and always fails with boot.ErrCodeUnimplemented,
+// see boot.containerManager.CheckpointContainer.
+func (s *Sandbox) CheckpointContainer(cid string, f *os.File) error {
+	log.Debugf("Checkpoint container %q in sandbox %q", cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.CheckpointContainerArgs{
+		SaveOpts: control.SaveOpts{
+			FilePayload: urpc.FilePayload{
+				Files: []*os.File{f},
+			},
+		},
+		CID: cid,
+	}
+	if err := conn.Call(boot.ContMgrCheckpointContainer, &args, nil); err != nil {
+		return fmt.Errorf("checkpointing container %q: %w", cid, err)
+	}
+	return nil
+}
+
+// SetCheckpointFile sets the file that the sandbox is checkpointed to when the
+// checkpoint signal is sent to the root container's init process.
+func (s *Sandbox) SetCheckpointFile(f *os.File) error {
+	log.Debugf("Set checkpoint file of sandbox %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	opt := control.SaveOpts{
+		FilePayload: urpc.FilePayload{
+			Files: []*os.File{f},
+		},
+	}
+	if err := conn.Call(boot.ContMgrSetCheckpointFile, &opt, nil); err != nil {
+		return fmt.Errorf("setting checkpoint file of sandbox %q: %w", s.ID, err)
+	}
+	return nil
+}
+
+// EventStream starts streaming structured events about all containers in the
+// sandbox to f, one JSON object per line. The sandbox stops writing to f once
+// the reader closes it.
+func (s *Sandbox) EventStream(f *os.File) error {
+	log.Debugf("Event stream for sandbox %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.EventStreamArgs{
+		FilePayload: urpc.FilePayload{
+			Files: []*os.File{f},
+		},
+	}
+	if err := conn.Call(boot.ContMgrEventStream, &args, nil); err != nil {
+		return fmt.Errorf("starting event stream of sandbox %q: %w", s.ID, err)
+	}
+	return nil
+}
+
+// SetCoreDumpUpload enables core dumps in the sandbox. Core dumps, each
+// prefixed with a boot.CoreDumpHeader, are written to f and truncated to
+// maxSize bytes, or boot.DefaultCoreDumpMaxSize if maxSize is 0.
+func (s *Sandbox) SetCoreDumpUpload(f *os.File, maxSize uint64) error {
+	log.Debugf("Set core dump upload of sandbox %q, max size: %d", s.ID, maxSize)
 	conn, err := s.sandboxConnect()
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
-	mode := boot.DeliverToProcess
-	if all {
-		mode = boot.DeliverToAllProcesses
-	}
-
-	args := boot.SignalArgs{
-		CID:   cid,
-		Signo: int32(sig),
-		Mode:  mode,
+	args := boot.SetCoreDumpUploadArgs{
+		MaxSize: maxSize,
+		FilePayload: urpc.FilePayload{
+			Files: []*os.File{f},
+		},
 	}
-	if err := conn.Call(boot.ContMgrSignal, &args, nil); err != nil {
-		return fmt.Errorf("signaling container %q: %v", cid, err)
+	if err := conn.Call(boot.ContMgrSetCoreDumpUpload, &args, nil); err != nil {
+		return fmt.Errorf("setting core dump upload of sandbox %q: %w", s.ID, err)
 	}
 	return nil
 }
 
-// SignalProcess sends the signal to a particular process in the container. If
-// fgProcess is true, then the signal is sent to the foreground process group
-// in the same session that PID belongs to. This is only valid if the process
-// is attached to a host TTY.
-func (s *Sandbox) SignalProcess(cid string, pid int32, sig unix.Signal, fgProcess bool) error {
-	log.Debugf("Signal sandbox %q", s.ID)
+// Pause sends the pause call for a container in the sandbox.
+func (s *Sandbox) Pause(cid string) error {
+	return s.PauseTimeout(cid, 0)
+}
+
+// PauseTimeout is like Pause, but fails and leaves the sandbox running if its
+// tasks haven't all stopped within timeout, unless it's 0.
+func (s *Sandbox) PauseTimeout(cid string, timeout time.Duration) error {
+	log.Debugf("Pause sandbox %q, timeout: %v", s.ID, timeout)
 	conn, err := s.sandboxConnect()
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
-	mode := boot.DeliverToProcess
-	if fgProcess {
-		mode = boot.DeliverToForegroundProcessGroup
+	args := control.PauseArgs{TimeoutMs: timeout.Milliseconds()}
+	if timeout > 0 && args.TimeoutMs == 0 {
+		// Don't turn a short timeout into an unbounded wait.
+		args.TimeoutMs = 1
 	}
-
-	args := boot.SignalArgs{
-		CID:   cid,
-		Signo: int32(sig),
-		PID:   pid,
-		Mode:  mode,
+	var result control.PauseResult
+	if err := conn.Call(boot.LifecyclePause, &args, &result); err != nil {
+		return fmt.Errorf("pausing container %q: %v", cid, err)
 	}
-	if err := conn.Call(boot.ContMgrSignal, &args, nil); err != nil {
-		return fmt.Errorf("signaling container %q PID %d: %v", cid, pid, err)
+	if !result.Paused {
+		log.Infof("Sandbox %q was already paused", s.ID)
 	}
 	return nil
 }
 
-// Checkpoint sends the checkpoint call for a container in the sandbox.
-// The statefile will be written to f.
-func (s *Sandbox) Checkpoint(cid string, f *os.File) error {
-	log.Debugf("Checkpoint sandbox %q", s.ID)
+// Resume sends the resume call for a container in the sandbox.
+func (s *Sandbox) Resume(cid string) error {
+	log.Debugf("Resume sandbox %q", s.ID)
 	conn, err := s.sandboxConnect()
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
-	opt := control.SaveOpts{
-		FilePayload: urpc.FilePayload{
-			Files: []*os.File{f},
-		},
+	var result control.ResumeResult
+	if err := conn.Call(boot.LifecycleResume, nil, &result); err != nil {
+		return fmt.Errorf("resuming container %q: %v", cid, err)
 	}
-
-	if err := conn.Call(boot.ContMgrCheckpoint, &opt, nil); err != nil {
-		return fmt.Errorf("checkpointing container %q: %v", cid, err)
+	if !result.Resumed {
+		log.Infof("Sandbox %q wasn't paused", s.ID)
 	}
 	return nil
 }
 
-// Pause sends the pause call for a container in the sandbox.
-func (s *Sandbox) Pause(cid string) error {
-	log.Debugf("Pause sandbox %q", s.ID)
+// PauseContainer stops all processes of container cid, leaving the other
+// containers in the sandbox running.
+func (s *Sandbox) PauseContainer(cid string) error {
+	log.Debugf("Pause container %q in sandbox %q", cid, s.ID)
 	conn, err := s.sandboxConnect()
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
-	if err := conn.Call(boot.LifecyclePause, nil, nil); err != nil {
+	args := boot.PauseContainerArgs{CID: cid}
+	if err := conn.Call(boot.ContMgrPauseContainer, &args, nil); err != nil {
 		return fmt.Errorf("pausing container %q: %v", cid, err)
 	}
 	return nil
 }
 
-// Resume sends the resume call for a container in the sandbox.
-func (s *Sandbox) Resume(cid string) error {
-	log.Debugf("Resume sandbox %q", s.ID)
+// ResumeContainer resumes the processes of container cid stopped by
+// PauseContainer.
+func (s *Sandbox) ResumeContainer(cid string) error {
+	log.Debugf("Resume container %q in sandbox %q", cid, s.ID)
 	conn, err := s.sandboxConnect()
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
-	if err := conn.Call(boot.LifecycleResume, nil, nil); err != nil {
+	if err := conn.Call(boot.ContMgrResumeContainer, &cid, nil); err != nil {
 		return fmt.Errorf("resuming container %q: %v", cid, err)
 	}
 	return nil
 }
 
+// ListContainers returns all containers known to the sandbox, including the
+// ones that haven't started yet, sorted by ID.
+func (s *Sandbox) ListContainers() ([]boot.ContainerInfo, error) {
+	log.Debugf("Listing containers in sandbox %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var infos []boot.ContainerInfo
+	if err := conn.Call(boot.ContMgrListContainers, nil, &infos); err != nil {
+		return nil, fmt.Errorf("listing containers in sandbox %q: %v", s.ID, err)
+	}
+	return infos, nil
+}
+
+// ContainerStatus returns the lifecycle state of container cid as seen by the
+// sandbox.
+func (s *Sandbox) ContainerStatus(cid string) (boot.ContainerStatus, error) {
+	log.Debugf("Getting status of container %q in sandbox %q", cid, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return boot.ContainerStatus{}, err
+	}
+	defer conn.Close()
+
+	var status boot.ContainerStatus
+	if err := conn.Call(boot.ContMgrStatus, &cid, &status); err != nil {
+		return boot.ContainerStatus{}, fmt.Errorf("getting status of container %q: %v", cid, err)
+	}
+	return status, nil
+}
+
 // Cat sends the cat call for a container in the sandbox.
 func (s *Sandbox) Cat(cid string, files []string, out *os.File) error {
 	log.Debugf("Cat sandbox %q", s.ID)
@@ -1131,9 +2493,10 @@ func (s *Sandbox) IsRunning() bool {
 	return false
 }
 
-// Stacks collects and returns all stacks for the sandbox.
-func (s *Sandbox) Stacks() (string, error) {
-	log.Debugf("Stacks sandbox %q", s.ID)
+// Stacks collects and returns the stacks of the sandbox that pass the filters
+// of args, or all of them if none is set.
+func (s *Sandbox) Stacks(args boot.StacksArgs) (string, error) {
+	log.Debugf("Stacks sandbox %q, args: %+v", s.ID, args)
 	conn, err := s.sandboxConnect()
 	if err != nil {
 		return "", err
@@ -1141,14 +2504,245 @@ func (s *Sandbox) Stacks() (string, error) {
 	defer conn.Close()
 
 	var stacks string
-	if err := conn.Call(boot.DebugStacks, nil, &stacks); err != nil {
+	if err := conn.Call(boot.DebugStacks, &args, &stacks); err != nil {
 		return "", fmt.Errorf("getting sandbox %q stacks: %v", s.ID, err)
 	}
 	return stacks, nil
 }
 
+// SetLogOutput switches the sandbox logs to the given file.
+func (s *Sandbox) SetLogOutput(f *os.File) error {
+	log.Debugf("Set log output %q for sandbox %q", f.Name(), s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.SetLogOutputArgs{
+		FilePayload: urpc.FilePayload{
+			Files: []*os.File{f},
+		},
+	}
+	if err := conn.Call(boot.DebugSetLogOutput, &args, nil); err != nil {
+		return fmt.Errorf("setting sandbox %q log output: %v", s.ID, err)
+	}
+	return nil
+}
+
+// SetDrainMode enables or disables drain mode. In drain mode, the sandbox
+// refuses to start new containers while existing ones keep running.
+func (s *Sandbox) SetDrainMode(enable bool) error {
+	log.Debugf("Set drain mode to %t for sandbox %q", enable, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.Call(boot.ContMgrSetDrainMode, &enable, nil); err != nil {
+		return fmt.Errorf("setting sandbox %q drain mode: %v", s.ID, err)
+	}
+	return nil
+}
+
+// DrainMode returns whether the sandbox is in drain mode.
+func (s *Sandbox) DrainMode() (bool, error) {
+	log.Debugf("Get drain mode for sandbox %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	var draining bool
+	if err := conn.Call(boot.ContMgrDrainMode, nil, &draining); err != nil {
+		return false, fmt.Errorf("getting sandbox %q drain mode: %v", s.ID, err)
+	}
+	return draining, nil
+}
+
+// SetOOMBehavior sets how the sandbox reacts when it runs out of memory, see
+// boot.debug.SetOOMBehavior.
+func (s *Sandbox) SetOOMBehavior(behavior string) error {
+	log.Debugf("Set OOM behavior %q for sandbox %q", behavior, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.Call(boot.DebugSetOOMBehavior, &behavior, nil); err != nil {
+		return fmt.Errorf("setting sandbox %q OOM behavior: %v", s.ID, err)
+	}
+	return nil
+}
+
+// OOMState returns the OOM behavior and statistics of the sandbox.
+func (s *Sandbox) OOMState() (*boot.OOMState, error) {
+	log.Debugf("Get OOM state for sandbox %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var state boot.OOMState
+	if err := conn.Call(boot.DebugOOMState, nil, &state); err != nil {
+		return nil, fmt.Errorf("getting sandbox %q OOM state: %v", s.ID, err)
+	}
+	return &state, nil
+}
+
+// ResolveOOM resumes the sandbox tasks paused on out of memory.
+func (s *Sandbox) ResolveOOM() error {
+	log.Debugf("Resolve OOM for sandbox %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.Call(boot.DebugResolveOOM, nil, nil); err != nil {
+		return fmt.Errorf("resolving sandbox %q OOM: %v", s.ID, err)
+	}
+	return nil
+}
+
+// MadviseMode returns whether the sandbox releases memory freed by the
+// application to the host, see kernel.MadviseMode.
+func (s *Sandbox) MadviseMode() (string, error) {
+	log.Debugf("Get madvise mode for sandbox %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	var mode string
+	if err := conn.Call(boot.DebugGetMadviseMode, nil, &mode); err != nil {
+		return "", fmt.Errorf("getting sandbox %q madvise mode: %v", s.ID, err)
+	}
+	return mode, nil
+}
+
+// SetWatchdogConfig changes the task timeout and action of the sandbox
+// watchdog.
+func (s *Sandbox) SetWatchdogConfig(timeout time.Duration, action watchdog.Action) error {
+	log.Debugf("Set watchdog task timeout %v and action %v for sandbox %q", timeout, action, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	args := boot.WatchdogConfig{TaskTimeout: timeout, Action: action}
+	if err := conn.Call(boot.DebugSetWatchdogConfig, &args, nil); err != nil {
+		return fmt.Errorf("setting sandbox %q watchdog config: %v", s.ID, err)
+	}
+	return nil
+}
+
+// WatchdogStatus returns the state of the sandbox watchdog.
+func (s *Sandbox) WatchdogStatus() (*watchdog.Status, error) {
+	log.Debugf("Get watchdog status for sandbox %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var status watchdog.Status
+	if err := conn.Call(boot.DebugWatchdogStatus, nil, &status); err != nil {
+		return nil, fmt.Errorf("getting sandbox %q watchdog status: %v", s.ID, err)
+	}
+	return &status, nil
+}
+
+// SetLogLevel sets the sandbox log level and returns the previous one.
+func (s *Sandbox) SetLogLevel(level log.Level) (log.Level, error) {
+	log.Debugf("Set log level %v for sandbox %q", level, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	var old log.Level
+	if err := conn.Call(boot.DebugSetLogLevel, &level, &old); err != nil {
+		return 0, fmt.Errorf("setting sandbox %q log level: %v", s.ID, err)
+	}
+	return old, nil
+}
+
+// Metrics returns goroutine, task and host FD counts of the sandbox.
+func (s *Sandbox) Metrics() (*boot.Metrics, error) {
+	log.Debugf("Get metrics for sandbox %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var metrics boot.Metrics
+	if err := conn.Call(boot.DebugMetrics, nil, &metrics); err != nil {
+		return nil, fmt.Errorf("getting sandbox %q metrics: %v", s.ID, err)
+	}
+	return &metrics, nil
+}
+
+// SetMadviseMode sets whether the sandbox releases memory freed by the
+// application to the host, see kernel.MadviseMode.
+func (s *Sandbox) SetMadviseMode(mode string) error {
+	log.Debugf("Set madvise mode %q for sandbox %q", mode, s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.Call(boot.DebugSetMadviseMode, &mode, nil); err != nil {
+		return fmt.Errorf("setting sandbox %q madvise mode: %v", s.ID, err)
+	}
+	return nil
+}
+
+// GoroutineHistory returns the goroutine and thread counts sampled by the
+// sandbox, oldest first.
+func (s *Sandbox) GoroutineHistory() ([]boot.GoroutineSample, error) {
+	log.Debugf("Get goroutine history for sandbox %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var history []boot.GoroutineSample
+	if err := conn.Call(boot.DebugGoroutineHistory, nil, &history); err != nil {
+		return nil, fmt.Errorf("getting sandbox %q goroutine history: %v", s.ID, err)
+	}
+	return history, nil
+}
+
+// EmulationInfo returns the features that the sandbox emulates or passes
+// through to the host.
+func (s *Sandbox) EmulationInfo() (boot.EmulationInfo, error) {
+	log.Debugf("Get emulation info for sandbox %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return boot.EmulationInfo{}, err
+	}
+	defer conn.Close()
+
+	var info boot.EmulationInfo
+	if err := conn.Call(boot.DebugEmulationInfo, nil, &info); err != nil {
+		return boot.EmulationInfo{}, fmt.Errorf("getting sandbox %q emulation info: %v", s.ID, err)
+	}
+	return info, nil
+}
+
 // HeapProfile writes a heap profile to the given file.
-func (s *Sandbox) HeapProfile(f *os.File, delay time.Duration) error {
+func (s *Sandbox) HeapProfile(f *os.File, delay time.Duration, skipGC bool) error {
 	log.Debugf("Heap profile %q", s.ID)
 	conn, err := s.sandboxConnect()
 	if err != nil {
@@ -1159,10 +2753,28 @@ func (s *Sandbox) HeapProfile(f *os.File, delay time.Duration) error {
 	opts := control.HeapProfileOpts{
 		FilePayload: urpc.FilePayload{Files: []*os.File{f}},
 		Delay:       delay,
+		SkipGC:      skipGC,
 	}
 	return conn.Call(boot.ProfileHeap, &opts, nil)
 }
 
+// GoroutineProfile writes a goroutine profile in pprof format to the given
+// file.
+func (s *Sandbox) GoroutineProfile(f *os.File) error {
+	log.Debugf("Goroutine profile %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	opts := control.GoroutineProfileOpts{
+		FilePayload: urpc.FilePayload{Files: []*os.File{f}},
+		Proto:       true,
+	}
+	return conn.Call(boot.ProfileGoroutine, &opts, nil)
+}
+
 // CPUProfile collects a CPU profile.
 func (s *Sandbox) CPUProfile(f *os.File, duration time.Duration) error {
 	log.Debugf("CPU profile %q", s.ID)
@@ -1179,6 +2791,35 @@ func (s *Sandbox) CPUProfile(f *os.File, duration time.Duration) error {
 	return conn.Call(boot.ProfileCPU, &opts, nil)
 }
 
+// StartCPUProfile starts collecting a CPU profile into the given file, until
+// StopCPUProfile is called or for the given duration if it's positive.
+func (s *Sandbox) StartCPUProfile(f *os.File, duration time.Duration) error {
+	log.Debugf("Start CPU profile %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	opts := control.CPUProfileOpts{
+		FilePayload: urpc.FilePayload{Files: []*os.File{f}},
+		Duration:    duration,
+	}
+	return conn.Call(boot.ProfileStartCPU, &opts, nil)
+}
+
+// StopCPUProfile stops the CPU profile started by StartCPUProfile.
+func (s *Sandbox) StopCPUProfile() error {
+	log.Debugf("Stop CPU profile %q", s.ID)
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Call(boot.ProfileStopCPU, nil, nil)
+}
+
 // BlockProfile writes a block profile to the given file.
 func (s *Sandbox) BlockProfile(f *os.File, duration time.Duration) error {
 	log.Debugf("Block profile %q", s.ID)
@@ -1245,7 +2886,14 @@ func (s *Sandbox) ChangeLogging(args control.LoggingArgs) error {
 // DestroyContainer destroys the given container. If it is the root container,
 // then the entire sandbox is destroyed.
 func (s *Sandbox) DestroyContainer(cid string) error {
-	if err := s.destroyContainer(cid); err != nil {
+	return s.DestroyContainerGracefully(cid, 0)
+}
+
+// DestroyContainerGracefully is like DestroyContainer, but if grace isn't 0,
+// the container init is first sent SIGTERM and given up to grace to exit
+// before the container is killed.
+func (s *Sandbox) DestroyContainerGracefully(cid string, grace time.Duration) error {
+	if err := s.destroyContainer(cid, grace); err != nil {
 		// If the sandbox isn't running, the container has already been destroyed,
 		// ignore the error in this case.
 		if s.IsRunning() {
@@ -1255,24 +2903,62 @@ func (s *Sandbox) DestroyContainer(cid string) error {
 	return nil
 }
 
-func (s *Sandbox) destroyContainer(cid string) error {
+func (s *Sandbox) destroyContainer(cid string, grace time.Duration) error {
 	if s.IsRootContainer(cid) {
+		if grace > 0 {
+			s.terminateRootContainer(cid, grace)
+		}
 		log.Debugf("Destroying root container by destroying sandbox, cid: %s", cid)
 		return s.destroy()
 	}
 
-	log.Debugf("Destroying container, cid: %s, sandbox: %s", cid, s.ID)
+	log.Debugf("Destroying container, cid: %s, sandbox: %s, grace period: %v", cid, s.ID, grace)
 	conn, err := s.sandboxConnect()
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
-	if err := conn.Call(boot.ContMgrDestroySubcontainer, &cid, nil); err != nil {
-		return fmt.Errorf("destroying container %q: %v", cid, err)
+	args := boot.DestroyArgs{CID: cid}
+	if grace > 0 {
+		// Don't turn a grace period shorter than 1ms into no grace period.
+		args.GracefulTimeoutMs = grace.Milliseconds()
+		if args.GracefulTimeoutMs == 0 {
+			args.GracefulTimeoutMs = 1
+		}
+	}
+	if err := conn.Call(boot.ContMgrDestroySubcontainer, &args, nil); err != nil {
+		return fmt.Errorf("destroying container %q: %w", cid, err)
 	}
 	return nil
 }
 
+// terminateRootContainer sends SIGTERM to the init process of the root
+// container and waits up to grace for it to exit. Errors are only logged, as
+// the sandbox is destroyed afterwards anyway.
+func (s *Sandbox) terminateRootContainer(cid string, grace time.Duration) {
+	if err := s.SignalContainer(cid, unix.SIGTERM, false); err != nil {
+		log.Warningf("Sending SIGTERM to root container %q: %v", cid, err)
+		return
+	}
+	deadline := time.Now().Add(grace)
+	for {
+		_, err := s.WaitNoHang(cid)
+		if err == nil {
+			log.Debugf("Root container %q exited after SIGTERM", cid)
+			return
+		}
+		if !errors.Is(err, boot.ErrStillRunning) {
+			log.Warningf("Waiting for root container %q after SIGTERM: %v", cid, err)
+			return
+		}
+		if time.Now().After(deadline) {
+			log.Infof("Root container %q didn't exit %v after SIGTERM, destroying the sandbox", cid, grace)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 func (s *Sandbox) waitForStopped() error {
 	if s.child {
 		s.statusMu.Lock()
@@ -107,10 +107,11 @@ func ValidateSpec(spec *specs.Spec) error {
 		log.Warningf("AppArmor profile %q is being ignored", spec.Process.ApparmorProfile)
 	}
 
-	// PR_SET_NO_NEW_PRIVS is assumed to always be set.
-	// See kernel.Task.updateCredsForExecLocked.
+	// Execve behaves as if PR_SET_NO_NEW_PRIVS is always set, even though
+	// the bit is only reported once set. See
+	// kernel.Task.updateCredsForExecLocked.
 	if !spec.Process.NoNewPrivileges {
-		log.Warningf("noNewPrivileges ignored. PR_SET_NO_NEW_PRIVS is assumed to always be set.")
+		log.Warningf("noNewPrivileges ignored. Execve behaves as if PR_SET_NO_NEW_PRIVS is set.")
 	}
 
 	if spec.Linux != nil && spec.Linux.RootfsPropagation != "" {
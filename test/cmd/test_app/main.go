@@ -26,12 +26,15 @@ import (
 	"os"
 	"os/exec"
 	"regexp"
+	"runtime"
 	"strconv"
 	sys "syscall"
 	"time"
+	"unsafe"
 
 	"github.com/google/subcommands"
 	"github.com/kr/pty"
+	"golang.org/x/sys/unix"
 	"gvisor.dev/gvisor/pkg/test/testutil"
 	"gvisor.dev/gvisor/runsc/flag"
 )
@@ -43,10 +46,13 @@ func main() {
 	subcommands.Register(new(fdReceiver), "")
 	subcommands.Register(new(fdSender), "")
 	subcommands.Register(new(forkBomb), "")
+	subcommands.Register(new(pollObjects), "")
 	subcommands.Register(new(ptyRunner), "")
 	subcommands.Register(new(reaper), "")
+	subcommands.Register(new(sigqueueWait), "")
 	subcommands.Register(new(syscall), "")
 	subcommands.Register(new(taskTree), "")
+	subcommands.Register(new(tcpPing), "")
 	subcommands.Register(new(uds), "")
 
 	flag.Parse()
@@ -300,6 +306,194 @@ func (s *syscall) Execute(ctx context.Context, f *flag.FlagSet, args ...interfac
 	return subcommands.ExitSuccess
 }
 
+type pollObjects struct {
+	eventValue uint
+}
+
+// Name implements subcommands.Command.
+func (*pollObjects) Name() string {
+	return "poll-objects"
+}
+
+// Synopsis implements subcommands.Command.
+func (*pollObjects) Synopsis() string {
+	return "creates an epoll instance watching an eventfd and a timerfd, and waits forever"
+}
+
+// Usage implements subcommands.Command.
+func (*pollObjects) Usage() string {
+	return "poll-objects <flags>"
+}
+
+// SetFlags implements subcommands.Command.
+func (p *pollObjects) SetFlags(f *flag.FlagSet) {
+	f.UintVar(&p.eventValue, "event-value", 0, "initial value of the eventfd")
+}
+
+// Execute implements subcommands.Command.
+func (p *pollObjects) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	efd, err := unix.Eventfd(p.eventValue, 0)
+	if err != nil {
+		log.Fatalf("eventfd failed: %v", err)
+	}
+	tfd, err := unix.TimerfdCreate(unix.CLOCK_MONOTONIC, 0)
+	if err != nil {
+		log.Fatalf("timerfd_create failed: %v", err)
+	}
+	spec := unix.ItimerSpec{
+		Interval: unix.NsecToTimespec(int64(time.Hour)),
+		Value:    unix.NsecToTimespec(int64(time.Hour)),
+	}
+	if err := unix.TimerfdSettime(tfd, 0, &spec, nil); err != nil {
+		log.Fatalf("timerfd_settime failed: %v", err)
+	}
+	epfd, err := unix.EpollCreate1(0)
+	if err != nil {
+		log.Fatalf("epoll_create1 failed: %v", err)
+	}
+	for _, fd := range []int{efd, tfd} {
+		event := unix.EpollEvent{Events: unix.EPOLLIN, Fd: int32(fd)}
+		if err := unix.EpollCtl(epfd, unix.EPOLL_CTL_ADD, fd, &event); err != nil {
+			log.Fatalf("epoll_ctl(%d) failed: %v", fd, err)
+		}
+	}
+	select {}
+}
+
+const (
+	// sigqueueBlockedEnv is set once sigqueue-wait has blocked the signal
+	// and re-executed itself.
+	sigqueueBlockedEnv = "SIGQUEUE_WAIT_BLOCKED"
+
+	// siQueue is SI_QUEUE, the si_code of signals sent by sigqueue(3).
+	siQueue = -1
+)
+
+type sigqueueWait struct {
+	signal int
+	value  int64
+}
+
+// Name implements subcommands.Command.
+func (*sigqueueWait) Name() string {
+	return "sigqueue-wait"
+}
+
+// Synopsis implements subcommands.Command.
+func (*sigqueueWait) Synopsis() string {
+	return "waits for a queued realtime signal and checks the value passed with it"
+}
+
+// Usage implements subcommands.Command.
+func (*sigqueueWait) Usage() string {
+	return "sigqueue-wait <flags>"
+}
+
+// SetFlags implements subcommands.Command.
+func (s *sigqueueWait) SetFlags(f *flag.FlagSet) {
+	f.IntVar(&s.signal, "signal", 0, "realtime signal to wait for")
+	f.Int64Var(&s.value, "value", 0, "value expected in si_value")
+}
+
+// Execute implements subcommands.Command.
+func (s *sigqueueWait) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	var set unix.Sigset_t
+	set.Val[(s.signal-1)/64] |= 1 << (uint(s.signal-1) % 64)
+
+	if os.Getenv(sigqueueBlockedEnv) == "" {
+		// The Go runtime handles all signals in every thread, so block
+		// the signal before exec: the runtime keeps the inherited mask in
+		// all threads it creates.
+		runtime.LockOSThread()
+		if _, _, errno := unix.RawSyscall6(unix.SYS_RT_SIGPROCMASK, unix.SIG_BLOCK, uintptr(unsafe.Pointer(&set)), 0, 8, 0, 0); errno != 0 {
+			log.Fatalf("rt_sigprocmask failed: %v", errno)
+		}
+		env := append(os.Environ(), sigqueueBlockedEnv+"=1")
+		if err := unix.Exec("/proc/self/exe", os.Args, env); err != nil {
+			log.Fatalf("exec failed: %v", err)
+		}
+	}
+	fmt.Println("ready")
+
+	// struct siginfo is 128 bytes. For SI_QUEUE, si_pid and si_uid are
+	// followed by si_value at offset 24.
+	var info [128]byte
+	for {
+		_, _, errno := unix.Syscall6(unix.SYS_RT_SIGTIMEDWAIT, uintptr(unsafe.Pointer(&set)), uintptr(unsafe.Pointer(&info[0])), 0, 8, 0, 0)
+		if errno == unix.EINTR {
+			continue
+		}
+		if errno != 0 {
+			log.Fatalf("rt_sigtimedwait failed: %v", errno)
+		}
+		break
+	}
+	signo := *(*int32)(unsafe.Pointer(&info[0]))
+	code := *(*int32)(unsafe.Pointer(&info[8]))
+	value := *(*int64)(unsafe.Pointer(&info[24]))
+	if int(signo) != s.signal || code != siQueue || value != s.value {
+		log.Fatalf("got signal %d, code %d, value %d, want signal %d, code %d, value %d", signo, code, value, s.signal, siQueue, s.value)
+	}
+	fmt.Printf("signal %d received with value %d\n", signo, value)
+	return subcommands.ExitSuccess
+}
+
+type tcpPing struct{}
+
+// Name implements subcommands.Command.
+func (*tcpPing) Name() string {
+	return "tcp-ping"
+}
+
+// Synopsis implements subcommands.Command.
+func (*tcpPing) Synopsis() string {
+	return "connects to a TCP listener on the loopback interface and exchanges a message"
+}
+
+// Usage implements subcommands.Command.
+func (*tcpPing) Usage() string {
+	return "tcp-ping"
+}
+
+// SetFlags implements subcommands.Command.
+func (*tcpPing) SetFlags(*flag.FlagSet) {}
+
+// Execute implements subcommands.Command.
+func (*tcpPing) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatalf("listen failed: %v", err)
+	}
+	defer l.Close()
+
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			log.Fatalf("accept failed: %v", err)
+		}
+		defer c.Close()
+		io.Copy(c, c)
+	}()
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		log.Fatalf("dial failed: %v", err)
+	}
+	defer c.Close()
+	const msg = "ping"
+	if _, err := c.Write([]byte(msg)); err != nil {
+		log.Fatalf("write failed: %v", err)
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(c, buf); err != nil {
+		log.Fatalf("read failed: %v", err)
+	}
+	if got := string(buf); got != msg {
+		log.Fatalf("read got: %q, want: %q", got, msg)
+	}
+	return subcommands.ExitSuccess
+}
+
 type capability struct {
 	enabled  uint64
 	disabled uint64